@@ -0,0 +1,43 @@
+package mist
+
+// Abort stops the handling of the request: the middleware and handlers that have not run yet
+// are skipped, even when the current middleware calls next anyway. The middleware already
+// running still completes, and the response built so far is flushed.
+func (c *Context) Abort() {
+	c.Aborted = true
+}
+
+// AbortWithJSON responds with val serialized as JSON and stops the handling of the request,
+// see Abort. Serialization failures are handled by the MarshalErrorHandler of the server.
+//
+// Example:
+//
+//	if !allowed {
+//	    ctx.AbortWithJSON(http.StatusForbidden, map[string]string{"error": "forbidden"})
+//	    return
+//	}
+//
+// Parameters:
+//   - status: The HTTP status code of the response.
+//   - val: The body of the response.
+func (c *Context) AbortWithJSON(status int, val any) {
+	_ = c.RespondWithJSON(status, val)
+	c.Abort()
+}
+
+// IsAborted reports whether the handling of the request was stopped with Abort,
+// AbortWithStatus or AbortWithJSON.
+func (c *Context) IsAborted() bool {
+	return c.Aborted
+}
+
+// skipAborted wraps next so that it is not invoked for aborted requests. The chain runner
+// places it before every middleware and handler.
+func skipAborted(next HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		if ctx.Aborted {
+			return
+		}
+		next(ctx)
+	}
+}
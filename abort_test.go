@@ -0,0 +1,78 @@
+package mist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestAbortNestedGroups aborts the chain of a route registered in a nested group from each level
+// of middleware, and checks that the later middleware and the handler never run while the
+// response of the abort is flushed.
+func TestAbortNestedGroups(t *testing.T) {
+	testCases := []struct {
+		name    string
+		abortAt string
+		wantRun []string
+	}{
+		{name: "group middleware", abortAt: "group", wantRun: []string{"server", "group"}},
+		{name: "nested group middleware", abortAt: "nested", wantRun: []string{"server", "group", "nested"}},
+		{name: "route middleware", abortAt: "route", wantRun: []string{"server", "group", "nested", "route"}},
+		{name: "no abort", wantRun: []string{"server", "group", "nested", "route", "handler"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var run []string
+			mw := func(name string) Middleware {
+				return func(next HandleFunc) HandleFunc {
+					return func(ctx *Context) {
+						run = append(run, name)
+						if name == tc.abortAt {
+							ctx.AbortWithJSON(http.StatusForbidden, map[string]string{"aborted": name})
+						}
+						// Calling next after Abort must not resume the chain.
+						next(ctx)
+					}
+				}
+			}
+
+			server := InitHTTPServer()
+			server.Use(mw("server"))
+			server.UseRoute(http.MethodGet, "/api", mw("group"))
+			server.Group("/api/v1", mw("nested")).GET("/users", func(ctx *Context) {
+				run = append(run, "handler")
+				_ = ctx.RespondWithJSON(http.StatusOK, "users")
+			}, mw("route"))
+
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/users", nil))
+
+			if !reflect.DeepEqual(run, tc.wantRun) {
+				t.Fatalf("run = %v, want %v", run, tc.wantRun)
+			}
+			if tc.abortAt == "" {
+				if recorder.Code != http.StatusOK || recorder.Body.String() != `"users"` {
+					t.Fatalf("response = %d %s, want 200 \"users\"", recorder.Code, recorder.Body)
+				}
+				return
+			}
+			wantBody := `{"aborted":"` + tc.abortAt + `"}`
+			if recorder.Code != http.StatusForbidden || recorder.Body.String() != wantBody {
+				t.Fatalf("response = %d %s, want 403 %s", recorder.Code, recorder.Body, wantBody)
+			}
+		})
+	}
+}
+
+// TestIsAborted checks that Abort is reported by IsAborted.
+func TestIsAborted(t *testing.T) {
+	ctx := &Context{}
+	if ctx.IsAborted() {
+		t.Fatal("new context is aborted")
+	}
+	ctx.Abort()
+	if !ctx.IsAborted() {
+		t.Fatal("aborted context is not reported as aborted")
+	}
+}
@@ -0,0 +1,118 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist/internal/errs"
+	"sync"
+	"time"
+)
+
+// taskGroup tracks the asynchronous work started through Context.Async so that a graceful
+// shutdown can wait for it. Once closed, no new work is accepted.
+type taskGroup struct {
+	mutex   sync.Mutex
+	wg      sync.WaitGroup
+	closed  bool
+	onPanic func(ctx *Context, err any)
+}
+
+// add registers a new task, reporting false when the group no longer accepts work.
+func (g *taskGroup) add() bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	return true
+}
+
+// close stops the group from accepting new work.
+func (g *taskGroup) close() {
+	g.mutex.Lock()
+	g.closed = true
+	g.mutex.Unlock()
+}
+
+// wait blocks until every registered task has finished or ctx is done.
+func (g *taskGroup) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// defaultAsyncPanicHandler reports panics of asynchronous work to standard output.
+func defaultAsyncPanicHandler(ctx *Context, err any) {
+	fmt.Printf("%s - async task panic: %v\n", time.Now().Format(time.RFC3339), err)
+}
+
+// ServerWithAsyncPanicHandler is a configuration function that returns an HTTPServerOption.
+// It sets the function invoked when work started with Context.Async panics. The panic is
+// always recovered, so a failing background task never crashes the process.
+//
+// Parameters:
+//   - handler: The function receiving the detached context of the task and the recovered value.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified handler.
+func ServerWithAsyncPanicHandler(handler func(ctx *Context, err any)) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.tasks.onPanic = handler
+	}
+}
+
+// Async runs fn on a new goroutine with a detached copy of the context (see Detach), so the
+// work can safely outlive the request without touching the original Context, its request
+// body or its ResponseWriter after the response has been written.
+//
+// Panics raised by fn are recovered and reported to the server's async panic handler. The
+// task is tracked by the server: Shutdown waits for it to finish during the graceful drain,
+// and once the drain has started new tasks are rejected.
+//
+// Example:
+//
+//	server.POST("/orders", func(ctx *mist.Context) {
+//	    // ... create the order ...
+//	    _ = ctx.Async(func(detached *mist.Context) {
+//	        sendConfirmationMail(detached.CopyToContext(context.Background()), order)
+//	    })
+//	    ctx.RespStatusCode = http.StatusAccepted
+//	})
+//
+// Parameters:
+//   - fn: The work to run; it receives the detached context.
+//
+// Returns:
+//   - error: An error if the server is shutting down and the work was not started.
+func (c *Context) Async(fn func(detached *Context)) error {
+	tasks := c.tasks
+	if tasks != nil && !tasks.add() {
+		return errs.ErrServerShuttingDown()
+	}
+	detached := c.Detach()
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				handler := defaultAsyncPanicHandler
+				if tasks != nil && tasks.onPanic != nil {
+					handler = tasks.onPanic
+				}
+				handler(detached, err)
+			}
+			if tasks != nil {
+				tasks.wg.Done()
+			}
+		}()
+		fn(detached)
+	}()
+	return nil
+}
@@ -0,0 +1,300 @@
+package mist
+
+import (
+	"context"
+	"github.com/dormoron/mist/internal/errs"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// baggageHeader is the W3C Baggage request header.
+	baggageHeader = "baggage"
+	// baggageKey is the key under which the request's Baggage is stored in Context.Keys, so
+	// that CopyToContext and Detach carry it along.
+	baggageKey = "mist.baggage"
+	// maxBaggageMembers and maxBaggageBytes are the limits of the W3C Baggage specification.
+	maxBaggageMembers = 64
+	maxBaggageBytes   = 8192
+)
+
+// baggageCtxKey is the key of a Baggage attached to a standard context with ContextWithBaggage.
+type baggageCtxKey struct{}
+
+// BaggageMember is a single entry of the W3C Baggage header.
+//
+// Fields:
+//   - Key: The name of the entry.
+//   - Value: The decoded value of the entry.
+//   - Properties: The raw properties following the value, e.g. "ttl=60"; usually empty.
+type BaggageMember struct {
+	Key        string
+	Value      string
+	Properties string
+}
+
+// Baggage holds the W3C Baggage of a request: key-value pairs such as the tenant or the
+// experiment arm that travel with a request across services. It is safe for concurrent use.
+type Baggage struct {
+	mutex   sync.RWMutex
+	members []BaggageMember
+}
+
+// ParseBaggage parses the value of a W3C Baggage header. Malformed members are skipped, and
+// members beyond the limits of the specification (64 members, 8192 bytes) are dropped.
+//
+// Parameters:
+//   - header: The header value, e.g. "tenant=acme,experiment=checkout-v2".
+//
+// Returns:
+//   - *Baggage: The parsed baggage; empty if the header is empty.
+func ParseBaggage(header string) *Baggage {
+	b := &Baggage{}
+	if len(header) > maxBaggageBytes {
+		header = header[:maxBaggageBytes]
+	}
+	for _, raw := range strings.Split(header, ",") {
+		if len(b.members) == maxBaggageMembers {
+			break
+		}
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		pair, props, _ := strings.Cut(raw, ";")
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validBaggageKey(key) {
+			continue
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		b.set(BaggageMember{Key: key, Value: value, Properties: strings.TrimSpace(props)})
+	}
+	return b
+}
+
+// Get returns the value of a member.
+func (b *Baggage) Get(key string) (string, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, m := range b.members {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set adds a member or replaces its value. Set members are propagated to downstream services
+// by BaggageTransport.
+//
+// Parameters:
+//   - key: The name of the member; it must be a valid HTTP token.
+//   - value: The value of the member; it is percent-encoded when propagated.
+//
+// Returns:
+//   - error: An error if the key is invalid or the baggage would exceed 64 members.
+func (b *Baggage) Set(key string, value string) error {
+	if !validBaggageKey(key) {
+		return errs.ErrInvalidBaggage(key)
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.set(BaggageMember{Key: key, Value: value}) {
+		return errs.ErrInvalidBaggage(key)
+	}
+	return nil
+}
+
+// set adds or replaces a member; the caller holds the lock. It reports false if the baggage is
+// full.
+func (b *Baggage) set(member BaggageMember) bool {
+	for i, m := range b.members {
+		if m.Key == member.Key {
+			b.members[i] = member
+			return true
+		}
+	}
+	if len(b.members) == maxBaggageMembers {
+		return false
+	}
+	b.members = append(b.members, member)
+	return true
+}
+
+// Delete removes a member, so that it is no longer propagated.
+func (b *Baggage) Delete(key string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, m := range b.members {
+		if m.Key == key {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// Members returns a copy of the members, in header order.
+func (b *Baggage) Members() []BaggageMember {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return append([]BaggageMember(nil), b.members...)
+}
+
+// Len returns the number of members.
+func (b *Baggage) Len() int {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return len(b.members)
+}
+
+// String encodes the baggage as a W3C Baggage header value. Members that would push the header
+// beyond 8192 bytes are left out.
+func (b *Baggage) String() string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	var sb strings.Builder
+	for _, m := range b.members {
+		entry := m.Key + "=" + escapeBaggageValue(m.Value)
+		if m.Properties != "" {
+			entry += ";" + m.Properties
+		}
+		size := len(entry)
+		if sb.Len() > 0 {
+			size++
+		}
+		if sb.Len()+size > maxBaggageBytes {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(entry)
+	}
+	return sb.String()
+}
+
+// Baggage returns the W3C Baggage of the request, parsed from the "baggage" header on first
+// use. Members set on it are visible to later handlers, carried by CopyToContext and Detach, and
+// forwarded to downstream services by BaggageTransport when the request is made with the
+// Context (or a context derived with CopyToContext).
+//
+// Example:
+//
+//	tenant, _ := ctx.Baggage().Get("tenant")
+//	_ = ctx.Baggage().Set("experiment", "checkout-v2")
+//
+// Returns:
+//   - *Baggage: The request's baggage, never nil.
+func (c *Context) Baggage() *Baggage {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if b, ok := c.Keys[baggageKey].(*Baggage); ok {
+		return b
+	}
+	var header string
+	if c.Request != nil {
+		header = strings.Join(c.Request.Header.Values(baggageHeader), ",")
+	}
+	b := ParseBaggage(header)
+	if c.Keys == nil {
+		c.Keys = make(map[string]any)
+	}
+	c.Keys[baggageKey] = b
+	return b
+}
+
+// ContextWithBaggage returns a copy of parent carrying b, for outgoing requests made outside of
+// a mist handler.
+func ContextWithBaggage(parent context.Context, b *Baggage) context.Context {
+	return context.WithValue(parent, baggageCtxKey{}, b)
+}
+
+// BaggageFromContext returns the Baggage carried by ctx: the request baggage of a *Context or of
+// a context derived from one with CopyToContext, or a baggage attached with ContextWithBaggage.
+// It returns nil if ctx carries no baggage.
+func BaggageFromContext(ctx context.Context) *Baggage {
+	if b, ok := ctx.Value(baggageCtxKey{}).(*Baggage); ok {
+		return b
+	}
+	if c, ok := ctx.(*Context); ok {
+		return c.Baggage()
+	}
+	b, _ := ctx.Value(baggageKey).(*Baggage)
+	return b
+}
+
+// BaggageTransport returns an http.RoundTripper adding the baggage of the request's context to
+// outgoing requests, so that cross-service metadata flows without handlers copying headers.
+// Requests that already carry a baggage header are sent unchanged.
+//
+// Example:
+//
+//	client := &http.Client{Transport: mist.BaggageTransport(nil)}
+//	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, inventoryURL, nil)
+//	resp, err := client.Do(req)
+//
+// Parameters:
+//   - next: The transport sending the requests; nil uses http.DefaultTransport.
+//
+// Returns:
+//   - http.RoundTripper: The propagating transport.
+func BaggageTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return baggageTransport{next: next}
+}
+
+// baggageTransport is the http.RoundTripper returned by BaggageTransport.
+type baggageTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTrip sets the baggage header from the request's context and sends the request.
+func (t baggageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(baggageHeader) == "" {
+		if b := BaggageFromContext(req.Context()); b != nil && b.Len() > 0 {
+			req = req.Clone(req.Context())
+			req.Header.Set(baggageHeader, b.String())
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// validBaggageKey reports whether key is an HTTP token, as required for baggage keys.
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeBaggageValue percent-encodes the bytes of value that are not allowed in a baggage
+// value: controls, whitespace, '"', ',', ';', '\\', '%' and non-ASCII bytes.
+func escapeBaggageValue(value string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' || c == '%' {
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&0xf])
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,275 @@
+// Package batch serves many API calls in a single HTTP request, saving mobile clients the
+// round trips. A batch is a JSON array of sub-requests:
+//
+//	[
+//	  {"id": "me", "method": "GET", "path": "/users/me"},
+//	  {"id": "order", "method": "POST", "path": "/orders", "body": {"sku": "A1", "qty": 2}}
+//	]
+//
+// Each sub-request is dispatched through the server's router and middleware as if it had been
+// sent on its own, and the response is an array of results in the same order:
+//
+//	[
+//	  {"id": "me", "status": 200, "headers": {"Content-Type": "application/json"}, "body": {"id": 7}},
+//	  {"id": "order", "status": 201, "headers": {...}, "body": {...}}
+//	]
+//
+// Sub-requests are isolated: the failure, or even the panic, of one of them is reported in its
+// result and does not affect the others.
+package batch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Request is a sub-request of a batch.
+//
+// Fields:
+//   - ID: An identifier chosen by the client, copied to the result.
+//   - Method: The HTTP method.
+//   - Path: The path and query of the sub-request, e.g. "/orders?status=open".
+//   - Headers: Headers of the sub-request, added to the headers inherited from the batch.
+//   - Body: The JSON body of the sub-request, sent with Content-Type application/json.
+type Request struct {
+	ID      string            `json:"id,omitempty"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response is the result of a sub-request.
+//
+// Fields:
+//   - ID: The identifier of the sub-request.
+//   - Status: The HTTP status of the sub-request.
+//   - Headers: The response headers, first value only.
+//   - Body: The response body: the JSON document for JSON responses, a JSON string otherwise.
+type Response struct {
+	ID      string            `json:"id,omitempty"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Handler serves batches by dispatching their sub-requests to an http.Handler, usually the
+// server itself.
+type Handler struct {
+	handler        http.Handler
+	concurrency    int
+	maxRequests    int
+	inheritHeaders []string
+}
+
+// InitHandler creates a Handler dispatching sub-requests to handler. It runs up to 4
+// sub-requests at a time, accepts batches of up to 20 sub-requests, and passes the
+// Authorization, Cookie, Accept-Language and X-Request-ID headers of the batch on to every
+// sub-request.
+//
+// Example:
+//
+//	server := mist.InitHTTPServer()
+//	server.POST("/batch", batch.InitHandler(server).Handle)
+//
+// Parameters:
+//   - handler: The handler serving the sub-requests.
+//
+// Returns:
+//   - *Handler: The initialized handler.
+func InitHandler(handler http.Handler) *Handler {
+	return &Handler{
+		handler:        handler,
+		concurrency:    4,
+		maxRequests:    20,
+		inheritHeaders: []string{"Authorization", "Cookie", "Accept-Language", "X-Request-ID"},
+	}
+}
+
+// SetConcurrency sets how many sub-requests of a batch run at the same time. 1 runs them
+// sequentially, in order.
+func (h *Handler) SetConcurrency(n int) *Handler {
+	if n < 1 {
+		n = 1
+	}
+	h.concurrency = n
+	return h
+}
+
+// SetMaxRequests sets the maximum number of sub-requests in a batch; larger batches are
+// rejected with 413 Content Too Large.
+func (h *Handler) SetMaxRequests(n int) *Handler {
+	h.maxRequests = n
+	return h
+}
+
+// SetInheritHeaders sets the headers of the batch request passed on to every sub-request.
+func (h *Handler) SetInheritHeaders(names ...string) *Handler {
+	h.inheritHeaders = names
+	return h
+}
+
+// nestedKey marks the context of sub-requests, so that a batch sent as a sub-request, under any
+// path or encoding of it, is rejected instead of multiplying the requests served.
+type nestedKey struct{}
+
+// Handle is the mist.HandleFunc serving batches. Malformed batches, and batches sent as a
+// sub-request of another batch, are answered with a problem response; otherwise the response is
+// 200 OK with the array of results.
+func (h *Handler) Handle(ctx *mist.Context) {
+	if ctx.Request.Context().Value(nestedKey{}) != nil {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: "batches cannot be nested"})
+		return
+	}
+	var requests []Request
+	if err := ctx.Bind(&requests); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if h.maxRequests > 0 && len(requests) > h.maxRequests {
+		_ = ctx.RespondProblem(mist.Problem{
+			Status: http.StatusRequestEntityTooLarge,
+			Detail: fmt.Sprintf("a batch holds at most %d requests", h.maxRequests),
+		})
+		return
+	}
+
+	results := make([]Response, len(requests))
+	sem := make(chan struct{}, h.concurrency)
+	var wg sync.WaitGroup
+	for i := range requests {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = h.dispatch(ctx, requests[i])
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	ctx.Header("Content-Type", "application/json")
+	ctx.RespStatusCode = http.StatusOK
+	ctx.RespData = data
+}
+
+// dispatch serves a sub-request, turning invalid sub-requests and panics into error results.
+func (h *Handler) dispatch(ctx *mist.Context, sub Request) (res Response) {
+	res.ID = sub.ID
+	defer func() {
+		if r := recover(); r != nil {
+			res = problemResult(sub.ID, http.StatusInternalServerError, "the request failed")
+		}
+	}()
+
+	method := strings.ToUpper(sub.Method)
+	switch {
+	case method == "":
+		return problemResult(sub.ID, http.StatusBadRequest, "method is required")
+	case !strings.HasPrefix(sub.Path, "/"):
+		return problemResult(sub.ID, http.StatusBadRequest, "path must start with '/'")
+	}
+
+	reqCtx := context.WithValue(ctx.Request.Context(), nestedKey{}, true)
+	req, err := http.NewRequestWithContext(reqCtx, method, sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return problemResult(sub.ID, http.StatusBadRequest, "path is invalid")
+	}
+	req.RemoteAddr = ctx.Request.RemoteAddr
+	req.Host = ctx.Request.Host
+	req.TLS = ctx.Request.TLS
+	for _, name := range h.inheritHeaders {
+		if values := ctx.Request.Header.Values(name); len(values) > 0 {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range sub.Headers {
+		req.Header.Set(name, value)
+	}
+
+	rec := &recorder{header: make(http.Header)}
+	h.handler.ServeHTTP(rec, req)
+
+	res.Status = rec.status
+	if res.Status == 0 {
+		res.Status = http.StatusOK
+	}
+	if len(rec.header) > 0 {
+		res.Headers = make(map[string]string, len(rec.header))
+		for name := range rec.header {
+			res.Headers[name] = rec.header.Get(name)
+		}
+	}
+	res.Body = encodeBody(rec.header.Get("Content-Type"), rec.body.Bytes())
+	return res
+}
+
+// problemResult returns the result of a sub-request that could not be served.
+func problemResult(id string, status int, detail string) Response {
+	body, _ := json.Marshal(mist.Problem{Title: http.StatusText(status), Status: status, Detail: detail})
+	return Response{
+		ID:      id,
+		Status:  status,
+		Headers: map[string]string{"Content-Type": "application/problem+json"},
+		Body:    body,
+	}
+}
+
+// encodeBody embeds a response body in the result: JSON documents as is, anything else as a
+// JSON string.
+func encodeBody(contentType string, body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if strings.Contains(contentType, "json") && json.Valid(body) {
+		return body
+	}
+	encoded, err := json.Marshal(string(body))
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// recorder is the http.ResponseWriter of sub-requests.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header returns the response headers.
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+// Write buffers the response body.
+func (r *recorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(p)
+}
+
+// WriteHeader records the status, keeping the first one like net/http does.
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
@@ -0,0 +1,304 @@
+package mist
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/dormoron/mist/errcode"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/validation"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// BodyParser decodes the body of a request into val. Parsers may return *errcode.Error values
+// to choose the reported code; other errors are reported as "request.malformed_body".
+type BodyParser func(ctx *Context, val any) error
+
+// defaultBodyParsers are the parsers of every server, before RegisterBodyParser.
+var defaultBodyParsers = map[string]BodyParser{
+	"application/json":                  parseJSONBody,
+	"application/xml":                   parseXMLBody,
+	"text/xml":                          parseXMLBody,
+	"application/x-www-form-urlencoded": parseFormBody,
+	"multipart/form-data":               parseFormBody,
+}
+
+// RegisterBodyParser registers the parser used by Context.Bind for a media type, e.g.
+// "application/x-protobuf" or "application/cbor". Registering a built-in media type (JSON, XML
+// and forms) replaces its parser. Parsers must be registered before the server starts handling
+// requests.
+//
+// A parser registered for "application/json" or "application/xml" also decodes the media types
+// with the "+json" or "+xml" structured suffix, such as "application/merge-patch+json", unless
+// they have a parser of their own.
+//
+// Parameters:
+//   - contentType: The media type, without parameters.
+//   - parser: The parser.
+func (s *HTTPServer) RegisterBodyParser(contentType string, parser BodyParser) {
+	parsers := make(map[string]BodyParser, len(s.bodyParsers)+1)
+	for mediaType, p := range s.bodyParsers {
+		parsers[mediaType] = p
+	}
+	parsers[strings.ToLower(strings.TrimSpace(contentType))] = parser
+	s.bodyParsers = parsers
+}
+
+// Bind decodes the request body into val with the parser registered for its Content-Type.
+// Requests without a Content-Type are decoded as JSON. Failures are reported with catalog
+// codes, so they can be passed straight to RespondError:
+//   - a media type without parser yields an *errcode.Error with code
+//     "request.unsupported_media_type",
+//   - a missing body yields an *errcode.Error with code "request.empty_body",
+//   - a malformed body yields an *errcode.Error with code "request.malformed_body".
+//
+// Example:
+//
+//	server.RegisterBodyParser("application/cbor", func(ctx *mist.Context, val any) error {
+//	    return cbor.NewDecoder(ctx.Request.Body).Decode(val)
+//	})
+//
+//	var input CreateUser
+//	if err := c.Bind(&input); err != nil {
+//	    _ = c.RespondError(err)
+//	    return
+//	}
+//
+// Parameters:
+//   - val: A non-nil pointer to the value to populate.
+//
+// Returns:
+//   - error: nil on success, otherwise a coded error as described above.
+func (c *Context) Bind(val any) error {
+	if val == nil {
+		return errs.ErrInputNil()
+	}
+	mediaType := "application/json"
+	if header := c.Request.Header.Get("Content-Type"); header != "" {
+		parsed, _, err := mime.ParseMediaType(header)
+		if err != nil {
+			return errcode.New(errcode.CodeUnsupportedType, err)
+		}
+		mediaType = parsed
+	}
+	parser, ok := c.bodyParser(mediaType)
+	if !ok {
+		return &errcode.Error{Code: errcode.CodeUnsupportedType, Params: map[string]any{"type": mediaType}}
+	}
+	// A body cached by BodyBytes is decoded from the start, whoever read it before.
+	if c.bodyRead {
+		c.resetBody()
+	}
+	err := parser(c, val)
+	if err == nil {
+		return nil
+	}
+	var coded *errcode.Error
+	if errors.As(err, &coded) {
+		return err
+	}
+	return errcode.New(errcode.CodeMalformedBody, err)
+}
+
+// bodyParser returns the parser of a media type, falling back to the parser of its structured
+// suffix.
+func (c *Context) bodyParser(mediaType string) (BodyParser, bool) {
+	parsers := c.bodyParsers
+	if parsers == nil {
+		parsers = defaultBodyParsers
+	}
+	if parser, ok := parsers[mediaType]; ok {
+		return parser, true
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		parser, ok := parsers["application/json"]
+		return parser, ok
+	case strings.HasSuffix(mediaType, "+xml"):
+		parser, ok := parsers["application/xml"]
+		return parser, ok
+	}
+	return nil, false
+}
+
+// hasBody reports whether the request carries a body.
+func (c *Context) hasBody() bool {
+	return c.Request.Body != nil && c.Request.Body != http.NoBody
+}
+
+// parseJSONBody is the built-in JSON parser.
+func parseJSONBody(ctx *Context, val any) error {
+	if !ctx.hasBody() {
+		return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+	}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(val); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+		}
+		return errcode.New(errcode.CodeMalformedBody, err)
+	}
+	return nil
+}
+
+// parseXMLBody is the built-in XML parser.
+func parseXMLBody(ctx *Context, val any) error {
+	if !ctx.hasBody() {
+		return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+	}
+	if err := xml.NewDecoder(ctx.Request.Body).Decode(val); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+		}
+		return errcode.New(errcode.CodeMalformedBody, err)
+	}
+	return nil
+}
+
+// parseFormBody is the built-in parser of URL-encoded and multipart forms, see BindForm.
+func parseFormBody(ctx *Context, val any) error {
+	return ctx.BindForm(val)
+}
+
+// BindStream decodes a request body holding many JSON values one at a time, so bulk endpoints
+// process arbitrarily large uploads in constant memory. The body may be newline-delimited JSON
+// (application/x-ndjson, application/jsonl) or a JSON array (application/json); fn receives a
+// decode function reading the next value, which returns io.EOF after the last one. The body is
+// only read as fast as decode is called, so slow processing applies backpressure to the
+// client instead of buffering.
+//
+// Example:
+//
+//	err := c.BindStream(func(decode func(val any) error) error {
+//	    for {
+//	        var item Product
+//	        if err := decode(&item); err == io.EOF {
+//	            return nil
+//	        } else if err != nil {
+//	            return err
+//	        }
+//	        if err := store.Save(c, item); err != nil {
+//	            return err
+//	        }
+//	    }
+//	})
+//
+// Parameters:
+//   - fn: The function consuming the values; its error is returned as is.
+//
+// Returns:
+//   - error: An *errcode.Error with code "request.unsupported_media_type" or
+//     "request.empty_body" if the body cannot be streamed, the error of fn otherwise. Values
+//     that fail to decode yield an *errcode.Error with code "request.malformed_body" and the
+//     zero-based index of the value as the "item" parameter.
+func (c *Context) BindStream(fn func(decode func(val any) error) error) error {
+	if fn == nil {
+		return errs.ErrInputNil()
+	}
+	mediaType := "application/json"
+	if header := c.Request.Header.Get("Content-Type"); header != "" {
+		mediaType, _, _ = mime.ParseMediaType(header)
+	}
+	switch {
+	case mediaType == "application/json", mediaType == "application/x-ndjson", mediaType == "application/jsonl",
+		strings.HasSuffix(mediaType, "+json"):
+	default:
+		return &errcode.Error{Code: errcode.CodeUnsupportedType, Params: map[string]any{"type": mediaType}}
+	}
+	if !c.hasBody() {
+		return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+	}
+
+	body := bufio.NewReader(c.Request.Body)
+	array, err := startsWithArray(body)
+	if err == io.EOF {
+		return errcode.New(errcode.CodeEmptyBody, errs.ErrBodyNil())
+	}
+	if err != nil {
+		return errcode.New(errcode.CodeMalformedBody, err)
+	}
+	decoder := json.NewDecoder(body)
+	if array {
+		// Consume the opening bracket; the elements are then decoded one by one.
+		if _, err = decoder.Token(); err != nil {
+			return errcode.New(errcode.CodeMalformedBody, err)
+		}
+	}
+	index, done := 0, false
+	return fn(func(val any) error {
+		if done {
+			return io.EOF
+		}
+		if array && !decoder.More() {
+			done = true
+			if _, err := decoder.Token(); err != nil {
+				return &errcode.Error{Code: errcode.CodeMalformedBody, Params: map[string]any{"item": index}, Err: err}
+			}
+			return io.EOF
+		}
+		if err := decoder.Decode(val); err != nil {
+			done = true
+			if err == io.EOF && !array {
+				return io.EOF
+			}
+			return &errcode.Error{Code: errcode.CodeMalformedBody, Params: map[string]any{"item": index}, Err: err}
+		}
+		index++
+		return nil
+	})
+}
+
+// BindEach decodes a streamed body with BindStream, validates every value against its
+// `validate` struct tags, and passes it to fn along with its zero-based index. It stops at the
+// first error of decoding, validation or fn.
+//
+// Example:
+//
+//	imported := 0
+//	err := mist.BindEach(c, func(i int, p Product) error {
+//	    imported++
+//	    return store.Save(c, p)
+//	})
+//
+// Parameters:
+//   - ctx: The request context.
+//   - fn: The function processing each value.
+//
+// Returns:
+//   - error: The first error, see BindStream; validation failures yield validation.Errors.
+func BindEach[T any](ctx *Context, fn func(index int, item T) error) error {
+	return ctx.BindStream(func(decode func(val any) error) error {
+		for index := 0; ; index++ {
+			var item T
+			if err := decode(&item); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := validation.Validate(item); err != nil {
+				return err
+			}
+			if err := fn(index, item); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// startsWithArray skips leading whitespace and reports whether the body is a JSON array.
+func startsWithArray(r *bufio.Reader) (bool, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return false, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b == '[', r.UnreadByte()
+	}
+}
@@ -0,0 +1,116 @@
+package mist
+
+import (
+	"bytes"
+	"github.com/dormoron/mist/errcode"
+	"io"
+	"net/http"
+)
+
+// defaultBodyLimit is the size limit of the bodies cached by BodyBytes unless
+// ServerWithBodyLimit sets another one.
+const defaultBodyLimit = 10 << 20
+
+// ServerWithBodyLimit sets the size limit of the request bodies cached by Context.BodyBytes.
+// The default is 10 MiB. It only bounds the cache: handlers streaming the body are not
+// limited.
+//
+// Parameters:
+//   - limit: The size limit in bytes.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified limit.
+func ServerWithBodyLimit(limit int64) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.bodyLimit = limit
+	}
+}
+
+// BodyBytes reads the request body once and caches it, so that several consumers, such as a
+// signature verification middleware, an audit log and Bind, can all access it. After the
+// first call, Request.Body is replaced by a reader over the cached bytes, so consumers reading
+// the body directly see it whole; ResetBody rewinds it for further reads.
+//
+// Example:
+//
+//	func verifySignature(next mist.HandleFunc) mist.HandleFunc {
+//	    return func(ctx *mist.Context) {
+//	        body, err := ctx.BodyBytes()
+//	        if err != nil {
+//	            _ = ctx.RespondError(err)
+//	            return
+//	        }
+//	        if !validSignature(ctx.Request.Header.Get("X-Signature"), body) {
+//	            ctx.RespStatusCode = http.StatusUnauthorized
+//	            return
+//	        }
+//	        next(ctx)
+//	    }
+//	}
+//
+// Returns:
+//   - []byte: The body, empty if the request has none. The slice must not be modified.
+//   - error: An *errcode.Error with code "request.body_too_large" if the body exceeds the
+//     limit set with ServerWithBodyLimit, in which case Request.Body is left readable from the
+//     start, or the read error.
+func (c *Context) BodyBytes() ([]byte, error) {
+	if c.bodyRead {
+		return c.body, nil
+	}
+	if !c.hasBody() {
+		c.bodyRead = true
+		return nil, nil
+	}
+	limit := c.bodyLimit
+	if limit <= 0 {
+		limit = defaultBodyLimit
+	}
+
+	original := c.Request.Body
+	data, err := io.ReadAll(io.LimitReader(original, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		// Give the consumed part back so the body can still be streamed.
+		c.Request.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(data), original), Closer: original}
+		return nil, &errcode.Error{Code: errcode.CodeBodyTooLarge, Params: map[string]any{"limit": limit}}
+	}
+	_ = original.Close()
+	c.body, c.bodyRead = data, true
+	c.Request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	c.resetBody()
+	return data, nil
+}
+
+// ResetBody rewinds Request.Body to the start of the body, so that it can be read again after
+// a consumer such as Bind drained it. It reads and caches the body with BodyBytes on the first
+// call.
+//
+// Returns:
+//   - error: The error of BodyBytes.
+func (c *Context) ResetBody() error {
+	if !c.bodyRead {
+		_, err := c.BodyBytes()
+		return err
+	}
+	c.resetBody()
+	return nil
+}
+
+// resetBody points Request.Body at the start of the cached body.
+func (c *Context) resetBody() {
+	if len(c.body) == 0 {
+		c.Request.Body = http.NoBody
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(c.body))
+}
+
+// readCloser combines a Reader with the Closer of another stream.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
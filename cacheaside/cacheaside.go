@@ -0,0 +1,276 @@
+// Package cacheaside caches the results of expensive loads, such as database queries or calls
+// to other services, in front of their source: Get returns the cached value of a key, or calls
+// the loader once for all the concurrent requests of the key and caches its result. Values go
+// through tiers, typically a small in-memory one in front of Redis, and are encoded as JSON:
+//
+//	memory, _ := cacheaside.InitMemoryTier(10000)
+//	cache := cacheaside.InitCache(memory.SetMaxTTL(30*time.Second), cacheaside.InitRedisTier(rdb))
+//	server.GET("/products/:id", func(ctx *mist.Context) {
+//	    id := ctx.PathValue("id").StringOrDefault("")
+//	    product, err := cacheaside.Get(ctx, cache, "product:"+id, 10*time.Minute,
+//	        func(c context.Context) (Product, error) { return products.Find(c, id) })
+//	    ...
+//	})
+//	...
+//	_ = cache.Invalidate(ctx, "product:"+id)
+//
+// A *mist.Context is a context.Context, so handlers pass theirs directly.
+package cacheaside
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist/internal/singleflight"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// Cache looks up values in its tiers, in order, and loads the missing ones.
+type Cache struct {
+	tiers   []Tier
+	prefix  string
+	onError func(err error)
+	flight  singleflight.Group[[]byte]
+
+	// generation counts the invalidations, so that a load started before one does not store
+	// the value it invalidated.
+	generation atomic.Uint64
+
+	pubsub  *redis.Client
+	channel string
+}
+
+// InitCache creates a Cache with keys prefixed by "cacheaside:". Errors of the tiers are
+// logged, and lookups fall back to the next tier or to the loader.
+//
+// Parameters:
+//   - tiers: The tiers, from the fastest to the slowest.
+//
+// Returns:
+//   - *Cache: The initialized cache.
+func InitCache(tiers ...Tier) *Cache {
+	return &Cache{
+		tiers:  tiers,
+		prefix: "cacheaside:",
+		onError: func(err error) {
+			log.Println(err)
+		},
+	}
+}
+
+// SetKeyPrefix sets the prefix of the keys in the tiers.
+func (c *Cache) SetKeyPrefix(prefix string) *Cache {
+	c.prefix = prefix
+	return c
+}
+
+// OnError sets the handler of the errors of the tiers and of the encoding of values.
+func (c *Cache) OnError(fn func(err error)) *Cache {
+	c.onError = fn
+	return c
+}
+
+// SetInvalidation sets the Redis channel invalidations are published on, so that Listen drops
+// them from the in-memory tiers of every instance.
+//
+// Parameters:
+//   - client: The Redis client publishing and subscribing.
+//   - channel: The name of the channel, e.g. "cacheaside:invalidate".
+func (c *Cache) SetInvalidation(client *redis.Client, channel string) *Cache {
+	c.pubsub = client
+	c.channel = channel
+	return c
+}
+
+// Get returns the cached value of a key, or loads it. Concurrent calls for a missing key wait
+// for a single load; the loader runs with the values of ctx but without its cancellation, as
+// its result is shared. Loader errors are not cached.
+//
+// Parameters:
+//   - ctx: The context of the lookup, e.g. the *mist.Context of a handler.
+//   - c: The cache.
+//   - key: The key of the value.
+//   - ttl: The time the loaded value is cached.
+//   - loader: The function loading the value from its source.
+//
+// Returns:
+//   - T: The value.
+//   - error: The error of the loader, or of the decoding of the value.
+func Get[T any](ctx context.Context, c *Cache, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	raw, err := c.get(ctx, key, ttl, func(ctx context.Context) ([]byte, error) {
+		v, err := loader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(v)
+	})
+	if err != nil {
+		return value, err
+	}
+	// Each caller decodes its own copy, so that sharing a load does not share its value.
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return value, fmt.Errorf("cacheaside: decoding %q: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set stores the value of a key in every tier, e.g. after writing it to its source.
+func Set[T any](ctx context.Context, c *Cache, key string, value T, ttl time.Duration) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("cacheaside: encoding %q: %w", key, err)
+	}
+	c.store(ctx, c.prefix+key, raw, ttl, len(c.tiers))
+	return nil
+}
+
+// Invalidate removes keys from every tier, and from the in-memory tiers of the other instances
+// when SetInvalidation is set.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - keys: The keys to remove.
+//
+// Returns:
+//   - error: The first error of a tier or of the publication.
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = c.prefix + key
+	}
+	return c.invalidate(ctx, invalidation{Keys: full})
+}
+
+// InvalidatePrefix removes the keys starting with a prefix from every tier supporting it, such
+// as MemoryTier and RedisTier, e.g. "product:42:" for all the cached views of a product.
+func (c *Cache) InvalidatePrefix(ctx context.Context, prefix string) error {
+	return c.invalidate(ctx, invalidation{Prefix: c.prefix + prefix})
+}
+
+// Listen applies the invalidations published by the other instances to the in-memory tiers,
+// until ctx is done. It is run in its own goroutine when SetInvalidation is set.
+func (c *Cache) Listen(ctx context.Context) error {
+	if c.pubsub == nil {
+		return fmt.Errorf("cacheaside: no invalidation channel set")
+	}
+	sub := c.pubsub.Subscribe(ctx, c.channel)
+	defer sub.Close()
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			var inv invalidation
+			if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+				c.report(fmt.Errorf("cacheaside: invalid invalidation message: %w", err))
+				continue
+			}
+			c.generation.Add(1)
+			for _, tier := range c.tiers {
+				if local, ok := tier.(*MemoryTier); ok {
+					c.apply(ctx, local, inv)
+				}
+			}
+		}
+	}
+}
+
+// invalidation is the message published on the invalidation channel.
+type invalidation struct {
+	Keys   []string `json:"keys,omitempty"`
+	Prefix string   `json:"prefix,omitempty"`
+}
+
+// prefixDeleter is a Tier able to remove the keys of a prefix.
+type prefixDeleter interface {
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// get looks a key up in the tiers, filling the faster tiers on a hit in a slower one, and
+// loads it on a miss.
+func (c *Cache) get(ctx context.Context, key string, ttl time.Duration, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	full := c.prefix + key
+	for i, tier := range c.tiers {
+		raw, ok, err := tier.Get(ctx, full)
+		if err != nil {
+			c.report(fmt.Errorf("cacheaside: reading %q: %w", full, err))
+			continue
+		}
+		if ok {
+			c.store(ctx, full, raw, ttl, i)
+			return raw, nil
+		}
+	}
+	raw, err, _ := c.flight.Do(full, func() ([]byte, error) {
+		generation := c.generation.Load()
+		raw, err := load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if c.generation.Load() == generation {
+			c.store(ctx, full, raw, ttl, len(c.tiers))
+		}
+		return raw, nil
+	})
+	return raw, err
+}
+
+// store writes a value to the first n tiers.
+func (c *Cache) store(ctx context.Context, key string, raw []byte, ttl time.Duration, n int) {
+	ctx = context.WithoutCancel(ctx)
+	for _, tier := range c.tiers[:n] {
+		if err := tier.Set(ctx, key, raw, ttl); err != nil {
+			c.report(fmt.Errorf("cacheaside: writing %q: %w", key, err))
+		}
+	}
+}
+
+// invalidate applies an invalidation to every tier and publishes it.
+func (c *Cache) invalidate(ctx context.Context, inv invalidation) error {
+	c.generation.Add(1)
+	for _, key := range inv.Keys {
+		c.flight.Forget(key)
+	}
+	var firstErr error
+	for _, tier := range c.tiers {
+		if err := c.apply(ctx, tier, inv); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if c.pubsub != nil {
+		payload, _ := json.Marshal(inv)
+		if err := c.pubsub.Publish(ctx, c.channel, payload).Err(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// apply applies an invalidation to a tier.
+func (c *Cache) apply(ctx context.Context, tier Tier, inv invalidation) error {
+	if err := tier.Delete(ctx, inv.Keys...); err != nil {
+		return err
+	}
+	if inv.Prefix == "" {
+		return nil
+	}
+	if d, ok := tier.(prefixDeleter); ok {
+		return d.DeletePrefix(ctx, inv.Prefix)
+	}
+	return fmt.Errorf("cacheaside: %T cannot delete by prefix", tier)
+}
+
+// report hands an error to the error handler.
+func (c *Cache) report(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
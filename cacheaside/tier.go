@@ -0,0 +1,161 @@
+package cacheaside
+
+import (
+	"context"
+	"errors"
+	"github.com/hashicorp/golang-lru"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"time"
+)
+
+// Tier is a level of a Cache.
+type Tier interface {
+	// Get returns the value of a key and whether it was found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value of a key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes keys.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// MemoryTier is a Tier local to the process, holding a bounded number of entries and evicting
+// the least recently used ones.
+type MemoryTier struct {
+	entries *lru.Cache
+	maxTTL  time.Duration
+}
+
+// memoryEntry is a value of MemoryTier and its expiry.
+type memoryEntry struct {
+	value    []byte
+	deadline time.Time
+}
+
+// InitMemoryTier creates a MemoryTier.
+//
+// Parameters:
+//   - size: The maximum number of entries.
+//
+// Returns:
+//   - *MemoryTier: The initialized tier.
+//   - error: An error if size is not positive.
+func InitMemoryTier(size int) (*MemoryTier, error) {
+	entries, err := lru.New(size)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryTier{entries: entries}, nil
+}
+
+// SetMaxTTL caps the time entries are kept, so that a process holding a value that was changed
+// by another instance serves it for a short while only, e.g. 30 seconds in front of a Redis
+// tier kept for minutes; 0 keeps entries for the ttl they are stored with.
+func (t *MemoryTier) SetMaxTTL(ttl time.Duration) *MemoryTier {
+	t.maxTTL = ttl
+	return t
+}
+
+// Get returns the value of a key, unless it expired.
+func (t *MemoryTier) Get(_ context.Context, key string) ([]byte, bool, error) {
+	v, ok := t.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	e := v.(memoryEntry)
+	if !time.Now().Before(e.deadline) {
+		t.entries.Remove(key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set stores the value of a key for ttl, or for the maximum set by SetMaxTTL if shorter.
+func (t *MemoryTier) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if t.maxTTL > 0 && ttl > t.maxTTL {
+		ttl = t.maxTTL
+	}
+	t.entries.Add(key, memoryEntry{value: value, deadline: time.Now().Add(ttl)})
+	return nil
+}
+
+// Delete removes keys.
+func (t *MemoryTier) Delete(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		t.entries.Remove(key)
+	}
+	return nil
+}
+
+// DeletePrefix removes the keys starting with a prefix.
+func (t *MemoryTier) DeletePrefix(_ context.Context, prefix string) error {
+	for _, k := range t.entries.Keys() {
+		if key, ok := k.(string); ok && strings.HasPrefix(key, prefix) {
+			t.entries.Remove(key)
+		}
+	}
+	return nil
+}
+
+// RedisTier is a Tier shared by the instances of an application.
+type RedisTier struct {
+	client redis.Cmdable
+}
+
+// InitRedisTier creates a RedisTier.
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *RedisTier: The initialized tier.
+func InitRedisTier(client redis.Cmdable) *RedisTier {
+	return &RedisTier{client: client}
+}
+
+// Get returns the value of a key.
+func (t *RedisTier) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := t.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores the value of a key for ttl.
+func (t *RedisTier) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return t.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Delete removes keys.
+func (t *RedisTier) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return t.client.Del(ctx, keys...).Err()
+}
+
+// DeletePrefix removes the keys starting with a prefix, scanning the keyspace in batches.
+func (t *RedisTier) DeletePrefix(ctx context.Context, prefix string) error {
+	var cursor uint64
+	for {
+		keys, next, err := t.client.Scan(ctx, cursor, escapePattern(prefix)+"*", 500).Result()
+		if err != nil {
+			return err
+		}
+		if err = t.Delete(ctx, keys...); err != nil {
+			return err
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// escapePattern escapes the glob characters of a Redis SCAN pattern.
+func escapePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace(s)
+}
@@ -0,0 +1,26 @@
+package mist
+
+import (
+	"slices"
+)
+
+// CacheTag tags the response of the request with surrogate keys, such as "user:42" or
+// "product:7", naming the data it was built from. Response caches store the tags with the
+// response, so that purging a tag after the data changed invalidates every cached response
+// built from it, see the httpcache middleware.
+//
+// Parameters:
+//   - tags: The tags; duplicates are ignored.
+func (c *Context) CacheTag(tags ...string) {
+	for _, tag := range tags {
+		if tag == "" || slices.Contains(c.cacheTags, tag) {
+			continue
+		}
+		c.cacheTags = append(c.cacheTags, tag)
+	}
+}
+
+// CacheTags returns the tags set with CacheTag.
+func (c *Context) CacheTags() []string {
+	return c.cacheTags
+}
@@ -0,0 +1,133 @@
+// Package cdn helps serving an application behind a CDN: it signs URLs of private content for
+// CloudFront and Cloudflare, builds Cache-Control headers telling the CDN and browsers how long
+// to keep responses, and purges the CDN caches after content changes:
+//
+//	server.Use(cdn.Middleware(cdn.CacheFor(time.Minute, time.Hour, 10*time.Minute)))
+//	...
+//	purger := cdn.InitCloudflarePurger(zoneID, apiToken)
+//	_ = purger.PurgeTags(ctx, "product:42")
+//
+// The s-maxage of a policy also sets how long the httpcache middleware stores a response, so
+// that the local cache and the CDN expire together.
+package cdn
+
+import (
+	"github.com/dormoron/mist"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CachePolicy is the caching policy of responses, rendered as a Cache-Control header.
+//
+// Fields:
+//   - MaxAge: The time browsers keep the response (max-age).
+//   - SMaxAge: The time shared caches, such as CDNs, keep the response (s-maxage); 0 leaves
+//     them to MaxAge.
+//   - StaleWhileRevalidate: The time a stale response is still served while it is refreshed
+//     in the background (stale-while-revalidate).
+//   - StaleIfError: The time a stale response is served when the application fails
+//     (stale-if-error).
+//   - Public: Whether shared caches may store responses to authenticated requests (public).
+//   - Private: Whether only the browser may store the response (private).
+//   - NoStore: Whether the response must not be stored at all (no-store); the other fields
+//     are ignored.
+//   - Immutable: Whether the response never changes during its lifetime (immutable), e.g.
+//     fingerprinted assets.
+type CachePolicy struct {
+	MaxAge               time.Duration
+	SMaxAge              time.Duration
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	Public               bool
+	Private              bool
+	NoStore              bool
+	Immutable            bool
+}
+
+// CacheFor returns the policy of public content kept briefly by browsers and longer by the
+// CDN, which is purged when the content changes.
+//
+// Parameters:
+//   - browser: The max-age.
+//   - cdn: The s-maxage.
+//   - stale: The stale-while-revalidate and stale-if-error periods.
+//
+// Returns:
+//   - CachePolicy: The policy.
+func CacheFor(browser time.Duration, cdn time.Duration, stale time.Duration) CachePolicy {
+	return CachePolicy{
+		MaxAge:               browser,
+		SMaxAge:              cdn,
+		StaleWhileRevalidate: stale,
+		StaleIfError:         stale,
+		Public:               true,
+	}
+}
+
+// NoStore is the policy of responses that must not be cached, such as personal data.
+var NoStore = CachePolicy{NoStore: true}
+
+// String returns the value of the Cache-Control header of the policy.
+func (p CachePolicy) String() string {
+	if p.NoStore {
+		return "no-store"
+	}
+	var directives []string
+	switch {
+	case p.Private:
+		directives = append(directives, "private")
+	case p.Public:
+		directives = append(directives, "public")
+	}
+	directives = append(directives, "max-age="+seconds(p.MaxAge))
+	if p.SMaxAge > 0 && !p.Private {
+		directives = append(directives, "s-maxage="+seconds(p.SMaxAge))
+	}
+	if p.StaleWhileRevalidate > 0 {
+		directives = append(directives, "stale-while-revalidate="+seconds(p.StaleWhileRevalidate))
+	}
+	if p.StaleIfError > 0 {
+		directives = append(directives, "stale-if-error="+seconds(p.StaleIfError))
+	}
+	if p.Immutable {
+		directives = append(directives, "immutable")
+	}
+	return strings.Join(directives, ", ")
+}
+
+// Apply sets the Cache-Control header of a response to the policy.
+func (p CachePolicy) Apply(ctx *mist.Context) {
+	ctx.Header("Cache-Control", p.String())
+}
+
+// Middleware returns a middleware applying a policy to the successful responses of GET and
+// HEAD requests whose handler did not set a Cache-Control header itself.
+//
+// Parameters:
+//   - p: The default policy.
+//
+// Returns:
+//   - mist.Middleware: The middleware.
+func Middleware(p CachePolicy) mist.Middleware {
+	value := p.String()
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			next(ctx)
+			method := ctx.Request.Method
+			if (method != http.MethodGet && method != http.MethodHead) || ctx.Committed() {
+				return
+			}
+			if ctx.RespStatusCode >= 300 || ctx.ResponseWriter.Header().Get("Cache-Control") != "" {
+				return
+			}
+			ctx.Header("Cache-Control", value)
+		}
+	}
+}
+
+// seconds formats a duration as whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(d/time.Second), 10)
+}
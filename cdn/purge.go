@@ -0,0 +1,200 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/dormoron/mist/internal/awsv4"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Purger removes content from the caches of a CDN.
+type Purger interface {
+	// PurgeURLs removes the cached responses of URLs.
+	PurgeURLs(ctx context.Context, urls ...string) error
+	// PurgeTags removes the cached responses tagged with tags, see httpcache.Cache.SetTagHeader.
+	PurgeTags(ctx context.Context, tags ...string) error
+}
+
+// CloudflarePurger purges the cache of a Cloudflare zone through its API.
+type CloudflarePurger struct {
+	zoneID   string
+	token    string
+	endpoint string
+	client   *http.Client
+}
+
+// InitCloudflarePurger creates a CloudflarePurger.
+//
+// Parameters:
+//   - zoneID: The ID of the zone.
+//   - token: An API token with the Cache Purge permission on the zone.
+//
+// Returns:
+//   - *CloudflarePurger: The initialized purger.
+func InitCloudflarePurger(zoneID string, token string) *CloudflarePurger {
+	return &CloudflarePurger{
+		zoneID:   zoneID,
+		token:    token,
+		endpoint: "https://api.cloudflare.com/client/v4",
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetEndpoint sets the base URL of the API.
+func (p *CloudflarePurger) SetEndpoint(endpoint string) *CloudflarePurger {
+	p.endpoint = endpoint
+	return p
+}
+
+// SetClient sets the HTTP client calling the API.
+func (p *CloudflarePurger) SetClient(client *http.Client) *CloudflarePurger {
+	p.client = client
+	return p
+}
+
+// PurgeURLs purges URLs, 30 per API call.
+func (p *CloudflarePurger) PurgeURLs(ctx context.Context, urls ...string) error {
+	return p.purge(ctx, "files", urls)
+}
+
+// PurgeTags purges the responses with any of the tags in their Cache-Tag header, 30 per API
+// call.
+func (p *CloudflarePurger) PurgeTags(ctx context.Context, tags ...string) error {
+	return p.purge(ctx, "tags", tags)
+}
+
+// purge calls the purge_cache API in batches.
+func (p *CloudflarePurger) purge(ctx context.Context, field string, values []string) error {
+	for start := 0; start < len(values); start += 30 {
+		body, err := json.Marshal(map[string][]string{field: values[start:min(start+30, len(values))]})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint+"/zones/"+p.zoneID+"/purge_cache", nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.token)
+		req.Header.Set("Content-Type", "application/json")
+		if err = do(p.client, req, body); err != nil {
+			return fmt.Errorf("cdn: purging Cloudflare %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// CloudFrontPurger invalidates the paths of a CloudFront distribution.
+type CloudFrontPurger struct {
+	distributionID string
+	creds          awsv4.Credentials
+	endpoint       string
+	client         *http.Client
+}
+
+// InitCloudFrontPurger creates a CloudFrontPurger.
+//
+// Parameters:
+//   - distributionID: The ID of the distribution.
+//   - accessKeyID, secretAccessKey: The credentials of an identity allowed
+//     cloudfront:CreateInvalidation.
+//
+// Returns:
+//   - *CloudFrontPurger: The initialized purger.
+func InitCloudFrontPurger(distributionID string, accessKeyID string, secretAccessKey string) *CloudFrontPurger {
+	return &CloudFrontPurger{
+		distributionID: distributionID,
+		creds:          awsv4.Credentials{AccessKeyID: accessKeyID, SecretKey: secretAccessKey},
+		endpoint:       "https://cloudfront.amazonaws.com",
+		client:         &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetSessionToken sets the session token of temporary credentials.
+func (p *CloudFrontPurger) SetSessionToken(token string) *CloudFrontPurger {
+	p.creds.SessionToken = token
+	return p
+}
+
+// SetClient sets the HTTP client calling the API.
+func (p *CloudFrontPurger) SetClient(client *http.Client) *CloudFrontPurger {
+	p.client = client
+	return p
+}
+
+// invalidationBatch is the body of the CreateInvalidation API.
+type invalidationBatch struct {
+	XMLName         xml.Name `xml:"http://cloudfront.amazonaws.com/doc/2020-05-31/ InvalidationBatch"`
+	CallerReference string   `xml:"CallerReference"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Items           []string `xml:"Paths>Items>Path"`
+}
+
+// PurgeURLs invalidates the paths of URLs, with their query; paths may end with "*" to
+// invalidate a prefix. Full URLs and bare paths are accepted.
+func (p *CloudFrontPurger) PurgeURLs(ctx context.Context, urls ...string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	paths := make([]string, len(urls))
+	for i, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return err
+		}
+		paths[i] = u.EscapedPath()
+		if u.RawQuery != "" {
+			paths[i] += "?" + u.RawQuery
+		}
+	}
+	body, err := xml.Marshal(invalidationBatch{
+		CallerReference: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Quantity:        len(paths),
+		Items:           paths,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		p.endpoint+"/2020-05-31/distribution/"+p.distributionID+"/invalidation", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	awsv4.Sign(req, body, p.creds, "us-east-1", "cloudfront", time.Now())
+	if err = do(p.client, req, body); err != nil {
+		return fmt.Errorf("cdn: invalidating CloudFront paths: %w", err)
+	}
+	return nil
+}
+
+// PurgeTags fails: CloudFront does not tag cached responses.
+func (p *CloudFrontPurger) PurgeTags(_ context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	return fmt.Errorf("cdn: CloudFront cannot purge by tag, invalidate the paths of %v", tags)
+}
+
+// do sends a request with a body and turns responses other than 2xx into errors.
+func do(client *http.Client, req *http.Request, body []byte) error {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package cdn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLSigner signs URLs of private content, so that the CDN serves them until they expire.
+type URLSigner interface {
+	// SignURL returns the signed form of a URL, valid until expires.
+	SignURL(rawURL string, expires time.Time) (string, error)
+}
+
+// CloudFrontSigner signs URLs for Amazon CloudFront with the key of a trusted key group.
+type CloudFrontSigner struct {
+	keyID string
+	key   *rsa.PrivateKey
+}
+
+// InitCloudFrontSigner creates a CloudFrontSigner.
+//
+// Parameters:
+//   - keyID: The ID of the public key in CloudFront, sent as Key-Pair-Id.
+//   - key: The private key matching the public key.
+//
+// Returns:
+//   - *CloudFrontSigner: The initialized signer.
+func InitCloudFrontSigner(keyID string, key *rsa.PrivateKey) *CloudFrontSigner {
+	return &CloudFrontSigner{keyID: keyID, key: key}
+}
+
+// SignURL signs a URL with a canned policy, adding the Expires, Signature and Key-Pair-Id query
+// parameters.
+func (s *CloudFrontSigner) SignURL(rawURL string, expires time.Time) (string, error) {
+	policy := s.policy(rawURL, expires)
+	signature, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(rawURL, "Expires="+strconv.FormatInt(expires.Unix(), 10)+
+		"&Signature="+signature+"&Key-Pair-Id="+s.keyID), nil
+}
+
+// SignURLForResource signs a URL with a custom policy granting access to a resource pattern,
+// such as "https://media.example/videos/42/*" for all the segments of a video, adding the
+// Policy, Signature and Key-Pair-Id query parameters. The same signature is valid for every URL
+// of the pattern.
+func (s *CloudFrontSigner) SignURLForResource(rawURL string, resource string, expires time.Time) (string, error) {
+	policy := s.policy(resource, expires)
+	signature, err := s.sign(policy)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(rawURL, "Policy="+cloudFrontEncode(policy)+
+		"&Signature="+signature+"&Key-Pair-Id="+s.keyID), nil
+}
+
+// cloudFrontPolicy is the JSON policy of a CloudFront signature.
+type cloudFrontPolicy struct {
+	Statement []cloudFrontStatement `json:"Statement"`
+}
+
+// cloudFrontStatement is a statement of a cloudFrontPolicy.
+type cloudFrontStatement struct {
+	Resource  string `json:"Resource"`
+	Condition struct {
+		DateLessThan struct {
+			EpochTime int64 `json:"AWS:EpochTime"`
+		} `json:"DateLessThan"`
+	} `json:"Condition"`
+}
+
+// policy returns the policy granting access to a resource until expires. It is encoded
+// without escaping "&", "<" and ">", as CloudFront rebuilds canned policies from the URL.
+func (s *CloudFrontSigner) policy(resource string, expires time.Time) []byte {
+	statement := cloudFrontStatement{Resource: resource}
+	statement.Condition.DateLessThan.EpochTime = expires.Unix()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(cloudFrontPolicy{Statement: []cloudFrontStatement{statement}})
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// sign returns the encoded RSA-SHA1 signature of a policy, the algorithm CloudFront requires.
+func (s *CloudFrontSigner) sign(policy []byte) (string, error) {
+	digest := sha1.Sum(policy)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("cdn: signing CloudFront policy: %w", err)
+	}
+	return cloudFrontEncode(signature), nil
+}
+
+// cloudFrontEncode encodes a value in the URL-safe base64 variant of CloudFront.
+func cloudFrontEncode(b []byte) string {
+	return strings.NewReplacer("+", "-", "=", "_", "/", "~").Replace(base64.StdEncoding.EncodeToString(b))
+}
+
+// CloudflareSigner signs URLs for the token authentication of Cloudflare, checked by a WAF
+// rule such as:
+//
+//	not is_timed_hmac_valid_v0("<secret>", http.request.uri, 3600, http.request.timestamp.sec, 8)
+//
+// The token is sent as the "verify" query parameter; the URLs to sign must have no query.
+type CloudflareSigner struct {
+	secret   []byte
+	validity time.Duration
+}
+
+// InitCloudflareSigner creates a CloudflareSigner.
+//
+// Parameters:
+//   - secret: The secret of the WAF rule.
+//   - validity: The validity period of the WAF rule; the tokens carry their issue time, from
+//     which the rule computes their expiry.
+//
+// Returns:
+//   - *CloudflareSigner: The initialized signer.
+func InitCloudflareSigner(secret []byte, validity time.Duration) *CloudflareSigner {
+	return &CloudflareSigner{secret: secret, validity: validity}
+}
+
+// SignURL signs a URL with a token issued at expires minus the validity period of the rule, so
+// that the rule rejects it from expires on.
+func (s *CloudflareSigner) SignURL(rawURL string, expires time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.RawQuery != "" {
+		return "", fmt.Errorf("cdn: Cloudflare token authentication does not support URLs with a query: %s", rawURL)
+	}
+	issued := strconv.FormatInt(expires.Add(-s.validity).Unix(), 10)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(u.EscapedPath() + issued))
+	token := issued + "-" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return rawURL + "?verify=" + url.QueryEscape(token), nil
+}
+
+// withQuery appends query parameters to a URL.
+func withQuery(rawURL string, query string) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query
+	}
+	return rawURL + "?" + query
+}
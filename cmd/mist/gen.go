@@ -0,0 +1,435 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// runGenHandler implements "mist gen handler".
+func runGenHandler(args []string) error {
+	fs := flag.NewFlagSet("gen handler", flag.ContinueOnError)
+	dir := fs.String("dir", "handlers", "directory of the handler package")
+	method := fs.String("method", http.MethodPost, "HTTP method of the route")
+	path := fs.String("path", "", "route pattern (default: /<kebab-case name>)")
+	name, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("gen handler: handler name is required")
+	}
+	data := map[string]any{
+		"Package": packageName(*dir),
+		"Name":    exported(name),
+		"Method":  strings.ToUpper(*method),
+		"Path":    *path,
+		"Body":    *method != http.MethodGet && *method != http.MethodDelete && *method != http.MethodHead,
+	}
+	if data["Path"] == "" {
+		data["Path"] = "/" + kebab(name)
+	}
+	files := []file{
+		{path: filepath.Join(*dir, snake(name)+".go"), tmpl: genHandler},
+		{path: filepath.Join(*dir, snake(name)+"_test.go"), tmpl: genHandlerTest},
+	}
+	if err = generate(files, data); err != nil {
+		return err
+	}
+	fmt.Printf("\nregister the route:\n\tserver.%s(%q, %s.%s)\n", data["Method"], data["Path"], data["Package"], data["Name"])
+	return nil
+}
+
+// runGenCRUD implements "mist gen crud".
+func runGenCRUD(args []string) error {
+	fs := flag.NewFlagSet("gen crud", flag.ContinueOnError)
+	model := fs.String("model", "", "name of the model, e.g. User")
+	dir := fs.String("dir", "handlers", "directory of the handler package")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *model == "" {
+		*model = positional
+	}
+	if *model == "" {
+		return errors.New("gen crud: -model is required")
+	}
+	w := words(*model)
+	w[len(w)-1] = plural(w[len(w)-1])
+	data := map[string]any{
+		"Package":    packageName(*dir),
+		"Model":      exported(*model),
+		"Collection": "/" + strings.Join(w, "-"),
+	}
+	files := []file{
+		{path: filepath.Join(*dir, snake(*model)+".go"), tmpl: genCRUD},
+		{path: filepath.Join(*dir, snake(*model)+"_test.go"), tmpl: genCRUDTest},
+	}
+	if err = generate(files, data); err != nil {
+		return err
+	}
+	fmt.Printf("\nregister the routes:\n\t%s.New%sHandler(%s.NewMemory%sRepository()).Register(server)\n",
+		data["Package"], data["Model"], data["Package"], data["Model"])
+	return nil
+}
+
+var genHandler = parse("handler.go", `package {{.Package}}
+
+import (
+	"net/http"
+
+	"github.com/dormoron/mist"
+)
+{{if .Body}}
+// {{.Name}}Request is the body of {{.Name}} requests.
+type {{.Name}}Request struct {
+	// Replace with the fields of the request and their validation rules.
+	Name string ´json:"name" validate:"required,max=100"´
+}
+{{end}}
+// {{.Name}}Response is the body of successful {{.Name}} responses.
+type {{.Name}}Response struct {
+	Name string ´json:"name"´
+}
+
+// {{.Name}} handles {{.Method}} {{.Path}}.
+//
+// @Summary  {{.Name}}
+{{- if .Body}}
+// @Accept   json{{end}}
+// @Produce  json
+{{- if .Body}}
+// @Param    body body {{.Name}}Request true "request body"{{end}}
+// @Success  200 {object} {{.Name}}Response
+{{- if .Body}}
+// @Failure  400 {object} mist.Problem
+// @Failure  422 {object} mist.Problem{{end}}
+// @Router   {{.Path}} [{{lower .Method}}]
+func {{.Name}}(ctx *mist.Context) {
+{{- if .Body}}
+	var req {{.Name}}Request
+	if err := ctx.BindAndValidate(&req); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, {{.Name}}Response{Name: req.Name})
+{{- else}}
+	_ = ctx.RespondWithJSON(http.StatusOK, {{.Name}}Response{})
+{{- end}}
+}
+`)
+
+var genHandlerTest = parse("handler_test.go", `package {{.Package}}
+
+import (
+	"net/http"
+	"net/http/httptest"
+{{- if .Body}}
+	"strings"{{end}}
+	"testing"
+
+	"github.com/dormoron/mist"
+)
+
+func Test{{.Name}}(t *testing.T) {
+	server := mist.InitHTTPServer()
+	server.{{.Method}}("{{.Path}}", {{.Name}})
+
+	rec := httptest.NewRecorder()
+{{- if .Body}}
+	server.ServeHTTP(rec, httptest.NewRequest("{{.Method}}", "{{.Path}}", strings.NewReader(´{"name":"test"}´)))
+{{- else}}
+	server.ServeHTTP(rec, httptest.NewRequest("{{.Method}}", "{{.Path}}", nil))
+{{- end}}
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
+{{- if .Body}}
+
+func Test{{.Name}}Invalid(t *testing.T) {
+	server := mist.InitHTTPServer()
+	server.{{.Method}}("{{.Path}}", {{.Name}})
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("{{.Method}}", "{{.Path}}", strings.NewReader(´{}´)))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+{{- end}}
+`)
+
+var genCRUD = parse("crud.go", `package {{.Package}}
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dormoron/mist"
+)
+
+// {{.Model}} is the resource managed by {{.Model}}Handler.
+type {{.Model}} struct {
+	ID   string ´json:"id"´
+	Name string ´json:"name" validate:"required,max=100"´
+}
+
+// {{.Model}}Repository stores {{.Model}} values.
+type {{.Model}}Repository interface {
+	List(ctx context.Context) ([]{{.Model}}, error)
+	Get(ctx context.Context, id string) ({{.Model}}, bool, error)
+	Create(ctx context.Context, v {{.Model}}) ({{.Model}}, error)
+	Update(ctx context.Context, v {{.Model}}) (bool, error)
+	Delete(ctx context.Context, id string) (bool, error)
+}
+
+// Memory{{.Model}}Repository is an in-memory {{.Model}}Repository, useful for tests and
+// prototypes.
+type Memory{{.Model}}Repository struct {
+	mutex  sync.RWMutex
+	nextID int
+	items  map[string]{{.Model}}
+}
+
+// NewMemory{{.Model}}Repository creates an empty Memory{{.Model}}Repository.
+func NewMemory{{.Model}}Repository() *Memory{{.Model}}Repository {
+	return &Memory{{.Model}}Repository{items: make(map[string]{{.Model}})}
+}
+
+// List returns every {{.Model}} ordered by ID.
+func (r *Memory{{.Model}}Repository) List(_ context.Context) ([]{{.Model}}, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	res := make([]{{.Model}}, 0, len(r.items))
+	for _, v := range r.items {
+		res = append(res, v)
+	}
+	slices.SortFunc(res, func(a, b {{.Model}}) int { return strings.Compare(a.ID, b.ID) })
+	return res, nil
+}
+
+// Get returns the {{.Model}} with the given ID and whether it exists.
+func (r *Memory{{.Model}}Repository) Get(_ context.Context, id string) ({{.Model}}, bool, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	v, ok := r.items[id]
+	return v, ok, nil
+}
+
+// Create stores v under a new ID.
+func (r *Memory{{.Model}}Repository) Create(_ context.Context, v {{.Model}}) ({{.Model}}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.nextID++
+	v.ID = strconv.Itoa(r.nextID)
+	r.items[v.ID] = v
+	return v, nil
+}
+
+// Update replaces an existing {{.Model}}, reporting whether it existed.
+func (r *Memory{{.Model}}Repository) Update(_ context.Context, v {{.Model}}) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.items[v.ID]; !ok {
+		return false, nil
+	}
+	r.items[v.ID] = v
+	return true, nil
+}
+
+// Delete removes a {{.Model}}, reporting whether it existed.
+func (r *Memory{{.Model}}Repository) Delete(_ context.Context, id string) (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.items[id]; !ok {
+		return false, nil
+	}
+	delete(r.items, id)
+	return true, nil
+}
+
+// {{.Model}}Handler serves the {{.Collection}} resource.
+type {{.Model}}Handler struct {
+	repo {{.Model}}Repository
+}
+
+// New{{.Model}}Handler creates a {{.Model}}Handler backed by repo.
+func New{{.Model}}Handler(repo {{.Model}}Repository) *{{.Model}}Handler {
+	return &{{.Model}}Handler{repo: repo}
+}
+
+// Register registers the routes of the handler on server.
+func (h *{{.Model}}Handler) Register(server *mist.HTTPServer) {
+	server.GET("{{.Collection}}", h.List)
+	server.POST("{{.Collection}}", h.Create)
+	server.GET("{{.Collection}}/:id", h.Get)
+	server.PUT("{{.Collection}}/:id", h.Update)
+	server.DELETE("{{.Collection}}/:id", h.Delete)
+}
+
+// List returns every {{.Model}}.
+//
+// @Summary  List {{.Model}} resources
+// @Produce  json
+// @Success  200 {array} {{.Model}}
+// @Router   {{.Collection}} [get]
+func (h *{{.Model}}Handler) List(ctx *mist.Context) {
+	items, err := h.repo.List(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, items)
+}
+
+// Get returns a single {{.Model}}.
+//
+// @Summary  Get a {{.Model}}
+// @Produce  json
+// @Param    id path string true "{{.Model}} ID"
+// @Success  200 {object} {{.Model}}
+// @Failure  404 {object} mist.Problem
+// @Router   {{.Collection}}/{id} [get]
+func (h *{{.Model}}Handler) Get(ctx *mist.Context) {
+	item, ok, err := h.repo.Get(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if !ok {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusNotFound})
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, item)
+}
+
+// Create stores a new {{.Model}}.
+//
+// @Summary  Create a {{.Model}}
+// @Accept   json
+// @Produce  json
+// @Param    body body {{.Model}} true "the {{.Model}} to create"
+// @Success  201 {object} {{.Model}}
+// @Failure  422 {object} mist.Problem
+// @Router   {{.Collection}} [post]
+func (h *{{.Model}}Handler) Create(ctx *mist.Context) {
+	var item {{.Model}}
+	if err := ctx.BindAndValidate(&item); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	item, err := h.repo.Create(ctx.Request.Context(), item)
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusCreated, item)
+}
+
+// Update replaces an existing {{.Model}}.
+//
+// @Summary  Update a {{.Model}}
+// @Accept   json
+// @Produce  json
+// @Param    id path string true "{{.Model}} ID"
+// @Param    body body {{.Model}} true "the new state of the {{.Model}}"
+// @Success  200 {object} {{.Model}}
+// @Failure  404 {object} mist.Problem
+// @Failure  422 {object} mist.Problem
+// @Router   {{.Collection}}/{id} [put]
+func (h *{{.Model}}Handler) Update(ctx *mist.Context) {
+	var item {{.Model}}
+	if err := ctx.BindAndValidate(&item); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	item.ID = ctx.PathValue("id").StringOrDefault("")
+	ok, err := h.repo.Update(ctx.Request.Context(), item)
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if !ok {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusNotFound})
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, item)
+}
+
+// Delete removes a {{.Model}}.
+//
+// @Summary  Delete a {{.Model}}
+// @Param    id path string true "{{.Model}} ID"
+// @Success  204
+// @Failure  404 {object} mist.Problem
+// @Router   {{.Collection}}/{id} [delete]
+func (h *{{.Model}}Handler) Delete(ctx *mist.Context) {
+	ok, err := h.repo.Delete(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if !ok {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusNotFound})
+		return
+	}
+	ctx.RespStatusCode = http.StatusNoContent
+}
+`)
+
+var genCRUDTest = parse("crud_test.go", `package {{.Package}}
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dormoron/mist"
+)
+
+func Test{{.Model}}Handler(t *testing.T) {
+	server := mist.InitHTTPServer()
+	New{{.Model}}Handler(NewMemory{{.Model}}Repository()).Register(server)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "{{.Collection}}", strings.NewReader(´{"name":"test"}´)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body)
+	}
+	var created {{.Model}}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "{{.Collection}}/"+created.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "{{.Collection}}/"+created.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "{{.Collection}}/"+created.ID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("get after delete: status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+`)
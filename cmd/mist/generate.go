@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// file is a file to generate from a template.
+type file struct {
+	path string
+	tmpl *template.Template
+}
+
+// parse parses a template of generated code. Templates use "´" in place of backquotes, which
+// cannot appear in Go raw string literals.
+func parse(name string, src string) *template.Template {
+	return template.Must(template.New(name).Funcs(template.FuncMap{
+		"lower": strings.ToLower,
+	}).Parse(strings.ReplaceAll(src, "´", "`")))
+}
+
+// generate renders files with data. Go sources are formatted with gofmt. Existing files are
+// never overwritten; generation stops at the first existing file before anything is written.
+func generate(files []file, data any) error {
+	rendered := make(map[string][]byte, len(files))
+	for _, f := range files {
+		if _, err := os.Stat(f.path); err == nil {
+			return fmt.Errorf("%s already exists", f.path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := f.tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		src := buf.Bytes()
+		if strings.HasSuffix(f.path, ".go") {
+			formatted, err := format.Source(src)
+			if err != nil {
+				return fmt.Errorf("formatting %s: %w", f.path, err)
+			}
+			src = formatted
+		}
+		rendered[f.path] = src
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, rendered[f.path], 0o644); err != nil {
+			return err
+		}
+		fmt.Println("created", f.path)
+	}
+	return nil
+}
+
+// parseArgs parses flags that may follow a leading positional argument, as in
+// "mist new shop -module github.com/acme/shop".
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	positional := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if positional == "" && fs.NArg() > 0 {
+		positional = fs.Arg(0)
+	}
+	return positional, nil
+}
+
+// words splits an identifier such as "CreateOrder" or "create_order" into lower-case words.
+func words(name string) []string {
+	var res []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			res = append(res, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ':
+			flush()
+		case unicode.IsUpper(r) && i > 0 && (unicode.IsLower(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))):
+			flush()
+			cur = append(cur, r)
+		default:
+			cur = append(cur, r)
+		}
+	}
+	flush()
+	return res
+}
+
+// exported converts a name into an exported Go identifier: "create_order" -> "CreateOrder".
+func exported(name string) string {
+	var b strings.Builder
+	for _, w := range words(name) {
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	return b.String()
+}
+
+// snake converts a name into snake case: "CreateOrder" -> "create_order".
+func snake(name string) string {
+	return strings.Join(words(name), "_")
+}
+
+// kebab converts a name into kebab case: "CreateOrder" -> "create-order".
+func kebab(name string) string {
+	return strings.Join(words(name), "-")
+}
+
+// plural returns a naive English plural of a lower-case word.
+func plural(word string) string {
+	switch {
+	case strings.HasSuffix(word, "s"), strings.HasSuffix(word, "x"), strings.HasSuffix(word, "ch"), strings.HasSuffix(word, "sh"):
+		return word + "es"
+	case strings.HasSuffix(word, "y") && len(word) > 1 && !strings.ContainsRune("aeiou", rune(word[len(word)-2])):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+// packageName derives the Go package name of a directory.
+func packageName(dir string) string {
+	name := strings.ToLower(filepath.Base(filepath.Clean(dir)))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" || name == "." || unicode.IsDigit(rune(name[0])) {
+		return "handlers"
+	}
+	return name
+}
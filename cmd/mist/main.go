@@ -0,0 +1,63 @@
+// Command mist scaffolds mist applications and generates code following the framework's
+// conventions.
+//
+// Usage:
+//
+//	mist new <name> [-module <path>]
+//	mist gen handler <Name> [-dir handlers] [-method POST] [-path /name]
+//	mist gen crud -model <Model> [-dir handlers]
+//	mist gen openapi -spec <openapi.json> [-dir api]
+//
+// "new" creates a project with a server, a health handler and its test. "gen handler" adds a
+// handler with a request type, binding and validation boilerplate, API doc annotations and a
+// test. "gen crud" adds list/get/create/update/delete handlers for a model, a repository
+// interface with an in-memory implementation, route registration and tests. "gen openapi" turns
+// an OpenAPI 3 document (JSON) into typed request and response structs, a Server interface, route
+// registration with parameter binding and validation, and a stub implementation to fill in.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage:
+	mist new <name> [-module <path>]
+	mist gen handler <Name> [-dir handlers] [-method POST] [-path /name]
+	mist gen crud -model <Model> [-dir handlers]
+	mist gen openapi -spec <openapi.json> [-dir api]
+`
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "mist:", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches the sub-command named by the first argument.
+func run(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch args[0] {
+	case "new":
+		return runNew(args[1:])
+	case "gen":
+		if len(args) < 2 {
+			break
+		}
+		switch args[1] {
+		case "handler":
+			return runGenHandler(args[2:])
+		case "crud":
+			return runGenCRUD(args[2:])
+		case "openapi":
+			return runGenOpenAPI(args[2:])
+		}
+	}
+	fmt.Fprint(os.Stderr, usage)
+	os.Exit(2)
+	return nil
+}
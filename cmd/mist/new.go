@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+// runNew implements "mist new".
+func runNew(args []string) error {
+	fs := flag.NewFlagSet("new", flag.ContinueOnError)
+	module := fs.String("module", "", "module path of the project (default: the project name)")
+	name, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		return errors.New("new: project name is required")
+	}
+	if *module == "" {
+		*module = name
+	}
+	data := map[string]string{"Module": *module, "Name": filepath.Base(name)}
+	files := []file{
+		{path: filepath.Join(name, "go.mod"), tmpl: newGoMod},
+		{path: filepath.Join(name, "main.go"), tmpl: newMain},
+		{path: filepath.Join(name, "server.go"), tmpl: newServer},
+		{path: filepath.Join(name, "handlers", "health.go"), tmpl: newHealth},
+		{path: filepath.Join(name, "handlers", "health_test.go"), tmpl: newHealthTest},
+	}
+	if err = generate(files, data); err != nil {
+		return err
+	}
+	fmt.Printf("\nnext steps:\n\tcd %s\n\tgo get github.com/dormoron/mist\n\tgo mod tidy\n\tgo run .\n", name)
+	return nil
+}
+
+var newGoMod = parse("go.mod", `module {{.Module}}
+
+go 1.22
+`)
+
+var newMain = parse("main.go", `package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/dormoron/mist"
+)
+
+func main() {
+	server := NewServer()
+	if err := server.RunWithSignals(":8080",
+		mist.RunWithPreStopDelay(5*time.Second),
+		mist.RunWithGracePeriod(10*time.Second)); err != nil {
+		log.Fatal(err)
+	}
+}
+`)
+
+var newServer = parse("server.go", `package main
+
+import (
+	"github.com/dormoron/mist"
+
+	"{{.Module}}/handlers"
+)
+
+// NewServer creates the HTTP server of {{.Name}} with all of its routes. It is also the
+// constructor checked by mistcheck.
+func NewServer() *mist.HTTPServer {
+	server := mist.InitHTTPServer()
+	server.GET("/health", handlers.Health)
+	return server
+}
+`)
+
+var newHealth = parse("health.go", `package handlers
+
+import (
+	"net/http"
+
+	"github.com/dormoron/mist"
+)
+
+// HealthResponse is the body of health check responses.
+type HealthResponse struct {
+	Status string ´json:"status"´
+}
+
+// Health reports that the service is up.
+//
+// @Summary  Health check
+// @Produce  json
+// @Success  200 {object} HealthResponse
+// @Router   /health [get]
+func Health(ctx *mist.Context) {
+	_ = ctx.RespondWithJSON(http.StatusOK, HealthResponse{Status: "ok"})
+}
+`)
+
+var newHealthTest = parse("health_test.go", `package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dormoron/mist"
+)
+
+func TestHealth(t *testing.T) {
+	server := mist.InitHTTPServer()
+	server.GET("/health", Health)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+`)
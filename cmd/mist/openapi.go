@@ -0,0 +1,781 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// spec is the subset of an OpenAPI 3 document used by "mist gen openapi".
+type spec struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*pathItem `json:"paths"`
+	Components struct {
+		Schemas       map[string]*schema      `json:"schemas"`
+		Parameters    map[string]*parameter   `json:"parameters"`
+		RequestBodies map[string]*requestBody `json:"requestBodies"`
+		Responses     map[string]*response    `json:"responses"`
+	} `json:"components"`
+}
+
+type pathItem struct {
+	Parameters []*parameter `json:"parameters"`
+	Get        *operation   `json:"get"`
+	Put        *operation   `json:"put"`
+	Post       *operation   `json:"post"`
+	Delete     *operation   `json:"delete"`
+	Options    *operation   `json:"options"`
+	Head       *operation   `json:"head"`
+	Patch      *operation   `json:"patch"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Description string               `json:"description"`
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *requestBody         `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref"`
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description"`
+	Required    bool    `json:"required"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Ref      string               `json:"$ref"`
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Ref         string               `json:"$ref"`
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Description          string             `json:"description"`
+	Items                *schema            `json:"items"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	AllOf                []*schema          `json:"allOf"`
+	Enum                 []any              `json:"enum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// typeDecl is a struct type emitted by the generator.
+type typeDecl struct {
+	Name   string
+	Doc    string
+	Fields []fieldDecl
+}
+
+type fieldDecl struct {
+	Name string
+	Type string
+	Tag  string
+	Doc  string
+}
+
+// opDecl is an operation emitted by the generator.
+type opDecl struct {
+	Name     string
+	Method   string
+	Path     string
+	SpecPath string
+	Doc      string
+	Params   []paramDecl
+	Body     *bodyDecl
+	Resp     string
+	Status   int
+}
+
+type paramDecl struct {
+	Field    string
+	Name     string
+	In       string
+	Required bool
+}
+
+type bodyDecl struct {
+	Type     string
+	Required bool
+}
+
+// openapiGen converts a spec into declarations.
+type openapiGen struct {
+	spec  *spec
+	types []*typeDecl
+	names map[string]bool
+	time  bool
+}
+
+// runGenOpenAPI implements "mist gen openapi".
+func runGenOpenAPI(args []string) error {
+	fs := flag.NewFlagSet("gen openapi", flag.ContinueOnError)
+	specPath := fs.String("spec", "", "path of the OpenAPI 3 document (JSON)")
+	dir := fs.String("dir", "api", "directory of the generated package")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *specPath == "" {
+		*specPath = positional
+	}
+	if *specPath == "" {
+		return errors.New("gen openapi: -spec is required")
+	}
+	raw, err := os.ReadFile(*specPath)
+	if err != nil {
+		return err
+	}
+	var doc spec
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("gen openapi: %s is not a JSON OpenAPI document (convert YAML specs to JSON first): %w", *specPath, err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return fmt.Errorf("gen openapi: unsupported OpenAPI version %q, want 3.x", doc.OpenAPI)
+	}
+
+	g := &openapiGen{spec: &doc, names: make(map[string]bool)}
+	ops, err := g.operations()
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		return fmt.Errorf("gen openapi: %s declares no operations", *specPath)
+	}
+	data := map[string]any{
+		"Package": packageName(*dir),
+		"Spec":    filepath.Base(*specPath),
+		"Types":   g.types,
+		"Ops":     ops,
+		"Time":    g.time,
+	}
+
+	// The generated file is owned by the generator and replaced on every run; the service
+	// stub is only created once so that it can be filled in.
+	gen := filepath.Join(*dir, "api.gen.go")
+	if err = os.Remove(gen); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	files := []file{{path: gen, tmpl: genOpenAPI}}
+	service := filepath.Join(*dir, "service.go")
+	if _, err = os.Stat(service); errors.Is(err, os.ErrNotExist) {
+		files = append(files, file{path: service, tmpl: genOpenAPIService})
+	}
+	if err = generate(files, data); err != nil {
+		return err
+	}
+	fmt.Printf("\nregister the routes:\n\t%s.Register(server, %s.NewService())\n", data["Package"], data["Package"])
+	return nil
+}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// operations converts the paths of the spec into operations, ordered by path and method.
+func (g *openapiGen) operations() ([]opDecl, error) {
+	// Component schemas are declared first so that references resolve to them.
+	for _, name := range sortedKeys(g.spec.Components.Schemas) {
+		g.declare(goName(name), g.spec.Components.Schemas[name])
+	}
+
+	var ops []opDecl
+	for _, p := range sortedKeys(g.spec.Paths) {
+		item := g.spec.Paths[p]
+		methods := []struct {
+			method string
+			op     *operation
+		}{
+			{http.MethodGet, item.Get}, {http.MethodPost, item.Post}, {http.MethodPut, item.Put},
+			{http.MethodPatch, item.Patch}, {http.MethodDelete, item.Delete},
+			{http.MethodHead, item.Head}, {http.MethodOptions, item.Options},
+		}
+		for _, m := range methods {
+			if m.op == nil {
+				continue
+			}
+			op, err := g.operation(p, m.method, item, m.op)
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+func (g *openapiGen) operation(p string, method string, item *pathItem, op *operation) (opDecl, error) {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(method) + " " + pathParamPattern.ReplaceAllString(p, "by $1")
+	}
+	res := opDecl{
+		Name:     goName(name),
+		Method:   method,
+		Path:     pathParamPattern.ReplaceAllString(p, ":$1"),
+		SpecPath: p,
+		Doc:      sentence(firstNonEmpty(op.Summary, op.Description)),
+		Status:   http.StatusOK,
+	}
+	if g.names[res.Name+"Request"] {
+		return res, fmt.Errorf("gen openapi: duplicate operation %s", res.Name)
+	}
+
+	req := &typeDecl{Name: res.Name + "Request", Doc: fmt.Sprintf("%s holds the parameters and body of %s %s.", res.Name+"Request", method, p)}
+	params := make([]*parameter, 0, len(item.Parameters)+len(op.Parameters))
+	params = append(params, item.Parameters...)
+	params = append(params, op.Parameters...)
+	seen := make(map[string]int)
+	for _, prm := range params {
+		prm = g.resolveParameter(prm)
+		if prm == nil || prm.In == "cookie" {
+			continue
+		}
+		typ := g.paramType(prm.Schema)
+		field := fieldDecl{
+			Name: goName(prm.Name),
+			Type: typ,
+			Tag:  tag(prm.Name, true, rules(prm.Schema, false, typ)),
+			Doc:  prm.Description,
+		}
+		decl := paramDecl{Field: field.Name, Name: prm.Name, In: prm.In, Required: prm.Required || prm.In == "path"}
+		// Operation parameters override path item parameters with the same name and location.
+		if i, ok := seen[prm.In+":"+prm.Name]; ok {
+			req.Fields[i], res.Params[i] = field, decl
+			continue
+		}
+		seen[prm.In+":"+prm.Name] = len(req.Fields)
+		req.Fields = append(req.Fields, field)
+		res.Params = append(res.Params, decl)
+	}
+
+	if body := g.resolveRequestBody(op.RequestBody); body != nil {
+		if s := jsonSchema(body.Content); s != nil {
+			typ := g.goType(s, res.Name+"Body")
+			if !body.Required && !strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") {
+				typ = "*" + typ
+			}
+			res.Body = &bodyDecl{Type: typ, Required: body.Required}
+			req.Fields = append(req.Fields, fieldDecl{Name: "Body", Type: typ, Tag: tag("body", true, ""), Doc: "Body is the decoded JSON request body."})
+		}
+	}
+	g.add(req)
+
+	codes := sortedKeys(op.Responses)
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil || status < 200 || status > 299 {
+			continue
+		}
+		res.Status = status
+		if resp := g.resolveResponse(op.Responses[code]); resp != nil {
+			if s := jsonSchema(resp.Content); s != nil {
+				res.Resp = g.goType(s, res.Name+"Response")
+			}
+		}
+		break
+	}
+	return res, nil
+}
+
+// declare adds the struct (or named non-struct type) described by s under name.
+func (g *openapiGen) declare(name string, s *schema) {
+	if g.names[name] {
+		return
+	}
+	if s.Ref != "" || (s.Type != "object" && s.Type != "" && len(s.AllOf) == 0) ||
+		(s.Properties == nil && len(s.AllOf) == 0) {
+		// Aliases of other types are declared as defined types so they keep their name.
+		g.names[name] = true
+		g.types = append(g.types, &typeDecl{Name: name, Doc: docOf(name, s), Fields: []fieldDecl{{Type: g.goType(s, name+"Value")}}})
+		return
+	}
+	decl := &typeDecl{Name: name, Doc: docOf(name, s)}
+	g.add(decl)
+	props, required := s.Properties, s.Required
+	if len(s.AllOf) > 0 {
+		props = make(map[string]*schema)
+		for _, part := range s.AllOf {
+			part = g.resolveSchema(part)
+			for k, v := range part.Properties {
+				props[k] = v
+			}
+			required = append(required, part.Required...)
+		}
+	}
+	for _, prop := range sortedKeys(props) {
+		ps := props[prop]
+		req := slices.Contains(required, prop)
+		typ := g.goType(ps, name+goName(prop))
+		if !req && g.isObject(ps) {
+			typ = "*" + typ
+		}
+		decl.Fields = append(decl.Fields, fieldDecl{
+			Name: goName(prop),
+			Type: typ,
+			Tag:  tag(prop, req, rules(ps, req, typ)),
+			Doc:  g.resolveSchema(ps).Description,
+		})
+	}
+}
+
+func (g *openapiGen) add(decl *typeDecl) {
+	g.names[decl.Name] = true
+	g.types = append(g.types, decl)
+}
+
+// isObject reports whether s, after resolving references, is generated as a struct.
+func (g *openapiGen) isObject(s *schema) bool {
+	s = g.resolveSchema(s)
+	return s != nil && (len(s.Properties) > 0 || len(s.AllOf) > 0)
+}
+
+// goType returns the Go type of s, declaring inline object schemas under hint.
+func (g *openapiGen) goType(s *schema, hint string) string {
+	if s == nil {
+		return "any"
+	}
+	if s.Ref != "" {
+		return goName(refName(s.Ref))
+	}
+	if len(s.AllOf) == 1 {
+		return g.goType(s.AllOf[0], hint)
+	}
+	switch s.Type {
+	case "string":
+		if s.Format == "date-time" {
+			g.time = true
+			return "time.Time"
+		}
+		return "string"
+	case "integer":
+		if s.Format == "int32" {
+			return "int32"
+		}
+		return "int64"
+	case "number":
+		if s.Format == "float" {
+			return "float32"
+		}
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]" + g.goType(s.Items, hint+"Item")
+	}
+	if len(s.Properties) > 0 || len(s.AllOf) > 0 {
+		g.declare(hint, s)
+		return hint
+	}
+	if len(s.AdditionalProperties) > 0 && s.AdditionalProperties[0] == '{' {
+		var inner schema
+		if json.Unmarshal(s.AdditionalProperties, &inner) == nil {
+			return "map[string]" + g.goType(&inner, hint+"Value")
+		}
+	}
+	if s.Type == "object" {
+		return "map[string]any"
+	}
+	return "any"
+}
+
+// paramType maps a parameter schema to one of the types the generated binder understands.
+func (g *openapiGen) paramType(s *schema) string {
+	s = g.resolveSchema(s)
+	if s == nil {
+		return "string"
+	}
+	switch typ := g.goType(s, ""); typ {
+	case "string", "int64", "int32", "float64", "float32", "bool", "[]string":
+		return typ
+	}
+	if s.Type == "array" {
+		return "[]string"
+	}
+	return "string"
+}
+
+func (g *openapiGen) resolveSchema(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		s = g.spec.Components.Schemas[refName(s.Ref)]
+	}
+	return s
+}
+
+func (g *openapiGen) resolveParameter(p *parameter) *parameter {
+	for p != nil && p.Ref != "" {
+		p = g.spec.Components.Parameters[refName(p.Ref)]
+	}
+	return p
+}
+
+func (g *openapiGen) resolveRequestBody(b *requestBody) *requestBody {
+	for b != nil && b.Ref != "" {
+		b = g.spec.Components.RequestBodies[refName(b.Ref)]
+	}
+	return b
+}
+
+func (g *openapiGen) resolveResponse(r *response) *response {
+	for r != nil && r.Ref != "" {
+		r = g.spec.Components.Responses[refName(r.Ref)]
+	}
+	return r
+}
+
+// jsonSchema returns the schema of the JSON media type of content.
+func jsonSchema(content map[string]mediaType) *schema {
+	for _, ct := range sortedKeys(content) {
+		if ct == "application/json" || strings.HasSuffix(ct, "+json") {
+			return content[ct].Schema
+		}
+	}
+	return nil
+}
+
+// rules translates the constraints of s into validation rules.
+func rules(s *schema, required bool, typ string) string {
+	var res []string
+	if required && typ != "bool" && !strings.HasPrefix(typ, "int") && !strings.HasPrefix(typ, "float") {
+		res = append(res, "required")
+	}
+	if s == nil {
+		return strings.Join(res, ",")
+	}
+	for _, bound := range []struct {
+		rule string
+		val  *int
+	}{{"min", s.MinLength}, {"max", s.MaxLength}, {"min", s.MinItems}, {"max", s.MaxItems}} {
+		if bound.val != nil {
+			res = append(res, bound.rule+"="+strconv.Itoa(*bound.val))
+		}
+	}
+	if s.Minimum != nil {
+		res = append(res, "min="+strconv.FormatFloat(*s.Minimum, 'g', -1, 64))
+	}
+	if s.Maximum != nil {
+		res = append(res, "max="+strconv.FormatFloat(*s.Maximum, 'g', -1, 64))
+	}
+	switch s.Format {
+	case "email":
+		res = append(res, "email")
+	case "uri", "url":
+		res = append(res, "url")
+	}
+	if len(s.Enum) > 0 {
+		opts := make([]string, len(s.Enum))
+		for i, v := range s.Enum {
+			opts[i] = fmt.Sprint(v)
+		}
+		res = append(res, "oneof="+strings.Join(opts, " "))
+	}
+	return strings.Join(res, ",")
+}
+
+// tag builds the struct tag of a field.
+func tag(name string, required bool, validate string) string {
+	res := `json:"` + name
+	if !required {
+		res += ",omitempty"
+	}
+	res += `"`
+	if validate != "" {
+		res += ` validate:"` + validate + `"`
+	}
+	return "`" + res + "`"
+}
+
+func docOf(name string, s *schema) string {
+	if s.Description != "" {
+		return name + ": " + strings.TrimSpace(s.Description)
+	}
+	return name + " is generated from the " + name + " schema."
+}
+
+// sentence terminates s with a period.
+func sentence(s string) string {
+	if s != "" && !strings.HasSuffix(s, ".") {
+		s += "."
+	}
+	return s
+}
+
+func refName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// initialisms are the words written in upper case in Go identifiers.
+var initialisms = map[string]bool{"id": true, "url": true, "uri": true, "http": true, "api": true, "json": true, "uuid": true, "ip": true}
+
+// goName converts a schema, property or operation name into an exported Go identifier.
+func goName(name string) string {
+	var b strings.Builder
+	for _, w := range words(strings.Map(func(r rune) rune {
+		if r == '.' || r == '/' || r == '{' || r == '}' {
+			return ' '
+		}
+		return r
+	}, name)) {
+		if initialisms[w] {
+			b.WriteString(strings.ToUpper(w))
+			continue
+		}
+		b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+	}
+	res := b.String()
+	if res == "" || (res[0] >= '0' && res[0] <= '9') {
+		res = "X" + res
+	}
+	return res
+}
+
+var genOpenAPI = parse("api.gen.go", `// Code generated by mist gen openapi from {{.Spec}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+{{- if .Time}}
+	"time"{{end}}
+
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/errcode"
+	"github.com/dormoron/mist/validation"
+)
+{{range .Types}}
+// {{.Doc}}
+{{- if and .Fields (not (index .Fields 0).Name)}}
+type {{.Name}} {{(index .Fields 0).Type}}
+{{- else}}
+type {{.Name}} struct {
+{{- range .Fields}}
+{{- if .Doc}}
+	// {{.Doc}}{{end}}
+	{{.Name}} {{.Type}} {{.Tag}}
+{{- end}}
+}
+{{- end}}
+{{end}}
+// Server is implemented by the service behind the API. Returned errors are reported with
+// ctx.RespondError, so *errcode.Error values control the status and code of the response.
+type Server interface {
+{{- range .Ops}}
+	// {{.Name}} handles {{.Method}} {{.SpecPath}}.{{if .Doc}} {{.Doc}}{{end}}
+	{{.Name}}(ctx *mist.Context, req {{.Name}}Request) {{if .Resp}}({{.Resp}}, error){{else}}error{{end}}
+{{- end}}
+}
+
+// Unimplemented implements Server by answering every operation with 501 Not Implemented.
+// Embed it to compile against a spec before every operation is written.
+type Unimplemented struct{}
+{{range .Ops}}
+// {{.Name}} reports that the operation is not implemented.
+func (Unimplemented) {{.Name}}(*mist.Context, {{.Name}}Request) {{if .Resp}}({{.Resp}}, error){{else}}error{{end}} {
+{{- if .Resp}}
+	var resp {{.Resp}}
+	return resp, errcode.New(errcode.CodeNotImplemented, nil)
+{{- else}}
+	return errcode.New(errcode.CodeNotImplemented, nil)
+{{- end}}
+}
+{{end}}
+// Register registers the operations of the API on server, binding and validating requests
+// before they reach impl. The middlewares ms wrap every operation, the first one outermost.
+func Register(server *mist.HTTPServer, impl Server, ms ...mist.Middleware) {
+{{- range .Ops}}
+	server.{{.Method}}("{{.Path}}", chain(func(ctx *mist.Context) {
+		var req {{.Name}}Request
+		if err := bind{{.Name}}(ctx, &req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+{{- if .Resp}}
+		resp, err := impl.{{.Name}}(ctx, req)
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		_ = ctx.RespondWithJSON({{.Status}}, resp)
+{{- else}}
+		if err := impl.{{.Name}}(ctx, req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		ctx.RespStatusCode = {{.Status}}
+{{- end}}
+	}, ms))
+{{- end}}
+}
+
+// chain wraps handler with ms.
+func chain(handler mist.HandleFunc, ms []mist.Middleware) mist.HandleFunc {
+	for i := len(ms) - 1; i >= 0; i-- {
+		handler = ms[i](handler)
+	}
+	return handler
+}
+{{range .Ops}}
+func bind{{.Name}}(ctx *mist.Context, req *{{.Name}}Request) error {
+{{- range .Params}}
+	if err := bindParam(ctx, "{{.In}}", "{{.Name}}", {{.Required}}, &req.{{.Field}}); err != nil {
+		return err
+	}
+{{- end}}
+{{- if .Body}}
+	if err := bindBody(ctx, &req.Body, {{.Body.Required}}); err != nil {
+		return err
+	}
+{{- end}}
+	return validation.Validate(req)
+}
+{{end}}
+// bindParam decodes the path, query or header parameter name into dst.
+func bindParam(ctx *mist.Context, in string, name string, required bool, dst any) error {
+	var raw []string
+	switch in {
+	case "path":
+		if v, ok := ctx.PathParams[name]; ok {
+			raw = []string{v}
+		}
+	case "query":
+		raw = ctx.Request.URL.Query()[name]
+	case "header":
+		raw = ctx.Request.Header.Values(name)
+	}
+	if len(raw) == 0 {
+		if required {
+			return validation.Errors{{"{{"}}Field: name, Code: errcode.CodeRequired{{"}}"}}
+		}
+		return nil
+	}
+	var err error
+	switch p := dst.(type) {
+	case *string:
+		*p = raw[0]
+	case *[]string:
+		*p = raw
+	case *int64:
+		*p, err = strconv.ParseInt(raw[0], 10, 64)
+	case *int32:
+		var v int64
+		v, err = strconv.ParseInt(raw[0], 10, 32)
+		*p = int32(v)
+	case *float64:
+		*p, err = strconv.ParseFloat(raw[0], 64)
+	case *float32:
+		var v float64
+		v, err = strconv.ParseFloat(raw[0], 32)
+		*p = float32(v)
+	case *bool:
+		*p, err = strconv.ParseBool(raw[0])
+	default:
+		err = fmt.Errorf("unsupported parameter type %T", dst)
+	}
+	if err != nil {
+		return &errcode.Error{Code: errcode.CodeInvalidParam, Params: map[string]any{"param": name}, Err: err}
+	}
+	return nil
+}
+
+// bindBody decodes the JSON request body into dst.
+func bindBody(ctx *mist.Context, dst any, required bool) error {
+	if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody {
+		if required {
+			return errcode.New(errcode.CodeEmptyBody, nil)
+		}
+		return nil
+	}
+	err := json.NewDecoder(ctx.Request.Body).Decode(dst)
+	if errors.Is(err, io.EOF) {
+		if required {
+			return errcode.New(errcode.CodeEmptyBody, nil)
+		}
+		return nil
+	}
+	if err != nil {
+		return errcode.New(errcode.CodeMalformedBody, err)
+	}
+	return nil
+}
+`)
+
+var genOpenAPIService = parse("service.go", `package {{.Package}}
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/errcode"
+)
+
+// Service implements Server. Replace the stubs with the logic of each operation; operations
+// added to the spec later can be stubbed by embedding Unimplemented.
+type Service struct{}
+
+// NewService creates the Service registered by Register.
+func NewService() *Service {
+	return &Service{}
+}
+
+var _ Server = (*Service)(nil)
+{{range .Ops}}
+// {{.Name}} handles {{.Method}} {{.SpecPath}}.{{if .Doc}} {{.Doc}}{{end}}
+func (s *Service) {{.Name}}(ctx *mist.Context, req {{.Name}}Request) {{if .Resp}}({{.Resp}}, error){{else}}error{{end}} {
+{{- if .Resp}}
+	var resp {{.Resp}}
+	return resp, errcode.New(errcode.CodeNotImplemented, nil)
+{{- else}}
+	return errcode.New(errcode.CodeNotImplemented, nil)
+{{- end}}
+}
+{{end}}`)
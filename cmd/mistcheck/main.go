@@ -0,0 +1,87 @@
+// Command mistcheck reports route conflicts and middleware mistakes of a mist server.
+//
+// mistcheck builds a small driver program that imports the package holding the server
+// constructor, calls it and runs the routecheck analysis on the result. It must be run from
+// within the module of the application so the package can be resolved:
+//
+//	mistcheck -pkg github.com/acme/shop/internal/server -func New -format json
+//
+// The constructor must have the signature func() *mist.HTTPServer. The exit status is 1 when a
+// finding reaches the -fail-on severity, which makes the command suitable for CI.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+)
+
+var driver = template.Must(template.New("driver").Parse(`// Code generated by mistcheck. DO NOT EDIT.
+
+package main
+
+import (
+	"os"
+
+	"github.com/dormoron/mist/routecheck"
+	target {{printf "%q" .Pkg}}
+)
+
+func main() {
+	os.Exit(routecheck.Main(target.{{.Func}}, os.Args[1:]))
+}
+`))
+
+func main() {
+	pkg := flag.String("pkg", "", "import path of the package holding the server constructor")
+	fn := flag.String("func", "NewServer", "name of the constructor, with the signature func() *mist.HTTPServer")
+	format := flag.String("format", "text", "output format: text or json")
+	failOn := flag.String("fail-on", "error", "lowest severity failing the check: error, warning or none")
+	flag.Parse()
+	if *pkg == "" {
+		fmt.Fprintln(os.Stderr, "mistcheck: -pkg is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	os.Exit(run(*pkg, *fn, *format, *failOn))
+}
+
+// run generates the driver in a temporary directory of the current module, runs it and returns
+// its exit status.
+func run(pkg string, fn string, format string, failOn string) int {
+	dir, err := os.MkdirTemp(".", ".mistcheck-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mistcheck:", err)
+		return 2
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "main.go"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mistcheck:", err)
+		return 2
+	}
+	err = driver.Execute(f, map[string]string{"Pkg": pkg, "Func": fn})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mistcheck:", err)
+		return 2
+	}
+
+	cmd := exec.Command("go", "run", "./"+filepath.Base(dir), "-format", format, "-fail-on", failOn)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok {
+			return exit.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, "mistcheck:", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,133 @@
+package mist
+
+import (
+	"bufio"
+	"github.com/dormoron/mist/internal/errs"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Commit sends the status code and the headers of the response, exactly once. Handlers and
+// middleware normally never call it: the response is committed when it is flushed, after every
+// middleware has run, so that headers set at any point of the chain reach the client. Call it
+// before streaming a body to the ResponseWriter; writing to the ResponseWriter directly commits
+// the response as well. Headers set after the commit are lost.
+//
+// The status is RespStatusCode, or 200 when it is not set. The Server-Timing header is added
+// from the metrics recorded with AddTiming.
+func (c *Context) Commit() {
+	if c.headerWritten {
+		return
+	}
+	if c.RespStatusCode == 0 {
+		c.RespStatusCode = http.StatusOK
+	}
+	c.writeTimings()
+	c.ResponseWriter.WriteHeader(c.RespStatusCode)
+	c.headerWritten = true
+}
+
+// Committed reports whether the status code and the headers of the response have been sent,
+// after which they cannot be changed anymore.
+func (c *Context) Committed() bool {
+	return c.headerWritten
+}
+
+// Hijack takes over the connection of the request, for protocols that leave HTTP behind, such
+// as tunnels opened by CONNECT, proxied upgrades or custom Upgrade handshakes. The handler
+// then owns the connection: it writes the response of the handshake itself, must close the
+// connection when done, and may keep it past the return of the handler. The response is marked
+// committed and the server writes nothing more; the read and write deadlines of the server and
+// the handler timeout are cleared.
+//
+// Hijacking is only possible for HTTP/1.x requests and before the response is committed; a
+// response buffered but not committed yet, e.g. by RespondWithJSON, is discarded.
+//
+// Example:
+//
+//	conn, r, err := ctx.Hijack()
+//	if err != nil {
+//	    _ = ctx.RespondError(err)
+//	    return
+//	}
+//	_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: myproto\r\nConnection: Upgrade\r\n\r\n"))
+//	go serveMyProto(conn, r)
+//
+// Returns:
+//   - net.Conn: The connection.
+//   - *bufio.Reader: The reader of the connection, holding the bytes the client sent past the
+//     request that the server already buffered; read from it rather than from the connection.
+//   - error: An error wrapping errors.ErrResponseCommitted if the response is committed, or
+//     http.ErrNotSupported if the connection cannot be hijacked, e.g. for HTTP/2.
+func (c *Context) Hijack() (net.Conn, *bufio.Reader, error) {
+	if c.hijacked || c.headerWritten {
+		return nil, nil, errs.ErrResponseCommitted()
+	}
+	conn, rw, err := http.NewResponseController(c.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.hijacked = true
+	c.headerWritten = true
+	_ = conn.SetDeadline(time.Time{})
+	if c.deadline != nil {
+		c.deadline.reset(0)
+	}
+	return conn, rw.Reader, nil
+}
+
+// Hijacked reports whether the handler took over the connection with Hijack.
+func (c *Context) Hijacked() bool {
+	return c.hijacked
+}
+
+// responseWriter is the ResponseWriter of the requests served by HTTPServer. It makes sure
+// the header is sent exactly once, with the buffered status, however the handlers write.
+type responseWriter struct {
+	http.ResponseWriter
+	ctx *Context
+}
+
+// WriteHeader sends the header with statusCode, unless the response is already committed.
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.ctx.headerWritten {
+		return
+	}
+	w.ctx.headerWritten = true
+	w.ctx.RespStatusCode = statusCode
+	if w.ctx.frames != nil {
+		w.ctx.frames.apply(w.Header())
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write commits the response if needed and writes p to the body.
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.ctx.Commit()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush commits the response if needed and sends the buffered body to the client.
+func (w *responseWriter) Flush() {
+	w.ctx.Commit()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection, e.g. for WebSockets. Libraries hijacking
+// through the ResponseWriter mark the response committed and hijacked, as Context.Hijack does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.ctx.hijacked = true
+		w.ctx.headerWritten = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
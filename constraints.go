@@ -0,0 +1,163 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/errcode"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RouteMetaConstraints is the metadata key under which Route.Constrain records the constraints
+// of a route, so that documentation tooling reading RouteTrees can describe them.
+const RouteMetaConstraints = "constraints"
+
+// Constraints declares the requests a route accepts. The router checks them after the
+// middleware of the route and before its handler, and answers violating requests with a
+// problem response instead of invoking the handler.
+//
+// Fields:
+//   - Headers: The request headers that must be present; requests lacking one get 400.
+//   - Consumes: The media types accepted for request bodies, such as "application/json"; "*/*"
+//     and "image/*" match families. Requests with a body of another type get 415. Empty
+//     accepts every type.
+//   - Produces: The media types the route responds with. Requests whose Accept header matches
+//     none of them get 406. Empty accepts every Accept header.
+//   - MaxBodySize: The largest request body, in bytes; larger bodies get 413, whether announced
+//     by Content-Length or found while reading. 0 means no limit.
+//   - MaxHeaderSize: The largest total size of the request headers, in bytes; requests with
+//     larger headers get 431. 0 means no limit beyond the one of the server.
+type Constraints struct {
+	Headers       []string `json:"headers,omitempty"`
+	Consumes      []string `json:"consumes,omitempty"`
+	Produces      []string `json:"produces,omitempty"`
+	MaxBodySize   int64    `json:"max_body_size,omitempty"`
+	MaxHeaderSize int      `json:"max_header_size,omitempty"`
+}
+
+// Constrain declares the requests the route accepts, see Constraints. Calling Constrain again
+// replaces the constraints of the route. Constraints must be declared before the server starts
+// handling requests.
+//
+// Example:
+//
+//	server.POST("/uploads", upload).Constrain(mist.Constraints{
+//	    Headers:     []string{"Idempotency-Key"},
+//	    Consumes:    []string{"image/*"},
+//	    Produces:    []string{"application/json"},
+//	    MaxBodySize: 10 << 20,
+//	})
+//
+// Parameters:
+//   - c: The constraints.
+//
+// Returns:
+//   - *Route: The route, for chaining.
+func (r *Route) Constrain(c Constraints) *Route {
+	r.node.constraints = &c
+	return r.Meta(RouteMetaConstraints, c)
+}
+
+// Constrain declares the requests accepted by the routes of the group, both those already
+// registered and those registered afterwards, see Route.Constrain.
+//
+// Parameters:
+//   - c: The constraints.
+//
+// Returns:
+//   - *routerGroup: The group, for chaining.
+func (g *routerGroup) Constrain(c Constraints) *routerGroup {
+	g.constraints = &c
+	for _, route := range g.routes {
+		route.Constrain(c)
+	}
+	return g
+}
+
+// check verifies a request against the constraints, returning the coded error of the first
+// violation.
+func (c *Constraints) check(ctx *Context) error {
+	req := ctx.Request
+	if c.MaxHeaderSize > 0 {
+		size := 0
+		for name, values := range req.Header {
+			for _, v := range values {
+				// "Name: value\r\n"
+				size += len(name) + len(v) + 4
+			}
+		}
+		if size > c.MaxHeaderSize {
+			return &errcode.Error{Code: errcode.CodeHeadersTooLarge, Params: map[string]any{"limit": c.MaxHeaderSize}}
+		}
+	}
+	for _, name := range c.Headers {
+		if req.Header.Get(name) == "" {
+			return &errcode.Error{Code: errcode.CodeHeaderMissing, Params: map[string]any{"header": name}}
+		}
+	}
+	if len(c.Produces) > 0 && !acceptable(req.Header.Values("Accept"), c.Produces) {
+		return &errcode.Error{Code: errcode.CodeNotAcceptable}
+	}
+	hasBody := req.ContentLength > 0 || (req.ContentLength < 0 && req.Body != nil && req.Body != http.NoBody)
+	if len(c.Consumes) > 0 && hasBody {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !matchesAny(mediaType, c.Consumes) {
+			return &errcode.Error{Code: errcode.CodeUnsupportedType, Params: map[string]any{"type": mediaType}}
+		}
+	}
+	if c.MaxBodySize > 0 {
+		if req.ContentLength > c.MaxBodySize {
+			return &errcode.Error{Code: errcode.CodeBodyTooLarge, Params: map[string]any{"limit": c.MaxBodySize}}
+		}
+		if hasBody {
+			req.Body = http.MaxBytesReader(ctx.ResponseWriter, req.Body, c.MaxBodySize)
+		}
+	}
+	return nil
+}
+
+// acceptable reports whether the values of an Accept header allow one of the produced media
+// types; a request without Accept header accepts everything.
+func acceptable(accept []string, produces []string) bool {
+	if len(accept) == 0 {
+		return true
+	}
+	for _, value := range accept {
+		for _, part := range strings.Split(value, ",") {
+			mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			for _, produced := range produces {
+				if matchMediaType(produced, mediaRange) || matchMediaType(mediaRange, produced) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// matchesAny reports whether a media type matches one of the patterns.
+func matchesAny(mediaType string, patterns []string) bool {
+	for _, p := range patterns {
+		if matchMediaType(mediaType, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMediaType reports whether a media type matches a pattern, which may be "*/*" or a
+// family such as "image/*".
+func matchMediaType(mediaType string, pattern string) bool {
+	mediaType, pattern = strings.ToLower(mediaType), strings.ToLower(pattern)
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	family, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(mediaType, family+"/")
+}
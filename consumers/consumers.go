@@ -0,0 +1,143 @@
+// Package consumers runs message consumers beside the HTTP server, so that one binary serves
+// requests and consumes queues with the same logger, metrics, tracing and graceful shutdown.
+// A Consumer reads the messages of a Source, such as a Redis stream read by a consumer group or
+// a Kafka or NATS subscription adapted with Funcs, and handles them with a pool of workers,
+// retrying failed messages with an exponential backoff:
+//
+//	orders := consumers.InitConsumer("orders", consumers.InitRedisStreamSource(rdb, "orders.created", "billing"),
+//	    func(ctx context.Context, msg *consumers.Message) error {
+//	        var order Order
+//	        if err := json.Unmarshal(msg.Payload, &order); err != nil {
+//	            return consumers.Permanent(err)
+//	        }
+//	        return billing.Invoice(ctx, order)
+//	    }).SetConcurrency(8)
+//	consumers.InitGroup(orders).SetMetrics("shop", "consumers").Attach(server)
+//	_ = server.RunWithSignals(":8080")
+//
+// Delivery is at least once: a message is acknowledged once handled, so that a message whose
+// handling was interrupted is delivered again; handlers deduplicate messages by their ID, such
+// as the ID of an event of the outbox package.
+package consumers
+
+import (
+	"context"
+	"errors"
+)
+
+// Message is a message read from a Source.
+//
+// Fields:
+//   - ID: The identifier of the message, e.g. the ID of the entry of a Redis stream.
+//   - Topic: The topic, stream or subject the message was read from.
+//   - Key: The key of the message; may be empty.
+//   - Payload: The content of the message.
+//   - Headers: Metadata of the message, through which the trace context is propagated.
+//   - Attempt: The number of the current attempt at handling the message, from 1.
+//   - Raw: The message of the client of the broker, for sources acknowledging it, e.g. a
+//     jetstream.Msg.
+type Message struct {
+	ID      string
+	Topic   string
+	Key     string
+	Payload []byte
+	Headers map[string]string
+	Attempt int
+	Raw     any
+}
+
+// Handler handles a message. A nil error acknowledges it; other errors are retried, unless
+// wrapped with Permanent.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Source is the broker a consumer reads messages from. It must be safe for concurrent use by
+// the workers of the consumer.
+type Source interface {
+	// Receive blocks until a message is available, or ctx is done.
+	Receive(ctx context.Context) (*Message, error)
+	// Ack acknowledges a handled message.
+	Ack(ctx context.Context, msg *Message) error
+	// Nack reports a message that could not be handled, after its retries; sources move it to
+	// a dead-letter destination, or leave it for redelivery.
+	Nack(ctx context.Context, msg *Message, cause error) error
+}
+
+// Funcs adapts functions into a Source, e.g. around the client of Kafka or NATS:
+//
+//	// github.com/nats-io/nats.go/jetstream
+//	msgs, _ := cons.Messages()
+//	source := consumers.Funcs{
+//	    ReceiveFunc: func(ctx context.Context) (*consumers.Message, error) {
+//	        m, err := msgs.Next()
+//	        if err != nil {
+//	            return nil, err
+//	        }
+//	        return &consumers.Message{ID: m.Headers().Get("Nats-Msg-Id"), Topic: m.Subject(),
+//	            Payload: m.Data(), Raw: m}, nil
+//	    },
+//	    AckFunc: func(ctx context.Context, msg *consumers.Message) error {
+//	        return msg.Raw.(jetstream.Msg).Ack()
+//	    },
+//	    NackFunc: func(ctx context.Context, msg *consumers.Message, _ error) error {
+//	        return msg.Raw.(jetstream.Msg).Term()
+//	    },
+//	}
+//
+// Call Stop on the iterator in a shutdown hook, so that Next returns; a nil AckFunc or
+// NackFunc does nothing.
+type Funcs struct {
+	ReceiveFunc func(ctx context.Context) (*Message, error)
+	AckFunc     func(ctx context.Context, msg *Message) error
+	NackFunc    func(ctx context.Context, msg *Message, cause error) error
+}
+
+// Receive calls ReceiveFunc.
+func (f Funcs) Receive(ctx context.Context) (*Message, error) {
+	return f.ReceiveFunc(ctx)
+}
+
+// Ack calls AckFunc, if any.
+func (f Funcs) Ack(ctx context.Context, msg *Message) error {
+	if f.AckFunc == nil {
+		return nil
+	}
+	return f.AckFunc(ctx, msg)
+}
+
+// Nack calls NackFunc, if any.
+func (f Funcs) Nack(ctx context.Context, msg *Message, cause error) error {
+	if f.NackFunc == nil {
+		return nil
+	}
+	return f.NackFunc(ctx, msg, cause)
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent wraps an error that retrying cannot fix, such as a malformed payload, so that the
+// message is nacked at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent reports whether err was wrapped with Permanent.
+func isPermanent(err error) bool {
+	var perm *permanentError
+	return errors.As(err, &perm)
+}
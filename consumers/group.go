@@ -0,0 +1,300 @@
+package consumers
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const instrumentationName = "github.com/dormoron/mist/consumers"
+
+// Consumer handles the messages of a Source.
+type Consumer struct {
+	name        string
+	source      Source
+	handler     Handler
+	concurrency int
+	attempts    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	timeout     time.Duration
+}
+
+// InitConsumer creates a Consumer handling one message at a time, attempting each message 3
+// times, 1 second apart then doubling up to 30 seconds.
+//
+// Parameters:
+//   - name: The name of the consumer, in the logs, spans and metrics.
+//   - source: The source of the messages.
+//   - handler: The handler of the messages.
+//
+// Returns:
+//   - *Consumer: The initialized consumer.
+func InitConsumer(name string, source Source, handler Handler) *Consumer {
+	return &Consumer{
+		name:        name,
+		source:      source,
+		handler:     handler,
+		concurrency: 1,
+		attempts:    3,
+		backoff:     time.Second,
+		maxBackoff:  30 * time.Second,
+	}
+}
+
+// SetConcurrency sets the number of messages handled at the same time. Messages handled
+// concurrently may complete out of order.
+func (c *Consumer) SetConcurrency(concurrency int) *Consumer {
+	c.concurrency = max(concurrency, 1)
+	return c
+}
+
+// SetRetry sets the number of attempts at handling a message, and the wait before the first
+// retry, doubled at each retry up to maxBackoff.
+func (c *Consumer) SetRetry(attempts int, backoff time.Duration, maxBackoff time.Duration) *Consumer {
+	c.attempts = max(attempts, 1)
+	c.backoff = backoff
+	c.maxBackoff = maxBackoff
+	return c
+}
+
+// SetTimeout sets the time limit of an attempt at handling a message; 0, the default, means no
+// limit.
+func (c *Consumer) SetTimeout(timeout time.Duration) *Consumer {
+	c.timeout = timeout
+	return c
+}
+
+// Group runs consumers until it is shut down, usually with the HTTP server, see Attach.
+type Group struct {
+	consumers []*Consumer
+	logger    *slog.Logger
+	tracer    trace.Tracer
+
+	handled  *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	wg           sync.WaitGroup
+	stop         context.CancelFunc
+	abort        context.CancelFunc
+	stopCtx      context.Context
+	handleCtx    context.Context
+	shutdownOnce sync.Once
+}
+
+// InitGroup creates a Group of consumers logging with slog.Default() and tracing with the
+// global OpenTelemetry tracer provider.
+//
+// Parameters:
+//   - consumers: The consumers.
+//
+// Returns:
+//   - *Group: The initialized group.
+func InitGroup(consumers ...*Consumer) *Group {
+	return &Group{
+		consumers: consumers,
+		logger:    slog.Default(),
+		tracer:    otel.GetTracerProvider().Tracer(instrumentationName),
+	}
+}
+
+// Add adds consumers to the group, before it starts.
+func (g *Group) Add(consumers ...*Consumer) *Group {
+	g.consumers = append(g.consumers, consumers...)
+	return g
+}
+
+// SetLogger sets the logger of the failures, the one of the application.
+func (g *Group) SetLogger(logger *slog.Logger) *Group {
+	g.logger = logger
+	return g
+}
+
+// SetTracer sets the tracer of the spans of the handled messages. The spans continue the trace
+// propagated in the headers of the messages.
+func (g *Group) SetTracer(tracer trace.Tracer) *Group {
+	g.tracer = tracer
+	return g
+}
+
+// SetMetrics counts the handled messages in a Prometheus counter named
+// "<namespace>_<subsystem>_messages_total", labelled by consumer and outcome ("ack", "retry"
+// or "nack"), and observes the handling time in a histogram named
+// "<namespace>_<subsystem>_message_duration_seconds", labelled by consumer. Both are
+// registered with the default registry. It panics if they are already registered.
+func (g *Group) SetMetrics(namespace string, subsystem string) *Group {
+	g.handled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "messages_total",
+		Help:      "Messages handled by the consumers, by outcome.",
+	}, []string{"consumer", "outcome"})
+	g.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "message_duration_seconds",
+		Help:      "Time spent handling a message, per attempt.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"consumer"})
+	prometheus.MustRegister(g.handled, g.duration)
+	return g
+}
+
+// Attach starts the group and registers its shutdown with the server, so that the consumers
+// stop with it and drain their messages within its grace period.
+//
+// Parameters:
+//   - server: The HTTP server.
+func (g *Group) Attach(server *mist.HTTPServer) {
+	g.Start()
+	server.OnShutdown(g.Shutdown)
+}
+
+// Start starts the workers of the consumers.
+func (g *Group) Start() {
+	g.stopCtx, g.stop = context.WithCancel(context.Background())
+	g.handleCtx, g.abort = context.WithCancel(context.Background())
+	for _, c := range g.consumers {
+		for i := 0; i < c.concurrency; i++ {
+			g.wg.Add(1)
+			go g.work(c)
+		}
+	}
+}
+
+// Shutdown stops receiving messages and waits for the messages being handled. When ctx is done
+// first, the contexts of the handlers are cancelled and the messages they did not complete are
+// left for redelivery.
+//
+// Returns:
+//   - error: The error of ctx if the handlers did not complete in time.
+func (g *Group) Shutdown(ctx context.Context) error {
+	if g.stop == nil {
+		return nil
+	}
+	g.shutdownOnce.Do(g.stop)
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		g.abort()
+		return nil
+	case <-ctx.Done():
+		g.abort()
+		return ctx.Err()
+	}
+}
+
+// work receives and handles the messages of a consumer until the group stops.
+func (g *Group) work(c *Consumer) {
+	defer g.wg.Done()
+	for {
+		msg, err := c.source.Receive(g.stopCtx)
+		if g.stopCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			g.logger.Error("consumers: receive failed", "consumer", c.name, "error", err)
+			if !g.sleep(c.backoff) {
+				return
+			}
+			continue
+		}
+		g.handle(c, msg)
+	}
+}
+
+// handle handles a message, retrying it, then acknowledges or nacks it. A message whose retry
+// is interrupted by the shutdown is neither, and is delivered again.
+func (g *Group) handle(c *Consumer, msg *Message) {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		msg.Attempt = attempt
+		err := g.call(c, msg)
+		if err == nil {
+			g.count(c, "ack")
+			if err = c.source.Ack(g.handleCtx, msg); err != nil {
+				g.logger.Error("consumers: ack failed", "consumer", c.name, "message", msg.ID, "error", err)
+			}
+			return
+		}
+		if attempt >= c.attempts || isPermanent(err) {
+			g.count(c, "nack")
+			g.logger.Error("consumers: message failed", "consumer", c.name, "message", msg.ID,
+				"attempts", attempt, "error", err)
+			if err = c.source.Nack(g.handleCtx, msg, err); err != nil {
+				g.logger.Error("consumers: nack failed", "consumer", c.name, "message", msg.ID, "error", err)
+			}
+			return
+		}
+		g.count(c, "retry")
+		if !g.sleep(backoff) {
+			return
+		}
+		backoff = min(2*backoff, c.maxBackoff)
+	}
+}
+
+// call runs one attempt of the handler in a span, turning panics into errors.
+func (g *Group) call(c *Consumer, msg *Message) (err error) {
+	ctx := otel.GetTextMapPropagator().Extract(g.handleCtx, propagation.MapCarrier(msg.Headers))
+	ctx, span := g.tracer.Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.destination.name", msg.Topic),
+			attribute.String("messaging.message.id", msg.ID),
+			attribute.String("messaging.consumer.name", c.name),
+			attribute.Int("messaging.attempt", msg.Attempt),
+		))
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("consumers: handler panic: %v", r)
+		}
+		if g.duration != nil {
+			g.duration.WithLabelValues(c.name).Observe(time.Since(start).Seconds())
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	return c.handler(ctx, msg)
+}
+
+// sleep waits for d, and reports false if the group stopped meanwhile.
+func (g *Group) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-g.stopCtx.Done():
+		return false
+	}
+}
+
+// count counts a handled message.
+func (g *Group) count(c *Consumer, outcome string) {
+	if g.handled != nil {
+		g.handled.WithLabelValues(c.name, outcome).Inc()
+	}
+}
@@ -0,0 +1,197 @@
+package consumers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisStreamSource is a Source reading a Redis stream as a member of a consumer group, so that
+// the instances of a deployment share its entries. Entries written by the RedisStreamPublisher
+// of the outbox package are decoded from their "id", "key", "payload" and "headers" fields;
+// the fields of other entries are passed as headers.
+//
+// Entries are acknowledged with XACK once handled. On start, the entries delivered to the
+// consumer but never acknowledged, because the process stopped, are read again first; entries
+// that failed are moved to the dead-letter stream when one is set, and stay pending otherwise.
+type RedisStreamSource struct {
+	client     redis.Cmdable
+	stream     string
+	group      string
+	consumer   string
+	deadLetter string
+	count      int64
+	block      time.Duration
+	claimIdle  time.Duration
+
+	mutex     sync.Mutex
+	created   bool
+	pending   bool
+	lastClaim time.Time
+	buffer    []redis.XMessage
+}
+
+// InitRedisStreamSource creates a RedisStreamSource reading stream as a member of group,
+// named after the host, creating the group at the end of the stream when it does not exist.
+//
+// Parameters:
+//   - client: The Redis client.
+//   - stream: The name of the stream, e.g. "orders.created".
+//   - group: The name of the consumer group, e.g. the name of the service.
+//
+// Returns:
+//   - *RedisStreamSource: The initialized source.
+func InitRedisStreamSource(client redis.Cmdable, stream string, group string) *RedisStreamSource {
+	host, _ := os.Hostname()
+	return &RedisStreamSource{
+		client:   client,
+		stream:   stream,
+		group:    group,
+		consumer: host,
+		count:    10,
+		block:    2 * time.Second,
+		pending:  true,
+	}
+}
+
+// SetConsumer sets the name of the consumer within the group, which must be stable across the
+// restarts of an instance and distinct between instances, e.g. the name of the pod of a
+// StatefulSet.
+func (s *RedisStreamSource) SetConsumer(name string) *RedisStreamSource {
+	s.consumer = name
+	return s
+}
+
+// SetDeadLetter sets the stream the failed entries are moved to, with their error in the
+// field "error".
+func (s *RedisStreamSource) SetDeadLetter(stream string) *RedisStreamSource {
+	s.deadLetter = stream
+	return s
+}
+
+// SetClaimIdle sets how long an entry stays pending with another consumer of the group before
+// it is claimed, with XAUTOCLAIM, to take over the entries of instances that are gone for good;
+// 0, the default, never claims.
+func (s *RedisStreamSource) SetClaimIdle(idle time.Duration) *RedisStreamSource {
+	s.claimIdle = idle
+	return s
+}
+
+// Receive returns the next entry of the stream, reading them by batches.
+func (s *RedisStreamSource) Receive(ctx context.Context) (*Message, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for len(s.buffer) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := s.fill(ctx); err != nil {
+			return nil, err
+		}
+	}
+	entry := s.buffer[0]
+	s.buffer = s.buffer[1:]
+	return s.decode(entry), nil
+}
+
+// fill reads the next batch of entries: claimed ones, pending ones, then new ones.
+func (s *RedisStreamSource) fill(ctx context.Context) error {
+	if !s.created {
+		err := s.client.XGroupCreateMkStream(ctx, s.stream, s.group, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+		s.created = true
+	}
+	if s.claimIdle > 0 && time.Since(s.lastClaim) >= s.claimIdle {
+		s.lastClaim = time.Now()
+		entries, _, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.group,
+			Consumer: s.consumer,
+			MinIdle:  s.claimIdle,
+			Start:    "0",
+			Count:    s.count,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			s.buffer = entries
+			return nil
+		}
+	}
+	id, block := ">", s.block
+	if s.pending {
+		id, block = "0", -1
+	}
+	streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.group,
+		Consumer: s.consumer,
+		Streams:  []string{s.stream, id},
+		Count:    s.count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		s.buffer = append(s.buffer, stream.Messages...)
+	}
+	if s.pending && len(s.buffer) == 0 {
+		// The entries left pending by a previous run are all handled.
+		s.pending = false
+	}
+	return nil
+}
+
+// decode turns an entry into a message.
+func (s *RedisStreamSource) decode(entry redis.XMessage) *Message {
+	msg := &Message{ID: entry.ID, Topic: s.stream, Headers: make(map[string]string), Raw: entry}
+	for field, value := range entry.Values {
+		str, _ := value.(string)
+		switch field {
+		case "id":
+			msg.ID = str
+		case "key":
+			msg.Key = str
+		case "payload":
+			msg.Payload = []byte(str)
+		case "headers":
+			_ = json.Unmarshal([]byte(str), &msg.Headers)
+		default:
+			msg.Headers[field] = str
+		}
+	}
+	return msg
+}
+
+// Ack acknowledges the entry of a message.
+func (s *RedisStreamSource) Ack(ctx context.Context, msg *Message) error {
+	return s.client.XAck(ctx, s.stream, s.group, msg.Raw.(redis.XMessage).ID).Err()
+}
+
+// Nack moves the entry of a message to the dead-letter stream, if any.
+func (s *RedisStreamSource) Nack(ctx context.Context, msg *Message, cause error) error {
+	if s.deadLetter == "" {
+		return nil
+	}
+	entry := msg.Raw.(redis.XMessage)
+	values := make(map[string]any, len(entry.Values)+1)
+	for field, value := range entry.Values {
+		values[field] = value
+	}
+	values["error"] = cause.Error()
+	if err := s.client.XAdd(ctx, &redis.XAddArgs{Stream: s.deadLetter, Values: values}).Err(); err != nil {
+		return err
+	}
+	return s.client.XAck(ctx, s.stream, s.group, entry.ID).Err()
+}
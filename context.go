@@ -1,12 +1,17 @@
 package mist
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist/errcode"
 	"github.com/dormoron/mist/internal/errs"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
-	"strconv"
+	"reflect"
+	"runtime"
 	"strings"
 	"sync"
 	"time"
@@ -52,6 +57,11 @@ type Context struct {
 	// matches it, this field will hold that pattern "/users/:action".
 	MatchedRoute string
 
+	// handler is the handler of the matched route, named by HandlerName.
+	handler HandleFunc
+	// routeMeta is the metadata attached to the matched route, see Route.Meta.
+	routeMeta map[string]any
+
 	// RespData is a buffer to hold the data that will be written to the HTTP response.
 	// This is used to accumulate the response body prior to writing to the
 	// ResponseWriter.
@@ -67,18 +77,88 @@ type Context struct {
 	// or interface to the template engine that's used to do that rendering.
 	templateEngine TemplateEngine
 
+	// catalog is the error catalog of the server handling the request. It resolves the
+	// status and localized message of error codes emitted by RespondError.
+	catalog *errcode.Catalog
+
+	// tasks tracks the asynchronous work started with Async so that the server can wait for
+	// it during a graceful shutdown.
+	tasks *taskGroup
+
+	// flags is the feature flag evaluator of the server handling the request.
+	flags FlagEvaluator
+
+	// respReader and respSize hold a streamed response body set by RespondReader. They take
+	// precedence over RespData.
+	respReader io.Reader
+	respSize   int64
+
+	// timings holds the Server-Timing metrics of the request, see AddTiming.
+	timings []Timing
+	// timingPolicy decides whether the timings are sent to the client.
+	timingPolicy ServerTimingPolicy
+	// bodyParsers decode request bodies in Bind, keyed by media type.
+	bodyParsers map[string]BodyParser
+	// body caches the request body read by BodyBytes; bodyRead tells whether it was read, and
+	// bodyLimit caps its size.
+	body      []byte
+	bodyRead  bool
+	bodyLimit int64
+	// marshalErrorHandler handles the serialization failures of RespondWithJSON.
+	marshalErrorHandler MarshalErrorHandler
+	// jsonLocalizer localizes the responses of RespondWithJSON, see ServerWithJSONLocalizer.
+	jsonLocalizer *JSONLocalizer
+	// jobs runs the jobs accepted with AcceptAsync, see ServerWithJobs.
+	jobs *jobRunner
+	// start is the time the request started to be served, from which the handler timeout
+	// counts; deadline enforces it, see ServerWithHandlerTimeout.
+	start    time.Time
+	deadline *handlerDeadline
+	// clientCtx is the context of the request as received from net/http, cancelled when the
+	// client disconnects; discardGone skips the response of such requests.
+	clientCtx   context.Context
+	discardGone bool
+	// listener is the listener that accepted the request; nil when the server is used as a
+	// plain http.Handler.
+	listener *listener
+	// flashStore keeps the flash messages of the client; flashes caches those taken by
+	// Flashes for the rest of the request.
+	flashStore   FlashStore
+	flashes      []Flash
+	flashesTaken bool
+	// respondedErr is the error passed to RespondError, see RespondedError.
+	respondedErr error
+	// cacheTags are the surrogate keys of the response, see CacheTag.
+	cacheTags []string
+
 	// UserValues is a flexible storage area provided for the developer to store
 	// any additional values that might be needed throughout the life of the request.
 	// It is essentially a map that can hold values of any type, indexed by string keys.
 	UserValues map[string]any
 
 	// headerWritten is a flag indicating whether or not the HTTP headers have already
-	// been written to the response. This is used to ensure that headers and status code
-	// are not written more than once.
+	// been written to the response, see Commit. This is used to ensure that headers and
+	// status code are written exactly once.
 	headerWritten bool
 
+	// hijacked is a flag indicating whether the handler took over the connection with Hijack,
+	// after which the server writes nothing more to it.
+	hijacked bool
+
+	// cspNonce is the Content-Security-Policy nonce of the request, generated by CSPNonce.
+	cspNonce string
+
+	// frames is the framing policy of the matched route, applied when the response is committed.
+	frames *framePolicy
+
+	// viewData is the view data of the request, see ViewData; viewContributors are the
+	// contributors not run yet.
+	viewData         ViewData
+	viewContributors []ViewContributor
+
 	// Aborted is a flag indicating whether the request handling should be stopped.
-	// If true, handlers should terminate further processing immediately.
+	// If true, the remaining middleware and handlers are skipped; prefer Abort and
+	// IsAborted to setting and reading it directly.
 	Aborted bool
 }
 
@@ -136,47 +216,14 @@ func (c *Context) Value(key any) any {
 	return c.Request.Context().Value(key)
 }
 
-// writeHeader sends an HTTP response header with the provided status code
-// if the header has not been written yet. It ensures that the WriteHeader
-// method of the ResponseWriter is called only once during the lifecycle
-// of a single HTTP request.
-//
-// This method belongs to the Context structure and it handles the state of
-// the response header using an internal flag (headerWritten).
-//
-// Params:
-//
-//	statusCode int - The HTTP status code to be sent with the response header.
-func (c *Context) writeHeader(statusCode int) {
-	if c.Aborted {
-		return
-	}
-
-	// Check if the header has already been written.
-	// The headerWritten field is a boolean and it indicates whether the
-	// HTTP status code and headers have already been sent to the client.
-	// This check is crucial to avoid writing the header more than once.
-	if !c.headerWritten {
-		// Use the ResponseWriter from the Context to write the HTTP status code.
-		// ResponseWriter.WriteHeader sends the HTTP response header with the
-		// status code provided. If called more than once, it would typically
-		// result in a runtime error, as the HTTP protocol allows for only one
-		// set of headers per response.
-		c.ResponseWriter.WriteHeader(statusCode)
-		c.RespStatusCode = statusCode
-
-		// Set the headerWritten flag to true to indicate that the header
-		// has now been written for this request.
-		// This ensures that subsequent calls to writeHeader within the same
-		// request will not attempt to write the header again.
-		c.headerWritten = true
-	}
-}
+// AbortWithStatus stops the handling of the request with the given status code. The
+// remaining middleware and handlers are skipped and the response is committed with the
+// status and the headers set so far when it is flushed.
 func (c *Context) AbortWithStatus(code int) {
 	if c.Aborted {
 		return
 	}
-	c.writeHeader(code)
+	c.RespStatusCode = code
 	c.Aborted = true
 }
 
@@ -189,6 +236,10 @@ func (c *Context) AbortWithStatus(code int) {
 //   - 'data' is an interface{} type, which means it can accept any value that conforms to Go's empty interface. This is
 //     the dynamic content that will be injected into the template during rendering.
 //
+// When the request has view data, see ViewData, a map or nil 'data' is merged over it, so that the template
+// sees both the common entries, such as the current user, and those of the handler, which win on conflicts.
+// Other data is passed as is.
+//
 // The rendered template output is captured and assigned to 'c.RespData'. This output will typically be HTML or another
 // text format suitable for the client's response.
 //
@@ -205,12 +256,14 @@ func (c *Context) AbortWithStatus(code int) {
 func (c *Context) Render(templateName string, data any) error {
 	var err error
 	// Use the template engine to render the template with the provided data.
-	c.RespData, err = c.templateEngine.Render(c.Request.Context(), templateName, data)
+	c.RespData, err = c.templateEngine.Render(c.Request.Context(), templateName, c.viewDataFor(data))
 	if err != nil {
 		// On error, set the HTTP status to 500 and return the error.
 		c.RespStatusCode = http.StatusInternalServerError
 		return err
 	}
+	// Fill in the Content-Security-Policy nonce written by the cspNonce template function.
+	c.RespData = c.fillCSPNonce(c.RespData)
 	// On success, set the HTTP status to 200.
 	c.RespStatusCode = http.StatusOK
 	return nil
@@ -339,18 +392,18 @@ func (c *Context) RespondSuccess(val any) error {
 //     The value provided must be a valid input for the json.Marshal function, which means it should be able to be encoded into JSON. Non-exported struct fields will be omitted by the marshaller.
 //
 // This function performs several actions:
-//  1. It uses the 'json.Marshal' function to serialize the 'val' parameter into a JSON-formatted byte slice 'data'. If marshaling fails,
-//     it returns the resultant error without writing anything to the response.
-//  2. Assuming marshaling is successful, it sets the "Content-Type" header of the response to "application/json" to inform
+//  1. When the server has a JSONLocalizer and the client asks for a locale, the values of 'val' such as timestamps
+//     are first formatted for that locale, see ServerWithJSONLocalizer.
+//  2. It uses the 'json.Marshal' function to serialize the 'val' parameter into a JSON-formatted byte slice 'data'. If marshaling fails,
+//     it hands the error to the MarshalErrorHandler of the server, which by default responds with a 500 problem, and returns it.
+//  3. Assuming marshaling is successful, it sets the "Content-Type" header of the response to "application/json" to inform
 //     the client that the server is returning JSON-formatted data.
-//  3. It sets the "Content-Length" header to the length of the serialized JSON data, which helps the client understand how much data
-//     is being transmitted.
-//  4. It writes the HTTP status code to the response using WriteHeader(status). This must be done before writing the response body.
-//  5. Lastly, it assigns the JSON data to 'c.RespData' and the status code to 'c.RespStatusCode' for later use or inspection.
+//  4. Lastly, it assigns the JSON data to 'c.RespData' and the status code to 'c.RespStatusCode'. Nothing is written yet: the
+//     status, the headers and the body are committed when the response is flushed, so middleware can still inspect and amend them.
 //
 // Return Value:
 // - If the JSON serialization and writing to the response are successful, it returns 'nil', indicating that the operation completed without error.
-// - If an error occurs during JSON serialization, the error is returned, and no further action is taken.
+// - If an error occurs during JSON serialization, the error is returned after the MarshalErrorHandler of the server handled it.
 //
 // Usage:
 // - This method is designed to be used in HTTP handler functions where a JSON response is needed. It abstracts away the common tasks of JSON serialization, header setting, and response writing.
@@ -366,17 +419,27 @@ func (c *Context) RespondSuccess(val any) error {
 //	}
 //
 // Note:
-//   - It is important to note that once the 'WriteHeader' method is called, it's not possible to change the response status code
-//     or write any new headers. Also, care must be taken to ensure that 'RespJSON' is not called after the response body has started to be written
-//     by other means, as this would result in an HTTP protocol error.
+//   - Once the response is committed, see Commit, it's not possible to change the response status code or write any new headers.
+//     Calling 'RespondWithJSON' after the response body has started to be written by other means has no effect on the status.
 func (c *Context) RespondWithJSON(status int, val any) error {
+	if c.jsonLocalizer != nil {
+		locale, negotiated := c.jsonLocalizer.locale(c)
+		if negotiated {
+			c.ResponseWriter.Header().Add("Vary", "Accept-Language")
+		}
+		if locale != "" {
+			val = c.jsonLocalizer.Apply(locale, val)
+			c.ResponseWriter.Header().Set("Content-Language", locale)
+		}
+	}
 	data, err := json.Marshal(val)
 	if err != nil {
+		if c.marshalErrorHandler != nil {
+			c.marshalErrorHandler(c, val, err)
+		}
 		return err
 	}
-	c.writeHeader(status)
 	c.ResponseWriter.Header().Set("Content-Type", "application/json")
-	c.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(data)))
 	c.RespData = data
 	c.RespStatusCode = status
 	return err
@@ -423,7 +486,8 @@ func (c *Context) RespondWithJSON(status int, val any) error {
 //
 // Note:
 //   - The 'BindJSON' method should be called before accessing the request body by any other means, as the body is an io.ReadCloser
-//     and can generally only be read once. Reading the body elsewhere before calling 'BindJSON' will likely result in an EOF error.
+//     and can generally only be read once. Reading the body elsewhere before calling 'BindJSON' will likely result in an EOF error,
+//     unless it was read with BodyBytes, whose cached copy 'BindJSON' decodes from the start.
 func (c *Context) BindJSON(val any) error {
 	if val == nil {
 		return errs.ErrInputNil()
@@ -431,6 +495,9 @@ func (c *Context) BindJSON(val any) error {
 	if c.Request.Body == nil {
 		return errs.ErrBodyNil()
 	}
+	if c.bodyRead {
+		c.resetBody()
+	}
 	decoder := json.NewDecoder(c.Request.Body)
 	return decoder.Decode(val)
 }
@@ -478,7 +545,8 @@ func (c *Context) BindJSON(val any) error {
 //
 // Note:
 //   - Similar to BindJSON, BindJSONOpt should be called before any other form of accessing the request body is performed, as it is an io.ReadCloser
-//     that allows for a single read operation. This means that calling BindJSONOpt after the body has been read will likely result in an EOF error.
+//     that allows for a single read operation. This means that calling BindJSONOpt after the body has been read will likely result in an EOF error,
+//     unless it was read with BodyBytes.
 func (c *Context) BindJSONOpt(val any, useNumber bool, disableUnknown bool) error {
 	if val == nil {
 		return errs.ErrInputNil()
@@ -486,6 +554,9 @@ func (c *Context) BindJSONOpt(val any, useNumber bool, disableUnknown bool) erro
 	if c.Request.Body == nil {
 		return errs.ErrBodyNil()
 	}
+	if c.bodyRead {
+		c.resetBody()
+	}
 	decoder := json.NewDecoder(c.Request.Body)
 	if useNumber {
 		decoder.UseNumber()
@@ -711,6 +782,44 @@ func (c *Context) MustGet(key string) any {
 	panic("Key \"" + key + "\" does not exist")
 }
 
+// CtxGet retrieves the value stored under key in the context as a T. It replaces the
+// type-specific accessors such as GetString for values of any type, including the types that
+// middleware store for later handlers.
+//
+// Example:
+//
+//	user, ok := mist.CtxGet[*User](ctx, "user")
+//
+// Parameters:
+//   - ctx: The request context.
+//   - key: The key under which the value is stored.
+//
+// Returns:
+//   - T: The stored value, or the zero value of T if the key does not exist or holds a
+//     value of another type.
+//   - bool: true if the key exists and holds a T.
+func CtxGet[T any](ctx *Context, key string) (T, bool) {
+	val, ok := ctx.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	res, ok := val.(T)
+	return res, ok
+}
+
+// MustCtxGet retrieves the value stored under key in the context as a T. It panics if the key
+// does not exist or holds a value of another type, which makes it suitable for values that a
+// middleware of the route is guaranteed to have stored.
+func MustCtxGet[T any](ctx *Context, key string) T {
+	val := ctx.MustGet(key)
+	res, ok := val.(T)
+	if !ok {
+		panic(fmt.Sprintf("Key \"%s\" holds %T, not %T", key, val, res))
+	}
+	return res
+}
+
 // GetString retrieves a string value associated with the given key from the context.
 // Parameters:
 // - key: The key to retrieve the value for (string).
@@ -866,3 +975,29 @@ func (c *Context) GetStringMapStringSlice(key string) (smss map[string][]string)
 	}
 	return
 }
+
+// RoutePattern returns the pattern of the route that matched the request, such as
+// "/users/:id", for routes registered on the server or on groups alike. Metrics, traces and
+// logs should be labelled with it rather than with the raw path, whose values are unbounded.
+//
+// Returns:
+//   - string: The route pattern, or an empty string if no route matched the request.
+func (c *Context) RoutePattern() string {
+	return c.MatchedRoute
+}
+
+// HandlerName returns the name of the handler function of the matched route, such as
+// "github.com/acme/shop/orders.(*Handler).List-fm", to identify the code serving a route in
+// logs and traces.
+//
+// Returns:
+//   - string: The handler name, or an empty string if no route matched the request.
+func (c *Context) HandlerName() string {
+	if c.handler == nil {
+		return ""
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(c.handler).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return ""
+}
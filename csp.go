@@ -0,0 +1,75 @@
+package mist
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"strings"
+)
+
+// cspNoncePlaceholder is what the cspNonce template function writes, replaced with the nonce of
+// the request by Context.Render. It is random per process so that content rendered from user
+// input cannot forge it and be granted the nonce.
+var cspNoncePlaceholder = func() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "mistcspnonce" + hex.EncodeToString(b)
+}()
+
+// TemplateFuncs returns the template functions provided by the framework, registered by the
+// loading methods of GoTemplateEngine; templates parsed otherwise register them with
+// template.New(name).Funcs(mist.TemplateFuncs()). They are:
+//   - cspNonce: The Content-Security-Policy nonce of the request, see Context.CSPNonce, e.g.
+//     <script nonce="{{cspNonce}}">. It is filled in by Context.Render.
+//
+// Returns:
+//   - template.FuncMap: The template functions.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string { return cspNoncePlaceholder },
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request, generated on first use:
+// 128 random bits, base64 encoded. Inline scripts and styles carrying it in their nonce
+// attribute are allowed by policies granting the source 'nonce-<value>', which the csp and
+// https middleware write for the source 'nonce'.
+//
+// Returns:
+//   - string: The nonce.
+func (c *Context) CSPNonce() string {
+	if c.cspNonce == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		c.cspNonce = base64.StdEncoding.EncodeToString(b)
+	}
+	return c.cspNonce
+}
+
+// fillCSPNonce replaces the placeholders written by the cspNonce template function with the
+// nonce of the request.
+func (c *Context) fillCSPNonce(data []byte) []byte {
+	placeholder := []byte(cspNoncePlaceholder)
+	if !bytes.Contains(data, placeholder) {
+		return data
+	}
+	return bytes.ReplaceAll(data, placeholder, []byte(c.CSPNonce()))
+}
+
+// ExpandCSPNonce returns a Content-Security-Policy with the source 'nonce' replaced by the
+// nonce of the request, 'nonce-<value>'. Policies without the source are returned unchanged,
+// without generating a nonce.
+//
+// Parameters:
+//   - policy: The policy, e.g. "script-src 'self' 'nonce'".
+//
+// Returns:
+//   - string: The policy of the request.
+func (c *Context) ExpandCSPNonce(policy string) string {
+	if !strings.Contains(policy, "'nonce'") {
+		return policy
+	}
+	return strings.ReplaceAll(policy, "'nonce'", "'nonce-"+c.CSPNonce()+"'")
+}
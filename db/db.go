@@ -0,0 +1,127 @@
+// Package db runs each request in a database transaction. The middleware begins a transaction
+// before the handler, stores it on the context, and commits it when the handler succeeds or
+// rolls it back when it fails or panics, so that handlers never leave partial writes behind:
+//
+//	server.Use(db.InitMiddlewareBuilder(db.SQL(sqlDB, nil)).SetMutatingOnly(true).Build())
+//	...
+//	server.POST("/orders", func(ctx *mist.Context) {
+//	    tx, _ := db.From[*sql.Tx](ctx)
+//	    _, err := tx.ExecContext(ctx.Request.Context(), "INSERT INTO orders ...")
+//	    ...
+//	})
+//
+// Drivers other than database/sql plug in through BeginFunc. A pgx pool is adapted with
+//
+//	db.BeginFunc(func(ctx context.Context) (db.Tx, error) { return pool.Begin(ctx) })
+//
+// and handlers get the pgx.Tx with db.From[pgx.Tx](ctx). GORM is adapted by wrapping the
+// *gorm.DB returned by Begin in a type whose Commit and Rollback call those of GORM and whose
+// Unwrap returns it, so that handlers get it with db.From[*gorm.DB](ctx).
+package db
+
+import (
+	"context"
+	"database/sql"
+	"github.com/dormoron/mist"
+)
+
+// contextKey is the key of the transaction in the context of a request.
+const contextKey = "mist.db.tx"
+
+// Tx is a transaction.
+type Tx interface {
+	// Commit commits the transaction.
+	Commit(ctx context.Context) error
+	// Rollback aborts the transaction.
+	Rollback(ctx context.Context) error
+}
+
+// Beginner begins transactions.
+type Beginner interface {
+	// Begin begins a transaction.
+	Begin(ctx context.Context) (Tx, error)
+}
+
+// BeginFunc adapts a function into a Beginner.
+type BeginFunc func(ctx context.Context) (Tx, error)
+
+// Begin calls f.
+func (f BeginFunc) Begin(ctx context.Context) (Tx, error) {
+	return f(ctx)
+}
+
+// SQL adapts a database/sql database into a Beginner. Handlers get the *sql.Tx with
+// From[*sql.Tx].
+//
+// Parameters:
+//   - database: The database.
+//   - opts: The options of the transactions, e.g. their isolation level; nil for the defaults
+//     of the driver.
+//
+// Returns:
+//   - Beginner: The adapter.
+func SQL(database *sql.DB, opts *sql.TxOptions) Beginner {
+	return BeginFunc(func(ctx context.Context) (Tx, error) {
+		tx, err := database.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return sqlTx{tx: tx}, nil
+	})
+}
+
+// sqlTx adapts a *sql.Tx into a Tx.
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+// Commit commits the transaction.
+func (t sqlTx) Commit(context.Context) error {
+	return t.tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (t sqlTx) Rollback(context.Context) error {
+	return t.tx.Rollback()
+}
+
+// Unwrap returns the *sql.Tx.
+func (t sqlTx) Unwrap() any {
+	return t.tx
+}
+
+// From returns the transaction of a request as the type of its driver, e.g. *sql.Tx or
+// pgx.Tx. Adapters expose the transaction of their driver with an Unwrap() any method.
+//
+// Returns:
+//   - T: The transaction.
+//   - bool: false if the request has no transaction, or one of another type.
+func From[T any](ctx *mist.Context) (T, bool) {
+	var zero T
+	tx, ok := Current(ctx)
+	if !ok {
+		return zero, false
+	}
+	if t, ok := tx.(T); ok {
+		return t, true
+	}
+	if u, ok := tx.(interface{ Unwrap() any }); ok {
+		t, ok := u.Unwrap().(T)
+		return t, ok
+	}
+	return zero, false
+}
+
+// Current returns the transaction of a request.
+//
+// Returns:
+//   - Tx: The transaction.
+//   - bool: false if the middleware did not begin one for the request.
+func Current(ctx *mist.Context) (Tx, bool) {
+	val, ok := ctx.Get(contextKey)
+	if !ok {
+		return nil, false
+	}
+	tx, ok := val.(Tx)
+	return tx, ok
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"net/http"
+)
+
+// MiddlewareBuilder builds the middleware running requests in transactions.
+type MiddlewareBuilder struct {
+	beginner     Beginner
+	mutatingOnly bool
+	failed       func(ctx *mist.Context) bool
+}
+
+// InitMiddlewareBuilder creates a builder beginning a transaction for every request. The
+// transaction is rolled back when the handler panics, responds with a status of 400 or more,
+// or passes an error to Context.RespondError; it is committed otherwise.
+//
+// Parameters:
+//   - beginner: The database, e.g. SQL(sqlDB, nil).
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(beginner Beginner) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		beginner: beginner,
+		failed: func(ctx *mist.Context) bool {
+			return ctx.RespStatusCode >= http.StatusBadRequest || ctx.RespondedError() != nil
+		},
+	}
+}
+
+// SetMutatingOnly sets whether transactions are only begun for the methods that change state,
+// all but GET, HEAD, OPTIONS and TRACE; handlers of the other methods then use the database
+// directly.
+func (b *MiddlewareBuilder) SetMutatingOnly(mutatingOnly bool) *MiddlewareBuilder {
+	b.mutatingOnly = mutatingOnly
+	return b
+}
+
+// SetFailedFunc sets the function deciding from the response whether the handler failed and
+// its transaction is to be rolled back.
+func (b *MiddlewareBuilder) SetFailedFunc(fn func(ctx *mist.Context) bool) *MiddlewareBuilder {
+	b.failed = fn
+	return b
+}
+
+// Build creates the middleware. A failure to begin the transaction is answered with
+// RespondError without calling the handler; a failure to commit it is answered the same way,
+// replacing the response of the handler unless it was already sent.
+//
+// Returns:
+//   - mist.Middleware: The transaction middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			if b.mutatingOnly && !mutating(ctx.Request.Method) {
+				next(ctx)
+				return
+			}
+			tx, err := b.beginner.Begin(ctx.Request.Context())
+			if err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+			ctx.Set(contextKey, tx)
+			done := false
+			defer func() {
+				if !done {
+					// The handler panicked; the client may be gone, so the rollback does not
+					// depend on the request context.
+					_ = tx.Rollback(context.WithoutCancel(ctx.Request.Context()))
+				}
+			}()
+			next(ctx)
+			done = true
+			if b.failed(ctx) {
+				_ = tx.Rollback(context.WithoutCancel(ctx.Request.Context()))
+				return
+			}
+			if err = tx.Commit(ctx.Request.Context()); err != nil {
+				_ = ctx.RespondError(err)
+			}
+		}
+	}
+}
+
+// mutating reports whether a method may change state.
+func mutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
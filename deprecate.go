@@ -0,0 +1,119 @@
+package mist
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DeprecatedRoute is a route marked deprecated with DeprecateRoute.
+//
+// Fields:
+//   - Method: The HTTP method of the route.
+//   - Route: The route pattern, as registered.
+//   - Deprecation: The deprecation details announced to clients.
+type DeprecatedRoute struct {
+	Method string
+	Route  string
+	Deprecation
+}
+
+// DeprecationObserver is notified of every request served by a deprecated route, e.g. to log
+// the caller or count usage ahead of the removal. The deprecation package provides a standard
+// implementation.
+type DeprecationObserver func(ctx *Context, route DeprecatedRoute)
+
+// ServerWithDeprecationObserver is a configuration function that returns an HTTPServerOption.
+// It adds observers notified of every request to a route marked with DeprecateRoute.
+//
+// Parameters:
+//   - observers: The observers, called in order before the route's handler.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified observers.
+func ServerWithDeprecationObserver(observers ...DeprecationObserver) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.deprecations.observers = append(server.deprecations.observers, observers...)
+	}
+}
+
+// routeDeprecations holds the deprecated routes of a server. Reads are lock-free; writes copy
+// the map.
+type routeDeprecations struct {
+	mutex     sync.Mutex
+	routes    atomic.Pointer[map[string]DeprecatedRoute]
+	observers []DeprecationObserver
+}
+
+// lookup returns the deprecation of the route registered as method and route.
+func (d *routeDeprecations) lookup(method string, route string) (DeprecatedRoute, bool) {
+	routes := d.routes.Load()
+	if routes == nil {
+		return DeprecatedRoute{}, false
+	}
+	dr, ok := (*routes)[method+" "+route]
+	return dr, ok
+}
+
+// serve emits the deprecation headers of a deprecated route and notifies the observers.
+func (d *routeDeprecations) serve(ctx *Context, dr DeprecatedRoute) {
+	dr.apply(ctx.ResponseWriter.Header())
+	if dr.Replacement != "" && (strings.HasPrefix(dr.Replacement, "/") || strings.Contains(dr.Replacement, "://")) {
+		ctx.ResponseWriter.Header().Add("Link", "<"+dr.Replacement+`>; rel="successor-version"`)
+	}
+	for _, observe := range d.observers {
+		observe(ctx, dr)
+	}
+}
+
+// DeprecateRoute marks a registered route as deprecated. Responses of the route then carry the
+// Deprecation, Sunset and Link headers, and the observers configured with
+// ServerWithDeprecationObserver are notified of each request. Marking a route again replaces
+// its deprecation.
+//
+// Example:
+//
+//	server.DeprecateRoute(http.MethodGet, "/users/:id/profile", mist.Deprecation{
+//	    Sunset:      time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+//	    Replacement: "/profiles/:id",
+//	    Link:        "https://docs.example.com/migrations/profiles",
+//	})
+//
+// Parameters:
+//   - method: The HTTP method of the route.
+//   - route: The route pattern, exactly as registered.
+//   - d: The deprecation details.
+func (s *HTTPServer) DeprecateRoute(method string, route string, d Deprecation) {
+	s.deprecations.mutex.Lock()
+	defer s.deprecations.mutex.Unlock()
+	routes := make(map[string]DeprecatedRoute)
+	if cur := s.deprecations.routes.Load(); cur != nil {
+		for k, v := range *cur {
+			routes[k] = v
+		}
+	}
+	method = strings.ToUpper(method)
+	routes[method+" "+route] = DeprecatedRoute{Method: method, Route: route, Deprecation: d}
+	s.deprecations.routes.Store(&routes)
+}
+
+// DeprecatedRoutes returns the routes marked with DeprecateRoute, ordered by route and method,
+// for example to publish a removal schedule.
+func (s *HTTPServer) DeprecatedRoutes() []DeprecatedRoute {
+	cur := s.deprecations.routes.Load()
+	if cur == nil {
+		return nil
+	}
+	res := make([]DeprecatedRoute, 0, len(*cur))
+	for _, dr := range *cur {
+		res = append(res, dr)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Route != res[j].Route {
+			return res[i].Route < res[j].Route
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
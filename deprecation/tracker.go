@@ -0,0 +1,98 @@
+// Package deprecation tracks the usage of deprecated mist routes so that their removal can be
+// planned: who still calls them, and how often.
+//
+// Routes are marked with HTTPServer.DeprecateRoute; a Tracker observes their requests:
+//
+//	tracker := deprecation.InitTracker().SetMetrics("shop", "api")
+//	server := mist.InitHTTPServer(mist.ServerWithDeprecationObserver(tracker.Observe))
+//	server.GET("/v1/orders", listOrders)
+//	server.DeprecateRoute(http.MethodGet, "/v1/orders", mist.Deprecation{Replacement: "/v2/orders"})
+package deprecation
+
+import (
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/security"
+	"github.com/prometheus/client_golang/prometheus"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Tracker logs and counts requests to deprecated routes. Its Observe method is a
+// mist.DeprecationObserver.
+type Tracker struct {
+	logFunc    func(msg string)
+	callerFunc func(ctx *mist.Context) string
+	requests   *prometheus.CounterVec
+}
+
+// InitTracker creates a Tracker that logs every request to a deprecated route with the
+// standard logger and identifies callers with DefaultCaller. Metrics are disabled until
+// SetMetrics is called.
+func InitTracker() *Tracker {
+	return &Tracker{
+		logFunc: func(msg string) {
+			log.Println(msg)
+		},
+		callerFunc: DefaultCaller,
+	}
+}
+
+// SetLogFunc sets the function receiving usage log lines. A nil function disables logging.
+func (t *Tracker) SetLogFunc(fn func(msg string)) *Tracker {
+	t.logFunc = fn
+	return t
+}
+
+// SetCallerFunc sets the function identifying the caller of a request in logs, e.g. from an
+// API key or a client certificate.
+func (t *Tracker) SetCallerFunc(fn func(ctx *mist.Context) string) *Tracker {
+	t.callerFunc = fn
+	return t
+}
+
+// SetMetrics counts requests to deprecated routes in a Prometheus counter named
+// "<namespace>_<subsystem>_deprecated_requests_total" with the labels method and route, and
+// registers it with the default registry. Callers are not a label, to keep the cardinality
+// bounded; they are available in the logs. It panics if the counter is already registered.
+func (t *Tracker) SetMetrics(namespace string, subsystem string) *Tracker {
+	t.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "deprecated_requests_total",
+		Help:      "Number of requests served by deprecated routes.",
+	}, []string{"method", "route"})
+	prometheus.MustRegister(t.requests)
+	return t
+}
+
+// Observe records a request to a deprecated route. It is meant to be passed to
+// mist.ServerWithDeprecationObserver.
+func (t *Tracker) Observe(ctx *mist.Context, route mist.DeprecatedRoute) {
+	if t.requests != nil {
+		t.requests.WithLabelValues(route.Method, route.Route).Inc()
+	}
+	if t.logFunc == nil {
+		return
+	}
+	msg := fmt.Sprintf("deprecated route %s %s called by %s", route.Method, route.Route, t.callerFunc(ctx))
+	if route.Replacement != "" {
+		msg += ", replacement: " + route.Replacement
+	}
+	if !route.Sunset.IsZero() {
+		msg += ", sunset: " + route.Sunset.UTC().Format(time.DateOnly)
+	}
+	t.logFunc(msg)
+}
+
+// DefaultCaller identifies the caller by the user ID of the security session when the request
+// is authenticated, and by client IP and User-Agent otherwise.
+func DefaultCaller(ctx *mist.Context) string {
+	if val, ok := ctx.Get(security.CtxSessionKey); ok {
+		if sess, ok := val.(security.Session); ok {
+			return "user " + strconv.FormatInt(sess.Claims().UserID, 10)
+		}
+	}
+	return fmt.Sprintf("%s (%q)", ctx.ClientIP(), ctx.Request.UserAgent())
+}
@@ -0,0 +1,135 @@
+package mist
+
+import (
+	"context"
+	"maps"
+	"net/http"
+)
+
+// valuesContext is a context.Context that exposes a snapshot of a request's Keys and the
+// values of the request's standard context (trace spans, baggage, ...) on top of a parent
+// context. Cancellation and deadlines come from the parent only, so it can outlive the request.
+type valuesContext struct {
+	context.Context
+	keys   map[string]any
+	values context.Context
+}
+
+// Value looks up key in the Keys snapshot first, then in the parent context and finally in
+// the original request context.
+func (v *valuesContext) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if val, exists := v.keys[k]; exists {
+			return val
+		}
+	}
+	if val := v.Context.Value(key); val != nil {
+		return val
+	}
+	if v.values != nil {
+		return v.values.Value(key)
+	}
+	return nil
+}
+
+// CopyToContext returns a standard context derived from parent that carries the request's
+// values: a snapshot of Keys (which holds the auth principal, session, request ID and other
+// values stored by middleware) and every value of the request's own context, such as the
+// active trace span. Use it when passing request-scoped data to database calls, clients or
+// goroutines that take a context.Context.
+//
+// Cancellation and deadlines are inherited from parent only; pass c.Request.Context() as the
+// parent to keep the request's cancellation, or context.Background() for work that must
+// outlive the request.
+//
+// Parameters:
+//   - parent: The context providing cancellation and deadlines.
+//
+// Returns:
+//   - context.Context: A context exposing the request's values.
+func (c *Context) CopyToContext(parent context.Context) context.Context {
+	if parent == nil {
+		parent = context.Background()
+	}
+	c.mutex.RLock()
+	keys := maps.Clone(c.Keys)
+	c.mutex.RUnlock()
+	var values context.Context
+	if c.Request != nil {
+		values = c.Request.Context()
+	}
+	return &valuesContext{Context: parent, keys: keys, values: values}
+}
+
+// Detach returns a copy of the Context that is safe to use after the request has ended, for
+// example from a goroutine performing asynchronous work. The copy:
+//   - carries copies of Keys, UserValues, PathParams and the matched route,
+//   - shares the settings of the server, such as the body parsers of Bind, the flash store and
+//     the Server-Timing policy,
+//   - has a Request whose context keeps the original values but is never cancelled,
+//   - has no request body, since the original one is closed when the request ends,
+//   - writes to a private ResponseWriter that discards output, so late writes can never
+//     corrupt the client's response or a response of another request.
+//
+// Returns:
+//   - *Context: The detached copy.
+func (c *Context) Detach() *Context {
+	c.mutex.RLock()
+	keys := maps.Clone(c.Keys)
+	c.mutex.RUnlock()
+
+	// Keep in sync with HTTPServer.serve: every server-scoped field is copied, so that Bind,
+	// flashes, Server-Timing and the other features behave as in the request.
+	detached := &Context{
+		Keys:                keys,
+		PathParams:          maps.Clone(c.PathParams),
+		UserValues:          maps.Clone(c.UserValues),
+		MatchedRoute:        c.MatchedRoute,
+		handler:             c.handler,
+		routeMeta:           c.routeMeta,
+		frames:              c.frames,
+		templateEngine:      c.templateEngine,
+		catalog:             c.catalog,
+		tasks:               c.tasks,
+		flags:               c.flags,
+		timingPolicy:        c.timingPolicy,
+		bodyParsers:         c.bodyParsers,
+		bodyLimit:           c.bodyLimit,
+		marshalErrorHandler: c.marshalErrorHandler,
+		listener:            c.listener,
+		flashStore:          c.flashStore,
+		jsonLocalizer:       c.jsonLocalizer,
+		jobs:                c.jobs,
+		cspNonce:            c.cspNonce,
+		ResponseWriter:      &discardResponseWriter{header: http.Header{}},
+	}
+	if c.Request != nil {
+		req := c.Request.Clone(c.CopyToContext(context.Background()))
+		req.Body = http.NoBody
+		req.GetBody = nil
+		detached.Request = req
+	}
+	return detached
+}
+
+// discardResponseWriter is the ResponseWriter of detached contexts. It records headers and
+// the status code but drops the body.
+type discardResponseWriter struct {
+	header http.Header
+	status int
+}
+
+// Header returns the header map of the detached response.
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+// Write discards p and reports it as fully written.
+func (d *discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteHeader records the status code.
+func (d *discardResponseWriter) WriteHeader(statusCode int) {
+	d.status = statusCode
+}
@@ -0,0 +1,136 @@
+package mist
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// disabledRule switches off the routes matching a method and a route pattern.
+type disabledRule struct {
+	method  string
+	pattern string
+}
+
+// matches reports whether the rule covers the route registered as method and route.
+func (r disabledRule) matches(method string, route string) bool {
+	if r.method != "" && r.method != "*" && r.method != method {
+		return false
+	}
+	if r.pattern == route {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(r.pattern, "/*"); ok && strings.HasPrefix(route, prefix+"/") {
+		return true
+	}
+	ok, _ := path.Match(r.pattern, route)
+	return ok
+}
+
+// routeSwitch holds the disabled-route rules of a server. Reads are lock-free so that the check
+// costs nothing noticeable on the request path; writes copy the rule list.
+type routeSwitch struct {
+	mutex  sync.Mutex
+	rules  atomic.Pointer[[]disabledRule]
+	status int
+}
+
+// disabled reports whether the route registered as method and route is switched off.
+func (s *routeSwitch) disabled(method string, route string) bool {
+	rules := s.rules.Load()
+	if rules == nil {
+		return false
+	}
+	for _, r := range *rules {
+		if r.matches(method, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// update replaces the rule list with the result of fn applied to a copy of it.
+func (s *routeSwitch) update(fn func(rules []disabledRule) []disabledRule) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var rules []disabledRule
+	if cur := s.rules.Load(); cur != nil {
+		rules = append(rules, *cur...)
+	}
+	rules = fn(rules)
+	s.rules.Store(&rules)
+}
+
+// ServerWithDisabledRouteStatus is a configuration function that returns an HTTPServerOption.
+// It sets the status code returned by disabled routes, typically http.StatusNotFound (the
+// default) to hide the endpoint or http.StatusServiceUnavailable to signal a temporary outage.
+//
+// Parameters:
+//   - status: The HTTP status code returned by disabled routes.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified status.
+func ServerWithDisabledRouteStatus(status int) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.switches.status = status
+	}
+}
+
+// DisableRoute switches off the routes matching method and pattern at runtime, without a
+// redeploy, e.g. to kill a misbehaving endpoint during an incident. Requests to a disabled
+// route still pass through the middleware chain but never reach the handler, and receive the
+// status configured with ServerWithDisabledRouteStatus.
+//
+// Rules are evaluated against route patterns at request time, so a route can be registered
+// disabled by calling DisableRoute before or after registering it.
+//
+// Example:
+//
+//	server.DisableRoute(http.MethodPost, "/beta/*")    // every POST route below /beta
+//	server.DisableRoute("*", "/users/:id/export")      // one route, all methods
+//
+// Parameters:
+//   - method: The HTTP method, or "*" for every method.
+//   - pattern: A route pattern as registered ("/users/:id"), a pattern ending in "/*" covering
+//     every route below a prefix, or a path.Match glob over route patterns.
+func (s *HTTPServer) DisableRoute(method string, pattern string) {
+	rule := disabledRule{method: strings.ToUpper(method), pattern: pattern}
+	s.switches.update(func(rules []disabledRule) []disabledRule {
+		for _, r := range rules {
+			if r == rule {
+				return rules
+			}
+		}
+		return append(rules, rule)
+	})
+}
+
+// EnableRoute removes a rule added with DisableRoute. The method and pattern must be the same as
+// the ones used to disable the routes.
+func (s *HTTPServer) EnableRoute(method string, pattern string) {
+	rule := disabledRule{method: strings.ToUpper(method), pattern: pattern}
+	s.switches.update(func(rules []disabledRule) []disabledRule {
+		res := rules[:0]
+		for _, r := range rules {
+			if r != rule {
+				res = append(res, r)
+			}
+		}
+		return res
+	})
+}
+
+// RouteDisabled reports whether the route registered as method and route is currently disabled.
+func (s *HTTPServer) RouteDisabled(method string, route string) bool {
+	return s.switches.disabled(strings.ToUpper(method), route)
+}
+
+// disabledStatus returns the status code of disabled routes.
+func (s *routeSwitch) disabledStatus() int {
+	if s.status == 0 {
+		return http.StatusNotFound
+	}
+	return s.status
+}
@@ -0,0 +1,299 @@
+// Package dlock provides distributed locks backed by a single Redis instance, so that only one
+// node of a cluster performs a cluster-wide task such as a scheduled job or a session GC.
+//
+// A lock is a Redis key set with SET NX PX to a random token identifying its holder. It is
+// leased for a TTL and expires on its own if the holder dies; a live holder keeps it with
+// Refresh or KeepAlive. Refresh and Unlock check the token, so a holder whose lease expired
+// never releases or extends a lock taken over by another node.
+//
+//	locks := dlock.InitClient(rdb)
+//	err := locks.Do(ctx, "jobs:prune-reports", 30*time.Second, func(ctx context.Context) error {
+//	    return pruneReports(ctx)
+//	})
+//	if errors.Is(err, misterrors.ErrLockNotAcquired) {
+//	    // another node is pruning
+//	}
+package dlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	misterrors "github.com/dormoron/mist/errors"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// luaRefresh extends the lease of a lock if the token still matches.
+const luaRefresh = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+// luaUnlock deletes a lock if the token still matches.
+const luaUnlock = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// Client acquires locks on a Redis client.
+type Client struct {
+	client        redis.Cmdable
+	prefix        string
+	retryInterval time.Duration
+}
+
+// InitClient creates a Client. Lock keys are prefixed with "mist:lock:", and Lock retries
+// every 100ms.
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *Client: The initialized client.
+func InitClient(client redis.Cmdable) *Client {
+	return &Client{
+		client:        client,
+		prefix:        "mist:lock:",
+		retryInterval: 100 * time.Millisecond,
+	}
+}
+
+// SetKeyPrefix sets the prefix of the Redis keys of the locks.
+func (c *Client) SetKeyPrefix(prefix string) *Client {
+	c.prefix = prefix
+	return c
+}
+
+// SetRetryInterval sets how often Lock retries to acquire a held lock.
+func (c *Client) SetRetryInterval(d time.Duration) *Client {
+	c.retryInterval = d
+	return c
+}
+
+// TryLock acquires the lock of key for ttl, without waiting.
+//
+// Parameters:
+//   - ctx: The context of the Redis call.
+//   - key: The name of the lock.
+//   - ttl: The lease of the lock.
+//
+// Returns:
+//   - *Lock: The acquired lock.
+//   - error: An error wrapping errors.ErrLockNotAcquired if the lock is held, or the Redis
+//     error.
+func (c *Client) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token := uuid.NewString()
+	ok, err := c.client.SetNX(ctx, c.prefix+key, token, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errs.ErrLockNotAcquired(key)
+	}
+	return &Lock{
+		client:    c.client,
+		name:      key,
+		key:       c.prefix + key,
+		token:     token,
+		ttl:       ttl,
+		expiresAt: time.Now().Add(ttl),
+		lost:      make(chan struct{}),
+	}, nil
+}
+
+// Lock acquires the lock of key for ttl, waiting until it is released, expires, or ctx is
+// done.
+//
+// Returns:
+//   - *Lock: The acquired lock.
+//   - error: The error of ctx if it is done first, or the Redis error.
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(c.retryInterval)
+	defer ticker.Stop()
+	for {
+		l, err := c.TryLock(ctx, key, ttl)
+		if err == nil {
+			return l, nil
+		}
+		if !errors.Is(err, misterrors.ErrLockNotAcquired) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Do runs fn while holding the lock of key, if it is free. The lease is renewed every third
+// of ttl while fn runs; if it is lost, the context passed to fn is cancelled. The lock is
+// released when fn returns.
+//
+// Parameters:
+//   - ctx: The parent context of fn.
+//   - key: The name of the lock.
+//   - ttl: The lease of the lock; Do panics if it is too short to be renewed.
+//   - fn: The task.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrLockNotAcquired if another holder runs the task, the
+//     Redis error, or the error of fn.
+func (c *Client) Do(ctx context.Context, key string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	if ttl/3 <= 0 {
+		panic(fmt.Sprintf("dlock: %s: the ttl of Do is too short to be renewed, got %s", key, ttl))
+	}
+	l, err := c.TryLock(ctx, key, ttl)
+	if err != nil {
+		return err
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	l.KeepAlive(runCtx, ttl/3)
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	err = fn(runCtx)
+	// Release with a fresh context: runCtx may already be cancelled.
+	releaseCtx, release := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+	defer release()
+	_ = l.Unlock(releaseCtx)
+	return err
+}
+
+// Lock is an acquired lock.
+type Lock struct {
+	client redis.Cmdable
+	name   string
+	key    string
+	token  string
+	ttl    time.Duration
+
+	mutex     sync.Mutex
+	expiresAt time.Time
+	lost      chan struct{}
+	lostOnce  sync.Once
+	stop      context.CancelFunc
+}
+
+// Key returns the name of the lock.
+func (l *Lock) Key() string {
+	return l.name
+}
+
+// Refresh renews the lease of the lock for its TTL.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrLockNotHeld if the lock expired or was taken over, or
+//     the Redis error.
+func (l *Lock) Refresh(ctx context.Context) error {
+	start := time.Now()
+	n, err := l.client.Eval(ctx, luaRefresh, []string{l.key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		l.markLost()
+		return errs.ErrLockNotHeld(l.name)
+	}
+	l.mutex.Lock()
+	l.expiresAt = start.Add(l.ttl)
+	l.mutex.Unlock()
+	return nil
+}
+
+// KeepAlive renews the lease every interval in the background until the lock is released, ctx
+// is done, or the lock is lost; Lost reports the latter. Transient Redis errors are retried at
+// the next interval as long as more than an interval of the lease remains. Past that, the lock
+// is considered lost: the next renewal could only come after the lease expired and another
+// node took the lock over, so the holder is warned while it still has an interval to stop.
+//
+// Parameters:
+//   - ctx: The context bounding the renewals.
+//   - interval: The renewal interval, which must be positive and well below the TTL; it also
+//     bounds each renewal.
+func (l *Lock) KeepAlive(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("dlock: %s: the KeepAlive interval must be positive, got %s", l.name, interval))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	l.mutex.Lock()
+	if l.stop != nil {
+		l.stop()
+	}
+	l.stop = cancel
+	l.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.lost:
+				return
+			case <-ticker.C:
+				refreshCtx, cancelRefresh := context.WithTimeout(ctx, interval)
+				err := l.Refresh(refreshCtx)
+				cancelRefresh()
+				if err != nil && ctx.Err() == nil && time.Until(l.expiry()) < interval {
+					l.markLost()
+				}
+			}
+		}
+	}()
+}
+
+// Lost returns a channel closed when a renewal finds that the lock expired or was taken over.
+// The holder should then stop the task, as another node may be running it.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock stops the renewals and releases the lock.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrLockNotHeld if the lock expired or was taken over, or
+//     the Redis error.
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.mutex.Lock()
+	if l.stop != nil {
+		l.stop()
+		l.stop = nil
+	}
+	l.mutex.Unlock()
+
+	n, err := l.client.Eval(ctx, luaUnlock, []string{l.key}, l.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		l.markLost()
+		return errs.ErrLockNotHeld(l.name)
+	}
+	return nil
+}
+
+// expiry returns when the lease ends unless renewed.
+func (l *Lock) expiry() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.expiresAt
+}
+
+// markLost closes the Lost channel once.
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
@@ -0,0 +1,200 @@
+package dlock
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Elector elects one leader among the instances running an election of the same name, so that
+// scheduled tasks such as session GC or report pruning run on a single instance. Leadership
+// is a lock renewed by the leader; when the leader stops or dies, the lock expires and another
+// instance takes over within one TTL.
+type Elector struct {
+	client *Client
+	name   string
+	ttl    time.Duration
+
+	leading   atomic.Bool
+	termMutex sync.Mutex
+	term      context.Context
+	onElected func(ctx context.Context)
+	onRevoked func()
+
+	leaderGauge prometheus.Gauge
+	transitions prometheus.Counter
+}
+
+// InitElector creates an Elector for the election of the given name. The leader renews its
+// lease every third of ttl, and followers try to take over at the same pace.
+//
+// Example:
+//
+//	elector := dlock.InitElector(locks, "session-gc", 15*time.Second)
+//	go elector.Run(ctx)
+//	go elector.Every(ctx, time.Minute, func(ctx context.Context) {
+//	    store.GC(ctx)
+//	})
+//
+// Parameters:
+//   - client: The lock client.
+//   - name: The name of the election, shared by all instances.
+//   - ttl: The lease of the leadership.
+//
+// Returns:
+//   - *Elector: The initialized elector.
+func InitElector(client *Client, name string, ttl time.Duration) *Elector {
+	return &Elector{
+		client: client,
+		name:   "leader:" + name,
+		ttl:    ttl,
+	}
+}
+
+// OnElected sets a function called when the instance becomes the leader. Its context is
+// cancelled when the leadership is lost.
+func (e *Elector) OnElected(fn func(ctx context.Context)) *Elector {
+	e.onElected = fn
+	return e
+}
+
+// OnRevoked sets a function called when the instance stops being the leader.
+func (e *Elector) OnRevoked(fn func()) *Elector {
+	e.onRevoked = fn
+	return e
+}
+
+// SetMetrics exposes the leadership in a Prometheus gauge named
+// "<namespace>_<subsystem>_leader", 1 while the instance leads and 0 otherwise, and counts
+// leadership changes in "<namespace>_<subsystem>_leader_transitions_total". Both carry the
+// election name as the constant label "election" and are registered with the default
+// registry. It panics if they are already registered.
+func (e *Elector) SetMetrics(namespace string, subsystem string) *Elector {
+	labels := prometheus.Labels{"election": e.name}
+	e.leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "leader",
+		Help:        "Whether this instance is the leader of the election.",
+		ConstLabels: labels,
+	})
+	e.transitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "leader_transitions_total",
+		Help:        "Number of times this instance gained or lost the leadership.",
+		ConstLabels: labels,
+	})
+	prometheus.MustRegister(e.leaderGauge, e.transitions)
+	return e
+}
+
+// IsLeader reports whether the instance is currently the leader.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run takes part in the election until ctx is done, then resigns the leadership if held so
+// that another instance takes over immediately. Redis errors are retried at the next attempt.
+//
+// Returns:
+//   - error: The error of ctx.
+func (e *Elector) Run(ctx context.Context) error {
+	interval := e.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if l, err := e.client.TryLock(ctx, e.name, e.ttl); err == nil {
+			e.lead(ctx, l, interval)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Every calls fn every interval until ctx is done, on the leader only; followers skip their
+// ticks. It is a convenience for scheduled tasks guarded by the election. The context of fn is
+// cancelled when ctx is done or the leadership is lost, so that a run in progress stops before
+// another instance takes over.
+func (e *Elector) Every(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if term := e.currentTerm(); term != nil {
+				e.runInTerm(ctx, term, fn)
+			}
+		}
+	}
+}
+
+// runInTerm calls fn with a context cancelled when ctx is done or the term ends.
+func (e *Elector) runInTerm(ctx context.Context, term context.Context, fn func(ctx context.Context)) {
+	runCtx, cancel := context.WithCancel(term)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+	fn(runCtx)
+}
+
+// currentTerm returns the context of the current leadership, nil when the instance does not
+// lead.
+func (e *Elector) currentTerm() context.Context {
+	e.termMutex.Lock()
+	defer e.termMutex.Unlock()
+	return e.term
+}
+
+// setTerm sets the context of the current leadership.
+func (e *Elector) setTerm(term context.Context) {
+	e.termMutex.Lock()
+	defer e.termMutex.Unlock()
+	e.term = term
+}
+
+// lead holds the leadership until it is lost or ctx is done.
+func (e *Elector) lead(ctx context.Context, l *Lock, interval time.Duration) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	l.KeepAlive(leaderCtx, interval)
+	e.setTerm(leaderCtx)
+	e.transition(true)
+	if e.onElected != nil {
+		go e.onElected(leaderCtx)
+	}
+
+	select {
+	case <-l.Lost():
+	case <-ctx.Done():
+	}
+	e.setTerm(nil)
+	cancel()
+	e.transition(false)
+	if e.onRevoked != nil {
+		e.onRevoked()
+	}
+	releaseCtx, release := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+	defer release()
+	_ = l.Unlock(releaseCtx)
+}
+
+// transition records a change of leadership.
+func (e *Elector) transition(leading bool) {
+	e.leading.Store(leading)
+	if e.leaderGauge == nil {
+		return
+	}
+	e.transitions.Inc()
+	if leading {
+		e.leaderGauge.Set(1)
+	} else {
+		e.leaderGauge.Set(0)
+	}
+}
@@ -0,0 +1,181 @@
+// Package errcode defines the catalog of stable, machine-readable error codes emitted by mist
+// in problem-details responses, together with their HTTP status and localizable messages.
+package errcode
+
+import (
+	"github.com/dormoron/mist/i18n"
+	"net/http"
+	"sync"
+)
+
+// Codes emitted by the framework itself. Applications may register their own codes; using a
+// dotted "<area>.<reason>" naming scheme keeps them consistent with the built-in ones.
+const (
+	CodeInternal        = "internal"
+	CodeMalformedBody   = "request.malformed_body"
+	CodeEmptyBody       = "request.empty_body"
+	CodeBodyTooLarge    = "request.body_too_large"
+	CodeValidation      = "validation.failed"
+	CodeRequired        = "validation.required"
+	CodeMin             = "validation.min"
+	CodeMax             = "validation.max"
+	CodeLen             = "validation.len"
+	CodeEmail           = "validation.email"
+	CodeURL             = "validation.url"
+	CodeOneOf           = "validation.oneof"
+	CodeNotFound        = "route.not_found"
+	CodeUnsupportedType = "request.unsupported_media_type"
+	CodeNotAcceptable   = "request.not_acceptable"
+	CodeHeaderMissing   = "request.header_missing"
+	CodeHeadersTooLarge = "request.headers_too_large"
+	CodeTenantMissing   = "tenant.missing"
+	CodeTenantUnknown   = "tenant.unknown"
+	CodeInvalidParam    = "request.invalid_parameter"
+	CodeNotImplemented  = "not_implemented"
+)
+
+// Entry describes a single error code.
+//
+// Fields:
+//   - Code: The stable machine-readable identifier clients can branch on.
+//   - Status: The HTTP status code used when the error is the primary cause of a response.
+//   - Message: The default (English) message template, with "{name}" placeholders.
+type Entry struct {
+	Code    string
+	Status  int
+	Message string
+}
+
+// Translator localizes message templates. *i18n.Bundle satisfies this interface; the catalog
+// uses the error code as the message key.
+type Translator interface {
+	Translate(locale string, key string, params map[string]any) (string, bool)
+}
+
+// Catalog is a registry of error codes. It is safe for concurrent use.
+type Catalog struct {
+	mutex      sync.RWMutex
+	entries    map[string]Entry
+	translator Translator
+}
+
+// CatalogOption configures a Catalog.
+type CatalogOption func(c *Catalog)
+
+// WithTranslator sets the Translator used to localize messages.
+func WithTranslator(t Translator) CatalogOption {
+	return func(c *Catalog) {
+		c.translator = t
+	}
+}
+
+// InitCatalog creates a Catalog preloaded with the framework's built-in codes.
+func InitCatalog(opts ...CatalogOption) *Catalog {
+	c := &Catalog{entries: make(map[string]Entry, len(builtin))}
+	c.Register(builtin...)
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var builtin = []Entry{
+	{Code: CodeInternal, Status: http.StatusInternalServerError, Message: "internal server error"},
+	{Code: CodeMalformedBody, Status: http.StatusBadRequest, Message: "the request body could not be parsed"},
+	{Code: CodeEmptyBody, Status: http.StatusBadRequest, Message: "the request body is empty"},
+	{Code: CodeBodyTooLarge, Status: http.StatusRequestEntityTooLarge, Message: "the request body exceeds {limit} bytes"},
+	{Code: CodeValidation, Status: http.StatusUnprocessableEntity, Message: "the request failed validation"},
+	{Code: CodeRequired, Status: http.StatusUnprocessableEntity, Message: "{field} is required"},
+	{Code: CodeMin, Status: http.StatusUnprocessableEntity, Message: "{field} must be at least {param}"},
+	{Code: CodeMax, Status: http.StatusUnprocessableEntity, Message: "{field} must be at most {param}"},
+	{Code: CodeLen, Status: http.StatusUnprocessableEntity, Message: "{field} must have length {param}"},
+	{Code: CodeEmail, Status: http.StatusUnprocessableEntity, Message: "{field} must be a valid email address"},
+	{Code: CodeURL, Status: http.StatusUnprocessableEntity, Message: "{field} must be a valid URL"},
+	{Code: CodeOneOf, Status: http.StatusUnprocessableEntity, Message: "{field} must be one of [{param}]"},
+	{Code: CodeNotFound, Status: http.StatusNotFound, Message: "the requested resource was not found"},
+	{Code: CodeUnsupportedType, Status: http.StatusUnsupportedMediaType, Message: "the request content type is not supported"},
+	{Code: CodeNotAcceptable, Status: http.StatusNotAcceptable, Message: "none of the accepted media types can be produced"},
+	{Code: CodeHeaderMissing, Status: http.StatusBadRequest, Message: "header {header} is required"},
+	{Code: CodeHeadersTooLarge, Status: http.StatusRequestHeaderFieldsTooLarge, Message: "the request headers exceed {limit} bytes"},
+	{Code: CodeTenantMissing, Status: http.StatusBadRequest, Message: "the request does not identify a tenant"},
+	{Code: CodeTenantUnknown, Status: http.StatusNotFound, Message: "tenant {tenant} does not exist"},
+	{Code: CodeInvalidParam, Status: http.StatusBadRequest, Message: "parameter {param} is invalid"},
+	{Code: CodeNotImplemented, Status: http.StatusNotImplemented, Message: "the operation is not implemented"},
+}
+
+// Register adds or replaces entries in the catalog.
+func (c *Catalog) Register(entries ...Entry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, e := range entries {
+		c.entries[e.Code] = e
+	}
+}
+
+// SetTranslator replaces the Translator used to localize messages.
+func (c *Catalog) SetTranslator(t Translator) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.translator = t
+}
+
+// Lookup returns the entry registered for code.
+func (c *Catalog) Lookup(code string) (Entry, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	e, ok := c.entries[code]
+	return e, ok
+}
+
+// Status returns the HTTP status registered for code, or 500 for unknown codes.
+func (c *Catalog) Status(code string) int {
+	if e, ok := c.Lookup(code); ok && e.Status > 0 {
+		return e.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// Message renders the message for code in the requested locale. The translator is consulted
+// first; when it has no translation the default template of the entry is used, and unknown
+// codes render as the code itself.
+//
+// Parameters:
+//   - locale: The locale of the message, typically negotiated from Accept-Language.
+//   - code: The error code.
+//   - params: Values substituted for "{name}" placeholders.
+//
+// Returns:
+//   - string: The rendered, user-safe message.
+func (c *Catalog) Message(locale string, code string, params map[string]any) string {
+	c.mutex.RLock()
+	e, ok := c.entries[code]
+	t := c.translator
+	c.mutex.RUnlock()
+	if t != nil {
+		if msg, found := t.Translate(locale, code, params); found {
+			return msg
+		}
+	}
+	if !ok {
+		return code
+	}
+	return i18n.Format(e.Message, params)
+}
+
+// Locales reports the locales the catalog can translate to, when its translator exposes them.
+func (c *Catalog) Locales() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if l, ok := c.translator.(interface{ Locales() []string }); ok {
+		return l.Locales()
+	}
+	return nil
+}
+
+var defaultCatalog = InitCatalog()
+
+// DefaultCatalog returns the process-wide catalog used when a server has not been configured
+// with its own.
+func DefaultCatalog() *Catalog {
+	return defaultCatalog
+}
@@ -0,0 +1,43 @@
+package errcode
+
+import "errors"
+
+// Error is an error carrying a catalog code. Handlers and framework helpers return it so that
+// the problem-details responder can emit the code and a localized message consistently.
+//
+// Fields:
+//   - Code: The catalog code describing the error.
+//   - Params: Values substituted into the localized message.
+//   - Err: The underlying cause, if any. It is never exposed to clients.
+type Error struct {
+	Code   string
+	Params map[string]any
+	Err    error
+}
+
+// New creates an Error with the given code wrapping cause.
+func New(code string, cause error) *Error {
+	return &Error{Code: code, Err: cause}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Err.Error()
+	}
+	return e.Code
+}
+
+// Unwrap returns the underlying cause so errors.Is and errors.As see through the code.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// CodeOf returns the catalog code carried by err, or "" when err carries none.
+func CodeOf(err error) string {
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return ""
+}
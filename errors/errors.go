@@ -0,0 +1,312 @@
+// Package errors exposes the errors returned by mist as sentinel values so that callers can
+// branch on them with errors.Is and errors.As instead of matching strings, together with the
+// HTTP status and the user-safe message that each error maps to.
+//
+// Errors returned by the framework wrap one of the sentinels below:
+//
+//	if errors.Is(err, misterrors.ErrSessionNotFound) {
+//	    // ask the user to sign in again
+//	}
+//
+//	var typeErr *misterrors.InvalidTypeError
+//	if errors.As(err, &typeErr) {
+//	    log.Printf("expected %s", typeErr.Want)
+//	}
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// Sentinel errors of the framework. Their text is kept stable for log compatibility; match
+// them with errors.Is rather than by message.
+var (
+	// ErrInvalidType is wrapped by conversions that meet a value of an unexpected type.
+	ErrInvalidType = stderrors.New("base: type conversion failed, expected type")
+
+	// ErrKeyNotFound is wrapped when a session holds no value for a key.
+	ErrKeyNotFound = stderrors.New("session: key not found")
+	// ErrSessionNotFound is wrapped when a request carries no session.
+	ErrSessionNotFound = stderrors.New("session: session not found")
+	// ErrIDSessionNotFound is wrapped when no session exists for a session ID.
+	ErrIDSessionNotFound = stderrors.New("session: session corresponding to id does not exist")
+	// ErrSessionRotationUnsupported is returned when the ID of a session is rotated in a store
+	// unable to move the data of a session.
+	ErrSessionRotationUnsupported = stderrors.New("session: store does not support ID rotation")
+	// ErrSessionIDTaken is wrapped when a session is rotated to an ID already in use.
+	ErrSessionIDTaken = stderrors.New("session: session ID already in use")
+	// ErrVerificationFailed is wrapped when a session token fails verification.
+	ErrVerificationFailed = stderrors.New("session: verification failed")
+	// ErrEmptyRefreshOpts is returned when refresh token options are missing.
+	ErrEmptyRefreshOpts = stderrors.New("refreshJWTOptions are nil")
+
+	// ErrInputNil is returned when a nil destination is passed to a binder.
+	ErrInputNil = stderrors.New("web: input cannot be nil")
+	// ErrBodyNil is wrapped when a request has no body to bind.
+	ErrBodyNil = stderrors.New("web: body is nil")
+	// ErrKeyNil is wrapped when a form, query or path value does not exist.
+	ErrKeyNil = stderrors.New("web: key does not exist")
+
+	// ErrInvalidRoute is wrapped by every *RouteError, i.e. every error reporting a malformed
+	// or clashing route registration.
+	ErrInvalidRoute = stderrors.New("web: invalid route")
+	// ErrRouteConflict is wrapped when the same route is registered twice.
+	ErrRouteConflict = &RouteError{Msg: "web: route conflict"}
+	// ErrRouteNameConflict is wrapped when two routes are registered under the same name.
+	ErrRouteNameConflict = &RouteError{Msg: "web: route name already registered"}
+	// ErrRouteNameNotFound is wrapped when no route is registered under a name.
+	ErrRouteNameNotFound = stderrors.New("web: route name not found")
+	// ErrRouteParamMissing is wrapped when a URL is built without a required parameter.
+	ErrRouteParamMissing = stderrors.New("web: missing route parameter")
+	// ErrInvalidFrameAncestor is wrapped when a route declares a malformed frame ancestor.
+	ErrInvalidFrameAncestor = &RouteError{Msg: "web: invalid frame ancestor"}
+
+	// ErrInvalidResource is wrapped when a serializer receives a value that is not a resource.
+	ErrInvalidResource = stderrors.New("serializer: value is not a struct resource")
+	// ErrResourceTypeMissing is wrapped when a resource has no type.
+	ErrResourceTypeMissing = stderrors.New("serializer: resource has no primary field with a type")
+
+	// ErrServerShuttingDown is returned when work is started on a server that is shutting down.
+	ErrServerShuttingDown = stderrors.New("web: server is shutting down")
+	// ErrNoListener is returned when a server is served without any listener declared.
+	ErrNoListener = stderrors.New("web: no listener declared")
+	// ErrNoFlashStore is returned when a flash message is added on a server without a store.
+	ErrNoFlashStore = stderrors.New("web: no flash store configured")
+	// ErrResponseCommitted is wrapped when the connection of a request is hijacked after its
+	// response was committed.
+	ErrResponseCommitted = stderrors.New("web: response already committed")
+	// ErrScanFailed is wrapped when a file scanner cannot tell whether a file is clean.
+	ErrScanFailed = stderrors.New("web: file scan failed")
+	// ErrStaticBackend is wrapped when the backend of a static resource handler fails.
+	ErrStaticBackend = stderrors.New("web: static backend failed")
+	// ErrStaticRedirectUnsupported is returned when a static resource handler redirecting to
+	// signed URLs is given a backend unable to sign them.
+	ErrStaticRedirectUnsupported = stderrors.New("web: static backend cannot sign URLs")
+	// ErrNoJobStore is returned when an asynchronous job is accepted on a server without a
+	// job store.
+	ErrNoJobStore = stderrors.New("web: no job store configured")
+	// ErrJobNotFound is wrapped when a job store has no job of the given identifier.
+	ErrJobNotFound = stderrors.New("web: job not found")
+
+	// ErrFlagNotFound is wrapped when a feature flag does not exist.
+	ErrFlagNotFound = stderrors.New("featureflags: flag not found")
+	// ErrFlagNameEmpty is returned when a feature flag is saved without a name.
+	ErrFlagNameEmpty = stderrors.New("featureflags: flag name cannot be empty")
+
+	// ErrInvalidBaggage is wrapped when a baggage member has an invalid key or exceeds the
+	// limits of the W3C Baggage header.
+	ErrInvalidBaggage = stderrors.New("web: invalid baggage member")
+
+	// ErrLockNotAcquired is wrapped when a distributed lock is held by someone else.
+	ErrLockNotAcquired = stderrors.New("dlock: lock not acquired")
+	// ErrLockNotHeld is wrapped when a distributed lock is renewed or released after it expired
+	// or was taken over.
+	ErrLockNotHeld = stderrors.New("dlock: lock not held")
+
+	// ErrFlowStateNotFound is wrapped when the transient state of a multi-step flow is
+	// missing, expired or was already used.
+	ErrFlowStateNotFound = stderrors.New("flowstate: state not found")
+
+	// ErrMailQueueFull is wrapped when a message is queued while the mail queue is full.
+	ErrMailQueueFull = stderrors.New("mailer: queue is full")
+	// ErrMailQueueClosed is returned when a message is queued after the mail queue was closed.
+	ErrMailQueueClosed = stderrors.New("mailer: queue is closed")
+
+	// ErrAccountTokenInvalid is wrapped when a password reset or email verification token is
+	// unknown, expired or was already used.
+	ErrAccountTokenInvalid = stderrors.New("accountflows: invalid or expired token")
+	// ErrAccountFlowRateLimited is wrapped when too many account emails were requested.
+	ErrAccountFlowRateLimited = stderrors.New("accountflows: too many requests")
+
+	// ErrSAMLResponseInvalid is wrapped when a SAML response fails validation: bad signature,
+	// wrong audience or recipient, expired, replayed or unsolicited.
+	ErrSAMLResponseInvalid = stderrors.New("saml: invalid response")
+
+	// ErrSCIMNotFound is wrapped when a SCIM store has no resource with an ID.
+	ErrSCIMNotFound = stderrors.New("scim: resource not found")
+	// ErrSCIMConflict is wrapped when a SCIM resource would duplicate a unique attribute of
+	// another, such as the userName of a user.
+	ErrSCIMConflict = stderrors.New("scim: resource already exists")
+
+	// ErrLDAPInvalidCredentials is wrapped when a directory rejects a username and password.
+	ErrLDAPInvalidCredentials = stderrors.New("ldap: invalid credentials")
+
+	// ErrOAuthTokenInactive is wrapped when an access token is unknown, expired or revoked.
+	ErrOAuthTokenInactive = stderrors.New("oauth: inactive token")
+
+	// ErrOutboxNoTransaction is wrapped when events are emitted to an outbox outside of a
+	// database transaction its store can write to.
+	ErrOutboxNoTransaction = stderrors.New("outbox: no usable transaction")
+)
+
+// InvalidTypeError reports a value that could not be converted to the wanted type. It wraps
+// ErrInvalidType.
+//
+// Fields:
+//   - Want: The name of the expected type.
+//   - Got: The value that was found.
+type InvalidTypeError struct {
+	Want string
+	Got  any
+}
+
+// Error implements the error interface.
+func (e *InvalidTypeError) Error() string {
+	return fmt.Sprintf("%s :%s, actual value:%#v", ErrInvalidType, e.Want, e.Got)
+}
+
+// Unwrap returns ErrInvalidType.
+func (e *InvalidTypeError) Unwrap() error {
+	return ErrInvalidType
+}
+
+// KeyError reports a missing session key. It wraps ErrKeyNotFound.
+//
+// Fields:
+//   - Key: The key that was looked up.
+type KeyError struct {
+	Key string
+}
+
+// Error implements the error interface.
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s, key %s", ErrKeyNotFound, e.Key)
+}
+
+// Unwrap returns ErrKeyNotFound.
+func (e *KeyError) Unwrap() error {
+	return ErrKeyNotFound
+}
+
+// RouteError reports an invalid route registration. Each kind of problem is a distinct
+// *RouteError sentinel, and all of them wrap ErrInvalidRoute.
+//
+// Fields:
+//   - Msg: The description of the problem.
+type RouteError struct {
+	Msg string
+}
+
+// Error implements the error interface.
+func (e *RouteError) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns ErrInvalidRoute.
+func (e *RouteError) Unwrap() error {
+	return ErrInvalidRoute
+}
+
+// Mapping is the HTTP representation of an error.
+//
+// Fields:
+//   - Status: The HTTP status code of responses caused by the error.
+//   - Message: A message that is safe to show to end users; it never contains internal
+//     details such as keys, values or routes.
+type Mapping struct {
+	Status  int
+	Message string
+}
+
+var (
+	mutex    sync.RWMutex
+	sentinel []error
+	mappings = map[error]Mapping{}
+)
+
+func init() {
+	Register(ErrInvalidType, http.StatusBadRequest, "a value has an unexpected type")
+	Register(ErrKeyNotFound, http.StatusNotFound, "the requested value does not exist")
+	Register(ErrSessionNotFound, http.StatusUnauthorized, "the session has expired or does not exist")
+	Register(ErrIDSessionNotFound, http.StatusUnauthorized, "the session has expired or does not exist")
+	Register(ErrVerificationFailed, http.StatusUnauthorized, "the credentials could not be verified")
+	Register(ErrBodyNil, http.StatusBadRequest, "the request body is empty")
+	Register(ErrKeyNil, http.StatusBadRequest, "a required parameter is missing")
+	Register(ErrRouteNameNotFound, http.StatusNotFound, "the requested resource was not found")
+	Register(ErrServerShuttingDown, http.StatusServiceUnavailable, "the service is shutting down, retry later")
+	Register(ErrFlagNotFound, http.StatusNotFound, "the requested resource was not found")
+	Register(ErrFlagNameEmpty, http.StatusBadRequest, "a name is required")
+	Register(ErrInvalidBaggage, http.StatusBadRequest, "the request baggage is invalid")
+	Register(ErrLockNotAcquired, http.StatusConflict, "the resource is busy, retry later")
+	Register(ErrFlowStateNotFound, http.StatusBadRequest, "the operation has expired or was already completed, start over")
+	Register(ErrAccountTokenInvalid, http.StatusBadRequest, "the link has expired or was already used, request a new one")
+	Register(ErrAccountFlowRateLimited, http.StatusTooManyRequests, "too many requests, retry later")
+	Register(ErrSAMLResponseInvalid, http.StatusUnauthorized, "the sign-in could not be verified, try again")
+	Register(ErrSCIMNotFound, http.StatusNotFound, "the requested resource was not found")
+	Register(ErrSCIMConflict, http.StatusConflict, "the resource already exists")
+	Register(ErrLDAPInvalidCredentials, http.StatusUnauthorized, "the username or password is incorrect")
+	Register(ErrOAuthTokenInactive, http.StatusUnauthorized, "the access token is invalid, expired or revoked")
+	Register(ErrJobNotFound, http.StatusNotFound, "the job does not exist or has expired")
+}
+
+// Register maps errors wrapping target to an HTTP status and a user-safe message. Later
+// registrations of the same target replace earlier ones; applications use it to map their own
+// sentinel errors.
+//
+// Parameters:
+//   - target: The sentinel error, matched with errors.Is.
+//   - status: The HTTP status code.
+//   - message: The user-safe message.
+func Register(target error, status int, message string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if _, ok := mappings[target]; !ok {
+		sentinel = append(sentinel, target)
+	}
+	mappings[target] = Mapping{Status: status, Message: message}
+}
+
+// Lookup returns the mapping of the first registered sentinel that err wraps.
+//
+// Returns:
+//   - Mapping: The mapping of err.
+//   - bool: false if err wraps no registered sentinel.
+func Lookup(err error) (Mapping, bool) {
+	if err == nil {
+		return Mapping{}, false
+	}
+	mutex.RLock()
+	defer mutex.RUnlock()
+	for _, target := range sentinel {
+		if stderrors.Is(err, target) {
+			return mappings[target], true
+		}
+	}
+	return Mapping{}, false
+}
+
+// HTTPStatus returns the HTTP status code for err: the status of its registered sentinel, the
+// status reported by a StatusCode() int method anywhere in its chain, or 500.
+func HTTPStatus(err error) int {
+	if m, ok := Lookup(err); ok {
+		return m.Status
+	}
+	var sc interface{ StatusCode() int }
+	if stderrors.As(err, &sc) && sc.StatusCode() > 0 {
+		return sc.StatusCode()
+	}
+	return http.StatusInternalServerError
+}
+
+// Message returns a message for err that is safe to show to end users: the message of its
+// registered sentinel, or the standard text of its HTTP status.
+func Message(err error) string {
+	if m, ok := Lookup(err); ok {
+		return m.Message
+	}
+	return http.StatusText(HTTPStatus(err))
+}
+
+// Is reports whether any error in err's chain matches target. It is errors.Is, re-exported so
+// that importing this package does not shadow the standard library helpers.
+func Is(err error, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in err's chain that matches target. It is errors.As.
+func As(err error, target any) bool {
+	return stderrors.As(err, target)
+}
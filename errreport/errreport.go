@@ -0,0 +1,426 @@
+// Package errreport sends the panics and the failed requests of an application to an error
+// tracking service, such as Sentry or Rollbar. A Reporter samples the events, queues them and
+// hands them in batches to a Sink in the background, so that reporting never slows requests
+// down:
+//
+//	sink, err := errreport.InitSentrySink(os.Getenv("SENTRY_DSN"))
+//	...
+//	reporter := errreport.InitReporter(sink).SetEnvironment("production").SetRelease(version)
+//	defer reporter.Close(context.Background())
+//	server.Use(recovery.InitMiddlewareBuilder(500, nil).Build(), reporter.Middleware())
+//
+// Events carry the context of the request: its method, redacted URL and headers, route,
+// request ID and user.
+package errreport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/redact"
+	mrand "math/rand/v2"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Levels of events.
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+// Frame is a frame of the stack trace of an event.
+type Frame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// Event is a reported error and the context of the request it happened in.
+//
+// Fields:
+//   - ID: A random identifier of 32 hexadecimal digits.
+//   - Level: LevelFatal for panics, LevelError for the errors of responses.
+//   - Type: The type of the error, e.g. "*fs.PathError", or "panic".
+//   - Message: The text of the error or the value of the panic.
+//   - Stack: The stack trace, innermost frame first.
+//   - Method, URL, Headers: The request, its sensitive query parameters and headers masked.
+//   - Route: The pattern of the matched route.
+//   - Status: The status of the response.
+//   - RequestID: The identifier of the request, from its request ID header.
+//   - User: The identifier of the user, from the user function of the reporter.
+type Event struct {
+	ID          string
+	Time        time.Time
+	Level       string
+	Type        string
+	Message     string
+	Stack       []Frame
+	Method      string
+	URL         string
+	Headers     map[string]string
+	Route       string
+	Status      int
+	RequestID   string
+	User        string
+	Environment string
+	Release     string
+}
+
+// Sink delivers events to an error tracking service.
+type Sink interface {
+	// Send delivers a batch of events.
+	Send(ctx context.Context, events []*Event) error
+}
+
+// Reporter samples, queues and sends events. It is safe for concurrent use; its settings are
+// to be made before it reports its first event.
+type Reporter struct {
+	sink          Sink
+	sampleRate    float64
+	batchSize     int
+	flushInterval time.Duration
+	redactor      *redact.Redactor
+	requestID     string
+	userFunc      func(ctx *mist.Context) string
+	environment   string
+	release       string
+	onError       func(err error)
+
+	start   sync.Once
+	queue   chan *Event
+	flushes chan chan struct{}
+	closed  chan struct{}
+	close   sync.Once
+}
+
+// InitReporter creates a Reporter sending every event, in batches of up to 10 events at least
+// every 5 seconds, with a queue of 1000 events. Events arriving while the queue is full are
+// dropped. The request ID is read from the X-Request-Id header.
+//
+// Parameters:
+//   - sink: The service receiving the events, e.g. a SentrySink or a RollbarSink.
+//
+// Returns:
+//   - *Reporter: The initialized reporter.
+func InitReporter(sink Sink) *Reporter {
+	return &Reporter{
+		sink:          sink,
+		sampleRate:    1,
+		batchSize:     10,
+		flushInterval: 5 * time.Second,
+		requestID:     "X-Request-Id",
+		onError: func(err error) {
+			fmt.Printf("%s - errreport: %v\n", time.Now().Format(time.RFC3339), err)
+		},
+		queue:   make(chan *Event, 1000),
+		flushes: make(chan chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// SetSampleRate sets the fraction of the events that are sent, between 0 and 1.
+func (r *Reporter) SetSampleRate(rate float64) *Reporter {
+	r.sampleRate = rate
+	return r
+}
+
+// SetBatch sets the largest number of events sent at once and the longest time an event waits
+// before being sent.
+func (r *Reporter) SetBatch(size int, interval time.Duration) *Reporter {
+	r.batchSize = max(size, 1)
+	r.flushInterval = interval
+	return r
+}
+
+// SetQueueSize sets the number of events waiting to be sent beyond which new events are
+// dropped.
+func (r *Reporter) SetQueueSize(size int) *Reporter {
+	r.queue = make(chan *Event, size)
+	return r
+}
+
+// SetRedactor sets the redactor masking the query parameters and headers of the events, in
+// place of redact.Default().
+func (r *Reporter) SetRedactor(redactor *redact.Redactor) *Reporter {
+	r.redactor = redactor
+	return r
+}
+
+// SetRequestIDHeader sets the header holding the identifier of the request, read from the
+// request and then from the response.
+func (r *Reporter) SetRequestIDHeader(name string) *Reporter {
+	r.requestID = name
+	return r
+}
+
+// SetUserFunc sets the function identifying the user of a request, e.g. reading the user ID
+// stored by the authentication middleware; "" for anonymous requests.
+func (r *Reporter) SetUserFunc(fn func(ctx *mist.Context) string) *Reporter {
+	r.userFunc = fn
+	return r
+}
+
+// SetEnvironment sets the environment the events are reported in, e.g. "production".
+func (r *Reporter) SetEnvironment(environment string) *Reporter {
+	r.environment = environment
+	return r
+}
+
+// SetRelease sets the version of the application the events are reported for.
+func (r *Reporter) SetRelease(release string) *Reporter {
+	r.release = release
+	return r
+}
+
+// OnError sets the handler of the failures to send events, which are printed by default.
+func (r *Reporter) OnError(fn func(err error)) *Reporter {
+	r.onError = fn
+	return r
+}
+
+// Capture reports an error that happened while serving a request, e.g. one a handler handles
+// without RespondError.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - err: The error.
+func (r *Reporter) Capture(ctx *mist.Context, err error) {
+	if err == nil {
+		return
+	}
+	event := r.newEvent(ctx, LevelError, errorType(err), err.Error())
+	event.Stack = callers(3)
+	r.enqueue(event)
+}
+
+// CapturePanic reports a value recovered from a panic, with the stack of the panic. It is to
+// be called in the deferred function that recovered it.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - val: The recovered value.
+func (r *Reporter) CapturePanic(ctx *mist.Context, val any) {
+	event := r.newEvent(ctx, LevelFatal, "panic", fmt.Sprint(val))
+	if err, ok := val.(error); ok {
+		event.Type = errorType(err)
+	}
+	event.Stack = panicStack(callers(3))
+	r.enqueue(event)
+}
+
+// Flush sends the queued events and waits until they are sent or ctx is done.
+func (r *Reporter) Flush(ctx context.Context) error {
+	r.start.Do(r.run)
+	done := make(chan struct{})
+	select {
+	case r.flushes <- done:
+	case <-r.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close sends the queued events and stops the reporter; later events are dropped. It is to be
+// called when the application stops, e.g. after HTTPServer.Shutdown.
+func (r *Reporter) Close(ctx context.Context) error {
+	err := r.Flush(ctx)
+	r.close.Do(func() { close(r.closed) })
+	return err
+}
+
+// newEvent creates an event with the context of a request.
+func (r *Reporter) newEvent(ctx *mist.Context, level string, typ string, msg string) *Event {
+	event := &Event{
+		ID:          newID(),
+		Time:        time.Now().UTC(),
+		Level:       level,
+		Type:        typ,
+		Message:     msg,
+		Environment: r.environment,
+		Release:     r.release,
+	}
+	if ctx == nil || ctx.Request == nil {
+		return event
+	}
+	redactor := r.redactor
+	if redactor == nil {
+		redactor = redact.Default()
+	}
+	req := ctx.Request
+	event.Method = req.Method
+	event.Route = ctx.MatchedRoute
+	event.Status = ctx.RespStatusCode
+	event.URL = ctx.Scheme() + "://" + req.Host + req.URL.EscapedPath()
+	if query := redactor.Query(req.URL.RawQuery); query != "" {
+		event.URL += "?" + query
+	}
+	event.Headers = make(map[string]string, len(req.Header))
+	for name, values := range redactor.Header(req.Header) {
+		event.Headers[name] = strings.Join(values, ", ")
+	}
+	event.RequestID = req.Header.Get(r.requestID)
+	if event.RequestID == "" && ctx.ResponseWriter != nil {
+		event.RequestID = ctx.ResponseWriter.Header().Get(r.requestID)
+	}
+	if r.userFunc != nil {
+		event.User = r.userFunc(ctx)
+	}
+	return event
+}
+
+// enqueue samples an event and queues it, dropping it when the queue is full or the reporter
+// is closed.
+func (r *Reporter) enqueue(event *Event) {
+	if r.sampleRate < 1 && mrand.Float64() >= r.sampleRate {
+		return
+	}
+	r.start.Do(r.run)
+	select {
+	case <-r.closed:
+	case r.queue <- event:
+	default:
+	}
+}
+
+// run starts the goroutine sending the events.
+func (r *Reporter) run() {
+	go func() {
+		ticker := time.NewTicker(r.flushInterval)
+		defer ticker.Stop()
+		batch := make([]*Event, 0, r.batchSize)
+		send := func() {
+			if len(batch) == 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := r.sink.Send(ctx, batch); err != nil && r.onError != nil {
+				r.onError(err)
+			}
+			cancel()
+			batch = make([]*Event, 0, r.batchSize)
+		}
+		// drain moves the queued events into batches and sends them.
+		drain := func() {
+			for {
+				select {
+				case event := <-r.queue:
+					if batch = append(batch, event); len(batch) >= r.batchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+		for {
+			select {
+			case event := <-r.queue:
+				if batch = append(batch, event); len(batch) >= r.batchSize {
+					send()
+				}
+			case <-ticker.C:
+				send()
+			case done := <-r.flushes:
+				drain()
+				close(done)
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+}
+
+// Middleware returns a middleware reporting the panics of the next handlers, which it panics
+// again for the recovery middleware to answer, and the responses of 500 and above that carry
+// an error given to Context.RespondError. It is to be used after the recovery middleware.
+//
+// Returns:
+//   - mist.Middleware: The reporting middleware.
+func (r *Reporter) Middleware() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			defer func() {
+				if val := recover(); val != nil {
+					if val == http.ErrAbortHandler {
+						panic(val)
+					}
+					r.CapturePanic(ctx, val)
+					panic(val)
+				}
+			}()
+			next(ctx)
+			if err := ctx.RespondedError(); err != nil && ctx.RespStatusCode >= http.StatusInternalServerError {
+				event := r.newEvent(ctx, LevelError, errorType(err), err.Error())
+				r.enqueue(event)
+			}
+		}
+	}
+}
+
+// errorType returns the name of the dynamic type of an error, unwrapping the errors of
+// fmt.Errorf which say nothing of the failure.
+func errorType(err error) string {
+	for {
+		typ := reflect.TypeOf(err).String()
+		if typ != "*fmt.wrapError" && typ != "*fmt.wrapErrors" {
+			return typ
+		}
+		inner, ok := err.(interface{ Unwrap() error })
+		if !ok || inner.Unwrap() == nil {
+			return typ
+		}
+		err = inner.Unwrap()
+	}
+}
+
+// callers returns the stack of the calling goroutine, skipping skip frames.
+func callers(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make([]Frame, 0, n)
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return stack
+		}
+	}
+}
+
+// panicStack trims the frames of the deferred function and of the runtime from the stack of a
+// recovering goroutine, so that it starts where the panic was raised.
+func panicStack(stack []Frame) []Frame {
+	for i, frame := range stack {
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[i+1:]
+			break
+		}
+	}
+	for len(stack) > 0 && strings.HasPrefix(stack[0].Function, "runtime.") {
+		stack = stack[1:]
+	}
+	return stack
+}
+
+// newID returns a random event identifier of 32 hexadecimal digits.
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
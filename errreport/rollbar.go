@@ -0,0 +1,117 @@
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RollbarSink sends events to Rollbar through its item API.
+type RollbarSink struct {
+	token    string
+	endpoint string
+	client   *http.Client
+}
+
+// InitRollbarSink creates a RollbarSink for the project of an access token.
+//
+// Parameters:
+//   - token: A project access token with the post_server_item scope.
+//
+// Returns:
+//   - *RollbarSink: The initialized sink.
+func InitRollbarSink(token string) *RollbarSink {
+	return &RollbarSink{
+		token:    token,
+		endpoint: "https://api.rollbar.com/api/1/item/",
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetEndpoint sets the URL of the item API, e.g. for a proxy or a self-hosted instance.
+func (s *RollbarSink) SetEndpoint(endpoint string) *RollbarSink {
+	s.endpoint = endpoint
+	return s
+}
+
+// SetClient sets the HTTP client sending the events.
+func (s *RollbarSink) SetClient(client *http.Client) *RollbarSink {
+	s.client = client
+	return s
+}
+
+// Send sends the events, one item each since the API takes a single item per request.
+func (s *RollbarSink) Send(ctx context.Context, events []*Event) error {
+	for _, event := range events {
+		body, err := json.Marshal(map[string]any{"data": s.item(event)})
+		if err != nil {
+			return err
+		}
+		if err = post(ctx, s.client, s.endpoint, "application/json",
+			map[string]string{"X-Rollbar-Access-Token": s.token}, body); err != nil {
+			return fmt.Errorf("errreport: sending to Rollbar: %w", err)
+		}
+	}
+	return nil
+}
+
+// item encodes an event as a Rollbar item.
+func (s *RollbarSink) item(event *Event) map[string]any {
+	frames := make([]map[string]any, 0, len(event.Stack))
+	// Rollbar lists the frames outermost first.
+	for i := len(event.Stack) - 1; i >= 0; i-- {
+		frame := event.Stack[i]
+		frames = append(frames, map[string]any{
+			"filename": frame.File,
+			"lineno":   frame.Line,
+			"method":   frame.Function,
+		})
+	}
+	level := event.Level
+	if level == LevelFatal {
+		level = "critical"
+	}
+	custom := map[string]any{}
+	if event.Route != "" {
+		custom["route"] = event.Route
+	}
+	if event.RequestID != "" {
+		custom["request_id"] = event.RequestID
+	}
+	if event.Status != 0 {
+		custom["status_code"] = event.Status
+	}
+	data := map[string]any{
+		"uuid":      event.ID,
+		"timestamp": event.Time.Unix(),
+		"level":     level,
+		"platform":  "go",
+		"language":  "go",
+		"framework": "mist",
+		"body": map[string]any{
+			"trace": map[string]any{
+				"frames":    frames,
+				"exception": map[string]string{"class": event.Type, "message": event.Message},
+			},
+		},
+		"custom": custom,
+	}
+	if event.Environment != "" {
+		data["environment"] = event.Environment
+	}
+	if event.Release != "" {
+		data["code_version"] = event.Release
+	}
+	if event.Route != "" {
+		data["context"] = event.Method + " " + event.Route
+	}
+	if event.Method != "" {
+		data["request"] = map[string]any{"method": event.Method, "url": event.URL, "headers": event.Headers}
+	}
+	if event.User != "" {
+		data["person"] = map[string]string{"id": event.User}
+	}
+	return data
+}
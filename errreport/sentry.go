@@ -0,0 +1,169 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SentrySink sends events to Sentry through its envelope endpoint.
+type SentrySink struct {
+	endpoint string
+	auth     string
+	dsn      string
+	client   *http.Client
+}
+
+// InitSentrySink creates a SentrySink for the project of a DSN.
+//
+// Parameters:
+//   - dsn: The DSN of the project, "https://{key}@{host}/{project}".
+//
+// Returns:
+//   - *SentrySink: The initialized sink.
+//   - error: An error if the DSN is malformed.
+func InitSentrySink(dsn string) (*SentrySink, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("errreport: invalid Sentry DSN: %w", err)
+	}
+	key := ""
+	if u.User != nil {
+		key = u.User.Username()
+	}
+	// The project is the last segment of the path, which may be prefixed when Sentry is
+	// served under a path.
+	path, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		path, project = "/"+project[:i], project[i+1:]
+	}
+	if key == "" || project == "" || u.Host == "" {
+		return nil, fmt.Errorf("errreport: invalid Sentry DSN %q", u.Redacted())
+	}
+	return &SentrySink{
+		endpoint: u.Scheme + "://" + u.Host + path + "/api/" + project + "/envelope/",
+		auth:     "Sentry sentry_version=7, sentry_client=mist-errreport/1.0, sentry_key=" + key,
+		dsn:      dsn,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// SetClient sets the HTTP client sending the events.
+func (s *SentrySink) SetClient(client *http.Client) *SentrySink {
+	s.client = client
+	return s
+}
+
+// Send sends the events, one envelope each since an envelope holds a single event.
+func (s *SentrySink) Send(ctx context.Context, events []*Event) error {
+	for _, event := range events {
+		envelope, err := s.envelope(event)
+		if err != nil {
+			return err
+		}
+		if err = post(ctx, s.client, s.endpoint, "application/x-sentry-envelope",
+			map[string]string{"X-Sentry-Auth": s.auth}, envelope); err != nil {
+			return fmt.Errorf("errreport: sending to Sentry: %w", err)
+		}
+	}
+	return nil
+}
+
+// envelope encodes an event as a Sentry envelope.
+func (s *SentrySink) envelope(event *Event) ([]byte, error) {
+	frames := make([]map[string]any, 0, len(event.Stack))
+	// Sentry lists the frames outermost first.
+	for i := len(event.Stack) - 1; i >= 0; i-- {
+		frame := event.Stack[i]
+		frames = append(frames, map[string]any{
+			"function": frame.Function,
+			"abs_path": frame.File,
+			"lineno":   frame.Line,
+			"in_app":   !strings.HasPrefix(frame.Function, "runtime.") && !strings.HasPrefix(frame.Function, "net/http."),
+		})
+	}
+	exception := map[string]any{"type": event.Type, "value": event.Message}
+	if len(frames) > 0 {
+		exception["stacktrace"] = map[string]any{"frames": frames}
+	}
+	payload := map[string]any{
+		"event_id":  event.ID,
+		"timestamp": event.Time.Format(time.RFC3339Nano),
+		"level":     event.Level,
+		"platform":  "go",
+		"exception": map[string]any{"values": []any{exception}},
+		"tags":      map[string]string{},
+	}
+	tags := payload["tags"].(map[string]string)
+	if event.Route != "" {
+		tags["route"] = event.Route
+		payload["transaction"] = event.Method + " " + event.Route
+	}
+	if event.RequestID != "" {
+		tags["request_id"] = event.RequestID
+	}
+	if event.Status != 0 {
+		tags["status_code"] = fmt.Sprint(event.Status)
+	}
+	if event.Method != "" {
+		payload["request"] = map[string]any{"method": event.Method, "url": event.URL, "headers": event.Headers}
+	}
+	if event.User != "" {
+		payload["user"] = map[string]string{"id": event.User}
+	}
+	if event.Environment != "" {
+		payload["environment"] = event.Environment
+	}
+	if event.Release != "" {
+		payload["release"] = event.Release
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	header, err := json.Marshal(map[string]string{
+		"event_id": event.ID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		"dsn":      s.dsn,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteString("\n")
+	fmt.Fprintf(&buf, `{"type":"event","length":%d}`, len(body))
+	buf.WriteString("\n")
+	buf.Write(body)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// post sends a request body and fails on statuses other than 2xx.
+func post(ctx context.Context, client *http.Client, endpoint string, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
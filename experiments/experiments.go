@@ -0,0 +1,151 @@
+// Package experiments runs A/B tests. A middleware assigns every request to a variant of each
+// running experiment, keeps the assignment sticky through a cookie, exposes it on the context
+// and in templates, and records an exposure event the first time a handler reads a variant.
+//
+//	checkout := experiments.Experiment{
+//	    Name:     "checkout",
+//	    Variants: []experiments.Variant{{Name: "control", Weight: 50}, {Name: "one-page", Weight: 50}},
+//	}
+//	server.Use(experiments.InitMiddlewareBuilder(checkout).
+//	    SetRecorder(experiments.InitPrometheusRecorder("shop", "experiments")).
+//	    Build())
+//
+//	server.GET("/checkout", func(ctx *mist.Context) {
+//	    if experiments.VariantOf(ctx, "checkout") == "one-page" {
+//	        // ...
+//	    }
+//	})
+package experiments
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"hash/fnv"
+	"sync"
+)
+
+// ctxKey is the key under which the assignment of a request is stored.
+const ctxKey = "_experiments"
+
+// Variant is one arm of an experiment.
+//
+// Fields:
+//   - Name: The name of the variant, e.g. "control".
+//   - Weight: The relative share of traffic assigned to the variant.
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Experiment describes an A/B test.
+//
+// Fields:
+//   - Name: The unique name of the experiment.
+//   - Variants: The arms of the experiment; the first one is the fallback.
+type Experiment struct {
+	Name     string
+	Variants []Variant
+}
+
+// has reports whether the experiment has a variant with the given name.
+func (e Experiment) has(name string) bool {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pick deterministically selects a variant for key according to the variant weights.
+func (e Experiment) pick(key string) string {
+	if len(e.Variants) == 0 {
+		return ""
+	}
+	total := 0
+	for _, v := range e.Variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+	if total == 0 {
+		return e.Variants[0].Name
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(e.Name + ":" + key))
+	n := int(h.Sum32() % uint32(total))
+	for _, v := range e.Variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		if n < v.Weight {
+			return v.Name
+		}
+		n -= v.Weight
+	}
+	return e.Variants[0].Name
+}
+
+// Recorder receives exposure events, i.e. the moments a request actually observed a variant.
+// Implementations can forward them to metrics, an analytics pipeline or an event bus.
+type Recorder interface {
+	Exposure(ctx *mist.Context, experiment string, variant string)
+}
+
+// assignment is the per-request state stored on the context.
+type assignment struct {
+	mutex    sync.Mutex
+	variants map[string]string
+	exposed  map[string]bool
+	recorder Recorder
+}
+
+// contextKey is the key of the assignment in the standard request context.
+type contextKey struct{}
+
+// VariantOf returns the variant of the named experiment assigned to the request, or an empty
+// string when the experiment is unknown or the middleware is not installed. The first call per
+// experiment records an exposure event.
+func VariantOf(ctx *mist.Context, experiment string) string {
+	val, ok := ctx.Get(ctxKey)
+	if !ok {
+		return ""
+	}
+	a, ok := val.(*assignment)
+	if !ok {
+		return ""
+	}
+	a.mutex.Lock()
+	variant, ok := a.variants[experiment]
+	first := ok && !a.exposed[experiment]
+	if first {
+		a.exposed[experiment] = true
+	}
+	a.mutex.Unlock()
+	if first && a.recorder != nil {
+		a.recorder.Exposure(ctx, experiment, variant)
+	}
+	return variant
+}
+
+// Assignments returns every experiment-to-variant assignment of the request, e.g. to pass it
+// to a template as data. It does not record exposures.
+func Assignments(ctx *mist.Context) map[string]string {
+	val, ok := ctx.Get(ctxKey)
+	if !ok {
+		return nil
+	}
+	if a, ok := val.(*assignment); ok {
+		return a.variants
+	}
+	return nil
+}
+
+// FromContext returns the assignments stored in a standard context. Template engines receive
+// the request context in Render and can use it to expose variants to templates.
+func FromContext(ctx context.Context) map[string]string {
+	if a, ok := ctx.Value(contextKey{}).(*assignment); ok {
+		return a.variants
+	}
+	return nil
+}
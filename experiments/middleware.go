@@ -0,0 +1,121 @@
+package experiments
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/security"
+	"github.com/google/uuid"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MiddlewareBuilder builds the middleware assigning requests to experiment variants.
+//
+// Fields:
+//   - experiments: The running experiments.
+//   - cookieName: The name of the cookie holding the sticky assignments.
+//   - maxAge: The lifetime of the assignment cookie.
+//   - keyFn: Derives the bucketing key of a request for new assignments.
+//   - recorder: Receives exposure events.
+type MiddlewareBuilder struct {
+	experiments []Experiment
+	cookieName  string
+	maxAge      time.Duration
+	keyFn       func(ctx *mist.Context) string
+	recorder    Recorder
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder for the given experiments. Assignments are
+// kept in the "mist_exp" cookie for 90 days and bucketed by the user ID of the security session
+// when there is one, so that a signed-in user sees the same variant on every device, and by a
+// random visitor ID otherwise.
+func InitMiddlewareBuilder(experiments ...Experiment) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		experiments: experiments,
+		cookieName:  "mist_exp",
+		maxAge:      90 * 24 * time.Hour,
+		keyFn:       defaultKey,
+	}
+}
+
+// SetCookie sets the name and lifetime of the assignment cookie.
+func (b *MiddlewareBuilder) SetCookie(name string, maxAge time.Duration) *MiddlewareBuilder {
+	b.cookieName = name
+	b.maxAge = maxAge
+	return b
+}
+
+// SetKeyFunc sets the function deriving the bucketing key of a request. Requests sharing a key
+// receive the same variants.
+func (b *MiddlewareBuilder) SetKeyFunc(fn func(ctx *mist.Context) string) *MiddlewareBuilder {
+	b.keyFn = fn
+	return b
+}
+
+// SetRecorder sets the Recorder receiving exposure events.
+func (b *MiddlewareBuilder) SetRecorder(recorder Recorder) *MiddlewareBuilder {
+	b.recorder = recorder
+	return b
+}
+
+// defaultKey buckets by the user ID of the security session, or by a random visitor ID.
+func defaultKey(ctx *mist.Context) string {
+	if val, ok := ctx.Get(security.CtxSessionKey); ok {
+		if sess, ok := val.(security.Session); ok && sess.Claims().UserID != 0 {
+			return strconv.FormatInt(sess.Claims().UserID, 10)
+		}
+	}
+	return uuid.NewString()
+}
+
+// Build creates the middleware. For every request it reads the assignment cookie, assigns the
+// experiments missing from it (or whose recorded variant no longer exists), rewrites the cookie
+// when something changed, and stores the assignment on the context for VariantOf, Assignments
+// and FromContext.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			raw := ""
+			if ck, err := ctx.Request.Cookie(b.cookieName); err == nil {
+				raw = ck.Value
+			}
+			stored, _ := url.ParseQuery(raw)
+
+			a := &assignment{
+				variants: make(map[string]string, len(b.experiments)),
+				exposed:  make(map[string]bool, len(b.experiments)),
+				recorder: b.recorder,
+			}
+			current := make(url.Values, len(b.experiments))
+			key := ""
+			for _, e := range b.experiments {
+				v := stored.Get(e.Name)
+				if !e.has(v) {
+					if key == "" {
+						key = b.keyFn(ctx)
+					}
+					v = e.pick(key)
+				}
+				a.variants[e.Name] = v
+				current.Set(e.Name, v)
+			}
+			// Rewrite the cookie when assignments were added or ended experiments dropped.
+			if value := current.Encode(); value != raw {
+				ctx.SetCookie(&http.Cookie{
+					Name:     b.cookieName,
+					Value:    value,
+					Path:     "/",
+					MaxAge:   int(b.maxAge.Seconds()),
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			ctx.Set(ctxKey, a)
+			ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), contextKey{}, a))
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package experiments
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusRecorder counts exposures per experiment and variant in a Prometheus counter named
+// "<namespace>_<subsystem>_exposures_total".
+type PrometheusRecorder struct {
+	exposures *prometheus.CounterVec
+}
+
+// InitPrometheusRecorder creates a PrometheusRecorder and registers its counter with the default
+// Prometheus registry. It panics if the counter is already registered.
+func InitPrometheusRecorder(namespace string, subsystem string) *PrometheusRecorder {
+	exposures := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "exposures_total",
+		Help:      "Number of requests exposed to each experiment variant.",
+	}, []string{"experiment", "variant"})
+	prometheus.MustRegister(exposures)
+	return &PrometheusRecorder{exposures: exposures}
+}
+
+// Exposure increments the counter of the experiment variant.
+func (r *PrometheusRecorder) Exposure(_ *mist.Context, experiment string, variant string) {
+	r.exposures.WithLabelValues(experiment, variant).Inc()
+}
+
+// RecorderFunc adapts a function to the Recorder interface, e.g. to publish exposures to an
+// event bus or analytics pipeline.
+type RecorderFunc func(ctx *mist.Context, experiment string, variant string)
+
+// Exposure calls f.
+func (f RecorderFunc) Exposure(ctx *mist.Context, experiment string, variant string) {
+	f(ctx, experiment, variant)
+}
@@ -0,0 +1,173 @@
+package mist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// ExportDOT writes the routing tree in Graphviz DOT format, one subtree per HTTP method. Nodes
+// are shaped by kind (static, parameter, regular expression, wildcard), nodes ending a route
+// are drawn with a double border and labelled with the route, and the middleware attached to
+// a node is listed under its segment.
+//
+// Example:
+//
+//	f, _ := os.Create("routes.dot")
+//	_ = server.ExportDOT(f) // dot -Tsvg routes.dot > routes.svg
+//
+// Parameters:
+//   - w: The writer receiving the DOT document.
+//
+// Returns:
+//   - error: An error if writing fails.
+func (r *router) ExportDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph routes {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [fontname=\"monospace\"];")
+	r.walkTrees(func(id string, parentID string, method string, n *node) {
+		shape := map[nodeType]string{
+			nodeTypeStatic: "box",
+			nodeTypeReg:    "hexagon",
+			nodeTypeParam:  "ellipse",
+			nodeTypeAny:    "diamond",
+		}[n.typ]
+		label := segmentLabel(method, n, parentID == "")
+		if names := middlewareNames(n.mils); len(names) > 0 {
+			label += "\n[" + strings.Join(names, ", ") + "]"
+		}
+		peripheries := 1
+		if n.handler != nil {
+			peripheries = 2
+			label += "\n→ " + n.route
+		}
+		if parentID == "" {
+			shape = "box"
+		}
+		fmt.Fprintf(bw, "\t%s [label=%q, shape=%s, peripheries=%d];\n", id, label, shape, peripheries)
+		if parentID != "" {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", parentID, id)
+		}
+	})
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// ExportMermaid writes the routing tree as a Mermaid flowchart, suitable for embedding in
+// Markdown documentation. Node shapes and labels follow the same conventions as ExportDOT.
+//
+// Parameters:
+//   - w: The writer receiving the flowchart.
+//
+// Returns:
+//   - error: An error if writing fails.
+func (r *router) ExportMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "flowchart LR")
+	r.walkTrees(func(id string, parentID string, method string, n *node) {
+		label := segmentLabel(method, n, parentID == "")
+		if names := middlewareNames(n.mils); len(names) > 0 {
+			label += "<br/>[" + strings.Join(names, ", ") + "]"
+		}
+		if n.handler != nil {
+			label += "<br/>→ " + n.route
+		}
+		label = `"` + strings.ReplaceAll(label, `"`, "#quot;") + `"`
+		open, closing := "[", "]"
+		if parentID != "" {
+			switch n.typ {
+			case nodeTypeParam:
+				open, closing = "([", "])"
+			case nodeTypeReg:
+				open, closing = "{{", "}}"
+			case nodeTypeAny:
+				open, closing = "{", "}"
+			}
+		}
+		if n.handler != nil && n.typ == nodeTypeStatic && parentID != "" {
+			open, closing = "[[", "]]"
+		}
+		fmt.Fprintf(bw, "\t%s%s%s%s\n", id, open, label, closing)
+		if parentID != "" {
+			fmt.Fprintf(bw, "\t%s --> %s\n", parentID, id)
+		}
+	})
+	return bw.Flush()
+}
+
+// walkTrees visits every node of every method tree depth-first in a deterministic order,
+// passing generated node identifiers to visit. The parent identifier is empty for roots.
+func (r *router) walkTrees(visit func(id string, parentID string, method string, n *node)) {
+	methods := make([]string, 0, len(r.trees))
+	for m := range r.trees {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+
+	counter := 0
+	var walk func(method string, parentID string, n *node)
+	walk = func(method string, parentID string, n *node) {
+		id := fmt.Sprintf("n%d", counter)
+		counter++
+		visit(id, parentID, method, n)
+		for _, child := range orderedChildren(n) {
+			walk(method, id, child)
+		}
+	}
+	for _, m := range methods {
+		walk(m, "", r.trees[m])
+	}
+}
+
+// orderedChildren returns the children of n in matching priority order: static children
+// sorted by segment, then the regular expression, parameter and wildcard children.
+func orderedChildren(n *node) []*node {
+	keys := make([]string, 0, len(n.children))
+	for k := range n.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]*node, 0, len(keys)+3)
+	for _, k := range keys {
+		res = append(res, n.children[k])
+	}
+	for _, c := range []*node{n.regChild, n.paramChild, n.starChild} {
+		if c != nil {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// segmentLabel renders the label of a node: "METHOD /" for roots, the path segment otherwise.
+func segmentLabel(method string, n *node, root bool) string {
+	if root {
+		return method + " /"
+	}
+	return n.path
+}
+
+// middlewareNames returns short, human-readable names of middleware functions, derived from
+// the names of the functions that created them.
+func middlewareNames(ms []Middleware) []string {
+	names := make([]string, 0, len(ms))
+	for _, m := range ms {
+		if m == nil {
+			continue
+		}
+		name := runtime.FuncForPC(reflect.ValueOf(m).Pointer()).Name()
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:]
+		}
+		for strings.HasSuffix(name, "func1") || strings.HasSuffix(name, ".") {
+			name = strings.TrimSuffix(strings.TrimSuffix(name, "func1"), ".")
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,98 @@
+package featureflags
+
+import (
+	"github.com/dormoron/mist"
+	"net/http"
+)
+
+// RegisterAdmin registers the admin API of the store under prefix, so flags can be inspected
+// and toggled at runtime without a redeploy:
+//
+//	GET   {prefix}/flags         lists every flag
+//	GET   {prefix}/flags/:name   returns a flag
+//	PUT   {prefix}/flags/:name   creates or replaces a flag from a JSON Flag body
+//	PATCH {prefix}/flags/:name   toggles a flag with a {"enabled": true|false} body
+//
+// The API must not be exposed publicly; pass authentication and authorization middleware in ms.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the admin API, e.g. "/admin".
+//   - ms: Middleware applied to every admin route.
+func (s *Store) RegisterAdmin(server *mist.HTTPServer, prefix string, ms ...mist.Middleware) {
+	g := server.Group(prefix, ms...)
+	g.GET("/flags", s.listHandler)
+	g.GET("/flags/:name", s.getHandler)
+	g.PUT("/flags/:name", s.putHandler)
+	g.PATCH("/flags/:name", s.patchHandler)
+}
+
+// listHandler responds with every flag.
+func (s *Store) listHandler(ctx *mist.Context) {
+	flags, err := s.List(ctx.Request.Context())
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, flags)
+}
+
+// getHandler responds with a single flag.
+func (s *Store) getHandler(ctx *mist.Context) {
+	flag, ok, err := s.Get(ctx.Request.Context(), ctx.PathValue("name").StringOrDefault(""))
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if !ok {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusNotFound, Detail: "the flag does not exist"})
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, flag)
+}
+
+// putHandler creates or replaces a flag. The name in the path wins over the name in the body.
+func (s *Store) putHandler(ctx *mist.Context) {
+	var flag Flag
+	if err := ctx.Bind(&flag); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	flag.Name = ctx.PathValue("name").StringOrDefault("")
+	if err := s.Save(ctx.Request.Context(), flag); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, flag)
+}
+
+// patchHandler toggles the master switch of a flag.
+func (s *Store) patchHandler(ctx *mist.Context) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := ctx.Bind(&body); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if body.Enabled == nil {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: `the body must set "enabled"`})
+		return
+	}
+	name := ctx.PathValue("name").StringOrDefault("")
+	flag, ok, err := s.Get(ctx.Request.Context(), name)
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	if !ok {
+		_ = ctx.RespondProblem(mist.Problem{Status: http.StatusNotFound, Detail: "the flag does not exist"})
+		return
+	}
+	flag.Enabled = *body.Enabled
+	if err = s.Save(ctx.Request.Context(), flag); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, flag)
+}
@@ -0,0 +1,85 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileBackend keeps flag definitions in a JSON file holding an array of flags. The file is
+// read into memory when the backend is created and on Reload; Save rewrites it atomically so
+// that toggles made through the admin API survive restarts.
+type FileBackend struct {
+	*MemoryBackend
+	path  string
+	write sync.Mutex
+}
+
+// InitFileBackend creates a FileBackend reading path. A missing file is treated as an empty
+// set of flags and is created on the first Save.
+//
+// Returns:
+//   - *FileBackend: The backend.
+//   - error: An error if the file exists but cannot be read or parsed.
+func InitFileBackend(path string) (*FileBackend, error) {
+	b := &FileBackend{MemoryBackend: InitMemoryBackend(), path: path}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload replaces the in-memory flags with the contents of the file, picking up changes made
+// to the file by other processes or by hand.
+func (b *FileBackend) Reload() error {
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var flags []Flag
+	if err = json.Unmarshal(data, &flags); err != nil {
+		return err
+	}
+	loaded := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		loaded[f.Name] = f
+	}
+	b.mutex.Lock()
+	b.flags = loaded
+	b.mutex.Unlock()
+	return nil
+}
+
+// Save creates or replaces a flag and persists the full set of flags to the file.
+func (b *FileBackend) Save(ctx context.Context, flag Flag) error {
+	b.write.Lock()
+	defer b.write.Unlock()
+	if err := b.MemoryBackend.Save(ctx, flag); err != nil {
+		return err
+	}
+	flags, _ := b.List(ctx)
+	data, err := json.MarshalIndent(flags, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
@@ -0,0 +1,74 @@
+package featureflags
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/security"
+	"log"
+)
+
+// Flags connects an Evaluator to the server. It implements mist.FlagEvaluator and is installed
+// with mist.ServerWithFeatureFlags, which makes ctx.FlagEnabled available in handlers.
+type Flags struct {
+	evaluator Evaluator
+	subjectFn func(ctx *mist.Context) Subject
+	errorFn   func(ctx *mist.Context, name string, err error)
+}
+
+// Option configures Flags.
+type Option func(f *Flags)
+
+// WithSubjectFunc sets the function deriving the evaluation subject from a request. The default
+// is DefaultSubject.
+func WithSubjectFunc(fn func(ctx *mist.Context) Subject) Option {
+	return func(f *Flags) {
+		f.subjectFn = fn
+	}
+}
+
+// WithErrorHandler sets the function called when a flag cannot be evaluated, e.g. because the
+// backend is unreachable. The flag is reported as off in that case. The default logs the error.
+func WithErrorHandler(fn func(ctx *mist.Context, name string, err error)) Option {
+	return func(f *Flags) {
+		f.errorFn = fn
+	}
+}
+
+// InitFlags creates Flags evaluating through evaluator.
+func InitFlags(evaluator Evaluator, opts ...Option) *Flags {
+	f := &Flags{
+		evaluator: evaluator,
+		subjectFn: DefaultSubject,
+		errorFn: func(ctx *mist.Context, name string, err error) {
+			log.Println("featureflags: evaluating", name, "failed:", err)
+		},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// FlagEnabled reports whether the named flag is on for the request of ctx. Evaluation errors
+// are reported to the error handler and turn the flag off.
+func (f *Flags) FlagEnabled(ctx *mist.Context, name string) bool {
+	enabled, err := f.evaluator.Evaluate(ctx.Request.Context(), name, f.subjectFn(ctx))
+	if err != nil {
+		f.errorFn(ctx, name, err)
+		return false
+	}
+	return enabled
+}
+
+// DefaultSubject derives the subject from the security session stored on the context by the
+// security middleware, using the user and session IDs of its claims, and from the matched route.
+func DefaultSubject(ctx *mist.Context) Subject {
+	subject := Subject{Route: ctx.MatchedRoute}
+	if val, ok := ctx.Get(security.CtxSessionKey); ok {
+		if sess, ok := val.(security.Session); ok {
+			claims := sess.Claims()
+			subject.UserID = formatUserID(claims.UserID)
+			subject.SessionID = claims.SessionID
+		}
+	}
+	return subject
+}
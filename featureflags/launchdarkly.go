@@ -0,0 +1,33 @@
+package featureflags
+
+import "context"
+
+// VariationFunc evaluates a boolean flag in a third-party flag service.
+type VariationFunc func(ctx context.Context, key string, subject Subject, defaultVal bool) (bool, error)
+
+// LaunchDarkly is an Evaluator delegating to LaunchDarkly (or any similar service). The adapter
+// does not depend on the vendor SDK; the application bridges it with a VariationFunc:
+//
+//	ld, _ := ldclient.MakeClient(sdkKey, 5*time.Second)
+//	evaluator := featureflags.InitLaunchDarkly(func(_ context.Context, key string, s featureflags.Subject, def bool) (bool, error) {
+//	    builder := ldcontext.NewBuilder(s.UserID)
+//	    if s.UserID == "" {
+//	        builder = ldcontext.NewBuilder(s.SessionID).Anonymous(true)
+//	    }
+//	    return ld.BoolVariation(key, builder.Build(), def)
+//	})
+//	flags := featureflags.InitFlags(evaluator)
+type LaunchDarkly struct {
+	variation VariationFunc
+}
+
+// InitLaunchDarkly creates a LaunchDarkly evaluator. Flags default to off when the service
+// cannot be reached.
+func InitLaunchDarkly(variation VariationFunc) *LaunchDarkly {
+	return &LaunchDarkly{variation: variation}
+}
+
+// Evaluate reports whether the flag is on for subject according to the service.
+func (l *LaunchDarkly) Evaluate(ctx context.Context, name string, subject Subject) (bool, error) {
+	return l.variation(ctx, name, subject, false)
+}
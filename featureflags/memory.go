@@ -0,0 +1,59 @@
+package featureflags
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// MemoryBackend keeps flag definitions in process memory. It is safe for concurrent use and
+// suits tests and single-instance deployments.
+type MemoryBackend struct {
+	mutex sync.RWMutex
+	flags map[string]Flag
+}
+
+// InitMemoryBackend creates a MemoryBackend preloaded with flags.
+func InitMemoryBackend(flags ...Flag) *MemoryBackend {
+	b := &MemoryBackend{flags: make(map[string]Flag, len(flags))}
+	for _, f := range flags {
+		b.flags[f.Name] = f
+	}
+	return b
+}
+
+// Get returns the named flag and whether it exists.
+func (b *MemoryBackend) Get(_ context.Context, name string) (Flag, bool, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	f, ok := b.flags[name]
+	return f, ok, nil
+}
+
+// List returns every flag sorted by name.
+func (b *MemoryBackend) List(_ context.Context) ([]Flag, error) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	res := make([]Flag, 0, len(b.flags))
+	for _, f := range b.flags {
+		res = append(res, f)
+	}
+	sortFlags(res)
+	return res, nil
+}
+
+// Save creates or replaces a flag.
+func (b *MemoryBackend) Save(_ context.Context, flag Flag) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.flags[flag.Name] = flag
+	return nil
+}
+
+// sortFlags orders flags by name for stable listings.
+func sortFlags(flags []Flag) {
+	slices.SortFunc(flags, func(a, b Flag) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+}
@@ -0,0 +1,77 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisBackend keeps flag definitions in a Redis hash, one JSON encoded flag per field, so that
+// every instance of the application sees a toggle immediately.
+type RedisBackend struct {
+	client redis.Cmdable
+	key    string
+}
+
+// RedisBackendOption configures a RedisBackend.
+type RedisBackendOption func(b *RedisBackend)
+
+// WithRedisKey sets the key of the hash holding the flags. The default is "mist:featureflags".
+func WithRedisKey(key string) RedisBackendOption {
+	return func(b *RedisBackend) {
+		b.key = key
+	}
+}
+
+// InitRedisBackend creates a RedisBackend using client.
+func InitRedisBackend(client redis.Cmdable, opts ...RedisBackendOption) *RedisBackend {
+	b := &RedisBackend{client: client, key: "mist:featureflags"}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Get returns the named flag and whether it exists.
+func (b *RedisBackend) Get(ctx context.Context, name string) (Flag, bool, error) {
+	data, err := b.client.HGet(ctx, b.key, name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Flag{}, false, nil
+	}
+	if err != nil {
+		return Flag{}, false, err
+	}
+	var f Flag
+	if err = json.Unmarshal(data, &f); err != nil {
+		return Flag{}, false, err
+	}
+	return f, true, nil
+}
+
+// List returns every flag sorted by name.
+func (b *RedisBackend) List(ctx context.Context) ([]Flag, error) {
+	values, err := b.client.HGetAll(ctx, b.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Flag, 0, len(values))
+	for _, data := range values {
+		var f Flag
+		if err = json.Unmarshal([]byte(data), &f); err != nil {
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	sortFlags(res)
+	return res, nil
+}
+
+// Save creates or replaces a flag.
+func (b *RedisBackend) Save(ctx context.Context, flag Flag) error {
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return err
+	}
+	return b.client.HSet(ctx, b.key, flag.Name, data).Err()
+}
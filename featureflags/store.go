@@ -0,0 +1,65 @@
+package featureflags
+
+import (
+	"context"
+	"github.com/dormoron/mist/internal/errs"
+)
+
+// Store evaluates flags against the definitions kept in a Backend and offers the operations
+// used by the admin API.
+type Store struct {
+	backend Backend
+}
+
+// InitStore creates a Store backed by backend.
+func InitStore(backend Backend) *Store {
+	return &Store{backend: backend}
+}
+
+// Evaluate reports whether the named flag is on for subject. Unknown flags are off.
+func (s *Store) Evaluate(ctx context.Context, name string, subject Subject) (bool, error) {
+	flag, ok, err := s.backend.Get(ctx, name)
+	if err != nil || !ok {
+		return false, err
+	}
+	return flag.EnabledFor(subject), nil
+}
+
+// Get returns the named flag and whether it exists.
+func (s *Store) Get(ctx context.Context, name string) (Flag, bool, error) {
+	return s.backend.Get(ctx, name)
+}
+
+// List returns every flag of the backend.
+func (s *Store) List(ctx context.Context) ([]Flag, error) {
+	return s.backend.List(ctx)
+}
+
+// Save creates or replaces a flag definition.
+func (s *Store) Save(ctx context.Context, flag Flag) error {
+	if flag.Name == "" {
+		return errs.ErrFlagNameEmpty()
+	}
+	return s.backend.Save(ctx, flag)
+}
+
+// Toggle flips the master switch of an existing flag.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - name: The name of the flag.
+//   - enabled: The new state of the master switch.
+//
+// Returns:
+//   - error: An error if the flag does not exist or cannot be saved.
+func (s *Store) Toggle(ctx context.Context, name string, enabled bool) error {
+	flag, ok, err := s.backend.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errs.ErrFlagNotFound(name)
+	}
+	flag.Enabled = enabled
+	return s.backend.Save(ctx, flag)
+}
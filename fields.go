@@ -0,0 +1,478 @@
+package mist
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// fieldsQueryKey is the query parameter used by clients to request a sparse fieldset,
+// for example "?fields=id,name,address.city". The JSON:API-style typed variant uses the
+// same key followed by the resource type in brackets, for example "?fields[articles]=title".
+const fieldsQueryKey = "fields"
+
+// Resource may be implemented by response payload types that want to take part in
+// JSON:API-style typed sparse fieldsets. When a request carries "fields[<type>]=a,b",
+// every value whose ResourceType returns <type> is pruned down to the listed fields,
+// wherever it appears in the response tree.
+type Resource interface {
+	ResourceType() string
+}
+
+// fieldTree is the parsed representation of a field selection. Each key is a JSON field
+// name; a nil subtree means that the whole value of the field is kept, while a non-nil
+// subtree narrows the nested value further.
+type fieldTree map[string]fieldTree
+
+// FieldSet describes which JSON fields of a response should be kept when it is serialized.
+// It is usually obtained from the request through Context.FieldSet or ParseFieldSet and
+// applied with Apply or Context.RespondWithFields.
+//
+// Fields:
+//   - root: The selection that applies to the top-level response value, parsed from the
+//     plain "fields" query parameter. Nested fields are addressed with dots ("a.b.c").
+//   - typed: Selections keyed by resource type, parsed from "fields[<type>]" parameters.
+//     They apply to any value implementing Resource with a matching type.
+type FieldSet struct {
+	root  fieldTree
+	typed map[string]fieldTree
+}
+
+// ParseFieldSet builds a FieldSet from URL query values. Both the flat syntax
+// ("fields=a,b.c") and the JSON:API typed syntax ("fields[users]=name,email") are
+// recognised. Empty entries are ignored, so "fields=a,,b" selects "a" and "b".
+//
+// Parameters:
+//   - query: The parsed URL query of the request.
+//
+// Returns:
+//   - FieldSet: The parsed selection. When no fields were requested the set is empty and
+//     Apply returns values unchanged.
+func ParseFieldSet(query url.Values) FieldSet {
+	var fs FieldSet
+	for key, vals := range query {
+		if key == fieldsQueryKey {
+			fs.root = parseFieldList(fs.root, vals)
+			continue
+		}
+		if strings.HasPrefix(key, fieldsQueryKey+"[") && strings.HasSuffix(key, "]") {
+			typ := key[len(fieldsQueryKey)+1 : len(key)-1]
+			if typ == "" {
+				continue
+			}
+			if fs.typed == nil {
+				fs.typed = make(map[string]fieldTree, 1)
+			}
+			fs.typed[typ] = parseFieldList(fs.typed[typ], vals)
+		}
+	}
+	return fs
+}
+
+// parseFieldList merges comma separated, dot-addressed field lists into the given tree.
+func parseFieldList(tree fieldTree, vals []string) fieldTree {
+	for _, val := range vals {
+		for _, path := range strings.Split(val, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+			if tree == nil {
+				tree = fieldTree{}
+			}
+			cur := tree
+			segs := strings.Split(path, ".")
+			for i, seg := range segs {
+				if seg == "" {
+					break
+				}
+				sub, ok := cur[seg]
+				if i == len(segs)-1 {
+					// The last segment keeps the whole value unless a deeper
+					// selection for the same field has already been recorded.
+					if !ok {
+						cur[seg] = nil
+					}
+					break
+				}
+				if sub == nil {
+					sub = fieldTree{}
+					cur[seg] = sub
+				}
+				cur = sub
+			}
+		}
+	}
+	return tree
+}
+
+// Empty reports whether the FieldSet selects nothing, meaning responses should be
+// serialized in full.
+func (fs FieldSet) Empty() bool {
+	return len(fs.root) == 0 && len(fs.typed) == 0
+}
+
+// Apply prunes val down to the selected fields and returns a value that can be passed to
+// json.Marshal. Structs are inspected through reflection honouring their `json` tags, and
+// the per-type field layout is cached so repeated responses of the same type do not pay
+// the reflection cost again. Maps with string keys, slices and arrays are traversed as
+// well; any other value is returned untouched.
+//
+// Types implementing json.Marshaler or encoding.TextMarshaler are serialized once and pruned
+// in their generic JSON form, which keeps custom encodings intact.
+//
+// Parameters:
+//   - val: The response payload to prune.
+//
+// Returns:
+//   - any: The pruned payload, or val itself when the FieldSet is empty.
+//   - error: An error if a json.Marshaler implementation fails.
+func (fs FieldSet) Apply(val any) (any, error) {
+	if fs.Empty() {
+		return val, nil
+	}
+	return fs.prune(reflect.ValueOf(val), fs.root)
+}
+
+// prune walks v and keeps only the fields listed in tree. A nil tree keeps everything at
+// this level, but traversal continues when typed selections may apply further down.
+func (fs FieldSet) prune(v reflect.Value, tree fieldTree) (any, error) {
+	if tree == nil && len(fs.typed) > 0 {
+		tree = fs.typedTree(v)
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, nil
+	}
+	if tree == nil && len(fs.typed) == 0 {
+		return v.Interface(), nil
+	}
+
+	if v.Type().Implements(marshalerType) || reflect.PointerTo(v.Type()).Implements(marshalerType) ||
+		v.Type().Implements(textMarshalerType) || reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+		if v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+			generic, err := toGenericJSON(v.Interface())
+			if err != nil {
+				return nil, err
+			}
+			return fs.prune(reflect.ValueOf(generic), tree)
+		}
+		return v.Interface(), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		res := make(map[string]any)
+		for _, f := range cachedJSONFields(v.Type()) {
+			sub, selected := tree[f.name]
+			if tree != nil && !selected {
+				continue
+			}
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil {
+				// A nil embedded pointer: encoding/json skips these fields as well.
+				continue
+			}
+			if f.omitEmpty && isEmptyJSONValue(fv) {
+				continue
+			}
+			if f.quoted {
+				quoted, err := quoteJSONValue(fv)
+				if err != nil {
+					return nil, err
+				}
+				res[f.name] = quoted
+				continue
+			}
+			pruned, err := fs.prune(fv, sub)
+			if err != nil {
+				return nil, err
+			}
+			res[f.name] = pruned
+		}
+		return res, nil
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface(), nil
+		}
+		if v.IsNil() {
+			return nil, nil
+		}
+		res := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			sub, selected := tree[key]
+			if tree != nil && !selected {
+				continue
+			}
+			pruned, err := fs.prune(iter.Value(), sub)
+			if err != nil {
+				return nil, err
+			}
+			res[key] = pruned
+		}
+		return res, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), nil
+		}
+		res := make([]any, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			pruned, err := fs.prune(v.Index(i), tree)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = pruned
+		}
+		return res, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// typedTree returns the typed selection for v when v, or a value it points to, implements
+// Resource and the client asked for fields of that resource type.
+func (fs FieldSet) typedTree(v reflect.Value) fieldTree {
+	for v.IsValid() {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return nil
+		}
+		if v.CanInterface() {
+			if res, ok := v.Interface().(Resource); ok {
+				return fs.typed[res.ResourceType()]
+			}
+		}
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			return nil
+		}
+		v = v.Elem()
+	}
+	return nil
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// quoteJSONValue returns the value of a field with the ",string" option the way encoding/json
+// serializes it: its JSON encoding inside a string, or nil for a nil pointer.
+func quoteJSONValue(v reflect.Value) (any, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// toGenericJSON round-trips val through encoding/json, producing maps, slices and scalars.
+func toGenericJSON(val any) (any, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	err = json.Unmarshal(data, &res)
+	return res, err
+}
+
+// jsonField describes a single serialized struct field as seen by encoding/json.
+type jsonField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	quoted    bool // The ",string" option: the value is serialized inside a JSON string.
+	tagged    bool // The name comes from the tag, which wins over untagged fields at equal depth.
+}
+
+// jsonFieldCache maps a reflect.Type to its []jsonField layout.
+var jsonFieldCache sync.Map
+
+// cachedJSONFields returns the JSON layout of struct type t, computing it on first use. The
+// layout follows encoding/json: only untagged embedded structs are flattened, and of several
+// fields under the same name the shallowest wins, or the tagged one at equal depth; a tie
+// leaves none.
+func cachedJSONFields(t reflect.Type) []jsonField {
+	if fields, ok := jsonFieldCache.Load(t); ok {
+		return fields.([]jsonField)
+	}
+	var candidates []jsonField
+	for _, sf := range reflect.VisibleFields(t) {
+		if !promotedToJSON(t, sf.Index) {
+			continue
+		}
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous {
+			// Untagged embedded structs are flattened; reflect.VisibleFields already
+			// reports their promoted fields individually.
+			if name == "" && ft.Kind() == reflect.Struct {
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+		}
+		tagged := name != ""
+		if name == "" {
+			name = sf.Name
+		}
+		candidates = append(candidates, jsonField{
+			name:      name,
+			index:     sf.Index,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+			quoted:    strings.Contains(","+opts+",", ",string,") && quotable(ft),
+			tagged:    tagged,
+		})
+	}
+
+	fields := make([]jsonField, 0, len(candidates))
+	for i, f := range candidates {
+		if dominantJSONField(candidates, f.name) == i {
+			fields = append(fields, f)
+		}
+	}
+	actual, _ := jsonFieldCache.LoadOrStore(t, fields)
+	return actual.([]jsonField)
+}
+
+// promotedToJSON reports whether encoding/json reaches the field at index of t: every embedded
+// field on the way must be an untagged struct, or an exported pointer to one.
+func promotedToJSON(t reflect.Type, index []int) bool {
+	for i := 1; i < len(index); i++ {
+		sf := t.FieldByIndex(index[:i])
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name != "" {
+			return false
+		}
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			if !sf.IsExported() {
+				return false
+			}
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Struct {
+			return false
+		}
+	}
+	return true
+}
+
+// dominantJSONField returns the position of the field encoding/json serializes under name, or
+// -1 when there is none.
+func dominantJSONField(fields []jsonField, name string) int {
+	dominant, tie := -1, false
+	for i, f := range fields {
+		switch {
+		case f.name != name:
+		case dominant < 0 || len(f.index) < len(fields[dominant].index) ||
+			len(f.index) == len(fields[dominant].index) && f.tagged && !fields[dominant].tagged:
+			dominant, tie = i, false
+		case len(f.index) == len(fields[dominant].index) && f.tagged == fields[dominant].tagged:
+			tie = true
+		}
+	}
+	if tie {
+		return -1
+	}
+	return dominant
+}
+
+// quotable reports whether the ",string" option applies to a field of type t.
+func quotable(t reflect.Type) bool {
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	default:
+		return false
+	}
+}
+
+// isEmptyJSONValue mirrors the "omitempty" rules of encoding/json.
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// FieldSet returns the sparse fieldset requested by the client through the "fields" and
+// "fields[<type>]" query parameters.
+//
+// Returns:
+//   - FieldSet: The parsed selection; it is empty when the client did not ask for one.
+func (c *Context) FieldSet() FieldSet {
+	if c.queryValues == nil {
+		c.queryValues = c.Request.URL.Query()
+	}
+	return ParseFieldSet(c.queryValues)
+}
+
+// RespondWithFields behaves like RespondWithJSON but first prunes val according to the
+// sparse fieldset requested by the client, reducing payload sizes for clients that only
+// need a handful of attributes.
+//
+// Example:
+//
+//	// GET /users/42?fields=id,name,address.city
+//	err := c.RespondWithFields(http.StatusOK, user)
+//
+// Parameters:
+//   - status: The HTTP status code of the response.
+//   - val: The payload to prune and serialize.
+//
+// Returns:
+//   - error: An error if pruning or JSON serialization fails.
+func (c *Context) RespondWithFields(status int, val any) error {
+	pruned, err := c.FieldSet().Apply(val)
+	if err != nil {
+		return err
+	}
+	return c.RespondWithJSON(status, pruned)
+}
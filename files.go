@@ -1,14 +1,18 @@
 package mist
 
 import (
-	"github.com/hashicorp/golang-lru"
+	"context"
+	"errors"
+	"github.com/dormoron/mist/internal/errs"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // FileUploader defines a structure used for configuring and handling the upload of files in a web application.
@@ -34,6 +38,22 @@ import (
 //     behavior. This is advantageous when the storage location depends
 //     on specific file characteristics or other request-specific data.
 //
+//   - Scanner Scanner: Scans the uploaded files for malware before they are persisted, e.g.
+//     InitClamAVScanner("tcp", "127.0.0.1:3310"). The upload is written to a temporary file next
+//     to its destination, scanned, and renamed to the destination only when clean. Infected
+//     uploads are rejected with 422 Unprocessable Entity. Nil disables scanning.
+//
+//   - ScanTimeout time.Duration: The time limit of a scan, 30 seconds when zero.
+//
+//   - QuarantineDir string: The directory infected uploads are moved to for analysis. When
+//     empty, infected uploads are deleted.
+//
+//   - ScanFailOpen bool: Persists the uploads the scanner failed to scan, e.g. when the daemon
+//     is down, instead of rejecting them with 503 Service Unavailable.
+//
+//   - OnScan func(*Context, *multipart.FileHeader, ScanResult, error): Receives the outcome of
+//     every scan, e.g. to log infected uploads as security events or to forward them to a SIEM.
+//
 // Example usage of FileUploader:
 //
 //	uploader := &FileUploader{
@@ -51,8 +71,13 @@ import (
 // should be stored. Subsequent steps would typically involve actually storing the file data in the specified
 // location and handling any errors or post-processing tasks as necessary.
 type FileUploader struct {
-	FileField   string
-	DstPathFunc func(*multipart.FileHeader) string
+	FileField     string
+	DstPathFunc   func(*multipart.FileHeader) string
+	Scanner       Scanner
+	ScanTimeout   time.Duration
+	QuarantineDir string
+	ScanFailOpen  bool
+	OnScan        func(ctx *Context, fileHeader *multipart.FileHeader, res ScanResult, err error)
 }
 
 // Handle returns a HandleFunc specifically prepared to process file upload requests based on the configuration
@@ -109,6 +134,11 @@ func (f *FileUploader) Handle() HandleFunc {
 			ctx.RespData = []byte("Upload failure" + err.Error())
 			return
 		}
+		// Scan the upload before it reaches its destination when a scanner is configured.
+		if f.Scanner != nil {
+			f.scanAndStore(ctx, file, fileHeader, dst)
+			return
+		}
 		// Open (or create) the destination file for writing with the appropriate permissions.
 		dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o666)
 		// If the destination file cannot be opened, respond with a server error.
@@ -133,6 +163,67 @@ func (f *FileUploader) Handle() HandleFunc {
 	}
 }
 
+// scanAndStore writes an upload to a temporary file next to its destination, scans it and
+// renames it to the destination when clean, or quarantines it.
+func (f *FileUploader) scanAndStore(ctx *Context, file multipart.File, fileHeader *multipart.FileHeader, dst string) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("Upload failure" + err.Error())
+		return
+	}
+	stored := false
+	defer func() {
+		if !stored {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	_, err = io.Copy(tmp, file)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("Upload failure" + err.Error())
+		return
+	}
+
+	timeout := f.ScanTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	scanCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+	res, err := f.Scanner.Scan(scanCtx, tmp.Name())
+	cancel()
+	if f.OnScan != nil {
+		f.OnScan(ctx, fileHeader, res, err)
+	}
+	switch {
+	case err != nil && !f.ScanFailOpen:
+		ctx.RespStatusCode = http.StatusServiceUnavailable
+		ctx.RespData = []byte("Upload failure: the file could not be scanned")
+		return
+	case err == nil && !res.Clean:
+		if f.QuarantineDir != "" {
+			name := time.Now().UTC().Format("20060102T150405.000000000") + "-" + filepath.Base(dst)
+			stored = os.Rename(tmp.Name(), filepath.Join(f.QuarantineDir, name)) == nil
+		}
+		ctx.RespStatusCode = http.StatusUnprocessableEntity
+		ctx.RespData = []byte("Upload rejected: the file is infected")
+		return
+	}
+	// CreateTemp restricts the file to its owner; make it readable like other uploads.
+	_ = os.Chmod(tmp.Name(), 0o644)
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("Upload failure" + err.Error())
+		return
+	}
+	stored = true
+	ctx.RespStatusCode = http.StatusOK
+	ctx.RespData = []byte("Upload success")
+}
+
 // FileDownloader is a structure that encapsulates the necessary
 // information for handling file download operations in a web application setting.
 // The struct is designed to provide a foundation for methods that allow users to download
@@ -310,20 +401,20 @@ type StaticResourceHandlerOption func(handler *StaticResourceHandler)
 //   - dir string: The root directory from where the static resources will be served. This should be
 //     an absolute path to ensure correct file resolution. When a request comes in for a
 //     static resource, the handler will use this directory to look up and serve the files.
-//   - cache *lru.Cache: An LRU (Least Recently Used) cache used to store and retrieve the most
-//     recently accessed static files quickly. The caching mechanism improves
-//     the performance of the web server by reducing the number of disk reads.
-//     The 'lru.Cache' refers to an in-memory key-value store where the key is typically
-//     the file path or name, and the value is the file's content.
+//   - cache *StaticCache: A cache bounded in bytes holding the most recently accessed static files,
+//     keyed by file name. The caching mechanism improves the performance of the web server by
+//     reducing the number of reads from the backend.
 //   - extContentTypeMap map[string]string: A map associating file extensions with their corresponding MIME
 //     content type. This mapping allows the server to set the appropriate
 //     'Content-Type' header in HTTP responses based on the requested
 //     file's extension. For example, it might map ".css" to "text/css"
 //     and ".png" to "image/png".
-//   - maxSize int: The maximum size of a file, in bytes, that the handler will serve. Requests for files
-//     larger than this size will result in an error, preventing the server from consuming
-//     excessive resources when serving large files. This is a safeguard to help maintain
-//     server performance and stability.
+//   - maxSize int: The maximum size of a file, in bytes, that the handler will cache. Larger files
+//     are streamed from the backend on every request instead of being held in memory.
+//   - backend StaticBackend: The storage the files are read from; a FileBackend reading dir unless
+//     StaticWithBackend sets another one, such as an S3Backend.
+//   - redirect time.Duration: The validity of the signed URLs clients are redirected to in place
+//     of being served the files; zero serves the files.
 //
 // The StaticResourceHandler struct requires careful initialization to ensure it has access to the correct
 // directory and that the cache and content type map are adequately configured. It can be used in standalone
@@ -335,14 +426,16 @@ type StaticResourceHandlerOption func(handler *StaticResourceHandler)
 // web application's overall performance strategy.
 type StaticResourceHandler struct {
 	dir               string
-	cache             *lru.Cache
+	cache             *StaticCache
 	extContentTypeMap map[string]string
 	maxSize           int
+	backend           StaticBackend
+	redirect          time.Duration
 }
 
 // InitStaticResourceHandler initializes and returns a pointer to a StaticResourceHandler
 // with the provided directory path and applies any given configuration options. The function
-// also establishes an LRU (Least Recently Used) cache with a default maximum capacity to
+// also establishes a StaticCache with a default byte budget to
 // optimize the serving of static files. This function centralizes the setup logic for creating
 // a StaticResourceHandler, ensuring that the handler is properly initialized and configured before
 // use.
@@ -359,14 +452,13 @@ type StaticResourceHandler struct {
 //   - *StaticResourceHandler: A pointer to the newly-created configured StaticResourceHandler ready to
 //     serve static files.
 //   - error: An error that may have occurred during the creation or configuration of the
-//     StaticResourceHandler. If the error is not nil, it usually indicates a problem with
-//     setting up the internal LRU cache.
+//     StaticResourceHandler. If the error is not nil, it indicates a redirect mode set with a
+//     backend unable to sign URLs.
 //
 // Internal Initialization Steps:
-//  1. The function creates an LRU cache with a default size of 1000 cache entries. If the cache
-//     cannot be created, the function immediately returns nil and the error.
+//  1. The function creates a StaticCache with a budget of 64 megabytes whose entries never expire.
 //  2. A StaticResourceHandler struct instance is instantiated with the given directory path and the
-//     newly created LRU cache.
+//     newly created cache.
 //  3. Default file size limit for serving files is set to 1 megabyte (1024 * 1024 bytes).
 //  4. A default extension to content type mapping is established for common file formats to ensure
 //     correct 'Content-Type' headers in HTTP responses.
@@ -389,15 +481,11 @@ type StaticResourceHandler struct {
 //
 // // Now handler can be used to serve static resources with the specified configurations.
 func InitStaticResourceHandler(dir string, opts ...StaticResourceHandlerOption) (*StaticResourceHandler, error) {
-	// Create a new LRU cache instance with default capacity.
-	c, err := lru.New(1000)
-	if err != nil {
-		return nil, err // Return the error if cache creation fails.
-	}
 	// Instantiate the StaticResourceHandler struct with default values.
 	res := &StaticResourceHandler{
 		dir:     dir,
-		cache:   c,
+		cache:   InitStaticCache(64 << 20), // Default budget of 64 megabytes.
+		backend: InitFileBackend(dir),
 		maxSize: 1024 * 1024, // Default max file size of 1 megabyte.
 		// Set up default file extension to MIME type mappings.
 		extContentTypeMap: map[string]string{
@@ -412,6 +500,9 @@ func InitStaticResourceHandler(dir string, opts ...StaticResourceHandlerOption)
 	for _, opt := range opts {
 		opt(res)
 	}
+	if _, ok := res.backend.(StaticURLSigner); res.redirect > 0 && !ok {
+		return nil, errs.ErrStaticRedirectUnsupported()
+	}
 	// Return the configured handler ready for use.
 	return res, nil
 }
@@ -458,45 +549,28 @@ func StaticWithMaxFileSize(maxSize int) StaticResourceHandlerOption {
 }
 
 // StaticWithCache returns a StaticResourceHandlerOption that assigns a custom
-// LRU (Least Recently Used) cache to a StaticResourceHandler. The provided *lru.Cache
-// replaces the default cache, allowing for higher flexibility in how caching is configured
-// for the static file handler. This is particularly useful for fine-tuning the cache size
-// or sharing a cache instance among multiple handlers.
+// StaticCache to a StaticResourceHandler, replacing the default one. This is useful to set
+// the byte budget, the TTL and the stale-while-revalidate window of the cache, to keep a
+// reference to it for flushing entries and reading its statistics, or to share it among
+// handlers serving the same files.
 //
 // Parameters:
-//   - c *lru.Cache: A pointer to the lru.Cache instance that should be used by the
-//     StaticResourceHandler. This parameter allows the user to specify the
-//     exact cache instance, including its size and eviction policies, which
-//     will be integrated into the static resource serving process.
+//   - c *StaticCache: The cache of the handler.
 //
 // Returns:
-//   - StaticResourceHandlerOption: A closure function that accepts a *StaticResourceHandler
-//     as its parameter. When executed, this option function sets
-//     the StaticResourceHandler's internal cache pointer to the
-//     provided *lru.Cache instance.
-//
-// This configuration option is valuable when performance optimization is needed or when
-// different caching strategies are tested. It provides the ability to swap in a custom cache
-// with a pre-defined configuration without altering the existing flow of the handler's initialization.
+//   - StaticResourceHandlerOption: A closure function that sets the StaticResourceHandler's
+//     internal cache pointer to the provided cache.
 //
 // Example Usage:
-// To use a previously configured lru.Cache with a capacity of 500 items in a new StaticResourceHandler,
-// invoke StaticWithCache like this:
-//
-// existingCache, _ := lru.New(500) // Create an lru.Cache with a capacity for 500 items.
-// handler, err := InitStaticResourceHandler("/static", StaticWithCache(existingCache))
 //
+//	cache := InitStaticCache(256 << 20).SetTTL(time.Minute).SetStaleWhileRevalidate(time.Hour)
+//	handler, err := InitStaticResourceHandler("", StaticWithBackend(backend), StaticWithCache(cache))
 //	if err != nil {
 //	    // handle error
 //	}
-//
-// This allows the new StaticResourceHandler to utilize the existingCache for caching static
-// files, providing a customized caching strategy as per the application's requirements.
-//
-// Adopting a feature-rich cache can significantly reduce IO operations against the disk and
-// improve the serving speed of static files, leading to better application performance and
-// scalability. The option to set a custom cache is a direct way to control these aspects.
-func StaticWithCache(c *lru.Cache) StaticResourceHandlerOption {
+//	// After a deployment:
+//	cache.Flush("app.")
+func StaticWithCache(c *StaticCache) StaticResourceHandlerOption {
 	return func(handler *StaticResourceHandler) {
 		handler.cache = c // Assign the provided cache to the handler.
 	}
@@ -555,28 +629,68 @@ func StaticWithExtension(extMap map[string]string) StaticResourceHandlerOption {
 	}
 }
 
+// StaticWithBackend returns a StaticResourceHandlerOption serving the files from a backend in
+// place of the directory of the handler, e.g. a bucket of object storage. Files up to the
+// maximum file size are still cached in memory; give the cache a TTL, with StaticWithCache,
+// when the objects may change.
+//
+// Example:
+//
+//	backend := InitS3Backend("assets", "eu-west-1", accessKeyID, secretAccessKey)
+//	cache := InitStaticCache(64 << 20).SetTTL(time.Minute)
+//	handler, err := InitStaticResourceHandler("", StaticWithBackend(backend), StaticWithCache(cache))
+//
+// Parameters:
+//   - backend StaticBackend: The storage of the files.
+//
+// Returns:
+//   - StaticResourceHandlerOption: The option setting the backend.
+func StaticWithBackend(backend StaticBackend) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.backend = backend
+	}
+}
+
+// StaticWithRedirect returns a StaticResourceHandlerOption redirecting clients to a signed
+// URL of the file, e.g. a presigned S3 URL, so that the bytes are served by the storage
+// instead of being proxied by the server. The backend must implement StaticURLSigner, or
+// InitStaticResourceHandler fails. The redirects may be cached by clients for half the
+// validity of the URLs.
+//
+// Parameters:
+//   - expires time.Duration: The validity of the signed URLs.
+//
+// Returns:
+//   - StaticResourceHandlerOption: The option enabling the redirect mode.
+func StaticWithRedirect(expires time.Duration) StaticResourceHandlerOption {
+	return func(handler *StaticResourceHandler) {
+		handler.redirect = expires
+	}
+}
+
 // Handle takes a Context pointer and serves static files based on the request's path.
 // It attempts to retrieve and serve the requested file, handling various error scenarios
-// gracefully. It sets appropriate HTTP response status codes and headers, leveraging an LRU cache
+// gracefully. It sets appropriate HTTP response status codes and headers, leveraging its StaticCache
 // for performance optimization when possible.
 //
 // The method logic is as follows:
 //  1. It extracts the requested 'file' from the context's PathValue.
 //  2. If there's an error in retrieving the file (e.g., malformed request path),
 //     it sends a 400 Bad Request status and a "Request path error" message.
-//  3. If the file can be retrieved, it constructs a full file path using the provided
-//     directory path and the file's name.
-//  4. The file extension is extracted to determine the correct content type from the handler's
-//     extension to MIME type mapping (extContentTypeMap).
-//  5. If the file's data is found in the cache, it uses this data to set the response headers
-//     and body, sending a 200 OK status code.
-//  6. If not cached, it reads the file from disk using os.ReadFile.
-//  7. If there's an error reading the file (e.g., file not found, permissions issue), it sets
-//     a 500 Internal Server Error status code and a "Server error" message.
-//  8. It checks if the file size is within the allowed maximum size (s.maxSize).
-//     If it is, the function adds the file's data to the cache.
-//  9. Lastly, it sets the correct "Content-Type" and "Content-Length" headers and sends the file data
-//     with a 200 OK status.
+//  3. In redirect mode, it redirects the client to a signed URL of the file with 302 Found.
+//  4. If the file's data is found in the cache and has not expired, it serves it. Files expired
+//     within the stale-while-revalidate window of the cache are served as well, while a
+//     background request revalidates them.
+//  5. Otherwise it reads the file from the backend. The conditional headers of the request, or
+//     the entity tag of an expired cached copy, are passed on so that the backend can answer
+//     "not modified" without sending the content.
+//  6. A missing file gets 404 Not Found, and a backend failure 500 Internal Server Error with
+//     a "Server error" message.
+//  7. Files within the maximum size (s.maxSize) are read into the cache; larger ones are
+//     streamed to the client.
+//  8. Lastly, it sets the "Content-Type", "ETag" and "Last-Modified" headers and sends the file
+//     data with 200 OK, or 304 Not Modified when the request's If-None-Match or
+//     If-Modified-Since header matches the file.
 //
 // Parameters:
 //   - ctx *Context: A pointer to the Context object which contains information about the HTTP request
@@ -588,16 +702,12 @@ func StaticWithExtension(extMap map[string]string) StaticResourceHandlerOption {
 // threshold before caching the data.
 //
 // Example Usage:
-// Assuming 'handler' is an instance of StaticResourceHandler with a configured directory and cache,
-// the Handle method would be attached to a web server route like so:
-//
-//	http.Handle("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-//	    ctx := NewContext(r, w)
-//	    handler.Handle(ctx)
-//	}))
 //
-// This specifies that all requests to '/static/' should be handled by the Handle method of 'handler',
-// which will serve the files as static resources.
+//	handler, err := InitStaticResourceHandler("/var/www/static")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	server.GET("/static/:file", handler.Handle)
 func (s *StaticResourceHandler) Handle(ctx *Context) {
 	file, err := ctx.PathValue("file").String()
 	if err != nil {
@@ -606,33 +716,201 @@ func (s *StaticResourceHandler) Handle(ctx *Context) {
 		ctx.RespData = []byte("Request path error")
 		return
 	}
-	dst := filepath.Join(s.dir, file)
-	ext := filepath.Ext(dst)[1:]
-	header := ctx.ResponseWriter.Header()
-	if data, ok := s.cache.Get(file); ok {
+	if s.redirect > 0 {
+		s.redirectTo(ctx, file)
+		return
+	}
+
+	entry, state := s.cache.get(file)
+	switch state {
+	case staticCacheFresh:
 		// Serve content from cache if available.
-		header.Set("Content-Type", s.extContentTypeMap[ext])
-		header.Set("Content-Length", strconv.Itoa(len(data.([]byte))))
-		ctx.RespStatusCode = http.StatusOK
-		ctx.RespData = data.([]byte)
+		s.serve(ctx, entry)
+		return
+	case staticCacheStale:
+		// Serve the stale copy while a single request revalidates it.
+		go s.refresh(file, entry)
+		s.serve(ctx, entry)
 		return
 	}
 
-	data, err := os.ReadFile(dst)
+	cond := make(http.Header)
+	if entry != nil {
+		// Revalidate the expired copy rather than reading the file again.
+		cond.Set("If-None-Match", entry.etag)
+	} else {
+		cond.Set("If-None-Match", ctx.Request.Header.Get("If-None-Match"))
+		cond.Set("If-Modified-Since", ctx.Request.Header.Get("If-Modified-Since"))
+	}
+	obj, err := s.backend.Open(ctx.Request.Context(), file, cond)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			s.cache.drop(file)
+			ctx.RespStatusCode = http.StatusNotFound
+			ctx.RespData = []byte("File not found")
+			return
+		}
 		// Error handling: Internal server error due to file read issues.
 		ctx.RespStatusCode = http.StatusInternalServerError
 		ctx.RespData = []byte("Server error")
 		return
 	}
+	if obj.NotModified {
+		if entry != nil {
+			s.cache.add(file, entry, obj.MaxAge)
+			s.serve(ctx, entry)
+			return
+		}
+		// The client has the file.
+		s.serve(ctx, &staticEntry{etag: obj.ETag, modTime: obj.ModTime})
+		return
+	}
 
+	fresh := &staticEntry{etag: obj.ETag, modTime: obj.ModTime, contentType: s.contentType(file, obj.ContentType)}
 	// Caching file data if it's within the maximum allowed size.
+	if obj.Size >= 0 && obj.Size <= int64(s.maxSize) {
+		fresh.data, err = s.read(file, obj)
+		if err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			ctx.RespData = []byte("Server error")
+			return
+		}
+		s.serve(ctx, fresh)
+		return
+	}
+	s.cache.drop(file)
+	if s.setValidators(ctx, fresh) {
+		obj.Body.Close()
+		return
+	}
+	_ = ctx.RespondReader(http.StatusOK, fresh.contentType, obj.Body, obj.Size)
+}
+
+// Cache returns the cache of the handler, e.g. to flush entries or read its statistics.
+func (s *StaticResourceHandler) Cache() *StaticCache {
+	return s.cache
+}
+
+// refresh revalidates a stale cached file in the background. Missing files are dropped from the
+// cache; when the backend fails, the stale copy is served until the next revalidation.
+func (s *StaticResourceHandler) refresh(file string, entry *staticEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	obj, err := s.backend.Open(ctx, file, http.Header{"If-None-Match": {entry.etag}})
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		s.cache.drop(file)
+	case err != nil:
+		s.cache.release(file)
+	case obj.NotModified:
+		s.cache.add(file, entry, obj.MaxAge)
+	case obj.Size >= 0 && obj.Size <= int64(s.maxSize):
+		if _, err := s.read(file, obj); err != nil {
+			s.cache.release(file)
+		}
+	default:
+		obj.Body.Close()
+		s.cache.drop(file)
+	}
+}
+
+// read reads the content of a file and caches it when it is within the maximum size.
+func (s *StaticResourceHandler) read(file string, obj *StaticObject) ([]byte, error) {
+	defer obj.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(obj.Body, int64(s.maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
 	if len(data) <= s.maxSize {
-		s.cache.Add(file, data)
+		s.cache.add(file, &staticEntry{
+			data:        data,
+			etag:        obj.ETag,
+			modTime:     obj.ModTime,
+			contentType: s.contentType(file, obj.ContentType),
+		}, obj.MaxAge)
+	} else {
+		s.cache.drop(file)
 	}
-	// Serving the file content with the correct headers.
-	header.Set("Content-Type", s.extContentTypeMap[ext])
-	header.Set("Content-Length", strconv.Itoa(len(data)))
+	return data, nil
+}
+
+// serve serves a file read into memory, or 304 Not Modified when the client has it. Revalidated
+// entries without data only answer conditional requests.
+func (s *StaticResourceHandler) serve(ctx *Context, entry *staticEntry) {
+	if s.setValidators(ctx, entry) {
+		return
+	}
+	if entry.data == nil {
+		// The backend found the copy of the client current.
+		ctx.RespStatusCode = http.StatusNotModified
+		return
+	}
+	header := ctx.ResponseWriter.Header()
+	header.Set("Content-Type", entry.contentType)
+	header.Set("Content-Length", strconv.Itoa(len(entry.data)))
 	ctx.RespStatusCode = http.StatusOK
-	ctx.RespData = data
+	ctx.RespData = entry.data
+}
+
+// setValidators sets the ETag and Last-Modified headers of a file, and answers 304 Not Modified
+// when the request's conditional headers match them, reporting whether it did.
+func (s *StaticResourceHandler) setValidators(ctx *Context, entry *staticEntry) bool {
+	header := ctx.ResponseWriter.Header()
+	if entry.etag != "" {
+		header.Set("ETag", entry.etag)
+	}
+	if !entry.modTime.IsZero() {
+		header.Set("Last-Modified", entry.modTime.UTC().Format(http.TimeFormat))
+	}
+	if !notModified(ctx.Request, entry.etag, entry.modTime) {
+		return false
+	}
+	ctx.RespStatusCode = http.StatusNotModified
+	ctx.RespData = nil
+	return true
+}
+
+// redirectTo redirects the client to a signed URL of a file.
+func (s *StaticResourceHandler) redirectTo(ctx *Context, file string) {
+	target, err := s.backend.(StaticURLSigner).SignedURL(file, s.redirect)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		ctx.RespData = []byte("Server error")
+		return
+	}
+	// The redirect must not outlive the URL it points to.
+	ctx.ResponseWriter.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(s.redirect/2/time.Second)))
+	ctx.ResponseWriter.Header().Set("Location", target)
+	ctx.RespStatusCode = http.StatusFound
+}
+
+// contentType returns the media type of a file: the one mapped to its extension, or the one
+// stored by the backend.
+func (s *StaticResourceHandler) contentType(file string, stored string) string {
+	if contentType, ok := s.extContentTypeMap[strings.TrimPrefix(filepath.Ext(file), ".")]; ok {
+		return contentType
+	}
+	return stored
+}
+
+// notModified reports whether the conditional headers of a GET or HEAD request match a file,
+// If-None-Match taking precedence over If-Modified-Since.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.IsZero() && !modTime.Truncate(time.Second).After(since)
 }
@@ -0,0 +1,46 @@
+package mist
+
+// FlagEvaluator decides whether a feature flag is enabled for a request. The featureflags
+// package provides the standard implementation; it is plugged into the server with
+// ServerWithFeatureFlags and consulted through Context.FlagEnabled.
+type FlagEvaluator interface {
+	// FlagEnabled reports whether the named flag is enabled for the request of ctx.
+	FlagEnabled(ctx *Context, name string) bool
+}
+
+// ServerWithFeatureFlags is a configuration function that returns an HTTPServerOption.
+// It sets the evaluator answering Context.FlagEnabled for every request of the server.
+//
+// Parameters:
+//   - evaluator: The feature flag evaluator, e.g. a *featureflags.Flags.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified evaluator.
+func ServerWithFeatureFlags(evaluator FlagEvaluator) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.flags = evaluator
+	}
+}
+
+// FlagEnabled reports whether the named feature flag is enabled for the current request.
+// Flags are always disabled when the server has no feature flag evaluator.
+//
+// Example:
+//
+//	if ctx.FlagEnabled("new-checkout") {
+//	    newCheckout(ctx)
+//	    return
+//	}
+//	legacyCheckout(ctx)
+//
+// Parameters:
+//   - name: The name of the flag.
+//
+// Returns:
+//   - bool: true if the flag is enabled for the request.
+func (c *Context) FlagEnabled(name string) bool {
+	if c.flags == nil {
+		return false
+	}
+	return c.flags.FlagEnabled(c, name)
+}
@@ -0,0 +1,105 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/internal/errs"
+	"net/http"
+)
+
+// Levels of flash messages, usable as CSS classes by templates.
+const (
+	FlashInfo    = "info"
+	FlashSuccess = "success"
+	FlashWarning = "warning"
+	FlashError   = "error"
+)
+
+// Flash is a one-time message shown to a user on the next page they see, such as the outcome
+// of a form submission.
+type Flash struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// FlashStore keeps the flash messages of a client until the request displaying them. The
+// session package provides a store backed by sessions.
+type FlashStore interface {
+	// Add appends a message to the pending messages of the client.
+	Add(ctx *Context, flash Flash) error
+	// Take returns the pending messages of the client and removes them.
+	Take(ctx *Context) ([]Flash, error)
+}
+
+// ServerWithFlashStore is a configuration function that returns an HTTPServerOption. It sets
+// the store of the flash messages added with Context.AddFlash and Context.RedirectWithFlash.
+//
+// Parameters:
+//   - store: The store of the flash messages, e.g. session.InitFlashStore(manager).
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified store.
+func ServerWithFlashStore(store FlashStore) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.flashStore = store
+	}
+}
+
+// AddFlash adds a flash message for the next page shown to the client.
+//
+// Parameters:
+//   - level: The level of the message, e.g. FlashSuccess.
+//   - msg: The message.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrNoFlashStore if the server has no flash store, or the
+//     error of the store.
+func (c *Context) AddFlash(level string, msg string) error {
+	if c.flashStore == nil {
+		return errs.ErrNoFlashStore()
+	}
+	return c.flashStore.Add(c, Flash{Level: level, Message: msg})
+}
+
+// Flashes returns the pending flash messages of the client, for the template of the page
+// displaying them. They are removed from the store on the first call, later calls for the same
+// request return them again.
+//
+// Example:
+//
+//	_ = ctx.Render("orders.html", map[string]any{"Flashes": ctx.Flashes(), "Orders": orders})
+//
+//	{{range .Flashes}}<div class="flash {{.Level}}">{{.Message}}</div>{{end}}
+//
+// Returns:
+//   - []Flash: The messages, oldest first; nil when there are none or the store failed.
+func (c *Context) Flashes() []Flash {
+	if !c.flashesTaken && c.flashStore != nil {
+		c.flashes, _ = c.flashStore.Take(c)
+		c.flashesTaken = true
+	}
+	return c.flashes
+}
+
+// RedirectWithFlash implements the post/redirect/get pattern: it adds a flash message and
+// redirects the client with 303 See Other, so that the page it lands on shows the message and
+// reloading that page does not submit the form again.
+//
+// Example:
+//
+//	server.POST("/orders", func(ctx *mist.Context) {
+//	    // ... create the order ...
+//	    _ = ctx.RedirectWithFlash("/orders", mist.FlashSuccess, "Your order was placed.")
+//	})
+//
+// Parameters:
+//   - url: The URL to redirect to.
+//   - level: The level of the message, e.g. FlashSuccess.
+//   - msg: The message.
+//
+// Returns:
+//   - error: An error if the message could not be stored; the client is redirected anyway.
+func (c *Context) RedirectWithFlash(url string, level string, msg string) error {
+	err := c.AddFlash(level, msg)
+	c.Header("Location", url)
+	c.RespStatusCode = http.StatusSeeOther
+	return err
+}
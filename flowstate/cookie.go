@@ -0,0 +1,99 @@
+package flowstate
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"time"
+)
+
+// CookieStore keeps the state of flows in cookies, encrypted and authenticated with AES-GCM.
+// The name of the flow and the expiry are sealed with the state, so that a cookie cannot be
+// replayed for another flow or past its lifetime. Take clears the cookie, so the browser sends
+// it once; a copy of the cookie captured before remains usable until it expires, which
+// ServerStore prevents.
+type CookieStore struct {
+	aead cipher.AEAD
+	cookieOptions
+}
+
+// InitCookieStore creates a CookieStore. Its cookies are named "mist_flow_{flow}", scoped to
+// every path, secure, HttpOnly and SameSite=Lax.
+//
+// Parameters:
+//   - key: The AES key, of 16, 24 or 32 bytes, shared by every instance of the application.
+//
+// Returns:
+//   - *CookieStore: The initialized store.
+//   - error: An error if the key has an invalid size.
+func InitCookieStore(key []byte) (*CookieStore, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CookieStore{aead: aead, cookieOptions: defaultCookieOptions()}, nil
+}
+
+// SetCookiePrefix sets the prefix of the cookie names, followed by the name of the flow.
+func (s *CookieStore) SetCookiePrefix(prefix string) *CookieStore {
+	s.prefix = prefix
+	return s
+}
+
+// SetCookiePath sets the path and domain the cookies are scoped to; "" leaves the domain to
+// the host of the request.
+func (s *CookieStore) SetCookiePath(path string, domain string) *CookieStore {
+	s.path = path
+	s.domain = domain
+	return s
+}
+
+// SetSecure sets whether the cookies are only sent over HTTPS, e.g. false for local
+// development over HTTP.
+func (s *CookieStore) SetSecure(secure bool) *CookieStore {
+	s.secure = secure
+	return s
+}
+
+// Save seals the state and its expiry in the cookie of the flow.
+func (s *CookieStore) Save(ctx *mist.Context, flow string, value []byte, ttl time.Duration) error {
+	plain := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(value)), uint64(time.Now().Add(ttl).Unix()))
+	plain = append(plain, value...)
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plain)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, []byte(flow))
+	ctx.SetCookie(s.cookie(flow, base64.RawURLEncoding.EncodeToString(sealed), ttl))
+	return nil
+}
+
+// Take opens the cookie of the flow and clears it. Cookies that were altered, sealed for
+// another flow or with another key are reported as missing.
+func (s *CookieStore) Take(ctx *mist.Context, flow string) ([]byte, error) {
+	encoded, ok := s.take(ctx, flow)
+	if !ok {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	size := s.aead.NonceSize()
+	if err != nil || len(sealed) < size {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	plain, err := s.aead.Open(nil, sealed[:size], sealed[size:], []byte(flow))
+	if err != nil || len(plain) < 8 {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	if time.Now().Unix() >= int64(binary.BigEndian.Uint64(plain)) {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	return plain[8:], nil
+}
@@ -0,0 +1,93 @@
+// Package flowstate keeps the transient state of multi-step flows between their requests, such
+// as the state and PKCE verifier of an OAuth authorization, a pending email confirmation or a
+// checkout handed to a payment provider. State is short-lived and single-use: it expires on its
+// own and reading it removes it, so that a completed step cannot be replayed.
+//
+// Two stores are provided: CookieStore keeps the state in the browser, encrypted and bound to
+// its flow, and ServerStore keeps it in a Backend, in memory or in Redis, behind a random
+// cookie. The OAuth helpers build on either:
+//
+//	store, err := flowstate.InitCookieStore(key)
+//	server.GET("/login", func(ctx *mist.Context) {
+//	    auth, err := flowstate.BeginOAuth(ctx, store, 10*time.Minute)
+//	    ...
+//	    ctx.Header("Location", provider+"?state="+auth.State+"&code_challenge="+auth.CodeChallenge+...)
+//	    ctx.RespStatusCode = http.StatusFound
+//	})
+//	server.GET("/callback", func(ctx *mist.Context) {
+//	    verifier, err := flowstate.CompleteOAuth(ctx, store)
+//	    ...
+//	})
+package flowstate
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"github.com/dormoron/mist"
+	"net/http"
+	"time"
+)
+
+// Store keeps the transient state of flows. Flow names are used in cookie names: they are
+// made of letters, digits and "-_." only.
+type Store interface {
+	// Save stores the state of a flow for ttl, replacing any pending state of the same flow.
+	Save(ctx *mist.Context, flow string, value []byte, ttl time.Duration) error
+	// Take returns the state of a flow and removes it. State that is missing, expired or
+	// already taken yields an error wrapping errors.ErrFlowStateNotFound.
+	Take(ctx *mist.Context, flow string) ([]byte, error)
+}
+
+// cookieOptions holds the attributes of the cookies set by the stores.
+type cookieOptions struct {
+	prefix string
+	path   string
+	domain string
+	secure bool
+}
+
+// defaultCookieOptions returns the default cookie attributes: cookies named "mist_flow_{flow}",
+// on every path, secure.
+func defaultCookieOptions() cookieOptions {
+	return cookieOptions{prefix: "mist_flow_", path: "/", secure: true}
+}
+
+// cookie creates a cookie of the store. The cookies are HttpOnly and SameSite=Lax, so that they
+// are sent along the top-level redirects coming back from third parties, such as an OAuth
+// provider, but not with cross-site subrequests.
+func (o cookieOptions) cookie(flow string, value string, ttl time.Duration) *http.Cookie {
+	ck := &http.Cookie{
+		Name:     o.prefix + flow,
+		Value:    value,
+		Path:     o.path,
+		Domain:   o.domain,
+		Secure:   o.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if ttl > 0 {
+		ck.MaxAge = int((ttl + time.Second - 1) / time.Second)
+	} else {
+		ck.MaxAge = -1
+	}
+	return ck
+}
+
+// take reads the cookie of a flow and clears it on the client.
+func (o cookieOptions) take(ctx *mist.Context, flow string) (string, bool) {
+	ck, err := ctx.Request.Cookie(o.prefix + flow)
+	if err != nil {
+		return "", false
+	}
+	ctx.SetCookie(o.cookie(flow, "", 0))
+	return ck.Value, true
+}
+
+// randomToken returns a URL-safe random token of 256 bits.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
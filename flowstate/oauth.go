@@ -0,0 +1,86 @@
+package flowstate
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"strings"
+	"time"
+)
+
+// oauthFlow is the prefix of the flow names of OAuth authorizations, followed by their state.
+const oauthFlow = "oauth_"
+
+// OAuthAuthorization holds the parameters to send to the authorization endpoint of an OAuth
+// 2.0 provider.
+type OAuthAuthorization struct {
+	// State is the value of the "state" parameter, protecting the callback against CSRF.
+	State string
+	// CodeChallenge is the value of the "code_challenge" parameter (RFC 7636).
+	CodeChallenge string
+	// CodeChallengeMethod is the value of the "code_challenge_method" parameter, "S256".
+	CodeChallengeMethod string
+}
+
+// BeginOAuth starts an OAuth 2.0 authorization code flow with PKCE: it generates the state and
+// the code verifier, and stores them so that CompleteOAuth can check the callback and return
+// the verifier. Each authorization is stored under its own state, so that a user can run
+// several at once, e.g. from two tabs.
+//
+// Parameters:
+//   - ctx: The context of the request starting the flow.
+//   - store: The store keeping the verifier until the callback.
+//   - ttl: How long the user has to complete the authorization, e.g. 10 minutes.
+//
+// Returns:
+//   - *OAuthAuthorization: The parameters of the authorization request.
+//   - error: An error if the randomness source or the store failed.
+func BeginOAuth(ctx *mist.Context, store Store, ttl time.Duration) (*OAuthAuthorization, error) {
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	if err = store.Save(ctx, oauthFlow+state, []byte(state+"."+verifier), ttl); err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	return &OAuthAuthorization{
+		State:               state,
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(challenge[:]),
+		CodeChallengeMethod: "S256",
+	}, nil
+}
+
+// CompleteOAuth checks the callback of an authorization started with BeginOAuth against the
+// state it stored, and returns the code verifier to send with the code to the token endpoint.
+// The stored state is removed: a callback succeeds once.
+//
+// Parameters:
+//   - ctx: The context of the callback request, carrying the "state" query parameter.
+//
+// Returns:
+//   - string: The code verifier.
+//   - error: An error wrapping errors.ErrFlowStateNotFound when the state is unknown, expired
+//     or already used, or errors.ErrVerificationFailed when it does not match.
+func CompleteOAuth(ctx *mist.Context, store Store) (string, error) {
+	state := ctx.QueryValue("state").StringOrDefault("")
+	if state == "" {
+		return "", errs.ErrFlowStateNotFound(oauthFlow)
+	}
+	value, err := store.Take(ctx, oauthFlow+state)
+	if err != nil {
+		return "", err
+	}
+	stored, verifier, ok := strings.Cut(string(value), ".")
+	if !ok || subtle.ConstantTimeCompare([]byte(stored), []byte(state)) != 1 {
+		return "", errs.ErrVerificationFailed(errors.New("oauth state mismatch"))
+	}
+	return verifier, nil
+}
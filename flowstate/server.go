@@ -0,0 +1,185 @@
+package flowstate
+
+import (
+	"context"
+	"errors"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// Backend stores the state of ServerStore.
+type Backend interface {
+	// Put stores value under key for ttl.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Take atomically returns and deletes the value of key, nil when there is none.
+	Take(ctx context.Context, key string) ([]byte, error)
+}
+
+// ServerStore keeps the state of flows in a Backend, under a random identifier sent to the
+// browser in the cookie of the flow. The backend deletes the state as it is read, so that it
+// is used at most once even if the cookie was copied.
+type ServerStore struct {
+	backend Backend
+	cookieOptions
+}
+
+// InitServerStore creates a ServerStore. Its cookies are named "mist_flow_{flow}", scoped to
+// every path, secure, HttpOnly and SameSite=Lax.
+//
+// Parameters:
+//   - backend: The backend holding the state, e.g. InitMemoryBackend() or
+//     InitRedisBackend(rdb) when several instances serve the flows.
+//
+// Returns:
+//   - *ServerStore: The initialized store.
+func InitServerStore(backend Backend) *ServerStore {
+	return &ServerStore{backend: backend, cookieOptions: defaultCookieOptions()}
+}
+
+// SetCookiePrefix sets the prefix of the cookie names, followed by the name of the flow.
+func (s *ServerStore) SetCookiePrefix(prefix string) *ServerStore {
+	s.prefix = prefix
+	return s
+}
+
+// SetCookiePath sets the path and domain the cookies are scoped to; "" leaves the domain to
+// the host of the request.
+func (s *ServerStore) SetCookiePath(path string, domain string) *ServerStore {
+	s.path = path
+	s.domain = domain
+	return s
+}
+
+// SetSecure sets whether the cookies are only sent over HTTPS, e.g. false for local
+// development over HTTP.
+func (s *ServerStore) SetSecure(secure bool) *ServerStore {
+	s.secure = secure
+	return s
+}
+
+// Save stores the state in the backend under a new identifier, set in the cookie of the flow.
+func (s *ServerStore) Save(ctx *mist.Context, flow string, value []byte, ttl time.Duration) error {
+	id, err := randomToken()
+	if err != nil {
+		return err
+	}
+	if err = s.backend.Put(ctx.Request.Context(), flow+":"+id, value, ttl); err != nil {
+		return err
+	}
+	ctx.SetCookie(s.cookie(flow, id, ttl))
+	return nil
+}
+
+// Take takes the state identified by the cookie of the flow from the backend and clears the
+// cookie.
+func (s *ServerStore) Take(ctx *mist.Context, flow string) ([]byte, error) {
+	id, ok := s.take(ctx, flow)
+	if !ok || id == "" {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	value, err := s.backend.Take(ctx.Request.Context(), flow+":"+id)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, errs.ErrFlowStateNotFound(flow)
+	}
+	return value, nil
+}
+
+// MemoryBackend is a Backend local to the process, for applications served by a single
+// instance.
+type MemoryBackend struct {
+	mutex     sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+// memoryEntry is a value of MemoryBackend and its expiry.
+type memoryEntry struct {
+	value    []byte
+	deadline time.Time
+}
+
+// sweepInterval is the minimum period between two purges of the expired entries of
+// MemoryBackend.
+const sweepInterval = time.Minute
+
+// InitMemoryBackend creates an empty MemoryBackend. Expired entries are purged as new ones are
+// stored.
+//
+// Returns:
+//   - *MemoryBackend: The initialized backend.
+func InitMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{entries: make(map[string]memoryEntry), lastSweep: time.Now()}
+}
+
+// Put stores value under key for ttl.
+func (b *MemoryBackend) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now.Sub(b.lastSweep) >= sweepInterval {
+		for k, e := range b.entries {
+			if !now.Before(e.deadline) {
+				delete(b.entries, k)
+			}
+		}
+		b.lastSweep = now
+	}
+	b.entries[key] = memoryEntry{value: value, deadline: now.Add(ttl)}
+	return nil
+}
+
+// Take returns and deletes the value of key, nil when it is missing or expired.
+func (b *MemoryBackend) Take(_ context.Context, key string) ([]byte, error) {
+	b.mutex.Lock()
+	e, ok := b.entries[key]
+	delete(b.entries, key)
+	b.mutex.Unlock()
+	if !ok || !time.Now().Before(e.deadline) {
+		return nil, nil
+	}
+	return e.value, nil
+}
+
+// RedisBackend is a Backend shared by the instances of an application through Redis. It
+// requires Redis 6.2 or later for GETDEL.
+type RedisBackend struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// InitRedisBackend creates a RedisBackend. Keys are prefixed with "mist:flow:".
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *RedisBackend: The initialized backend.
+func InitRedisBackend(client redis.Cmdable) *RedisBackend {
+	return &RedisBackend{client: client, prefix: "mist:flow:"}
+}
+
+// SetKeyPrefix sets the prefix of the Redis keys of the state.
+func (b *RedisBackend) SetKeyPrefix(prefix string) *RedisBackend {
+	b.prefix = prefix
+	return b
+}
+
+// Put stores value under key for ttl.
+func (b *RedisBackend) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return b.client.Set(ctx, b.prefix+key, value, ttl).Err()
+}
+
+// Take returns and deletes the value of key with GETDEL, nil when it is missing or expired.
+func (b *RedisBackend) Take(ctx context.Context, key string) ([]byte, error) {
+	value, err := b.client.GetDel(ctx, b.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return value, err
+}
@@ -0,0 +1,423 @@
+package mist
+
+import (
+	"encoding"
+	"errors"
+	"github.com/dormoron/mist/errcode"
+	"github.com/dormoron/mist/internal/errs"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxFormMemory is the part of a multipart body kept in memory by BindForm; the rest of the
+	// files is stored in temporary files.
+	maxFormMemory = 32 << 20
+	// maxFormIndex bounds the slice indexes accepted in form keys, so that a key such as
+	// "items[99999999]" cannot make BindForm allocate a huge slice.
+	maxFormIndex = 1000
+)
+
+var (
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindForm decodes the fields of an application/x-www-form-urlencoded or multipart/form-data
+// request, together with the query parameters, into the struct pointed to by val. Form keys
+// address nested structs, maps and slices with the following syntax:
+//   - "name" sets the field named name,
+//   - "address.city" or "address[city]" sets the field city of the struct or map address,
+//   - "items[0].sku" sets the field sku of the first element of the slice items,
+//   - "tags" repeated, or "tags[]", appends every value to the slice tags.
+//
+// Fields are named by their `form` tag, then their `json` tag, then their Go name compared
+// case-insensitively; a tag of "-" skips the field. Values are converted to strings, booleans
+// ("on" is true, as sent by checkboxes), numbers, time.Time (RFC 3339, "2006-01-02T15:04" or
+// "2006-01-02", as sent by date inputs) and types implementing encoding.TextUnmarshaler. Empty
+// values leave non-string fields at their zero value. Uploaded files are bound to fields of type
+// *multipart.FileHeader or []*multipart.FileHeader. Keys matching no field are ignored, and
+// slice indexes are limited to 1000.
+//
+// Example:
+//
+//	type Order struct {
+//	    Email   string `form:"email" validate:"required,email"`
+//	    Address struct {
+//	        City string `form:"city"`
+//	    } `form:"address"`
+//	    Items []struct {
+//	        SKU      string `form:"sku"`
+//	        Quantity int    `form:"qty"`
+//	    } `form:"items"`
+//	}
+//
+//	// email=a@example.com&address.city=Paris&items[0].sku=A1&items[0].qty=2
+//	var order Order
+//	if err := c.BindForm(&order); err != nil {
+//	    _ = c.RespondError(err)
+//	    return
+//	}
+//
+// Parameters:
+//   - val: A non-nil pointer to the struct to populate.
+//
+// Returns:
+//   - error: nil on success; an *errcode.Error with code "request.malformed_body" if the form
+//     cannot be parsed, or with code "request.invalid_parameter" and the offending key as the
+//     "param" parameter if a value cannot be stored in its field.
+func (c *Context) BindForm(val any) error {
+	if val == nil {
+		return errs.ErrInputNil()
+	}
+	target := reflect.ValueOf(val)
+	if target.Kind() != reflect.Pointer || target.IsNil() || target.Elem().Kind() != reflect.Struct {
+		return errs.ErrInvalidType("pointer to struct", val)
+	}
+	if err := c.parseForm(); err != nil {
+		return errcode.New(errcode.CodeMalformedBody, err)
+	}
+
+	inputs := make(map[string]formInput, len(c.Request.Form))
+	for key, values := range c.Request.Form {
+		inputs[key] = formInput{values: values}
+	}
+	if c.Request.MultipartForm != nil {
+		for key, files := range c.Request.MultipartForm.File {
+			in := inputs[key]
+			in.files = files
+			inputs[key] = in
+		}
+	}
+	// Keys are applied in order so that "items[0]" is created before "items[1]" and errors are
+	// reported deterministically.
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path, ok := parseFormKey(key)
+		if !ok {
+			continue
+		}
+		if err := bindFormPath(target.Elem(), path, inputs[key]); err != nil {
+			return &errcode.Error{Code: errcode.CodeInvalidParam, Params: map[string]any{"param": key}, Err: err}
+		}
+	}
+	return nil
+}
+
+// parseForm parses the request body according to its content type.
+func (c *Context) parseForm() error {
+	mediaType, _, _ := mime.ParseMediaType(c.Request.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		return c.Request.ParseMultipartForm(maxFormMemory)
+	}
+	return c.Request.ParseForm()
+}
+
+// formInput holds the values and files submitted under a form key.
+type formInput struct {
+	values []string
+	files  []*multipart.FileHeader
+}
+
+// formSegment is a step of a form key: a field or map key name, a slice index, or an append
+// ("[]").
+type formSegment struct {
+	name   string
+	index  int
+	append bool
+}
+
+// parseFormKey splits a form key such as "items[0].sku" into its segments. It reports false
+// for keys that do not follow the syntax.
+func parseFormKey(key string) ([]formSegment, bool) {
+	var path []formSegment
+	for key != "" {
+		switch key[0] {
+		case '.':
+			key = key[1:]
+			if key == "" || key[0] == '.' || key[0] == '[' {
+				return nil, false
+			}
+		case '[':
+			end := strings.IndexByte(key, ']')
+			if end < 0 {
+				return nil, false
+			}
+			inner := key[1:end]
+			key = key[end+1:]
+			switch {
+			case inner == "":
+				if key != "" {
+					return nil, false
+				}
+				path = append(path, formSegment{append: true})
+			case inner[0] >= '0' && inner[0] <= '9':
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, false
+				}
+				path = append(path, formSegment{index: index})
+			default:
+				path = append(path, formSegment{name: inner})
+			}
+			continue
+		}
+		end := strings.IndexAny(key, ".[")
+		if end < 0 {
+			end = len(key)
+		}
+		if end == 0 {
+			return nil, false
+		}
+		path = append(path, formSegment{name: key[:end]})
+		key = key[end:]
+	}
+	return path, len(path) > 0 && path[0].name != ""
+}
+
+// bindFormPath stores in into the value reached from v by path.
+func bindFormPath(v reflect.Value, path []formSegment, in formInput) error {
+	// Leaf pointers are allocated by setFormValue, only for non-empty values.
+	for v.Kind() == reflect.Pointer && len(path) > 0 {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return setFormLeaf(v, in)
+	}
+
+	seg := path[0]
+	switch {
+	case seg.append:
+		if v.Kind() != reflect.Slice {
+			return errors.New("[] used on a field that is not a slice")
+		}
+		return setFormLeaf(v, in)
+	case seg.name != "":
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := formField(v, seg.name)
+			if !ok {
+				return nil
+			}
+			return bindFormPath(field, path[1:], in)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return errors.New("map keys must be strings")
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			key := reflect.ValueOf(seg.name).Convert(v.Type().Key())
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if cur := v.MapIndex(key); cur.IsValid() {
+				elem.Set(cur)
+			}
+			if err := bindFormPath(elem, path[1:], in); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+			return nil
+		}
+		return errors.New("field " + seg.name + " used on a value that is not a struct or map")
+	default:
+		switch v.Kind() {
+		case reflect.Slice:
+			if seg.index >= maxFormIndex {
+				return errors.New("index " + strconv.Itoa(seg.index) + " is out of range")
+			}
+			if seg.index >= v.Len() {
+				grown := reflect.MakeSlice(v.Type(), seg.index+1, seg.index+1)
+				reflect.Copy(grown, v)
+				v.Set(grown)
+			}
+		case reflect.Array:
+			if seg.index >= v.Len() {
+				return errors.New("index " + strconv.Itoa(seg.index) + " is out of range")
+			}
+		default:
+			return errors.New("index used on a value that is not a slice")
+		}
+		return bindFormPath(v.Index(seg.index), path[1:], in)
+	}
+}
+
+// setFormLeaf stores the values or files of in into v.
+func setFormLeaf(v reflect.Value, in formInput) error {
+	switch v.Type() {
+	case fileHeaderType:
+		if len(in.files) > 0 {
+			v.Set(reflect.ValueOf(in.files[0]))
+		}
+		return nil
+	case fileHeadersType:
+		v.Set(reflect.AppendSlice(v, reflect.ValueOf(in.files)))
+		return nil
+	}
+	if len(in.values) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !reflect.PointerTo(v.Type()).Implements(unmarshalerType) {
+		for _, s := range in.values {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := setFormValue(elem, s); err != nil {
+				return err
+			}
+			v.Set(reflect.Append(v, elem))
+		}
+		return nil
+	}
+	return setFormValue(v, in.values[0])
+}
+
+// setFormValue converts s into the type of v and stores it.
+func setFormValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if s == "" {
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		if s == "" {
+			return nil
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("cannot parse " + strconv.Quote(s) + " as a time")
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if s == "" && v.Kind() != reflect.String {
+		v.SetZero()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		if s == "on" {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// Only []byte reaches here; other slices are filled value by value by setFormLeaf.
+		v.SetBytes([]byte(s))
+	default:
+		return errors.New("unsupported field type " + v.Type().String())
+	}
+	return nil
+}
+
+// formField returns the field of struct v named name, looking into embedded structs too.
+func formField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	var fallback reflect.Value
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		tag := formTagName(sf)
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			if tag == name {
+				return v.Field(i), true
+			}
+			continue
+		}
+		if sf.Anonymous {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Pointer {
+				if embedded.Type().Elem().Kind() != reflect.Struct || !sf.IsExported() {
+					continue
+				}
+				if embedded.IsNil() {
+					// Allocate the embedded struct only if it holds the field.
+					if _, ok := formField(reflect.New(embedded.Type().Elem()).Elem(), name); !ok {
+						continue
+					}
+					embedded.Set(reflect.New(embedded.Type().Elem()))
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if field, ok := formField(embedded, name); ok {
+					return field, true
+				}
+				continue
+			}
+		}
+		if sf.IsExported() && !fallback.IsValid() && strings.EqualFold(sf.Name, name) {
+			fallback = v.Field(i)
+		}
+	}
+	return fallback, fallback.IsValid()
+}
+
+// formTagName returns the name given to a field by its form or json tag.
+func formTagName(sf reflect.StructField) string {
+	for _, key := range []string{"form", "json"} {
+		if tag, ok := sf.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,368 @@
+// Package forms renders and processes the HTML forms of server-rendered applications. A Form
+// carries to the template what it needs to redisplay a form: the values to show, the error
+// messages of the fields and the CSRF token of the csrf middleware. Bind decodes and validates
+// a submission in one step, so that a handler only re-renders the form when it is invalid:
+//
+//	server.POST("/signup", func(ctx *mist.Context) {
+//	    var input Signup
+//	    form, err := forms.Bind(ctx, &input)
+//	    if form.HasErrors() {
+//	        _ = ctx.Render("signup.html", map[string]any{"Form": form})
+//	        ctx.RespStatusCode = http.StatusUnprocessableEntity
+//	        return
+//	    }
+//	    if err != nil {
+//	        _ = ctx.RespondError(err)
+//	        return
+//	    }
+//	    ...
+//	})
+//
+// and the template:
+//
+//	<form method="post">
+//	    {{.Form.CSRFField}}
+//	    <input name="email" value="{{.Form.Value "email"}}">
+//	    {{with .Form.Error "email"}}<p class="error">{{.}}</p>{{end}}
+//	</form>
+package forms
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/errcode"
+	"github.com/dormoron/mist/middlewares/csrf"
+	"github.com/dormoron/mist/validation"
+	"html/template"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Form is the state of an HTML form, for templates.
+//
+// Fields:
+//   - Values: The values shown in the fields, keyed by form key ("email", "address.city",
+//     "items[0].sku").
+//   - Errors: The error messages of the fields, keyed by form key.
+type Form struct {
+	Values    url.Values
+	Errors    map[string][]string
+	csrfToken string
+	csrfField string
+}
+
+// New creates the form displaying a value, such as a blank form or the record being edited.
+// The fields of the struct are encoded under the keys BindForm decodes them from; zero numbers
+// and strings, and false booleans, are left blank.
+//
+// Parameters:
+//   - ctx: The context of the request rendering the form.
+//   - initial: A struct, or a pointer to one, holding the values to show; nil for a blank form.
+//
+// Returns:
+//   - *Form: The form.
+func New(ctx *mist.Context, initial any) *Form {
+	f := newForm(ctx)
+	if initial != nil {
+		encodeValue(reflect.ValueOf(initial), "", f.Values)
+	}
+	return f
+}
+
+// Bind decodes a submitted form into val with Context.BindForm and validates it with the
+// validation package. The returned form always holds the submitted values, and the localized
+// error messages of the fields that could not be decoded or broke a rule, to redisplay the form.
+//
+// Parameters:
+//   - ctx: The context of the request submitting the form.
+//   - val: A non-nil pointer to the struct to populate.
+//
+// Returns:
+//   - *Form: The submitted form.
+//   - error: nil when the submission is valid; the decoding or validation error otherwise. The
+//     field errors are also set on the form, so that Form.HasErrors tells whether to redisplay
+//     it; other errors, such as a malformed body, are to be answered with RespondError.
+func Bind(ctx *mist.Context, val any) (*Form, error) {
+	f := newForm(ctx)
+	bindErr := ctx.BindForm(val)
+	if ctx.Request.Form != nil {
+		f.Values = cloneValues(ctx.Request.Form)
+	}
+	catalog, locale := ctx.ErrorCatalog(), ctx.Locale()
+
+	// BindForm stops at the first field it cannot decode, leaving the next ones unset: only
+	// that field is reported, rules would fail for fields that were submitted.
+	var coded *errcode.Error
+	if bindErr != nil {
+		if errors.As(bindErr, &coded) && coded.Code == errcode.CodeInvalidParam {
+			key, _ := coded.Params["param"].(string)
+			f.AddError(key, catalog.Message(locale, coded.Code, coded.Params))
+		}
+		return f, bindErr
+	}
+
+	err := validation.Validate(val)
+	var verrs validation.Errors
+	if errors.As(err, &verrs) {
+		typ := reflect.TypeOf(val)
+		for _, fe := range verrs {
+			f.AddError(formKey(typ, fe.Field), catalog.Message(locale, fe.Code, fe.Params()))
+		}
+	}
+	return f, err
+}
+
+// newForm creates an empty form with the CSRF token of the request.
+func newForm(ctx *mist.Context) *Form {
+	return &Form{
+		Values:    url.Values{},
+		Errors:    map[string][]string{},
+		csrfToken: csrf.Token(ctx),
+		csrfField: csrf.FieldName(ctx),
+	}
+}
+
+// Value returns the first value of a field, "" when there is none.
+func (f *Form) Value(key string) string {
+	return f.Values.Get(key)
+}
+
+// ValuesOf returns all the values of a field, such as the options of a multiple select.
+func (f *Form) ValuesOf(key string) []string {
+	return f.Values[key]
+}
+
+// Checked reports whether a checkbox, radio button or option is selected: whether value is
+// one of the values of the field.
+func (f *Form) Checked(key string, value string) bool {
+	return slices.Contains(f.Values[key], value)
+}
+
+// Error returns the first error message of a field, "" when it is valid.
+func (f *Form) Error(key string) string {
+	if msgs := f.Errors[key]; len(msgs) > 0 {
+		return msgs[0]
+	}
+	return ""
+}
+
+// HasError reports whether a field has an error.
+func (f *Form) HasError(key string) bool {
+	return len(f.Errors[key]) > 0
+}
+
+// HasErrors reports whether any field has an error.
+func (f *Form) HasErrors() bool {
+	return len(f.Errors) > 0
+}
+
+// AddError adds an error message to a field, e.g. for checks made by the handler such as a
+// duplicate email address.
+func (f *Form) AddError(key string, msg string) {
+	f.Errors[key] = append(f.Errors[key], msg)
+}
+
+// CSRFToken returns the CSRF token of the request, "" when the csrf middleware did not run.
+func (f *Form) CSRFToken() string {
+	return f.csrfToken
+}
+
+// CSRFField returns the hidden input carrying the CSRF token, to place in every form posting
+// to the application; it is empty when the csrf middleware did not run.
+func (f *Form) CSRFField() template.HTML {
+	if f.csrfToken == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(f.csrfField) +
+		`" value="` + template.HTMLEscapeString(f.csrfToken) + `">`)
+}
+
+// cloneValues copies submitted values.
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, vals := range values {
+		clone[key] = slices.Clone(vals)
+	}
+	return clone
+}
+
+// textMarshalerType is the type of values encoded with MarshalText.
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// encodeValue encodes a value under a form key, the way BindForm decodes it.
+func encodeValue(v reflect.Value, key string, values url.Values) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if !t.IsZero() {
+			values.Add(key, formatTime(t))
+		}
+		return
+	}
+	if v.Type().Implements(textMarshalerType) {
+		if text, err := v.Interface().(encoding.TextMarshaler).MarshalText(); err == nil {
+			values.Add(key, string(text))
+		}
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		typ := v.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			sf := typ.Field(i)
+			name := formName(sf)
+			if name == "-" || (!sf.IsExported() && !sf.Anonymous) {
+				continue
+			}
+			if sf.Anonymous && tagName(sf) == "" {
+				encodeValue(v.Field(i), key, values)
+				continue
+			}
+			encodeValue(v.Field(i), joinKey(key, name), values)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(key, string(v.Bytes()))
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem := reflect.Indirect(v.Index(i))
+			if elem.Kind() == reflect.Struct {
+				encodeValue(elem, key+"["+strconv.Itoa(i)+"]", values)
+			} else {
+				encodeValue(elem, key, values)
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			encodeValue(iter.Value(), joinKey(key, fmt.Sprint(iter.Key().Interface())), values)
+		}
+	case reflect.Bool:
+		if v.Bool() {
+			values.Add(key, "on")
+		}
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		// Zero values are left blank, as in a form that was never filled.
+		if !v.IsZero() {
+			values.Add(key, fmt.Sprint(v.Interface()))
+		}
+	}
+}
+
+// formatTime formats a time as date inputs expect it, with the time of day for datetime-local
+// inputs when it is not midnight.
+func formatTime(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04")
+}
+
+// formKey translates the path of a validation error, made of JSON names, into the form key
+// of the field. Segments that cannot be resolved are kept as they are.
+func formKey(typ reflect.Type, path string) string {
+	var key strings.Builder
+	for i, segment := range strings.Split(path, ".") {
+		name, index, _ := strings.Cut(segment, "[")
+		for typ != nil && (typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) {
+			typ = typ.Elem()
+		}
+		var sf reflect.StructField
+		found := false
+		if typ != nil && typ.Kind() == reflect.Struct {
+			sf, found = fieldByJSONName(typ, name)
+		}
+		if i > 0 {
+			key.WriteByte('.')
+		}
+		if found {
+			key.WriteString(formName(sf))
+			typ = sf.Type
+		} else {
+			key.WriteString(name)
+			typ = nil
+		}
+		if index != "" {
+			key.WriteString("[" + index)
+		}
+	}
+	return key.String()
+}
+
+// fieldByJSONName finds the field a validation path segment names, looking into embedded
+// structs, which do not add a segment.
+func fieldByJSONName(typ reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.Anonymous {
+			embedded := sf.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if found, ok := fieldByJSONName(embedded, name); ok {
+					return found, true
+				}
+			}
+			continue
+		}
+		if jsonName(sf) == name {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// formName returns the form key of a field: the name of its form tag, then of its json tag,
+// then its Go name.
+func formName(sf reflect.StructField) string {
+	if name := tagName(sf); name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+// tagName returns the name given to a field by its form or json tag.
+func tagName(sf reflect.StructField) string {
+	for _, key := range []string{"form", "json"} {
+		if tag, ok := sf.Tag.Lookup(key); ok {
+			if name, _, _ := strings.Cut(tag, ","); name != "" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// jsonName returns the name of a field in validation paths.
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// joinKey appends a field name to a form key.
+func joinKey(key string, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
@@ -0,0 +1,147 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/internal/errs"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RouteMetaFrameAncestors is the metadata key under which Route.FrameAncestors records the
+// sites allowed to embed a route, so that tooling reading RouteTrees can audit them.
+const RouteMetaFrameAncestors = "frame_ancestors"
+
+// framePolicy is the framing policy of a route, resolved into the headers it is served with.
+type framePolicy struct {
+	// directive is the frame-ancestors directive of the Content-Security-Policy.
+	directive string
+	// xfo is the X-Frame-Options header; empty when partner origins are allowed, which the
+	// header cannot express.
+	xfo string
+}
+
+// FrameAncestors declares the sites allowed to embed the route in frames, overriding the
+// framing policy of the global security headers, such as an X-Frame-Options: DENY preset with
+// DefaultHeaders or a frame-ancestors directive of the https or csp middleware. The route is
+// served with:
+//   - the frame-ancestors directive replaced, or added, in every Content-Security-Policy header,
+//     or in a Content-Security-Policy header of its own when there is none,
+//   - X-Frame-Options DENY for 'none', SAMEORIGIN for 'self' alone, and no X-Frame-Options when
+//     partner origins are allowed, since browsers honouring it would block them.
+//
+// Sources are 'none', 'self', origins such as "https://partner.example", hosts such as
+// "*.partner.example", and schemes such as "https:". Malformed sources panic, like
+// malformed route patterns. Calling FrameAncestors again replaces the sources of the route.
+//
+// Example:
+//
+//	server.DefaultHeaders(map[string]string{"X-Frame-Options": "DENY"})
+//	server.GET("/widgets/:id", widget).FrameAncestors("'self'", "https://partner.example")
+//
+// Parameters:
+//   - sources: The allowed sources; none means 'none'.
+//
+// Returns:
+//   - *Route: The route, for chaining.
+func (r *Route) FrameAncestors(sources ...string) *Route {
+	r.node.frames = newFramePolicy(sources)
+	return r.Meta(RouteMetaFrameAncestors, append([]string(nil), sources...))
+}
+
+// FrameAncestors declares the sites allowed to embed the routes of the group, both those
+// already registered and those registered afterwards, see Route.FrameAncestors.
+//
+// Parameters:
+//   - sources: The allowed sources; none means 'none'.
+//
+// Returns:
+//   - *routerGroup: The group, for chaining.
+func (g *routerGroup) FrameAncestors(sources ...string) *routerGroup {
+	newFramePolicy(sources)
+	g.frameAncestors = append([]string{}, sources...)
+	for _, route := range g.routes {
+		route.FrameAncestors(sources...)
+	}
+	return g
+}
+
+// newFramePolicy validates the sources of a framing policy and resolves its headers.
+func newFramePolicy(sources []string) *framePolicy {
+	if len(sources) == 0 {
+		sources = []string{"'none'"}
+	}
+	for _, source := range sources {
+		if !validFrameAncestor(source) || (source == "'none'" && len(sources) > 1) {
+			panic(errs.ErrInvalidFrameAncestor(source))
+		}
+	}
+	p := &framePolicy{directive: "frame-ancestors " + strings.Join(sources, " ")}
+	switch {
+	case sources[0] == "'none'":
+		p.xfo = "DENY"
+	case len(sources) == 1 && sources[0] == "'self'":
+		p.xfo = "SAMEORIGIN"
+	}
+	return p
+}
+
+// validFrameAncestor reports whether a source is valid in a frame-ancestors directive.
+func validFrameAncestor(source string) bool {
+	if source == "'none'" || source == "'self'" {
+		return true
+	}
+	if source == "" || strings.ContainsAny(source, " \t;,'\"") {
+		return false
+	}
+	// A scheme source, such as "https:".
+	if scheme, ok := strings.CutSuffix(source, ":"); ok {
+		return scheme != "" && !strings.ContainsAny(scheme, "/:")
+	}
+	// A host source, with or without scheme, whose leftmost label may be a wildcard.
+	if !strings.Contains(source, "://") {
+		source = "https://" + source
+	}
+	u, err := url.Parse(strings.Replace(source, "://*.", "://wildcard.", 1))
+	return err == nil && u.Scheme != "" && u.Host != "" && (u.Path == "" || u.Path == "/") &&
+		u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// apply writes the framing policy into the response headers, replacing the framing directives
+// set by the global security headers.
+func (p *framePolicy) apply(header http.Header) {
+	if p.xfo == "" {
+		header.Del("X-Frame-Options")
+	} else {
+		header.Set("X-Frame-Options", p.xfo)
+	}
+	policies := header.Values("Content-Security-Policy")
+	if len(policies) == 0 {
+		header.Set("Content-Security-Policy", p.directive)
+		return
+	}
+	rewritten := make([]string, 0, len(policies))
+	for _, value := range policies {
+		// A header value may hold several policies separated by commas.
+		parts := strings.Split(value, ",")
+		for i, policy := range parts {
+			parts[i] = p.rewrite(policy)
+		}
+		rewritten = append(rewritten, strings.Join(parts, ", "))
+	}
+	header["Content-Security-Policy"] = rewritten
+}
+
+// rewrite replaces the frame-ancestors directive of a policy.
+func (p *framePolicy) rewrite(policy string) string {
+	directives := strings.Split(policy, ";")
+	kept := make([]string, 0, len(directives)+1)
+	for _, directive := range directives {
+		directive = strings.TrimSpace(directive)
+		name, _, _ := strings.Cut(directive, " ")
+		if directive == "" || strings.EqualFold(name, "frame-ancestors") {
+			continue
+		}
+		kept = append(kept, directive)
+	}
+	return strings.Join(append(kept, p.directive), "; ")
+}
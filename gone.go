@@ -0,0 +1,50 @@
+package mist
+
+import (
+	"context"
+	"errors"
+)
+
+// ServerWithDiscardGoneResponses is a configuration function that returns an HTTPServerOption.
+// When enabled, the responses of requests whose client disconnected are not written, which
+// saves serializing and sending bodies nobody reads. Handlers should still stop early by
+// watching Request.Context, which is cancelled as soon as the server notices the
+// disconnection.
+//
+// Parameters:
+//   - discard: Whether to skip writing the responses of disconnected clients.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified behaviour.
+func ServerWithDiscardGoneResponses(discard bool) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.discardGone = discard
+	}
+}
+
+// IsClientGone reports whether the client of the request disconnected, or reset its stream
+// for HTTP/2 and HTTP/3 servers built on net/http contexts. Unlike checking
+// Request.Context().Err(), it does not mistake the handler timeout set with
+// ServerWithHandlerTimeout for a disconnection.
+//
+// Example:
+//
+//	for _, row := range rows {
+//	    if ctx.IsClientGone() {
+//	        return
+//	    }
+//	    // ...
+//	}
+//
+// Returns:
+//   - bool: Whether the client went away.
+func (c *Context) IsClientGone() bool {
+	parent := c.clientCtx
+	if parent == nil {
+		if c.Request == nil {
+			return false
+		}
+		parent = c.Request.Context()
+	}
+	return errors.Is(parent.Err(), context.Canceled)
+}
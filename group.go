@@ -23,11 +23,20 @@ import (
 //     These middleware functions are executed in the order that they are added to
 //     this slice, prior to the route-specific handler being called. They can be used
 //     for logging, auth, session management, etc.
+//   - listeners: The listeners the routes of the group are restricted to, see OnlyOn.
+//   - constraints: The constraints of the routes of the group, see Constrain.
+//   - frameAncestors: The sites allowed to embed the routes of the group, see FrameAncestors; nil
+//     leaves the framing policy to the global security headers.
+//   - routes: The routes registered through the group, restricted along when OnlyOn is called.
 type routerGroup struct {
-	prefix  string
-	parent  *routerGroup
-	router  *router
-	middles []Middleware
+	prefix         string
+	parent         *routerGroup
+	router         *router
+	middles        []Middleware
+	listeners      []string
+	constraints    *Constraints
+	frameAncestors []string
+	routes         []*Route
 }
 
 // registerRoute adds a new route to the routerGroup with the specified HTTP method, path, and handler.
@@ -50,13 +59,27 @@ type routerGroup struct {
 //
 // The above will register a route that handles GET requests at "/api/users"
 // with loggingMiddleware executed before usersHandler.
-func (g *routerGroup) registerRoute(method, path string, handler HandleFunc, ms ...Middleware) {
+func (g *routerGroup) registerRoute(method, path string, handler HandleFunc, ms ...Middleware) *Route {
 	// Calculate the full path for the route by prepending the group's prefix
 	fullPath := g.calculateFullPath(path) // Assume calculateFullPath does what it says
 	// Combine the middleware attached to the group with any additional middleware provided for the route
 	middles := append(g.middles, ms...) // Group middleware is applied first, then route-specific middleware
 	// Register the route within the parent router using the method, full path, handler and all middleware
-	g.router.registerRoute(method, fullPath, handler, middles...)
+	route := g.router.registerRoute(method, fullPath, handler, middles...)
+	// Restrict the route to the listeners of the group, if any
+	if len(g.listeners) > 0 {
+		route.OnlyOn(g.listeners...)
+	}
+	// Constrain the route with the constraints of the group, if any
+	if g.constraints != nil {
+		route.Constrain(*g.constraints)
+	}
+	// Declare the framing policy of the group, if any
+	if g.frameAncestors != nil {
+		route.FrameAncestors(g.frameAncestors...)
+	}
+	g.routes = append(g.routes, route)
+	return route
 }
 
 // calculateFullPath constructs the full path for a route by concatenating the routerGroup's prefix
@@ -109,10 +132,12 @@ func (g *routerGroup) calculateFullPath(path string) string {
 // g.GET("/users", usersHandler, loggingMiddleware, authMiddleware)
 // This example would register a GET route at "/users" on the routerGroup's prefix, with both logging
 // and auth middleware applied to the route, followed by the execution of usersHandler.
-func (g *routerGroup) GET(path string, handler HandleFunc, ms ...Middleware) {
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) GET(path string, handler HandleFunc, ms ...Middleware) *Route {
 	// Calls the internal registerRoute method, providing the "GET" method
 	// along with the path, handler, and any middleware provided in the call.
-	g.registerRoute(http.MethodGet, path, handler, ms...)
+	return g.registerRoute(http.MethodGet, path, handler, ms...)
 }
 
 // HEAD registers a route for HTTP HEAD requests. The HEAD method is used to retrieve
@@ -147,8 +172,10 @@ func (g *routerGroup) GET(path string, handler HandleFunc, ms ...Middleware) {
 //
 // When a HEAD request is made to '/resources', the `resourceHandler` will be invoked after the
 // `loggingMiddleware` and `authenticationMiddleware` have been executed in that order.
-func (g *routerGroup) HEAD(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodHead, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) HEAD(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodHead, path, handler, ms...)
 }
 
 // POST adds a new route to the routerGroup to handle HTTP POST requests for a specific path.
@@ -187,8 +214,10 @@ func (g *routerGroup) HEAD(path string, handler HandleFunc, ms ...Middleware) {
 //
 // The POST method is a critical part of the CRUD operations supported by RESTful services, and it
 // enables the client-server interaction necessary for creating resources.
-func (g *routerGroup) POST(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodPost, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) POST(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodPost, path, handler, ms...)
 }
 
 // PUT registers a new route in the routerGroup specifically for handling HTTP PUT requests.
@@ -225,8 +254,10 @@ func (g *routerGroup) POST(path string, handler HandleFunc, ms ...Middleware) {
 // In this case, a PUT request to '/users/:id' will trigger the `updateUserHandler` after successfully
 // passing through the `authMiddleware` and `logMiddleware` checks. The ':id' is a path parameter which
 // will be used to identify the specific user to be updated.
-func (g *routerGroup) PUT(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodPut, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) PUT(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodPut, path, handler, ms...)
 }
 
 // PATCH adds a route to the routerGroup to handle HTTP PATCH requests. Unlike PUT, the PATCH method
@@ -260,8 +291,10 @@ func (g *routerGroup) PUT(path string, handler HandleFunc, ms ...Middleware) {
 // Before the `updateAvatarHandler` is invoked, the middleware functions `authenticateUser` and
 // `logUserActivity` are applied, checking if the user is authenticated and logging the user’s activity,
 // respectively.
-func (g *routerGroup) PATCH(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodPatch, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) PATCH(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodPatch, path, handler, ms...)
 }
 
 // DELETE adds a new route to the routerGroup for handling HTTP DELETE requests. The DELETE method is
@@ -298,8 +331,10 @@ func (g *routerGroup) PATCH(path string, handler HandleFunc, ms ...Middleware) {
 // This creates a route that will handle DELETE requests at the path "/user/:userID", where `:userID` is a path
 // parameter that represents a specific user's ID. `deleteUserHandler` handles the deletion logic after
 // `authMiddleware` authenticates the user who made the request and `logMiddleware` records the request details.
-func (g *routerGroup) DELETE(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodDelete, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) DELETE(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodDelete, path, handler, ms...)
 }
 
 // CONNECT registers a new route in the routerGroup to handle HTTP CONNECT requests. The CONNECT method
@@ -335,8 +370,10 @@ func (g *routerGroup) DELETE(path string, handler HandleFunc, ms ...Middleware)
 //
 // In this example, a CONNECT request to the path "/secure-tunnel" will initiate the `sslTunnelHandler` after
 // passing through the `authMiddleware`, which could authenticate the client request before the tunnel is established.
-func (g *routerGroup) CONNECT(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodConnect, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) CONNECT(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodConnect, path, handler, ms...)
 }
 
 // OPTIONS creates a new route in the routerGroup to handle HTTP OPTIONS requests. The OPTIONS method is used
@@ -378,6 +415,8 @@ func (g *routerGroup) CONNECT(path string, handler HandleFunc, ms ...Middleware)
 // `loggingMiddleware` to record the event. This route can be used by clients to discover allowable
 // methods like GET, POST, PUT, DELETE, etc., and headers like 'Content-Type' for interacting with
 // "/resource".
-func (g *routerGroup) OPTIONS(path string, handler HandleFunc, ms ...Middleware) {
-	g.registerRoute(http.MethodOptions, path, handler, ms...)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (g *routerGroup) OPTIONS(path string, handler HandleFunc, ms ...Middleware) *Route {
+	return g.registerRoute(http.MethodOptions, path, handler, ms...)
 }
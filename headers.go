@@ -0,0 +1,83 @@
+package mist
+
+import "net/http"
+
+// ServerWithDefaultHeaders is a configuration function that returns an HTTPServerOption.
+// It sets response headers sent with every response of the server, see DefaultHeaders.
+//
+// Parameters:
+//   - headers: The headers to preset, keyed by header name.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified headers.
+func ServerWithDefaultHeaders(headers map[string]string) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.DefaultHeaders(headers)
+	}
+}
+
+// DefaultHeaders presets response headers, such as Server or X-Frame-Options, on every
+// response of the server. Repeated calls add to the presets; an empty value removes a preset.
+// Presets must be configured before the server starts handling requests.
+//
+// Headers are resolved with the following precedence, from lowest to highest:
+//  1. server presets set with DefaultHeaders,
+//  2. group presets set with a HeaderPreset group middleware,
+//  3. route presets set with a HeaderPreset route middleware,
+//  4. headers set by the handler itself, e.g. with Context.Header.
+//
+// Parameters:
+//   - headers: The headers to preset, keyed by header name.
+func (s *HTTPServer) DefaultHeaders(headers map[string]string) {
+	merged := s.headers.Clone()
+	if merged == nil {
+		merged = make(http.Header, len(headers))
+	}
+	for key, value := range headers {
+		if value == "" {
+			merged.Del(key)
+			continue
+		}
+		merged.Set(key, value)
+	}
+	s.headers = merged
+}
+
+// HeaderPreset returns a middleware presetting response headers for the routes it is applied
+// to. Used on a group it overrides the server presets, and used on a route it overrides the
+// group presets; handlers can still override it. An empty value removes the header set by a
+// preset of lower precedence.
+//
+// Example:
+//
+//	v2 := server.Group("/v2", mist.HeaderPreset(map[string]string{"API-Version": "2"}))
+//	v2.GET("/legacy", handler, mist.HeaderPreset(map[string]string{"API-Version": "2-legacy"}))
+//
+// Parameters:
+//   - headers: The headers to preset, keyed by header name.
+//
+// Returns:
+//   - Middleware: The middleware applying the presets.
+func HeaderPreset(headers map[string]string) Middleware {
+	preset := make(http.Header, len(headers))
+	for key, value := range headers {
+		preset[http.CanonicalHeaderKey(key)] = []string{value}
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			applyHeaders(ctx.ResponseWriter.Header(), preset)
+			next(ctx)
+		}
+	}
+}
+
+// applyHeaders copies presets into dst, removing the headers preset with an empty value.
+func applyHeaders(dst http.Header, presets http.Header) {
+	for key, values := range presets {
+		if len(values) == 0 || values[0] == "" {
+			dst.Del(key)
+			continue
+		}
+		dst[key] = values
+	}
+}
@@ -0,0 +1,197 @@
+package health
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/dormoron/mist"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gRPC status codes used by the health service.
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+)
+
+// watchInterval is the period at which Watch re-runs the checks.
+const watchInterval = time.Second
+
+// maxRequestSize bounds the size of health check requests, which only carry a service name.
+const maxRequestSize = 64 << 10
+
+// RegisterGRPC registers the gRPC health checking protocol (grpc.health.v1.Health) on the
+// server, so that service mesh sidecars and Kubernetes gRPC probes can check the service:
+//
+//	POST /grpc.health.v1.Health/Check   returns the status of a service
+//	POST /grpc.health.v1.Health/Watch   streams the status of a service as it changes
+//
+// The messages are encoded without depending on a gRPC library. gRPC requires HTTP/2: the
+// server must be served over TLS, or over cleartext HTTP/2 (h2c) behind a handler such as
+// golang.org/x/net/http2/h2c. Compressed messages are not supported.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - ms: Middleware applied to both routes.
+func (c *Checker) RegisterGRPC(server *mist.HTTPServer, ms ...mist.Middleware) {
+	g := server.Group("/grpc.health.v1.Health", ms...)
+	g.POST("/Check", c.grpcCheck)
+	g.POST("/Watch", c.grpcWatch)
+}
+
+// grpcCheck serves the unary Check method. Unknown services fail with NOT_FOUND, as the
+// protocol requires.
+func (c *Checker) grpcCheck(ctx *mist.Context) {
+	service, code, msg := readHealthRequest(ctx)
+	if code != grpcOK {
+		grpcStatus(ctx, code, msg)
+		return
+	}
+	status := c.Status(ctx.Request.Context(), service)
+	if status == StatusServiceUnknown {
+		grpcStatus(ctx, grpcNotFound, "unknown service "+service)
+		return
+	}
+	startStream(ctx)
+	_, _ = ctx.ResponseWriter.Write(healthResponse(status))
+	endStream(ctx, grpcOK, "")
+}
+
+// grpcWatch serves the server-streaming Watch method: it sends the current status, then every
+// change, until the client cancels. Unknown services are reported as SERVICE_UNKNOWN.
+func (c *Checker) grpcWatch(ctx *mist.Context) {
+	service, code, msg := readHealthRequest(ctx)
+	if code != grpcOK {
+		grpcStatus(ctx, code, msg)
+		return
+	}
+	startStream(ctx)
+	rc := http.NewResponseController(ctx.ResponseWriter)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := StatusUnknown
+	for {
+		if status := c.Status(ctx.Request.Context(), service); status != last {
+			last = status
+			if _, err := ctx.ResponseWriter.Write(healthResponse(status)); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readHealthRequest decodes a HealthCheckRequest and returns its service name, or the gRPC
+// status code and message of the failure.
+func readHealthRequest(ctx *mist.Context) (string, int, string) {
+	if !strings.HasPrefix(ctx.Request.Header.Get("Content-Type"), "application/grpc") {
+		return "", grpcInvalidArgument, "invalid content type"
+	}
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxRequestSize))
+	if err != nil || len(body) < 5 {
+		return "", grpcInvalidArgument, "malformed message"
+	}
+	if body[0] != 0 {
+		return "", grpcUnimplemented, "compression is not supported"
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if int(size) != len(body)-5 {
+		return "", grpcInvalidArgument, "malformed message"
+	}
+	service, err := decodeService(body[5:])
+	if err != nil {
+		return "", grpcInvalidArgument, err.Error()
+	}
+	return service, grpcOK, ""
+}
+
+// errMalformed reports a HealthCheckRequest that is not valid protobuf.
+var errMalformed = errors.New("malformed health check request")
+
+// decodeService reads the service field (1) of a protobuf HealthCheckRequest, skipping unknown
+// fields.
+func decodeService(msg []byte) (string, error) {
+	service := ""
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return "", errMalformed
+		}
+		msg = msg[n:]
+		switch tag & 7 {
+		case 0:
+			if _, n = binary.Uvarint(msg); n <= 0 {
+				return "", errMalformed
+			}
+			msg = msg[n:]
+		case 1:
+			if len(msg) < 8 {
+				return "", errMalformed
+			}
+			msg = msg[8:]
+		case 2:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return "", errMalformed
+			}
+			if tag>>3 == 1 {
+				service = string(msg[n : n+int(size)])
+			}
+			msg = msg[n+int(size):]
+		case 5:
+			if len(msg) < 4 {
+				return "", errMalformed
+			}
+			msg = msg[4:]
+		default:
+			return "", errMalformed
+		}
+	}
+	return service, nil
+}
+
+// healthResponse encodes a HealthCheckResponse as a gRPC message frame.
+func healthResponse(status Status) []byte {
+	msg := []byte{0x08} // field 1, varint
+	msg = binary.AppendUvarint(msg, uint64(status))
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// startStream commits the headers of a gRPC response.
+func startStream(ctx *mist.Context) {
+	ctx.Header("Content-Type", "application/grpc")
+	ctx.RespStatusCode = http.StatusOK
+	ctx.Commit()
+}
+
+// endStream sends the trailers ending a gRPC response.
+func endStream(ctx *mist.Context, code int, msg string) {
+	header := ctx.ResponseWriter.Header()
+	header.Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		header.Set(http.TrailerPrefix+"Grpc-Message", msg)
+	}
+}
+
+// grpcStatus answers with a trailers-only response carrying a gRPC status.
+func grpcStatus(ctx *mist.Context, code int, msg string) {
+	ctx.Header("Content-Type", "application/grpc")
+	ctx.Header("Grpc-Status", strconv.Itoa(code))
+	ctx.Header("Grpc-Message", msg)
+	ctx.RespStatusCode = http.StatusOK
+}
@@ -0,0 +1,160 @@
+// Package health reports the health of a service to orchestrators, load balancers and
+// service meshes: HTTP liveness and readiness probes, and the gRPC health checking protocol
+// (grpc.health.v1) for sidecars and probes configured for gRPC checks.
+//
+//	checker := health.InitChecker().
+//	    AddCheck("", func(ctx context.Context) error { return db.PingContext(ctx) }).
+//	    AddCheck("orders.v1.Orders", ordersReady)
+//	server.GET("/livez", checker.LivenessHandler())
+//	server.GET("/readyz", checker.ReadinessHandler())
+//	checker.RegisterGRPC(server)
+package health
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status is the health of a service. Its values are those of the gRPC health checking
+// protocol.
+type Status int
+
+const (
+	// StatusUnknown is the status of a service whose health has not been determined.
+	StatusUnknown Status = 0
+	// StatusServing reports a healthy service.
+	StatusServing Status = 1
+	// StatusNotServing reports an unhealthy service.
+	StatusNotServing Status = 2
+	// StatusServiceUnknown reports a service the checker does not know.
+	StatusServiceUnknown Status = 3
+)
+
+// String returns the name of the status in the gRPC protocol, e.g. "SERVING".
+func (s Status) String() string {
+	switch s {
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	case StatusServiceUnknown:
+		return "SERVICE_UNKNOWN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Check probes a dependency of a service and returns an error when it is unhealthy.
+type Check func(ctx context.Context) error
+
+// Checker holds the health checks of the services of a process. The service named "" is the
+// process as a whole: it is serving when the checker is ready and every check of every service
+// passes.
+type Checker struct {
+	mutex   sync.RWMutex
+	checks  map[string][]Check
+	ready   atomic.Bool
+	timeout time.Duration
+}
+
+// InitChecker creates a ready Checker without checks. Checks time out after 2 seconds.
+//
+// Returns:
+//   - *Checker: The initialized checker.
+func InitChecker() *Checker {
+	c := &Checker{
+		checks:  map[string][]Check{"": nil},
+		timeout: 2 * time.Second,
+	}
+	c.ready.Store(true)
+	return c
+}
+
+// AddCheck adds a check to a service, declaring the service if needed. Checks added to ""
+// apply to the process as a whole.
+func (c *Checker) AddCheck(service string, check Check) *Checker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.checks[service] = append(c.checks[service], check)
+	return c
+}
+
+// AddService declares a service without checks, serving as long as the checker is ready.
+func (c *Checker) AddService(service string) *Checker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.checks[service]; !ok {
+		c.checks[service] = nil
+	}
+	return c
+}
+
+// SetTimeout sets the time limit of a run of the checks of a service.
+func (c *Checker) SetTimeout(timeout time.Duration) *Checker {
+	c.timeout = timeout
+	return c
+}
+
+// SetReady sets whether the process accepts traffic. A process that is not ready reports every
+// service as not serving, e.g. while it warms up or once it starts shutting down.
+func (c *Checker) SetReady(ready bool) {
+	c.ready.Store(ready)
+}
+
+// Ready reports whether the process accepts traffic, see SetReady.
+func (c *Checker) Ready() bool {
+	return c.ready.Load()
+}
+
+// Services returns the names of the declared services, sorted, "" included.
+func (c *Checker) Services() []string {
+	c.mutex.RLock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	c.mutex.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Status runs the checks of a service and returns its health.
+//
+// Parameters:
+//   - ctx: The context of the checks.
+//   - service: The name of the service; "" for the process as a whole.
+//
+// Returns:
+//   - Status: StatusServiceUnknown for undeclared services, StatusNotServing when the checker
+//     is not ready or a check fails, StatusServing otherwise.
+func (c *Checker) Status(ctx context.Context, service string) Status {
+	c.mutex.RLock()
+	checks, ok := c.checks[service]
+	if service == "" {
+		checks = nil
+		for _, cs := range c.checks {
+			checks = append(checks, cs...)
+		}
+	}
+	c.mutex.RUnlock()
+	if !ok {
+		return StatusServiceUnknown
+	}
+	if !c.Ready() {
+		return StatusNotServing
+	}
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	for _, check := range checks {
+		if err := check(ctx); err != nil {
+			return StatusNotServing
+		}
+	}
+	return StatusServing
+}
@@ -0,0 +1,40 @@
+package health
+
+import (
+	"github.com/dormoron/mist"
+	"net/http"
+)
+
+// probeResponse is the body of the HTTP probes.
+type probeResponse struct {
+	Status string `json:"status"`
+}
+
+// LivenessHandler returns the handler of the liveness probe. It reports the process as alive
+// whenever it can answer, without running the checks: a failing dependency must not get the
+// process restarted.
+func (c *Checker) LivenessHandler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		_ = ctx.RespondWithJSON(http.StatusOK, probeResponse{Status: StatusServing.String()})
+	}
+}
+
+// ReadinessHandler returns the handler of the readiness probe. It responds with 200 when the
+// service named by the "service" query parameter, or the process as a whole when it is
+// absent, is serving, and with 503 otherwise, or 404 for unknown services.
+func (c *Checker) ReadinessHandler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		service := ctx.QueryValue("service").StringOrDefault("")
+		status := c.Status(ctx.Request.Context(), service)
+		code := http.StatusOK
+		switch status {
+		case StatusServiceUnknown:
+			code = http.StatusNotFound
+		case StatusNotServing:
+			code = http.StatusServiceUnavailable
+		}
+		ctx.Header("Cache-Control", "no-store")
+		_ = ctx.RespondWithJSON(code, probeResponse{Status: status.String()})
+	}
+}
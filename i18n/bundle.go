@@ -0,0 +1,192 @@
+// Package i18n provides message translation and language negotiation for mist applications.
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Bundle stores translated messages grouped by locale. Lookups fall back from a regional
+// locale ("pt-BR") to its base language ("pt") and finally to the default locale of the bundle.
+// A Bundle is safe for concurrent use.
+//
+// Fields:
+//   - mutex: Guards the messages map against concurrent registration and lookup.
+//   - defaultLocale: The locale used when no translation exists for the requested one.
+//   - messages: Messages keyed by normalized locale and then by message key.
+type Bundle struct {
+	mutex         sync.RWMutex
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+// InitBundle creates an empty Bundle that falls back to defaultLocale.
+//
+// Parameters:
+//   - defaultLocale: The fallback locale, for example "en".
+//
+// Returns:
+//   - *Bundle: The initialized bundle.
+func InitBundle(defaultLocale string) *Bundle {
+	return &Bundle{
+		defaultLocale: Normalize(defaultLocale),
+		messages:      make(map[string]map[string]string),
+	}
+}
+
+// DefaultLocale returns the fallback locale of the bundle.
+func (b *Bundle) DefaultLocale() string {
+	return b.defaultLocale
+}
+
+// AddMessages registers messages for a locale, overwriting existing keys. Messages may contain
+// "{name}" placeholders that are substituted with parameters at translation time.
+//
+// Parameters:
+//   - locale: The locale of the messages, e.g. "de" or "zh-CN".
+//   - messages: Message templates keyed by message key.
+func (b *Bundle) AddMessages(locale string, messages map[string]string) {
+	locale = Normalize(locale)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	dst, ok := b.messages[locale]
+	if !ok {
+		dst = make(map[string]string, len(messages))
+		b.messages[locale] = dst
+	}
+	for key, msg := range messages {
+		dst[key] = msg
+	}
+}
+
+// Locales returns the locales that have at least one registered message, sorted.
+func (b *Bundle) Locales() []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	res := make([]string, 0, len(b.messages))
+	for locale := range b.messages {
+		res = append(res, locale)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Translate looks up the message registered under key for locale and substitutes params.
+//
+// Parameters:
+//   - locale: The requested locale.
+//   - key: The message key.
+//   - params: Values substituted for "{name}" placeholders.
+//
+// Returns:
+//   - string: The translated message.
+//   - bool: False if no translation exists in the locale, its base language or the default locale.
+func (b *Bundle) Translate(locale string, key string, params map[string]any) (string, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for _, candidate := range fallbacks(Normalize(locale), b.defaultLocale) {
+		if msg, ok := b.messages[candidate][key]; ok {
+			return Format(msg, params), true
+		}
+	}
+	return "", false
+}
+
+// Match negotiates the best supported locale for an Accept-Language header value, honouring
+// quality values. Base languages match regional variants in both directions, so "en-US" matches
+// a supported "en" and "en" matches a supported "en-GB".
+//
+// Parameters:
+//   - acceptLanguage: The raw Accept-Language header value.
+//   - supported: The locales the application can serve.
+//
+// Returns:
+//   - string: The best matching supported locale, or "" when nothing matches.
+func Match(acceptLanguage string, supported ...string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var prefs []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q > 0 {
+			prefs = append(prefs, weighted{tag: Normalize(tag), q: q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, pref := range prefs {
+		if pref.tag == "*" && len(supported) > 0 {
+			return supported[0]
+		}
+		for _, s := range supported {
+			if Normalize(s) == pref.tag {
+				return s
+			}
+		}
+		base := baseLanguage(pref.tag)
+		for _, s := range supported {
+			if baseLanguage(Normalize(s)) == base {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Normalize canonicalizes a locale tag: underscores become hyphens, the language is lower
+// case and the region upper case ("zh_cn" becomes "zh-CN").
+func Normalize(locale string) string {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	lang, region, ok := strings.Cut(locale, "-")
+	if !ok {
+		return strings.ToLower(lang)
+	}
+	return strings.ToLower(lang) + "-" + strings.ToUpper(region)
+}
+
+// Format substitutes "{name}" placeholders in msg with the matching params.
+func Format(msg string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(msg, "{") {
+		return msg
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for name, val := range params {
+		pairs = append(pairs, "{"+name+"}", fmt.Sprint(val))
+	}
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// baseLanguage returns the language part of a normalized locale.
+func baseLanguage(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+// fallbacks lists the locales consulted, in order, for a lookup.
+func fallbacks(locale string, def string) []string {
+	res := make([]string, 0, 3)
+	if locale != "" {
+		res = append(res, locale)
+		if base := baseLanguage(locale); base != locale {
+			res = append(res, base)
+		}
+	}
+	if def != "" && def != locale {
+		res = append(res, def)
+	}
+	return res
+}
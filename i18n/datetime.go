@@ -0,0 +1,69 @@
+package i18n
+
+import (
+	"time"
+)
+
+// DateFormat describes how a locale writes dates and times, as layouts of the time package.
+//
+// Fields:
+//   - Date: The layout of dates, e.g. "02.01.2006" in German.
+//   - Time: The layout of times of day, e.g. "15:04".
+type DateFormat struct {
+	Date string
+	Time string
+}
+
+var (
+	isoDate   = DateFormat{Date: "2006-01-02", Time: "15:04"}
+	usDate    = DateFormat{Date: "01/02/2006", Time: "3:04 PM"}
+	slashDMY  = DateFormat{Date: "02/01/2006", Time: "15:04"}
+	dotDMY    = DateFormat{Date: "02.01.2006", Time: "15:04"}
+	dashDMY   = DateFormat{Date: "02-01-2006", Time: "15:04"}
+	slashYMD  = DateFormat{Date: "2006/01/02", Time: "15:04"}
+	dottedYMD = DateFormat{Date: "2006. 01. 02.", Time: "15:04"}
+)
+
+// dateFormats maps normalized locales and base languages to their date format. Locales that
+// are not listed use ISO 8601 dates, which every reader understands.
+var dateFormats = map[string]DateFormat{
+	"en": usDate, "en-US": usDate, "en-GB": slashDMY, "en-AU": slashDMY, "en-IN": slashDMY,
+	"en-IE": slashDMY, "en-NZ": slashDMY, "en-CA": isoDate,
+
+	"fr": slashDMY, "es": slashDMY, "it": slashDMY, "pt": slashDMY, "el": slashDMY,
+	"vi": slashDMY, "id": slashDMY, "he": dotDMY, "hi": slashDMY, "th": slashDMY,
+
+	"de": dotDMY, "ru": dotDMY, "pl": dotDMY, "cs": dotDMY, "sk": dotDMY, "tr": dotDMY,
+	"nb": dotDMY, "no": dotDMY, "fi": dotDMY, "uk": dotDMY, "ro": dotDMY, "bg": dotDMY,
+	"da": dotDMY,
+
+	"nl": dashDMY,
+
+	"ja": slashYMD, "zh": slashYMD, "ko": dottedYMD, "hu": dottedYMD,
+	"sv": isoDate,
+}
+
+// DateFormatOf returns the date format of a locale, falling back from a regional locale
+// ("en-GB") to its base language ("en") and finally to ISO 8601.
+func DateFormatOf(locale string) DateFormat {
+	locale = Normalize(locale)
+	if f, ok := dateFormats[locale]; ok {
+		return f
+	}
+	if f, ok := dateFormats[baseLanguage(locale)]; ok {
+		return f
+	}
+	return isoDate
+}
+
+// FormatDate writes the date of t as locale does, e.g. "17.10.2026" in German.
+func FormatDate(locale string, t time.Time) string {
+	return t.Format(DateFormatOf(locale).Date)
+}
+
+// FormatDateTime writes the date and the time of day of t as locale does, e.g.
+// "10/17/2026 3:04 PM" in American English. The time is written in the location of t.
+func FormatDateTime(locale string, t time.Time) string {
+	f := DateFormatOf(locale)
+	return t.Format(f.Date + " " + f.Time)
+}
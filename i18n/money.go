@@ -0,0 +1,76 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of money in the minor unit of its currency, e.g. cents, which avoids the
+// rounding errors of floating point amounts.
+//
+// Fields:
+//   - Amount: The amount in minor units, e.g. 123450 for 1234.50 euros.
+//   - Currency: The ISO 4217 code of the currency, e.g. "EUR".
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// currencyDigits are the numbers of minor unit digits of the currencies that do not have two.
+var currencyDigits = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "UGX": 0, "XAF": 0, "XOF": 0,
+	"BHD": 3, "KWD": 3, "OMR": 3, "JOD": 3, "TND": 3,
+}
+
+// currencySymbols are the symbols of the common currencies; others are written with their code.
+var currencySymbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "CNY": "¥", "INR": "₹", "KRW": "₩",
+	"RUB": "₽", "TRY": "₺", "ILS": "₪", "VND": "₫", "PLN": "zł", "UAH": "₴",
+}
+
+// CurrencyDigits returns the number of minor unit digits of a currency, 2 for most of them.
+func CurrencyDigits(currency string) int {
+	if digits, ok := currencyDigits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// FormatMoney writes an amount of money as locale does: with its number separators, and the
+// symbol of the currency before the amount in locales writing numbers as English does, e.g.
+// "€1,234.50", after it otherwise, e.g. "1.234,50 €" in German. Currencies without a symbol are
+// written with their code, e.g. "CHF 1,234.50".
+//
+// Parameters:
+//   - locale: The locale of the reader.
+//   - m: The amount.
+//
+// Returns:
+//   - string: The formatted amount.
+func FormatMoney(locale string, m Money) string {
+	digits := CurrencyDigits(m.Currency)
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		// The minor units of math.MinInt64 overflow; amounts that large are not money.
+		sign, amount = "-", -amount
+	}
+	num := strconv.FormatInt(amount, 10)
+	if digits > 0 {
+		num = strings.Repeat("0", max(0, digits+1-len(num))) + num
+		num = num[:len(num)-digits] + "." + num[len(num)-digits:]
+	}
+	f := NumberFormatOf(locale)
+	num = localize(f, num)
+	currency := strings.ToUpper(m.Currency)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if f == pointComma {
+		if !ok {
+			symbol += " "
+		}
+		return sign + symbol + num
+	}
+	return sign + num + " " + symbol
+}
@@ -0,0 +1,106 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NumberFormat describes how a locale writes numbers.
+//
+// Fields:
+//   - Decimal: The decimal separator, e.g. "." in English and "," in German.
+//   - Group: The separator between groups of three integer digits.
+type NumberFormat struct {
+	Decimal string
+	Group   string
+}
+
+var (
+	pointComma = NumberFormat{Decimal: ".", Group: ","}
+	commaPoint = NumberFormat{Decimal: ",", Group: "."}
+	commaSpace = NumberFormat{Decimal: ",", Group: "\u00a0"} // no-break space
+)
+
+// numberFormats maps normalized locales and base languages to their number format. Locales
+// that are not listed use the English format.
+var numberFormats = map[string]NumberFormat{
+	"en": pointComma, "ja": pointComma, "zh": pointComma, "ko": pointComma, "he": pointComma,
+	"th": pointComma, "hi": pointComma,
+
+	"de": commaPoint, "es": commaPoint, "it": commaPoint, "nl": commaPoint, "pt": commaPoint,
+	"id": commaPoint, "tr": commaPoint, "da": commaPoint, "el": commaPoint, "ro": commaPoint,
+	"vi": commaPoint,
+
+	"fr": commaSpace, "ru": commaSpace, "pl": commaSpace, "cs": commaSpace, "sk": commaSpace,
+	"sv": commaSpace, "nb": commaSpace, "no": commaSpace, "fi": commaSpace, "uk": commaSpace,
+	"hu": commaSpace, "bg": commaSpace, "pt-PT": commaSpace,
+
+	"de-CH": {Decimal: ".", Group: "\u2019"},
+	"es-MX": pointComma,
+}
+
+// NumberFormatOf returns the number format of a locale, falling back from a regional locale
+// ("de-CH") to its base language ("de") and finally to English.
+func NumberFormatOf(locale string) NumberFormat {
+	locale = Normalize(locale)
+	if f, ok := numberFormats[locale]; ok {
+		return f
+	}
+	if f, ok := numberFormats[baseLanguage(locale)]; ok {
+		return f
+	}
+	return pointComma
+}
+
+// FormatNumber writes v with the separators of locale, e.g. 1234567.5 as "1.234.567,5" in
+// German.
+//
+// Parameters:
+//   - locale: The locale of the reader, e.g. "fr" or "en-US".
+//   - v: The number to format.
+//   - prec: The number of digits after the decimal separator, or -1 for the smallest number
+//     of digits that represents v exactly.
+//
+// Returns:
+//   - string: The formatted number.
+func FormatNumber(locale string, v float64, prec int) string {
+	return localize(NumberFormatOf(locale), strconv.FormatFloat(v, 'f', prec, 64))
+}
+
+// FormatInteger writes v with the group separator of locale, e.g. 1234567 as "1 234 567" in
+// French.
+func FormatInteger(locale string, v int64) string {
+	return localize(NumberFormatOf(locale), strconv.FormatInt(v, 10))
+}
+
+// FormatUnsigned is FormatInteger for unsigned integers.
+func FormatUnsigned(locale string, v uint64) string {
+	return localize(NumberFormatOf(locale), strconv.FormatUint(v, 10))
+}
+
+// localize rewrites a number formatted by strconv, which uses "." as decimal separator and no
+// grouping, with the separators of f. Non-finite values are returned unchanged.
+func localize(f NumberFormat, num string) string {
+	sign := ""
+	if strings.HasPrefix(num, "-") {
+		sign, num = "-", num[1:]
+	}
+	if num == "" || num[0] < '0' || num[0] > '9' {
+		return sign + num
+	}
+	integer, frac, hasFrac := strings.Cut(num, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(f.Group)
+		}
+		b.WriteRune(d)
+	}
+	if hasFrac {
+		b.WriteString(f.Decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+// Package awsv4 signs requests to AWS APIs with Signature Version 4.
+package awsv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials are the credentials of an AWS identity.
+//
+// Fields:
+//   - AccessKeyID, SecretKey: The access key.
+//   - SessionToken: The session token of temporary credentials; empty for long-term ones.
+type Credentials struct {
+	AccessKeyID  string
+	SecretKey    string
+	SessionToken string
+}
+
+// Sign signs a request, setting its X-Amz-Date, X-Amz-Security-Token and Authorization
+// headers. The Content-Type and Host headers are signed.
+//
+// Parameters:
+//   - req: The request.
+//   - body: The body of the request, set separately.
+//   - creds: The credentials signing the request.
+//   - region: The region of the service, e.g. "eu-west-1", or "us-east-1" for global services.
+//   - service: The name of the service in the signing scope, e.g. "ses".
+//   - now: The time of the signature.
+func Sign(req *http.Request, body []byte, creds Credentials, region string, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalHeaders := "content-type:" + req.Header.Get("Content-Type") + "\n" +
+		"host:" + req.URL.Host + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += "x-amz-security-token:" + creds.SessionToken + "\n"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := req.Method + "\n" + req.URL.EscapedPath() + "\n" + req.URL.RawQuery + "\n" +
+		canonicalHeaders + "\n" + signedHeaders + "\n" + hex.EncodeToString(payloadHash[:])
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey(creds, date, region, service), stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// Presign returns a URL carrying its signature in its query, such as a presigned S3 URL, which
+// anyone holding it can use until it expires. Only the Host header is signed, and the payload is
+// not.
+//
+// Parameters:
+//   - method: The method of the requests made with the URL, e.g. "GET".
+//   - u: The URL to sign; its path must be escaped as the service expects, e.g. in RawPath.
+//   - creds: The credentials signing the URL.
+//   - region: The region of the service.
+//   - service: The name of the service in the signing scope, e.g. "s3".
+//   - now: The time of the signature.
+//   - expires: How long the URL is valid, at most 7 days.
+//
+// Returns:
+//   - string: The signed URL.
+func Presign(method string, u *url.URL, creds Credentials, region string, service string, now time.Time, expires time.Duration) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := method + "\n" + u.EscapedPath() + "\n" + canonicalQuery + "\n" +
+		"host:" + u.Host + "\n\nhost\nUNSIGNED-PAYLOAD"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	signature := hex.EncodeToString(hmacSHA256(signingKey(creds, date, region, service), stringToSign))
+
+	signed := *u
+	signed.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return signed.String()
+}
+
+// EscapePath escapes a path as AWS expects in canonical requests: every byte but the unreserved
+// characters of RFC 3986 and the slashes is percent-encoded.
+func EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || unreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+// canonicalQueryString encodes a query with its parameters sorted by name.
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escapeQuery(key)+"="+escapeQuery(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escapeQuery escapes a query parameter as AWS expects, spaces included as %20.
+func escapeQuery(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(url.QueryEscape(s), "+", "%20"), "%7E", "~")
+}
+
+// unreserved reports whether c is an unreserved character of RFC 3986.
+func unreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '_' || c == '.' || c == '~'
+}
+
+// signingKey derives the key signing the requests of a day to a service.
+func signingKey(creds Credentials, date string, region string, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+creds.SecretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -3,47 +3,94 @@ package errs
 import (
 	"errors"
 	"fmt"
+	misterrors "github.com/dormoron/mist/errors"
 )
 
 var (
 	// base
-	errInvalidType = errors.New("base: type conversion failed, expected type")
+	errInvalidType = misterrors.ErrInvalidType
 	// web
-	errKeyNotFound        = errors.New("session: key not found")
-	errSessionNotFound    = errors.New("session: session not found")
-	errIdSessionNotFound  = errors.New("session: session corresponding to id does not exist")
-	errVerificationFailed = errors.New("session: verification failed")
-	errEmptyRefreshOpts   = errors.New("refreshJWTOptions are nil")
+	errKeyNotFound        = misterrors.ErrKeyNotFound
+	errSessionNotFound    = misterrors.ErrSessionNotFound
+	errIdSessionNotFound  = misterrors.ErrIDSessionNotFound
+	errSessionRotation    = misterrors.ErrSessionRotationUnsupported
+	errSessionIDTaken     = misterrors.ErrSessionIDTaken
+	errVerificationFailed = misterrors.ErrVerificationFailed
+	errEmptyRefreshOpts   = misterrors.ErrEmptyRefreshOpts
 	// context error
-	errInputNil = errors.New("web: input cannot be nil")
-	errBodyNil  = errors.New("web: body is nil")
-	errKeyNil   = errors.New("web: key does not exist")
+	errInputNil = misterrors.ErrInputNil
+	errBodyNil  = misterrors.ErrBodyNil
+	errKeyNil   = misterrors.ErrKeyNil
 	//  router errors
-	errPathNotAllowWildcardAndPath        = errors.New("web: illegal route, path parameter route already exists. Cannot register wildcard route and parameter route at the same time")
-	errPathNotAllowPathAndRegular         = errors.New("web: illegal route, path parameter route already exists. Cannot register regular route and parameter route at the same time")
-	errRegularNotAllowWildcardAndRegular  = errors.New("web: illegal route, regular route already exists. Cannot register wildcard route and regular route at the same time")
-	errRegularNotAllowRegularAndPath      = errors.New("web: illegal route, regular route already exists. Cannot register regular route and parameter route at the same time")
-	errWildcardNotAllowWildcardAndPath    = errors.New("web: illegal route, wildcard route already exists. Cannot register wildcard route and parameter route at the same time")
-	errWildcardNotAllowWildcardAndRegular = errors.New("web: illegal route, wildcard route already exists. Cannot register wildcard route and regular route at the same time")
-	errPathClash                          = errors.New("web: route conflict, parameter routes clash")
-	errRegularClash                       = errors.New("web: route conflict, regular routes clash")
-	errRegularExpression                  = errors.New("web: regular expression error")
-	errRouterNotString                    = errors.New("web: route is an empty string")
-	errRouterFront                        = errors.New("web: route must start with '/'")
-	errRouterBack                         = errors.New("web: route cannot end with '/'")
-	errRouterGroupFront                   = errors.New("web: route group must start with '/'")
-	errRouterGroupBack                    = errors.New("web: route group cannot end with '/'")
-	errRouterChildConflict                = errors.New("web: Child routes must start with '/'")
-	errRouterConflict                     = errors.New("web: route conflict")
-	errRouterNotSymbolic                  = errors.New("web: illegal route. Routes like //a/b, /a//b etc. are not allowed")
+	errPathNotAllowWildcardAndPath        = &misterrors.RouteError{Msg: "web: illegal route, path parameter route already exists. Cannot register wildcard route and parameter route at the same time"}
+	errPathNotAllowPathAndRegular         = &misterrors.RouteError{Msg: "web: illegal route, path parameter route already exists. Cannot register regular route and parameter route at the same time"}
+	errRegularNotAllowWildcardAndRegular  = &misterrors.RouteError{Msg: "web: illegal route, regular route already exists. Cannot register wildcard route and regular route at the same time"}
+	errRegularNotAllowRegularAndPath      = &misterrors.RouteError{Msg: "web: illegal route, regular route already exists. Cannot register regular route and parameter route at the same time"}
+	errWildcardNotAllowWildcardAndPath    = &misterrors.RouteError{Msg: "web: illegal route, wildcard route already exists. Cannot register wildcard route and parameter route at the same time"}
+	errWildcardNotAllowWildcardAndRegular = &misterrors.RouteError{Msg: "web: illegal route, wildcard route already exists. Cannot register wildcard route and regular route at the same time"}
+	errPathClash                          = &misterrors.RouteError{Msg: "web: route conflict, parameter routes clash"}
+	errRegularClash                       = &misterrors.RouteError{Msg: "web: route conflict, regular routes clash"}
+	errRegularExpression                  = &misterrors.RouteError{Msg: "web: regular expression error"}
+	errRouterNotString                    = &misterrors.RouteError{Msg: "web: route is an empty string"}
+	errRouterFront                        = &misterrors.RouteError{Msg: "web: route must start with '/'"}
+	errRouterBack                         = &misterrors.RouteError{Msg: "web: route cannot end with '/'"}
+	errRouterGroupFront                   = &misterrors.RouteError{Msg: "web: route group must start with '/'"}
+	errRouterGroupBack                    = &misterrors.RouteError{Msg: "web: route group cannot end with '/'"}
+	errRouterChildConflict                = &misterrors.RouteError{Msg: "web: Child routes must start with '/'"}
+	errRouterConflict                     = misterrors.ErrRouteConflict
+	errRouterNotSymbolic                  = &misterrors.RouteError{Msg: "web: illegal route. Routes like //a/b, /a//b etc. are not allowed"}
+	errRouteNameConflict                  = misterrors.ErrRouteNameConflict
+	errRouteNameNotFound                  = misterrors.ErrRouteNameNotFound
+	errRouteParamMissing                  = misterrors.ErrRouteParamMissing
+	errInvalidFrameAncestor               = misterrors.ErrInvalidFrameAncestor
+	// serializer errors
+	errInvalidResource     = misterrors.ErrInvalidResource
+	errResourceTypeMissing = misterrors.ErrResourceTypeMissing
+	// server lifecycle errors
+	errServerShuttingDown = misterrors.ErrServerShuttingDown
+	errNoListener         = misterrors.ErrNoListener
+	errNoFlashStore       = misterrors.ErrNoFlashStore
+	errResponseCommitted  = misterrors.ErrResponseCommitted
+	errScanFailed         = misterrors.ErrScanFailed
+	errStaticBackend      = misterrors.ErrStaticBackend
+	errStaticRedirect     = misterrors.ErrStaticRedirectUnsupported
+	errNoJobStore         = misterrors.ErrNoJobStore
+	errJobNotFound        = misterrors.ErrJobNotFound
+	// feature flag errors
+	errFlagNotFound  = misterrors.ErrFlagNotFound
+	errFlagNameEmpty = misterrors.ErrFlagNameEmpty
+	// baggage errors
+	errInvalidBaggage = misterrors.ErrInvalidBaggage
+	// distributed lock errors
+	errLockNotAcquired = misterrors.ErrLockNotAcquired
+	errLockNotHeld     = misterrors.ErrLockNotHeld
+	// flow state errors
+	errFlowStateNotFound = misterrors.ErrFlowStateNotFound
+	// mailer errors
+	errMailQueueFull   = misterrors.ErrMailQueueFull
+	errMailQueueClosed = misterrors.ErrMailQueueClosed
+	// account flow errors
+	errAccountTokenInvalid    = misterrors.ErrAccountTokenInvalid
+	errAccountFlowRateLimited = misterrors.ErrAccountFlowRateLimited
+	// SAML errors
+	errSAMLResponseInvalid = misterrors.ErrSAMLResponseInvalid
+	// SCIM errors
+	errSCIMNotFound = misterrors.ErrSCIMNotFound
+	errSCIMConflict = misterrors.ErrSCIMConflict
+	// LDAP errors
+	errLDAPInvalidCredentials = misterrors.ErrLDAPInvalidCredentials
+	// OAuth errors
+	errOAuthTokenInactive = misterrors.ErrOAuthTokenInactive
+	// outbox errors
+	errOutboxNoTransaction = misterrors.ErrOutboxNoTransaction
 )
 
 func ErrInvalidType(want string, got any) error {
-	return fmt.Errorf("%w :%s, actual value:%#v", errInvalidType, want, got)
+	return &misterrors.InvalidTypeError{Want: want, Got: got}
 }
 
 func ErrKeyNotFound(key string) error {
-	return fmt.Errorf("%w, key %s", errKeyNotFound, key)
+	return &misterrors.KeyError{Key: key}
 }
 
 func ErrSessionNotFound() error {
@@ -54,6 +101,19 @@ func ErrIdSessionNotFound() error {
 	return fmt.Errorf("%w", errIdSessionNotFound)
 }
 
+func ErrSessionRotationUnsupported() error {
+	return fmt.Errorf("%w", errSessionRotation)
+}
+
+func ErrSessionIDTaken(id string) error {
+	return fmt.Errorf("%w [%s]", errSessionIDTaken, id)
+}
+
+// IsSessionRotationUnsupported reports whether err reports a store unable to rotate IDs.
+func IsSessionRotationUnsupported(err error) bool {
+	return errors.Is(err, errSessionRotation)
+}
+
 func ErrVerificationFailed(err error) error {
 	return fmt.Errorf("%w, %w", errVerificationFailed, err)
 }
@@ -137,6 +197,140 @@ func ErrRouterConflict(val string) error {
 	return fmt.Errorf("%w [%s]", errRouterConflict, val)
 }
 
+// IsRouterConflict reports whether err reports a route registered twice.
+func IsRouterConflict(err error) bool {
+	return errors.Is(err, errRouterConflict)
+}
+
 func ErrRouterNotSymbolic(path string) error {
 	return fmt.Errorf("%w, [%s]", errRouterNotSymbolic, path)
 }
+
+func ErrRouteNameConflict(name string) error {
+	return fmt.Errorf("%w [%s]", errRouteNameConflict, name)
+}
+
+func ErrRouteNameNotFound(name string) error {
+	return fmt.Errorf("%w [%s]", errRouteNameNotFound, name)
+}
+
+func ErrRouteParamMissing(name string, param string) error {
+	return fmt.Errorf("%w: route %s requires parameter %s", errRouteParamMissing, name, param)
+}
+
+func ErrInvalidFrameAncestor(source string) error {
+	return fmt.Errorf("%w [%s]", errInvalidFrameAncestor, source)
+}
+
+func ErrInvalidResource(typ string) error {
+	return fmt.Errorf("%w [%s]", errInvalidResource, typ)
+}
+
+func ErrResourceTypeMissing(typ string) error {
+	return fmt.Errorf("%w [%s]", errResourceTypeMissing, typ)
+}
+
+func ErrServerShuttingDown() error {
+	return fmt.Errorf("%w", errServerShuttingDown)
+}
+
+func ErrNoListener() error {
+	return fmt.Errorf("%w", errNoListener)
+}
+
+func ErrNoFlashStore() error {
+	return fmt.Errorf("%w", errNoFlashStore)
+}
+
+func ErrResponseCommitted() error {
+	return fmt.Errorf("%w", errResponseCommitted)
+}
+
+func ErrScanFailed(reason string) error {
+	return fmt.Errorf("%w: %s", errScanFailed, reason)
+}
+
+func ErrStaticBackend(reason string) error {
+	return fmt.Errorf("%w: %s", errStaticBackend, reason)
+}
+
+func ErrStaticRedirectUnsupported() error {
+	return fmt.Errorf("%w", errStaticRedirect)
+}
+
+func ErrNoJobStore() error {
+	return fmt.Errorf("%w", errNoJobStore)
+}
+
+func ErrJobNotFound(id string) error {
+	return fmt.Errorf("%w [%s]", errJobNotFound, id)
+}
+
+// IsJobNotFound reports whether err reports a job missing from its store.
+func IsJobNotFound(err error) bool {
+	return errors.Is(err, errJobNotFound)
+}
+
+func ErrFlagNotFound(name string) error {
+	return fmt.Errorf("%w [%s]", errFlagNotFound, name)
+}
+
+func ErrFlagNameEmpty() error {
+	return fmt.Errorf("%w", errFlagNameEmpty)
+}
+
+func ErrInvalidBaggage(key string) error {
+	return fmt.Errorf("%w [%s]", errInvalidBaggage, key)
+}
+
+func ErrLockNotAcquired(key string) error {
+	return fmt.Errorf("%w [%s]", errLockNotAcquired, key)
+}
+
+func ErrLockNotHeld(key string) error {
+	return fmt.Errorf("%w [%s]", errLockNotHeld, key)
+}
+
+func ErrFlowStateNotFound(flow string) error {
+	return fmt.Errorf("%w [%s]", errFlowStateNotFound, flow)
+}
+
+func ErrMailQueueFull(subject string) error {
+	return fmt.Errorf("%w [%s]", errMailQueueFull, subject)
+}
+
+func ErrMailQueueClosed() error {
+	return fmt.Errorf("%w", errMailQueueClosed)
+}
+
+func ErrAccountTokenInvalid(purpose string) error {
+	return fmt.Errorf("%w [%s]", errAccountTokenInvalid, purpose)
+}
+
+func ErrAccountFlowRateLimited(purpose string) error {
+	return fmt.Errorf("%w [%s]", errAccountFlowRateLimited, purpose)
+}
+
+func ErrSAMLResponseInvalid(reason string) error {
+	return fmt.Errorf("%w: %s", errSAMLResponseInvalid, reason)
+}
+
+func ErrSCIMNotFound(resourceType string, id string) error {
+	return fmt.Errorf("%w [%s %s]", errSCIMNotFound, resourceType, id)
+}
+
+func ErrSCIMConflict(attribute string, value string) error {
+	return fmt.Errorf("%w: %s %q", errSCIMConflict, attribute, value)
+}
+
+func ErrLDAPInvalidCredentials(username string) error {
+	return fmt.Errorf("%w [%s]", errLDAPInvalidCredentials, username)
+}
+
+func ErrOAuthTokenInactive(reason string) error {
+	return fmt.Errorf("%w: %s", errOAuthTokenInactive, reason)
+}
+
+func ErrOutboxNoTransaction(reason string) error {
+	return fmt.Errorf("%w: %s", errOutboxNoTransaction, reason)
+}
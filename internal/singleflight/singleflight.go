@@ -0,0 +1,88 @@
+// Package singleflight runs a function once for concurrent callers of the same key, handing its
+// result to all of them.
+package singleflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group coalesces the calls of Do by key.
+type Group[T any] struct {
+	mutex sync.Mutex
+	calls map[string]*call[T]
+}
+
+// call is an in-flight or completed call of Do.
+type call[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Do runs fn unless a call of the same key is in flight, in which case it waits for that call
+// and returns its result. A panic of fn is propagated to its caller, and the waiting callers
+// receive an error.
+//
+// Parameters:
+//   - key: The key of the call.
+//   - fn: The function to run.
+//
+// Returns:
+//   - T: The result of fn.
+//   - error: The error of fn.
+//   - bool: Whether the result comes from the call of another caller.
+func (g *Group[T]) Do(key string, fn func() (T, error)) (T, error, bool) {
+	return g.DoContext(context.Background(), key, fn)
+}
+
+// DoContext is Do where callers waiting for the call of another caller stop waiting when ctx is
+// done, returning its error. The call itself goes on for the others.
+func (g *Group[T]) DoContext(ctx context.Context, key string, fn func() (T, error)) (T, error, bool) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		select {
+		case <-c.done:
+			return c.value, c.err, true
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err(), true
+		}
+	}
+	c := &call[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mutex.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("singleflight: call panicked: %v", r)
+			g.finish(key, c)
+			panic(r)
+		}
+		g.finish(key, c)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
+
+// Forget makes the next call of a key run even if one is in flight.
+func (g *Group[T]) Forget(key string) {
+	g.mutex.Lock()
+	delete(g.calls, key)
+	g.mutex.Unlock()
+}
+
+// finish releases the waiting callers of a call.
+func (g *Group[T]) finish(key string, c *call[T]) {
+	g.mutex.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mutex.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,324 @@
+package mist
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist/internal/errs"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JobState is the state of an asynchronous job.
+type JobState string
+
+const (
+	// JobPending reports a job accepted but not started yet.
+	JobPending JobState = "pending"
+	// JobRunning reports a job being run.
+	JobRunning JobState = "running"
+	// JobSucceeded reports a job completed with a result.
+	JobSucceeded JobState = "succeeded"
+	// JobFailed reports a job completed with an error.
+	JobFailed JobState = "failed"
+)
+
+// JobStatus is the status of an asynchronous job, as served by its status endpoint.
+//
+// Fields:
+//   - ID: The identifier of the job.
+//   - State: The state of the job.
+//   - Progress: The completion of the job, from 0 to 1, as reported by the job.
+//   - Message: A message of the job describing its progress, e.g. "importing row 1200".
+//   - Result: The JSON result of a succeeded job.
+//   - Error: The problem of a failed job, built like the responses of Context.RespondError.
+//   - CreatedAt, UpdatedAt: The times the job was accepted and last updated.
+type JobStatus struct {
+	ID        string          `json:"id"`
+	State     JobState        `json:"state"`
+	Progress  float64         `json:"progress"`
+	Message   string          `json:"message,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *Problem        `json:"error,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Done reports whether the job has completed, successfully or not.
+func (s JobStatus) Done() bool {
+	return s.State == JobSucceeded || s.State == JobFailed
+}
+
+// JobStore keeps the status of the asynchronous jobs. Implementations must be safe for
+// concurrent use; use a store shared by every instance, e.g. on Redis, when several instances
+// serve the API, so that any of them can answer the polls of a job.
+type JobStore interface {
+	// Save creates or replaces the status of a job.
+	Save(ctx context.Context, status JobStatus) error
+	// Get returns the status of a job, or an error wrapping errors.ErrJobNotFound.
+	Get(ctx context.Context, id string) (JobStatus, error)
+}
+
+// MemoryJobStore is a JobStore keeping the jobs in process memory, for single-instance servers
+// and tests. Completed jobs are forgotten after a retention period.
+type MemoryJobStore struct {
+	mutex     sync.Mutex
+	jobs      map[string]JobStatus
+	retention time.Duration
+	lastSweep time.Time
+}
+
+// InitMemoryJobStore creates an empty MemoryJobStore keeping completed jobs for 24 hours.
+func InitMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]JobStatus), retention: 24 * time.Hour}
+}
+
+// SetRetention sets how long completed jobs are kept, for their clients to fetch the results.
+func (m *MemoryJobStore) SetRetention(retention time.Duration) *MemoryJobStore {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retention = retention
+	return m
+}
+
+// Save stores the status of a job. Expired jobs are swept once a minute.
+func (m *MemoryJobStore) Save(_ context.Context, status JobStatus) error {
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, job := range m.jobs {
+			if m.expired(job, now) {
+				delete(m.jobs, id)
+			}
+		}
+		m.lastSweep = now
+	}
+	m.jobs[status.ID] = status
+	return nil
+}
+
+// Get returns the status of a job.
+func (m *MemoryJobStore) Get(_ context.Context, id string) (JobStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	status, ok := m.jobs[id]
+	if !ok || m.expired(status, time.Now()) {
+		return JobStatus{}, errs.ErrJobNotFound(id)
+	}
+	return status, nil
+}
+
+// expired reports whether a job is completed since longer than the retention.
+func (m *MemoryJobStore) expired(status JobStatus, now time.Time) bool {
+	return status.Done() && now.Sub(status.UpdatedAt) > m.retention
+}
+
+// Job is a long-running operation accepted with Context.AcceptAsync. It runs in the background
+// with a context detached from the request, and returns its result, serialized to JSON, or an
+// error.
+type Job func(ctx context.Context, progress *JobProgress) (any, error)
+
+// JobProgress reports the progress of a running job to its clients.
+type JobProgress struct {
+	ctx    context.Context
+	store  JobStore
+	mutex  sync.Mutex
+	status JobStatus
+}
+
+// Update records the progress of the job, clamped between 0 and 1, with a message for its
+// clients.
+//
+// Parameters:
+//   - fraction: The completion of the job, from 0 to 1.
+//   - message: A message describing the progress, or "".
+//
+// Returns:
+//   - error: The error of the store.
+func (p *JobProgress) Update(fraction float64, message string) error {
+	return p.save(func(status *JobStatus) {
+		status.Progress = min(max(fraction, 0), 1)
+		status.Message = message
+	})
+}
+
+// save applies change to the status of the job and stores it.
+func (p *JobProgress) save(change func(status *JobStatus)) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	change(&p.status)
+	p.status.UpdatedAt = time.Now()
+	return p.store.Save(p.ctx, p.status)
+}
+
+// jobRunner runs the jobs of a server and serves their status.
+type jobRunner struct {
+	store  JobStore
+	prefix string
+}
+
+// ServerWithJobs is a configuration function that returns an HTTPServerOption. It sets the
+// store of the jobs accepted with Context.AcceptAsync and registers their endpoints:
+//   - GET <prefix>/:id serves the JobStatus of a job; with a "wait" query parameter, e.g.
+//     "?wait=30s", the request is held until the job completes, for at most a minute, and
+//     answered with 204 No Content if it did not, see Context.LongPoll,
+//   - GET <prefix>/:id/result serves the result of a succeeded job as is, the problem of a
+//     failed one, and 409 Conflict while the job runs.
+//
+// Parameters:
+//   - store: The store of the jobs, e.g. InitMemoryJobStore().
+//   - prefix: The path of the endpoints, e.g. "/jobs".
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified store.
+func ServerWithJobs(store JobStore, prefix string) HTTPServerOption {
+	return func(server *HTTPServer) {
+		runner := &jobRunner{store: store, prefix: prefix}
+		server.jobs = runner
+		server.GET(prefix+"/:id", runner.serveStatus)
+		server.GET(prefix+"/:id/result", runner.serveResult)
+	}
+}
+
+// AcceptAsync starts a long-running job in the background and answers the request with
+// 202 Accepted, the JobStatus of the job and a Location header pointing to its status
+// endpoint, which clients poll until the job completes, see ServerWithJobs. The job is run
+// with Context.Async, so that a graceful shutdown waits for it.
+//
+// Example:
+//
+//	server.POST("/exports", func(ctx *mist.Context) {
+//	    _ = ctx.AcceptAsync(func(jctx context.Context, progress *mist.JobProgress) (any, error) {
+//	        for i, table := range tables {
+//	            _ = progress.Update(float64(i)/float64(len(tables)), "exporting "+table)
+//	            ...
+//	        }
+//	        return map[string]string{"url": exportURL}, nil
+//	    })
+//	})
+//
+// Parameters:
+//   - job: The job.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrNoJobStore if the server has no job store,
+//     errors.ErrServerShuttingDown if it is shutting down, or the error of the store.
+func (c *Context) AcceptAsync(job Job) error {
+	if c.jobs == nil {
+		return errs.ErrNoJobStore()
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	now := time.Now()
+	status := JobStatus{ID: hex.EncodeToString(id), State: JobPending, CreatedAt: now, UpdatedAt: now}
+	store := c.jobs.store
+	if err := store.Save(c.Request.Context(), status); err != nil {
+		return err
+	}
+	err := c.Async(func(detached *Context) {
+		ctx := detached.CopyToContext(context.Background())
+		detached.runJob(&JobProgress{ctx: ctx, store: store, status: status}, job)
+	})
+	if err != nil {
+		status.State, status.UpdatedAt = JobFailed, time.Now()
+		status.Error = &Problem{Status: http.StatusServiceUnavailable, Title: http.StatusText(http.StatusServiceUnavailable)}
+		_ = store.Save(c.Request.Context(), status)
+		return err
+	}
+	c.Header("Location", c.jobs.prefix+"/"+status.ID)
+	c.Header("Retry-After", "1")
+	return c.RespondWithJSON(http.StatusAccepted, status)
+}
+
+// runJob runs a job and records its outcome. A panicking job is recorded as failed before the
+// panic is passed on to the async panic handler.
+func (c *Context) runJob(progress *JobProgress, job Job) {
+	_ = progress.save(func(status *JobStatus) { status.State = JobRunning })
+	defer func() {
+		if r := recover(); r != nil {
+			c.finishJob(progress, nil, fmt.Errorf("job panic: %v", r))
+			panic(r)
+		}
+	}()
+	result, err := job(progress.ctx, progress)
+	c.finishJob(progress, result, err)
+}
+
+// finishJob records the outcome of a job.
+func (c *Context) finishJob(progress *JobProgress, result any, err error) {
+	var data []byte
+	if err == nil {
+		data, err = json.Marshal(result)
+	}
+	_ = progress.save(func(status *JobStatus) {
+		if err != nil {
+			p := c.problemFor(err)
+			if p.Title == "" {
+				p.Title = http.StatusText(p.Status)
+			}
+			status.State, status.Error = JobFailed, &p
+			return
+		}
+		status.State, status.Progress, status.Result = JobSucceeded, 1, data
+	})
+}
+
+// serveStatus serves the status of a job.
+func (r *jobRunner) serveStatus(ctx *Context) {
+	id := ctx.PathValue("id").StringOrDefault("")
+	status, err := r.store.Get(ctx.Request.Context(), id)
+	if err != nil {
+		r.respondStoreError(ctx, err)
+		return
+	}
+	wait, _ := time.ParseDuration(ctx.Request.URL.Query().Get("wait"))
+	if wait > 0 && !status.Done() {
+		_ = ctx.LongPoll(nil, min(wait, time.Minute), func() (any, bool) {
+			if latest, err := r.store.Get(ctx.Request.Context(), id); err == nil {
+				status = latest
+			}
+			return status, status.Done()
+		})
+		return
+	}
+	ctx.Header("Cache-Control", "no-store")
+	if !status.Done() {
+		ctx.Header("Retry-After", "1")
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, status)
+}
+
+// serveResult serves the result of a job.
+func (r *jobRunner) serveResult(ctx *Context) {
+	status, err := r.store.Get(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		r.respondStoreError(ctx, err)
+		return
+	}
+	switch status.State {
+	case JobSucceeded:
+		ctx.Header("Content-Type", "application/json")
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = status.Result
+	case JobFailed:
+		_ = ctx.RespondProblem(*status.Error)
+	default:
+		ctx.Header("Location", r.prefix+"/"+status.ID)
+		_ = ctx.RespondProblem(Problem{Status: http.StatusConflict, Detail: "the job has not completed yet"})
+	}
+}
+
+// respondStoreError answers a request for a missing job, or failing store.
+func (r *jobRunner) respondStoreError(ctx *Context, err error) {
+	if errs.IsJobNotFound(err) {
+		_ = ctx.RespondProblem(Problem{Status: http.StatusNotFound, Detail: "the job does not exist or has expired"})
+		return
+	}
+	_ = ctx.RespondProblem(Problem{Status: http.StatusServiceUnavailable, Detail: "the job status is unavailable, retry later"})
+}
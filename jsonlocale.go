@@ -0,0 +1,224 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/i18n"
+	"reflect"
+	"time"
+)
+
+// JSONLocalizer rewrites the values of JSON responses for display in the locale of the client,
+// e.g. timestamps as "17.10.2026 15:04" and amounts of money as "1.234,50 €" for a German
+// client, for clients rendering responses without formatting them. It is opt-in per request:
+// responses are only localized for clients asking for a locale with the "locale" query
+// parameter or, when the localizer lists supported locales, the Accept-Language header.
+//
+// The formats are registered per Go type with RegisterJSONFormat; by default time.Time is
+// written with i18n.FormatDateTime and i18n.Money with i18n.FormatMoney.
+type JSONLocalizer struct {
+	param    string
+	locales  []string
+	location *time.Location
+	formats  map[reflect.Type]func(locale string, v any) any
+}
+
+// InitJSONLocalizer creates a JSONLocalizer formatting time.Time and i18n.Money values.
+//
+// Example:
+//
+//	localizer := mist.InitJSONLocalizer("en-US", "de", "fr").SetLocation(paris)
+//	server := mist.InitHTTPServer(mist.ServerWithJSONLocalizer(localizer))
+//
+// Parameters:
+//   - locales: The locales negotiated with the Accept-Language header of the requests; none
+//     localizes only the responses of requests with the query parameter, in any locale.
+//
+// Returns:
+//   - *JSONLocalizer: The initialized localizer.
+func InitJSONLocalizer(locales ...string) *JSONLocalizer {
+	l := &JSONLocalizer{param: "locale", locales: locales, formats: make(map[reflect.Type]func(string, any) any)}
+	RegisterJSONFormat(l, func(locale string, t time.Time) any {
+		if l.location != nil {
+			t = t.In(l.location)
+		}
+		return i18n.FormatDateTime(locale, t)
+	})
+	RegisterJSONFormat(l, func(locale string, m i18n.Money) any {
+		return i18n.FormatMoney(locale, m)
+	})
+	return l
+}
+
+// SetQueryParam sets the name of the query parameter carrying the locale asked for, "locale"
+// by default; an empty name ignores the query.
+func (l *JSONLocalizer) SetQueryParam(name string) *JSONLocalizer {
+	l.param = name
+	return l
+}
+
+// SetLocation sets the time zone timestamps are displayed in, in place of their own.
+func (l *JSONLocalizer) SetLocation(loc *time.Location) *JSONLocalizer {
+	l.location = loc
+	return l
+}
+
+// RegisterJSONFormat registers the format of the values of type T in localized responses,
+// replacing the format of that type, if any. Values of T are replaced by the result of fn,
+// typically a string, wherever they appear in a response, including behind pointers.
+//
+// Example:
+//
+//	mist.RegisterJSONFormat(localizer, func(locale string, d Distance) any {
+//	    return i18n.FormatNumber(locale, d.Kilometers(), 1) + " km"
+//	})
+//
+// Parameters:
+//   - l: The localizer.
+//   - fn: The format of T in a locale.
+//
+// Returns:
+//   - *JSONLocalizer: The localizer, for chaining.
+func RegisterJSONFormat[T any](l *JSONLocalizer, fn func(locale string, v T) any) *JSONLocalizer {
+	l.formats[reflect.TypeOf((*T)(nil)).Elem()] = func(locale string, v any) any {
+		return fn(locale, v.(T))
+	}
+	return l
+}
+
+// Apply returns val with the values of the registered types formatted for locale, as a value
+// to pass to json.Marshal. Structs are turned into maps honouring their `json` tags, as
+// FieldSet.Apply does; types implementing json.Marshaler that are not registered keep their
+// own encoding.
+//
+// Parameters:
+//   - locale: The locale, e.g. "de-CH".
+//   - val: The response payload.
+//
+// Returns:
+//   - any: The localized payload.
+func (l *JSONLocalizer) Apply(locale string, val any) any {
+	return l.localize(reflect.ValueOf(val), locale)
+}
+
+// localize walks v and formats the values of the registered types.
+func (l *JSONLocalizer) localize(v reflect.Value, locale string) any {
+	for {
+		if !v.IsValid() || !v.CanInterface() {
+			return nil
+		}
+		if format, ok := l.formats[v.Type()]; ok {
+			return format(locale, v.Interface())
+		}
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			break
+		}
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Type().Implements(marshalerType) || reflect.PointerTo(v.Type()).Implements(marshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		res := make(map[string]any)
+		for _, f := range cachedJSONFields(v.Type()) {
+			fv, err := v.FieldByIndexErr(f.index)
+			if err != nil {
+				// A nil embedded pointer: encoding/json skips these fields as well.
+				continue
+			}
+			if f.omitEmpty && isEmptyJSONValue(fv) {
+				continue
+			}
+			res[f.name] = l.localize(fv, locale)
+		}
+		return res
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		if v.IsNil() {
+			return nil
+		}
+		res := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			res[iter.Key().String()] = l.localize(iter.Value(), locale)
+		}
+		return res
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+		res := make([]any, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res[i] = l.localize(v.Index(i), locale)
+		}
+		return res
+	default:
+		return v.Interface()
+	}
+}
+
+// locale returns the locale the response of a request is localized for, "" for none, and
+// whether it was negotiated with the Accept-Language header.
+func (l *JSONLocalizer) locale(c *Context) (string, bool) {
+	if l.param != "" {
+		if asked := c.Request.URL.Query().Get(l.param); asked != "" {
+			if len(l.locales) > 0 {
+				return i18n.Match(asked, l.locales...), false
+			}
+			if validLocale(asked) {
+				return i18n.Normalize(asked), false
+			}
+			return "", false
+		}
+	}
+	if len(l.locales) == 0 {
+		return "", false
+	}
+	return i18n.Match(c.Request.Header.Get("Accept-Language"), l.locales...), true
+}
+
+// validLocale reports whether s looks like a locale tag, such as "en" or "pt_BR", so that it
+// can be echoed in the Content-Language header.
+func validLocale(s string) bool {
+	if len(s) > 35 {
+		return false
+	}
+	for _, r := range s {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return s[0] != '-' && s[0] != '_'
+}
+
+// ServerWithJSONLocalizer is a configuration function that returns an HTTPServerOption. It sets
+// the localizer of the JSON responses sent with RespondWithJSON.
+//
+// Parameters:
+//   - localizer: The localizer, e.g. InitJSONLocalizer("en", "de").
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified localizer.
+func ServerWithJSONLocalizer(localizer *JSONLocalizer) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.jsonLocalizer = localizer
+	}
+}
+
+// JSONLocale returns the locale the JSON responses of the request are localized for, "" when
+// they are not localized.
+func (c *Context) JSONLocale() string {
+	if c.jsonLocalizer == nil {
+		return ""
+	}
+	locale, _ := c.jsonLocalizer.locale(c)
+	return locale
+}
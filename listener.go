@@ -0,0 +1,168 @@
+package mist
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/dormoron/mist/internal/errs"
+	"net"
+	"net/http"
+)
+
+// ListenerOption configures a listener declared with HTTPServer.Listen.
+type ListenerOption func(l *listener)
+
+// listener is a network address the server accepts connections on, with the TLS
+// configuration, the middleware and the protocol configuration specific to it.
+type listener struct {
+	addr     string
+	name     string
+	tls      *tls.Config
+	mils     []Middleware
+	protocol *ProtocolConfig
+}
+
+// listenerCtxKey is the key of the listener that accepted a request in the context of the
+// request, so that the requests dispatched again through ServeHTTP from inside it, e.g. by the
+// batch package, run the middleware of the same listener.
+type listenerCtxKey struct{}
+
+// handler returns the handler serving the requests accepted on the listener.
+func (l *listener) handler(s *HTTPServer) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		request = request.WithContext(context.WithValue(request.Context(), listenerCtxKey{}, l))
+		s.serve(writer, request, l)
+	})
+}
+
+// TLS serves the listener over TLS. The configuration must provide the certificates, through
+// Certificates or GetCertificate; HTTP/2 is negotiated unless NextProtos says otherwise.
+func TLS(cfg *tls.Config) ListenerOption {
+	return func(l *listener) {
+		l.tls = cfg
+	}
+}
+
+// ListenerName names the listener, e.g. "internal" or "public". The name is reported by
+// Context.Listener and defaults to the address of the listener.
+func ListenerName(name string) ListenerOption {
+	return func(l *listener) {
+		l.name = name
+	}
+}
+
+// ListenerMiddleware sets middleware run for the requests accepted on the listener only, before
+// the middleware of the routes, e.g. an authentication required on the public port but not on
+// the internal one.
+func ListenerMiddleware(mils ...Middleware) ListenerOption {
+	return func(l *listener) {
+		l.mils = append(l.mils, mils...)
+	}
+}
+
+// Listen declares an address the server accepts connections on. Every listener serves the
+// same routes; Serve starts them all, so that a server can, for instance, answer in plaintext
+// on an internal port and over TLS on the public one:
+//
+//	server.Listen("127.0.0.1:8080", mist.ListenerName("internal")).
+//	    Listen(":8443", mist.ListenerName("public"), mist.TLS(cfg), mist.ListenerMiddleware(auth)).
+//	    Serve()
+//
+// Parameters:
+//   - addr: The TCP address to listen on, e.g. ":8443".
+//   - opts: The options of the listener.
+//
+// Returns:
+//   - *HTTPServer: The server, for chaining.
+func (s *HTTPServer) Listen(addr string, opts ...ListenerOption) *HTTPServer {
+	l := &listener{addr: addr, name: addr}
+	for _, opt := range opts {
+		opt(l)
+	}
+	s.listeners = append(s.listeners, l)
+	return s
+}
+
+// Serve starts every listener declared with Listen and blocks until the server stops. All the
+// addresses are bound before any is served, so that a busy port fails the whole start. When a
+// listener fails, the others are closed.
+//
+// Returns:
+//   - error: http.ErrServerClosed once Shutdown has been called, or the error of the first
+//     listener to fail.
+func (s *HTTPServer) Serve() error {
+	if len(s.listeners) == 0 {
+		return errs.ErrNoListener()
+	}
+	served, err := s.startListeners(s.listeners)
+	if err != nil {
+		return err
+	}
+	err = <-served
+	if !errors.Is(err, http.ErrServerClosed) {
+		s.closeServers()
+	}
+	return err
+}
+
+// closeServers closes the servers of the listeners at once, when one of them failed.
+func (s *HTTPServer) closeServers() {
+	s.srvsMutex.Lock()
+	srvs := s.srvs
+	s.srvsMutex.Unlock()
+	for _, srv := range srvs {
+		_ = srv.Close()
+	}
+}
+
+// startListeners binds the addresses of the listeners, then serves each of them in its own
+// goroutine. The returned channel receives the result of every listener.
+func (s *HTTPServer) startListeners(ls []*listener) (<-chan error, error) {
+	nls := make([]net.Listener, 0, len(ls))
+	for _, l := range ls {
+		nl, err := net.Listen("tcp", l.addr)
+		if err != nil {
+			for _, opened := range nls {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		nls = append(nls, nl)
+	}
+
+	srvs := make([]*http.Server, len(ls))
+	for i, l := range ls {
+		srvs[i] = s.newHTTPServer(l)
+	}
+	s.srvsMutex.Lock()
+	if s.closed {
+		// Shutdown was called before the servers were stored.
+		s.srvsMutex.Unlock()
+		for _, nl := range nls {
+			_ = nl.Close()
+		}
+		return nil, http.ErrServerClosed
+	}
+	s.srvs = srvs
+	s.srvsMutex.Unlock()
+
+	served := make(chan error, len(ls))
+	for i, l := range ls {
+		srv, nl := srvs[i], nls[i]
+		if l.tls != nil {
+			go func() { served <- srv.ServeTLS(nl, "", "") }()
+		} else {
+			go func() { served <- srv.Serve(nl) }()
+		}
+	}
+	return served, nil
+}
+
+// Listener returns the name of the listener that accepted the request, see
+// HTTPServer.Listen, or the address passed to Start.
+func (c *Context) Listener() string {
+	if c.listener == nil {
+		return ""
+	}
+	return c.listener.name
+}
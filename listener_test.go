@@ -0,0 +1,54 @@
+package mist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestListenerMiddlewareSubRequest checks that a request dispatched again through ServeHTTP from
+// inside a request accepted on a listener, as the batch package does, runs the middleware of
+// that listener.
+func TestListenerMiddlewareSubRequest(t *testing.T) {
+	server := InitHTTPServer()
+	server.GET("/secret", func(ctx *Context) {
+		_ = ctx.RespondWithJSON(http.StatusOK, "SECRET")
+	})
+	server.POST("/batch", func(ctx *Context) {
+		req := httptest.NewRequest(http.MethodGet, "/secret", nil).WithContext(ctx.Request.Context())
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, req)
+		_ = ctx.RespondWithJSON(recorder.Code, recorder.Body.String())
+	})
+	public := &listener{addr: ":8443", name: "public", mils: []Middleware{
+		func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				if ctx.Request.URL.Path == "/secret" {
+					ctx.AbortWithStatus(http.StatusUnauthorized)
+					return
+				}
+				next(ctx)
+			}
+		},
+	}}
+	handler := public.handler(server)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/secret", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("direct request: status = %d, want 401", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/batch", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("sub-request: status = %d %s, want 401", recorder.Code, recorder.Body)
+	}
+
+	// Outside of any listener, the server serves the route as a plain http.Handler.
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/secret", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("plain handler: status = %d, want 200", recorder.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package mist
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const (
+	// longPollMinInterval and longPollMaxInterval bound the delay between two polls of
+	// LongPoll: polling starts fast and slows down while nothing happens.
+	longPollMinInterval = 50 * time.Millisecond
+	longPollMaxInterval = time.Second
+)
+
+// LongPoll holds the request until poll reports a result or wait elapses, as a lighter
+// alternative to server-sent events and WebSockets for clients waiting for changes. poll is
+// called immediately, then repeatedly with a delay growing from 50ms to 1s.
+//   - When poll reports a result, it is sent as a JSON response with status 200.
+//   - When wait elapses first, the response is 204 No Content and the client polls again.
+//   - When ctx or the request is cancelled, for example because the client disconnected,
+//     nothing is sent and the cancellation error is returned.
+//
+// Responses carry "Cache-Control: no-store" so that intermediaries never serve a stale poll.
+//
+// Example:
+//
+//	server.GET("/jobs/:id/status", func(ctx *mist.Context) {
+//	    id := ctx.PathValue("id").StringOrDefault("")
+//	    _ = ctx.LongPoll(ctx, 30*time.Second, func() (any, bool) {
+//	        job := jobs.Get(id)
+//	        return job, job.Done()
+//	    })
+//	})
+//
+// Parameters:
+//   - ctx: A context bounding the wait in addition to the request context; nil uses the
+//     request context only.
+//   - wait: The maximum time to hold the request.
+//   - poll: The function checking for a result; it reports false while there is none.
+//
+// Returns:
+//   - error: The cancellation error if ctx or the request was cancelled, an encoding error if
+//     the result cannot be marshalled, nil otherwise.
+func (c *Context) LongPoll(ctx context.Context, wait time.Duration, poll func() (any, bool)) error {
+	if poll == nil {
+		return nil
+	}
+	if ctx == nil {
+		ctx = c.Request.Context()
+	}
+	reqDone := c.Request.Context().Done()
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	c.Header("Cache-Control", "no-store")
+
+	interval := longPollMinInterval
+	for {
+		if val, ok := poll(); ok {
+			data, err := json.Marshal(val)
+			if err != nil {
+				return err
+			}
+			c.Header("Content-Type", "application/json")
+			c.RespStatusCode = http.StatusOK
+			c.RespData = data
+			return nil
+		}
+
+		tick := time.NewTimer(interval)
+		select {
+		case <-tick.C:
+		case <-timeout.C:
+			tick.Stop()
+			c.RespStatusCode = http.StatusNoContent
+			return nil
+		case <-ctx.Done():
+			tick.Stop()
+			return ctx.Err()
+		case <-reqDone:
+			tick.Stop()
+			return c.Request.Context().Err()
+		}
+		if interval *= 2; interval > longPollMaxInterval {
+			interval = longPollMaxInterval
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DKIMSigner signs messages with DomainKeys Identified Mail (RFC 6376), so that receivers can
+// verify they were sent by the domain, using relaxed canonicalization of the headers and the
+// body.
+type DKIMSigner struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+	headers  []string
+}
+
+// InitDKIMSigner creates a DKIMSigner signing the From, To, Cc, Reply-To, Subject, Date,
+// Message-ID, MIME-Version and Content-Type headers, when present, and the body.
+//
+// Parameters:
+//   - domain: The signing domain, e.g. "shop.example".
+//   - selector: The selector of the public key, published in the TXT record
+//     "{selector}._domainkey.{domain}".
+//   - key: The private key, an *rsa.PrivateKey (rsa-sha256) or an ed25519.PrivateKey
+//     (ed25519-sha256).
+//
+// Returns:
+//   - *DKIMSigner: The initialized signer.
+//   - error: An error if the key is of another type.
+func InitDKIMSigner(domain string, selector string, key crypto.Signer) (*DKIMSigner, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey, ed25519.PrivateKey:
+	default:
+		return nil, fmt.Errorf("mailer: unsupported DKIM key type %T", key)
+	}
+	return &DKIMSigner{
+		domain:   domain,
+		selector: selector,
+		key:      key,
+		headers:  []string{"From", "To", "Cc", "Reply-To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"},
+	}, nil
+}
+
+// Sign returns a message with its DKIM-Signature header prepended.
+//
+// Parameters:
+//   - raw: The message, as encoded by Message.Bytes.
+//
+// Returns:
+//   - []byte: The signed message.
+//   - error: An error if the message has no header section or the signing failed.
+func (s *DKIMSigner) Sign(raw []byte) ([]byte, error) {
+	head, body, ok := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !ok {
+		return nil, fmt.Errorf("mailer: message has no header section")
+	}
+	fields := parseHeaderFields(string(head) + "\r\n")
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	var signed []string
+	h := sha256.New()
+	for _, name := range s.headers {
+		// The last occurrence of a header is signed, as receivers look for it first.
+		for i := len(fields) - 1; i >= 0; i-- {
+			if strings.EqualFold(fields[i].name, name) {
+				h.Write([]byte(relaxedHeader(fields[i].name, fields[i].value) + "\r\n"))
+				signed = append(signed, strings.ToLower(name))
+				break
+			}
+		}
+	}
+
+	algorithm := "rsa-sha256"
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+	}
+	value := "v=1; a=" + algorithm + "; c=relaxed/relaxed; d=" + s.domain + "; s=" + s.selector +
+		"; t=" + strconv.FormatInt(time.Now().Unix(), 10) + "; h=" + strings.Join(signed, ":") +
+		"; bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + "; b="
+	h.Write([]byte(relaxedHeader("DKIM-Signature", value)))
+	digest := h.Sum(nil)
+
+	var opts crypto.SignerOpts = crypto.SHA256
+	if algorithm == "ed25519-sha256" {
+		opts = crypto.Hash(0)
+	}
+	signature, err := s.key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: DKIM signing failed: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("DKIM-Signature: " + value + foldBase64(base64.StdEncoding.EncodeToString(signature)) + "\r\n")
+	out.Write(raw)
+	return out.Bytes(), nil
+}
+
+// headerField is a header of a message, its value unfolded.
+type headerField struct {
+	name  string
+	value string
+}
+
+// parseHeaderFields splits a header section into its fields, keeping the continuation lines
+// of folded fields in their value.
+func parseHeaderFields(head string) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(head, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields = append(fields, headerField{name: name, value: value})
+	}
+	return fields
+}
+
+// relaxedHeader canonicalizes a header with the relaxed algorithm: lowercase name, unfolded
+// value with runs of whitespace reduced to a space, without leading or trailing whitespace.
+func relaxedHeader(name string, value string) string {
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.Join(strings.Fields(value), " ")
+}
+
+// relaxedBody canonicalizes a body with the relaxed algorithm: runs of whitespace reduced to a
+// space, no whitespace at the end of lines and no empty lines at the end of the body.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		for strings.Contains(line, "\t") || strings.Contains(line, "  ") {
+			line = strings.ReplaceAll(strings.ReplaceAll(line, "\t", " "), "  ", " ")
+		}
+		lines[i] = line
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// foldBase64 folds a base64 value over lines of 72 characters, as the header would otherwise
+// exceed the line length limit of SMTP.
+func foldBase64(value string) string {
+	var b strings.Builder
+	for len(value) > 72 {
+		b.WriteString(value[:72] + "\r\n\t")
+		value = value[72:]
+	}
+	b.WriteString(value)
+	return b.String()
+}
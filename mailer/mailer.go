@@ -0,0 +1,130 @@
+// Package mailer sends the emails of an application, such as account verification and
+// password reset messages, through SMTP, Amazon SES or SendGrid. Bodies are rendered from
+// templates with the template engines of mist, and a Queue sends them in the background so
+// that requests do not wait for the mail server:
+//
+//	engine := &mist.GoTemplateEngine{}
+//	_ = engine.LoadFromGlob("mail/*.html")
+//	transport := mailer.InitSMTPTransport("smtp.example.com", 587, user, password)
+//	m := mailer.InitMailer(transport).SetFrom("Shop <no-reply@shop.example>").SetTemplates(engine, nil)
+//	queue := mailer.InitQueue(m, 2, 100)
+//	defer queue.Close(context.Background())
+//	...
+//	msg := &mailer.Message{To: []string{user.Email}, Subject: "Confirm your email"}
+//	if err := m.Render(ctx, msg, "confirm", data); err == nil {
+//	    _ = queue.Enqueue(msg)
+//	}
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist"
+)
+
+// Transport delivers messages.
+type Transport interface {
+	// Send delivers a message.
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Mailer renders and sends messages.
+type Mailer struct {
+	transport Transport
+	from      string
+	html      mist.TemplateEngine
+	text      mist.TemplateEngine
+}
+
+// InitMailer creates a Mailer.
+//
+// Parameters:
+//   - transport: The transport delivering the messages, e.g. an SMTPTransport.
+//
+// Returns:
+//   - *Mailer: The initialized mailer.
+func InitMailer(transport Transport) *Mailer {
+	return &Mailer{transport: transport}
+}
+
+// SetFrom sets the sender of the messages that do not name one.
+func (m *Mailer) SetFrom(from string) *Mailer {
+	m.from = from
+	return m
+}
+
+// SetTemplates sets the engines rendering the bodies: the template "{name}.html" of html
+// renders the HTML body and the template "{name}.txt" of text the plain text one. Either may
+// be nil. The HTML engine should escape its data, as a GoTemplateEngine of html/template does.
+func (m *Mailer) SetTemplates(html mist.TemplateEngine, text mist.TemplateEngine) *Mailer {
+	m.html = html
+	m.text = text
+	return m
+}
+
+// Send sends a message, from the default sender when it names none.
+//
+// Parameters:
+//   - ctx: The context of the delivery.
+//   - msg: The message.
+//
+// Returns:
+//   - error: An error if the message is invalid or could not be delivered.
+func (m *Mailer) Send(ctx context.Context, msg *Message) error {
+	if msg.From == "" {
+		msg.From = m.from
+	}
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	return m.transport.Send(ctx, msg)
+}
+
+// Render renders the bodies of a message from the templates of a name, see SetTemplates.
+//
+// Parameters:
+//   - ctx: The context of the rendering.
+//   - msg: The message whose HTML and Text bodies are set.
+//   - name: The name of the templates, without extension.
+//   - data: The data of the templates.
+//
+// Returns:
+//   - error: An error if a template failed, or if no engine has a template of that name.
+func (m *Mailer) Render(ctx context.Context, msg *Message, name string, data any) error {
+	var firstErr error
+	rendered := false
+	for _, target := range []struct {
+		engine mist.TemplateEngine
+		ext    string
+		body   *string
+	}{{m.html, ".html", &msg.HTML}, {m.text, ".txt", &msg.Text}} {
+		if target.engine == nil {
+			continue
+		}
+		out, err := target.engine.Render(ctx, name+target.ext, data)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		*target.body = string(out)
+		rendered = true
+	}
+	// A missing template is fine as long as the other body was rendered.
+	if !rendered {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("no template engine configured")
+		}
+		return fmt.Errorf("mailer: rendering %q: %w", name, firstErr)
+	}
+	return nil
+}
+
+// SendTemplate renders the bodies of a message with Render and sends it.
+func (m *Mailer) SendTemplate(ctx context.Context, msg *Message, name string, data any) error {
+	if err := m.Render(ctx, msg, name, data); err != nil {
+		return err
+	}
+	return m.Send(ctx, msg)
+}
@@ -0,0 +1,247 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Message is an email.
+//
+// Fields:
+//   - From: The sender, e.g. "Shop <no-reply@shop.example>"; the default sender of the mailer
+//     when empty.
+//   - To, Cc, Bcc: The recipients. Bcc recipients receive the message without being listed in
+//     it.
+//   - ReplyTo: The address replies go to, if not the sender.
+//   - Subject: The subject.
+//   - Text, HTML: The plain text and HTML bodies; at least one is required. When both are set,
+//     clients show the one they support best.
+//   - Headers: Additional headers, e.g. "List-Unsubscribe".
+//   - Attachments: The attached files.
+type Message struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	ReplyTo     string
+	Subject     string
+	Text        string
+	HTML        string
+	Headers     map[string]string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Recipients returns the addresses of all the recipients, To, Cc and Bcc, without their names.
+//
+// Returns:
+//   - []string: The addresses.
+//   - error: An error if an address is malformed.
+func (m *Message) Recipients() ([]string, error) {
+	var addrs []string
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, raw := range list {
+			addr, err := mail.ParseAddress(raw)
+			if err != nil {
+				return nil, fmt.Errorf("mailer: invalid recipient %q: %w", raw, err)
+			}
+			addrs = append(addrs, addr.Address)
+		}
+	}
+	return addrs, nil
+}
+
+// validate checks that a message can be sent.
+func (m *Message) validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("mailer: invalid sender %q: %w", m.From, err)
+	}
+	if len(m.To)+len(m.Cc)+len(m.Bcc) == 0 {
+		return fmt.Errorf("mailer: message %q has no recipient", m.Subject)
+	}
+	if _, err := m.Recipients(); err != nil {
+		return err
+	}
+	if m.ReplyTo != "" {
+		if _, err := mail.ParseAddress(m.ReplyTo); err != nil {
+			return fmt.Errorf("mailer: invalid reply-to address %q: %w", m.ReplyTo, err)
+		}
+	}
+	if m.Text == "" && m.HTML == "" {
+		return fmt.Errorf("mailer: message %q has no body", m.Subject)
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("mailer: subject %q contains a line break", m.Subject)
+	}
+	for name, value := range m.Headers {
+		if strings.ContainsAny(name+value, "\r\n") || strings.ContainsAny(name, ": ") {
+			return fmt.Errorf("mailer: invalid header %q", name)
+		}
+	}
+	return nil
+}
+
+// Bytes encodes the message in the Internet Message Format (RFC 5322), as sent over SMTP.
+// Bcc recipients are not listed.
+//
+// Returns:
+//   - []byte: The encoded message, with CRLF line endings.
+//   - error: An error if the message is invalid.
+func (m *Message) Bytes() ([]byte, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	from, _ := mail.ParseAddress(m.From)
+	var buf bytes.Buffer
+	header := func(name string, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	if len(m.To) > 0 {
+		header("To", formatList(m.To))
+	}
+	if len(m.Cc) > 0 {
+		header("Cc", formatList(m.Cc))
+	}
+	if m.ReplyTo != "" {
+		replyTo, _ := mail.ParseAddress(m.ReplyTo)
+		header("Reply-To", replyTo.String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header(textproto.CanonicalMIMEHeaderKey(name), mime.QEncoding.Encode("utf-8", m.Headers[name]))
+	}
+	header("MIME-Version", "1.0")
+
+	bodyHeader, body := m.body()
+	if len(m.Attachments) == 0 {
+		for _, name := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := bodyHeader.Get(name); value != "" {
+				header(name, value)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+	mixed := multipart.NewWriter(&buf)
+	header("Content-Type", `multipart/mixed; boundary="`+mixed.Boundary()+`"`)
+	buf.WriteString("\r\n")
+	part, _ := mixed.CreatePart(bodyHeader)
+	part.Write(body)
+	for _, att := range m.Attachments {
+		contentType := att.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		filename := mime.QEncoding.Encode("utf-8", att.Filename)
+		part, _ = mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		writeBase64(part, att.Data)
+	}
+	mixed.Close()
+	return buf.Bytes(), nil
+}
+
+// body encodes the text and HTML bodies, as a single part or as a multipart/alternative one
+// when both are set, and returns the headers and the content of the part.
+func (m *Message) body() (textproto.MIMEHeader, []byte) {
+	var buf bytes.Buffer
+	if m.Text == "" || m.HTML == "" {
+		contentType, content := "text/plain; charset=utf-8", m.Text
+		if m.HTML != "" {
+			contentType, content = "text/html; charset=utf-8", m.HTML
+		}
+		writeQuotedPrintable(&buf, content)
+		return textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes()
+	}
+	alt := multipart.NewWriter(&buf)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, _ := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		writeQuotedPrintable(w, part.content)
+	}
+	alt.Close()
+	return textproto.MIMEHeader{
+		"Content-Type": {`multipart/alternative; boundary="` + alt.Boundary() + `"`},
+	}, buf.Bytes()
+}
+
+// writeQuotedPrintable writes a body in quoted-printable encoding, with CRLF line endings.
+func writeQuotedPrintable(w io.Writer, content string) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\n", "\r\n")
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(content))
+	qp.Close()
+}
+
+// writeBase64 writes data in base64 encoding, in lines of 76 characters.
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
+
+// formatList formats a list of addresses for a header.
+func formatList(list []string) string {
+	formatted := make([]string, 0, len(list))
+	for _, raw := range list {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			continue
+		}
+		formatted = append(formatted, addr.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// messageID returns a unique Message-ID in the domain of the sender.
+func messageID(from string) string {
+	domain := "localhost"
+	if _, d, ok := strings.Cut(from, "@"); ok {
+		domain = d
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">"
+}
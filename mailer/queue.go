@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist/internal/errs"
+	"sync"
+	"time"
+)
+
+// Queue sends messages in the background with a pool of workers, retrying failed deliveries.
+type Queue struct {
+	mailer   *Mailer
+	messages chan *Message
+	attempts int
+	backoff  time.Duration
+	onError  func(msg *Message, err error)
+
+	mutex    sync.RWMutex
+	closed   bool
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// InitQueue creates a Queue and starts its workers. Deliveries are attempted 3 times, 1 second
+// apart then doubling, and messages that still fail are printed.
+//
+// Parameters:
+//   - mailer: The mailer sending the messages.
+//   - workers: The number of messages sent at the same time.
+//   - size: The number of messages waiting to be sent beyond which Enqueue fails.
+//
+// Returns:
+//   - *Queue: The started queue.
+func InitQueue(mailer *Mailer, workers int, size int) *Queue {
+	q := &Queue{
+		mailer:   mailer,
+		messages: make(chan *Message, size),
+		attempts: 3,
+		backoff:  time.Second,
+		onError: func(msg *Message, err error) {
+			fmt.Printf("%s - mailer: %q to %v not sent: %v\n", time.Now().Format(time.RFC3339), msg.Subject, msg.To, err)
+		},
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < max(workers, 1); i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// SetRetry sets the number of delivery attempts of a message and the wait before the first
+// retry, doubled at each retry.
+func (q *Queue) SetRetry(attempts int, backoff time.Duration) *Queue {
+	q.attempts = max(attempts, 1)
+	q.backoff = backoff
+	return q
+}
+
+// OnError sets the handler of the messages that could not be delivered.
+func (q *Queue) OnError(fn func(msg *Message, err error)) *Queue {
+	q.onError = fn
+	return q
+}
+
+// Enqueue queues a message for delivery, from the default sender of the mailer when it names
+// none.
+//
+// Parameters:
+//   - msg: The message, not to be modified afterwards.
+//
+// Returns:
+//   - error: An error if the message is invalid, or wrapping errors.ErrMailQueueFull or
+//     errors.ErrMailQueueClosed.
+func (q *Queue) Enqueue(msg *Message) error {
+	if msg.From == "" {
+		msg.From = q.mailer.from
+	}
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		return errs.ErrMailQueueClosed()
+	}
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return errs.ErrMailQueueFull(msg.Subject)
+	}
+}
+
+// Close stops accepting messages and waits until the queued ones are sent or ctx is done, in
+// which case pending retries are abandoned. It may be called again, e.g. after a first call timed
+// out.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.messages)
+	}
+	q.mutex.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		q.stopOnce.Do(func() { close(q.stop) })
+		return ctx.Err()
+	}
+}
+
+// work sends the queued messages until the queue is closed.
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for msg := range q.messages {
+		backoff := q.backoff
+		var err error
+		for attempt := 1; attempt <= q.attempts; attempt++ {
+			if err = q.mailer.Send(context.Background(), msg); err == nil {
+				break
+			}
+			if attempt == q.attempts {
+				break
+			}
+			select {
+			case <-time.After(backoff):
+			case <-q.stop:
+				attempt = q.attempts
+			}
+			backoff *= 2
+		}
+		if err != nil && q.onError != nil {
+			q.onError(msg, err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// SendGridTransport sends messages through the v3 Mail Send API of SendGrid, which signs them
+// with the DKIM keys of the authenticated domain.
+type SendGridTransport struct {
+	apiKey   string
+	endpoint string
+	client   *http.Client
+}
+
+// InitSendGridTransport creates a SendGridTransport.
+//
+// Parameters:
+//   - apiKey: An API key with the Mail Send permission.
+//
+// Returns:
+//   - *SendGridTransport: The initialized transport.
+func InitSendGridTransport(apiKey string) *SendGridTransport {
+	return &SendGridTransport{
+		apiKey:   apiKey,
+		endpoint: "https://api.sendgrid.com/v3/mail/send",
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetEndpoint sets the URL of the Mail Send API, e.g. "https://api.eu.sendgrid.com/v3/mail/send"
+// for the EU region.
+func (t *SendGridTransport) SetEndpoint(endpoint string) *SendGridTransport {
+	t.endpoint = endpoint
+	return t
+}
+
+// SetClient sets the HTTP client calling the API.
+func (t *SendGridTransport) SetClient(client *http.Client) *SendGridTransport {
+	t.client = client
+	return t
+}
+
+// Send sends a message.
+func (t *SendGridTransport) Send(ctx context.Context, msg *Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	personalization := map[string]any{}
+	for key, list := range map[string][]string{"to": msg.To, "cc": msg.Cc, "bcc": msg.Bcc} {
+		if len(list) > 0 {
+			personalization[key] = sendGridAddresses(list)
+		}
+	}
+	var content []map[string]string
+	if msg.Text != "" {
+		content = append(content, map[string]string{"type": "text/plain", "value": msg.Text})
+	}
+	if msg.HTML != "" {
+		content = append(content, map[string]string{"type": "text/html", "value": msg.HTML})
+	}
+	payload := map[string]any{
+		"personalizations": []any{personalization},
+		"from":             sendGridAddresses([]string{msg.From})[0],
+		"subject":          msg.Subject,
+		"content":          content,
+	}
+	if msg.ReplyTo != "" {
+		payload["reply_to"] = sendGridAddresses([]string{msg.ReplyTo})[0]
+	}
+	if len(msg.Headers) > 0 {
+		payload["headers"] = msg.Headers
+	}
+	if len(msg.Attachments) > 0 {
+		attachments := make([]map[string]any, 0, len(msg.Attachments))
+		for _, att := range msg.Attachments {
+			attachment := map[string]any{"content": att.Data, "filename": att.Filename}
+			if att.ContentType != "" {
+				attachment["type"] = att.ContentType
+			}
+			attachments = append(attachments, attachment)
+		}
+		payload["attachments"] = attachments
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	if err = do(t.client, req, body); err != nil {
+		return fmt.Errorf("mailer: sending through SendGrid: %w", err)
+	}
+	return nil
+}
+
+// sendGridAddresses converts addresses, validated beforehand, to SendGrid email objects.
+func sendGridAddresses(list []string) []map[string]string {
+	addrs := make([]map[string]string, 0, len(list))
+	for _, raw := range list {
+		addr, _ := mail.ParseAddress(raw)
+		entry := map[string]string{"email": addr.Address}
+		if addr.Name != "" {
+			entry["name"] = addr.Name
+		}
+		addrs = append(addrs, entry)
+	}
+	return addrs
+}
+
+// do sends a request with a body and fails on statuses other than 2xx.
+func do(client *http.Client, req *http.Request, body []byte) error {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist/internal/awsv4"
+	"net/http"
+	"time"
+)
+
+// SESTransport sends messages through the API of Amazon SES (v2), as raw messages so that
+// they can carry attachments and a DKIM signature.
+type SESTransport struct {
+	region       string
+	accessKeyID  string
+	secretKey    string
+	sessionToken string
+	endpoint     string
+	dkim         *DKIMSigner
+	client       *http.Client
+}
+
+// InitSESTransport creates an SESTransport.
+//
+// Parameters:
+//   - region: The AWS region of SES, e.g. "eu-west-1".
+//   - accessKeyID, secretAccessKey: The credentials of an identity allowed ses:SendEmail.
+//
+// Returns:
+//   - *SESTransport: The initialized transport.
+func InitSESTransport(region string, accessKeyID string, secretAccessKey string) *SESTransport {
+	return &SESTransport{
+		region:      region,
+		accessKeyID: accessKeyID,
+		secretKey:   secretAccessKey,
+		endpoint:    "https://email." + region + ".amazonaws.com",
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetSessionToken sets the session token of temporary credentials.
+func (t *SESTransport) SetSessionToken(token string) *SESTransport {
+	t.sessionToken = token
+	return t
+}
+
+// SetEndpoint sets the base URL of the API, e.g. for a VPC endpoint.
+func (t *SESTransport) SetEndpoint(endpoint string) *SESTransport {
+	t.endpoint = endpoint
+	return t
+}
+
+// SetDKIM sets the signer of the messages, for domains whose DKIM is not handled by SES.
+func (t *SESTransport) SetDKIM(signer *DKIMSigner) *SESTransport {
+	t.dkim = signer
+	return t
+}
+
+// SetClient sets the HTTP client calling the API.
+func (t *SESTransport) SetClient(client *http.Client) *SESTransport {
+	t.client = client
+	return t
+}
+
+// Send sends a message with the SendEmail action.
+func (t *SESTransport) Send(ctx context.Context, msg *Message) error {
+	raw, err := encode(msg, t.dkim)
+	if err != nil {
+		return err
+	}
+	recipients, _ := msg.Recipients()
+	body, err := json.Marshal(map[string]any{
+		"Content":     map[string]any{"Raw": map[string]any{"Data": raw}},
+		"Destination": map[string]any{"ToAddresses": recipients},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint+"/v2/email/outbound-emails", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	creds := awsv4.Credentials{AccessKeyID: t.accessKeyID, SecretKey: t.secretKey, SessionToken: t.sessionToken}
+	awsv4.Sign(req, body, creds, t.region, "ses", time.Now())
+	if err = do(t.client, req, body); err != nil {
+		return fmt.Errorf("mailer: sending through SES: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPTransport sends messages through an SMTP server. Connections use implicit TLS on port
+// 465 and STARTTLS otherwise, when the server offers it.
+type SMTPTransport struct {
+	host      string
+	port      int
+	auth      smtp.Auth
+	tlsConfig *tls.Config
+	localName string
+	dkim      *DKIMSigner
+	timeout   time.Duration
+}
+
+// InitSMTPTransport creates an SMTPTransport authenticating with PLAIN when a username is
+// given. Sending a message times out after 30 seconds.
+//
+// Parameters:
+//   - host: The host name of the server, e.g. "smtp.example.com".
+//   - port: The port of the server, e.g. 587 for submission with STARTTLS or 465 for implicit
+//     TLS.
+//   - username, password: The credentials; "" to send without authentication.
+//
+// Returns:
+//   - *SMTPTransport: The initialized transport.
+func InitSMTPTransport(host string, port int, username string, password string) *SMTPTransport {
+	t := &SMTPTransport{
+		host:      host,
+		port:      port,
+		tlsConfig: &tls.Config{ServerName: host},
+		localName: "localhost",
+		timeout:   30 * time.Second,
+	}
+	if username != "" {
+		t.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return t
+}
+
+// SetAuth sets the authentication mechanism, e.g. smtp.CRAMMD5Auth.
+func (t *SMTPTransport) SetAuth(auth smtp.Auth) *SMTPTransport {
+	t.auth = auth
+	return t
+}
+
+// SetTLSConfig sets the TLS configuration of the connections.
+func (t *SMTPTransport) SetTLSConfig(config *tls.Config) *SMTPTransport {
+	t.tlsConfig = config
+	return t
+}
+
+// SetLocalName sets the host name sent in the HELO/EHLO command.
+func (t *SMTPTransport) SetLocalName(name string) *SMTPTransport {
+	t.localName = name
+	return t
+}
+
+// SetDKIM sets the signer of the messages.
+func (t *SMTPTransport) SetDKIM(signer *DKIMSigner) *SMTPTransport {
+	t.dkim = signer
+	return t
+}
+
+// SetTimeout sets the time limit of sending a message, when ctx has no earlier deadline.
+func (t *SMTPTransport) SetTimeout(timeout time.Duration) *SMTPTransport {
+	t.timeout = timeout
+	return t
+}
+
+// Send sends a message over a new connection.
+func (t *SMTPTransport) Send(ctx context.Context, msg *Message) error {
+	raw, err := encode(msg, t.dkim)
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(msg.From)
+	recipients, _ := msg.Recipients()
+
+	deadline := time.Now().Add(t.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	addr := net.JoinHostPort(t.host, strconv.Itoa(t.port))
+	dialer := &net.Dialer{Deadline: deadline}
+	var conn net.Conn
+	if t.port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: t.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("mailer: connecting to %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(deadline)
+	// Closing the connection interrupts the exchange when ctx is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: connecting to %s: %w", addr, err)
+	}
+	defer client.Close()
+	if err = t.exchange(client, from.Address, recipients, raw); err != nil {
+		return fmt.Errorf("mailer: sending through %s: %w", addr, err)
+	}
+	return nil
+}
+
+// exchange runs the SMTP commands sending a message.
+func (t *SMTPTransport) exchange(client *smtp.Client, from string, recipients []string, raw []byte) error {
+	if err := client.Hello(t.localName); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok && t.port != 465 {
+		if err := client.StartTLS(t.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if t.auth != nil {
+		if err := client.Auth(t.auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(raw); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// encode encodes a message and signs it when a signer is given.
+func encode(msg *Message, dkim *DKIMSigner) ([]byte, error) {
+	raw, err := msg.Bytes()
+	if err != nil || dkim == nil {
+		return raw, err
+	}
+	return dkim.Sign(raw)
+}
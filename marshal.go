@@ -0,0 +1,48 @@
+package mist
+
+import "log"
+
+// MarshalErrorHandler handles the failure of RespondWithJSON to serialize a value, e.g. a
+// value holding a channel, a function or an unsupported float such as NaN.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - val: The value that could not be serialized.
+//   - err: The serialization error.
+type MarshalErrorHandler func(ctx *Context, val any, err error)
+
+// ServerWithMarshalErrorHandler sets the handler called when RespondWithJSON fails to
+// serialize a value. The default, DefaultMarshalErrorHandler, responds with a 500 problem
+// instead of leaving an empty 200 behind handlers that ignore the error. A nil handler leaves
+// the response untouched.
+//
+// Parameters:
+//   - handler: The handler of serialization failures.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified handler.
+func ServerWithMarshalErrorHandler(handler MarshalErrorHandler) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.marshalErrorHandler = handler
+	}
+}
+
+// DefaultMarshalErrorHandler logs the serialization error with the type of the offending
+// value and the request, and responds with a 500 problem details body whose code is
+// "internal"; the error text is not exposed to the client.
+func DefaultMarshalErrorHandler(ctx *Context, val any, err error) {
+	log.Printf("mist: failed to marshal JSON response of type %T for %s %s: %v",
+		val, ctx.Request.Method, ctx.Request.URL.Path, err)
+	_ = ctx.RespondError(err)
+}
+
+// MustRespondJSON sends a JSON response like RespondWithJSON but returns nothing to check:
+// serialization failures are handled by the MarshalErrorHandler of the server. It suits
+// linters flagging the ignored error of RespondWithJSON, and never panics.
+//
+// Parameters:
+//   - status: The HTTP status code of the response.
+//   - val: The value to serialize.
+func (c *Context) MustRespondJSON(status int, val any) {
+	_ = c.RespondWithJSON(status, val)
+}
@@ -0,0 +1,58 @@
+package mist
+
+import "maps"
+
+// Route is a registered route, returned by the registration methods so that metadata can be
+// attached to it.
+type Route struct {
+	node *node
+}
+
+// Meta attaches a metadata value to the route, such as the owning team or the latency
+// objective, for ownership-aware alerting and documentation generation. Handlers and
+// middleware read it with Context.RouteMeta, and tooling through RouteTrees. Metadata must be
+// attached before the server starts handling requests.
+//
+// Example:
+//
+//	server.POST("/payments", createPayment).
+//	    Meta("owner", "payments-team").
+//	    Meta("sla_ms", 200)
+//
+// Parameters:
+//   - key: The metadata key.
+//   - value: The metadata value.
+//
+// Returns:
+//   - *Route: The route, for chaining.
+func (r *Route) Meta(key string, value any) *Route {
+	if r.node.meta == nil {
+		r.node.meta = make(map[string]any, 1)
+	}
+	r.node.meta[key] = value
+	return r
+}
+
+// Pattern returns the pattern the route was registered with.
+func (r *Route) Pattern() string {
+	return r.node.route
+}
+
+// RouteMeta returns a metadata value attached to the matched route with Route.Meta.
+//
+// Parameters:
+//   - key: The metadata key.
+//
+// Returns:
+//   - any: The value.
+//   - bool: Whether the matched route has a value for key; false when no route matched.
+func (c *Context) RouteMeta(key string) (any, bool) {
+	val, ok := c.routeMeta[key]
+	return val, ok
+}
+
+// RouteMetadata returns a copy of all the metadata attached to the matched route, nil when
+// there is none.
+func (c *Context) RouteMetadata() map[string]any {
+	return maps.Clone(c.routeMeta)
+}
@@ -3,6 +3,7 @@ package accesslog
 import (
 	"encoding/json"
 	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/redact"
 	"log"
 )
 
@@ -38,6 +39,15 @@ type MiddlewareBuilder struct {
 	// The behavior of logging—where and how the log messages are output—is determined by the implementation
 	// of this function provided by the user.
 	logFunc func(log string)
+
+	// baggageKeys lists the W3C Baggage members included in the access log, see LogBaggage.
+	baggageKeys []string
+
+	// headerNames lists the request headers included in the access log, see LogHeaders.
+	headerNames []string
+
+	// redactor masks the sensitive query parameters and headers; nil means redact.Default().
+	redactor *redact.Redactor
 }
 
 // LogFunc assigns a custom logging function to the MiddlewareBuilder instance. This method is used
@@ -75,6 +85,55 @@ func (b *MiddlewareBuilder) LogFunc(fn func(log string)) *MiddlewareBuilder {
 	return b
 }
 
+// LogBaggage includes members of the request's W3C Baggage, such as the tenant or the
+// experiment arm, in the access log. Only the listed members are logged, since baggage may carry
+// values that must not end up in logs.
+//
+// Parameters:
+//
+//	keys: The names of the baggage members to log.
+//
+// Returns:
+//
+//	*MiddlewareBuilder: A pointer to the current instance of the MiddlewareBuilder, allowing for additional
+//	                     configuration calls to be chained.
+func (b *MiddlewareBuilder) LogBaggage(keys ...string) *MiddlewareBuilder {
+	b.baggageKeys = append(b.baggageKeys, keys...)
+	return b
+}
+
+// LogHeaders includes request headers in the access log. Sensitive headers, such as
+// Authorization, are masked by the redactor.
+//
+// Parameters:
+//
+//	names: The names of the headers to log.
+//
+// Returns:
+//
+//	*MiddlewareBuilder: A pointer to the current instance of the MiddlewareBuilder, allowing for additional
+//	                     configuration calls to be chained.
+func (b *MiddlewareBuilder) LogHeaders(names ...string) *MiddlewareBuilder {
+	b.headerNames = append(b.headerNames, names...)
+	return b
+}
+
+// SetRedactor sets the redactor masking the sensitive query parameters and headers of the
+// access log, in place of the process-wide redact.Default().
+//
+// Parameters:
+//
+//	r: The redactor.
+//
+// Returns:
+//
+//	*MiddlewareBuilder: A pointer to the current instance of the MiddlewareBuilder, allowing for additional
+//	                     configuration calls to be chained.
+func (b *MiddlewareBuilder) SetRedactor(r *redact.Redactor) *MiddlewareBuilder {
+	b.redactor = r
+	return b
+}
+
 // InitMiddleware initializes a new instance of the MiddlewareBuilder struct with default
 // configuration settings. It sets up a standard logging function that will log access
 // events using the Go standard library's log package. The returned MiddlewareBuilder
@@ -128,13 +187,42 @@ func (b *MiddlewareBuilder) Build() mist.Middleware {
 			// This deferred function creates an access log struct containing relevant request information,
 			// marshals it to JSON, and then logs it using the `logFunc` defined in the MiddlewareBuilder.
 			defer func() {
+				redactor := b.redactor
+				if redactor == nil {
+					redactor = redact.Default()
+				}
+				rawQuery := ctx.Request.URL.RawQuery
 				// Compile access log information into a struct from the provided context `ctx`.
 				log := accessLog{
-					Host:       ctx.Request.Host,     // Hostname from the HTTP request
-					StatusCode: ctx.RespStatusCode,   // status code the HTTP request
-					Route:      ctx.MatchedRoute,     // The route pattern matched for the request
-					Method:     ctx.Request.Method,   // HTTP method, e.g., GET, POST
-					Path:       ctx.Request.URL.Path, // Request path
+					Host:       ctx.Request.Host,         // Hostname from the HTTP request
+					StatusCode: ctx.RespStatusCode,       // status code the HTTP request
+					Route:      ctx.RoutePattern(),       // The route pattern matched for the request
+					Handler:    ctx.HandlerName(),        // The handler serving the route
+					Method:     ctx.Request.Method,       // HTTP method, e.g., GET, POST
+					Path:       ctx.Request.URL.Path,     // Request path
+					Query:      redactor.Query(rawQuery), // Raw query string, sensitive parameters masked
+				}
+				if len(b.headerNames) > 0 {
+					header := redactor.Header(ctx.Request.Header)
+					for _, name := range b.headerNames {
+						if value := header.Get(name); value != "" {
+							if log.Headers == nil {
+								log.Headers = make(map[string]string, len(b.headerNames))
+							}
+							log.Headers[name] = value
+						}
+					}
+				}
+				if len(b.baggageKeys) > 0 {
+					baggage := ctx.Baggage()
+					for _, key := range b.baggageKeys {
+						if value, ok := baggage.Get(key); ok {
+							if log.Baggage == nil {
+								log.Baggage = make(map[string]string, len(b.baggageKeys))
+							}
+							log.Baggage[key] = value
+						}
+					}
 				}
 				// Convert the access log struct to JSON format.
 				data, _ := json.Marshal(log)
@@ -175,9 +263,15 @@ func (b *MiddlewareBuilder) Build() mist.Middleware {
 // An instance of accessLog is created and populated with data from an HTTP request context and then marshalled into JSON.
 // The JSON output is then passed to a logging function to record the incoming requests being handled by an HTTP server.
 type accessLog struct {
-	Host       string `json:"host,omitempty"`   // The server host name or IP address from the HTTP request.
-	Route      string `json:"route,omitempty"`  // The matched route pattern for the request.
-	Method     string `json:"method,omitempty"` // The method used in the request (e.g., GET, POST).
-	Path       string `json:"path,omitempty"`   // The path of the HTTP request URL.
-	StatusCode int    `json:"status,omitempty"` //The statusCode of the HTTP request status.
+	Host       string `json:"host,omitempty"`    // The server host name or IP address from the HTTP request.
+	Route      string `json:"route,omitempty"`   // The matched route pattern for the request.
+	Handler    string `json:"handler,omitempty"` // The name of the handler serving the route.
+	Method     string `json:"method,omitempty"`  // The method used in the request (e.g., GET, POST).
+	Path       string `json:"path,omitempty"`    // The path of the HTTP request URL.
+	Query      string `json:"query,omitempty"`   // The raw query string of the HTTP request URL.
+	StatusCode int    `json:"status,omitempty"`  //The statusCode of the HTTP request status.
+	// Baggage holds the W3C Baggage members selected with LogBaggage.
+	Baggage map[string]string `json:"baggage,omitempty"`
+	// Headers holds the request headers selected with LogHeaders, sensitive ones masked.
+	Headers map[string]string `json:"headers,omitempty"`
 }
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package budget
+
+import "time"
+
+// processCPU is not supported on this platform; CPU time is reported as zero.
+func processCPU() time.Duration {
+	return 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package budget
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPU returns the user and system CPU time consumed by the process so far.
+func processCPU() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
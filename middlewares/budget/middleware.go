@@ -0,0 +1,215 @@
+// Package budget accounts for the resources spent by each request — wall time, CPU time, heap
+// allocations and the time contributed by handlers with Context.AddTiming, such as database
+// time — to pinpoint expensive endpoints.
+//
+// CPU time and allocations are sampled from process-wide counters before and after the
+// request, so they are exact for requests served alone and approximate under concurrency;
+// aggregated per route in metrics they still rank endpoints reliably.
+package budget
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+	"runtime/metrics"
+	"time"
+)
+
+// Usage is the resource usage of a request.
+//
+// Fields:
+//   - Route: The matched route pattern, or "unknown".
+//   - Method: The HTTP method of the request.
+//   - Duration: The wall time of the request handling.
+//   - CPU: The process CPU time consumed while handling the request.
+//   - AllocBytes: The bytes allocated on the heap while handling the request.
+//   - AllocObjects: The heap objects allocated while handling the request.
+//   - Timings: The time contributed by the handler with Context.AddTiming, e.g. "db".
+type Usage struct {
+	Route        string
+	Method       string
+	Duration     time.Duration
+	CPU          time.Duration
+	AllocBytes   uint64
+	AllocObjects uint64
+	Timings      []mist.Timing
+}
+
+// Budget sets the resources a request is expected to stay within. Zero fields are unlimited.
+//
+// Fields:
+//   - Duration: The maximum wall time.
+//   - CPU: The maximum CPU time.
+//   - AllocBytes: The maximum heap allocation in bytes.
+type Budget struct {
+	Duration   time.Duration
+	CPU        time.Duration
+	AllocBytes uint64
+}
+
+// exceeded reports whether usage goes over the budget.
+func (b Budget) exceeded(usage Usage) bool {
+	return (b.Duration > 0 && usage.Duration > b.Duration) ||
+		(b.CPU > 0 && usage.CPU > b.CPU) ||
+		(b.AllocBytes > 0 && usage.AllocBytes > b.AllocBytes)
+}
+
+// MiddlewareBuilder builds the accounting middleware.
+type MiddlewareBuilder struct {
+	serverTiming bool
+	budget       Budget
+	onExceeded   func(ctx *mist.Context, usage Usage)
+	onUsage      func(ctx *mist.Context, usage Usage)
+
+	allocBytes *prometheus.HistogramVec
+	cpuSeconds *prometheus.HistogramVec
+	timings    *prometheus.HistogramVec
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder that reports the wall time ("total") and
+// CPU time ("cpu") of each request in the Server-Timing header, next to the timings added by
+// handlers. Metrics and budgets are disabled until configured.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{serverTiming: true}
+}
+
+// SetServerTiming sets whether the request's total and CPU time are added to the Server-Timing
+// header. Disable it for public endpoints where the timings should not be disclosed.
+func (b *MiddlewareBuilder) SetServerTiming(enabled bool) *MiddlewareBuilder {
+	b.serverTiming = enabled
+	return b
+}
+
+// SetBudget sets the budget of requests. Requests exceeding it are reported to the OnExceeded
+// hook.
+func (b *MiddlewareBuilder) SetBudget(budget Budget) *MiddlewareBuilder {
+	b.budget = budget
+	return b
+}
+
+// OnExceeded sets the hook called with the usage of requests exceeding the budget, e.g. to log
+// them with their route and parameters.
+func (b *MiddlewareBuilder) OnExceeded(fn func(ctx *mist.Context, usage Usage)) *MiddlewareBuilder {
+	b.onExceeded = fn
+	return b
+}
+
+// OnUsage sets the hook called with the usage of every request, e.g. to export it to a custom
+// backend.
+func (b *MiddlewareBuilder) OnUsage(fn func(ctx *mist.Context, usage Usage)) *MiddlewareBuilder {
+	b.onUsage = fn
+	return b
+}
+
+// SetMetrics records the usage in Prometheus histograms, labelled with the route pattern and
+// method, and registers them with the default registry:
+//   - <namespace>_<subsystem>_request_alloc_bytes: heap bytes allocated per request,
+//   - <namespace>_<subsystem>_request_cpu_seconds: CPU time per request,
+//   - <namespace>_<subsystem>_request_timing_seconds: time added with Context.AddTiming,
+//     with the additional label name.
+//
+// It panics if the histograms are already registered.
+func (b *MiddlewareBuilder) SetMetrics(namespace string, subsystem string) *MiddlewareBuilder {
+	labels := []string{"pattern", "method"}
+	b.allocBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_alloc_bytes",
+		Help:      "Heap bytes allocated while handling a request.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, labels)
+	b.cpuSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_cpu_seconds",
+		Help:      "CPU time consumed while handling a request.",
+		Buckets:   prometheus.DefBuckets,
+	}, labels)
+	b.timings = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "request_timing_seconds",
+		Help:      "Time contributed to a request by handlers, such as database time.",
+		Buckets:   prometheus.DefBuckets,
+	}, append(labels, "name"))
+	prometheus.MustRegister(b.allocBytes, b.cpuSeconds, b.timings)
+	return b
+}
+
+// Build creates the middleware. Register it early in the chain so that the usage covers the
+// other middleware too.
+//
+// Returns:
+//   - mist.Middleware: The accounting middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			before := readAllocs()
+			cpu := processCPU()
+			start := time.Now()
+
+			next(ctx)
+
+			after := readAllocs()
+			usage := Usage{
+				Route:        ctx.MatchedRoute,
+				Method:       ctx.Request.Method,
+				Duration:     time.Since(start),
+				CPU:          processCPU() - cpu,
+				AllocBytes:   after.bytes - before.bytes,
+				AllocObjects: after.objects - before.objects,
+				Timings:      ctx.Timings(),
+			}
+			if usage.Route == "" {
+				usage.Route = "unknown"
+			}
+			b.report(ctx, usage)
+		}
+	}
+}
+
+// report publishes the usage of a request.
+func (b *MiddlewareBuilder) report(ctx *mist.Context, usage Usage) {
+	if b.serverTiming {
+		ctx.AddTiming("total", usage.Duration)
+		ctx.AddTiming("cpu", usage.CPU)
+	}
+	if b.allocBytes != nil {
+		b.allocBytes.WithLabelValues(usage.Route, usage.Method).Observe(float64(usage.AllocBytes))
+		b.cpuSeconds.WithLabelValues(usage.Route, usage.Method).Observe(usage.CPU.Seconds())
+		for _, t := range usage.Timings {
+			b.timings.WithLabelValues(usage.Route, usage.Method, t.Name).Observe(t.Duration.Seconds())
+		}
+	}
+	if b.onUsage != nil {
+		b.onUsage(ctx, usage)
+	}
+	if b.onExceeded != nil && b.budget.exceeded(usage) {
+		b.onExceeded(ctx, usage)
+	}
+}
+
+// allocs is a sample of the cumulative heap allocation counters.
+type allocs struct {
+	bytes   uint64
+	objects uint64
+}
+
+// readAllocs samples the cumulative heap allocation counters of the runtime.
+func readAllocs() allocs {
+	samples := []metrics.Sample{
+		{Name: "/gc/heap/allocs:bytes"},
+		{Name: "/gc/heap/allocs:objects"},
+	}
+	metrics.Read(samples)
+	var a allocs
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		a.bytes = samples[0].Value.Uint64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		a.objects = samples[1].Value.Uint64()
+	}
+	return a
+}
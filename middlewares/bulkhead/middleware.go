@@ -0,0 +1,270 @@
+// Package bulkhead isolates subsystems of an API from each other. Each route group gets its
+// own bulkhead: a budget of concurrent requests, so that a slow subsystem saturating its
+// budget does not take the workers of the rest of the API, and panic isolation with a
+// breaker, so that a subsystem panicking repeatedly is switched off for a while instead of
+// burning resources on every request.
+//
+//	reports := server.Group("/reports", bulkhead.InitMiddlewareBuilder("reports", 20).
+//	    SetMaxWait(200 * time.Millisecond).
+//	    SetBreaker(5, time.Minute, 30*time.Second).
+//	    Build())
+package bulkhead
+
+import (
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Reason tells why a bulkhead rejected a request.
+type Reason string
+
+const (
+	// ReasonSaturated reports a request that found no free slot within the maximum wait.
+	ReasonSaturated Reason = "saturated"
+	// ReasonOpen reports a request arriving while the breaker is open.
+	ReasonOpen Reason = "open"
+)
+
+// MiddlewareBuilder builds a bulkhead middleware. One builder is one bulkhead: the middleware
+// it builds share the budget and the breaker.
+type MiddlewareBuilder struct {
+	name     string
+	slots    chan struct{}
+	maxWait  time.Duration
+	onPanic  func(ctx *mist.Context, recovered any)
+	onReject func(ctx *mist.Context, reason Reason)
+	onTrip   func(name string, panics int)
+
+	mutex     sync.Mutex
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	panics    []time.Time
+	openUntil time.Time
+
+	rejected *prometheus.CounterVec
+	panicked prometheus.Counter
+	trips    prometheus.Counter
+}
+
+// InitMiddlewareBuilder creates a bulkhead serving at most maxConcurrent requests at once.
+// Requests beyond are rejected immediately with 503, panics are recovered into a 500 problem
+// response, and the breaker is disabled until configured with SetBreaker.
+//
+// Parameters:
+//   - name: The name of the bulkhead, used in metrics and hooks, e.g. "reports".
+//   - maxConcurrent: The number of requests served at once; it panics if it is not positive,
+//     since the bulkhead would reject every request.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(name string, maxConcurrent int) *MiddlewareBuilder {
+	if maxConcurrent <= 0 {
+		panic(fmt.Sprintf("bulkhead: %s: maxConcurrent must be positive, got %d", name, maxConcurrent))
+	}
+	return &MiddlewareBuilder{
+		name:  name,
+		slots: make(chan struct{}, maxConcurrent),
+	}
+}
+
+// SetMaxWait sets how long a request waits for a free slot before being rejected.
+func (b *MiddlewareBuilder) SetMaxWait(d time.Duration) *MiddlewareBuilder {
+	b.maxWait = d
+	return b
+}
+
+// SetBreaker trips the breaker when threshold panics happen within window: while it is open,
+// for cooldown, every request is rejected with 503 without reaching the handlers. The panic
+// count starts over when the breaker closes.
+func (b *MiddlewareBuilder) SetBreaker(threshold int, window time.Duration, cooldown time.Duration) *MiddlewareBuilder {
+	b.threshold = threshold
+	b.window = window
+	b.cooldown = cooldown
+	return b
+}
+
+// OnPanic sets the hook called with every recovered panic, e.g. to log it with its stack.
+func (b *MiddlewareBuilder) OnPanic(fn func(ctx *mist.Context, recovered any)) *MiddlewareBuilder {
+	b.onPanic = fn
+	return b
+}
+
+// OnReject sets the hook called for every rejected request.
+func (b *MiddlewareBuilder) OnReject(fn func(ctx *mist.Context, reason Reason)) *MiddlewareBuilder {
+	b.onReject = fn
+	return b
+}
+
+// OnTrip sets the hook called when the breaker opens, with the number of panics of the window.
+func (b *MiddlewareBuilder) OnTrip(fn func(name string, panics int)) *MiddlewareBuilder {
+	b.onTrip = fn
+	return b
+}
+
+// SetMetrics exports the state of the bulkhead, with the const label bulkhead set to its name,
+// and registers the metrics with the default registry:
+//   - <namespace>_<subsystem>_bulkhead_in_flight: requests being served,
+//   - <namespace>_<subsystem>_bulkhead_rejected_total: rejected requests, by reason,
+//   - <namespace>_<subsystem>_bulkhead_panics_total: recovered panics,
+//   - <namespace>_<subsystem>_bulkhead_trips_total: times the breaker opened.
+//
+// It panics if the metrics of a bulkhead with the same name are already registered.
+func (b *MiddlewareBuilder) SetMetrics(namespace string, subsystem string) *MiddlewareBuilder {
+	labels := prometheus.Labels{"bulkhead": b.name}
+	inFlight := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "bulkhead_in_flight",
+		Help:        "Requests being served by the bulkhead.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(len(b.slots)) })
+	b.rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "bulkhead_rejected_total",
+		Help:        "Requests rejected by the bulkhead.",
+		ConstLabels: labels,
+	}, []string{"reason"})
+	b.panicked = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "bulkhead_panics_total",
+		Help:        "Panics recovered by the bulkhead.",
+		ConstLabels: labels,
+	})
+	b.trips = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Subsystem:   subsystem,
+		Name:        "bulkhead_trips_total",
+		Help:        "Times the breaker of the bulkhead opened.",
+		ConstLabels: labels,
+	})
+	prometheus.MustRegister(inFlight, b.rejected, b.panicked, b.trips)
+	return b
+}
+
+// Build creates the middleware. Apply it to a group so that the routes of the group share
+// the bulkhead.
+//
+// Returns:
+//   - mist.Middleware: The bulkhead middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			if retry, open := b.open(); open {
+				b.reject(ctx, ReasonOpen, retry)
+				return
+			}
+			if !b.acquire(ctx) {
+				b.reject(ctx, ReasonSaturated, time.Second)
+				return
+			}
+			defer func() { <-b.slots }()
+			defer func() {
+				if r := recover(); r != nil {
+					// net/http aborts the response on ErrAbortHandler; it is no failure.
+					if r == http.ErrAbortHandler {
+						panic(r)
+					}
+					b.recordPanic(ctx, r)
+				}
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// acquire takes a slot, waiting up to the maximum wait.
+func (b *MiddlewareBuilder) acquire(ctx *mist.Context) bool {
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if b.maxWait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Request.Context().Done():
+		return false
+	}
+}
+
+// open reports whether the breaker is open and for how long it remains so.
+func (b *MiddlewareBuilder) open() (time.Duration, bool) {
+	if b.threshold <= 0 {
+		return 0, false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	remaining := time.Until(b.openUntil)
+	return remaining, remaining > 0
+}
+
+// recordPanic answers a recovered panic with a 500 problem and trips the breaker if needed.
+func (b *MiddlewareBuilder) recordPanic(ctx *mist.Context, recovered any) {
+	if b.panicked != nil {
+		b.panicked.Inc()
+	}
+	if b.onPanic != nil {
+		b.onPanic(ctx, recovered)
+	}
+	_ = ctx.RespondError(fmt.Errorf("bulkhead %s: panic: %v", b.name, recovered))
+
+	if b.threshold <= 0 {
+		return
+	}
+	now := time.Now()
+	b.mutex.Lock()
+	kept := b.panics[:0]
+	for _, t := range b.panics {
+		if now.Sub(t) < b.window {
+			kept = append(kept, t)
+		}
+	}
+	b.panics = append(kept, now)
+	count := len(b.panics)
+	tripped := count >= b.threshold && !now.Before(b.openUntil)
+	if tripped {
+		b.openUntil = now.Add(b.cooldown)
+		b.panics = b.panics[:0]
+	}
+	b.mutex.Unlock()
+
+	if tripped {
+		if b.trips != nil {
+			b.trips.Inc()
+		}
+		if b.onTrip != nil {
+			b.onTrip(b.name, count)
+		}
+	}
+}
+
+// reject answers a rejected request with 503 and a Retry-After header.
+func (b *MiddlewareBuilder) reject(ctx *mist.Context, reason Reason, retry time.Duration) {
+	if b.rejected != nil {
+		b.rejected.WithLabelValues(string(reason)).Inc()
+	}
+	if b.onReject != nil {
+		b.onReject(ctx, reason)
+	}
+	ctx.Header("Retry-After", strconv.Itoa(int(retry/time.Second)+1))
+	_ = ctx.RespondProblem(mist.Problem{
+		Status: http.StatusServiceUnavailable,
+		Detail: fmt.Sprintf("the %s subsystem is %s", b.name, reason),
+	})
+	ctx.Abort()
+}
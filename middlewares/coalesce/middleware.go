@@ -0,0 +1,160 @@
+// Package coalesce serves identical concurrent GET requests with a single execution of their
+// handler: the first request runs the handler, the ones arriving while it runs wait for it and
+// receive a copy of its response. It protects expensive endpoints from the bursts of identical
+// requests that follow the expiry of a cache entry or a popular page going live.
+//
+//	catalog := server.Group("/catalog", coalesce.InitMiddlewareBuilder().Build())
+//	catalog.GET("/products", listProducts)
+//
+// Requests are identical when they have the same path, query parameters and values of the
+// headers the response varies on, see SetVaryHeaders. Waiting requests only get the response:
+// values set on the context of the first request, with ctx.Set, are not shared.
+package coalesce
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/singleflight"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// response is a response captured to be shared.
+type response struct {
+	shareable bool
+	status    int
+	header    http.Header
+	body      []byte
+}
+
+// MiddlewareBuilder builds a coalescing middleware. The middleware it builds share their
+// in-flight requests.
+type MiddlewareBuilder struct {
+	keyFunc     func(ctx *mist.Context) string
+	varyHeaders []string
+	onShared    func(ctx *mist.Context, key string)
+	flight      singleflight.Group[*response]
+}
+
+// InitMiddlewareBuilder creates a builder coalescing GET requests by path, query parameters,
+// and the Accept, Accept-Encoding, Accept-Language, Authorization and Cookie headers, so that
+// the requests of different users are never merged.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder() *MiddlewareBuilder {
+	b := &MiddlewareBuilder{
+		varyHeaders: []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"},
+	}
+	b.keyFunc = b.defaultKey
+	return b
+}
+
+// SetVaryHeaders sets the request headers whose values are part of the key, replacing the
+// defaults. Leaving out Authorization and Cookie merges the requests of different users, which
+// is only correct for responses that do not depend on the user.
+func (b *MiddlewareBuilder) SetVaryHeaders(headers ...string) *MiddlewareBuilder {
+	b.varyHeaders = headers
+	return b
+}
+
+// SetKeyFunc sets the function computing the key of a request; requests with the same key are
+// coalesced, and an empty key opts a request out.
+func (b *MiddlewareBuilder) SetKeyFunc(fn func(ctx *mist.Context) string) *MiddlewareBuilder {
+	b.keyFunc = fn
+	return b
+}
+
+// OnShared sets the hook called for every request served with the response of another one,
+// e.g. to count them.
+func (b *MiddlewareBuilder) OnShared(fn func(ctx *mist.Context, key string)) *MiddlewareBuilder {
+	b.onShared = fn
+	return b
+}
+
+// Build creates the middleware. Requests other than GET are passed through. Responses that
+// cannot be copied are not shared, and the waiting requests then run the handler themselves:
+// streamed bodies, responses written to the ResponseWriter directly, and responses setting
+// cookies. A waiting request whose client goes away stops waiting.
+//
+// Returns:
+//   - mist.Middleware: The coalescing middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			if ctx.Request.Method != http.MethodGet {
+				next(ctx)
+				return
+			}
+			key := b.keyFunc(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+			resp, err, shared := b.flight.DoContext(ctx.Request.Context(), key, func() (*response, error) {
+				before := ctx.ResponseWriter.Header().Clone()
+				next(ctx)
+				return capture(ctx, before), nil
+			})
+			if !shared {
+				return
+			}
+			if err != nil {
+				// The client went away, or the first request panicked.
+				if ctx.Request.Context().Err() != nil {
+					return
+				}
+				next(ctx)
+				return
+			}
+			if !resp.shareable {
+				next(ctx)
+				return
+			}
+			header := ctx.ResponseWriter.Header()
+			for name, values := range resp.header {
+				header[name] = append([]string(nil), values...)
+			}
+			ctx.RespStatusCode = resp.status
+			ctx.RespData = append([]byte(nil), resp.body...)
+			if b.onShared != nil {
+				b.onShared(ctx, key)
+			}
+		}
+	}
+}
+
+// capture copies the response of a request once its handler returned. Only the headers set by
+// the handler and the inner middleware are kept, as those set before, such as a request ID,
+// belong to the request.
+func capture(ctx *mist.Context, before http.Header) *response {
+	header := ctx.ResponseWriter.Header()
+	if ctx.Streamed() || ctx.Committed() || len(header.Values("Set-Cookie")) > 0 {
+		return &response{}
+	}
+	set := make(http.Header)
+	for name, values := range header {
+		if !slices.Equal(values, before[name]) {
+			set[name] = append([]string(nil), values...)
+		}
+	}
+	return &response{
+		shareable: true,
+		status:    ctx.RespStatusCode,
+		header:    set,
+		body:      append([]byte(nil), ctx.RespData...),
+	}
+}
+
+// defaultKey returns the key of a request from its host, path, sorted query parameters and
+// vary headers. The header values are hashed so that credentials are not kept in memory.
+func (b *MiddlewareBuilder) defaultKey(ctx *mist.Context) string {
+	h := sha256.New()
+	for _, name := range b.varyHeaders {
+		h.Write([]byte(name + ":" + strings.Join(ctx.Request.Header.Values(name), ",") + "\n"))
+	}
+	return ctx.Request.Host + ctx.Request.URL.Path + "?" + ctx.Request.URL.Query().Encode() +
+		"#" + hex.EncodeToString(h.Sum(nil))
+}
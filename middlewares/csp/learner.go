@@ -0,0 +1,440 @@
+// Package csp eases the adoption of a Content-Security-Policy. In learning mode the site is
+// served with a report-only policy; the violations reported by browsers are aggregated, and a
+// policy allowing what the site actually loads is suggested, with a confidence level for every
+// source. The suggestion can then be reviewed and exported to the https middleware.
+//
+// Policies specific to route groups are served by the middleware of PolicyBuilder, with a nonce
+// per request shared with the templates.
+package csp
+
+import (
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/middlewares/https"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Confidence tells how strongly the observed reports support a suggested source.
+type Confidence int
+
+const (
+	// ConfidenceLow marks sources seen rarely, or unsafe keywords such as 'unsafe-inline' that
+	// should rather be fixed in the site than allowed.
+	ConfidenceLow Confidence = iota
+	// ConfidenceMedium marks sources reported repeatedly from a single page.
+	ConfidenceMedium
+	// ConfidenceHigh marks sources reported repeatedly from several pages.
+	ConfidenceHigh
+)
+
+// String returns the name of the confidence level.
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceHigh:
+		return "high"
+	case ConfidenceMedium:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// maxReportBytes caps the size of a report request, maxPages the pages remembered per source,
+// and maxSources the sources remembered per directive, so that report floods cannot exhaust
+// memory. Directives are bounded by learnedDirectives.
+const (
+	maxReportBytes = 64 << 10
+	maxPages       = 32
+	maxSources     = 256
+)
+
+// learnedDirectives are the directives taking a source list that the learner accepts from
+// reports; reports of other directives, forged or not, are ignored.
+var learnedDirectives = map[string]bool{
+	"default-src":     true,
+	"script-src":      true,
+	"style-src":       true,
+	"img-src":         true,
+	"font-src":        true,
+	"connect-src":     true,
+	"media-src":       true,
+	"object-src":      true,
+	"frame-src":       true,
+	"child-src":       true,
+	"worker-src":      true,
+	"manifest-src":    true,
+	"form-action":     true,
+	"frame-ancestors": true,
+	"base-uri":        true,
+}
+
+// hostSource matches the host sources built by sourceOf: a scheme and a host without
+// wildcards, with an optional port.
+var hostSource = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://([a-z0-9-]+(\.[a-z0-9-]+)*|\[[0-9a-f:.]+\])(:[0-9]{1,5})?$`)
+
+// Violation is a CSP violation reported by a browser.
+//
+// Fields:
+//   - Directive: The violated directive, e.g. "script-src-elem".
+//   - BlockedURI: The blocked resource: a URL, or a keyword such as "inline" or "eval".
+//   - DocumentURI: The page where the violation occurred.
+type Violation struct {
+	Directive   string
+	BlockedURI  string
+	DocumentURI string
+}
+
+// Source is a source suggested for a directive.
+//
+// Fields:
+//   - Source: The source expression, e.g. "https://cdn.example.com" or "'self'".
+//   - Reports: The number of violations allowing the source would have avoided.
+//   - Pages: The number of distinct pages reporting it, capped at 32.
+//   - Confidence: The confidence in the suggestion.
+type Source struct {
+	Source     string
+	Reports    int
+	Pages      int
+	Confidence Confidence
+}
+
+// Suggestion is the list of sources suggested for a directive.
+type Suggestion struct {
+	Directive string
+	Sources   []Source
+}
+
+// Learner aggregates CSP violation reports and suggests a policy. It is safe for concurrent
+// use.
+type Learner struct {
+	mutex      sync.Mutex
+	base       map[string][]string
+	reportURI  string
+	minReports int
+	stats      map[string]map[string]*sourceStats
+}
+
+// sourceStats aggregates the reports of a source.
+type sourceStats struct {
+	reports int
+	pages   map[string]struct{}
+}
+
+// InitLearner creates a Learner starting from a base policy, such as "default-src 'self'",
+// which is served in report-only mode and extended by the suggestions. Reports are expected
+// at "/csp-report" until SetReportURI is called.
+//
+// Parameters:
+//   - base: The base policy.
+//
+// Returns:
+//   - *Learner: The initialized learner.
+func InitLearner(base string) *Learner {
+	return &Learner{
+		base:       parsePolicy(base),
+		reportURI:  "/csp-report",
+		minReports: 5,
+		stats:      make(map[string]map[string]*sourceStats),
+	}
+}
+
+// SetReportURI sets the path where browsers send their reports; register Handler on it.
+func (l *Learner) SetReportURI(uri string) *Learner {
+	l.reportURI = uri
+	return l
+}
+
+// SetMinReports sets how many reports a source needs before its confidence rises above low.
+func (l *Learner) SetMinReports(n int) *Learner {
+	l.minReports = n
+	return l
+}
+
+// Middleware returns a middleware serving the base policy as Content-Security-Policy-Report-Only
+// with a report-uri directive pointing at the learner, so browsers report what the base policy
+// would block without blocking anything.
+func (l *Learner) Middleware() mist.Middleware {
+	header := formatPolicy(l.base) + "; report-uri " + l.reportURI
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			ctx.Header("Content-Security-Policy-Report-Only", header)
+			next(ctx)
+		}
+	}
+}
+
+// Handler returns the handler receiving the reports, in the report-uri format
+// (application/csp-report) or the Reporting API format (application/reports+json). It answers
+// 204 No Content; malformed reports are ignored.
+//
+// Example:
+//
+//	learner := csp.InitLearner("default-src 'self'")
+//	server.Use(learner.Middleware())
+//	server.POST("/csp-report", learner.Handler())
+func (l *Learner) Handler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		ctx.RespStatusCode = http.StatusNoContent
+		body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxReportBytes))
+		if err != nil {
+			return
+		}
+		for _, v := range parseReports(body) {
+			l.Observe(v)
+		}
+	}
+}
+
+// Observe records a violation. Reports are unauthenticated: violations of unknown directives,
+// or whose blocked resource does not translate to a plain source expression, are ignored, so
+// that a forged report cannot introduce wildcards or other directives in the policy.
+func (l *Learner) Observe(v Violation) {
+	directive := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(v.Directive), "-elem"), "-attr")
+	source := sourceOf(v.BlockedURI, v.DocumentURI)
+	if !learnedDirectives[directive] || !validSource(source) {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	sources, ok := l.stats[directive]
+	if !ok {
+		sources = make(map[string]*sourceStats)
+		l.stats[directive] = sources
+	}
+	st, ok := sources[source]
+	if !ok {
+		if len(sources) >= maxSources {
+			return
+		}
+		st = &sourceStats{pages: make(map[string]struct{})}
+		sources[source] = st
+	}
+	st.reports++
+	if page := pageOf(v.DocumentURI); page != "" && len(st.pages) < maxPages {
+		st.pages[page] = struct{}{}
+	}
+}
+
+// Suggestions returns the sources suggested for each directive, ordered by directive and by
+// decreasing number of reports.
+func (l *Learner) Suggestions() []Suggestion {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	res := make([]Suggestion, 0, len(l.stats))
+	for directive, sources := range l.stats {
+		s := Suggestion{Directive: directive}
+		for source, st := range sources {
+			s.Sources = append(s.Sources, Source{
+				Source:     source,
+				Reports:    st.reports,
+				Pages:      len(st.pages),
+				Confidence: l.confidence(source, st),
+			})
+		}
+		sort.Slice(s.Sources, func(i, j int) bool {
+			if s.Sources[i].Reports != s.Sources[j].Reports {
+				return s.Sources[i].Reports > s.Sources[j].Reports
+			}
+			return s.Sources[i].Source < s.Sources[j].Source
+		})
+		res = append(res, s)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Directive < res[j].Directive })
+	return res
+}
+
+// Policy returns the base policy extended with the suggested sources of at least the given
+// confidence. Directives missing from the base policy start from the sources of default-src,
+// so that adding a directive does not block what default-src allowed; they are left out when
+// none of their sources reaches the confidence.
+func (l *Learner) Policy(min Confidence) string {
+	policy := make(map[string][]string, len(l.base))
+	for directive, sources := range l.base {
+		policy[directive] = append([]string(nil), sources...)
+	}
+	for _, s := range l.Suggestions() {
+		var added []string
+		for _, src := range s.Sources {
+			if src.Confidence >= min {
+				added = append(added, src.Source)
+			}
+		}
+		sources, ok := policy[s.Directive]
+		if !ok {
+			if len(added) == 0 {
+				continue
+			}
+			sources = append([]string(nil), policy["default-src"]...)
+		}
+		for _, src := range added {
+			if !contains(sources, src) {
+				sources = append(sources, src)
+			}
+		}
+		policy[s.Directive] = sources
+	}
+	return formatPolicy(policy)
+}
+
+// Export sets the CSP of an https middleware configuration to the suggested policy, after the
+// suggestions have been reviewed.
+func (l *Learner) Export(cfg *https.RedirectConfig, min Confidence) {
+	cfg.CSP = l.Policy(min)
+}
+
+// Reset forgets the observed reports, e.g. after a deployment changed what the site loads.
+func (l *Learner) Reset() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.stats = make(map[string]map[string]*sourceStats)
+}
+
+// confidence rates a source; the caller holds the lock.
+func (l *Learner) confidence(source string, st *sourceStats) Confidence {
+	if strings.HasPrefix(source, "'unsafe-") || st.reports < l.minReports {
+		return ConfidenceLow
+	}
+	if len(st.pages) < 2 {
+		return ConfidenceMedium
+	}
+	return ConfidenceHigh
+}
+
+// cspReport is the report-uri format of a violation report.
+type cspReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is the Reporting API format of a violation report.
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+	} `json:"body"`
+}
+
+// parseReports decodes the violations of a report request in either format.
+func parseReports(body []byte) []Violation {
+	var batch []reportingAPIReport
+	if err := json.Unmarshal(body, &batch); err == nil {
+		res := make([]Violation, 0, len(batch))
+		for _, r := range batch {
+			if r.Type == "csp-violation" {
+				res = append(res, Violation{Directive: r.Body.EffectiveDirective, BlockedURI: r.Body.BlockedURL, DocumentURI: r.Body.DocumentURL})
+			}
+		}
+		return res
+	}
+	var report cspReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil
+	}
+	directive := report.Report.EffectiveDirective
+	if directive == "" {
+		directive, _, _ = strings.Cut(report.Report.ViolatedDirective, " ")
+	}
+	return []Violation{{Directive: directive, BlockedURI: report.Report.BlockedURI, DocumentURI: report.Report.DocumentURI}}
+}
+
+// sourceOf returns the source expression allowing a blocked resource.
+func sourceOf(blocked string, document string) string {
+	switch blocked {
+	case "inline":
+		return "'unsafe-inline'"
+	case "eval":
+		return "'unsafe-eval'"
+	case "wasm-eval":
+		return "'wasm-unsafe-eval'"
+	case "data", "blob":
+		return blocked + ":"
+	case "self":
+		return "'self'"
+	}
+	u, err := url.Parse(blocked)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	if u.Host == "" {
+		return u.Scheme + ":"
+	}
+	if doc, err := url.Parse(document); err == nil && doc.Scheme == u.Scheme && doc.Host == u.Host {
+		return "'self'"
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// validSource reports whether source is a source expression the learner may suggest: a keyword
+// produced by sourceOf, a scheme source of local content or a host source without wildcards.
+// Scheme sources such as "https:", which allow every host, are never suggested.
+func validSource(source string) bool {
+	switch source {
+	case "'self'", "'unsafe-inline'", "'unsafe-eval'", "'wasm-unsafe-eval'",
+		"data:", "blob:", "mediastream:", "filesystem:":
+		return true
+	}
+	return hostSource.MatchString(source)
+}
+
+// pageOf returns the page of a document URI, without query or fragment.
+func pageOf(document string) string {
+	u, err := url.Parse(document)
+	if err != nil {
+		return ""
+	}
+	return u.Host + u.Path
+}
+
+// parsePolicy parses a policy into its directives.
+func parsePolicy(policy string) map[string][]string {
+	res := make(map[string][]string)
+	for _, directive := range strings.Split(policy, ";") {
+		fields := strings.Fields(directive)
+		if len(fields) == 0 {
+			continue
+		}
+		res[strings.ToLower(fields[0])] = fields[1:]
+	}
+	return res
+}
+
+// formatPolicy formats directives as a policy, default-src first and the others sorted.
+func formatPolicy(policy map[string][]string) string {
+	names := make([]string, 0, len(policy))
+	for name := range policy {
+		if name != "default-src" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := policy["default-src"]; ok {
+		names = append([]string{"default-src"}, names...)
+	}
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, strings.Join(append([]string{name}, policy[name]...), " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// contains reports whether sources contains source.
+func contains(sources []string, source string) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
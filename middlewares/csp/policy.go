@@ -0,0 +1,76 @@
+package csp
+
+import (
+	"github.com/dormoron/mist"
+)
+
+// StrictPolicy is a strict policy for application pages: scripts run only when they carry the
+// nonce of the request, or are loaded by such scripts, and plugins, base URL changes and
+// framing by other sites are forbidden.
+const StrictPolicy = "default-src 'self'; script-src 'nonce' 'strict-dynamic'; object-src 'none'; base-uri 'none'; frame-ancestors 'self'"
+
+// PolicyBuilder builds a middleware serving a Content-Security-Policy for the routes it is
+// applied to, so that route groups declare distinct policies, e.g. a strict one for the
+// application pages and a relaxed one for a documentation UI loading its assets from a CDN.
+type PolicyBuilder struct {
+	policy     string
+	reportOnly bool
+	reportURI  string
+}
+
+// InitPolicyBuilder creates a PolicyBuilder serving a policy. The source 'nonce' is replaced by
+// the nonce of each request, the one written in templates by {{cspNonce}}, see
+// mist.Context.CSPNonce.
+//
+// Example:
+//
+//	server.Use(https.InitMiddlewareBuilder(cfg).Build())
+//	app := server.Group("/app", csp.InitPolicyBuilder(csp.StrictPolicy).Build())
+//	docs := server.Group("/docs", csp.InitPolicyBuilder(
+//	    "default-src 'self'; script-src 'self' https://cdn.example.com; style-src 'self' 'unsafe-inline'").Build())
+//
+// Parameters:
+//   - policy: The policy.
+//
+// Returns:
+//   - *PolicyBuilder: The initialized builder.
+func InitPolicyBuilder(policy string) *PolicyBuilder {
+	return &PolicyBuilder{policy: policy}
+}
+
+// SetReportOnly serves the policy as Content-Security-Policy-Report-Only, so that browsers
+// report violations without blocking anything, e.g. while tightening a policy.
+func (b *PolicyBuilder) SetReportOnly(reportOnly bool) *PolicyBuilder {
+	b.reportOnly = reportOnly
+	return b
+}
+
+// SetReportURI adds a report-uri directive sending the violations to uri, e.g. the handler of a
+// Learner.
+func (b *PolicyBuilder) SetReportURI(uri string) *PolicyBuilder {
+	b.reportURI = uri
+	return b
+}
+
+// Build creates the middleware. The policy replaces the one set by middleware run earlier, such
+// as the https middleware applied to the whole server, and is itself replaced by middleware run
+// later, so that a route overrides the policy of its group.
+//
+// Returns:
+//   - mist.Middleware: The policy middleware.
+func (b *PolicyBuilder) Build() mist.Middleware {
+	header := "Content-Security-Policy"
+	if b.reportOnly {
+		header = "Content-Security-Policy-Report-Only"
+	}
+	policy := b.policy
+	if b.reportURI != "" {
+		policy += "; report-uri " + b.reportURI
+	}
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			ctx.ResponseWriter.Header().Set(header, ctx.ExpandCSPNonce(policy))
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package csrf protects form-based applications against cross-site request forgery with the
+// double-submit cookie pattern: every client gets a random token in a cookie, and requests
+// with unsafe methods must echo it in a form field or a header, which a third-party site
+// cannot read.
+//
+//	server.Use(csrf.InitMiddlewareBuilder().Build())
+//
+// Templates embed the token with forms.Form.CSRFField, or with the values of Token and
+// FieldName passed by the handler; scripts send it in the X-CSRF-Token header.
+//
+// OriginBuilder builds a lighter check of the Origin and Sec-Fetch-Site headers, for APIs called
+// by scripts or as a second line of defense:
+//
+//	server.Use(csrf.InitOriginBuilder("https://admin.example.com").Build())
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/dormoron/mist"
+	"net/http"
+)
+
+// contextKey is the key of the token in the context of a request.
+const contextKey = "mist.csrf"
+
+// state is the token of a request and the form field expected to carry it.
+type state struct {
+	token string
+	field string
+}
+
+// MiddlewareBuilder builds the CSRF middleware.
+type MiddlewareBuilder struct {
+	cookieName string
+	fieldName  string
+	headerName string
+	secure     bool
+	onReject   func(ctx *mist.Context)
+}
+
+// InitMiddlewareBuilder creates a builder with the token in the "mist_csrf" cookie, expected in
+// the "csrf_token" form field or the X-CSRF-Token header. The cookie is secure, HttpOnly and
+// SameSite=Lax.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		cookieName: "mist_csrf",
+		fieldName:  "csrf_token",
+		headerName: "X-CSRF-Token",
+		secure:     true,
+	}
+}
+
+// SetCookieName sets the name of the cookie holding the token.
+func (b *MiddlewareBuilder) SetCookieName(name string) *MiddlewareBuilder {
+	b.cookieName = name
+	return b
+}
+
+// SetFieldName sets the name of the form field carrying the token.
+func (b *MiddlewareBuilder) SetFieldName(name string) *MiddlewareBuilder {
+	b.fieldName = name
+	return b
+}
+
+// SetHeaderName sets the name of the header carrying the token, used by scripts.
+func (b *MiddlewareBuilder) SetHeaderName(name string) *MiddlewareBuilder {
+	b.headerName = name
+	return b
+}
+
+// SetSecure sets whether the cookie is only sent over HTTPS, e.g. false for local development
+// over HTTP.
+func (b *MiddlewareBuilder) SetSecure(secure bool) *MiddlewareBuilder {
+	b.secure = secure
+	return b
+}
+
+// OnReject sets the handler of the requests failing the check, in place of the default 403
+// problem response; the request is aborted after it.
+func (b *MiddlewareBuilder) OnReject(fn func(ctx *mist.Context)) *MiddlewareBuilder {
+	b.onReject = fn
+	return b
+}
+
+// Build creates the middleware. It issues a token to clients without one and, for requests
+// with methods other than GET, HEAD, OPTIONS and TRACE, checks that the token of the cookie is
+// echoed in the header or the form field. Failing requests are rejected with 403.
+//
+// Returns:
+//   - mist.Middleware: The CSRF middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			token := ""
+			if ck, err := ctx.Request.Cookie(b.cookieName); err == nil && validToken(ck.Value) {
+				token = ck.Value
+			}
+			if !safeMethod(ctx.Request.Method) && (token == "" || !b.echoed(ctx, token)) {
+				b.reject(ctx)
+				return
+			}
+			if token == "" {
+				var err error
+				if token, err = newToken(); err != nil {
+					_ = ctx.RespondError(err)
+					return
+				}
+				ctx.SetCookie(&http.Cookie{
+					Name:     b.cookieName,
+					Value:    token,
+					Path:     "/",
+					Secure:   b.secure,
+					HttpOnly: true,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+			ctx.Set(contextKey, state{token: token, field: b.fieldName})
+			next(ctx)
+		}
+	}
+}
+
+// echoed reports whether the request carries the token in the header or the form field.
+func (b *MiddlewareBuilder) echoed(ctx *mist.Context, token string) bool {
+	sent := ctx.Request.Header.Get(b.headerName)
+	if sent == "" {
+		sent = ctx.Request.FormValue(b.fieldName)
+	}
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// reject answers a request failing the check.
+func (b *MiddlewareBuilder) reject(ctx *mist.Context) {
+	if b.onReject != nil {
+		b.onReject(ctx)
+	} else {
+		_ = ctx.RespondProblem(mist.Problem{
+			Status: http.StatusForbidden,
+			Detail: "the form has expired, reload the page and submit it again",
+		})
+	}
+	ctx.Abort()
+}
+
+// Token returns the CSRF token of the request, "" when the middleware did not run.
+func Token(ctx *mist.Context) string {
+	st, _ := lookup(ctx)
+	return st.token
+}
+
+// FieldName returns the name of the form field expected to carry the token, "" when the
+// middleware did not run.
+func FieldName(ctx *mist.Context) string {
+	st, _ := lookup(ctx)
+	return st.field
+}
+
+// lookup returns the state set by the middleware.
+func lookup(ctx *mist.Context) (state, bool) {
+	val, ok := ctx.Get(contextKey)
+	if !ok {
+		return state{}, false
+	}
+	st, ok := val.(state)
+	return st, ok
+}
+
+// safeMethod reports whether a method must not change state, and so is not checked.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// newToken returns a random token of 256 bits.
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validToken reports whether a cookie value has the shape of a token.
+func validToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && len(b) == 32
+}
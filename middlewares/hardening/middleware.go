@@ -0,0 +1,233 @@
+// Package hardening rejects malformed or ambiguous requests that front-end proxies and the
+// server may interpret differently, the basis of HTTP request smuggling, and logs them as
+// security events.
+//
+// net/http already refuses the grossest violations, and resolves a request carrying both
+// Content-Length and Transfer-Encoding by dropping Content-Length before any middleware runs.
+// The checks here cover handlers served by other stacks or behind proxies that normalize less
+// strictly, and anomalies that are valid HTTP but have no legitimate use against an
+// application server.
+package hardening
+
+import (
+	"fmt"
+	"github.com/dormoron/mist"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Rule names the check a request failed.
+type Rule string
+
+const (
+	// RuleLengthAndEncoding reports a request with both Content-Length and Transfer-Encoding.
+	RuleLengthAndEncoding Rule = "content_length_and_transfer_encoding"
+	// RuleInvalidLength reports several or malformed Content-Length values.
+	RuleInvalidLength Rule = "invalid_content_length"
+	// RuleInvalidEncoding reports a Transfer-Encoding other than a single "chunked".
+	RuleInvalidEncoding Rule = "invalid_transfer_encoding"
+	// RuleDuplicateHeader reports a critical header sent several times.
+	RuleDuplicateHeader Rule = "duplicate_header"
+	// RuleOversizedHeader reports a header value above the size limit, or too many headers.
+	RuleOversizedHeader Rule = "oversized_header"
+	// RuleInvalidHeader reports invalid characters in a header name or value.
+	RuleInvalidHeader Rule = "invalid_header"
+	// RuleAbsoluteURI reports a request target in absolute form, e.g. "GET http://host/ HTTP/1.1".
+	RuleAbsoluteURI Rule = "absolute_uri"
+)
+
+// Event is a security event raised for an anomalous request.
+//
+// Fields:
+//   - Rule: The failed check.
+//   - Detail: What was found, e.g. the offending header name.
+//   - RemoteAddr: The client IP of the request.
+//   - Method: The request method.
+//   - RequestURI: The raw request target.
+//   - Blocked: Whether the request was rejected; false in report-only mode.
+type Event struct {
+	Rule       Rule
+	Detail     string
+	RemoteAddr string
+	Method     string
+	RequestURI string
+	Blocked    bool
+}
+
+// MiddlewareBuilder builds the hardening middleware.
+type MiddlewareBuilder struct {
+	maxHeaderBytes   int
+	maxHeaders       int
+	criticalHeaders  []string
+	allowAbsoluteURI bool
+	reportOnly       bool
+	eventFunc        func(ctx *mist.Context, e Event)
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder with the following limits:
+//   - header values up to 8 KiB and at most 100 header fields,
+//   - Host, Content-Length, Transfer-Encoding, Content-Type and Authorization sent at most
+//     once,
+//   - request targets in origin form only.
+//
+// Events are logged with the standard logger.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		maxHeaderBytes:  8 << 10,
+		maxHeaders:      100,
+		criticalHeaders: []string{"Host", "Content-Length", "Transfer-Encoding", "Content-Type", "Authorization"},
+		eventFunc: func(ctx *mist.Context, e Event) {
+			log.Printf("security: %s (%s) from %s: %s %s, blocked: %t",
+				e.Rule, e.Detail, e.RemoteAddr, e.Method, e.RequestURI, e.Blocked)
+		},
+	}
+}
+
+// SetMaxHeaderBytes sets the size limit of a single header value.
+func (b *MiddlewareBuilder) SetMaxHeaderBytes(n int) *MiddlewareBuilder {
+	b.maxHeaderBytes = n
+	return b
+}
+
+// SetMaxHeaders sets the maximum number of header fields of a request.
+func (b *MiddlewareBuilder) SetMaxHeaders(n int) *MiddlewareBuilder {
+	b.maxHeaders = n
+	return b
+}
+
+// SetCriticalHeaders sets the headers that must not be sent more than once.
+func (b *MiddlewareBuilder) SetCriticalHeaders(names ...string) *MiddlewareBuilder {
+	b.criticalHeaders = names
+	return b
+}
+
+// AllowAbsoluteURI accepts request targets in absolute form, for servers acting as forward
+// proxies.
+func (b *MiddlewareBuilder) AllowAbsoluteURI(allow bool) *MiddlewareBuilder {
+	b.allowAbsoluteURI = allow
+	return b
+}
+
+// SetReportOnly only reports anomalies instead of rejecting the requests, to evaluate the
+// checks against real traffic before enforcing them.
+func (b *MiddlewareBuilder) SetReportOnly(reportOnly bool) *MiddlewareBuilder {
+	b.reportOnly = reportOnly
+	return b
+}
+
+// SetEventFunc sets the function receiving security events, e.g. to forward them to a SIEM.
+func (b *MiddlewareBuilder) SetEventFunc(fn func(ctx *mist.Context, e Event)) *MiddlewareBuilder {
+	b.eventFunc = fn
+	return b
+}
+
+// Build creates the middleware. Anomalous requests are answered with 400 Bad Request and the
+// connection is closed, since the framing of any following request on it cannot be trusted.
+//
+// Returns:
+//   - mist.Middleware: The hardening middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			rule, detail, ok := b.inspect(ctx.Request)
+			if ok {
+				next(ctx)
+				return
+			}
+			b.eventFunc(ctx, Event{
+				Rule:       rule,
+				Detail:     detail,
+				RemoteAddr: ctx.ClientIP(),
+				Method:     ctx.Request.Method,
+				RequestURI: ctx.Request.RequestURI,
+				Blocked:    !b.reportOnly,
+			})
+			if b.reportOnly {
+				next(ctx)
+				return
+			}
+			ctx.Header("Connection", "close")
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: "malformed request"})
+		}
+	}
+}
+
+// inspect runs the checks on r and returns the first one failing.
+func (b *MiddlewareBuilder) inspect(r *http.Request) (Rule, string, bool) {
+	lengths := r.Header.Values("Content-Length")
+	encodings := append(append([]string(nil), r.TransferEncoding...), r.Header.Values("Transfer-Encoding")...)
+
+	if len(lengths) > 0 && len(encodings) > 0 {
+		return RuleLengthAndEncoding, "both headers present", false
+	}
+	if len(lengths) > 1 || strings.Contains(strings.Join(lengths, ""), ",") {
+		return RuleInvalidLength, strings.Join(lengths, ", "), false
+	}
+	if len(lengths) == 1 && !isDigits(lengths[0]) {
+		return RuleInvalidLength, lengths[0], false
+	}
+	if len(encodings) > 1 || (len(encodings) == 1 && !strings.EqualFold(encodings[0], "chunked")) {
+		return RuleInvalidEncoding, strings.Join(encodings, ", "), false
+	}
+
+	if !b.allowAbsoluteURI && r.RequestURI != "" && !strings.HasPrefix(r.RequestURI, "/") && r.RequestURI != "*" {
+		return RuleAbsoluteURI, r.RequestURI, false
+	}
+
+	for _, name := range b.criticalHeaders {
+		if len(r.Header.Values(name)) > 1 {
+			return RuleDuplicateHeader, http.CanonicalHeaderKey(name), false
+		}
+	}
+
+	fields := 0
+	for name, values := range r.Header {
+		fields += len(values)
+		if !validHeaderName(name) {
+			return RuleInvalidHeader, fmt.Sprintf("name %q", name), false
+		}
+		for _, value := range values {
+			if b.maxHeaderBytes > 0 && len(value) > b.maxHeaderBytes {
+				return RuleOversizedHeader, name, false
+			}
+			if strings.ContainsAny(value, "\r\n\x00") {
+				return RuleInvalidHeader, "value of " + name, false
+			}
+		}
+	}
+	if b.maxHeaders > 0 && fields > b.maxHeaders {
+		return RuleOversizedHeader, fmt.Sprintf("%d header fields", fields), false
+	}
+	return "", "", true
+}
+
+// validHeaderName reports whether name is an HTTP token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+// Package httpcache caches the responses of GET requests on the server, and invalidates them by
+// surrogate keys: handlers tag their responses with the data they were built from, and purging
+// a tag after a change of that data removes every cached response built from it, the way CDNs
+// purge by surrogate key:
+//
+//	store, _ := httpcache.InitMemoryStore(10000)
+//	cache := httpcache.InitCache(store).SetTTL(5 * time.Minute)
+//	users := server.Group("/users", cache.Build())
+//	users.GET("/:id", func(ctx *mist.Context) {
+//	    id := ctx.PathValue("id").StringOrDefault("")
+//	    ctx.CacheTag("user:" + id)
+//	    ...
+//	})
+//	server.PUT("/users/:id", func(ctx *mist.Context) {
+//	    ...
+//	    _ = cache.PurgeTag(ctx, "user:"+ctx.PathValue("id").StringOrDefault(""))
+//	})
+package httpcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/dormoron/mist"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Cache is a server-side response cache.
+type Cache struct {
+	store       Store
+	ttl         time.Duration
+	statuses    []int
+	varyHeaders []string
+	keyFunc     func(ctx *mist.Context) string
+	bypassFunc  func(ctx *mist.Context) bool
+	tagHeader   string
+	onError     func(err error)
+
+	// purges counts the purges, so that a response rendered while one happened is not stored:
+	// it may have been built from the purged data.
+	purges atomic.Uint64
+}
+
+// InitCache creates a Cache storing the 200 responses of GET requests for 1 minute, keyed by
+// host, path, query parameters and the Accept, Accept-Encoding and Accept-Language headers.
+// Requests with an Authorization or a Cookie header, whose responses may depend on the user, or
+// with "Cache-Control: no-cache" bypass the cache. Errors of the store are logged, and requests are then served by the handler.
+//
+// Parameters:
+//   - store: The store of the responses, e.g. a MemoryStore, or a RedisStore shared by the
+//     instances of the application.
+//
+// Returns:
+//   - *Cache: The initialized cache.
+func InitCache(store Store) *Cache {
+	c := &Cache{
+		store:       store,
+		ttl:         time.Minute,
+		statuses:    []int{http.StatusOK},
+		varyHeaders: []string{"Accept", "Accept-Encoding", "Accept-Language"},
+		onError: func(err error) {
+			log.Println("httpcache:", err)
+		},
+	}
+	c.keyFunc = c.defaultKey
+	c.bypassFunc = func(ctx *mist.Context) bool {
+		header := ctx.Request.Header
+		return header.Get("Authorization") != "" || header.Get("Cookie") != "" ||
+			strings.Contains(header.Get("Cache-Control"), "no-cache")
+	}
+	return c
+}
+
+// SetTTL sets the time responses are stored, unless their Cache-Control header sets s-maxage
+// or max-age.
+func (c *Cache) SetTTL(ttl time.Duration) *Cache {
+	c.ttl = ttl
+	return c
+}
+
+// SetStatuses sets the status codes of the responses stored.
+func (c *Cache) SetStatuses(statuses ...int) *Cache {
+	c.statuses = statuses
+	return c
+}
+
+// SetVaryHeaders sets the request headers whose values are part of the key, replacing the
+// defaults.
+func (c *Cache) SetVaryHeaders(headers ...string) *Cache {
+	c.varyHeaders = headers
+	return c
+}
+
+// SetKeyFunc sets the function computing the key of a request; an empty key bypasses the
+// cache.
+func (c *Cache) SetKeyFunc(fn func(ctx *mist.Context) string) *Cache {
+	c.keyFunc = fn
+	return c
+}
+
+// SetBypassFunc sets the function telling whether a request bypasses the cache, replacing the
+// default one, e.g. to cache the responses of requests with cookies that are not read by the
+// handlers.
+func (c *Cache) SetBypassFunc(fn func(ctx *mist.Context) bool) *Cache {
+	c.bypassFunc = fn
+	return c
+}
+
+// SetTagHeader sets a response header listing the tags of the response separated by spaces,
+// such as "Surrogate-Key" for Fastly or "Cache-Tag" for Cloudflare, so that a CDN in front of
+// the application can purge by the same tags.
+func (c *Cache) SetTagHeader(name string) *Cache {
+	c.tagHeader = name
+	return c
+}
+
+// OnError sets the handler of the errors of the store.
+func (c *Cache) OnError(fn func(err error)) *Cache {
+	c.onError = fn
+	return c
+}
+
+// PurgeTag removes the cached responses tagged with any of the tags.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - tags: The tags to purge, e.g. "user:42".
+//
+// Returns:
+//   - error: The first error of the store.
+func (c *Cache) PurgeTag(ctx context.Context, tags ...string) error {
+	c.purges.Add(1)
+	for _, tag := range tags {
+		if err := c.store.PurgeTag(ctx, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build creates the middleware. GET and HEAD requests are answered from the cache when it holds
+// their response, with the header X-Cache: HIT and the Age of the response; otherwise the
+// handler runs and its response is stored, with X-Cache: MISS. Responses are not stored when
+// they set cookies, are streamed or written directly, or have a Cache-Control header with no-store
+// or private.
+//
+// Returns:
+//   - mist.Middleware: The caching middleware.
+func (c *Cache) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			method := ctx.Request.Method
+			if (method != http.MethodGet && method != http.MethodHead) || c.bypassFunc(ctx) {
+				next(ctx)
+				return
+			}
+			key := c.keyFunc(ctx)
+			if key == "" {
+				next(ctx)
+				return
+			}
+			entry, err := c.store.Get(ctx, key)
+			if err != nil {
+				c.report(err)
+			}
+			if entry != nil {
+				c.serve(ctx, entry)
+				return
+			}
+
+			purges := c.purges.Load()
+			before := ctx.ResponseWriter.Header().Clone()
+			ctx.Header("X-Cache", "MISS")
+			next(ctx)
+			if c.tagHeader != "" && len(ctx.CacheTags()) > 0 && !ctx.Committed() {
+				ctx.Header(c.tagHeader, strings.Join(ctx.CacheTags(), " "))
+			}
+			ttl, ok := c.storable(ctx)
+			if !ok || c.purges.Load() != purges {
+				return
+			}
+			entry = &Entry{
+				Status: ctx.RespStatusCode,
+				Header: make(http.Header),
+				Body:   append([]byte(nil), ctx.RespData...),
+				Tags:   slices.Clone(ctx.CacheTags()),
+				Stored: time.Now(),
+			}
+			// Headers set before the handler, such as a request ID, belong to the request.
+			for name, values := range ctx.ResponseWriter.Header() {
+				if name != "X-Cache" && !slices.Equal(values, before[name]) {
+					entry.Header[name] = slices.Clone(values)
+				}
+			}
+			if err = c.store.Set(context.WithoutCancel(ctx), key, entry, ttl); err != nil {
+				c.report(err)
+			}
+		}
+	}
+}
+
+// serve answers a request with a cached response.
+func (c *Cache) serve(ctx *mist.Context, entry *Entry) {
+	header := ctx.ResponseWriter.Header()
+	for name, values := range entry.Header {
+		header[name] = slices.Clone(values)
+	}
+	age := int(time.Since(entry.Stored).Seconds())
+	ctx.Header("Age", strconv.Itoa(max(age, 0)))
+	ctx.Header("X-Cache", "HIT")
+	ctx.RespStatusCode = entry.Status
+	ctx.RespData = slices.Clone(entry.Body)
+	if ctx.Request.Method == http.MethodHead {
+		ctx.RespData = nil
+	}
+}
+
+// storable returns the time a response is stored for, and whether it can be stored.
+func (c *Cache) storable(ctx *mist.Context) (time.Duration, bool) {
+	status := ctx.RespStatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := ctx.ResponseWriter.Header()
+	if ctx.Request.Method != http.MethodGet || !slices.Contains(c.statuses, status) ||
+		ctx.Streamed() || ctx.Committed() || len(header.Values("Set-Cookie")) > 0 {
+		return 0, false
+	}
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok {
+		return 0, false
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(v)
+			if err != nil || seconds <= 0 {
+				return 0, false
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return c.ttl, c.ttl > 0
+}
+
+// parseCacheControl returns the directives of a Cache-Control header by name.
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// defaultKey returns the key of a request from its host, path, sorted query parameters and
+// vary headers.
+func (c *Cache) defaultKey(ctx *mist.Context) string {
+	h := sha256.New()
+	h.Write([]byte(ctx.Request.Host + ctx.Request.URL.Path + "?" + ctx.Request.URL.Query().Encode()))
+	for _, name := range c.varyHeaders {
+		h.Write([]byte("\n" + name + ":" + strings.Join(ctx.Request.Header.Values(name), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// report hands an error to the error handler.
+func (c *Cache) report(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
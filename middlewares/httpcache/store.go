@@ -0,0 +1,227 @@
+package httpcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response.
+//
+// Fields:
+//   - Status: The status code.
+//   - Header: The headers set by the handler.
+//   - Body: The body.
+//   - Tags: The surrogate keys of the response, see mist.Context.CacheTag.
+//   - Stored: When the response was stored, from which its Age is computed.
+type Entry struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Tags   []string    `json:"tags,omitempty"`
+	Stored time.Time   `json:"stored"`
+}
+
+// Store keeps the cached responses and the index of their tags.
+type Store interface {
+	// Get returns the entry of a key, nil when there is none.
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores the entry of a key for ttl, indexed by its tags.
+	Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error
+	// Delete removes the entries of keys.
+	Delete(ctx context.Context, keys ...string) error
+	// PurgeTag removes the entries tagged with a tag.
+	PurgeTag(ctx context.Context, tag string) error
+}
+
+// MemoryStore is a Store local to the process, holding a bounded number of responses and
+// evicting the least recently used ones.
+type MemoryStore struct {
+	mutex   sync.Mutex
+	entries *simplelru.LRU
+	tags    map[string]map[string]struct{}
+}
+
+// memoryEntry is an entry of MemoryStore and its expiry.
+type memoryEntry struct {
+	entry    *Entry
+	deadline time.Time
+}
+
+// InitMemoryStore creates a MemoryStore.
+//
+// Parameters:
+//   - size: The maximum number of responses.
+//
+// Returns:
+//   - *MemoryStore: The initialized store.
+//   - error: An error if size is not positive.
+func InitMemoryStore(size int) (*MemoryStore, error) {
+	s := &MemoryStore{tags: make(map[string]map[string]struct{})}
+	entries, err := simplelru.NewLRU(size, func(key any, value any) {
+		s.unindex(key.(string), value.(memoryEntry).entry.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.entries = entries
+	return s, nil
+}
+
+// Get returns the entry of a key, unless it expired.
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	v, ok := s.entries.Get(key)
+	if !ok {
+		return nil, nil
+	}
+	e := v.(memoryEntry)
+	if !time.Now().Before(e.deadline) {
+		s.entries.Remove(key)
+		return nil, nil
+	}
+	return e.entry, nil
+}
+
+// Set stores the entry of a key for ttl.
+func (s *MemoryStore) Set(_ context.Context, key string, entry *Entry, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Replacing an entry does not evict it: its tags are unindexed here.
+	s.entries.Remove(key)
+	s.entries.Add(key, memoryEntry{entry: entry, deadline: time.Now().Add(ttl)})
+	for _, tag := range entry.Tags {
+		keys, ok := s.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// Delete removes the entries of keys.
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, key := range keys {
+		s.entries.Remove(key)
+	}
+	return nil
+}
+
+// PurgeTag removes the entries tagged with a tag.
+func (s *MemoryStore) PurgeTag(_ context.Context, tag string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key := range s.tags[tag] {
+		s.entries.Remove(key)
+	}
+	delete(s.tags, tag)
+	return nil
+}
+
+// unindex removes a key from the index of its tags, as its entry is evicted or removed. It is
+// called with the mutex held.
+func (s *MemoryStore) unindex(key string, tags []string) {
+	for _, tag := range tags {
+		delete(s.tags[tag], key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+}
+
+// RedisStore is a Store shared by the instances of an application. Each tag is a set of the
+// keys tagged with it, expiring with the last of them; this requires Redis 7 or later.
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// InitRedisStore creates a RedisStore with keys prefixed by "httpcache:".
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *RedisStore: The initialized store.
+func InitRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client, prefix: "httpcache:"}
+}
+
+// SetKeyPrefix sets the prefix of the keys of the store.
+func (s *RedisStore) SetKeyPrefix(prefix string) *RedisStore {
+	s.prefix = prefix
+	return s
+}
+
+// Get returns the entry of a key.
+func (s *RedisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	raw, err := s.client.Get(ctx, s.prefix+"e:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry Entry
+	if err = json.Unmarshal(raw, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Set stores the entry of a key for ttl, and adds the key to the sets of its tags.
+func (s *RedisStore) Set(ctx context.Context, key string, entry *Entry, ttl time.Duration) error {
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.prefix+"e:"+key, raw, ttl)
+		for _, tag := range entry.Tags {
+			tagKey := s.prefix + "t:" + tag
+			pipe.SAdd(ctx, tagKey, key)
+			pipe.ExpireNX(ctx, tagKey, ttl)
+			pipe.ExpireGT(ctx, tagKey, ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Delete removes the entries of keys.
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, key := range keys {
+		full[i] = s.prefix + "e:" + key
+	}
+	return s.client.Del(ctx, full...).Err()
+}
+
+// PurgeTag removes the entries tagged with a tag, and the set of the tag. The set is read and
+// deleted atomically, so that keys tagged meanwhile are kept for the next purge.
+func (s *RedisStore) PurgeTag(ctx context.Context, tag string) error {
+	tagKey := s.prefix + "t:" + tag
+	var members *redis.StringSliceCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		members = pipe.SMembers(ctx, tagKey)
+		pipe.Del(ctx, tagKey)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.Delete(ctx, members.Val()...)
+}
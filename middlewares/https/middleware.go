@@ -23,7 +23,9 @@ import (
 //     by forcing browsers to only use secure connections.
 //   - CSP: A string that represents the Content-Security-Policy header value. This policy helps
 //     to prevent a wide range of attacks including Cross-Site Scripting (XSS) and data
-//     injection attacks by specifying valid sources of content.
+//     injection attacks by specifying valid sources of content. The source 'nonce' is replaced
+//     by the nonce of each request, see mist.Context.CSPNonce; route groups needing another
+//     policy override the header with the csp package.
 //   - IncludeSubDomains: A boolean flag that, when set to true, applies the HSTS policy not only
 //     to the domain but also to all of its subdomains. This ensures that the entire domain
 //     hierarchy is only accessible over HTTPS.
@@ -162,7 +164,7 @@ func (m *MiddlewareBuilder) Build() mist.Middleware {
 
 			// Set the Content-Security-Policy header if a policy has been defined.
 			if m.Config.CSP != "" {
-				ctx.ResponseWriter.Header().Set("Content-Security-Policy", m.Config.CSP)
+				ctx.ResponseWriter.Header().Set("Content-Security-Policy", ctx.ExpandCSPNonce(m.Config.CSP))
 			}
 
 			// Proceed with the next function in the middleware chain.
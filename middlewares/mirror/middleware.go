@@ -0,0 +1,281 @@
+// Package mirror shadows production traffic: a share of the requests is replayed, after the
+// client got its response, to a shadow upstream or to an alternate handler, so that a new
+// implementation can be exercised with real traffic without affecting clients.
+//
+//	shadow, _ := url.Parse("http://orders-v2.internal:8080")
+//	server.Use(mirror.InitMiddlewareBuilder(10).
+//	    SetUpstream(shadow).
+//	    OnResult(func(r mirror.Result) {
+//	        if r.Err != nil || r.ShadowStatus != r.PrimaryStatus {
+//	            log.Printf("shadow mismatch on %s %s: %d vs %d (%v)", r.Method, r.Path, r.PrimaryStatus, r.ShadowStatus, r.Err)
+//	        }
+//	    }).
+//	    Build())
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/dormoron/mist"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HeaderShadow is set on every mirrored request, so that the shadow can tell mirrored traffic
+// apart, e.g. to skip side effects such as sending emails.
+const HeaderShadow = "X-Shadow-Request"
+
+// hopHeaders are the hop-by-hop headers, which are not forwarded to the shadow upstream.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Proxy-Authenticate", "Te", "Trailer",
+	"Transfer-Encoding", "Upgrade",
+}
+
+// Result describes a mirrored request, to compare the shadow with the primary.
+//
+// Fields:
+//   - Method: The request method.
+//   - Path: The request path.
+//   - PrimaryStatus: The status code returned to the client.
+//   - ShadowStatus: The status code of the shadow; 0 if it failed.
+//   - Latency: The duration of the shadow request.
+//   - Err: The error of the shadow request, or of the panic of the alternate handler.
+type Result struct {
+	Method        string
+	Path          string
+	PrimaryStatus int
+	ShadowStatus  int
+	Latency       time.Duration
+	Err           error
+}
+
+// MiddlewareBuilder builds the mirroring middleware.
+//
+// Fields:
+//   - percent: The share of requests mirrored, from 0 to 100.
+//   - upstream: The shadow upstream, when mirroring over HTTP.
+//   - handler: The alternate handler, when mirroring in process.
+//   - client: The client sending requests to the upstream.
+//   - timeout: The time limit of a mirrored request.
+//   - sanitize: Strips sensitive data from mirrored requests.
+//   - inFlight: Bounds the number of concurrent mirrored requests.
+//   - onResult: Receives the result of every mirrored request.
+type MiddlewareBuilder struct {
+	percent  float64
+	upstream *url.URL
+	handler  mist.HandleFunc
+	client   *http.Client
+	timeout  time.Duration
+	sanitize func(req *http.Request, body []byte) []byte
+	inFlight chan struct{}
+	onResult func(r Result)
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder mirroring the given percentage of the
+// requests. By default:
+//   - mirrored requests time out after 5 seconds,
+//   - at most 64 mirrored requests run at once, requests beyond are not mirrored,
+//   - the Authorization, Proxy-Authorization and Cookie headers are removed.
+//
+// A target must be set with SetUpstream or SetHandler.
+//
+// Parameters:
+//   - percent: The share of requests to mirror, from 0 to 100.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(percent float64) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		percent:  percent,
+		client:   http.DefaultClient,
+		timeout:  5 * time.Second,
+		sanitize: defaultSanitize,
+		inFlight: make(chan struct{}, 64),
+	}
+}
+
+// SetUpstream mirrors the requests to an HTTP upstream. The request path and query are
+// appended to the path of target.
+func (b *MiddlewareBuilder) SetUpstream(target *url.URL) *MiddlewareBuilder {
+	b.upstream, b.handler = target, nil
+	return b
+}
+
+// SetHandler mirrors the requests to an alternate handler in process. The handler runs on a
+// detached context, see mist.Context.Detach, carrying the request body; its response is
+// discarded. The route middleware does not run around it.
+func (b *MiddlewareBuilder) SetHandler(handler mist.HandleFunc) *MiddlewareBuilder {
+	b.handler, b.upstream = handler, nil
+	return b
+}
+
+// SetClient sets the client sending the requests to the upstream.
+func (b *MiddlewareBuilder) SetClient(client *http.Client) *MiddlewareBuilder {
+	b.client = client
+	return b
+}
+
+// SetTimeout sets the time limit of a mirrored request.
+func (b *MiddlewareBuilder) SetTimeout(timeout time.Duration) *MiddlewareBuilder {
+	b.timeout = timeout
+	return b
+}
+
+// SetMaxInFlight sets the maximum number of concurrent mirrored requests. Requests arriving
+// while the limit is reached are not mirrored, so that a slow shadow cannot pile up goroutines.
+func (b *MiddlewareBuilder) SetMaxInFlight(n int) *MiddlewareBuilder {
+	b.inFlight = make(chan struct{}, n)
+	return b
+}
+
+// SetSanitizer sets the function stripping sensitive data from mirrored requests. It may edit
+// the header of req in place, and returns the body to send.
+func (b *MiddlewareBuilder) SetSanitizer(fn func(req *http.Request, body []byte) []byte) *MiddlewareBuilder {
+	b.sanitize = fn
+	return b
+}
+
+// OnResult sets a function receiving the result of every mirrored request, e.g. to count the
+// responses of the shadow that differ from the primary. It is called from the goroutine of the
+// mirrored request.
+func (b *MiddlewareBuilder) OnResult(fn func(r Result)) *MiddlewareBuilder {
+	b.onResult = fn
+	return b
+}
+
+// defaultSanitize removes the credentials of the request.
+func defaultSanitize(req *http.Request, body []byte) []byte {
+	req.Header.Del("Authorization")
+	req.Header.Del("Proxy-Authorization")
+	req.Header.Del("Cookie")
+	return body
+}
+
+// Build creates the middleware. Sampled requests have their body cached with
+// mist.Context.BodyBytes before the handler runs; once the handler returned, the mirrored
+// request is dispatched in a goroutine. Requests whose body exceeds the body limit of the
+// server are not mirrored.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			if b.upstream == nil && b.handler == nil || rand.Float64()*100 >= b.percent {
+				next(ctx)
+				return
+			}
+			body, err := ctx.BodyBytes()
+			if err != nil {
+				next(ctx)
+				return
+			}
+			next(ctx)
+
+			select {
+			case b.inFlight <- struct{}{}:
+			default:
+				return
+			}
+			res := Result{Method: ctx.Request.Method, Path: ctx.Request.URL.Path, PrimaryStatus: ctx.RespStatusCode}
+			if b.handler != nil {
+				shadow := ctx.Detach()
+				go b.runHandler(shadow, body, res)
+				return
+			}
+			req := b.upstreamRequest(ctx.Request, body)
+			go b.send(req, res)
+		}
+	}
+}
+
+// upstreamRequest builds the request sent to the upstream, without context.
+func (b *MiddlewareBuilder) upstreamRequest(src *http.Request, body []byte) *http.Request {
+	target := *b.upstream
+	target.Path = strings.TrimSuffix(target.Path, "/") + src.URL.Path
+	target.RawPath = ""
+	target.RawQuery = src.URL.RawQuery
+
+	req := &http.Request{
+		Method:     src.Method,
+		URL:        &target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     src.Header.Clone(),
+		Host:       target.Host,
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	if b.sanitize != nil {
+		body = b.sanitize(req, body)
+	}
+	req.Header.Set(HeaderShadow, "1")
+	req.ContentLength = int64(len(body))
+	req.Body = http.NoBody
+	if len(body) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return req
+}
+
+// send sends a mirrored request to the upstream and reports the result.
+func (b *MiddlewareBuilder) send(req *http.Request, res Result) {
+	defer func() { <-b.inFlight }()
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	start := time.Now()
+	resp, err := b.client.Do(req.WithContext(ctx))
+	if err == nil {
+		// Drain the body so that the connection is reused.
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		res.ShadowStatus = resp.StatusCode
+	}
+	res.Latency, res.Err = time.Since(start), err
+	if b.onResult != nil {
+		b.onResult(res)
+	}
+}
+
+// runHandler runs the alternate handler on a detached context and reports the result.
+func (b *MiddlewareBuilder) runHandler(shadow *mist.Context, body []byte, res Result) {
+	defer func() { <-b.inFlight }()
+	ctx, cancel := context.WithTimeout(shadow.Request.Context(), b.timeout)
+	defer cancel()
+
+	req := shadow.Request.WithContext(ctx)
+	if b.sanitize != nil {
+		body = b.sanitize(req, body)
+	}
+	req.Header.Set(HeaderShadow, "1")
+	req.ContentLength = int64(len(body))
+	if len(body) > 0 {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	shadow.Request = req
+
+	start := time.Now()
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				res.Err = fmt.Errorf("mirror: alternate handler panicked: %v", r)
+			}
+		}()
+		b.handler(shadow)
+	}()
+	res.Latency = time.Since(start)
+	if res.Err == nil {
+		res.ShadowStatus = shadow.RespStatusCode
+		if res.ShadowStatus == 0 {
+			res.ShadowStatus = http.StatusOK
+		}
+	}
+	if b.onResult != nil {
+		b.onResult(res)
+	}
+}
@@ -65,8 +65,17 @@ func (m *MiddlewareBuilder) Build() mist.Middleware {
 			// This ensures the following code runs after the next handlers are completed,
 			// right before exiting the middleware function.
 			defer func() {
-				// If the route was matched, name the span after the matched route.
-				span.SetName(ctx.MatchedRoute)
+				// Name the span after the method and the matched route pattern, never the raw path,
+				// which would make span names unbounded; unmatched requests are named by method only.
+				if route := ctx.RoutePattern(); route != "" {
+					span.SetName(ctx.Request.Method + " " + route)
+					span.SetAttributes(attribute.String("http.route", route))
+				} else {
+					span.SetName(ctx.Request.Method)
+				}
+				if handler := ctx.HandlerName(); handler != "" {
+					span.SetAttributes(attribute.String("code.function", handler))
+				}
 
 				// Set additional attributes to the span, such as the HTTP status code.
 				span.SetAttributes(attribute.Int("http.status", ctx.RespStatusCode))
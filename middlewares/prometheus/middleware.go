@@ -63,8 +63,9 @@ func (m *MiddlewareBuilder) Build() mist.Middleware {
 				// Calculate the duration since the start time in microseconds
 				duration := time.Now().Sub(startTime).Microseconds()
 
-				// Retrieve the matched route pattern from the context, use "unknown" as a default
-				pattern := ctx.MatchedRoute
+				// Retrieve the matched route pattern from the context, use "unknown" as a default.
+				// The raw path is never used as a label, since its values are unbounded.
+				pattern := ctx.RoutePattern()
 				if pattern == "" {
 					pattern = "unknown"
 				}
@@ -0,0 +1,60 @@
+package prometheus
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RegisterStaticCache exports the statistics of the cache of a static resource handler, with
+// the const label cache set to name, and registers the metrics with the default registry:
+//   - <namespace>_<subsystem>_static_cache_hits_total: lookups served from fresh entries,
+//   - <namespace>_<subsystem>_static_cache_stale_hits_total: lookups served from stale entries,
+//   - <namespace>_<subsystem>_static_cache_misses_total: lookups read from the backend,
+//   - <namespace>_<subsystem>_static_cache_evictions_total: entries evicted to fit the budget,
+//   - <namespace>_<subsystem>_static_cache_entries: entries cached,
+//   - <namespace>_<subsystem>_static_cache_bytes: bytes cached,
+//   - <namespace>_<subsystem>_static_cache_max_bytes: the byte budget.
+//
+// It panics if the metrics of a cache with the same name are already registered.
+//
+// Parameters:
+//   - namespace, subsystem: The namespace and subsystem of the metrics.
+//   - name: The name of the cache, e.g. "assets".
+//   - cache: The cache, e.g. handler.Cache().
+func RegisterStaticCache(namespace string, subsystem string, name string, cache *mist.StaticCache) {
+	labels := prometheus.Labels{"cache": name}
+	counter := func(metric string, help string, value func(mist.StaticCacheStats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return float64(value(cache.Stats())) })
+	}
+	gauge := func(metric string, help string, value func(mist.StaticCacheStats) int64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        metric,
+			Help:        help,
+			ConstLabels: labels,
+		}, func() float64 { return float64(value(cache.Stats())) })
+	}
+	prometheus.MustRegister(
+		counter("static_cache_hits_total", "Lookups served from fresh entries of the static cache.",
+			func(s mist.StaticCacheStats) uint64 { return s.Hits }),
+		counter("static_cache_stale_hits_total", "Lookups served from stale entries of the static cache while they were revalidated.",
+			func(s mist.StaticCacheStats) uint64 { return s.StaleHits }),
+		counter("static_cache_misses_total", "Lookups of the static cache read from the backend.",
+			func(s mist.StaticCacheStats) uint64 { return s.Misses }),
+		counter("static_cache_evictions_total", "Entries evicted from the static cache to fit its budget.",
+			func(s mist.StaticCacheStats) uint64 { return s.Evictions }),
+		gauge("static_cache_entries", "Entries in the static cache.",
+			func(s mist.StaticCacheStats) int64 { return int64(s.Entries) }),
+		gauge("static_cache_bytes", "Bytes held by the static cache.",
+			func(s mist.StaticCacheStats) int64 { return s.Bytes }),
+		gauge("static_cache_max_bytes", "Byte budget of the static cache.",
+			func(s mist.StaticCacheStats) int64 { return s.MaxBytes }),
+	)
+}
@@ -0,0 +1,254 @@
+// Package proxyheaders restores the scheme, host and port the client used when the server runs
+// behind reverse proxies or load balancers, from the standard Forwarded header (RFC 7239) or
+// the de facto X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port headers. It updates
+// Request.URL and Request.Host, so that mist.Context.Scheme and mist.Context.FullURL generate
+// correct absolute URLs.
+//
+// The headers are only honoured on requests coming from trusted proxies; anyone else could
+// forge them:
+//
+//	server.Use(proxyheaders.InitMiddlewareBuilder("10.0.0.0/8", "127.0.0.1").Build())
+package proxyheaders
+
+import (
+	"fmt"
+	"github.com/dormoron/mist"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// MiddlewareBuilder builds the proxy headers middleware.
+type MiddlewareBuilder struct {
+	trusted []netip.Prefix
+}
+
+// InitMiddlewareBuilder creates a builder trusting the given proxies. It panics when a proxy is
+// neither an IP address nor a CIDR prefix.
+//
+// Parameters:
+//   - proxies: The addresses of the trusted proxies, as IP addresses or CIDR prefixes, e.g.
+//     "10.0.0.0/8" or "::1".
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(proxies ...string) *MiddlewareBuilder {
+	b := &MiddlewareBuilder{}
+	for _, proxy := range proxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("proxyheaders: invalid trusted proxy %q: %v", proxy, err))
+		}
+		b.trusted = append(b.trusted, prefix)
+	}
+	return b
+}
+
+// Build creates the middleware. On requests coming from a trusted proxy, it sets the scheme and
+// host of Request.URL, and Request.Host, to those the client used:
+//   - from the Forwarded header when present: the element describing the first hop that is not
+//     a trusted proxy is used, so that elements forged by the client are ignored,
+//   - otherwise from the X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port headers; the
+//     last value of a list is used, being the one set by the nearest proxy.
+//
+// Malformed values are ignored. Requests from other peers are left untouched.
+//
+// Returns:
+//   - mist.Middleware: The proxy headers middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			if b.trustedPeer(ctx.Request.RemoteAddr) {
+				b.decorate(ctx.Request)
+			}
+			next(ctx)
+		}
+	}
+}
+
+// decorate applies the forwarded scheme and host to the request.
+func (b *MiddlewareBuilder) decorate(req *http.Request) {
+	var proto, host, port string
+	if forwarded := req.Header.Values("Forwarded"); len(forwarded) > 0 {
+		proto, host = b.fromForwarded(forwarded)
+	} else {
+		proto = lastValue(req.Header.Get("X-Forwarded-Proto"))
+		host = lastValue(req.Header.Get("X-Forwarded-Host"))
+		port = lastValue(req.Header.Get("X-Forwarded-Port"))
+	}
+
+	proto = strings.ToLower(proto)
+	if proto == "http" || proto == "https" {
+		req.URL.Scheme = proto
+	}
+	if host != "" && validHost(host) {
+		req.Host = host
+	}
+	if port != "" && validPort(port) {
+		hostname := req.Host
+		if h, _, err := net.SplitHostPort(req.Host); err == nil {
+			hostname = h
+		}
+		if strings.Contains(hostname, ":") {
+			hostname = "[" + hostname + "]"
+		}
+		req.Host = hostname + ":" + port
+	}
+	req.Host = stripDefaultPort(req.Host, req.URL.Scheme)
+	req.URL.Host = req.Host
+}
+
+// fromForwarded returns the proto and host parameters of the Forwarded element added by the
+// proxy the client connected to: elements are walked from the nearest proxy outwards, as long
+// as they were received from a trusted proxy.
+func (b *MiddlewareBuilder) fromForwarded(values []string) (string, string) {
+	var elements []map[string]string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			elements = append(elements, parseElement(element))
+		}
+	}
+	i := len(elements) - 1
+	for i > 0 && b.trustedNode(elements[i]["for"]) {
+		i--
+	}
+	return elements[i]["proto"], elements[i]["host"]
+}
+
+// trustedPeer reports whether the remote address of a request is a trusted proxy.
+func (b *MiddlewareBuilder) trustedPeer(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && b.trustedAddr(addr)
+}
+
+// trustedNode reports whether a node of the Forwarded header, such as "192.0.2.43:47011" or
+// "[2001:db8::17]", is a trusted proxy. Obfuscated and unknown nodes are not.
+func (b *MiddlewareBuilder) trustedNode(node string) bool {
+	if strings.HasPrefix(node, "[") {
+		end := strings.IndexByte(node, ']')
+		if end < 0 {
+			return false
+		}
+		node = node[1:end]
+	} else if strings.Count(node, ":") == 1 {
+		node = node[:strings.IndexByte(node, ':')]
+	}
+	addr, err := netip.ParseAddr(node)
+	return err == nil && b.trustedAddr(addr)
+}
+
+// trustedAddr reports whether an address belongs to a trusted proxy.
+func (b *MiddlewareBuilder) trustedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range b.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefix parses a CIDR prefix or a single IP address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// parseElement parses the semicolon-separated parameters of a Forwarded element, with
+// lowercased names and unquoted values.
+func parseElement(element string) map[string]string {
+	params := make(map[string]string, 4)
+	for _, pair := range splitQuoted(element, ';') {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = strings.ReplaceAll(value[1:len(value)-1], `\`, "")
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return params
+}
+
+// splitQuoted splits s on sep, ignoring separators within quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			i++
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// lastValue returns the last element of a comma-separated header value.
+func lastValue(value string) string {
+	if i := strings.LastIndexByte(value, ','); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
+
+// validHost reports whether a forwarded host is a plain host, optionally with a port, that
+// cannot alter the rest of a URL built from it.
+func validHost(host string) bool {
+	if strings.ContainsAny(host, "/\\@?# \t") {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host
+}
+
+// validPort reports whether a forwarded port is a valid TCP port.
+func validPort(port string) bool {
+	if len(port) == 0 || len(port) > 5 {
+		return false
+	}
+	n := 0
+	for _, r := range port {
+		if r < '0' || r > '9' {
+			return false
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n > 0 && n <= 65535
+}
+
+// stripDefaultPort removes the port of a host when it is the default port of the scheme.
+func stripDefaultPort(host string, scheme string) string {
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		if strings.Contains(h, ":") {
+			return "[" + h + "]"
+		}
+		return h
+	}
+	return host
+}
@@ -0,0 +1,273 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Plan is a quota plan, such as a free or a pro tier, assigned to the principals calling an API.
+//
+// Fields:
+//   - Name: The name of the plan, e.g. "free" or "pro".
+//   - Rate: The calls allowed per Interval, to absorb bursts; 0 disables the limit.
+//   - Interval: The length of the windows of Rate, e.g. time.Minute.
+//   - Daily: The calls allowed per calendar day; 0 means unlimited.
+//   - Monthly: The calls allowed per calendar month; 0 means unlimited.
+//   - Overage: Whether the calls over Daily or Monthly are served and reported to the
+//     over-quota hooks, e.g. to be billed, rather than rejected. Rate is always enforced.
+type Plan struct {
+	Name     string
+	Rate     int64
+	Interval time.Duration
+	Daily    int64
+	Monthly  int64
+	Overage  bool
+}
+
+// Period identifies a counter of a plan.
+type Period string
+
+const (
+	// PeriodRate is the counter of the Rate of a plan.
+	PeriodRate Period = "rate"
+	// PeriodDaily is the counter of the calls of the day.
+	PeriodDaily Period = "daily"
+	// PeriodMonthly is the counter of the calls of the month.
+	PeriodMonthly Period = "monthly"
+)
+
+// QuotaEvent describes a call over the daily or monthly quota of a principal, passed to the
+// over-quota hooks.
+//
+// Fields:
+//   - Principal: The API key or user ID the call was counted for.
+//   - Plan: The name of the plan of the principal.
+//   - Period: The quota exceeded.
+//   - Limit: The calls allowed in the period.
+//   - Used: The calls counted in the period, including this one when it was served.
+//   - Served: Whether the call was served as overage rather than rejected.
+type QuotaEvent struct {
+	Principal string
+	Plan      string
+	Period    Period
+	Limit     int64
+	Used      int64
+	Served    bool
+}
+
+// QuotaBuilder builds a middleware enforcing quota plans per principal, the API key or user ID
+// of the caller rather than its IP address. Every response carries the state of the limits:
+//   - X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset for the Rate of the plan,
+//   - X-Quota-Limit, X-Quota-Remaining and X-Quota-Reset for the daily or monthly quota with
+//     the fewest calls remaining,
+//
+// the resets in seconds. Rejected calls receive 429 with a Retry-After header.
+type QuotaBuilder struct {
+	store       QuotaStore
+	principalFn func(ctx *mist.Context) (principal string, plan string)
+	plans       map[string]Plan
+	defaultPlan string
+	prefix      string
+	location    *time.Location
+	onOverQuota []func(ctx context.Context, e QuotaEvent)
+	logFn       func(level string, msg any, args ...any)
+	now         func() time.Time
+}
+
+// InitQuotaBuilder creates a QuotaBuilder. Days and months are counted in UTC.
+//
+// Parameters:
+//   - store: The store of the counters, e.g. InitRedisQuotaStore(client).
+//   - principalFn: The function returning the principal of a request and the name of its
+//     plan, e.g. from the API key of the request or the claims of its user. Requests without
+//     a principal are not limited; principals of an unknown plan get the first plan.
+//   - plans: The plans.
+//
+// Returns:
+//   - *QuotaBuilder: The initialized builder.
+func InitQuotaBuilder(store QuotaStore, principalFn func(ctx *mist.Context) (principal string, plan string), plans ...Plan) *QuotaBuilder {
+	b := &QuotaBuilder{
+		store:       store,
+		principalFn: principalFn,
+		plans:       make(map[string]Plan, len(plans)),
+		prefix:      "quota",
+		location:    time.UTC,
+		logFn: func(level string, msg any, args ...any) {
+			v := make([]any, 0, len(args)+2)
+			v = append(v, level, msg)
+			v = append(v, args...)
+			log.Println(v...)
+		},
+		now: time.Now,
+	}
+	for _, p := range plans {
+		b.plans[p.Name] = p
+	}
+	if len(plans) > 0 {
+		b.defaultPlan = plans[0].Name
+	}
+	return b
+}
+
+// SetKeyPrefix sets the prefix of the keys of the counters.
+func (b *QuotaBuilder) SetKeyPrefix(prefix string) *QuotaBuilder {
+	b.prefix = prefix
+	return b
+}
+
+// SetLocation sets the time zone the days and months of the quotas are counted in, e.g. the
+// one of the billing cycle.
+func (b *QuotaBuilder) SetLocation(loc *time.Location) *QuotaBuilder {
+	b.location = loc
+	return b
+}
+
+// SetLogFunc sets the function used to log store failures.
+func (b *QuotaBuilder) SetLogFunc(fn func(level string, msg any, args ...any)) *QuotaBuilder {
+	b.logFn = fn
+	return b
+}
+
+// OnOverQuota adds a hook called for every call over a daily or monthly quota, served as
+// overage or rejected, e.g. to record billing events or to warn the customer.
+func (b *QuotaBuilder) OnOverQuota(fn func(ctx context.Context, e QuotaEvent)) *QuotaBuilder {
+	b.onOverQuota = append(b.onOverQuota, fn)
+	return b
+}
+
+// Build creates the middleware. When the store fails, calls are served without being counted.
+func (b *QuotaBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			principal, planName := b.principalFn(ctx)
+			if principal == "" {
+				next(ctx)
+				return
+			}
+			plan, ok := b.plans[planName]
+			if !ok {
+				plan = b.plans[b.defaultPlan]
+			}
+			now := b.now().In(b.location)
+			counters, periods := b.counters(principal, plan, now)
+			if len(counters) == 0 {
+				next(ctx)
+				return
+			}
+			counts, taken, err := b.store.Take(ctx.Request.Context(), counters)
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down.
+				b.logFn("error", "quota check failed: ", err)
+				next(ctx)
+				return
+			}
+			b.setHeaders(ctx, counters, periods, counts, now)
+
+			for i, c := range counters {
+				if periods[i] == PeriodRate || c.Limit <= 0 {
+					continue
+				}
+				if (taken && counts[i] > c.Limit) || (!taken && counts[i] >= c.Limit) {
+					b.overQuota(ctx, QuotaEvent{
+						Principal: principal,
+						Plan:      plan.Name,
+						Period:    periods[i],
+						Limit:     c.Limit,
+						Used:      counts[i],
+						Served:    taken,
+					})
+				}
+			}
+			if taken {
+				next(ctx)
+				return
+			}
+			for i, c := range counters {
+				if !c.Soft && c.Limit > 0 && counts[i] >= c.Limit {
+					ctx.Header("Retry-After", strconv.FormatInt(seconds(c.ResetAt.Sub(now)), 10))
+					detail := "the rate limit is exceeded, retry later"
+					if periods[i] != PeriodRate {
+						detail = "the " + string(periods[i]) + " quota is exhausted"
+					}
+					_ = ctx.RespondProblem(mist.Problem{Status: http.StatusTooManyRequests, Detail: detail})
+					return
+				}
+			}
+		}
+	}
+}
+
+// counters returns the counters of a principal under a plan at a time, and their periods. The
+// keys share the {principal} hash tag so that a Redis Cluster keeps them in one slot.
+func (b *QuotaBuilder) counters(principal string, plan Plan, now time.Time) ([]QuotaCounter, []Period) {
+	base := b.prefix + ":{" + principal + "}:"
+	var counters []QuotaCounter
+	var periods []Period
+	if plan.Rate > 0 && plan.Interval > 0 {
+		start := now.Truncate(plan.Interval)
+		counters = append(counters, QuotaCounter{
+			Key:     base + "r:" + strconv.FormatInt(start.UnixMilli(), 10),
+			Limit:   plan.Rate,
+			ResetAt: start.Add(plan.Interval),
+		})
+		periods = append(periods, PeriodRate)
+	}
+	y, m, d := now.Date()
+	if plan.Daily > 0 {
+		counters = append(counters, QuotaCounter{
+			Key:     base + "d:" + now.Format("20060102"),
+			Limit:   plan.Daily,
+			ResetAt: time.Date(y, m, d+1, 0, 0, 0, 0, now.Location()),
+			Soft:    plan.Overage,
+		})
+		periods = append(periods, PeriodDaily)
+	}
+	if plan.Monthly > 0 {
+		counters = append(counters, QuotaCounter{
+			Key:     base + "m:" + now.Format("200601"),
+			Limit:   plan.Monthly,
+			ResetAt: time.Date(y, m+1, 1, 0, 0, 0, 0, now.Location()),
+			Soft:    plan.Overage,
+		})
+		periods = append(periods, PeriodMonthly)
+	}
+	return counters, periods
+}
+
+// setHeaders sets the rate limit and quota headers of a response.
+func (b *QuotaBuilder) setHeaders(ctx *mist.Context, counters []QuotaCounter, periods []Period, counts []int64, now time.Time) {
+	quota := -1
+	for i, c := range counters {
+		if periods[i] == PeriodRate {
+			ctx.Header("X-RateLimit-Limit", strconv.FormatInt(c.Limit, 10))
+			ctx.Header("X-RateLimit-Remaining", strconv.FormatInt(max(c.Limit-counts[i], 0), 10))
+			ctx.Header("X-RateLimit-Reset", strconv.FormatInt(seconds(c.ResetAt.Sub(now)), 10))
+			continue
+		}
+		if quota < 0 || c.Limit-counts[i] < counters[quota].Limit-counts[quota] {
+			quota = i
+		}
+	}
+	if quota >= 0 {
+		c := counters[quota]
+		ctx.Header("X-Quota-Limit", strconv.FormatInt(c.Limit, 10))
+		ctx.Header("X-Quota-Remaining", strconv.FormatInt(max(c.Limit-counts[quota], 0), 10))
+		ctx.Header("X-Quota-Reset", strconv.FormatInt(seconds(c.ResetAt.Sub(now)), 10))
+	}
+}
+
+// overQuota calls the over-quota hooks.
+func (b *QuotaBuilder) overQuota(ctx *mist.Context, e QuotaEvent) {
+	for _, fn := range b.onOverQuota {
+		fn(ctx.Request.Context(), e)
+	}
+}
+
+// seconds returns a duration in whole seconds, rounded up.
+func seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// QuotaCounter is a counter of a principal, such as its calls of the day.
+//
+// Fields:
+//   - Key: The key of the counter.
+//   - Limit: The calls allowed until ResetAt; 0 means unlimited.
+//   - ResetAt: When the counter expires and restarts from 0.
+//   - Soft: Whether calls over Limit are still counted and served, e.g. billed as overage,
+//     rather than rejected.
+type QuotaCounter struct {
+	Key     string
+	Limit   int64
+	ResetAt time.Time
+	Soft    bool
+}
+
+// QuotaStore keeps the counters of the quota plans. Implementations must be safe for
+// concurrent use and update the counters of a call atomically; use a shared store such as
+// RedisQuotaStore when several instances serve the API.
+type QuotaStore interface {
+	// Take counts a call on every counter, unless a counter that is not Soft has reached its
+	// limit. It returns the values of the counters, including the call when it was counted.
+	Take(ctx context.Context, counters []QuotaCounter) (counts []int64, taken bool, err error)
+}
+
+// MemoryQuotaStore is a QuotaStore keeping counters in process memory. It suits
+// single-instance servers and tests; counters are lost on restart.
+type MemoryQuotaStore struct {
+	mutex     sync.Mutex
+	counters  map[string]memoryCounter
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// memoryCounter is a counter of a MemoryQuotaStore.
+type memoryCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// InitMemoryQuotaStore creates an empty MemoryQuotaStore. Expired counters are purged as calls
+// are counted.
+func InitMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{counters: make(map[string]memoryCounter), lastSweep: time.Now(), now: time.Now}
+}
+
+// Take counts a call on the counters unless a hard limit is reached.
+func (m *MemoryQuotaStore) Take(_ context.Context, counters []QuotaCounter) ([]int64, bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.now()
+	if now.Sub(m.lastSweep) >= time.Minute {
+		for key, c := range m.counters {
+			if !now.Before(c.expires) {
+				delete(m.counters, key)
+			}
+		}
+		m.lastSweep = now
+	}
+	counts := make([]int64, len(counters))
+	blocked := false
+	for i, qc := range counters {
+		if c, ok := m.counters[qc.Key]; ok && now.Before(c.expires) {
+			counts[i] = c.count
+		}
+		if qc.Limit > 0 && !qc.Soft && counts[i] >= qc.Limit {
+			blocked = true
+		}
+	}
+	if blocked {
+		return counts, false, nil
+	}
+	for i, qc := range counters {
+		counts[i]++
+		m.counters[qc.Key] = memoryCounter{count: counts[i], expires: qc.ResetAt}
+	}
+	return counts, true, nil
+}
+
+// RedisQuotaStore is a QuotaStore shared by every instance through Redis. The counters of a
+// call are updated by one script; on Redis Cluster, their keys must share a hash slot, which
+// the keys built by QuotaBuilder do.
+type RedisQuotaStore struct {
+	client redis.Cmdable
+}
+
+// InitRedisQuotaStore creates a RedisQuotaStore on the given client.
+func InitRedisQuotaStore(client redis.Cmdable) *RedisQuotaStore {
+	return &RedisQuotaStore{client: client}
+}
+
+// luaQuotaTake checks the limits of the counters in KEYS, then increments them all, setting
+// their expiry on the first increment. ARGV holds the limit, the expiry in Unix milliseconds
+// and the soft flag of each counter. The counts are returned followed by 1 when the call was
+// counted, 0 when it was rejected.
+const luaQuotaTake = `local counts = {}
+local blocked = false
+for i, key in ipairs(KEYS) do
+	counts[i] = tonumber(redis.call('GET', key) or '0')
+	local limit = tonumber(ARGV[3*i-2])
+	if limit > 0 and ARGV[3*i] ~= '1' and counts[i] >= limit then
+		blocked = true
+	end
+end
+if blocked then
+	counts[#KEYS+1] = 0
+	return counts
+end
+for i, key in ipairs(KEYS) do
+	counts[i] = redis.call('INCR', key)
+	if counts[i] == 1 then
+		redis.call('PEXPIREAT', key, ARGV[3*i-1])
+	end
+end
+counts[#KEYS+1] = 1
+return counts`
+
+// Take counts a call on the counters unless a hard limit is reached.
+func (r *RedisQuotaStore) Take(ctx context.Context, counters []QuotaCounter) ([]int64, bool, error) {
+	keys := make([]string, len(counters))
+	args := make([]any, 0, 3*len(counters))
+	for i, c := range counters {
+		keys[i] = c.Key
+		soft := 0
+		if c.Soft {
+			soft = 1
+		}
+		args = append(args, c.Limit, c.ResetAt.UnixMilli(), soft)
+	}
+	res, err := r.client.Eval(ctx, luaQuotaTake, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	return res[:len(counters)], res[len(counters)] == 1, nil
+}
@@ -3,6 +3,7 @@ package recovery
 import (
 	"fmt"
 	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/redact"
 	"time"
 )
 
@@ -67,9 +68,14 @@ func (m *MiddlewareBuilder) SetLogFunc(logFunc func(ctx *mist.Context, err any))
 }
 
 // defaultLogFunc is the default logging function used by the middleware.
-// It logs a message with a timestamp to standard output.
+// It logs a message with a timestamp and the request to standard output, the sensitive query
+// parameters masked by redact.Default().
 func defaultLogFunc(ctx *mist.Context, err any) {
-	fmt.Printf("%s - %e\n", time.Now().Format(time.RFC3339), err)
+	target := ctx.Request.URL.Path
+	if query := redact.Default().Query(ctx.Request.URL.RawQuery); query != "" {
+		target += "?" + query
+	}
+	fmt.Printf("%s - %s %s - %v\n", time.Now().Format(time.RFC3339), ctx.Request.Method, target, err)
 }
 
 // Build creates and returns a mist.Middleware based on the configurations provided in the MiddlewareBuilder.
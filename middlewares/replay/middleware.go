@@ -0,0 +1,192 @@
+// Package replay protects signed API requests against replay. Every request carries the time
+// it was signed at and a nonce, both covered by its signature; the middleware rejects requests
+// signed outside of an acceptance window around the server clock, and requests whose nonce was
+// already seen within that window, so that a captured request cannot be sent again.
+//
+//	store := replay.InitRedisNonceStore(client)
+//	api := server.Group("/api", replay.InitMiddlewareBuilder(store).
+//	    SetVerifier(verifySignature).
+//	    Build())
+package replay
+
+import (
+	"github.com/dormoron/mist"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Reason tells why a request was rejected.
+type Reason string
+
+const (
+	// ReasonMissing reports a request without timestamp or nonce.
+	ReasonMissing Reason = "missing"
+	// ReasonMalformed reports a timestamp that is not a Unix time in seconds, or a nonce of an
+	// invalid length.
+	ReasonMalformed Reason = "malformed"
+	// ReasonExpired reports a request signed too long ago.
+	ReasonExpired Reason = "expired"
+	// ReasonFuture reports a request signed further in the future than the clock skew allows.
+	ReasonFuture Reason = "future"
+	// ReasonReplayed reports a nonce already seen within the window.
+	ReasonReplayed Reason = "replayed"
+	// ReasonInvalid reports a request failing the verifier.
+	ReasonInvalid Reason = "invalid"
+)
+
+// details are the problem details of the rejected requests.
+var details = map[Reason]string{
+	ReasonMissing:   "the request must carry a timestamp and a nonce",
+	ReasonMalformed: "the timestamp or the nonce of the request is malformed",
+	ReasonExpired:   "the request has expired, sign it again",
+	ReasonFuture:    "the request is signed in the future, check the clock of the client",
+	ReasonReplayed:  "the nonce of the request was already used",
+	ReasonInvalid:   "the signature of the request is invalid",
+}
+
+// MiddlewareBuilder builds the replay protection middleware. Groups with different needs, e.g.
+// a wider window for batch clients, use builders of their own.
+type MiddlewareBuilder struct {
+	store           NonceStore
+	timestampHeader string
+	nonceHeader     string
+	window          time.Duration
+	skew            time.Duration
+	minNonce        int
+	maxNonce        int
+	verifier        func(ctx *mist.Context, timestamp time.Time, nonce string) error
+	onReject        func(ctx *mist.Context, reason Reason)
+}
+
+// InitMiddlewareBuilder creates a builder reading the signing time, a Unix time in seconds,
+// from the X-Timestamp header and the nonce, 16 to 128 characters, from the X-Nonce header.
+// Requests signed more than 5 minutes ago, or more than 30 seconds in the future to tolerate
+// clock skew, are rejected.
+//
+// Parameters:
+//   - store: The store of the nonces, e.g. InitMemoryNonceStore() or
+//     InitRedisNonceStore(client).
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(store NonceStore) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		store:           store,
+		timestampHeader: "X-Timestamp",
+		nonceHeader:     "X-Nonce",
+		window:          5 * time.Minute,
+		skew:            30 * time.Second,
+		minNonce:        16,
+		maxNonce:        128,
+	}
+}
+
+// SetHeaders sets the names of the headers carrying the signing time and the nonce.
+func (b *MiddlewareBuilder) SetHeaders(timestamp string, nonce string) *MiddlewareBuilder {
+	b.timestampHeader = timestamp
+	b.nonceHeader = nonce
+	return b
+}
+
+// SetWindow sets how old a request may be.
+func (b *MiddlewareBuilder) SetWindow(window time.Duration) *MiddlewareBuilder {
+	b.window = window
+	return b
+}
+
+// SetClockSkew sets how far in the future a request may be signed, to tolerate clients whose
+// clock runs ahead.
+func (b *MiddlewareBuilder) SetClockSkew(skew time.Duration) *MiddlewareBuilder {
+	b.skew = skew
+	return b
+}
+
+// SetNonceLength sets the accepted lengths of the nonces.
+func (b *MiddlewareBuilder) SetNonceLength(min int, max int) *MiddlewareBuilder {
+	b.minNonce = min
+	b.maxNonce = max
+	return b
+}
+
+// SetVerifier sets the function verifying the signature of a request, called before its nonce
+// is recorded so that unsigned requests cannot fill the store or burn the nonces of legitimate
+// clients. It returns an error for requests to reject.
+func (b *MiddlewareBuilder) SetVerifier(fn func(ctx *mist.Context, timestamp time.Time, nonce string) error) *MiddlewareBuilder {
+	b.verifier = fn
+	return b
+}
+
+// OnReject sets the handler of the rejected requests, in place of the default 401 problem
+// response; the request is aborted after it.
+func (b *MiddlewareBuilder) OnReject(fn func(ctx *mist.Context, reason Reason)) *MiddlewareBuilder {
+	b.onReject = fn
+	return b
+}
+
+// Build creates the middleware. Rejected requests get 401 with a problem response; when the
+// store fails, requests are answered with 503 rather than let through.
+//
+// Returns:
+//   - mist.Middleware: The replay protection middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			rawTimestamp := ctx.Request.Header.Get(b.timestampHeader)
+			nonce := ctx.Request.Header.Get(b.nonceHeader)
+			if rawTimestamp == "" || nonce == "" {
+				b.reject(ctx, ReasonMissing)
+				return
+			}
+			seconds, err := strconv.ParseInt(rawTimestamp, 10, 64)
+			if err != nil || len(nonce) < b.minNonce || len(nonce) > b.maxNonce {
+				b.reject(ctx, ReasonMalformed)
+				return
+			}
+			timestamp := time.Unix(seconds, 0)
+			age := time.Since(timestamp)
+			if age > b.window {
+				b.reject(ctx, ReasonExpired)
+				return
+			}
+			if -age > b.skew {
+				b.reject(ctx, ReasonFuture)
+				return
+			}
+			if b.verifier != nil {
+				if err := b.verifier(ctx, timestamp, nonce); err != nil {
+					b.reject(ctx, ReasonInvalid)
+					return
+				}
+			}
+			// The nonce is remembered until the request falls out of the window.
+			claimed, err := b.store.Claim(ctx.Request.Context(), nonce, b.window-age+time.Second)
+			if err != nil {
+				_ = ctx.RespondProblem(mist.Problem{
+					Status: http.StatusServiceUnavailable,
+					Detail: "the request cannot be verified right now, retry later",
+				})
+				ctx.Abort()
+				return
+			}
+			if !claimed {
+				b.reject(ctx, ReasonReplayed)
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// reject answers a rejected request.
+func (b *MiddlewareBuilder) reject(ctx *mist.Context, reason Reason) {
+	if b.onReject != nil {
+		b.onReject(ctx, reason)
+	} else {
+		_ = ctx.RespondProblem(mist.Problem{
+			Status: http.StatusUnauthorized,
+			Detail: details[reason],
+		})
+	}
+	ctx.Abort()
+}
@@ -0,0 +1,73 @@
+package replay
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// NonceStore remembers the nonces seen within the acceptance window. Implementations must be
+// safe for concurrent use; use a shared store such as RedisNonceStore when several instances
+// serve the API, or a request replayed against another instance would be accepted.
+type NonceStore interface {
+	// Claim records a nonce for ttl, reporting false when it was already recorded.
+	Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is a NonceStore keeping the nonces in process memory, for single-instance
+// servers and tests.
+type MemoryNonceStore struct {
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// InitMemoryNonceStore creates an empty MemoryNonceStore.
+func InitMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time)}
+}
+
+// Claim records a nonce unless it is recorded and not expired. Expired nonces are swept once a
+// minute.
+func (m *MemoryNonceStore) Claim(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for n, expiry := range m.nonces {
+			if !now.Before(expiry) {
+				delete(m.nonces, n)
+			}
+		}
+		m.lastSweep = now
+	}
+	if expiry, ok := m.nonces[nonce]; ok && now.Before(expiry) {
+		return false, nil
+	}
+	m.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// RedisNonceStore is a NonceStore shared by every instance through Redis, recording each
+// nonce with SET NX under "<prefix>:<nonce>".
+type RedisNonceStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// InitRedisNonceStore creates a RedisNonceStore with keys prefixed by "replay".
+func InitRedisNonceStore(client redis.Cmdable) *RedisNonceStore {
+	return &RedisNonceStore{client: client, prefix: "replay"}
+}
+
+// SetKeyPrefix sets the prefix of the keys of the store.
+func (r *RedisNonceStore) SetKeyPrefix(prefix string) *RedisNonceStore {
+	r.prefix = prefix
+	return r
+}
+
+// Claim records a nonce with SET NX and the ttl as expiry.
+func (r *RedisNonceStore) Claim(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, r.prefix+":"+nonce, 1, ttl).Result()
+}
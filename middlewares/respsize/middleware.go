@@ -0,0 +1,229 @@
+// Package respsize caps the size of responses, a safeguard against handlers accidentally
+// dumping gigabytes of JSON. Oversized responses are either rejected with a 500 problem
+// response or truncated with a Warning header, and reported to a hook and to metrics so that
+// the offending routes can be fixed.
+//
+// The limit can be raised or lowered per route with route metadata:
+//
+//	server.Use(respsize.InitMiddlewareBuilder(1 << 20).SetMetrics("shop", "http").Build())
+//	server.GET("/export", exportHandler).Meta(respsize.MetaMaxBytes, 64<<20)
+package respsize
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+)
+
+// MetaMaxBytes is the route metadata key overriding the limit of a route, see mist.Route.Meta.
+// Its value is an int or an int64; 0 or less disables the limit for the route.
+const MetaMaxBytes = "response.max_bytes"
+
+// Policy is the action taken on oversized responses.
+type Policy int
+
+const (
+	// Reject replaces oversized responses with a 500 problem response.
+	Reject Policy = iota
+	// Truncate cuts oversized responses at the limit and adds a Warning header.
+	Truncate
+)
+
+// String returns the name of the policy, used as a metric label.
+func (p Policy) String() string {
+	if p == Truncate {
+		return "truncate"
+	}
+	return "reject"
+}
+
+// Offense describes an oversized response.
+//
+// Fields:
+//   - Route: The matched route pattern, or "unknown".
+//   - Method: The HTTP method of the request.
+//   - Size: The size of the response body; for streamed bodies, the limit at which they were
+//     cut.
+//   - Limit: The limit of the route.
+//   - Streamed: Whether the body was written to the ResponseWriter directly, in which case it
+//     was cut at the limit whatever the policy.
+type Offense struct {
+	Route    string
+	Method   string
+	Size     int64
+	Limit    int64
+	Streamed bool
+}
+
+// MiddlewareBuilder builds the response size limiting middleware.
+type MiddlewareBuilder struct {
+	limit     int64
+	policy    Policy
+	onOffense func(ctx *mist.Context, o Offense)
+	offenses  *prometheus.CounterVec
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder rejecting responses larger than limit.
+//
+// Parameters:
+//   - limit: The default size limit of response bodies in bytes.
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(limit int64) *MiddlewareBuilder {
+	return &MiddlewareBuilder{limit: limit}
+}
+
+// SetPolicy sets the action taken on oversized responses.
+func (b *MiddlewareBuilder) SetPolicy(policy Policy) *MiddlewareBuilder {
+	b.policy = policy
+	return b
+}
+
+// OnOffense sets the hook called for every oversized response, e.g. to log the route.
+func (b *MiddlewareBuilder) OnOffense(fn func(ctx *mist.Context, o Offense)) *MiddlewareBuilder {
+	b.onOffense = fn
+	return b
+}
+
+// SetMetrics counts the oversized responses in <namespace>_<subsystem>_oversized_responses_total,
+// labelled with the route pattern, the method and the policy, and registers the counter with
+// the default registry. It panics if the counter is already registered.
+func (b *MiddlewareBuilder) SetMetrics(namespace string, subsystem string) *MiddlewareBuilder {
+	b.offenses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "oversized_responses_total",
+		Help:      "Responses exceeding the response size limit.",
+	}, []string{"pattern", "method", "policy"})
+	prometheus.MustRegister(b.offenses)
+	return b
+}
+
+// Build creates the middleware. Bodies set in RespData are checked once the handler returned;
+// bodies written to the ResponseWriter directly, such as streams, are cut at the limit as they
+// are written, since their status is already sent. A handler that sent its header before
+// setting RespData cannot be rejected or truncated cleanly anymore: its body is dropped, which
+// aborts the response.
+//
+// Returns:
+//   - mist.Middleware: The size limiting middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			limit := b.routeLimit(ctx)
+			if limit <= 0 {
+				next(ctx)
+				return
+			}
+			lw := &limitWriter{ResponseWriter: ctx.ResponseWriter, limit: limit}
+			lw.onCut = func() {
+				b.report(ctx, Offense{Size: limit, Limit: limit, Streamed: true})
+			}
+			ctx.ResponseWriter = lw
+			next(ctx)
+
+			if lw.cut {
+				return
+			}
+			size := int64(len(ctx.RespData))
+			if size <= limit {
+				return
+			}
+			b.report(ctx, Offense{Size: size, Limit: limit})
+			switch {
+			case lw.wroteHeader:
+				ctx.RespData = nil
+			case b.policy == Truncate:
+				ctx.RespData = ctx.RespData[:limit]
+				ctx.Header("Warning", fmt.Sprintf(`199 mist "response truncated from %d to %d bytes"`, size, limit))
+			default:
+				// The problem response itself may exceed small limits.
+				ctx.ResponseWriter = lw.ResponseWriter
+				ctx.RespData = nil
+				_ = ctx.RespondError(errors.New("response size limit exceeded"))
+			}
+		}
+	}
+}
+
+// routeLimit returns the limit of the matched route.
+func (b *MiddlewareBuilder) routeLimit(ctx *mist.Context) int64 {
+	val, ok := ctx.RouteMeta(MetaMaxBytes)
+	if !ok {
+		return b.limit
+	}
+	switch v := val.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	}
+	return b.limit
+}
+
+// report records an offense.
+func (b *MiddlewareBuilder) report(ctx *mist.Context, o Offense) {
+	o.Route, o.Method = ctx.RoutePattern(), ctx.Request.Method
+	if o.Route == "" {
+		o.Route = "unknown"
+	}
+	if b.offenses != nil {
+		b.offenses.WithLabelValues(o.Route, o.Method, b.policy.String()).Inc()
+	}
+	if b.onOffense != nil {
+		b.onOffense(ctx, o)
+	}
+}
+
+// limitWriter is a ResponseWriter cutting the body at a limit.
+type limitWriter struct {
+	http.ResponseWriter
+	limit       int64
+	written     int64
+	wroteHeader bool
+	cut         bool
+	onCut       func()
+}
+
+// WriteHeader records that the header was sent.
+func (w *limitWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes p up to the limit. Bytes beyond the limit are dropped and reported as written,
+// so that the handler completes normally.
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	if w.cut {
+		return len(p), nil
+	}
+	if rest := w.limit - w.written; int64(len(p)) > rest {
+		w.cut = true
+		w.onCut()
+		n, err := w.ResponseWriter.Write(p[:rest])
+		w.written += int64(n)
+		if err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush sends the buffered data to the client, if the underlying writer supports it.
+func (w *limitWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for http.ResponseController.
+func (w *limitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
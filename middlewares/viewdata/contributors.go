@@ -0,0 +1,112 @@
+package viewdata
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/middlewares/csrf"
+	"strings"
+)
+
+// Value sets an entry to a fixed value, e.g. the name of the site.
+func Value(key string, value any) mist.ViewContributor {
+	return func(_ *mist.Context, data mist.ViewData) {
+		data[key] = value
+	}
+}
+
+// Func sets an entry to the value computed by fn for the request.
+func Func(key string, fn func(ctx *mist.Context) any) mist.ViewContributor {
+	return func(ctx *mist.Context, data mist.ViewData) {
+		data[key] = fn(ctx)
+	}
+}
+
+// User sets the entry "User" to the current user returned by fn, when there is one.
+//
+// Parameters:
+//   - fn: The function returning the user of the request, e.g. from the session, and whether
+//     the request has one.
+func User(fn func(ctx *mist.Context) (any, bool)) mist.ViewContributor {
+	return func(ctx *mist.Context, data mist.ViewData) {
+		if user, ok := fn(ctx); ok {
+			data["User"] = user
+		}
+	}
+}
+
+// Flashes sets the entry "Flashes" to the pending flash messages of the client, see
+// Context.Flashes.
+func Flashes() mist.ViewContributor {
+	return func(ctx *mist.Context, data mist.ViewData) {
+		data["Flashes"] = ctx.Flashes()
+	}
+}
+
+// CSRF sets the entries "CSRFToken" and "CSRFFieldName" to the token of the csrf middleware and
+// the name of the form field carrying it, for forms not built with the forms package.
+//
+//	<input type="hidden" name="{{.CSRFFieldName}}" value="{{.CSRFToken}}">
+func CSRF() mist.ViewContributor {
+	return func(ctx *mist.Context, data mist.ViewData) {
+		data["CSRFToken"] = csrf.Token(ctx)
+		data["CSRFFieldName"] = csrf.FieldName(ctx)
+	}
+}
+
+// NavItem is an entry of a navigation menu.
+//
+// Fields:
+//   - Label: The text of the entry.
+//   - Path: The path the entry links to; the entry is active on it and on the paths below it.
+type NavItem struct {
+	Label string
+	Path  string
+}
+
+// NavLink is an entry of a navigation menu for a request.
+//
+// Fields:
+//   - NavItem: The entry.
+//   - Active: Whether the request is for the page of the entry, or a page below it.
+type NavLink struct {
+	NavItem
+	Active bool
+}
+
+// NavState is the navigation state of a request.
+//
+// Fields:
+//   - Path: The path of the request.
+//   - Route: The pattern of the matched route, e.g. "/orders/:id".
+//   - Items: The entries of the menu.
+type NavState struct {
+	Path  string
+	Route string
+	Items []NavLink
+}
+
+// Active reports whether the request is for path, or a path below it, e.g. in templates:
+//
+//	<a href="/orders" {{if .Nav.Active "/orders"}}class="active"{{end}}>Orders</a>
+func (n NavState) Active(path string) bool {
+	return activePath(n.Path, path)
+}
+
+// Nav sets the entry "Nav" to the NavState of the request, with the entries of a menu. Calling
+// it again, e.g. for a group, replaces the menu.
+func Nav(items ...NavItem) mist.ViewContributor {
+	return func(ctx *mist.Context, data mist.ViewData) {
+		state := NavState{Path: ctx.Request.URL.Path, Route: ctx.MatchedRoute, Items: make([]NavLink, len(items))}
+		for i, item := range items {
+			state.Items[i] = NavLink{NavItem: item, Active: activePath(state.Path, item.Path)}
+		}
+		data["Nav"] = state
+	}
+}
+
+// activePath reports whether path is target or below it; "/" matches only itself.
+func activePath(path string, target string) bool {
+	if path == target || target == "/" {
+		return path == target
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(target, "/")+"/")
+}
@@ -0,0 +1,67 @@
+// Package viewdata assembles the data common to the pages of server-rendered applications,
+// such as the current user, the flash messages, the CSRF token and the navigation state shown
+// by a layout, so that handlers render only the data of their page:
+//
+//	server.Use(viewdata.InitMiddlewareBuilder(
+//	    viewdata.User(currentUser),
+//	    viewdata.Flashes(),
+//	    viewdata.CSRF(),
+//	).Build())
+//	admin := server.Group("/admin", viewdata.InitMiddlewareBuilder(
+//	    viewdata.Nav(viewdata.NavItem{Label: "Users", Path: "/admin/users"}),
+//	).Build())
+//
+//	admin.GET("/users", func(ctx *mist.Context) {
+//	    _ = ctx.Render("users.html", map[string]any{"Users": users})
+//	})
+//
+// and the layout:
+//
+//	{{with .User}}<span>{{.Name}}</span>{{end}}
+//	{{range .Flashes}}<div class="flash {{.Level}}">{{.Message}}</div>{{end}}
+//	{{range .Nav.Items}}<a href="{{.Path}}" {{if .Active}}aria-current="page"{{end}}>{{.Label}}</a>{{end}}
+//
+// Contributors run when the page is rendered, in the order of the middleware, then of their
+// registration, so that a group may override the entries of the server.
+package viewdata
+
+import (
+	"github.com/dormoron/mist"
+)
+
+// MiddlewareBuilder builds the middleware registering the contributors of the view data.
+type MiddlewareBuilder struct {
+	contributors []mist.ViewContributor
+}
+
+// InitMiddlewareBuilder creates a builder registering contributors.
+//
+// Parameters:
+//   - contributors: The contributors, e.g. Flashes() or CSRF().
+//
+// Returns:
+//   - *MiddlewareBuilder: The initialized builder.
+func InitMiddlewareBuilder(contributors ...mist.ViewContributor) *MiddlewareBuilder {
+	return &MiddlewareBuilder{contributors: contributors}
+}
+
+// Add registers further contributors.
+func (b *MiddlewareBuilder) Add(contributors ...mist.ViewContributor) *MiddlewareBuilder {
+	b.contributors = append(b.contributors, contributors...)
+	return b
+}
+
+// Build creates the middleware. It only registers the contributors: they run when a handler
+// renders a template or reads Context.ViewData.
+//
+// Returns:
+//   - mist.Middleware: The view data middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	contributors := append([]mist.ViewContributor(nil), b.contributors...)
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			ctx.AddViewContributors(contributors...)
+			next(ctx)
+		}
+	}
+}
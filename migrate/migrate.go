@@ -0,0 +1,245 @@
+// Package migrate runs the schema migrations of an application at startup. A Runner applies
+// the pending migrations of a Migrator, such as a golang-migrate instance, holding a
+// distributed lock so that the instances of a deployment starting together migrate one at a
+// time, and reports its progress to the health checks and to an admin endpoint:
+//
+//	m, err := migrate.New("file://migrations", dsn) // github.com/golang-migrate/migrate/v4
+//	...
+//	runner := mistmigrate.InitRunner(m).
+//	    IgnoreErrors(migrate.ErrNoChange, migrate.ErrNilVersion).
+//	    SetLock(dlock.InitClient(rdb), "migrations", time.Minute)
+//	checker.AddCheck("", runner.Check())
+//	server.GET("/admin/migrations", runner.StatusHandler())
+//	if err := runner.Run(ctx); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Tools without a Go API, such as the Atlas CLI, are adapted with Funcs.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/dlock"
+	"github.com/dormoron/mist/health"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// States of a Runner.
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+// Migrator applies migrations. A golang-migrate *migrate.Migrate is a Migrator.
+type Migrator interface {
+	// Up applies all the pending migrations.
+	Up() error
+	// Version returns the version of the schema and whether a migration failed halfway.
+	Version() (version uint, dirty bool, err error)
+}
+
+// Funcs adapts functions into a Migrator, e.g. running "atlas migrate apply" and parsing
+// "atlas migrate status".
+type Funcs struct {
+	UpFunc      func() error
+	VersionFunc func() (uint, bool, error)
+}
+
+// Up calls UpFunc.
+func (f Funcs) Up() error {
+	return f.UpFunc()
+}
+
+// Version calls VersionFunc, or reports version 0 when it is nil.
+func (f Funcs) Version() (uint, bool, error) {
+	if f.VersionFunc == nil {
+		return 0, false, nil
+	}
+	return f.VersionFunc()
+}
+
+// Status is the progress of a Runner.
+//
+// Fields:
+//   - State: StatePending, StateRunning, StateDone or StateFailed.
+//   - Version: The version of the schema.
+//   - Dirty: Whether a migration failed halfway, leaving the schema to be repaired by hand.
+//   - Error: The error of the run, if it failed.
+//   - StartedAt, FinishedAt: When the run started and ended.
+type Status struct {
+	State      string    `json:"state"`
+	Version    uint      `json:"version"`
+	Dirty      bool      `json:"dirty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Runner runs the migrations of a Migrator once.
+type Runner struct {
+	migrator Migrator
+	locks    *dlock.Client
+	lockKey  string
+	lockTTL  time.Duration
+	ignored  []error
+
+	mutex  sync.RWMutex
+	status Status
+}
+
+// InitRunner creates a Runner without a lock, for applications running a single instance.
+//
+// Parameters:
+//   - migrator: The migrations to apply.
+//
+// Returns:
+//   - *Runner: The initialized runner.
+func InitRunner(migrator Migrator) *Runner {
+	return &Runner{migrator: migrator, status: Status{State: StatePending}}
+}
+
+// SetLock sets the distributed lock held while migrating. Instances starting together wait for
+// the lock in turn; the first applies the migrations and the next ones find none pending.
+//
+// Parameters:
+//   - locks: The lock client.
+//   - key: The name of the lock.
+//   - ttl: The lease of the lock, renewed while the migrations run.
+func (r *Runner) SetLock(locks *dlock.Client, key string, ttl time.Duration) *Runner {
+	r.locks = locks
+	r.lockKey = key
+	r.lockTTL = ttl
+	return r
+}
+
+// IgnoreErrors sets errors of the migrator that do not mean a failure, such as the
+// migrate.ErrNoChange returned by golang-migrate when the schema is up to date and the
+// migrate.ErrNilVersion returned when no migration was ever applied.
+func (r *Runner) IgnoreErrors(errs ...error) *Runner {
+	r.ignored = append(r.ignored, errs...)
+	return r
+}
+
+// Run applies the pending migrations, after acquiring the lock if one is set. It is to be
+// called at startup, before the server is started.
+//
+// Parameters:
+//   - ctx: The context bounding the wait for the lock.
+//
+// Returns:
+//   - error: An error if the lock could not be acquired, the migrations failed, or the schema
+//     is dirty.
+func (r *Runner) Run(ctx context.Context) (err error) {
+	r.update(func(s *Status) {
+		*s = Status{State: StateRunning, StartedAt: time.Now()}
+	})
+	defer func() {
+		r.update(func(s *Status) {
+			s.FinishedAt = time.Now()
+			s.State = StateDone
+			if err != nil {
+				s.State = StateFailed
+				s.Error = err.Error()
+			}
+		})
+	}()
+
+	if r.locks != nil {
+		l, err := r.locks.Lock(ctx, r.lockKey, r.lockTTL)
+		if err != nil {
+			return fmt.Errorf("migrate: acquiring lock %q: %w", r.lockKey, err)
+		}
+		keepCtx, stop := context.WithCancel(ctx)
+		l.KeepAlive(keepCtx, r.lockTTL/3)
+		defer func() {
+			stop()
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			defer cancel()
+			_ = l.Unlock(releaseCtx)
+		}()
+	}
+
+	if err = r.migrator.Up(); err != nil && !r.ignore(err) {
+		r.refreshVersion()
+		return fmt.Errorf("migrate: applying migrations: %w", err)
+	}
+	if err = r.refreshVersion(); err != nil {
+		return fmt.Errorf("migrate: reading schema version: %w", err)
+	}
+	if r.Status().Dirty {
+		return fmt.Errorf("migrate: schema version %d is dirty", r.Status().Version)
+	}
+	return nil
+}
+
+// Status returns the progress of the runner.
+func (r *Runner) Status() Status {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.status
+}
+
+// Check returns a health check failing until the migrations were applied, so that an instance
+// is not ready before its schema is.
+//
+// Returns:
+//   - health.Check: The check, e.g. for checker.AddCheck("", runner.Check()).
+func (r *Runner) Check() health.Check {
+	return func(ctx context.Context) error {
+		status := r.Status()
+		if status.State != StateDone {
+			return fmt.Errorf("migrate: migrations %s", status.State)
+		}
+		return nil
+	}
+}
+
+// StatusHandler returns the handler of an admin endpoint reporting the Status of the runner as
+// JSON, with 200 once the migrations were applied and 503 otherwise.
+func (r *Runner) StatusHandler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		status := r.Status()
+		code := http.StatusOK
+		if status.State != StateDone {
+			code = http.StatusServiceUnavailable
+		}
+		ctx.Header("Cache-Control", "no-store")
+		_ = ctx.RespondWithJSON(code, status)
+	}
+}
+
+// refreshVersion reads the version of the schema into the status.
+func (r *Runner) refreshVersion() error {
+	version, dirty, err := r.migrator.Version()
+	if err != nil && !r.ignore(err) {
+		return err
+	}
+	r.update(func(s *Status) {
+		s.Version, s.Dirty = version, dirty
+	})
+	return nil
+}
+
+// update changes the status.
+func (r *Runner) update(fn func(s *Status)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	fn(&r.status)
+}
+
+// ignore reports whether an error of the migrator is one of the ignored errors.
+func (r *Runner) ignore(err error) bool {
+	for _, target := range r.ignored {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
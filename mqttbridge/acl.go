@@ -0,0 +1,128 @@
+package mqttbridge
+
+import (
+	"github.com/dormoron/mist"
+	"strings"
+)
+
+// Action is what a client asks to do with a topic.
+type Action int
+
+const (
+	// ActionPublish publishes a message to a topic.
+	ActionPublish Action = iota
+	// ActionSubscribe subscribes to a topic filter, which may hold wildcards.
+	ActionSubscribe
+)
+
+// Authorizer decides whether the client of a request may act on a topic, mapping the identity
+// of the HTTP request, e.g. the user of a session or the subject of a token, to MQTT topics.
+type Authorizer func(ctx *mist.Context, action Action, topic string) bool
+
+// Rule grants actions on the topics matched by a filter.
+//
+// Fields:
+//   - Filter: The topic filter, with the MQTT wildcards "+" and "#", where "{id}" stands for
+//     the identity of the client, e.g. "devices/{id}/#".
+//   - Publish: Whether the client may publish to the matched topics.
+//   - Subscribe: Whether the client may subscribe to filters within Filter.
+type Rule struct {
+	Filter    string
+	Publish   bool
+	Subscribe bool
+}
+
+// ACL creates an Authorizer granting the actions of the rules matching a topic. A subscription
+// is granted when a rule covers every topic of its filter: "sensors/+/temp" is granted by
+// "sensors/#", but "sensors/#" is not granted by "sensors/+/temp".
+//
+// Example:
+//
+//	acl := mqttbridge.ACL(func(ctx *mist.Context) (string, bool) {
+//	    user, err := session.Get(ctx)
+//	    ...
+//	    return user.ID, true
+//	},
+//	    mqttbridge.Rule{Filter: "devices/{id}/#", Publish: true, Subscribe: true},
+//	    mqttbridge.Rule{Filter: "broadcast/#", Subscribe: true},
+//	)
+//
+// Parameters:
+//   - identity: Returns the identity of the client, or false for anonymous clients, which
+//     are only granted the rules without "{id}"; nil treats every client as anonymous.
+//   - rules: The rules.
+//
+// Returns:
+//   - Authorizer: The authorizer.
+func ACL(identity func(ctx *mist.Context) (string, bool), rules ...Rule) Authorizer {
+	return func(ctx *mist.Context, action Action, topic string) bool {
+		id, known := "", false
+		resolved := false
+		for _, rule := range rules {
+			if action == ActionPublish && !rule.Publish || action == ActionSubscribe && !rule.Subscribe {
+				continue
+			}
+			filter := rule.Filter
+			if strings.Contains(filter, "{id}") {
+				if !resolved && identity != nil {
+					id, known = identity(ctx)
+					resolved = true
+				}
+				// An identity holding separators or wildcards would widen the rule.
+				if !known || id == "" || strings.ContainsAny(id, "/+#") {
+					continue
+				}
+				filter = strings.ReplaceAll(filter, "{id}", id)
+			}
+			if covers(filter, topic) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// covers reports whether every topic matched by sub is matched by filter; a topic name is a
+// filter matching itself. Wildcards at the first level do not match the topics starting with
+// "$", which are reserved by the brokers.
+func covers(filter string, sub string) bool {
+	if strings.HasPrefix(sub, "$") && strings.IndexAny(filter, "+#") == 0 {
+		return false
+	}
+	fl, sl := strings.Split(filter, "/"), strings.Split(sub, "/")
+	for i, level := range fl {
+		if level == "#" {
+			// "a/#" matches "a" as well.
+			return true
+		}
+		if i == len(sl) {
+			return false
+		}
+		switch {
+		case level == "+":
+			if sl[i] == "#" {
+				return false
+			}
+		case level != sl[i]:
+			return false
+		}
+	}
+	return len(fl) == len(sl)
+}
+
+// validTopic reports whether s is a topic name, or a topic filter when wildcards are allowed.
+func validTopic(s string, wildcards bool) bool {
+	if s == "" || len(s) > 65535 || strings.ContainsRune(s, 0) {
+		return false
+	}
+	levels := strings.Split(s, "/")
+	for i, level := range levels {
+		if !strings.ContainsAny(level, "+#") {
+			continue
+		}
+		if !wildcards || len(level) != 1 || level == "#" && i != len(levels)-1 {
+			return false
+		}
+	}
+	return true
+}
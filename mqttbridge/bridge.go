@@ -0,0 +1,363 @@
+// Package mqttbridge bridges HTTP endpoints to the topics of an MQTT broker, for IoT dashboards
+// built on mist: browsers publish with a POST request and follow topics with server-sent
+// events, without an MQTT connection of their own. Access to the topics is decided from the
+// identity of the HTTP request by an Authorizer, such as an ACL.
+//
+// The bridge uses the MQTT client of the application through the Client interface; an Eclipse
+// Paho client is adapted with
+//
+//	type pahoClient struct{ mqtt.Client } // github.com/eclipse/paho.mqtt.golang
+//
+//	func (c pahoClient) Publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error {
+//	    return c.wait(ctx, c.Client.Publish(topic, qos, retained, payload))
+//	}
+//
+//	func (c pahoClient) Subscribe(ctx context.Context, filter string, qos byte, fn func(string, []byte)) error {
+//	    return c.wait(ctx, c.Client.Subscribe(filter, qos, func(_ mqtt.Client, m mqtt.Message) {
+//	        fn(m.Topic(), m.Payload())
+//	    }))
+//	}
+//
+//	func (c pahoClient) Unsubscribe(ctx context.Context, filter string) error {
+//	    return c.wait(ctx, c.Client.Unsubscribe(filter))
+//	}
+//
+//	func (c pahoClient) wait(ctx context.Context, token mqtt.Token) error {
+//	    select {
+//	    case <-token.Done():
+//	        return token.Error()
+//	    case <-ctx.Done():
+//	        return ctx.Err()
+//	    }
+//	}
+//
+// and the endpoints are registered with
+//
+//	bridge := mqttbridge.InitBridge(pahoClient{client}, acl)
+//	server.POST("/mqtt/publish", bridge.PublishHandler())
+//	server.GET("/mqtt/subscribe", bridge.SubscribeHandler())
+package mqttbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dormoron/mist"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Client is the MQTT client of the application.
+type Client interface {
+	// Publish publishes a message, returning once the broker acknowledged it for QoS 1 and 2.
+	Publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error
+	// Subscribe subscribes to a topic filter, calling handler with the messages received.
+	Subscribe(ctx context.Context, filter string, qos byte, handler func(topic string, payload []byte)) error
+	// Unsubscribe ends the subscription to a topic filter.
+	Unsubscribe(ctx context.Context, filter string) error
+}
+
+// Bridge serves the HTTP endpoints bridged to the broker. The subscriptions of the HTTP
+// clients to the same filter share one subscription of the broker.
+type Bridge struct {
+	client      Client
+	authorize   Authorizer
+	qos         byte
+	allowRetain bool
+	maxPayload  int64
+	maxFilters  int
+	keepAlive   time.Duration
+	buffer      int
+
+	mutex sync.Mutex
+	subs  map[string]*subscription
+}
+
+// subscription is a subscription of the broker shared by HTTP clients.
+type subscription struct {
+	ready       chan struct{}
+	err         error
+	subscribers map[*subscriber]struct{}
+}
+
+// subscriber is an HTTP client following topics.
+type subscriber struct {
+	messages chan message
+	dropped  atomic.Int64
+}
+
+// message is a message received from the broker.
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// InitBridge creates a Bridge publishing and subscribing with QoS 1, accepting payloads up to
+// 64 KiB, not allowing retained messages, and sending a keep-alive comment to the subscribers
+// every 15 seconds.
+//
+// Parameters:
+//   - client: The MQTT client.
+//   - authorize: The authorizer of the topics, e.g. an ACL.
+//
+// Returns:
+//   - *Bridge: The initialized bridge.
+func InitBridge(client Client, authorize Authorizer) *Bridge {
+	return &Bridge{
+		client:     client,
+		authorize:  authorize,
+		qos:        1,
+		maxPayload: 64 << 10,
+		maxFilters: 16,
+		keepAlive:  15 * time.Second,
+		buffer:     64,
+		subs:       make(map[string]*subscription),
+	}
+}
+
+// SetQoS sets the quality of service of the publications and subscriptions, from 0 to 2.
+func (b *Bridge) SetQoS(qos byte) *Bridge {
+	b.qos = min(qos, 2)
+	return b
+}
+
+// SetAllowRetain sets whether clients may publish retained messages, with "?retain=true".
+func (b *Bridge) SetAllowRetain(allow bool) *Bridge {
+	b.allowRetain = allow
+	return b
+}
+
+// SetMaxPayload sets the size limit of the published payloads, in bytes.
+func (b *Bridge) SetMaxPayload(size int64) *Bridge {
+	b.maxPayload = size
+	return b
+}
+
+// SetMaxFilters sets the number of topic filters a subscriber may follow at once.
+func (b *Bridge) SetMaxFilters(n int) *Bridge {
+	b.maxFilters = n
+	return b
+}
+
+// SetKeepAlive sets the interval of the keep-alive comments sent to the subscribers, which
+// keep proxies from closing idle streams.
+func (b *Bridge) SetKeepAlive(interval time.Duration) *Bridge {
+	b.keepAlive = interval
+	return b
+}
+
+// SetBuffer sets the number of messages queued for a subscriber; the messages arriving while
+// the queue of a slow subscriber is full are dropped.
+func (b *Bridge) SetBuffer(size int) *Bridge {
+	b.buffer = max(size, 1)
+	return b
+}
+
+// PublishHandler returns the handler publishing the body of a request to the topic named by its
+// "topic" query parameter, answering 204 No Content once the broker accepted it. The request
+// is rejected with 400 Bad Request for a missing or invalid topic, 403 Forbidden when the
+// authorizer denies it, and 413 Request Entity Too Large for an oversized payload.
+//
+// Returns:
+//   - mist.HandleFunc: The handler.
+func (b *Bridge) PublishHandler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		query := ctx.Request.URL.Query()
+		topic := query.Get("topic")
+		if !validTopic(topic, false) {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: "invalid topic"})
+			return
+		}
+		retain := query.Get("retain") == "true"
+		if retain && !b.allowRetain {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: "retained messages are not allowed"})
+			return
+		}
+		if !b.authorize(ctx, ActionPublish, topic) {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusForbidden, Detail: "publishing to this topic is not allowed"})
+			return
+		}
+		payload, err := io.ReadAll(io.LimitReader(ctx.Request.Body, b.maxPayload+1))
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		if int64(len(payload)) > b.maxPayload {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusRequestEntityTooLarge, Detail: "the payload is too large"})
+			return
+		}
+		if err = b.client.Publish(ctx.Request.Context(), topic, b.qos, retain, payload); err != nil {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadGateway, Detail: "the broker did not accept the message"})
+			return
+		}
+		ctx.RespStatusCode = http.StatusNoContent
+	}
+}
+
+// SubscribeHandler returns the handler streaming the messages of the topic filters named by the
+// "topic" query parameters of a request, e.g. "?topic=sensors/+/temp&topic=alerts/#", as
+// server-sent events until the client disconnects. Each message is an event of type "message"
+// whose data is a JSON object with the fields "topic" and "payload": the payload as is when it
+// is JSON, as a string when it is text, and base64-encoded otherwise, with "encoding" set to
+// "base64". The messages dropped for a slow client are reported by an event of type "dropped"
+// with their count.
+//
+// Returns:
+//   - mist.HandleFunc: The handler.
+func (b *Bridge) SubscribeHandler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		filters := ctx.Request.URL.Query()["topic"]
+		if len(filters) == 0 || len(filters) > b.maxFilters {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest,
+				Detail: fmt.Sprintf("between 1 and %d topics are required", b.maxFilters)})
+			return
+		}
+		for _, filter := range filters {
+			if !validTopic(filter, true) {
+				_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: "invalid topic filter " + strconv.Quote(filter)})
+				return
+			}
+			if !b.authorize(ctx, ActionSubscribe, filter) {
+				_ = ctx.RespondProblem(mist.Problem{Status: http.StatusForbidden,
+					Detail: "subscribing to " + strconv.Quote(filter) + " is not allowed"})
+				return
+			}
+		}
+
+		sub := &subscriber{messages: make(chan message, b.buffer)}
+		var joined []string
+		defer func() {
+			for _, filter := range joined {
+				b.leave(filter, sub)
+			}
+		}()
+		for _, filter := range filters {
+			if err := b.join(ctx.Request.Context(), filter, sub); err != nil {
+				_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadGateway, Detail: "the broker refused the subscription"})
+				return
+			}
+			joined = append(joined, filter)
+		}
+		b.stream(ctx, sub)
+	}
+}
+
+// stream writes the messages of a subscriber as server-sent events.
+func (b *Bridge) stream(ctx *mist.Context, sub *subscriber) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.RespStatusCode = http.StatusOK
+	ctx.Commit()
+	rc := http.NewResponseController(ctx.ResponseWriter)
+	if _, err := io.WriteString(ctx.ResponseWriter, ": connected\n\n"); err != nil || rc.Flush() != nil {
+		return
+	}
+	ticker := time.NewTicker(b.keepAlive)
+	defer ticker.Stop()
+	for {
+		var event []byte
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-ticker.C:
+			event = []byte(": keep-alive\n\n")
+		case msg := <-sub.messages:
+			event = encodeEvent(msg)
+			if dropped := sub.dropped.Swap(0); dropped > 0 {
+				event = append([]byte("event: dropped\ndata: "+strconv.FormatInt(dropped, 10)+"\n\n"), event...)
+			}
+		}
+		if _, err := ctx.ResponseWriter.Write(event); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// encodeEvent encodes a message as a server-sent event.
+func encodeEvent(msg message) []byte {
+	fields := map[string]any{"topic": msg.topic}
+	switch {
+	case json.Valid(msg.payload):
+		fields["payload"] = json.RawMessage(msg.payload)
+	case utf8.Valid(msg.payload):
+		fields["payload"] = string(msg.payload)
+	default:
+		fields["payload"] = base64.StdEncoding.EncodeToString(msg.payload)
+		fields["encoding"] = "base64"
+	}
+	data, _ := json.Marshal(fields)
+	return append(append([]byte("event: message\ndata: "), data...), '\n', '\n')
+}
+
+// join adds a subscriber to the subscription of a filter, subscribing to the broker for the
+// first one.
+func (b *Bridge) join(ctx context.Context, filter string, sub *subscriber) error {
+	b.mutex.Lock()
+	s, ok := b.subs[filter]
+	if ok {
+		s.subscribers[sub] = struct{}{}
+		b.mutex.Unlock()
+		<-s.ready
+		return s.err
+	}
+	s = &subscription{ready: make(chan struct{}), subscribers: map[*subscriber]struct{}{sub: {}}}
+	b.subs[filter] = s
+	b.mutex.Unlock()
+
+	s.err = b.client.Subscribe(ctx, filter, b.qos, func(topic string, payload []byte) {
+		b.deliver(s, message{topic: topic, payload: payload})
+	})
+	if s.err != nil {
+		b.mutex.Lock()
+		if b.subs[filter] == s {
+			delete(b.subs, filter)
+		}
+		b.mutex.Unlock()
+	}
+	close(s.ready)
+	return s.err
+}
+
+// leave removes a subscriber from the subscription of a filter, unsubscribing from the broker
+// after the last one.
+func (b *Bridge) leave(filter string, sub *subscriber) {
+	b.mutex.Lock()
+	s, ok := b.subs[filter]
+	if !ok {
+		b.mutex.Unlock()
+		return
+	}
+	delete(s.subscribers, sub)
+	last := len(s.subscribers) == 0
+	if last {
+		delete(b.subs, filter)
+	}
+	b.mutex.Unlock()
+	if last {
+		_ = b.client.Unsubscribe(context.Background(), filter)
+	}
+}
+
+// deliver queues a message for the subscribers of a subscription, dropping it for those whose
+// queue is full.
+func (b *Bridge) deliver(s *subscription, msg message) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for sub := range s.subscribers {
+		select {
+		case sub.messages <- msg:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
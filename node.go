@@ -138,6 +138,10 @@ type node struct {
 	regChild    *node
 	regExpr     *regexp.Regexp
 	parent      *node
+	meta        map[string]any
+	listeners   []string
+	constraints *Constraints
+	frames      *framePolicy
 }
 
 // childrenOf searches through the current node's children to construct a slice of child nodes that match or relate to the given path segment.
@@ -173,6 +177,11 @@ func (n *node) childrenOf(path string) []*node {
 		res = append(res, n.paramChild)
 	}
 
+	// If the current node has a regular expression child matching the segment, append it too.
+	if n.regChild != nil && n.regChild.regExpr.MatchString(path) {
+		res = append(res, n.regChild)
+	}
+
 	// If a static child exists, append it to the result slice after wildcard and parameterized children.
 	if static != nil {
 		res = append(res, static)
@@ -192,34 +201,25 @@ func (n *node) childrenOf(path string) []*node {
 //
 // Returns:
 //   - *node: A pointer to the child node that matches the path segment. If there is no exact match, it returns
-//     the parameterized or wildcard child node. If no matches are found, it returns nil.
-//   - bool: A boolean value that indicates if the returned node is a parameterized child node. It is true if the
-//     result is from a parameterized path segment, false otherwise.
+//     the regular expression, parameterized or wildcard child node. If no matches are found, it returns nil.
+//   - bool: A boolean value that indicates if the returned node captures the segment as a parameter. It is true if
+//     the result is a parameterized or regular expression child, false otherwise.
 //   - bool: A boolean value which indicates whether a successful match was found. It is true if either an exact match,
 //     parameterized match, or wildcard match is found, false if there is no child node for the path segment.
 func (n *node) childOf(path string) (*node, bool, bool) {
-	// If the current node does not have any children nodes, check for parameterized or wildcard child nodes.
-	if n.children == nil {
-		// If a parameterized child exists, return it along with true for both boolean values, indicating a match and parameterized match.
-		if n.paramChild != nil {
-			return n.paramChild, true, true
+	// An exact match on a static child takes precedence over dynamic children.
+	if n.children != nil {
+		if res, ok := n.children[path]; ok {
+			return res, false, true
 		}
-		// If only a star child exists (wildcard node), return it with false for parameterized match but true to indicate a match was found.
-		return n.starChild, false, n.starChild != nil
 	}
-
-	// Attempt to find an exact match for the path in the children node map.
-	res, ok := n.children[path]
+	// Otherwise try the regular expression, parameterized and wildcard children, in that order.
+	// Both regular expression and parameterized children capture the segment as a parameter.
+	res, ok := n.childOfNonStatic(path)
 	if !ok {
-		// If no exact match is found, check again for parameterized or wildcard children, similar to the logic above.
-		if n.paramChild != nil {
-			return n.paramChild, true, true
-		}
-		return n.starChild, false, n.starChild != nil
+		return nil, false, false
 	}
-
-	// If an exact match is found, return it along with false for both boolean values, indicating an exact match without any parameterization.
-	return res, false, ok
+	return res, res.typ == nodeTypeParam || res.typ == nodeTypeReg, true
 }
 
 // childOfNonStatic attempts to find a non-static (dynamic) child node of the current node (n) that matches the given
@@ -432,7 +432,7 @@ func (n *node) childOrCreateReg(path string, expr string, paramName string) *nod
 	if n.regChild != nil {
 		// A routing definition clash occurs when the existing regChild's regular expression or parameter name
 		// does not match the new requirements. Panic with an error indicating this conflict.
-		if n.regChild.regExpr.String() != expr || n.paramName != paramName {
+		if n.regChild.regExpr.String() != expr || n.regChild.paramName != paramName {
 			panic(errs.ErrRegularClash(n.regChild.path, path))
 		}
 	} else {
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// colors are the colors of the severities, as RGB values.
+var colors = map[string]int{
+	SeverityInfo:     0x439FE0,
+	SeverityWarning:  0xDAA038,
+	SeverityCritical: 0xD00000,
+	SeverityResolved: 0x2EB886,
+}
+
+// SlackChannel posts messages to a Slack channel through an incoming webhook.
+type SlackChannel struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// InitSlackChannel creates a SlackChannel.
+//
+// Parameters:
+//   - webhookURL: The URL of the incoming webhook of the channel.
+//
+// Returns:
+//   - *SlackChannel: The initialized channel.
+func InitSlackChannel(webhookURL string) *SlackChannel {
+	return &SlackChannel{webhookURL: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// SetClient sets the HTTP client posting the messages.
+func (c *SlackChannel) SetClient(client *http.Client) *SlackChannel {
+	c.client = client
+	return c
+}
+
+// Send posts a message as an attachment colored by its severity.
+func (c *SlackChannel) Send(ctx context.Context, msg Message) error {
+	fields := make([]map[string]any, 0, len(msg.Fields))
+	for _, name := range sortedFields(msg) {
+		fields = append(fields, map[string]any{"title": name, "value": msg.Fields[name], "short": true})
+	}
+	body, err := json.Marshal(map[string]any{
+		"text": heading(msg),
+		"attachments": []any{map[string]any{
+			"color":  fmt.Sprintf("#%06X", colors[msg.Severity]),
+			"text":   msg.Text,
+			"fields": fields,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if err = postJSON(ctx, c.client, c.webhookURL, body); err != nil {
+		return fmt.Errorf("notify: posting to Slack: %w", err)
+	}
+	return nil
+}
+
+// DiscordChannel posts messages to a Discord channel through a webhook.
+type DiscordChannel struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// InitDiscordChannel creates a DiscordChannel.
+//
+// Parameters:
+//   - webhookURL: The URL of the webhook of the channel.
+//
+// Returns:
+//   - *DiscordChannel: The initialized channel.
+func InitDiscordChannel(webhookURL string) *DiscordChannel {
+	return &DiscordChannel{webhookURL: webhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// SetClient sets the HTTP client posting the messages.
+func (c *DiscordChannel) SetClient(client *http.Client) *DiscordChannel {
+	c.client = client
+	return c
+}
+
+// Send posts a message as an embed colored by its severity.
+func (c *DiscordChannel) Send(ctx context.Context, msg Message) error {
+	fields := make([]map[string]any, 0, len(msg.Fields))
+	for _, name := range sortedFields(msg) {
+		fields = append(fields, map[string]any{"name": name, "value": msg.Fields[name], "inline": true})
+	}
+	body, err := json.Marshal(map[string]any{
+		"embeds": []any{map[string]any{
+			"title":       heading(msg),
+			"description": msg.Text,
+			"color":       colors[msg.Severity],
+			"fields":      fields,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	if err = postJSON(ctx, c.client, c.webhookURL, body); err != nil {
+		return fmt.Errorf("notify: posting to Discord: %w", err)
+	}
+	return nil
+}
+
+// TelegramChannel sends messages to a Telegram chat through a bot.
+type TelegramChannel struct {
+	endpoint string
+	chatID   string
+	client   *http.Client
+}
+
+// InitTelegramChannel creates a TelegramChannel.
+//
+// Parameters:
+//   - token: The token of the bot.
+//   - chatID: The identifier of the chat, e.g. "-100123456" for a group, or its "@username".
+//
+// Returns:
+//   - *TelegramChannel: The initialized channel.
+func InitTelegramChannel(token string, chatID string) *TelegramChannel {
+	return &TelegramChannel{
+		endpoint: "https://api.telegram.org/bot" + token + "/sendMessage",
+		chatID:   chatID,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetClient sets the HTTP client sending the messages.
+func (c *TelegramChannel) SetClient(client *http.Client) *TelegramChannel {
+	c.client = client
+	return c
+}
+
+// Send sends a message as HTML text.
+func (c *TelegramChannel) Send(ctx context.Context, msg Message) error {
+	var text strings.Builder
+	text.WriteString("<b>" + html.EscapeString(heading(msg)) + "</b>")
+	if msg.Text != "" {
+		text.WriteString("\n" + html.EscapeString(msg.Text))
+	}
+	for _, name := range sortedFields(msg) {
+		text.WriteString("\n<b>" + html.EscapeString(name) + ":</b> " + html.EscapeString(msg.Fields[name]))
+	}
+	body, err := json.Marshal(map[string]any{
+		"chat_id":    c.chatID,
+		"text":       text.String(),
+		"parse_mode": "HTML",
+	})
+	if err != nil {
+		return err
+	}
+	// The error of the client names the URL, which holds the token of the bot.
+	if err = postJSON(ctx, c.client, c.endpoint, body); err != nil {
+		return fmt.Errorf("notify: sending to Telegram: %w", redactToken(err, c.endpoint))
+	}
+	return nil
+}
+
+// redactToken removes the URL holding the token of a bot from an error.
+func redactToken(err error, endpoint string) error {
+	if !strings.Contains(err.Error(), endpoint) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), endpoint, "https://api.telegram.org/bot***/sendMessage"))
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"github.com/dormoron/mist/health"
+	"time"
+)
+
+// WatchHealth runs the checks of the services of a health checker every interval and notifies
+// the changes of their status: SeverityCritical when a service stops serving, SeverityResolved
+// when it recovers. The first run only notifies the services that are not serving. It returns
+// when ctx is done.
+//
+// Parameters:
+//   - ctx: The context ending the watch.
+//   - checker: The health checker.
+//   - interval: The time between two runs of the checks.
+func (n *Notifier) WatchHealth(ctx context.Context, checker *health.Checker, interval time.Duration) {
+	statuses := map[string]health.Status{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, service := range checker.Services() {
+			status := checker.Status(ctx, service)
+			previous, known := statuses[service]
+			statuses[service] = status
+			if ctx.Err() != nil {
+				return
+			}
+			if status == previous || (!known && status == health.StatusServing) {
+				continue
+			}
+			name := service
+			if name == "" {
+				name = "process"
+			}
+			msg := Message{
+				Severity: SeverityCritical,
+				Source:   "health",
+				Title:    name + " is " + status.String(),
+				Fields:   map[string]string{"Service": name, "Status": status.String()},
+				Key:      "health\x00" + service + "\x00" + status.String(),
+			}
+			if known {
+				msg.Fields["Previous"] = previous.String()
+			}
+			if status == health.StatusServing {
+				msg.Severity = SeverityResolved
+			}
+			_ = n.Notify(ctx, msg)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
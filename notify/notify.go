@@ -0,0 +1,214 @@
+// Package notify sends operational events, such as a dependency going down, to the chat
+// channels of the people running an application: Slack, Discord or Telegram. A Notifier
+// fans a message out to its channels and limits how often the same event is sent, so that a
+// flapping dependency does not flood them:
+//
+//	notifier := notify.InitNotifier(
+//	    notify.InitSlackChannel(os.Getenv("SLACK_WEBHOOK_URL")),
+//	    notify.InitTelegramChannel(os.Getenv("TELEGRAM_BOT_TOKEN"), "-100123456"),
+//	)
+//	go notifier.WatchHealth(ctx, checker, 30*time.Second)
+//	...
+//	_ = notifier.Notify(ctx, notify.Message{
+//	    Severity: notify.SeverityWarning,
+//	    Source:   "payments",
+//	    Title:    "Payment provider slow",
+//	    Text:     "p99 latency above 2s for 5 minutes",
+//	})
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severities of messages.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+	SeverityResolved = "resolved"
+)
+
+// Message is an operational event.
+//
+// Fields:
+//   - Severity: The severity of the event, e.g. SeverityCritical; SeverityInfo when empty.
+//   - Source: The component reporting the event, e.g. "health".
+//   - Title: A short summary of the event.
+//   - Text: The details of the event.
+//   - Fields: Additional facts, shown as a table where the channel supports it.
+//   - Key: The identity of the event for rate limiting; Source and Title when empty.
+type Message struct {
+	Severity string
+	Source   string
+	Title    string
+	Text     string
+	Fields   map[string]string
+	Key      string
+}
+
+// Channel delivers messages to a chat service.
+type Channel interface {
+	// Send delivers a message.
+	Send(ctx context.Context, msg Message) error
+}
+
+// Notifier sends messages to channels. It is safe for concurrent use.
+type Notifier struct {
+	channels     []Channel
+	interval     time.Duration
+	maxPerMinute int
+
+	mutex      sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+	window     time.Time
+	sent       int
+}
+
+// InitNotifier creates a Notifier sending the messages of a key at most once a minute, and at
+// most 20 messages a minute overall.
+//
+// Parameters:
+//   - channels: The channels receiving every message.
+//
+// Returns:
+//   - *Notifier: The initialized notifier.
+func InitNotifier(channels ...Channel) *Notifier {
+	return &Notifier{
+		channels:     channels,
+		interval:     time.Minute,
+		maxPerMinute: 20,
+		last:         map[string]time.Time{},
+		suppressed:   map[string]int{},
+	}
+}
+
+// AddChannel adds a channel receiving every message.
+func (n *Notifier) AddChannel(channel Channel) *Notifier {
+	n.channels = append(n.channels, channel)
+	return n
+}
+
+// SetRateLimit sets the shortest time between two messages of the same key, and the largest
+// number of messages sent in a minute; 0 disables a limit. Suppressed messages are counted in
+// the next message of their key.
+func (n *Notifier) SetRateLimit(interval time.Duration, maxPerMinute int) *Notifier {
+	n.interval = interval
+	n.maxPerMinute = maxPerMinute
+	return n
+}
+
+// Notify sends a message to every channel, unless the rate limits suppress it.
+//
+// Parameters:
+//   - ctx: The context of the delivery.
+//   - msg: The message.
+//
+// Returns:
+//   - error: nil when the message was sent or suppressed; the errors of the channels that
+//     failed otherwise.
+func (n *Notifier) Notify(ctx context.Context, msg Message) error {
+	if msg.Severity == "" {
+		msg.Severity = SeverityInfo
+	}
+	if !n.allow(&msg) {
+		return nil
+	}
+	var errs []error
+	for _, channel := range n.channels {
+		if err := channel.Send(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// allow applies the rate limits to a message, adding to it the count of the messages of its
+// key suppressed since the last one sent.
+func (n *Notifier) allow(msg *Message) bool {
+	key := msg.Key
+	if key == "" {
+		key = msg.Source + "\x00" + msg.Title
+	}
+	now := time.Now()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.interval > 0 && now.Sub(n.last[key]) < n.interval {
+		n.suppressed[key]++
+		return false
+	}
+	if now.Sub(n.window) >= time.Minute {
+		n.window, n.sent = now, 0
+	}
+	if n.maxPerMinute > 0 && n.sent >= n.maxPerMinute {
+		n.suppressed[key]++
+		return false
+	}
+	n.sent++
+	n.last[key] = now
+	if count := n.suppressed[key]; count > 0 {
+		delete(n.suppressed, key)
+		fields := make(map[string]string, len(msg.Fields)+1)
+		for name, value := range msg.Fields {
+			fields[name] = value
+		}
+		fields["Suppressed"] = fmt.Sprintf("%d similar messages", count)
+		msg.Fields = fields
+	}
+	return true
+}
+
+// heading returns the title of a message prefixed with its severity and source, for channels
+// without colors.
+func heading(msg Message) string {
+	severity := msg.Severity
+	if severity == "" {
+		severity = SeverityInfo
+	}
+	var b strings.Builder
+	b.WriteString("[" + strings.ToUpper(severity) + "]")
+	if msg.Source != "" {
+		b.WriteString(" " + msg.Source + ":")
+	}
+	b.WriteString(" " + msg.Title)
+	return b.String()
+}
+
+// sortedFields returns the names of the fields of a message, sorted.
+func sortedFields(msg Message) []string {
+	names := make([]string, 0, len(msg.Fields))
+	for name := range msg.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// postJSON sends a JSON body and fails on statuses other than 2xx.
+func postJSON(ctx context.Context, client *http.Client, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package outbox emits domain events reliably from handlers with the transactional outbox
+// pattern. Handlers write their events to an outbox table in the transaction of the request,
+// begun by the db middleware, so that the events are recorded if and only if the changes of the
+// request are committed; a Relay then reads the table in the background and publishes the
+// events to a broker, such as Redis streams, Kafka or NATS, with at-least-once semantics:
+//
+//	box := outbox.InitOutbox(outbox.InitSQLStore(sqlDB, "outbox").SetPlaceholder(outbox.Dollar))
+//	server.Use(db.InitMiddlewareBuilder(db.SQL(sqlDB, nil)).SetMutatingOnly(true).Build())
+//	server.POST("/orders", func(ctx *mist.Context) {
+//	    tx, _ := db.From[*sql.Tx](ctx)
+//	    ... insert the order with tx ...
+//	    event, _ := outbox.JSON("orders.created", order.ID, order)
+//	    if err := box.Emit(ctx, event); err != nil {
+//	        _ = ctx.RespondError(err)
+//	        return
+//	    }
+//	    _ = ctx.RespondWithJSON(http.StatusCreated, order)
+//	})
+//
+//	relay := outbox.InitRelay(box.Store(), outbox.InitRedisStreamPublisher(rdb))
+//	elector.OnElected(func(ctx context.Context) { _ = relay.Run(ctx) })
+//
+// An event may be published more than once, when the relay stops between publishing it and
+// recording it as published; consumers deduplicate events by their ID. Events are published in
+// the order they were stored, and the relay stops at the first failure so that the order
+// holds; run a single relay per outbox, e.g. on the leader elected by dlock.Elector.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/db"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/google/uuid"
+	"time"
+)
+
+// Event is a domain event.
+//
+// Fields:
+//   - ID: The identifier of the event, with which consumers deduplicate it; generated by
+//     Emit when empty.
+//   - Topic: The topic, stream or subject the event is published to, e.g. "orders.created".
+//   - Key: The key of the event, e.g. the ID of the entity it is about, which brokers such as
+//     Kafka partition by; may be empty.
+//   - Payload: The content of the event.
+//   - Headers: Metadata of the event, e.g. "content-type"; may be nil.
+//   - CreatedAt: The time the event was emitted; set by Emit when zero.
+type Event struct {
+	ID        string
+	Topic     string
+	Key       string
+	Payload   []byte
+	Headers   map[string]string
+	CreatedAt time.Time
+}
+
+// JSON creates an event with v serialized to JSON as its payload, and the "content-type"
+// header set to "application/json".
+//
+// Parameters:
+//   - topic: The topic of the event.
+//   - key: The key of the event.
+//   - v: The content of the event.
+//
+// Returns:
+//   - Event: The event.
+//   - error: The error of json.Marshal.
+func JSON(topic string, key string, v any) (Event, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		Topic:   topic,
+		Key:     key,
+		Payload: payload,
+		Headers: map[string]string{"content-type": "application/json"},
+	}, nil
+}
+
+// Store keeps the events of an outbox until they are published.
+type Store interface {
+	// Append stores events in a transaction of the application, so that they are committed
+	// with it. A transaction the store cannot write to is reported with an error wrapping
+	// errors.ErrOutboxNoTransaction.
+	Append(ctx context.Context, tx db.Tx, events []Event) error
+	// Pending returns at most limit events not published yet, oldest first.
+	Pending(ctx context.Context, limit int) ([]Event, error)
+	// MarkPublished records events as published.
+	MarkPublished(ctx context.Context, ids []string) error
+}
+
+// Outbox emits the events of handlers to a Store.
+type Outbox struct {
+	store Store
+}
+
+// InitOutbox creates an Outbox storing the events in store.
+//
+// Parameters:
+//   - store: The store, e.g. InitSQLStore(sqlDB, "outbox").
+//
+// Returns:
+//   - *Outbox: The initialized outbox.
+func InitOutbox(store Store) *Outbox {
+	return &Outbox{store: store}
+}
+
+// Store returns the store of the outbox, for its relay.
+func (o *Outbox) Store() Store {
+	return o.store
+}
+
+// Emit stores events in the transaction of the request, begun by the db middleware. The
+// events are published once the transaction is committed, and dropped with it when it is
+// rolled back.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - events: The events.
+//
+// Returns:
+//   - error: An error wrapping errors.ErrOutboxNoTransaction if the request has no
+//     transaction, or the error of the store.
+func (o *Outbox) Emit(ctx *mist.Context, events ...Event) error {
+	tx, ok := db.Current(ctx)
+	if !ok {
+		return errs.ErrOutboxNoTransaction("the request has no transaction")
+	}
+	return o.EmitTx(ctx.Request.Context(), tx, events...)
+}
+
+// EmitTx stores events in a transaction, for the code running outside of requests, such as
+// background jobs.
+//
+// Parameters:
+//   - ctx: The context of the call.
+//   - tx: The transaction.
+//   - events: The events.
+//
+// Returns:
+//   - error: The error of the store.
+func (o *Outbox) EmitTx(ctx context.Context, tx db.Tx, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now()
+	stamped := make([]Event, len(events))
+	for i, event := range events {
+		if event.ID == "" {
+			event.ID = uuid.NewString()
+		}
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = now
+		}
+		stamped[i] = event
+	}
+	return o.store.Append(ctx, tx, stamped)
+}
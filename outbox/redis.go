@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStreamPublisher is a Publisher appending the events to Redis streams, one per topic,
+// with XADD. The entries carry the fields "id", "key", "payload" and "headers", the latter
+// serialized to JSON.
+type RedisStreamPublisher struct {
+	client redis.Cmdable
+	prefix string
+	maxLen int64
+}
+
+// InitRedisStreamPublisher creates a RedisStreamPublisher appending the events of a topic to
+// the stream named after it, without trimming the streams.
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *RedisStreamPublisher: The initialized publisher.
+func InitRedisStreamPublisher(client redis.Cmdable) *RedisStreamPublisher {
+	return &RedisStreamPublisher{client: client}
+}
+
+// SetPrefix sets the prefix of the names of the streams, e.g. "events:" to append the events of
+// "orders.created" to "events:orders.created".
+func (p *RedisStreamPublisher) SetPrefix(prefix string) *RedisStreamPublisher {
+	p.prefix = prefix
+	return p
+}
+
+// SetMaxLen caps the streams at about maxLen entries, trimming the oldest; 0 keeps them all.
+func (p *RedisStreamPublisher) SetMaxLen(maxLen int64) *RedisStreamPublisher {
+	p.maxLen = maxLen
+	return p
+}
+
+// Publish appends an event to the stream of its topic.
+func (p *RedisStreamPublisher) Publish(ctx context.Context, event Event) error {
+	headers, err := json.Marshal(event.Headers)
+	if err != nil {
+		return err
+	}
+	return p.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: p.prefix + event.Topic,
+		MaxLen: p.maxLen,
+		Approx: p.maxLen > 0,
+		Values: []any{"id", event.ID, "key", event.Key, "payload", event.Payload, "headers", headers},
+	}).Err()
+}
@@ -0,0 +1,185 @@
+package outbox
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Publisher publishes events to a broker.
+type Publisher interface {
+	// Publish publishes an event, returning once the broker acknowledged it.
+	Publish(ctx context.Context, event Event) error
+}
+
+// PublisherFunc adapts a function into a Publisher, e.g. to publish with the Kafka or NATS
+// client of the application:
+//
+//	// github.com/segmentio/kafka-go
+//	outbox.PublisherFunc(func(ctx context.Context, e outbox.Event) error {
+//	    return writer.WriteMessages(ctx, kafka.Message{Topic: e.Topic, Key: []byte(e.Key), Value: e.Payload,
+//	        Headers: []kafka.Header{{Key: "event-id", Value: []byte(e.ID)}}})
+//	})
+//
+//	// github.com/nats-io/nats.go/jetstream, deduplicated by the server with Nats-Msg-Id
+//	outbox.PublisherFunc(func(ctx context.Context, e outbox.Event) error {
+//	    _, err := js.Publish(ctx, e.Topic, e.Payload, jetstream.WithMsgID(e.ID))
+//	    return err
+//	})
+type PublisherFunc func(ctx context.Context, event Event) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Relay publishes the events of a Store, polling it for pending events. Events are published
+// one at a time, in order; an event failing to publish is retried with an exponential backoff,
+// and the events behind it wait for it.
+type Relay struct {
+	store      Store
+	publisher  Publisher
+	batchSize  int
+	interval   time.Duration
+	maxBackoff time.Duration
+	onError    func(event Event, err error)
+
+	published prometheus.Counter
+	failures  prometheus.Counter
+}
+
+// InitRelay creates a Relay polling store every second for batches of 100 events, and backing
+// off up to 1 minute after failures.
+//
+// Parameters:
+//   - store: The store of the outbox.
+//   - publisher: The publisher of the events.
+//
+// Returns:
+//   - *Relay: The initialized relay.
+func InitRelay(store Store, publisher Publisher) *Relay {
+	return &Relay{
+		store:      store,
+		publisher:  publisher,
+		batchSize:  100,
+		interval:   time.Second,
+		maxBackoff: time.Minute,
+	}
+}
+
+// SetBatchSize sets the number of events read from the store at once.
+func (r *Relay) SetBatchSize(size int) *Relay {
+	r.batchSize = size
+	return r
+}
+
+// SetInterval sets the wait between two polls of the store finding no event; it bounds the
+// delay of the publication of an event.
+func (r *Relay) SetInterval(interval time.Duration) *Relay {
+	r.interval = interval
+	return r
+}
+
+// SetMaxBackoff sets the longest wait before retrying after a failure.
+func (r *Relay) SetMaxBackoff(backoff time.Duration) *Relay {
+	r.maxBackoff = backoff
+	return r
+}
+
+// OnError sets a function called with the events failing to publish, and with a zero event
+// when the store fails, e.g. to log them.
+func (r *Relay) OnError(fn func(event Event, err error)) *Relay {
+	r.onError = fn
+	return r
+}
+
+// SetMetrics counts the published events in a Prometheus counter named
+// "<namespace>_<subsystem>_outbox_published_total" and the failures to publish or read them in
+// "<namespace>_<subsystem>_outbox_failures_total", registered with the default registry. It
+// panics if they are already registered.
+func (r *Relay) SetMetrics(namespace string, subsystem string) *Relay {
+	r.published = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "outbox_published_total",
+		Help:      "Events of the outbox published to the broker.",
+	})
+	r.failures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "outbox_failures_total",
+		Help:      "Failures to read the events of the outbox or to publish them.",
+	})
+	prometheus.MustRegister(r.published, r.failures)
+	return r
+}
+
+// Run publishes the events of the store until ctx is done.
+//
+// Returns:
+//   - error: The error of ctx.
+func (r *Relay) Run(ctx context.Context) error {
+	backoff := time.Duration(0)
+	for {
+		n, err := r.Flush(ctx)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			backoff = min(max(2*backoff, r.interval), r.maxBackoff)
+			wait = backoff
+		case n == r.batchSize:
+			// More events are likely pending.
+			backoff = 0
+		default:
+			backoff = 0
+			wait = r.interval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush publishes one batch of pending events, stopping at the first failure.
+//
+// Returns:
+//   - int: The number of events published.
+//   - error: The error of the store or of the publisher.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	events, err := r.store.Pending(ctx, r.batchSize)
+	if err != nil {
+		r.fail(Event{}, err)
+		return 0, err
+	}
+	ids := make([]string, 0, len(events))
+	for _, event := range events {
+		if err = r.publisher.Publish(ctx, event); err != nil {
+			r.fail(event, err)
+			break
+		}
+		ids = append(ids, event.ID)
+	}
+	// Events published but not marked are published again: consumers deduplicate them.
+	if markErr := r.store.MarkPublished(context.WithoutCancel(ctx), ids); markErr != nil {
+		r.fail(Event{}, markErr)
+		return 0, markErr
+	}
+	if r.published != nil {
+		r.published.Add(float64(len(ids)))
+	}
+	return len(ids), err
+}
+
+// fail reports a failure.
+func (r *Relay) fail(event Event, err error) {
+	if r.failures != nil {
+		r.failures.Inc()
+	}
+	if r.onError != nil {
+		r.onError(event, err)
+	}
+}
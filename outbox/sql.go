@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/dormoron/mist/db"
+	"github.com/dormoron/mist/internal/errs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Placeholder returns the bind parameter of the n-th argument of a query, from 1.
+type Placeholder func(n int) string
+
+// Question writes bind parameters as "?", for MySQL and SQLite.
+func Question(int) string {
+	return "?"
+}
+
+// Dollar writes bind parameters as "$1", "$2"..., for PostgreSQL.
+func Dollar(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLStore is a Store keeping the events in a table of a database/sql database, written in
+// the *sql.Tx of the db middleware. The table is created by the migrations of the application,
+// e.g. on PostgreSQL:
+//
+//	CREATE TABLE outbox (
+//	    seq          BIGSERIAL PRIMARY KEY, -- BIGINT AUTO_INCREMENT on MySQL
+//	    id           VARCHAR(64) NOT NULL UNIQUE,
+//	    topic        VARCHAR(255) NOT NULL,
+//	    event_key    VARCHAR(255) NOT NULL,
+//	    payload      BYTEA NOT NULL,        -- BLOB on MySQL
+//	    headers      TEXT NOT NULL,
+//	    created_at   TIMESTAMP NOT NULL,
+//	    published_at TIMESTAMP NULL
+//	);
+//	CREATE INDEX outbox_pending ON outbox (seq) WHERE published_at IS NULL;
+//
+// Published events are kept until they are deleted with Purge.
+type SQLStore struct {
+	database    *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+// InitSQLStore creates an SQLStore on a table of database, with "?" bind parameters.
+//
+// Parameters:
+//   - database: The database, the one of the transactions of the requests.
+//   - table: The name of the table.
+//
+// Returns:
+//   - *SQLStore: The initialized store.
+func InitSQLStore(database *sql.DB, table string) *SQLStore {
+	return &SQLStore{database: database, table: table, placeholder: Question}
+}
+
+// SetPlaceholder sets how the bind parameters of the queries are written, e.g. Dollar for
+// PostgreSQL.
+func (s *SQLStore) SetPlaceholder(placeholder Placeholder) *SQLStore {
+	s.placeholder = placeholder
+	return s
+}
+
+// Append inserts events with the *sql.Tx of tx.
+func (s *SQLStore) Append(ctx context.Context, tx db.Tx, events []Event) error {
+	sqlTx, ok := unwrapSQLTx(tx)
+	if !ok {
+		return errs.ErrOutboxNoTransaction("the transaction is not a *sql.Tx")
+	}
+	query := "INSERT INTO " + s.table + " (id, topic, event_key, payload, headers, created_at) VALUES (" +
+		s.params(1, 6) + ")"
+	stmt, err := sqlTx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, event := range events {
+		headers, err := json.Marshal(event.Headers)
+		if err != nil {
+			return err
+		}
+		payload := event.Payload
+		if payload == nil {
+			payload = []byte{}
+		}
+		_, err = stmt.ExecContext(ctx, event.ID, event.Topic, event.Key, payload, string(headers), event.CreatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending returns the events not published yet, in the order they were inserted.
+func (s *SQLStore) Pending(ctx context.Context, limit int) ([]Event, error) {
+	rows, err := s.database.QueryContext(ctx, "SELECT id, topic, event_key, payload, headers, created_at FROM "+
+		s.table+" WHERE published_at IS NULL ORDER BY seq LIMIT "+strconv.Itoa(limit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var headers string
+		if err = rows.Scan(&event.ID, &event.Topic, &event.Key, &event.Payload, &headers, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(headers), &event.Headers); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkPublished sets the publication time of events.
+func (s *SQLStore) MarkPublished(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(ids)+1)
+	args = append(args, time.Now().UTC())
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	_, err := s.database.ExecContext(ctx, "UPDATE "+s.table+" SET published_at = "+s.placeholder(1)+
+		" WHERE id IN ("+s.params(2, len(ids))+")", args...)
+	return err
+}
+
+// Purge deletes the events published for longer than olderThan.
+//
+// Parameters:
+//   - ctx: The context of the call.
+//   - olderThan: The age of the publications to delete, e.g. 7 days.
+//
+// Returns:
+//   - int64: The number of events deleted.
+//   - error: The error of the database.
+func (s *SQLStore) Purge(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := s.database.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE published_at IS NOT NULL AND published_at < "+
+		s.placeholder(1), time.Now().Add(-olderThan).UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// params returns the count bind parameters starting at the first, separated by commas.
+func (s *SQLStore) params(first int, count int) string {
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(s.placeholder(first + i))
+	}
+	return sb.String()
+}
+
+// unwrapSQLTx returns the *sql.Tx of a transaction of the db middleware.
+func unwrapSQLTx(tx db.Tx) (*sql.Tx, bool) {
+	if u, ok := tx.(interface{ Unwrap() any }); ok {
+		sqlTx, ok := u.Unwrap().(*sql.Tx)
+		return sqlTx, ok
+	}
+	return nil, false
+}
@@ -0,0 +1,210 @@
+package mist
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/dormoron/mist/errcode"
+	misterrors "github.com/dormoron/mist/errors"
+	"github.com/dormoron/mist/i18n"
+	"github.com/dormoron/mist/validation"
+	"net/http"
+)
+
+// problemContentType is the media type of RFC 7807 problem details documents.
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document extended with the stable error code from
+// the errcode catalog and, for validation failures, the list of offending fields.
+//
+// Fields:
+//   - Type: A URI reference identifying the problem type; "about:blank" when omitted.
+//   - Title: A short, human-readable summary of the problem type.
+//   - Status: The HTTP status code of the response.
+//   - Detail: A human-readable explanation specific to this occurrence.
+//   - Instance: A URI reference identifying this occurrence, usually the request path.
+//   - Code: The machine-readable errcode catalog code.
+//   - Errors: Per-field errors for validation problems.
+type Problem struct {
+	Type     string         `json:"type,omitempty"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code,omitempty"`
+	Errors   []ProblemError `json:"errors,omitempty"`
+}
+
+// ProblemError describes a single field-level error inside a Problem.
+type ProblemError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ServerWithErrorCatalog is a configuration function that returns an HTTPServerOption.
+// It sets the error catalog used to resolve the status and localized message of error codes
+// emitted through RespondError and BindAndValidate. Servers without a catalog use
+// errcode.DefaultCatalog().
+//
+// Parameters:
+//   - catalog: The catalog of error codes, typically created with errcode.InitCatalog and
+//     configured with an i18n bundle as its translator.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified catalog.
+func ServerWithErrorCatalog(catalog *errcode.Catalog) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.catalog = catalog
+	}
+}
+
+// ErrorCatalog returns the error catalog of the server that is handling the request.
+func (c *Context) ErrorCatalog() *errcode.Catalog {
+	if c.catalog == nil {
+		return errcode.DefaultCatalog()
+	}
+	return c.catalog
+}
+
+// Locale negotiates the locale of the response from the Accept-Language request header
+// against the locales the error catalog can translate to. When nothing matches, an empty
+// string is returned and messages use the catalog's default locale.
+func (c *Context) Locale() string {
+	supported := c.ErrorCatalog().Locales()
+	if len(supported) == 0 {
+		return ""
+	}
+	return i18n.Match(c.Request.Header.Get("Accept-Language"), supported...)
+}
+
+// RespondProblem sends an RFC 7807 problem details response. Missing Status defaults to
+// 500, a missing Title defaults to the standard status text and a missing Instance defaults
+// to the request path.
+//
+// Parameters:
+//   - p: The problem to send.
+//
+// Returns:
+//   - error: An error if the problem cannot be serialized.
+func (c *Context) RespondProblem(p Problem) error {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" && c.Request != nil && c.Request.URL != nil {
+		p.Instance = c.Request.URL.Path
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	c.Header("Content-Type", problemContentType)
+	c.RespStatusCode = p.Status
+	c.RespData = data
+	return nil
+}
+
+// RespondError converts err into a problem details response using the error catalog, so that
+// every failure path emits the same machine-readable codes and localized messages:
+//   - validation.Errors produce a 422 response with code "validation.failed" and one entry per
+//     offending field, each carrying its own rule code.
+//   - *errcode.Error produces the status and message registered for its code.
+//   - Errors wrapping a sentinel registered with the errors package, such as ErrJobNotFound,
+//     produce the status and user-safe message of its mapping.
+//   - Any other error produces a 500 response with code "internal"; its text is not exposed.
+//
+// The error is kept for the middleware reporting failures, see RespondedError.
+//
+// Parameters:
+//   - err: The error to report.
+//
+// Returns:
+//   - error: An error if the problem cannot be serialized.
+func (c *Context) RespondError(err error) error {
+	c.respondedErr = err
+	return c.RespondProblem(c.problemFor(err))
+}
+
+// problemFor converts err into the problem RespondError sends.
+func (c *Context) problemFor(err error) Problem {
+	catalog := c.ErrorCatalog()
+	locale := c.Locale()
+
+	var verrs validation.Errors
+	if errors.As(err, &verrs) {
+		p := Problem{
+			Status: catalog.Status(errcode.CodeValidation),
+			Code:   errcode.CodeValidation,
+			Detail: catalog.Message(locale, errcode.CodeValidation, nil),
+			Errors: make([]ProblemError, 0, len(verrs)),
+		}
+		for _, fe := range verrs {
+			p.Errors = append(p.Errors, ProblemError{
+				Field:   fe.Field,
+				Code:    fe.Code,
+				Message: catalog.Message(locale, fe.Code, fe.Params()),
+			})
+		}
+		return p
+	}
+
+	code := errcode.CodeOf(err)
+	var params map[string]any
+	var coded *errcode.Error
+	if errors.As(err, &coded) {
+		params = coded.Params
+	}
+	if code == "" {
+		if m, ok := misterrors.Lookup(err); ok {
+			return Problem{Status: m.Status, Detail: m.Message}
+		}
+		code = errcode.CodeInternal
+	}
+	return Problem{
+		Status: catalog.Status(code),
+		Code:   code,
+		Detail: catalog.Message(locale, code, params),
+	}
+}
+
+// RespondedError returns the error last passed to RespondError, nil if there is none. It lets
+// middleware, such as the error reporters of the errreport package, see why a request failed
+// while the client only gets the problem response.
+//
+// Returns:
+//   - error: The error of the response.
+func (c *Context) RespondedError() error {
+	return c.respondedErr
+}
+
+// BindAndValidate decodes the request body into val with Bind, so with the parser registered
+// for its Content-Type (JSON when none is sent), and validates the result against its
+// `validate` struct tags. Failures are reported with catalog codes so they can be passed
+// straight to RespondError:
+//   - an unsupported media type yields an *errcode.Error with code
+//     "request.unsupported_media_type",
+//   - a missing body yields an *errcode.Error with code "request.empty_body",
+//   - a malformed body yields an *errcode.Error with code "request.malformed_body",
+//   - rule violations yield validation.Errors.
+//
+// Example:
+//
+//	var input CreateUser
+//	if err := c.BindAndValidate(&input); err != nil {
+//	    _ = c.RespondError(err)
+//	    return
+//	}
+//
+// Parameters:
+//   - val: A non-nil pointer to the value to populate.
+//
+// Returns:
+//   - error: nil on success, otherwise a coded error as described above.
+func (c *Context) BindAndValidate(val any) error {
+	if err := c.Bind(val); err != nil {
+		return err
+	}
+	return validation.Validate(val)
+}
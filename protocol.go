@@ -0,0 +1,113 @@
+package mist
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+// ProtocolConfig tunes the connections of the listeners: how long clients may take to send
+// requests and read responses, how long idle keep-alive connections are kept and how large
+// request headers may be. Zero fields take the production defaults below; negative durations
+// remove the limit.
+//
+// Fields:
+//   - ReadHeaderTimeout: The time allowed to read the headers of a request, which stops clients
+//     trickling headers to hold connections open. Defaults to 10 seconds.
+//   - ReadTimeout: The time allowed to read a whole request, body included. No limit by
+//     default, so that slow uploads are bounded by the handler instead.
+//   - WriteTimeout: The time allowed to write a response, from the end of the reading of the
+//     headers. No limit by default, as streams and long polls stay open for long.
+//   - IdleTimeout: The time a keep-alive connection is kept waiting for the next request.
+//     Defaults to 2 minutes.
+//   - MaxHeaderBytes: The largest size of the request line and headers, in bytes. Defaults to
+//     1 MiB.
+//   - DisableKeepAlives: Closes the connections after every response.
+//   - ConfigureTLS: Called with the name and a copy of the TLS configuration of every TLS
+//     listener before it is served, e.g. to restrict cipher suites or to set
+//     GetConfigForClient. TLS 1.2 is required unless MinVersion is set.
+type ProtocolConfig struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	DisableKeepAlives bool
+	ConfigureTLS      func(listener string, cfg *tls.Config)
+}
+
+// ServerWithProtocol is a configuration function that returns an HTTPServerOption.
+// It sets the protocol configuration of every listener, see ProtocolConfig. Listeners
+// override it with ListenerProtocol.
+//
+// Example:
+//
+//	server := mist.InitHTTPServer(mist.ServerWithProtocol(mist.ProtocolConfig{
+//	    ReadTimeout: 30 * time.Second,
+//	    IdleTimeout: time.Minute,
+//	}))
+//
+// Parameters:
+//   - cfg: The protocol configuration.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified configuration.
+func ServerWithProtocol(cfg ProtocolConfig) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.protocol = cfg
+	}
+}
+
+// ListenerProtocol sets the protocol configuration of the listener, replacing the one set with
+// ServerWithProtocol, e.g. to allow slower clients on an internal port.
+func ListenerProtocol(cfg ProtocolConfig) ListenerOption {
+	return func(l *listener) {
+		l.protocol = &cfg
+	}
+}
+
+// newHTTPServer returns the net/http server of a listener, configured by the protocol
+// configuration of the listener or of the server.
+func (s *HTTPServer) newHTTPServer(l *listener) *http.Server {
+	cfg := s.protocol
+	if l.protocol != nil {
+		cfg = *l.protocol
+	}
+	srv := &http.Server{
+		Handler:           l.handler(s),
+		ReadHeaderTimeout: protocolTimeout(cfg.ReadHeaderTimeout, 10*time.Second),
+		ReadTimeout:       protocolTimeout(cfg.ReadTimeout, 0),
+		WriteTimeout:      protocolTimeout(cfg.WriteTimeout, 0),
+		IdleTimeout:       protocolTimeout(cfg.IdleTimeout, 2*time.Minute),
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	if srv.MaxHeaderBytes <= 0 {
+		srv.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+	if cfg.DisableKeepAlives {
+		srv.SetKeepAlivesEnabled(false)
+	}
+	if l.tls != nil {
+		srv.TLSConfig = l.tls.Clone()
+		if srv.TLSConfig.MinVersion == 0 {
+			srv.TLSConfig.MinVersion = tls.VersionTLS12
+		}
+		if cfg.ConfigureTLS != nil {
+			cfg.ConfigureTLS(l.name, srv.TLSConfig)
+		}
+	}
+	return srv
+}
+
+// protocolTimeout resolves a timeout of a ProtocolConfig: zero takes the default and negative
+// values mean no limit.
+func protocolTimeout(d time.Duration, def time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d == 0:
+		return def
+	default:
+		return d
+	}
+}
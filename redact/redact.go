@@ -0,0 +1,236 @@
+// Package redact masks secrets and personal data before requests are written to logs. A
+// Redactor lists the header names, JSON fields and query parameters to mask; the logging
+// middleware use the process-wide Default unless given their own, so that the list is kept in
+// one place:
+//
+//	redact.Default().
+//	    AddHeaders("X-Api-Key").
+//	    AddFields("card.number", "ssn").
+//	    AddQueryParams("signature")
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Mask is the value substituted for redacted values.
+const Mask = "[REDACTED]"
+
+// Redactor masks sensitive values. It is safe for concurrent use, including while it is being
+// configured.
+type Redactor struct {
+	mutex   sync.RWMutex
+	headers map[string]struct{}
+	names   map[string]struct{}
+	paths   map[string]struct{}
+	params  map[string]struct{}
+}
+
+// defaultRedactor is the Redactor returned by Default.
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	defaultRedactor.Store(InitRedactor())
+}
+
+// Default returns the process-wide Redactor used by the logging middleware of mist that are
+// not given one.
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// SetDefault replaces the process-wide Redactor.
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// InitRedactor creates a Redactor masking, by default:
+//   - the Authorization, Proxy-Authorization, Cookie, Set-Cookie and X-Api-Key headers,
+//   - the password, passwd, secret, token, access_token, refresh_token, client_secret and
+//     api_key JSON fields, at any depth,
+//   - the same names as query parameters.
+//
+// Returns:
+//   - *Redactor: The initialized redactor.
+func InitRedactor() *Redactor {
+	r := &Redactor{
+		headers: map[string]struct{}{},
+		names:   map[string]struct{}{},
+		paths:   map[string]struct{}{},
+		params:  map[string]struct{}{},
+	}
+	secrets := []string{"password", "passwd", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key"}
+	r.AddHeaders("Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key")
+	r.AddFields(secrets...)
+	r.AddQueryParams(secrets...)
+	return r
+}
+
+// AddHeaders adds header names to mask, compared case-insensitively.
+func (r *Redactor) AddHeaders(names ...string) *Redactor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, name := range names {
+		r.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+	return r
+}
+
+// AddFields adds JSON fields to mask. A plain name, such as "password", masks the fields of
+// that name at any depth; a dotted path, such as "card.number", masks the field at that path
+// from the root, looking through arrays. Names are compared case-insensitively.
+func (r *Redactor) AddFields(fields ...string) *Redactor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, field := range fields {
+		field = strings.ToLower(field)
+		if strings.Contains(field, ".") {
+			r.paths[field] = struct{}{}
+		} else {
+			r.names[field] = struct{}{}
+		}
+	}
+	return r
+}
+
+// AddQueryParams adds query parameters to mask, compared case-insensitively.
+func (r *Redactor) AddQueryParams(names ...string) *Redactor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, name := range names {
+		r.params[strings.ToLower(name)] = struct{}{}
+	}
+	return r
+}
+
+// Header returns a copy of h with the values of the sensitive headers masked.
+func (r *Redactor) Header(h http.Header) http.Header {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	masked := make(http.Header, len(h))
+	for name, values := range h {
+		if _, ok := r.headers[http.CanonicalHeaderKey(name)]; ok {
+			masked[name] = []string{Mask}
+			continue
+		}
+		masked[name] = append([]string(nil), values...)
+	}
+	return masked
+}
+
+// Query returns a raw query string with the values of the sensitive parameters masked. The
+// order of the parameters is kept; a query that cannot be parsed is masked entirely.
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			return Mask
+		}
+		if _, ok := r.params[strings.ToLower(name)]; ok {
+			pairs[i] = key + "=" + url.QueryEscape(Mask)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// JSON returns a copy of a JSON document with the sensitive fields masked. Streams of several
+// JSON values, e.g. newline-delimited JSON, have every value masked and are returned one value
+// per line. Documents that are not valid JSON are returned unchanged, since there is no field to
+// find in them; callers logging arbitrary bodies should only log JSON ones. A stream whose first
+// values are valid JSON but not the rest is masked entirely.
+func (r *Redactor) JSON(body []byte) []byte {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var docs []any
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if err == io.EOF && len(docs) > 0 {
+			break
+		}
+		if err != nil {
+			if len(docs) > 0 {
+				return []byte(Mask)
+			}
+			return body
+		}
+		docs = append(docs, doc)
+	}
+	changed := false
+	r.mutex.RLock()
+	for _, doc := range docs {
+		if r.redactValue(doc, "") {
+			changed = true
+		}
+	}
+	r.mutex.RUnlock()
+	if !changed {
+		return body
+	}
+	var masked bytes.Buffer
+	for i, doc := range docs {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return []byte(Mask)
+		}
+		if i > 0 {
+			masked.WriteByte('\n')
+		}
+		masked.Write(data)
+	}
+	return masked.Bytes()
+}
+
+// redactValue masks the sensitive fields of a decoded JSON value in place and reports whether
+// it changed anything.
+func (r *Redactor) redactValue(v any, path string) bool {
+	changed := false
+	switch val := v.(type) {
+	case map[string]any:
+		for key, child := range val {
+			name := strings.ToLower(key)
+			childPath := name
+			if path != "" {
+				childPath = path + "." + name
+			}
+			if r.sensitive(name, childPath) {
+				val[key] = Mask
+				changed = true
+				continue
+			}
+			if r.redactValue(child, childPath) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, child := range val {
+			if r.redactValue(child, path) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// sensitive reports whether a JSON field is to be masked.
+func (r *Redactor) sensitive(name string, path string) bool {
+	if _, ok := r.names[name]; ok {
+		return true
+	}
+	_, ok := r.paths[path]
+	return ok
+}
@@ -0,0 +1,110 @@
+package rollout
+
+import (
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Registry holds the rollouts adjustable through the admin API.
+type Registry struct {
+	mutex    sync.RWMutex
+	rollouts map[string]*Rollout
+}
+
+// InitRegistry creates a Registry holding the given rollouts.
+func InitRegistry(rollouts ...*Rollout) *Registry {
+	reg := &Registry{rollouts: make(map[string]*Rollout, len(rollouts))}
+	for _, r := range rollouts {
+		reg.Register(r)
+	}
+	return reg
+}
+
+// Register adds a rollout, replacing any rollout with the same name.
+func (reg *Registry) Register(r *Rollout) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	reg.rollouts[r.name] = r
+}
+
+// Get returns the named rollout and whether it exists.
+func (reg *Registry) Get(name string) (*Rollout, bool) {
+	reg.mutex.RLock()
+	defer reg.mutex.RUnlock()
+	r, ok := reg.rollouts[name]
+	return r, ok
+}
+
+// State is the representation of a rollout in the admin API.
+//
+// Fields:
+//   - Name: The name of the rollout.
+//   - Weight: The percentage of the traffic served by green.
+type State struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// RegisterAdmin registers the admin API of the registry under prefix, so that rollouts can be
+// inspected and adjusted at runtime without a redeploy:
+//
+//	GET   {prefix}/rollouts         lists every rollout
+//	GET   {prefix}/rollouts/:name   returns a rollout
+//	PATCH {prefix}/rollouts/:name   sets the weight with a {"weight": 0-100} body
+//
+// The API must not be exposed publicly; pass authentication and authorization middleware in ms.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the admin API, e.g. "/admin".
+//   - ms: Middleware applied to every admin route.
+func (reg *Registry) RegisterAdmin(server *mist.HTTPServer, prefix string, ms ...mist.Middleware) {
+	g := server.Group(prefix, ms...)
+	g.GET("/rollouts", reg.listHandler)
+	g.GET("/rollouts/:name", reg.getHandler)
+	g.PATCH("/rollouts/:name", reg.patchHandler)
+}
+
+// listHandler responds with every rollout, sorted by name.
+func (reg *Registry) listHandler(ctx *mist.Context) {
+	reg.mutex.RLock()
+	states := make([]State, 0, len(reg.rollouts))
+	for _, r := range reg.rollouts {
+		states = append(states, State{Name: r.name, Weight: r.Weight()})
+	}
+	reg.mutex.RUnlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	_ = ctx.RespondWithJSON(http.StatusOK, states)
+}
+
+// getHandler responds with a single rollout.
+func (reg *Registry) getHandler(ctx *mist.Context) {
+	r, ok := reg.Get(ctx.PathValue("name").StringOrDefault(""))
+	if !ok {
+		ctx.RespStatusCode = http.StatusNotFound
+		return
+	}
+	_ = ctx.RespondWithJSON(http.StatusOK, State{Name: r.name, Weight: r.Weight()})
+}
+
+// patchHandler sets the weight of a rollout.
+func (reg *Registry) patchHandler(ctx *mist.Context) {
+	var body struct {
+		Weight *int `json:"weight"`
+	}
+	if err := json.NewDecoder(ctx.Request.Body).Decode(&body); err != nil ||
+		body.Weight == nil || *body.Weight < 0 || *body.Weight > 100 {
+		ctx.RespStatusCode = http.StatusBadRequest
+		return
+	}
+	r, ok := reg.Get(ctx.PathValue("name").StringOrDefault(""))
+	if !ok {
+		ctx.RespStatusCode = http.StatusNotFound
+		return
+	}
+	r.SetWeight(*body.Weight)
+	_ = ctx.RespondWithJSON(http.StatusOK, State{Name: r.name, Weight: r.Weight()})
+}
@@ -0,0 +1,163 @@
+// Package rollout switches a route between two implementations, blue (the current one) and
+// green (the new one), sending a weighted share of the traffic to green. Clients are assigned
+// sticky buckets, so that a client keeps hitting the same implementation, and raising the
+// weight only moves clients from blue to green. The weight can be adjusted at runtime through
+// the admin API, for gradual rollouts inside one process.
+//
+//	orders := rollout.InitRollout("orders", listOrdersV1, listOrdersV2).SetWeight(5)
+//	server.GET("/orders", orders.Handler())
+//
+//	registry := rollout.InitRegistry(orders)
+//	registry.RegisterAdmin(server, "/admin", adminAuth)
+package rollout
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"github.com/dormoron/mist"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Blue names the current implementation.
+	Blue = "blue"
+	// Green names the new implementation.
+	Green = "green"
+)
+
+// ctxKey is the key under which the color serving a request is stored.
+const ctxKey = "_rollout"
+
+// Rollout splits the traffic of a route between a blue and a green handler.
+//
+// Fields:
+//   - name: The unique name of the rollout.
+//   - blue: The handler of the current implementation.
+//   - green: The handler of the new implementation.
+//   - weight: The percentage of buckets served by green.
+//   - header: The request header carrying the bucketing key, if any.
+//   - cookieName: The name of the cookie holding the bucket of a client.
+//   - maxAge: The lifetime of the bucket cookie.
+type Rollout struct {
+	name       string
+	blue       mist.HandleFunc
+	green      mist.HandleFunc
+	weight     atomic.Int32
+	header     string
+	cookieName string
+	maxAge     time.Duration
+}
+
+// InitRollout creates a Rollout sending all the traffic to blue. Clients keep their bucket in
+// the "mist_rollout_{name}" cookie for 30 days.
+//
+// Parameters:
+//   - name: The unique name of the rollout, used in the cookie name and the admin API.
+//   - blue: The handler of the current implementation.
+//   - green: The handler of the new implementation.
+//
+// Returns:
+//   - *Rollout: The initialized rollout.
+func InitRollout(name string, blue, green mist.HandleFunc) *Rollout {
+	return &Rollout{
+		name:       name,
+		blue:       blue,
+		green:      green,
+		cookieName: "mist_rollout_" + name,
+		maxAge:     30 * 24 * time.Hour,
+	}
+}
+
+// Name returns the name of the rollout.
+func (r *Rollout) Name() string {
+	return r.name
+}
+
+// Weight returns the percentage of the traffic served by green.
+func (r *Rollout) Weight() int {
+	return int(r.weight.Load())
+}
+
+// SetWeight sets the percentage of the traffic served by green, clamped to [0, 100]. It is
+// safe to call while requests are served.
+func (r *Rollout) SetWeight(weight int) *Rollout {
+	r.weight.Store(int32(min(max(weight, 0), 100)))
+	return r
+}
+
+// SetHeader buckets the requests carrying the named header, e.g. a user ID set by a gateway,
+// by the value of the header instead of a cookie, so that a user is served by the same
+// implementation on every device.
+func (r *Rollout) SetHeader(name string) *Rollout {
+	r.header = name
+	return r
+}
+
+// SetCookie sets the name and lifetime of the bucket cookie.
+func (r *Rollout) SetCookie(name string, maxAge time.Duration) *Rollout {
+	r.cookieName = name
+	r.maxAge = maxAge
+	return r
+}
+
+// Handler returns the handler serving the route: it places the request in a bucket from 0 to
+// 99 and calls green when the bucket is below the weight, blue otherwise. The bucket comes from
+// the hash of the configured header when the request carries it, and from the bucket cookie
+// otherwise, which is assigned at random on the first request.
+func (r *Rollout) Handler() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		color := Blue
+		if r.bucket(ctx) < r.Weight() {
+			color = Green
+		}
+		ctx.Set(ctxKey, color)
+		if color == Green {
+			r.green(ctx)
+			return
+		}
+		r.blue(ctx)
+	}
+}
+
+// bucket returns the bucket of the request, assigning a cookie when needed.
+func (r *Rollout) bucket(ctx *mist.Context) int {
+	if r.header != "" {
+		if key := ctx.Request.Header.Get(r.header); key != "" {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(r.name + ":" + key))
+			return int(h.Sum32() % 100)
+		}
+	}
+	if ck, err := ctx.Request.Cookie(r.cookieName); err == nil {
+		if b, err := strconv.Atoi(ck.Value); err == nil && b >= 0 && b < 100 {
+			return b
+		}
+	}
+	var buf [4]byte
+	_, _ = rand.Read(buf[:])
+	b := int(binary.BigEndian.Uint32(buf[:]) % 100)
+	ctx.SetCookie(&http.Cookie{
+		Name:     r.cookieName,
+		Value:    strconv.Itoa(b),
+		Path:     "/",
+		MaxAge:   int(r.maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return b
+}
+
+// ColorOf returns the implementation, Blue or Green, serving the request, or an empty string
+// outside of a rollout handler. Middleware can use it to label logs and metrics.
+func ColorOf(ctx *mist.Context) string {
+	val, ok := ctx.Get(ctxKey)
+	if !ok {
+		return ""
+	}
+	color, _ := val.(string)
+	return color
+}
@@ -0,0 +1,58 @@
+package routecheck
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/dormoron/mist"
+	"io"
+	"os"
+)
+
+// Report writes findings to w as JSON (an array of findings) or as text (one line per
+// finding).
+func Report(w io.Writer, findings []Finding, format string) error {
+	if format == "json" {
+		if findings == nil {
+			findings = []Finding{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(findings)
+	}
+	for _, f := range findings {
+		if _, err := fmt.Fprintln(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Main runs the checks against the server built by constructor, reports the findings on
+// standard output and returns the exit code of the check: 1 when a finding reaches the
+// -fail-on severity, 0 otherwise. It is the entry point of the programs generated by mistcheck.
+//
+// Flags:
+//
+//	-format text|json     the output format (default text)
+//	-fail-on error|warning|none
+//	                      the lowest severity that fails the check (default error)
+func Main(constructor func() *mist.HTTPServer, args []string) int {
+	fs := flag.NewFlagSet("mistcheck", flag.ContinueOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	failOn := fs.String("fail-on", SeverityError, "lowest severity failing the check: error, warning or none")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	findings := Build(constructor)
+	if err := Report(os.Stdout, findings, *format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for _, f := range findings {
+		if *failOn == SeverityWarning || (*failOn == SeverityError && f.Severity == SeverityError) {
+			return 1
+		}
+	}
+	return 0
+}
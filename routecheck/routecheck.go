@@ -0,0 +1,237 @@
+// Package routecheck analyses the routes of a mist server and reports problems that are easy to
+// introduce in large route sets and hard to spot in review. It backs the mistcheck command but
+// can also be called from a unit test of the application:
+//
+//	func TestRoutes(t *testing.T) {
+//	    for _, f := range routecheck.Build(server.New) {
+//	        t.Error(f)
+//	    }
+//	}
+//
+// Rules:
+//
+//	duplicate-registration  the same method and pattern registered twice (construction fails)
+//	registration-conflict   any other registration the router rejects (construction fails)
+//	shadowed-route          requests for a route are captured by a static sibling, because the
+//	                        router prefers static segments and does not backtrack
+//	wildcard-child          a route below a "*" segment: the wildcard ends at the first segment
+//	                        matching the rest of the route, without backtracking, so that
+//	                        "/a/*/b" matches "/a/x/y/b" but not "/a/x/b/y/b"
+//	late-middleware         middleware registered after routes it covers
+package routecheck
+
+import (
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"sort"
+	"strings"
+)
+
+// Severity levels of findings.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Finding is a problem detected in the routes of a server.
+//
+// Fields:
+//   - Rule: The identifier of the rule that produced the finding.
+//   - Severity: SeverityError or SeverityWarning.
+//   - Method: The HTTP method of the affected route, if any.
+//   - Route: The affected route pattern, if any.
+//   - Message: A human-readable explanation.
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Method   string `json:"method,omitempty"`
+	Route    string `json:"route,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String renders the finding on a single line.
+func (f Finding) String() string {
+	if f.Route == "" {
+		return fmt.Sprintf("%s [%s] %s", f.Severity, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s [%s] %s %s: %s", f.Severity, f.Rule, f.Method, f.Route, f.Message)
+}
+
+// Build calls constructor and checks the server it returns. Registration panics raised while
+// the server is constructed are reported as findings instead of crashing the caller.
+func Build(constructor func() *mist.HTTPServer) (findings []Finding) {
+	defer func() {
+		if r := recover(); r != nil {
+			findings = []Finding{panicFinding(r)}
+		}
+	}()
+	return Check(constructor())
+}
+
+// panicFinding converts a registration panic into a finding.
+func panicFinding(r any) Finding {
+	err, ok := r.(error)
+	if !ok {
+		return Finding{Rule: "registration-conflict", Severity: SeverityError, Message: fmt.Sprint(r)}
+	}
+	if errs.IsRouterConflict(err) {
+		return Finding{Rule: "duplicate-registration", Severity: SeverityError, Message: err.Error()}
+	}
+	return Finding{Rule: "registration-conflict", Severity: SeverityError, Message: err.Error()}
+}
+
+// Check analyses the routes registered on server. Findings are sorted by method and route.
+func Check(server *mist.HTTPServer) []Finding {
+	var res []Finding
+	trees := server.RouteTrees()
+	methods := make([]string, 0, len(trees))
+	for m := range trees {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	for _, m := range methods {
+		res = append(res, checkShadowed(m, trees[m])...)
+		res = append(res, checkWildcardChildren(m, trees[m], false)...)
+	}
+	res = append(res, checkLateMiddleware(server.Registrations())...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Method != res[j].Method {
+			return res[i].Method < res[j].Method
+		}
+		return res[i].Route < res[j].Route
+	})
+	return res
+}
+
+// checkShadowed reports routes below a dynamic child that are unreachable for the segment values
+// of its static siblings.
+func checkShadowed(method string, n *mist.RouteNode) []Finding {
+	var res []Finding
+	var statics, dynamics []*mist.RouteNode
+	for _, c := range n.Children {
+		if c.Kind == mist.RouteKindStatic {
+			statics = append(statics, c)
+		} else {
+			dynamics = append(dynamics, c)
+		}
+	}
+	for _, d := range dynamics {
+		for _, r := range routesBelow(d, nil) {
+			for _, s := range statics {
+				if !reaches(s, r.rest) {
+					res = append(res, Finding{
+						Rule:     "shadowed-route",
+						Severity: SeverityWarning,
+						Method:   method,
+						Route:    r.route,
+						Message: fmt.Sprintf("requests with %q in place of %q never reach this route: the static segment takes precedence and the router does not backtrack",
+							s.Segment, d.Segment),
+					})
+				}
+			}
+		}
+	}
+	for _, c := range n.Children {
+		res = append(res, checkShadowed(method, c)...)
+	}
+	return res
+}
+
+// routeBelow is a route of a subtree with the segments following the subtree root.
+type routeBelow struct {
+	route string
+	rest  []*mist.RouteNode
+}
+
+// routesBelow lists the routes of the subtree rooted at n.
+func routesBelow(n *mist.RouteNode, rest []*mist.RouteNode) []routeBelow {
+	var res []routeBelow
+	if n.HasHandler {
+		res = append(res, routeBelow{route: n.Route, rest: rest})
+	}
+	for _, c := range n.Children {
+		res = append(res, routesBelow(c, append(append([]*mist.RouteNode(nil), rest...), c))...)
+	}
+	return res
+}
+
+// reaches reports whether every request matching the segments of rest, starting below n,
+// resolves to a handler when the router starts matching at n.
+func reaches(n *mist.RouteNode, rest []*mist.RouteNode) bool {
+	if len(rest) == 0 {
+		return n.HasHandler
+	}
+	seg := rest[0]
+	if seg.Kind == mist.RouteKindStatic {
+		for _, c := range n.Children {
+			if c.Kind == mist.RouteKindStatic && c.Segment == seg.Segment {
+				return reaches(c, rest[1:])
+			}
+		}
+	}
+	for _, c := range n.Children {
+		if c.Kind == mist.RouteKindParam || c.Kind == mist.RouteKindWildcard {
+			return reaches(c, rest[1:])
+		}
+	}
+	return false
+}
+
+// checkWildcardChildren reports routes registered below a wildcard segment.
+func checkWildcardChildren(method string, n *mist.RouteNode, belowWildcard bool) []Finding {
+	var res []Finding
+	if belowWildcard && n.HasHandler {
+		res = append(res, Finding{
+			Rule:     "wildcard-child",
+			Severity: SeverityWarning,
+			Method:   method,
+			Route:    n.Route,
+			Message: "route below a wildcard segment: the wildcard ends at the first segment matching the rest " +
+				"of the route, and paths repeating that segment later do not match",
+		})
+	}
+	for _, c := range n.Children {
+		res = append(res, checkWildcardChildren(method, c, belowWildcard || n.Kind == mist.RouteKindWildcard)...)
+	}
+	return res
+}
+
+// checkLateMiddleware reports middleware-only registrations made after routes they cover.
+func checkLateMiddleware(regs []mist.Registration) []Finding {
+	var res []Finding
+	for i, reg := range regs {
+		if reg.Handler || reg.Middlewares == 0 {
+			continue
+		}
+		var covered []string
+		for _, prev := range regs[:i] {
+			if prev.Handler && prev.Method == reg.Method && covers(reg.Path, prev.Path) {
+				covered = append(covered, prev.Path)
+			}
+		}
+		if len(covered) == 0 {
+			continue
+		}
+		res = append(res, Finding{
+			Rule:     "late-middleware",
+			Severity: SeverityWarning,
+			Method:   reg.Method,
+			Route:    reg.Path,
+			Message: fmt.Sprintf("middleware registered after %d route(s) it covers (first: %s); register middleware before routes so the setup reads in execution order",
+				len(covered), covered[0]),
+		})
+	}
+	return res
+}
+
+// covers reports whether middleware registered on pattern applies to route.
+func covers(pattern string, route string) bool {
+	if pattern == route || pattern == "/" || pattern == "/*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(route, prefix+"/")
+	}
+	return strings.HasPrefix(route, pattern+"/")
+}
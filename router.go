@@ -2,6 +2,7 @@ package mist
 
 import (
 	"github.com/dormoron/mist/internal/errs"
+	"net/url"
 	"strings"
 )
 
@@ -55,6 +56,12 @@ import (
 //     should be considered and implemented according to the needs of the application.
 type router struct {
 	trees map[string]*node
+	names map[string]string // Route names mapped to their path patterns, used for reverse routing.
+
+	registrations []Registration // Every route and middleware registration, in call order.
+
+	versioning *Versioning                // Resolution and retirement of API versions.
+	versioned  map[string]*versionedRoute // Versioned routes keyed by method and path.
 }
 
 // initRouter is a factory function that initializes and returns a new instance of the 'router' struct.
@@ -97,6 +104,10 @@ type router struct {
 func initRouter() router {
 	return router{
 		trees: map[string]*node{},
+		names: map[string]string{},
+
+		versioning: InitVersioning("v1"),
+		versioned:  map[string]*versionedRoute{},
 	}
 }
 
@@ -162,7 +173,12 @@ func (r *router) Group(prefix string, ms ...Middleware) *routerGroup {
 //
 // This method ensures that the routing tree accurately reflects all registered routes for each HTTP method, with the
 // appropriate handlers and middleware attached.
-func (r *router) registerRoute(method string, path string, handler HandleFunc, ms ...Middleware) {
+func (r *router) registerRoute(method string, path string, handler HandleFunc, ms ...Middleware) *Route {
+	// Record the call before validating it so that tooling can see the registration that failed.
+	r.registrations = append(r.registrations, Registration{
+		Method: method, Path: path, Handler: handler != nil, Middlewares: len(ms),
+	})
+
 	// Validate the incoming path to ensure it follows the expected format.
 	if path == "" {
 		// An empty path is invalid and indicative of an erroneous registration call.
@@ -195,7 +211,7 @@ func (r *router) registerRoute(method string, path string, handler HandleFunc, m
 		root.handler = handler
 		root.route = "/"
 		root.mils = ms
-		return
+		return &Route{node: root}
 	}
 
 	// Process each segment in the path to build the respective nodes in the routing tree.
@@ -219,6 +235,7 @@ func (r *router) registerRoute(method string, path string, handler HandleFunc, m
 	root.handler = handler
 	root.route = path
 	root.mils = appendCollectMiddlewares(root, ms)
+	return &Route{node: root}
 }
 
 // appendCollectMiddlewares traverses up the tree from the given node to the root and collects all
@@ -268,7 +285,7 @@ func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
 	root, ok := r.trees[method]
 	// If the method does not have a corresponding tree, return no match.
 	if !ok {
-		return nil, false
+		return &matchInfo{}, false
 	}
 
 	// Special case for root path "/".
@@ -285,17 +302,20 @@ func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
 	cur := root
 	// Loop through the path segments to traverse the routing tree.
 	for _, s := range segs {
-		var matchParam bool // Used to check if the current node match is a parameterized path segment.
-
 		// Find the child node matching the current path segment, capturing if it's a match with a parameter.
-		cur, matchParam, ok = cur.childOf(s)
-		// If there's no corresponding child node, the path does not match any route, return no match.
-		if !ok {
+		child, matchParam, found := cur.childOf(s)
+		if !found {
+			// A trailing wildcard absorbs the remaining segments.
+			if cur.typ == nodeTypeAny {
+				continue
+			}
+			// If there's no corresponding child node, the path does not match any route, return no match.
 			return &matchInfo{}, false
 		}
+		cur = child
 		// If the current node match is a parameterized segment, record the parameter value in matchInfo.
 		if matchParam {
-			mi.addValue(root.path[1:], s)
+			mi.addValue(cur.paramName, s)
 		}
 	}
 
@@ -351,3 +371,67 @@ func (r *router) findMils(root *node, segs []string) []Middleware {
 	// Return the collected middleware.
 	return res
 }
+
+// NameRoute associates a name with a route pattern so that URLs for the route can later be
+// generated with URLFor instead of being hard-coded in handlers, templates and serializers.
+// The pattern uses the same syntax as route registration, for example "/users/:id".
+// This method panics if the name has already been assigned to a different pattern, mirroring
+// the behaviour of conflicting route registrations.
+//
+// Parameters:
+//   - name: A unique, human-readable identifier for the route (e.g. "user-detail").
+//   - path: The route pattern the name refers to.
+//
+// Usage:
+//
+//	s.GET("/users/:id", showUser)
+//	s.NameRoute("user-detail", "/users/:id")
+func (r *router) NameRoute(name string, path string) {
+	if existing, ok := r.names[name]; ok && existing != path {
+		panic(errs.ErrRouteNameConflict(name))
+	}
+	if r.names == nil {
+		r.names = map[string]string{}
+	}
+	r.names[name] = path
+}
+
+// URLFor builds the URL path of a named route by substituting its parameter segments with
+// the supplied values. Parameter (":id") and regular expression (":id(^[0-9]+$)") segments
+// are replaced by the value stored under their parameter name, and a wildcard segment "*"
+// is replaced by the value stored under "*". Values are escaped for use in a URL path.
+//
+// Parameters:
+//   - name: The route name previously registered with NameRoute.
+//   - params: The values for the parameter segments of the route pattern.
+//
+// Returns:
+//   - string: The generated URL path.
+//   - error: An error if the name is unknown or a required parameter is missing.
+func (r *router) URLFor(name string, params map[string]string) (string, error) {
+	path, ok := r.names[name]
+	if !ok {
+		return "", errs.ErrRouteNameNotFound(name)
+	}
+	if path == "/" {
+		return path, nil
+	}
+	segs := strings.Split(path[1:], "/")
+	for i, seg := range segs {
+		var key string
+		switch {
+		case seg == "*":
+			key = "*"
+		case strings.HasPrefix(seg, ":"):
+			key, _, _ = strings.Cut(seg[1:], "(")
+		default:
+			continue
+		}
+		val, ok := params[key]
+		if !ok {
+			return "", errs.ErrRouteParamMissing(name, key)
+		}
+		segs[i] = url.PathEscape(val)
+	}
+	return "/" + strings.Join(segs, "/"), nil
+}
@@ -0,0 +1,104 @@
+package mist
+
+import (
+	"maps"
+	"slices"
+)
+
+// Kinds of RouteNode, mirroring the node types of the routing tree.
+const (
+	RouteKindStatic   = "static"
+	RouteKindParam    = "param"
+	RouteKindRegex    = "regex"
+	RouteKindWildcard = "wildcard"
+)
+
+// RouteNode is a read-only snapshot of a node of the routing tree, used by tooling such as the
+// route checker to inspect the routes of a server without access to its internals.
+//
+// Fields:
+//   - Segment: The path segment of the node as registered, e.g. "users", ":id" or "*".
+//   - Kind: One of the RouteKind constants.
+//   - Route: The full route pattern when a handler is registered on the node.
+//   - HasHandler: Whether a handler is registered on the node.
+//   - Middlewares: Short names of the middleware attached to the node.
+//   - Meta: The metadata attached to the route with Route.Meta.
+//   - Listeners: The listeners the route is restricted to with Route.OnlyOn; empty for all.
+//   - Constraints: The requests the route accepts, declared with Route.Constrain; nil when
+//     the route accepts every request.
+//   - Children: The child nodes in matching priority order.
+type RouteNode struct {
+	Segment     string
+	Kind        string
+	Route       string
+	HasHandler  bool
+	Middlewares []string
+	Meta        map[string]any
+	Listeners   []string
+	Constraints *Constraints
+	Children    []*RouteNode
+}
+
+// Registration records a call that registered a route or middleware on the router, in the
+// order the calls were made.
+//
+// Fields:
+//   - Method: The HTTP method of the registration.
+//   - Path: The path pattern of the registration.
+//   - Handler: Whether a handler was registered; false for middleware-only registrations.
+//   - Middlewares: The number of middleware passed with the registration.
+type Registration struct {
+	Method      string
+	Path        string
+	Handler     bool
+	Middlewares int
+}
+
+// RouteTrees returns a snapshot of the routing tree of every HTTP method, keyed by method.
+func (r *router) RouteTrees() map[string]*RouteNode {
+	res := make(map[string]*RouteNode, len(r.trees))
+	for method, root := range r.trees {
+		res[method] = snapshotNode(root)
+	}
+	return res
+}
+
+// Registrations returns every route and middleware registration in the order it was made.
+func (r *router) Registrations() []Registration {
+	return append([]Registration(nil), r.registrations...)
+}
+
+// snapshotNode copies n and its descendants into RouteNodes.
+func snapshotNode(n *node) *RouteNode {
+	kind := RouteKindStatic
+	switch n.typ {
+	case nodeTypeParam:
+		kind = RouteKindParam
+	case nodeTypeReg:
+		kind = RouteKindRegex
+	case nodeTypeAny:
+		kind = RouteKindWildcard
+	}
+	res := &RouteNode{
+		Segment:     n.path,
+		Kind:        kind,
+		Route:       n.route,
+		HasHandler:  n.handler != nil,
+		Middlewares: middlewareNames(n.mils),
+		Meta:        maps.Clone(n.meta),
+		Listeners:   slices.Clone(n.listeners),
+	}
+	if c := n.constraints; c != nil {
+		res.Constraints = &Constraints{
+			Headers:       slices.Clone(c.Headers),
+			Consumes:      slices.Clone(c.Consumes),
+			Produces:      slices.Clone(c.Produces),
+			MaxBodySize:   c.MaxBodySize,
+			MaxHeaderSize: c.MaxHeaderSize,
+		}
+	}
+	for _, child := range orderedChildren(n) {
+		res.Children = append(res.Children, snapshotNode(child))
+	}
+	return res
+}
@@ -0,0 +1,185 @@
+package mist
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"github.com/dormoron/mist/internal/errs"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ScanResult is the verdict of a Scanner on a file.
+//
+// Fields:
+//   - Clean: Whether the file was found free of malware.
+//   - Threat: The name of the malware found, e.g. "Eicar-Test-Signature"; empty for clean files.
+//   - Scanner: The name of the scanner, e.g. "clamav".
+//   - Duration: The time taken by the scan.
+type ScanResult struct {
+	Clean    bool
+	Threat   string
+	Scanner  string
+	Duration time.Duration
+}
+
+// Scanner scans files for malware, e.g. uploaded files before FileUploader persists them.
+type Scanner interface {
+	// Scan scans the file at path, returning an error wrapping errors.ErrScanFailed, or the
+	// error of ctx, when it cannot tell whether the file is clean.
+	Scan(ctx context.Context, path string) (ScanResult, error)
+}
+
+// ClamAVScanner is a Scanner streaming files to a clamd daemon with the INSTREAM command, so
+// that the daemon does not need access to the files.
+type ClamAVScanner struct {
+	network   string
+	address   string
+	chunkSize int
+}
+
+// InitClamAVScanner creates a ClamAVScanner connecting to clamd.
+//
+// Parameters:
+//   - network: "tcp" or "unix".
+//   - address: The address of clamd, e.g. "127.0.0.1:3310" or "/run/clamav/clamd.ctl".
+//
+// Returns:
+//   - *ClamAVScanner: The initialized scanner.
+func InitClamAVScanner(network string, address string) *ClamAVScanner {
+	return &ClamAVScanner{network: network, address: address, chunkSize: 64 << 10}
+}
+
+// Scan streams the file to clamd and reads its verdict. Files larger than the StreamMaxLength
+// of clamd fail the scan.
+func (s *ClamAVScanner) Scan(ctx context.Context, path string) (ScanResult, error) {
+	begin := time.Now()
+	res := ScanResult{Scanner: "clamav"}
+	file, err := os.Open(path)
+	if err != nil {
+		return res, err
+	}
+	defer file.Close()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return res, errs.ErrScanFailed(err.Error())
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	reply, err := s.stream(conn, file)
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	if err != nil {
+		return res, errs.ErrScanFailed(err.Error())
+	}
+	res.Duration = time.Since(begin)
+	// Replies read "stream: OK", "stream: <threat> FOUND" or "<reason> ERROR".
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case reply == "OK":
+		res.Clean = true
+		return res, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		res.Threat = strings.TrimSuffix(reply, " FOUND")
+		return res, nil
+	default:
+		return res, errs.ErrScanFailed("clamd replied " + reply)
+	}
+}
+
+// stream sends a file with the INSTREAM command and returns the reply of clamd.
+func (s *ClamAVScanner) stream(conn net.Conn, file io.Reader) (string, error) {
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4+s.chunkSize)
+	for {
+		n, err := file.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return "", werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+	reply, err := io.ReadAll(io.LimitReader(conn, 4096))
+	if err != nil && len(reply) == 0 {
+		return "", err
+	}
+	return string(bytes.TrimRight(reply, "\x00\n")), nil
+}
+
+// CommandScanner is a Scanner running an external command on the files, following the
+// convention of clamscan and most command line scanners: exit status 0 for clean files, 1 for
+// infected ones with the threat on the last line of the output, other statuses for failures.
+type CommandScanner struct {
+	name string
+	args []string
+}
+
+// InitCommandScanner creates a CommandScanner running the command with the path of the file
+// appended to args.
+//
+// Example:
+//
+//	scanner := mist.InitCommandScanner("clamdscan", "--no-summary", "--fdpass")
+//
+// Parameters:
+//   - name: The command.
+//   - args: The arguments of the command, before the path.
+//
+// Returns:
+//   - *CommandScanner: The initialized scanner.
+func InitCommandScanner(name string, args ...string) *CommandScanner {
+	return &CommandScanner{name: name, args: args}
+}
+
+// Scan runs the command on the file; the command is killed when ctx is done.
+func (s *CommandScanner) Scan(ctx context.Context, path string) (ScanResult, error) {
+	begin := time.Now()
+	res := ScanResult{Scanner: s.name}
+	cmd := exec.CommandContext(ctx, s.name, append(append([]string(nil), s.args...), path)...)
+	out, err := cmd.Output()
+	res.Duration = time.Since(begin)
+	if ctx.Err() != nil {
+		return res, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		res.Clean = true
+		return res, nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		res.Threat = lines[len(lines)-1]
+		// clamscan prints "<path>: <threat> FOUND".
+		res.Threat = strings.TrimSuffix(strings.TrimPrefix(res.Threat, path+": "), " FOUND")
+		if res.Threat == "" {
+			res.Threat = "unknown"
+		}
+		return res, nil
+	default:
+		return res, errs.ErrScanFailed(s.name + ": " + err.Error())
+	}
+}
@@ -0,0 +1,521 @@
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter is a parsed filter expression (RFC 7644, section 3.4.2.2), such as
+// `userName eq "bjensen"` or `emails[type eq "work" and value co "@example.com"]`. Stores
+// translate it to their query language, or evaluate it with Match.
+//
+// Fields:
+//   - Op: "and" and "or" combine Left and Right, and "not" negates Left; "eq", "ne", "co",
+//     "sw", "ew", "gt", "ge", "lt" and "le" compare the attribute at Path with Value, and
+//     "pr" tests its presence; "[]" matches the values of the multi-valued attribute at Path
+//     against Left.
+//   - Path: The attribute path, e.g. "userName" or "name.givenName". The URN of the core
+//     schemas is removed, that of extensions is kept, separated by a colon.
+//   - Value: The compared value: a string, a float64, a bool or nil.
+//   - Left: The first operand of logical operators, the filter of "[]".
+//   - Right: The second operand of "and" and "or".
+type Filter struct {
+	Op    string
+	Path  string
+	Value any
+	Left  *Filter
+	Right *Filter
+}
+
+// comparisons are the comparison operators of filters.
+var comparisons = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter expression.
+//
+// Parameters:
+//   - expr: The expression, e.g. the "filter" query parameter of a list request.
+//
+// Returns:
+//   - *Filter: The parsed filter.
+//   - error: An *Error of type "invalidFilter" if the expression is malformed.
+func ParseFilter(expr string) (*Filter, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, invalidFilter("unexpected " + p.peek().text)
+	}
+	return f, nil
+}
+
+// Match reports whether a resource matches the filter.
+//
+// Parameters:
+//   - resource: A *User, a *Group, or any value encoding to a JSON object.
+func (f *Filter) Match(resource any) bool {
+	m, ok := resource.(map[string]any)
+	if !ok {
+		data, err := json.Marshal(resource)
+		if err != nil || json.Unmarshal(data, &m) != nil {
+			return false
+		}
+	}
+	return f.match(m)
+}
+
+// match evaluates the filter against a resource decoded from JSON.
+func (f *Filter) match(m map[string]any) bool {
+	switch f.Op {
+	case "and":
+		return f.Left.match(m) && f.Right.match(m)
+	case "or":
+		return f.Left.match(m) || f.Right.match(m)
+	case "not":
+		return !f.Left.match(m)
+	case "[]":
+		for _, v := range resolve(m, splitPath(f.Path)) {
+			if e, ok := v.(map[string]any); ok && f.Left.match(e) {
+				return true
+			}
+		}
+		return false
+	case "pr":
+		for _, v := range resolve(m, splitPath(f.Path)) {
+			if present(v) {
+				return true
+			}
+		}
+		return false
+	case "ne":
+		return !(&Filter{Op: "eq", Path: f.Path, Value: f.Value}).match(m)
+	}
+	segments := splitPath(f.Path)
+	exact := caseExact(segments)
+	for _, v := range resolve(m, segments) {
+		// Multi-valued attributes are compared through their value.
+		if e, ok := v.(map[string]any); ok {
+			v = e["value"]
+		}
+		if compare(v, f.Op, f.Value, exact) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPath splits an attribute path into the names to look up, the URN of an extension being
+// a name of its own.
+func splitPath(path string) []string {
+	if strings.EqualFold(path, SchemaEnterpriseUser) {
+		return []string{SchemaEnterpriseUser}
+	}
+	var segments []string
+	if len(path) > 4 && strings.EqualFold(path[:4], "urn:") {
+		i := strings.LastIndexByte(path, ':')
+		urn, rest := path[:i], path[i+1:]
+		if !isCoreSchema(urn) {
+			segments = append(segments, urn)
+		}
+		path = rest
+	}
+	return append(segments, strings.Split(path, ".")...)
+}
+
+// isCoreSchema reports whether a URN is that of the core user or group schema.
+func isCoreSchema(urn string) bool {
+	return strings.EqualFold(urn, SchemaUser) || strings.EqualFold(urn, SchemaGroup)
+}
+
+// normalizePath removes the URN of the core schemas from an attribute path.
+func normalizePath(path string) string {
+	if len(path) > 4 && strings.EqualFold(path[:4], "urn:") {
+		i := strings.LastIndexByte(path, ':')
+		if isCoreSchema(path[:i]) {
+			return path[i+1:]
+		}
+	}
+	return path
+}
+
+// resolve returns the values at a path, attribute names matched case-insensitively and the
+// elements of multi-valued attributes flattened.
+func resolve(m map[string]any, segments []string) []any {
+	current := []any{m}
+	for _, name := range segments {
+		var next []any
+		for _, c := range current {
+			obj, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			v, ok := lookup(obj, name)
+			if !ok || v == nil {
+				continue
+			}
+			if arr, ok := v.([]any); ok {
+				next = append(next, arr...)
+			} else {
+				next = append(next, v)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// lookup returns the attribute of an object with a name, matched case-insensitively.
+func lookup(obj map[string]any, name string) (any, bool) {
+	if v, ok := obj[name]; ok {
+		return v, true
+	}
+	for k, v := range obj {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// caseExact reports whether the attribute at a path is compared case-sensitively: the
+// identifiers and references, the names and addresses of users being case-insensitive.
+func caseExact(segments []string) bool {
+	last := strings.ToLower(segments[len(segments)-1])
+	switch last {
+	case "id", "externalid", "$ref":
+		return true
+	case "value":
+		if len(segments) < 2 {
+			return false
+		}
+		parent := strings.ToLower(segments[len(segments)-2])
+		return parent == "members" || parent == "groups" || parent == "manager"
+	}
+	return false
+}
+
+// present reports whether a value is set.
+func present(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case string:
+		return t != ""
+	case []any:
+		return len(t) > 0
+	case map[string]any:
+		return len(t) > 0
+	}
+	return true
+}
+
+// compare applies a comparison operator to an attribute value and the value of a filter.
+func compare(v any, op string, want any, exact bool) bool {
+	switch w := want.(type) {
+	case string:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "gt", "ge", "lt", "le", "eq":
+			// Dates are compared as instants, whatever their precision or offset.
+			if t1, err := time.Parse(time.RFC3339, s); err == nil {
+				if t2, err := time.Parse(time.RFC3339, w); err == nil {
+					return ordered(op, t1.Compare(t2))
+				}
+			}
+		}
+		if !exact {
+			s, w = strings.ToLower(s), strings.ToLower(w)
+		}
+		switch op {
+		case "co":
+			return strings.Contains(s, w)
+		case "sw":
+			return strings.HasPrefix(s, w)
+		case "ew":
+			return strings.HasSuffix(s, w)
+		}
+		return ordered(op, strings.Compare(s, w))
+	case float64:
+		n, ok := v.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case n < w:
+			return ordered(op, -1)
+		case n > w:
+			return ordered(op, 1)
+		}
+		return ordered(op, 0)
+	case bool:
+		b, ok := v.(bool)
+		return ok && op == "eq" && b == w
+	}
+	return false
+}
+
+// ordered applies an ordering operator to the result of a comparison.
+func ordered(op string, c int) bool {
+	switch op {
+	case "eq":
+		return c == 0
+	case "gt":
+		return c > 0
+	case "ge":
+		return c >= 0
+	case "lt":
+		return c < 0
+	case "le":
+		return c <= 0
+	}
+	return false
+}
+
+// Kinds of filter tokens.
+const (
+	tokEOF = iota
+	tokWord
+	tokString
+	tokNumber
+	tokOpen
+	tokClose
+	tokOpenBracket
+	tokCloseBracket
+)
+
+// token is a token of a filter expression.
+type token struct {
+	kind  int
+	text  string
+	value any
+}
+
+// tokenize splits a filter expression into tokens.
+func tokenize(expr string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			toks = append(toks, token{kind: tokOpen, text: "("})
+			i++
+		case c == ')':
+			toks = append(toks, token{kind: tokClose, text: ")"})
+			i++
+		case c == '[':
+			toks = append(toks, token{kind: tokOpenBracket, text: "["})
+			i++
+		case c == ']':
+			toks = append(toks, token{kind: tokCloseBracket, text: "]"})
+			i++
+		case c == '"':
+			// Strings are JSON strings, escapes included.
+			j := i + 1
+			for j < len(expr) && expr[j] != '"' {
+				if expr[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(expr) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(expr[i:j+1]), &s); err != nil {
+				return nil, invalidFilter("malformed string " + expr[i:j+1])
+			}
+			toks = append(toks, token{kind: tokString, text: expr[i : j+1], value: s})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(expr) && strings.IndexByte("0123456789.eE+-", expr[j]) >= 0 {
+				j++
+			}
+			n, err := strconv.ParseFloat(expr[i:j], 64)
+			if err != nil {
+				return nil, invalidFilter("malformed number " + expr[i:j])
+			}
+			toks = append(toks, token{kind: tokNumber, text: expr[i:j], value: n})
+			i = j
+		case isWordByte(c):
+			j := i + 1
+			for j < len(expr) && isWordByte(expr[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokWord, text: expr[i:j]})
+			i = j
+		default:
+			return nil, invalidFilter("unexpected character " + string(c))
+		}
+	}
+	return append(toks, token{kind: tokEOF, text: "end of filter"}), nil
+}
+
+// isWordByte reports whether a byte belongs to attribute paths, operators and keywords.
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == ':' || c == '$'
+}
+
+// filterParser parses tokens by recursive descent, "and" binding tighter than "or".
+type filterParser struct {
+	toks []token
+	pos  int
+}
+
+// peek returns the next token.
+func (p *filterParser) peek() token {
+	return p.toks[p.pos]
+}
+
+// next consumes the next token.
+func (p *filterParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword reports whether the next token is a keyword, consuming it if so.
+func (p *filterParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// or parses filters joined by "or".
+func (p *filterParser) or() (*Filter, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right *Filter
+		if right, err = p.and(); err == nil {
+			left = &Filter{Op: "or", Left: left, Right: right}
+		}
+	}
+	return left, err
+}
+
+// and parses filters joined by "and".
+func (p *filterParser) and() (*Filter, error) {
+	left, err := p.factor()
+	for err == nil && p.keyword("and") {
+		var right *Filter
+		if right, err = p.factor(); err == nil {
+			left = &Filter{Op: "and", Left: left, Right: right}
+		}
+	}
+	return left, err
+}
+
+// factor parses a parenthesized or negated filter, a value path or a comparison.
+func (p *filterParser) factor() (*Filter, error) {
+	t := p.next()
+	switch {
+	case t.kind == tokOpen:
+		return p.group(tokClose, ")")
+	case t.kind == tokWord && strings.EqualFold(t.text, "not") && p.peek().kind == tokOpen:
+		p.next()
+		inner, err := p.group(tokClose, ")")
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Left: inner}, nil
+	case t.kind != tokWord:
+		return nil, invalidFilter("expected an attribute, found " + t.text)
+	}
+	path := normalizePath(t.text)
+	if p.peek().kind == tokOpenBracket {
+		p.next()
+		inner, err := p.group(tokCloseBracket, "]")
+		if err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "[]", Path: path, Left: inner}, nil
+	}
+	opTok := p.next()
+	op := strings.ToLower(opTok.text)
+	if opTok.kind == tokWord && op == "pr" {
+		return &Filter{Op: "pr", Path: path}, nil
+	}
+	if opTok.kind != tokWord || !comparisons[op] {
+		return nil, invalidFilter("expected an operator after " + t.text + ", found " + opTok.text)
+	}
+	v := p.next()
+	switch v.kind {
+	case tokString, tokNumber:
+		return &Filter{Op: op, Path: path, Value: v.value}, nil
+	case tokWord:
+		switch strings.ToLower(v.text) {
+		case "true":
+			return &Filter{Op: op, Path: path, Value: true}, nil
+		case "false":
+			return &Filter{Op: op, Path: path, Value: false}, nil
+		case "null":
+			return &Filter{Op: op, Path: path}, nil
+		}
+	}
+	return nil, invalidFilter("expected a value after " + op + ", found " + v.text)
+}
+
+// group parses a filter followed by a closing token.
+func (p *filterParser) group(closing int, text string) (*Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next().kind != closing {
+		return nil, invalidFilter("missing " + text)
+	}
+	return f, nil
+}
+
+// valuePath is a path of a patch operation: an attribute, optionally filtered and followed by
+// a sub-attribute, as in `emails[type eq "work"].value`.
+type valuePath struct {
+	attr   string
+	filter *Filter
+	sub    string
+}
+
+// parseValuePath parses the path of a patch operation.
+func parseValuePath(path string) (valuePath, error) {
+	path = normalizePath(strings.TrimSpace(path))
+	open := strings.IndexByte(path, '[')
+	if open < 0 {
+		return valuePath{attr: path}, nil
+	}
+	end := strings.LastIndexByte(path, ']')
+	if end < open {
+		return valuePath{}, invalidPath(path)
+	}
+	f, err := ParseFilter(path[open+1 : end])
+	if err != nil {
+		return valuePath{}, invalidPath(path)
+	}
+	vp := valuePath{attr: path[:open], filter: f}
+	if rest := path[end+1:]; rest != "" {
+		if rest[0] != '.' || len(rest) == 1 {
+			return valuePath{}, invalidPath(path)
+		}
+		vp.sub = rest[1:]
+	}
+	return vp, nil
+}
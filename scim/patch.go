@@ -0,0 +1,223 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// patchRequest is the body of a PATCH request.
+type patchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []patchOperation `json:"Operations"`
+}
+
+// patchOperation is an operation of a PATCH request.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// applyPatch applies the operations of a PATCH request to a resource decoded from JSON
+// (RFC 7644, section 3.5.2).
+func applyPatch(m map[string]any, ops []patchOperation) error {
+	for _, op := range ops {
+		var value any
+		if len(op.Value) > 0 {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return invalidValue("malformed value")
+			}
+		}
+		kind := strings.ToLower(op.Op)
+		switch kind {
+		case "add", "replace":
+			if strings.TrimSpace(op.Path) == "" {
+				// Without a path, the value holds the attributes to set, by path.
+				obj, ok := value.(map[string]any)
+				if !ok {
+					return invalidValue("an operation without path needs an object value")
+				}
+				for path, v := range obj {
+					vp, err := parseValuePath(path)
+					if err != nil {
+						return err
+					}
+					if err = patchPath(m, kind, vp, v); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+		case "remove":
+			if strings.TrimSpace(op.Path) == "" {
+				return &Error{Status: 400, Type: "noTarget", Detail: "remove needs a path"}
+			}
+		default:
+			return invalidValue("unknown operation " + op.Op)
+		}
+		vp, err := parseValuePath(op.Path)
+		if err != nil {
+			return err
+		}
+		if err = patchPath(m, kind, vp, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchPath applies an operation to the attribute at a path.
+func patchPath(m map[string]any, kind string, vp valuePath, value any) error {
+	segments := splitPath(vp.attr)
+	parent := m
+	for _, name := range segments[:len(segments)-1] {
+		v, _ := lookup(parent, name)
+		child, ok := v.(map[string]any)
+		if !ok {
+			if kind == "remove" {
+				return nil
+			}
+			child = make(map[string]any)
+			parent[keyOf(parent, name)] = child
+		}
+		parent = child
+	}
+	key := keyOf(parent, segments[len(segments)-1])
+	existing := parent[key]
+
+	if vp.filter != nil {
+		return patchValues(parent, key, kind, vp, value)
+	}
+	switch kind {
+	case "remove":
+		arr, ok := existing.([]any)
+		items, hasItems := value.([]any)
+		if !ok || !hasItems {
+			delete(parent, key)
+			return nil
+		}
+		// Values listed in the operation are removed from the attribute.
+		kept := arr[:0]
+		for _, e := range arr {
+			if !containsValue(items, e) {
+				kept = append(kept, e)
+			}
+		}
+		setOrDelete(parent, key, kept)
+	case "add":
+		if arr, ok := existing.([]any); ok {
+			items, isArray := value.([]any)
+			if !isArray {
+				items = []any{value}
+			}
+			for _, item := range items {
+				if !containsValue(arr, item) {
+					arr = append(arr, item)
+				}
+			}
+			parent[key] = arr
+			return nil
+		}
+		fallthrough
+	default:
+		if obj, ok := existing.(map[string]any); ok {
+			if update, ok := value.(map[string]any); ok {
+				for k, v := range update {
+					obj[keyOf(obj, k)] = v
+				}
+				return nil
+			}
+		}
+		parent[key] = value
+	}
+	return nil
+}
+
+// patchValues applies an operation to the values of a multi-valued attribute matching the
+// filter of a path.
+func patchValues(parent map[string]any, key string, kind string, vp valuePath, value any) error {
+	arr, _ := parent[key].([]any)
+	matched := false
+	kept := make([]any, 0, len(arr))
+	for _, e := range arr {
+		elem, ok := e.(map[string]any)
+		if !ok || !vp.filter.match(elem) {
+			kept = append(kept, e)
+			continue
+		}
+		matched = true
+		switch {
+		case kind == "remove" && vp.sub == "":
+			continue
+		case kind == "remove":
+			delete(elem, keyOf(elem, vp.sub))
+		case vp.sub != "":
+			elem[keyOf(elem, vp.sub)] = value
+		default:
+			update, ok := value.(map[string]any)
+			if !ok {
+				return invalidValue("the value of " + key + " must be an object")
+			}
+			if kind == "replace" {
+				elem = make(map[string]any)
+			}
+			for k, v := range update {
+				elem[keyOf(elem, k)] = v
+			}
+		}
+		kept = append(kept, elem)
+	}
+	if !matched && kind != "remove" {
+		// Identity providers set values such as emails[type eq "work"].value whether or not
+		// the user has one: a value is added with the attribute of a simple filter.
+		if vp.filter.Op != "eq" || vp.sub == "" || strings.Contains(vp.filter.Path, ".") {
+			return &Error{Status: 400, Type: "noTarget", Detail: "no value of " + key + " matches the filter"}
+		}
+		kept = append(kept, map[string]any{vp.filter.Path: vp.filter.Value, vp.sub: value})
+	}
+	setOrDelete(parent, key, kept)
+	return nil
+}
+
+// keyOf returns the key of an attribute in an object: the existing key matching a name
+// case-insensitively, or the name.
+func keyOf(obj map[string]any, name string) string {
+	if _, ok := obj[name]; ok {
+		return name
+	}
+	for k := range obj {
+		if strings.EqualFold(k, name) {
+			return k
+		}
+	}
+	return name
+}
+
+// containsValue reports whether a multi-valued attribute holds a value, complex values being
+// compared by their "value" sub-attribute.
+func containsValue(arr []any, v any) bool {
+	want := v
+	if obj, ok := v.(map[string]any); ok && obj["value"] != nil {
+		want = obj["value"]
+	}
+	for _, e := range arr {
+		got := e
+		if obj, ok := e.(map[string]any); ok && obj["value"] != nil {
+			got = obj["value"]
+		}
+		if reflect.DeepEqual(got, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOrDelete sets a multi-valued attribute, removing it once empty.
+func setOrDelete(obj map[string]any, key string, values []any) {
+	if len(values) == 0 {
+		delete(obj, key)
+		return
+	}
+	obj[key] = values
+}
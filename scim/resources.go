@@ -0,0 +1,157 @@
+package scim
+
+import (
+	"time"
+)
+
+// Schemas of the resources and messages of SCIM 2.0.
+const (
+	SchemaUser           = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaEnterpriseUser = "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User"
+	SchemaGroup          = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp        = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError          = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaConfig         = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType   = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// Meta holds the metadata of a resource, maintained by the Service.
+//
+// Fields:
+//   - ResourceType: "User" or "Group".
+//   - Created: When the resource was provisioned.
+//   - LastModified: When the resource was last replaced or patched.
+//   - Location: The URL of the resource, set in responses.
+type Meta struct {
+	ResourceType string    `json:"resourceType,omitempty"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+}
+
+// Name is the name of a user.
+type Name struct {
+	Formatted       string `json:"formatted,omitempty"`
+	FamilyName      string `json:"familyName,omitempty"`
+	GivenName       string `json:"givenName,omitempty"`
+	MiddleName      string `json:"middleName,omitempty"`
+	HonorificPrefix string `json:"honorificPrefix,omitempty"`
+	HonorificSuffix string `json:"honorificSuffix,omitempty"`
+}
+
+// MultiValue is a value of a multi-valued attribute such as emails or phoneNumbers.
+//
+// Fields:
+//   - Value: The value, e.g. the email address.
+//   - Display: A human readable form of the value.
+//   - Type: The kind of value, e.g. "work" or "home".
+//   - Primary: Whether this is the preferred value of the attribute.
+type MultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// GroupRef is a group a user belongs to. It is read-only: memberships are changed through the
+// members of the groups.
+type GroupRef struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// Manager is the manager of a user, in the enterprise extension.
+type Manager struct {
+	Value       string `json:"value,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// EnterpriseUser holds the attributes of the enterprise extension of users.
+type EnterpriseUser struct {
+	EmployeeNumber string   `json:"employeeNumber,omitempty"`
+	CostCenter     string   `json:"costCenter,omitempty"`
+	Organization   string   `json:"organization,omitempty"`
+	Division       string   `json:"division,omitempty"`
+	Department     string   `json:"department,omitempty"`
+	Manager        *Manager `json:"manager,omitempty"`
+}
+
+// User is a SCIM user.
+//
+// Fields:
+//   - ID: The identifier assigned by the service provider, read-only.
+//   - ExternalID: The identifier of the user at the identity provider.
+//   - UserName: The unique name the user signs in with.
+//   - Active: Whether the user may sign in; identity providers deactivate users before deleting
+//     them, if they delete them at all.
+//   - Groups: The groups of the user, read-only and maintained by the Store.
+//   - Enterprise: The attributes of the enterprise extension, nil when absent.
+type User struct {
+	Schemas           []string        `json:"schemas"`
+	ID                string          `json:"id"`
+	ExternalID        string          `json:"externalId,omitempty"`
+	UserName          string          `json:"userName"`
+	Name              *Name           `json:"name,omitempty"`
+	DisplayName       string          `json:"displayName,omitempty"`
+	NickName          string          `json:"nickName,omitempty"`
+	Title             string          `json:"title,omitempty"`
+	UserType          string          `json:"userType,omitempty"`
+	PreferredLanguage string          `json:"preferredLanguage,omitempty"`
+	Locale            string          `json:"locale,omitempty"`
+	Timezone          string          `json:"timezone,omitempty"`
+	Active            bool            `json:"active"`
+	Emails            []MultiValue    `json:"emails,omitempty"`
+	PhoneNumbers      []MultiValue    `json:"phoneNumbers,omitempty"`
+	Groups            []GroupRef      `json:"groups,omitempty"`
+	Enterprise        *EnterpriseUser `json:"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User,omitempty"`
+	Meta              Meta            `json:"meta"`
+}
+
+// PrimaryEmail returns the primary email address of the user, or the first one.
+func (u *User) PrimaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return e.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// Member is a member of a group.
+//
+// Fields:
+//   - Value: The ID of the member.
+//   - Display: The name of the member, filled by the Store.
+//   - Type: "User" or "Group".
+type Member struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// Group is a SCIM group.
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"`
+	Meta        Meta     `json:"meta"`
+}
+
+// ListResponse is the response of a query.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
@@ -0,0 +1,505 @@
+// Package scim implements the service provider side of SCIM 2.0 (RFC 7643 and RFC 7644), so
+// that identity providers such as Entra ID, Okta or OneLogin can provision the users and
+// groups of an organization into the application, and deprovision them when they leave:
+//
+//	svc := scim.InitService(store).SetBaseURL("https://app.example/scim/v2")
+//	svc.Register(server, "/scim/v2", scim.BearerToken(os.Getenv("SCIM_TOKEN")))
+//
+// The Store keeps the resources, usually in the tables of the application; InitMemoryStore
+// suits tests. The Users and Groups endpoints support filters, pagination, PATCH operations
+// and the attributes and excludedAttributes parameters. Bulk operations, sorting, ETags and
+// the /Schemas endpoint are not supported, as reported by /ServiceProviderConfig.
+package scim
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/dormoron/mist"
+	misterrors "github.com/dormoron/mist/errors"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a SCIM error, answered with the error schema of SCIM.
+//
+// Fields:
+//   - Status: The HTTP status code.
+//   - Type: The scimType of the error, e.g. "invalidFilter", "invalidValue" or "noTarget".
+//   - Detail: A description of the error.
+type Error struct {
+	Status int
+	Type   string
+	Detail string
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return "scim: " + e.Detail
+}
+
+// invalidFilter returns the error of a malformed filter.
+func invalidFilter(detail string) error {
+	return &Error{Status: http.StatusBadRequest, Type: "invalidFilter", Detail: detail}
+}
+
+// invalidPath returns the error of a malformed patch path.
+func invalidPath(path string) error {
+	return &Error{Status: http.StatusBadRequest, Type: "invalidPath", Detail: "invalid path " + path}
+}
+
+// invalidValue returns the error of a missing or malformed value.
+func invalidValue(detail string) error {
+	return &Error{Status: http.StatusBadRequest, Type: "invalidValue", Detail: detail}
+}
+
+// Service serves the SCIM endpoints over a Store.
+type Service struct {
+	store      Store
+	baseURL    string
+	maxResults int
+}
+
+// InitService creates a Service returning at most 100 resources per page.
+//
+// Parameters:
+//   - store: The store of the users and groups.
+//
+// Returns:
+//   - *Service: The initialized service.
+func InitService(store Store) *Service {
+	return &Service{store: store, maxResults: 100}
+}
+
+// SetBaseURL sets the absolute URL of the endpoints, used in the location of the resources;
+// the path prefix of the routes is used by default.
+func (s *Service) SetBaseURL(u string) *Service {
+	s.baseURL = strings.TrimSuffix(u, "/")
+	return s
+}
+
+// SetMaxResults sets the maximum number of resources per page.
+func (s *Service) SetMaxResults(n int) *Service {
+	s.maxResults = n
+	return s
+}
+
+// BearerToken returns a middleware admitting the requests carrying one of the tokens as a
+// bearer token, the way identity providers authenticate to SCIM endpoints. Several tokens
+// allow rotating them.
+func BearerToken(tokens ...string) mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			auth := ctx.Request.Header.Get("Authorization")
+			if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+				got := []byte(strings.TrimSpace(auth[7:]))
+				for _, token := range tokens {
+					if token != "" && subtle.ConstantTimeCompare(got, []byte(token)) == 1 {
+						next(ctx)
+						return
+					}
+				}
+			}
+			ctx.Header("WWW-Authenticate", `Bearer realm="scim"`)
+			respondError(ctx, &Error{Status: http.StatusUnauthorized, Detail: "invalid or missing token"})
+		}
+	}
+}
+
+// Register registers the SCIM endpoints under a prefix:
+//   - GET {prefix}/ServiceProviderConfig and {prefix}/ResourceTypes: the capabilities,
+//   - GET and POST {prefix}/Users: query and create users,
+//   - GET, PUT, PATCH and DELETE {prefix}/Users/:id: read, replace, patch and delete a user,
+//   - the same routes under {prefix}/Groups for groups.
+//
+// The endpoints must be authenticated; pass BearerToken or another middleware in ms.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the routes, e.g. "/scim/v2".
+//   - ms: Middleware applied to every route.
+func (s *Service) Register(server *mist.HTTPServer, prefix string, ms ...mist.Middleware) {
+	if s.baseURL == "" {
+		s.baseURL = prefix
+	}
+	g := server.Group(prefix, ms...)
+	g.GET("/ServiceProviderConfig", s.serviceProviderConfig)
+	g.GET("/ResourceTypes", s.resourceTypes)
+
+	users := &endpoint[User, *User]{s: s, kind: "User", path: "/Users",
+		create: s.store.CreateUser, get: s.store.GetUser, replace: s.store.ReplaceUser,
+		remove: s.store.DeleteUser, list: s.store.ListUsers}
+	groups := &endpoint[Group, *Group]{s: s, kind: "Group", path: "/Groups",
+		create: s.store.CreateGroup, get: s.store.GetGroup, replace: s.store.ReplaceGroup,
+		remove: s.store.DeleteGroup, list: s.store.ListGroups}
+	g.GET("/Users", users.listHandler)
+	g.POST("/Users", users.createHandler)
+	g.GET("/Users/:id", users.getHandler)
+	g.PUT("/Users/:id", users.replaceHandler)
+	g.PATCH("/Users/:id", users.patchHandler)
+	g.DELETE("/Users/:id", users.deleteHandler)
+	g.GET("/Groups", groups.listHandler)
+	g.POST("/Groups", groups.createHandler)
+	g.GET("/Groups/:id", groups.getHandler)
+	g.PUT("/Groups/:id", groups.replaceHandler)
+	g.PATCH("/Groups/:id", groups.patchHandler)
+	g.DELETE("/Groups/:id", groups.deleteHandler)
+}
+
+// resource is implemented by *User and *Group.
+type resource interface {
+	resourceID() string
+	setResourceID(id string)
+	metadata() *Meta
+	// prepare sets the schemas and clears the read-only attributes of a resource received from
+	// a client, and checks its required attributes.
+	prepare() error
+}
+
+func (u *User) resourceID() string      { return u.ID }
+func (u *User) setResourceID(id string) { u.ID = id }
+func (u *User) metadata() *Meta         { return &u.Meta }
+
+func (u *User) prepare() error {
+	if strings.TrimSpace(u.UserName) == "" {
+		return invalidValue("userName is required")
+	}
+	u.Schemas = []string{SchemaUser}
+	if u.Enterprise != nil {
+		u.Schemas = append(u.Schemas, SchemaEnterpriseUser)
+	}
+	u.Groups = nil
+	return nil
+}
+
+func (g *Group) resourceID() string      { return g.ID }
+func (g *Group) setResourceID(id string) { g.ID = id }
+func (g *Group) metadata() *Meta         { return &g.Meta }
+
+func (g *Group) prepare() error {
+	if strings.TrimSpace(g.DisplayName) == "" {
+		return invalidValue("displayName is required")
+	}
+	g.Schemas = []string{SchemaGroup}
+	for i := range g.Members {
+		if g.Members[i].Value == "" {
+			return invalidValue("members need a value")
+		}
+		g.Members[i].Display = ""
+		g.Members[i].Ref = ""
+	}
+	return nil
+}
+
+// endpoint serves the routes of a resource type.
+type endpoint[T any, P interface {
+	*T
+	resource
+}] struct {
+	s       *Service
+	kind    string
+	path    string
+	create  func(ctx context.Context, r P) error
+	get     func(ctx context.Context, id string) (P, error)
+	replace func(ctx context.Context, r P) error
+	remove  func(ctx context.Context, id string) error
+	list    func(ctx context.Context, q Query) ([]P, int, error)
+}
+
+// listHandler answers a query with a page of resources.
+func (e *endpoint[T, P]) listHandler(ctx *mist.Context) {
+	query := Query{StartIndex: 1, Count: e.s.maxResults}
+	if expr := ctx.QueryValue("filter").StringOrDefault(""); expr != "" {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			respondError(ctx, err)
+			return
+		}
+		query.Filter = f
+	}
+	if v, err := strconv.Atoi(ctx.QueryValue("startIndex").StringOrDefault("1")); err == nil && v > 1 {
+		query.StartIndex = v
+	}
+	if v, err := strconv.Atoi(ctx.QueryValue("count").StringOrDefault("")); err == nil {
+		query.Count = min(max(v, 0), e.s.maxResults)
+	}
+	resources, total, err := e.list(ctx.Request.Context(), query)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	resp := ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   query.StartIndex,
+		ItemsPerPage: len(resources),
+		Resources:    make([]any, 0, len(resources)),
+	}
+	for _, r := range resources {
+		resp.Resources = append(resp.Resources, e.output(ctx, r))
+	}
+	respond(ctx, http.StatusOK, resp)
+}
+
+// createHandler creates a resource and answers with it.
+func (e *endpoint[T, P]) createHandler(ctx *mist.Context) {
+	r, ok := e.bind(ctx)
+	if !ok {
+		return
+	}
+	now := time.Now().UTC()
+	r.setResourceID(uuid.NewString())
+	*r.metadata() = Meta{ResourceType: e.kind, Created: now, LastModified: now}
+	if err := e.create(ctx.Request.Context(), r); err != nil {
+		respondError(ctx, err)
+		return
+	}
+	created, err := e.get(ctx.Request.Context(), r.resourceID())
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	ctx.Header("Location", e.location(r.resourceID()))
+	respond(ctx, http.StatusCreated, e.output(ctx, created))
+}
+
+// getHandler answers with a resource.
+func (e *endpoint[T, P]) getHandler(ctx *mist.Context) {
+	r, err := e.get(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	respond(ctx, http.StatusOK, e.output(ctx, r))
+}
+
+// replaceHandler replaces a resource with the body of the request.
+func (e *endpoint[T, P]) replaceHandler(ctx *mist.Context) {
+	r, ok := e.bind(ctx)
+	if !ok {
+		return
+	}
+	existing, err := e.get(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	e.save(ctx, existing, r)
+}
+
+// patchHandler applies the operations of a PatchOp request to a resource.
+func (e *endpoint[T, P]) patchHandler(ctx *mist.Context) {
+	var req patchRequest
+	if err := ctx.BindJSON(&req); err != nil || len(req.Operations) == 0 {
+		respondError(ctx, &Error{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: "expected a PatchOp with operations"})
+		return
+	}
+	existing, err := e.get(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault(""))
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	m := toMap(existing)
+	if err = applyPatch(m, req.Operations); err != nil {
+		respondError(ctx, err)
+		return
+	}
+	// Some identity providers send booleans as strings, e.g. {"active": "False"}.
+	if v, ok := m["active"].(string); ok {
+		if b, err := strconv.ParseBool(strings.ToLower(v)); err == nil {
+			m["active"] = b
+		}
+	}
+	data, _ := json.Marshal(m)
+	r := P(new(T))
+	if err = json.Unmarshal(data, r); err != nil {
+		respondError(ctx, invalidValue("the patched resource is invalid: "+err.Error()))
+		return
+	}
+	if err = r.prepare(); err != nil {
+		respondError(ctx, err)
+		return
+	}
+	e.save(ctx, existing, r)
+}
+
+// deleteHandler deletes a resource.
+func (e *endpoint[T, P]) deleteHandler(ctx *mist.Context) {
+	if err := e.remove(ctx.Request.Context(), ctx.PathValue("id").StringOrDefault("")); err != nil {
+		respondError(ctx, err)
+		return
+	}
+	ctx.RespStatusCode = http.StatusNoContent
+}
+
+// bind decodes a resource from the body of a request, answering the request when it is
+// invalid.
+func (e *endpoint[T, P]) bind(ctx *mist.Context) (P, bool) {
+	r := P(new(T))
+	if err := ctx.BindJSON(r); err != nil {
+		respondError(ctx, &Error{Status: http.StatusBadRequest, Type: "invalidSyntax", Detail: "malformed " + e.kind})
+		return nil, false
+	}
+	if err := r.prepare(); err != nil {
+		respondError(ctx, err)
+		return nil, false
+	}
+	return r, true
+}
+
+// save replaces an existing resource, keeping its ID and creation time, and answers with the
+// stored resource.
+func (e *endpoint[T, P]) save(ctx *mist.Context, existing P, r P) {
+	r.setResourceID(existing.resourceID())
+	*r.metadata() = Meta{ResourceType: e.kind, Created: existing.metadata().Created, LastModified: time.Now().UTC()}
+	if err := e.replace(ctx.Request.Context(), r); err != nil {
+		respondError(ctx, err)
+		return
+	}
+	saved, err := e.get(ctx.Request.Context(), r.resourceID())
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	respond(ctx, http.StatusOK, e.output(ctx, saved))
+}
+
+// output returns a resource as answered: with its location, restricted to the attributes of
+// the "attributes" and "excludedAttributes" query parameters.
+func (e *endpoint[T, P]) output(ctx *mist.Context, r P) any {
+	r.metadata().ResourceType = e.kind
+	r.metadata().Location = e.location(r.resourceID())
+	attributes := splitList(ctx.QueryValue("attributes").StringOrDefault(""))
+	excluded := splitList(ctx.QueryValue("excludedAttributes").StringOrDefault(""))
+	if len(attributes) == 0 && len(excluded) == 0 {
+		return r
+	}
+	m := toMap(r)
+	if len(attributes) > 0 {
+		keep := map[string]bool{"id": true, "schemas": true}
+		for _, a := range attributes {
+			keep[strings.ToLower(splitPath(normalizePath(a))[0])] = true
+		}
+		for k := range m {
+			if !keep[strings.ToLower(k)] {
+				delete(m, k)
+			}
+		}
+	}
+	for _, a := range excluded {
+		name := splitPath(normalizePath(a))[0]
+		if !strings.EqualFold(name, "id") && !strings.EqualFold(name, "schemas") {
+			delete(m, keyOf(m, name))
+		}
+	}
+	return m
+}
+
+// location returns the URL of a resource.
+func (e *endpoint[T, P]) location(id string) string {
+	return e.s.baseURL + e.path + "/" + id
+}
+
+// serviceProviderConfig answers with the capabilities of the service.
+func (s *Service) serviceProviderConfig(ctx *mist.Context) {
+	supported := func(ok bool) map[string]any { return map[string]any{"supported": ok} }
+	respond(ctx, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaConfig},
+		"patch":          supported(true),
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": s.maxResults},
+		"changePassword": supported(false),
+		"sort":           supported(false),
+		"etag":           supported(false),
+		"authenticationSchemes": []map[string]any{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication with a bearer token",
+		}},
+		"meta": map[string]any{"resourceType": "ServiceProviderConfig", "location": s.baseURL + "/ServiceProviderConfig"},
+	})
+}
+
+// resourceTypes answers with the resource types of the service.
+func (s *Service) resourceTypes(ctx *mist.Context) {
+	resourceType := func(name string, endpoint string, schema string, extensions ...string) map[string]any {
+		rt := map[string]any{
+			"schemas":  []string{schemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta":     map[string]any{"resourceType": "ResourceType", "location": s.baseURL + "/ResourceTypes/" + name},
+		}
+		if len(extensions) > 0 {
+			var exts []map[string]any
+			for _, ext := range extensions {
+				exts = append(exts, map[string]any{"schema": ext, "required": false})
+			}
+			rt["schemaExtensions"] = exts
+		}
+		return rt
+	}
+	respond(ctx, http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: 2,
+		StartIndex:   1,
+		ItemsPerPage: 2,
+		Resources: []any{
+			resourceType("User", "/Users", SchemaUser, SchemaEnterpriseUser),
+			resourceType("Group", "/Groups", SchemaGroup),
+		},
+	})
+}
+
+// respond answers a request with a SCIM JSON body.
+func respond(ctx *mist.Context, status int, v any) {
+	if err := ctx.RespondWithJSON(status, v); err != nil {
+		_ = ctx.RespondError(err)
+		return
+	}
+	ctx.Header("Content-Type", "application/scim+json")
+}
+
+// respondError answers a request with the error schema of SCIM: *Error as is, registered
+// errors with their status and message, other errors with 500.
+func respondError(ctx *mist.Context, err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{Status: misterrors.HTTPStatus(err), Detail: misterrors.Message(err)}
+		if misterrors.Is(err, misterrors.ErrSCIMConflict) {
+			e.Type = "uniqueness"
+		}
+	}
+	body := map[string]any{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(e.Status),
+		"detail":  e.Detail,
+	}
+	if e.Type != "" {
+		body["scimType"] = e.Type
+	}
+	respond(ctx, e.Status, body)
+}
+
+// toMap returns a resource decoded from its JSON encoding.
+func toMap(v any) map[string]any {
+	data, _ := json.Marshal(v)
+	var m map[string]any
+	_ = json.Unmarshal(data, &m)
+	return m
+}
+
+// splitList splits a comma-separated query parameter.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,289 @@
+package scim
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/dormoron/mist/internal/errs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Query selects a page of the resources matching a filter.
+//
+// Fields:
+//   - Filter: The filter of the resources, nil for all of them.
+//   - StartIndex: The 1-based index of the first resource of the page.
+//   - Count: The maximum number of resources of the page; 0 asks for the total only.
+type Query struct {
+	Filter     *Filter
+	StartIndex int
+	Count      int
+}
+
+// Store keeps the provisioned users and groups, usually in the tables of the application. The
+// Service assigns IDs and metadata before calling it.
+type Store interface {
+	// CreateUser stores a new user, returning an error wrapping errors.ErrSCIMConflict if its
+	// userName is taken.
+	CreateUser(ctx context.Context, user *User) error
+	// GetUser returns a user with its groups, or an error wrapping errors.ErrSCIMNotFound.
+	GetUser(ctx context.Context, id string) (*User, error)
+	// ReplaceUser replaces a user, returning an error wrapping errors.ErrSCIMNotFound or
+	// errors.ErrSCIMConflict.
+	ReplaceUser(ctx context.Context, user *User) error
+	// DeleteUser deletes a user and its memberships, or returns an error wrapping
+	// errors.ErrSCIMNotFound.
+	DeleteUser(ctx context.Context, id string) error
+	// ListUsers returns a page of the users matching a query and the number of matching users.
+	ListUsers(ctx context.Context, query Query) ([]*User, int, error)
+
+	// CreateGroup stores a new group, returning an error wrapping errors.ErrSCIMConflict if
+	// its displayName is taken.
+	CreateGroup(ctx context.Context, group *Group) error
+	// GetGroup returns a group with its members, or an error wrapping errors.ErrSCIMNotFound.
+	GetGroup(ctx context.Context, id string) (*Group, error)
+	// ReplaceGroup replaces a group and its members, returning an error wrapping
+	// errors.ErrSCIMNotFound or errors.ErrSCIMConflict.
+	ReplaceGroup(ctx context.Context, group *Group) error
+	// DeleteGroup deletes a group, or returns an error wrapping errors.ErrSCIMNotFound.
+	DeleteGroup(ctx context.Context, id string) error
+	// ListGroups returns a page of the groups matching a query and the number of matching
+	// groups.
+	ListGroups(ctx context.Context, query Query) ([]*Group, int, error)
+}
+
+// MemoryStore keeps users and groups in process memory, evaluating filters with
+// Filter.Match. It is safe for concurrent use and suits tests and prototypes.
+type MemoryStore struct {
+	mutex  sync.RWMutex
+	users  map[string]*User
+	groups map[string]*Group
+}
+
+// InitMemoryStore creates an empty MemoryStore.
+func InitMemoryStore() *MemoryStore {
+	return &MemoryStore{users: make(map[string]*User), groups: make(map[string]*Group)}
+}
+
+// CreateUser stores a new user.
+func (s *MemoryStore) CreateUser(_ context.Context, user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.checkUserName(user); err != nil {
+		return err
+	}
+	s.users[user.ID] = clone(user)
+	return nil
+}
+
+// GetUser returns a user with its groups.
+func (s *MemoryStore) GetUser(_ context.Context, id string) (*User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errs.ErrSCIMNotFound("User", id)
+	}
+	return s.withGroups(user), nil
+}
+
+// ReplaceUser replaces a user.
+func (s *MemoryStore) ReplaceUser(_ context.Context, user *User) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.users[user.ID]; !ok {
+		return errs.ErrSCIMNotFound("User", user.ID)
+	}
+	if err := s.checkUserName(user); err != nil {
+		return err
+	}
+	s.users[user.ID] = clone(user)
+	return nil
+}
+
+// DeleteUser deletes a user and removes it from its groups.
+func (s *MemoryStore) DeleteUser(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return errs.ErrSCIMNotFound("User", id)
+	}
+	delete(s.users, id)
+	for _, g := range s.groups {
+		members := g.Members[:0]
+		for _, m := range g.Members {
+			if m.Value != id {
+				members = append(members, m)
+			}
+		}
+		g.Members = members
+	}
+	return nil
+}
+
+// ListUsers returns a page of the users matching a query, in the order they were created.
+func (s *MemoryStore) ListUsers(_ context.Context, query Query) ([]*User, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var matched []*User
+	for _, u := range s.users {
+		user := s.withGroups(u)
+		if query.Filter == nil || query.Filter.Match(user) {
+			matched = append(matched, user)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].Meta.Created.Equal(matched[j].Meta.Created) {
+			return matched[i].Meta.Created.Before(matched[j].Meta.Created)
+		}
+		return matched[i].ID < matched[j].ID
+	})
+	return page(matched, query), len(matched), nil
+}
+
+// CreateGroup stores a new group.
+func (s *MemoryStore) CreateGroup(_ context.Context, group *Group) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.checkDisplayName(group); err != nil {
+		return err
+	}
+	s.groups[group.ID] = clone(group)
+	return nil
+}
+
+// GetGroup returns a group with its members.
+func (s *MemoryStore) GetGroup(_ context.Context, id string) (*Group, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	group, ok := s.groups[id]
+	if !ok {
+		return nil, errs.ErrSCIMNotFound("Group", id)
+	}
+	return s.withDisplay(group), nil
+}
+
+// ReplaceGroup replaces a group and its members.
+func (s *MemoryStore) ReplaceGroup(_ context.Context, group *Group) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.groups[group.ID]; !ok {
+		return errs.ErrSCIMNotFound("Group", group.ID)
+	}
+	if err := s.checkDisplayName(group); err != nil {
+		return err
+	}
+	s.groups[group.ID] = clone(group)
+	return nil
+}
+
+// DeleteGroup deletes a group.
+func (s *MemoryStore) DeleteGroup(_ context.Context, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.groups[id]; !ok {
+		return errs.ErrSCIMNotFound("Group", id)
+	}
+	delete(s.groups, id)
+	return nil
+}
+
+// ListGroups returns a page of the groups matching a query, in the order they were created.
+func (s *MemoryStore) ListGroups(_ context.Context, query Query) ([]*Group, int, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var matched []*Group
+	for _, g := range s.groups {
+		group := s.withDisplay(g)
+		if query.Filter == nil || query.Filter.Match(group) {
+			matched = append(matched, group)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].Meta.Created.Equal(matched[j].Meta.Created) {
+			return matched[i].Meta.Created.Before(matched[j].Meta.Created)
+		}
+		return matched[i].ID < matched[j].ID
+	})
+	return page(matched, query), len(matched), nil
+}
+
+// checkUserName returns an error if another user has the userName of a user, names being
+// case-insensitive.
+func (s *MemoryStore) checkUserName(user *User) error {
+	for id, u := range s.users {
+		if id != user.ID && strings.EqualFold(u.UserName, user.UserName) {
+			return errs.ErrSCIMConflict("userName", user.UserName)
+		}
+	}
+	return nil
+}
+
+// checkDisplayName returns an error if another group has the displayName of a group.
+func (s *MemoryStore) checkDisplayName(group *Group) error {
+	for id, g := range s.groups {
+		if id != group.ID && strings.EqualFold(g.DisplayName, group.DisplayName) {
+			return errs.ErrSCIMConflict("displayName", group.DisplayName)
+		}
+	}
+	return nil
+}
+
+// withGroups returns a copy of a user with the groups it is a member of.
+func (s *MemoryStore) withGroups(user *User) *User {
+	u := clone(user)
+	u.Groups = nil
+	for _, g := range s.groups {
+		for _, m := range g.Members {
+			if m.Value == u.ID {
+				u.Groups = append(u.Groups, GroupRef{Value: g.ID, Display: g.DisplayName, Type: "direct"})
+				break
+			}
+		}
+	}
+	sort.Slice(u.Groups, func(i, j int) bool { return u.Groups[i].Display < u.Groups[j].Display })
+	return u
+}
+
+// withDisplay returns a copy of a group with the names of its members.
+func (s *MemoryStore) withDisplay(group *Group) *Group {
+	g := clone(group)
+	for i, m := range g.Members {
+		if u, ok := s.users[m.Value]; ok {
+			g.Members[i].Display = u.DisplayName
+			if g.Members[i].Display == "" {
+				g.Members[i].Display = u.UserName
+			}
+			g.Members[i].Type = "User"
+		} else if sub, ok := s.groups[m.Value]; ok {
+			g.Members[i].Display = sub.DisplayName
+			g.Members[i].Type = "Group"
+		}
+	}
+	return g
+}
+
+// clone returns a deep copy of a resource.
+func clone[T any](v *T) *T {
+	data, _ := json.Marshal(v)
+	var c T
+	_ = json.Unmarshal(data, &c)
+	return &c
+}
+
+// page returns the resources of the page of a query.
+func page[T any](resources []T, query Query) []T {
+	start := query.StartIndex - 1
+	if start < 0 {
+		start = 0
+	}
+	if start >= len(resources) || query.Count <= 0 {
+		return nil
+	}
+	end := start + query.Count
+	if end > len(resources) {
+		end = len(resources)
+	}
+	return resources[start:end]
+}
@@ -0,0 +1,367 @@
+// Package accountflows implements the password reset and email verification flows of an
+// account system: it issues expiring single-use tokens, mails them as links, limits how often
+// the emails can be requested, and serves the routes completing the flows. The application
+// keeps its users and password hashing behind the Users interface:
+//
+//	flows := accountflows.InitFlows(users, flowstate.InitRedisBackend(rdb), throttle.InitRedisStore(rdb), m).
+//	    SetResetURL("https://shop.example/reset-password").
+//	    SetVerifyURL("https://shop.example/api/account/email/verify").
+//	    SetQueue(queue)
+//	flows.Register(server, "/api/account")
+//
+// Tokens are 256-bit random values, stored hashed so that reading the store does not give
+// access to accounts, and deleted as they are used.
+package accountflows
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/flowstate"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/mailer"
+	"github.com/dormoron/mist/security/throttle"
+	"github.com/dormoron/mist/session"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Purposes of tokens, also the names of the mail templates.
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+// Users is the account store of the application.
+type Users interface {
+	// FindByEmail returns the ID of the user with an email address, "" when there is none.
+	FindByEmail(ctx context.Context, email string) (string, error)
+	// SetPassword sets the password of a user, hashing it.
+	SetPassword(ctx context.Context, userID string, password string) error
+	// MarkEmailVerified records that a user controls an email address.
+	MarkEmailVerified(ctx context.Context, userID string, email string) error
+}
+
+// MailData is the data of the mail templates.
+//
+// Fields:
+//   - Link: The URL completing the flow, carrying the token.
+//   - Email: The address the message is sent to.
+//   - ExpiresIn: The validity of the link.
+type MailData struct {
+	Link      string
+	Email     string
+	ExpiresIn time.Duration
+}
+
+// Flows issues, mails and verifies account tokens.
+type Flows struct {
+	users    Users
+	backend  flowstate.Backend
+	limits   throttle.Store
+	mailer   *mailer.Mailer
+	queue    *mailer.Queue
+	sessions *session.Manager
+
+	prefix         string
+	resetURL       string
+	verifyURL      string
+	verifiedURL    string
+	resetTTL       time.Duration
+	verifyTTL      time.Duration
+	perEmail       int64
+	perIP          int64
+	window         time.Duration
+	minPassword    int
+	subjects       map[string]string
+	currentUser    func(ctx *mist.Context) (userID string, email string)
+	onPasswordSet  func(ctx *mist.Context, userID string)
+	onVerification func(ctx *mist.Context, userID string, email string)
+}
+
+// InitFlows creates Flows with reset links valid for 1 hour and verification links for 24
+// hours. An email address can be sent 3 emails an hour, and a client IP 20, for each flow.
+// New passwords must have at least 8 characters.
+//
+// Parameters:
+//   - users: The account store of the application.
+//   - backend: The store of the tokens, e.g. flowstate.InitRedisBackend(rdb).
+//   - limits: The store of the rate limit counters, e.g. throttle.InitRedisStore(rdb).
+//   - m: The mailer sending the links, with templates "password_reset" and "verify_email"
+//     rendered with MailData.
+//
+// Returns:
+//   - *Flows: The initialized flows.
+func InitFlows(users Users, backend flowstate.Backend, limits throttle.Store, m *mailer.Mailer) *Flows {
+	return &Flows{
+		users:       users,
+		backend:     backend,
+		limits:      limits,
+		mailer:      m,
+		prefix:      "accountflows",
+		resetTTL:    time.Hour,
+		verifyTTL:   24 * time.Hour,
+		perEmail:    3,
+		perIP:       20,
+		window:      time.Hour,
+		minPassword: 8,
+		subjects: map[string]string{
+			PurposePasswordReset: "Reset your password",
+			PurposeVerifyEmail:   "Confirm your email address",
+		},
+	}
+}
+
+// SetResetURL sets the page where users choose a new password; the token is added as the
+// "token" query parameter.
+func (f *Flows) SetResetURL(u string) *Flows {
+	f.resetURL = u
+	return f
+}
+
+// SetVerifyURL sets the URL confirming an email address, usually the route of VerifyEmail; the
+// token is added as the "token" query parameter.
+func (f *Flows) SetVerifyURL(u string) *Flows {
+	f.verifyURL = u
+	return f
+}
+
+// SetVerifiedRedirect sets the page VerifyEmail redirects to once the address is confirmed,
+// in place of a JSON response.
+func (f *Flows) SetVerifiedRedirect(u string) *Flows {
+	f.verifiedURL = u
+	return f
+}
+
+// SetTTL sets the validity of the password reset and email verification links.
+func (f *Flows) SetTTL(reset time.Duration, verify time.Duration) *Flows {
+	f.resetTTL = reset
+	f.verifyTTL = verify
+	return f
+}
+
+// SetRateLimit sets the emails of each flow that an email address and a client IP can request
+// within a window; 0 disables a limit.
+func (f *Flows) SetRateLimit(perEmail int, perIP int, window time.Duration) *Flows {
+	f.perEmail = int64(perEmail)
+	f.perIP = int64(perIP)
+	f.window = window
+	return f
+}
+
+// SetSubjects sets the subjects of the password reset and email verification emails.
+func (f *Flows) SetSubjects(reset string, verify string) *Flows {
+	f.subjects[PurposePasswordReset] = reset
+	f.subjects[PurposeVerifyEmail] = verify
+	return f
+}
+
+// SetQueue sets the queue sending the emails, so that requests do not wait for the mail server
+// and their duration does not tell whether an address has an account.
+func (f *Flows) SetQueue(queue *mailer.Queue) *Flows {
+	f.queue = queue
+	return f
+}
+
+// SetKeyPrefix sets the prefix of the keys of the tokens and counters.
+func (f *Flows) SetKeyPrefix(prefix string) *Flows {
+	f.prefix = prefix
+	return f
+}
+
+// SetMinPasswordLength sets the shortest accepted new password.
+func (f *Flows) SetMinPasswordLength(n int) *Flows {
+	f.minPassword = n
+	return f
+}
+
+// SetSessionManager sets the session manager whose session is removed once the password is
+// reset, so that the user signs in with the new password.
+func (f *Flows) SetSessionManager(m *session.Manager) *Flows {
+	f.sessions = m
+	return f
+}
+
+// SetCurrentUserFunc sets the function returning the signed-in user of a request and their
+// email address, used by RequestVerification; "" when nobody is signed in.
+func (f *Flows) SetCurrentUserFunc(fn func(ctx *mist.Context) (userID string, email string)) *Flows {
+	f.currentUser = fn
+	return f
+}
+
+// OnPasswordReset sets a function called after a password was reset, e.g. to revoke the
+// other sessions and tokens of the user, or to notify them.
+func (f *Flows) OnPasswordReset(fn func(ctx *mist.Context, userID string)) *Flows {
+	f.onPasswordSet = fn
+	return f
+}
+
+// OnEmailVerified sets a function called after an email address was confirmed.
+func (f *Flows) OnEmailVerified(fn func(ctx *mist.Context, userID string, email string)) *Flows {
+	f.onVerification = fn
+	return f
+}
+
+// tokenData is the state stored under a token.
+type tokenData struct {
+	UserID string `json:"u"`
+	Email  string `json:"e,omitempty"`
+}
+
+// Issue creates a single-use token of a purpose.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - purpose: PurposePasswordReset or PurposeVerifyEmail.
+//   - userID: The user the token is for.
+//   - email: The address the token confirms; "" for password resets.
+//   - ttl: The validity of the token.
+//
+// Returns:
+//   - string: The token.
+//   - error: An error if the token could not be stored.
+func (f *Flows) Issue(ctx context.Context, purpose string, userID string, email string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	data, err := json.Marshal(tokenData{UserID: userID, Email: email})
+	if err != nil {
+		return "", err
+	}
+	if err = f.backend.Put(ctx, f.tokenKey(purpose, token), data, ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Consume verifies a token of a purpose and deletes it.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - purpose: The purpose the token was issued for.
+//   - token: The token.
+//
+// Returns:
+//   - string: The user the token is for.
+//   - string: The address the token confirms.
+//   - error: An error wrapping errors.ErrAccountTokenInvalid if the token is unknown, expired
+//     or was already used.
+func (f *Flows) Consume(ctx context.Context, purpose string, token string) (string, string, error) {
+	if token == "" {
+		return "", "", errs.ErrAccountTokenInvalid(purpose)
+	}
+	raw, err := f.backend.Take(ctx, f.tokenKey(purpose, token))
+	if err != nil {
+		return "", "", err
+	}
+	var data tokenData
+	if raw == nil || json.Unmarshal(raw, &data) != nil || data.UserID == "" {
+		return "", "", errs.ErrAccountTokenInvalid(purpose)
+	}
+	return data.UserID, data.Email, nil
+}
+
+// SendPasswordReset mails a password reset link to the user with an email address, if there
+// is one; it does nothing for unknown addresses, which callers must not reveal.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - email: The address the reset was requested for.
+//
+// Returns:
+//   - error: An error if the user could not be looked up or the email could not be sent.
+func (f *Flows) SendPasswordReset(ctx context.Context, email string) error {
+	userID, err := f.users.FindByEmail(ctx, email)
+	if err != nil || userID == "" {
+		return err
+	}
+	return f.send(ctx, PurposePasswordReset, userID, email, f.resetURL, f.resetTTL)
+}
+
+// SendVerification mails a link confirming an email address, e.g. after sign-up or a change
+// of address.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - userID: The user the address belongs to.
+//   - email: The address to confirm.
+//
+// Returns:
+//   - error: An error if the email could not be sent.
+func (f *Flows) SendVerification(ctx context.Context, userID string, email string) error {
+	return f.send(ctx, PurposeVerifyEmail, userID, email, f.verifyURL, f.verifyTTL)
+}
+
+// send issues a token and mails its link.
+func (f *Flows) send(ctx context.Context, purpose string, userID string, email string, base string, ttl time.Duration) error {
+	tokenEmail := ""
+	if purpose == PurposeVerifyEmail {
+		tokenEmail = email
+	}
+	token, err := f.Issue(ctx, purpose, userID, tokenEmail, ttl)
+	if err != nil {
+		return err
+	}
+	msg := &mailer.Message{To: []string{email}, Subject: f.subjects[purpose]}
+	data := MailData{Link: withToken(base, token), Email: email, ExpiresIn: ttl}
+	if err = f.mailer.Render(ctx, msg, purpose, data); err != nil {
+		return err
+	}
+	if f.queue != nil {
+		return f.queue.Enqueue(msg)
+	}
+	return f.mailer.Send(ctx, msg)
+}
+
+// allow counts a request for an email of a purpose against the limits of the address and of
+// the client IP.
+func (f *Flows) allow(ctx context.Context, purpose string, email string, ip string) error {
+	for _, limit := range []struct {
+		key string
+		max int64
+	}{
+		{f.prefix + ":" + purpose + ":email:" + email, f.perEmail},
+		{f.prefix + ":" + purpose + ":ip:" + ip, f.perIP},
+	} {
+		if limit.max <= 0 {
+			continue
+		}
+		count, err := f.limits.Incr(ctx, limit.key, f.window)
+		if err != nil {
+			return err
+		}
+		if count > limit.max {
+			return errs.ErrAccountFlowRateLimited(purpose)
+		}
+	}
+	return nil
+}
+
+// tokenKey returns the key of a token in the backend: its hash, so that the store does not
+// hold usable tokens.
+func (f *Flows) tokenKey(purpose string, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return f.prefix + ":" + purpose + ":" + hex.EncodeToString(sum[:])
+}
+
+// withToken adds a token to the query of a URL.
+func withToken(base string, token string) string {
+	sep := "?"
+	if strings.Contains(base, "?") {
+		sep = "&"
+	}
+	return base + sep + "token=" + url.QueryEscape(token)
+}
+
+// normalizeEmail lowercases an email address and trims its spaces, so that the rate limits
+// apply to an address however it is typed.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
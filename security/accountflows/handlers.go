@@ -0,0 +1,162 @@
+package accountflows
+
+import (
+	"errors"
+	"github.com/dormoron/mist"
+	misterrors "github.com/dormoron/mist/errors"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+)
+
+// forgotRequest is the body of RequestPasswordReset.
+type forgotRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// resetRequest is the body of ResetPassword.
+type resetRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Register registers the routes of the flows under a prefix:
+//   - POST {prefix}/password/forgot: RequestPasswordReset,
+//   - POST {prefix}/password/reset: ResetPassword,
+//   - POST {prefix}/email/verification: RequestVerification,
+//   - GET {prefix}/email/verify: VerifyEmail.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the routes, e.g. "/api/account".
+//   - ms: Middleware applied to every route.
+func (f *Flows) Register(server *mist.HTTPServer, prefix string, ms ...mist.Middleware) {
+	g := server.Group(prefix, ms...)
+	g.POST("/password/forgot", f.RequestPasswordReset())
+	g.POST("/password/reset", f.ResetPassword())
+	g.POST("/email/verification", f.RequestVerification())
+	g.GET("/email/verify", f.VerifyEmail())
+}
+
+// RequestPasswordReset returns the handler mailing a password reset link to the address of
+// the JSON body {"email": ...}. It responds with 202 whether the address has an account or
+// not, so that it cannot be used to find out, and with 429 once the rate limits are reached.
+func (f *Flows) RequestPasswordReset() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		var req forgotRequest
+		if err := ctx.BindAndValidate(&req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		email := normalizeEmail(req.Email)
+		if err := f.allow(ctx.Request.Context(), PurposePasswordReset, email, ctx.ClientIP()); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if err := f.SendPasswordReset(ctx.Request.Context(), email); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		ctx.RespStatusCode = http.StatusAccepted
+	}
+}
+
+// ResetPassword returns the handler setting a new password with a reset token, from the JSON
+// body {"token": ..., "password": ...}. It responds with 204, with 400 when the token is
+// invalid, expired or used, and with 422 when the password is too short. The session of the
+// request is removed when a session manager is set.
+func (f *Flows) ResetPassword() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		var req resetRequest
+		if err := ctx.BindAndValidate(&req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		if utf8.RuneCountInString(req.Password) < f.minPassword {
+			_ = ctx.RespondProblem(mist.Problem{
+				Status: http.StatusUnprocessableEntity,
+				Detail: "the password must have at least " + strconv.Itoa(f.minPassword) + " characters",
+			})
+			return
+		}
+		userID, _, err := f.Consume(ctx.Request.Context(), PurposePasswordReset, req.Token)
+		if err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if err = f.users.SetPassword(ctx.Request.Context(), userID, req.Password); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if f.sessions != nil {
+			_ = f.sessions.RemoveSession(ctx)
+		}
+		if f.onPasswordSet != nil {
+			f.onPasswordSet(ctx, userID)
+		}
+		ctx.RespStatusCode = http.StatusNoContent
+	}
+}
+
+// RequestVerification returns the handler mailing a new verification link to the signed-in
+// user, see SetCurrentUserFunc. It responds with 202, with 401 when nobody is signed in and
+// with 429 once the rate limits are reached.
+func (f *Flows) RequestVerification() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		userID, email := "", ""
+		if f.currentUser != nil {
+			userID, email = f.currentUser(ctx)
+		}
+		if userID == "" || email == "" {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusUnauthorized})
+			return
+		}
+		if err := f.allow(ctx.Request.Context(), PurposeVerifyEmail, normalizeEmail(email), ctx.ClientIP()); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if err := f.SendVerification(ctx.Request.Context(), userID, email); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		ctx.RespStatusCode = http.StatusAccepted
+	}
+}
+
+// VerifyEmail returns the handler of the verification links, confirming the address of the
+// "token" query parameter. It redirects to the page set by SetVerifiedRedirect, or responds
+// with {"status": "verified"}, and responds with 400 when the token is invalid, expired or
+// used.
+func (f *Flows) VerifyEmail() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		token := ctx.QueryValue("token").StringOrDefault("")
+		userID, email, err := f.Consume(ctx.Request.Context(), PurposeVerifyEmail, token)
+		if err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if err = f.users.MarkEmailVerified(ctx.Request.Context(), userID, email); err != nil {
+			f.respondError(ctx, err)
+			return
+		}
+		if f.onVerification != nil {
+			f.onVerification(ctx, userID, email)
+		}
+		ctx.Header("Cache-Control", "no-store")
+		if f.verifiedURL != "" {
+			ctx.Header("Location", f.verifiedURL)
+			ctx.RespStatusCode = http.StatusSeeOther
+			return
+		}
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]string{"status": "verified"})
+	}
+}
+
+// respondError answers a request with RespondError, with a Retry-After header for rate limited
+// requests.
+func (f *Flows) respondError(ctx *mist.Context, err error) {
+	if errors.Is(err, misterrors.ErrAccountFlowRateLimited) {
+		ctx.Header("Retry-After", strconv.Itoa(int(f.window.Seconds())))
+	}
+	_ = ctx.RespondError(err)
+}
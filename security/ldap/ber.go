@@ -0,0 +1,162 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Identifiers of the BER types used by LDAP (RFC 4511, section 5.1).
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+
+	classContext     = 0x80
+	classApplication = 0x40
+	constructed      = 0x20
+)
+
+// maxPacketSize bounds the size of the messages read from a server.
+const maxPacketSize = 16 << 20
+
+// packet is a BER element: primitive with a value, or constructed with children.
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+// seq returns a constructed element.
+func seq(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag | constructed, children: children}
+}
+
+// str returns a primitive element holding a string.
+func str(tag byte, s string) *packet {
+	return &packet{tag: tag, value: []byte(s)}
+}
+
+// integer returns a primitive element holding an integer, in the minimal two's complement form.
+func integer(tag byte, v int64) *packet {
+	b := []byte{byte(v)}
+	for v >= 128 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return &packet{tag: tag, value: b}
+}
+
+// boolean returns a primitive element holding a boolean.
+func boolean(tag byte, v bool) *packet {
+	if v {
+		return &packet{tag: tag, value: []byte{0xff}}
+	}
+	return &packet{tag: tag, value: []byte{0x00}}
+}
+
+// encode returns the encoding of an element, with definite lengths as LDAP requires.
+func (p *packet) encode() []byte {
+	content := p.value
+	if p.tag&constructed != 0 {
+		var buf bytes.Buffer
+		for _, c := range p.children {
+			buf.Write(c.encode())
+		}
+		content = buf.Bytes()
+	}
+	out := []byte{p.tag}
+	if n := len(content); n < 128 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, content...)
+}
+
+// int returns the integer value of a primitive element.
+func (p *packet) int() int64 {
+	var v int64
+	for i, b := range p.value {
+		if i == 0 && b&0x80 != 0 {
+			v = -1
+		}
+		v = v<<8 | int64(b)
+	}
+	return v
+}
+
+// child returns a child of a constructed element, nil when it has fewer children.
+func (p *packet) child(i int) *packet {
+	if i < len(p.children) {
+		return p.children[i]
+	}
+	return nil
+}
+
+// errMalformed reports a message that does not decode as BER.
+var errMalformed = errors.New("ldap: malformed message")
+
+// readPacket reads an element from a stream.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	n := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7f)
+		if size == 0 || size > 4 {
+			return nil, errMalformed
+		}
+		n = 0
+		for i := 0; i < size; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	if n > maxPacketSize {
+		return nil, errMalformed
+	}
+	content := make([]byte, n)
+	if _, err = io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return parsePacket(tag, content)
+}
+
+// parsePacket decodes the content of an element.
+func parsePacket(tag byte, content []byte) (*packet, error) {
+	p := &packet{tag: tag}
+	if tag&constructed == 0 {
+		p.value = content
+		return p, nil
+	}
+	r := bufio.NewReader(bytes.NewReader(content))
+	for {
+		if _, err := r.Peek(1); err == io.EOF {
+			return p, nil
+		}
+		c, err := readPacket(r)
+		if err != nil {
+			return nil, errMalformed
+		}
+		p.children = append(p.children, c)
+	}
+}
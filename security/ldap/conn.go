@@ -0,0 +1,334 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations of LDAP messages (RFC 4511, section 4.2).
+const (
+	opBindRequest      = classApplication | constructed | 0
+	opBindResponse     = classApplication | constructed | 1
+	opUnbindRequest    = classApplication | 2
+	opSearchRequest    = classApplication | constructed | 3
+	opSearchEntry      = classApplication | constructed | 4
+	opSearchDone       = classApplication | constructed | 5
+	opSearchReference  = classApplication | constructed | 19
+	opExtendedRequest  = classApplication | constructed | 23
+	opExtendedResponse = classApplication | constructed | 24
+)
+
+// Result codes of LDAP operations.
+const (
+	resultSuccess            = 0
+	resultSizeLimitExceeded  = 4
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+)
+
+// Parameters of the operations.
+const (
+	oidStartTLS        = "1.3.6.1.4.1.1466.20037"
+	scopeWholeSubtree  = 2
+	derefNever         = 0
+	searchSizeLimit    = 1000
+	searchTimeLimitSec = 10
+)
+
+// ResultError is an LDAP operation that did not succeed.
+//
+// Fields:
+//   - Code: The result code, e.g. 49 for invalid credentials.
+//   - Message: The diagnostic message of the server.
+type ResultError struct {
+	Code    int
+	Message string
+}
+
+// Error implements the error interface.
+func (e *ResultError) Error() string {
+	return fmt.Sprintf("ldap: result code %d: %s", e.Code, e.Message)
+}
+
+// Entry is an entry returned by a search.
+//
+// Fields:
+//   - DN: The distinguished name of the entry.
+//   - Attributes: The values of the requested attributes, by name as returned by the server.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Values returns the values of an attribute, its name matched case-insensitively.
+func (e *Entry) Values(name string) []string {
+	if v, ok := e.Attributes[name]; ok {
+		return v
+	}
+	for k, v := range e.Attributes {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of an attribute, "" when it has none.
+func (e *Entry) Value(name string) string {
+	if v := e.Values(name); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// errServerClosed reports the notice of disconnection of a server.
+var errServerClosed = errors.New("ldap: the server closed the connection")
+
+// conn is a connection to an LDAP server, running one operation at a time.
+type conn struct {
+	nc      net.Conn
+	r       *bufio.Reader
+	msgID   int64
+	timeout time.Duration
+}
+
+// dial connects to the server of an ldap:// or ldaps:// URL, upgrading ldap:// connections
+// with StartTLS when asked to.
+func dial(ctx context.Context, u *url.URL, tlsConfig *tls.Config, startTLS bool, timeout time.Duration) (*conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "ldaps" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+	}
+	cfg := tlsConfig.Clone()
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = u.Hostname()
+	}
+	dialer := &net.Dialer{Timeout: timeout}
+	var nc net.Conn
+	var err error
+	switch u.Scheme {
+	case "ldaps":
+		nc, err = (&tls.Dialer{NetDialer: dialer, Config: cfg}).DialContext(ctx, "tcp", host)
+	case "ldap":
+		nc, err = dialer.DialContext(ctx, "tcp", host)
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, r: bufio.NewReader(nc), timeout: timeout}
+	if startTLS && u.Scheme == "ldap" {
+		if err = c.startTLS(ctx, cfg); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// startTLS upgrades the connection to TLS with the StartTLS extended operation.
+func (c *conn) startTLS(ctx context.Context, cfg *tls.Config) error {
+	resp, err := c.roundTrip(ctx, seq(opExtendedRequest, str(classContext|0, oidStartTLS)), opExtendedResponse)
+	if err != nil {
+		return err
+	}
+	if err = result(resp); err != nil {
+		return err
+	}
+	tc := tls.Client(c.nc, cfg)
+	hsCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if err = tc.HandshakeContext(hsCtx); err != nil {
+		return err
+	}
+	c.nc = tc
+	c.r = bufio.NewReader(tc)
+	return nil
+}
+
+// bind authenticates the connection with a simple bind; an empty DN and password bind
+// anonymously.
+func (c *conn) bind(ctx context.Context, dn string, password string) error {
+	req := seq(opBindRequest,
+		integer(tagInteger, 3),
+		str(tagOctetString, dn),
+		str(classContext|0, password),
+	)
+	resp, err := c.roundTrip(ctx, req, opBindResponse)
+	if err != nil {
+		return err
+	}
+	return result(resp)
+}
+
+// searchRequest is the part of a search request the package uses.
+type searchRequest struct {
+	baseDN     string
+	scope      int64
+	filter     string
+	attributes []string
+	sizeLimit  int64
+}
+
+// search runs a search and returns its entries, ignoring referrals.
+func (c *conn) search(ctx context.Context, s searchRequest) ([]*Entry, error) {
+	filter, err := compileFilter(s.filter)
+	if err != nil {
+		return nil, err
+	}
+	attrs := seq(tagSequence)
+	for _, a := range s.attributes {
+		attrs.children = append(attrs.children, str(tagOctetString, a))
+	}
+	sizeLimit := s.sizeLimit
+	if sizeLimit <= 0 {
+		sizeLimit = searchSizeLimit
+	}
+	req := seq(opSearchRequest,
+		str(tagOctetString, s.baseDN),
+		integer(tagEnumerated, s.scope),
+		integer(tagEnumerated, derefNever),
+		integer(tagInteger, sizeLimit),
+		integer(tagInteger, searchTimeLimitSec),
+		boolean(tagBoolean, false),
+		filter,
+		attrs,
+	)
+	id, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer c.clearDeadline()
+	var entries []*Entry
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch op.tag {
+		case opSearchEntry:
+			entries = append(entries, parseEntry(op))
+		case opSearchReference:
+		case opSearchDone:
+			if err = result(op); err != nil {
+				return entries, err
+			}
+			return entries, nil
+		default:
+			return nil, errMalformed
+		}
+	}
+}
+
+// parseEntry decodes a SearchResultEntry.
+func parseEntry(op *packet) *Entry {
+	e := &Entry{Attributes: make(map[string][]string)}
+	if dn := op.child(0); dn != nil {
+		e.DN = string(dn.value)
+	}
+	if attrs := op.child(1); attrs != nil {
+		for _, a := range attrs.children {
+			name, vals := a.child(0), a.child(1)
+			if name == nil || vals == nil {
+				continue
+			}
+			for _, v := range vals.children {
+				e.Attributes[string(name.value)] = append(e.Attributes[string(name.value)], string(v.value))
+			}
+		}
+	}
+	return e
+}
+
+// close unbinds and closes the connection.
+func (c *conn) close() {
+	c.msgID++
+	_ = c.nc.SetWriteDeadline(time.Now().Add(time.Second))
+	_, _ = c.nc.Write(seq(tagSequence, integer(tagInteger, c.msgID), &packet{tag: opUnbindRequest}).encode())
+	_ = c.nc.Close()
+}
+
+// roundTrip sends a request and returns its response, which must be of a protocol operation.
+func (c *conn) roundTrip(ctx context.Context, req *packet, want byte) (*packet, error) {
+	id, err := c.send(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer c.clearDeadline()
+	op, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if op.tag != want {
+		return nil, errMalformed
+	}
+	return op, nil
+}
+
+// send writes a request, after setting the deadline of the operation from its context and the
+// timeout of the connection.
+func (c *conn) send(ctx context.Context, req *packet) (int64, error) {
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.nc.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+	c.msgID++
+	_, err := c.nc.Write(seq(tagSequence, integer(tagInteger, c.msgID), req).encode())
+	return c.msgID, err
+}
+
+// receive reads the next message of an operation and returns its protocol operation.
+func (c *conn) receive(id int64) (*packet, error) {
+	for {
+		msg, err := readPacket(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if msg.tag != tagSequence || len(msg.children) < 2 {
+			return nil, errMalformed
+		}
+		// Unsolicited notifications (message ID 0) announce that the server closes the
+		// connection.
+		switch msg.children[0].int() {
+		case id:
+			return msg.children[1], nil
+		case 0:
+			return nil, errServerClosed
+		}
+	}
+}
+
+// clearDeadline removes the deadline of the connection once an operation is over.
+func (c *conn) clearDeadline() {
+	_ = c.nc.SetDeadline(time.Time{})
+}
+
+// result returns the error of an LDAPResult, nil on success.
+func result(op *packet) error {
+	code, msg := op.child(0), op.child(2)
+	if code == nil || msg == nil {
+		return errMalformed
+	}
+	if c := code.int(); c != resultSuccess {
+		return &ResultError{Code: int(c), Message: string(msg.value)}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// EscapeFilter escapes a value for use in a search filter (RFC 4515), so that a username such
+// as "*)(uid=*" cannot change the meaning of the filter.
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Tags of the filter choices (RFC 4511, section 4.5.1.7).
+const (
+	filterAnd        = classContext | constructed | 0
+	filterOr         = classContext | constructed | 1
+	filterNot        = classContext | constructed | 2
+	filterEquality   = classContext | constructed | 3
+	filterSubstrings = classContext | constructed | 4
+	filterGreater    = classContext | constructed | 5
+	filterLess       = classContext | constructed | 6
+	filterPresent    = classContext | 7
+	filterApprox     = classContext | constructed | 8
+	filterExtensible = classContext | constructed | 9
+)
+
+// compileFilter compiles a filter in its string representation (RFC 4515), such as
+// "(&(objectClass=person)(uid=jdoe))", to BER.
+func compileFilter(filter string) (*packet, error) {
+	filter = strings.TrimSpace(filter)
+	if !strings.HasPrefix(filter, "(") {
+		filter = "(" + filter + ")"
+	}
+	p, rest, err := parseFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("ldap: unexpected %q after the filter", rest)
+	}
+	return p, nil
+}
+
+// parseFilter parses a parenthesized filter, returning what follows it.
+func parseFilter(s string) (*packet, string, error) {
+	if len(s) < 2 || s[0] != '(' {
+		return nil, "", fmt.Errorf("ldap: filter %q must start with (", s)
+	}
+	s = s[1:]
+	switch s[0] {
+	case '&', '|':
+		tag := byte(filterAnd)
+		if s[0] == '|' {
+			tag = filterOr
+		}
+		p := seq(tag)
+		s = s[1:]
+		for strings.HasPrefix(s, "(") {
+			child, rest, err := parseFilter(s)
+			if err != nil {
+				return nil, "", err
+			}
+			p.children = append(p.children, child)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", fmt.Errorf("ldap: unterminated filter")
+		}
+		return p, s[1:], nil
+	case '!':
+		child, rest, err := parseFilter(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", fmt.Errorf("ldap: unterminated filter")
+		}
+		return seq(filterNot, child), rest[1:], nil
+	}
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", fmt.Errorf("ldap: unterminated filter")
+	}
+	item, err := parseItem(s[:end])
+	return item, s[end+1:], err
+}
+
+// parseItem parses a simple filter item, such as "uid=jdoe", "cn=J*" or "mail=*".
+func parseItem(s string) (*packet, error) {
+	eq := strings.IndexByte(s, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("ldap: invalid filter item %q", s)
+	}
+	attr, raw := s[:eq], s[eq+1:]
+	tag := byte(filterEquality)
+	switch attr[len(attr)-1] {
+	case '>':
+		tag, attr = filterGreater, attr[:len(attr)-1]
+	case '<':
+		tag, attr = filterLess, attr[:len(attr)-1]
+	case '~':
+		tag, attr = filterApprox, attr[:len(attr)-1]
+	case ':':
+		return parseExtensible(attr[:len(attr)-1], raw)
+	}
+	if tag == filterEquality && raw == "*" {
+		return str(filterPresent, attr), nil
+	}
+	if tag == filterEquality && strings.Contains(raw, "*") {
+		// Substrings: initial*any*...*final, every part optional.
+		parts := strings.Split(raw, "*")
+		subs := seq(tagSequence)
+		for i, part := range parts {
+			if part == "" {
+				continue
+			}
+			v, err := unescapeValue(part)
+			if err != nil {
+				return nil, err
+			}
+			choice := byte(classContext | 1)
+			switch i {
+			case 0:
+				choice = classContext | 0
+			case len(parts) - 1:
+				choice = classContext | 2
+			}
+			subs.children = append(subs.children, str(choice, v))
+		}
+		return seq(filterSubstrings, str(tagOctetString, attr), subs), nil
+	}
+	v, err := unescapeValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	return seq(tag, str(tagOctetString, attr), str(tagOctetString, v)), nil
+}
+
+// parseExtensible parses an extensible match, such as the
+// "memberOf:1.2.840.113556.1.4.1941:=cn=admins,dc=example,dc=com" of Active Directory resolving
+// nested groups.
+func parseExtensible(left string, raw string) (*packet, error) {
+	p := seq(filterExtensible)
+	parts := strings.Split(left, ":")
+	attr, dnAttributes, rule := parts[0], false, ""
+	for _, part := range parts[1:] {
+		if strings.EqualFold(part, "dn") {
+			dnAttributes = true
+		} else {
+			rule = part
+		}
+	}
+	if rule != "" {
+		p.children = append(p.children, str(classContext|1, rule))
+	}
+	if attr != "" {
+		p.children = append(p.children, str(classContext|2, attr))
+	}
+	v, err := unescapeValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	p.children = append(p.children, str(classContext|3, v))
+	if dnAttributes {
+		p.children = append(p.children, boolean(classContext|4, true))
+	}
+	return p, nil
+}
+
+// unescapeValue decodes the \XX escapes of a filter value.
+func unescapeValue(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("ldap: invalid escape in %q", s)
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("ldap: invalid escape in %q", s)
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,110 @@
+package ldap
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/session"
+	"net/http"
+)
+
+// Session keys of the users signed in with Login.
+const (
+	SessionKeyUsername = "ldap_username"
+	SessionKeyRoles    = "roles"
+)
+
+// loginRequest is the body of Login.
+type loginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Login returns the handler signing users in from the JSON body {"username": ...,
+// "password": ...}. It creates the session when a session manager is set, and responds with
+// {"username": ..., "roles": [...]}, or with 401 when the credentials are rejected.
+func (a *Authenticator) Login() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		var req loginRequest
+		if err := ctx.BindAndValidate(&req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		user, err := a.Authenticate(ctx.Request.Context(), req.Username, req.Password)
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		if a.sessions != nil {
+			sess, err := a.sessions.InitSession(ctx)
+			if err == nil {
+				err = sess.Set(ctx.Request.Context(), SessionKeyUsername, user.Username)
+			}
+			if err == nil {
+				err = sess.Set(ctx.Request.Context(), SessionKeyRoles, user.Roles)
+			}
+			if err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+		}
+		if a.onLogin != nil {
+			if err = a.onLogin(ctx, user); err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+		}
+		roles := user.Roles
+		if roles == nil {
+			roles = []string{}
+		}
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{"username": user.Username, "roles": roles})
+	}
+}
+
+// RequireRole returns a middleware admitting the requests whose session holds one of the
+// roles under SessionKeyRoles, as stored by Login. Requests without a session are answered
+// with 401, those without the roles with 403.
+//
+// Parameters:
+//   - m: The session manager of the application.
+//   - roles: The roles admitted.
+func RequireRole(m *session.Manager, roles ...string) mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			sess, err := m.GetSession(ctx)
+			if err != nil {
+				_ = ctx.RespondProblem(mist.Problem{Status: http.StatusUnauthorized})
+				return
+			}
+			val, err := sess.Get(ctx.Request.Context(), SessionKeyRoles)
+			if err == nil && hasRole(val, roles) {
+				next(ctx)
+				return
+			}
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusForbidden})
+		}
+	}
+}
+
+// hasRole reports whether the roles of a session include one of the wanted roles. Stores
+// encoding sessions return the roles as []any.
+func hasRole(val any, wanted []string) bool {
+	var held []string
+	switch v := val.(type) {
+	case []string:
+		held = v
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				held = append(held, s)
+			}
+		}
+	}
+	for _, h := range held {
+		for _, w := range wanted {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,390 @@
+// Package ldap authenticates users against an LDAP directory such as Active Directory or
+// OpenLDAP: it looks the user up with a service account, verifies the password with a bind as
+// the user, resolves the groups of the user and maps them to the roles of the application.
+// Connections are pooled and secured with LDAPS or StartTLS:
+//
+//	auth, err := ldap.InitAuthenticator("ldaps://dc1.corp.example")
+//	...
+//	auth.SetServiceAccount("cn=svc-app,ou=services,dc=corp,dc=example", os.Getenv("LDAP_PASSWORD")).
+//	    SetUserSearch("ou=people,dc=corp,dc=example", "(sAMAccountName={username})").
+//	    SetGroupSearch("ou=groups,dc=corp,dc=example", "(member:1.2.840.113556.1.4.1941:={dn})").
+//	    SetRoleMap(map[string][]string{"app-admins": {"admin"}, "app-users": {"user"}}).
+//	    SetSessionManager(sessionManager)
+//	server.POST("/login", auth.Login())
+//	admin := server.Group("/admin", ldap.RequireRole(sessionManager, "admin"))
+//
+// The protocol is implemented for the operations above only: simple binds, searches and
+// StartTLS. Rate limit the login route, as the directory may lock accounts after repeated
+// failures.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/dormoron/mist"
+	misterrors "github.com/dormoron/mist/errors"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/session"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// User is a user authenticated by the directory.
+//
+// Fields:
+//   - Username: The name the user signed in with.
+//   - DN: The distinguished name of the user entry.
+//   - Attributes: The attributes of the user entry requested with SetAttributes.
+//   - Groups: The distinguished names of the groups of the user.
+//   - Roles: The roles of the application the groups map to, see SetRoleMap.
+type User struct {
+	Username   string
+	DN         string
+	Attributes map[string][]string
+	Groups     []string
+	Roles      []string
+}
+
+// Authenticator authenticates users against a directory.
+type Authenticator struct {
+	url       *url.URL
+	tlsConfig *tls.Config
+	startTLS  bool
+	timeout   time.Duration
+	idle      chan *conn
+
+	bindDN       string
+	bindPassword string
+	userBase     string
+	userFilter   string
+	attributes   []string
+	groupBase    string
+	groupFilter  string
+	groupAttr    string
+	roleMap      map[string][]string
+	sessions     *session.Manager
+	onLogin      func(ctx *mist.Context, user *User) error
+}
+
+// InitAuthenticator creates an Authenticator for a directory, keeping up to 4 idle
+// connections, with a timeout of 5 seconds per operation. Users are searched by "uid" from
+// the root of the directory, anonymously until SetServiceAccount is called, and their groups
+// by "member" or "uniqueMember".
+//
+// Parameters:
+//   - rawURL: The URL of the directory, "ldaps://host[:port]" or "ldap://host[:port]".
+//
+// Returns:
+//   - *Authenticator: The initialized authenticator.
+//   - error: An error if the URL is not an LDAP URL.
+func InitAuthenticator(rawURL string) (*Authenticator, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, errors.New("ldap: the URL must start with ldap:// or ldaps://")
+	}
+	return &Authenticator{
+		url:         u,
+		timeout:     5 * time.Second,
+		idle:        make(chan *conn, 4),
+		userFilter:  "(uid={username})",
+		attributes:  []string{"cn", "mail", "displayName"},
+		groupFilter: "(|(member={dn})(uniqueMember={dn}))",
+	}, nil
+}
+
+// SetTLSConfig sets the TLS configuration of LDAPS and StartTLS connections, e.g. to trust the
+// certificate authority of the directory.
+func (a *Authenticator) SetTLSConfig(cfg *tls.Config) *Authenticator {
+	a.tlsConfig = cfg
+	return a
+}
+
+// SetStartTLS upgrades ldap:// connections to TLS with StartTLS, so that passwords are not
+// sent in clear text.
+func (a *Authenticator) SetStartTLS(enabled bool) *Authenticator {
+	a.startTLS = enabled
+	return a
+}
+
+// SetTimeout sets the timeout of connecting and of each operation.
+func (a *Authenticator) SetTimeout(timeout time.Duration) *Authenticator {
+	a.timeout = timeout
+	return a
+}
+
+// SetPoolSize sets the maximum number of idle connections kept for reuse.
+func (a *Authenticator) SetPoolSize(n int) *Authenticator {
+	a.idle = make(chan *conn, n)
+	return a
+}
+
+// SetServiceAccount sets the account searching the users and groups.
+func (a *Authenticator) SetServiceAccount(dn string, password string) *Authenticator {
+	a.bindDN = dn
+	a.bindPassword = password
+	return a
+}
+
+// SetUserSearch sets where and how users are searched. The filter must match exactly one
+// entry; "{username}" is replaced with the escaped username, e.g. "(sAMAccountName={username})"
+// for Active Directory.
+func (a *Authenticator) SetUserSearch(baseDN string, filter string) *Authenticator {
+	a.userBase = baseDN
+	a.userFilter = filter
+	return a
+}
+
+// SetAttributes sets the attributes of the user entry returned in User.Attributes.
+func (a *Authenticator) SetAttributes(attributes ...string) *Authenticator {
+	a.attributes = attributes
+	return a
+}
+
+// SetGroupSearch sets where and how the groups of a user are searched; "{dn}" and
+// "{username}" are replaced with the escaped DN and username of the user, e.g.
+// "(memberUid={username})" for posixGroup entries.
+func (a *Authenticator) SetGroupSearch(baseDN string, filter string) *Authenticator {
+	a.groupBase = baseDN
+	a.groupFilter = filter
+	a.groupAttr = ""
+	return a
+}
+
+// SetGroupAttribute reads the groups of users from an attribute of their entry, such as
+// "memberOf", in place of searching them.
+func (a *Authenticator) SetGroupAttribute(attribute string) *Authenticator {
+	a.groupAttr = attribute
+	return a
+}
+
+// SetRoleMap maps groups to the roles of the application. Groups are given by DN, or by the
+// value of the first component of their DN, e.g. "admins" for "cn=admins,ou=groups,dc=example";
+// both are compared case-insensitively.
+func (a *Authenticator) SetRoleMap(m map[string][]string) *Authenticator {
+	a.roleMap = m
+	return a
+}
+
+// SetSessionManager sets the session manager creating the session of the users signed in with
+// Login. The session holds the username under SessionKeyUsername and the roles under
+// SessionKeyRoles.
+func (a *Authenticator) SetSessionManager(m *session.Manager) *Authenticator {
+	a.sessions = m
+	return a
+}
+
+// OnLogin sets a function called with every user signed in with Login, after the session is
+// created; an error rejects the sign-in.
+func (a *Authenticator) OnLogin(fn func(ctx *mist.Context, user *User) error) *Authenticator {
+	a.onLogin = fn
+	return a
+}
+
+// Authenticate verifies a username and password against the directory.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - username: The username, matched by the user search filter.
+//   - password: The password of the user.
+//
+// Returns:
+//   - *User: The authenticated user, with its groups and roles.
+//   - error: An error wrapping errors.ErrLDAPInvalidCredentials if the user does not exist or
+//     the password is wrong, or the error of the directory.
+func (a *Authenticator) Authenticate(ctx context.Context, username string, password string) (*User, error) {
+	// An empty password would make an unauthenticated bind, which servers accept.
+	if username == "" || password == "" {
+		return nil, errs.ErrLDAPInvalidCredentials(username)
+	}
+	var user *User
+	err := a.with(ctx, func(c *conn) error {
+		if err := c.bind(ctx, a.bindDN, a.bindPassword); err != nil {
+			return err
+		}
+		attributes := a.attributes
+		if a.groupAttr != "" {
+			attributes = append(append([]string(nil), attributes...), a.groupAttr)
+		}
+		entries, err := c.search(ctx, searchRequest{
+			baseDN:     a.userBase,
+			scope:      scopeWholeSubtree,
+			filter:     expand(a.userFilter, map[string]string{"{username}": username}),
+			attributes: attributes,
+			sizeLimit:  2,
+		})
+		var resultErr *ResultError
+		if errors.As(err, &resultErr) && (resultErr.Code == resultNoSuchObject || resultErr.Code == resultSizeLimitExceeded) {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		// Several matching entries make the username ambiguous, which is refused.
+		if len(entries) != 1 {
+			return errs.ErrLDAPInvalidCredentials(username)
+		}
+		if err = c.bind(ctx, entries[0].DN, password); err != nil {
+			if errors.As(err, &resultErr) && resultErr.Code == resultInvalidCredentials {
+				return errs.ErrLDAPInvalidCredentials(username)
+			}
+			return err
+		}
+		user = &User{Username: username, DN: entries[0].DN, Attributes: entries[0].Attributes}
+		if a.groupAttr != "" {
+			user.Groups = entries[0].Values(a.groupAttr)
+			return nil
+		}
+		// Groups are searched with the service account, users usually cannot read them.
+		if err = c.bind(ctx, a.bindDN, a.bindPassword); err != nil {
+			return err
+		}
+		groups, err := c.search(ctx, searchRequest{
+			baseDN: a.groupBase,
+			scope:  scopeWholeSubtree,
+			filter: expand(a.groupFilter, map[string]string{"{dn}": user.DN, "{username}": username}),
+			// "1.1" asks for no attributes, only the DNs are needed.
+			attributes: []string{"1.1"},
+		})
+		if errors.As(err, &resultErr) && resultErr.Code == resultNoSuchObject {
+			err = nil
+		}
+		for _, g := range groups {
+			user.Groups = append(user.Groups, g.DN)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	user.Roles = a.roles(user.Groups)
+	return user, nil
+}
+
+// Check returns an error if the directory cannot be reached or the service account cannot
+// bind, for readiness probes.
+func (a *Authenticator) Check(ctx context.Context) error {
+	return a.with(ctx, func(c *conn) error {
+		return c.bind(ctx, a.bindDN, a.bindPassword)
+	})
+}
+
+// Close closes the idle connections.
+func (a *Authenticator) Close() {
+	for {
+		select {
+		case c := <-a.idle:
+			c.close()
+		default:
+			return
+		}
+	}
+}
+
+// with runs operations on a pooled connection. Idle connections may have been closed by the
+// server: the operations are retried once on a new connection when a reused one fails.
+func (a *Authenticator) with(ctx context.Context, fn func(c *conn) error) error {
+	for attempt := 0; ; attempt++ {
+		c, reused, err := a.get(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(c)
+		var netErr net.Error
+		var resultErr *ResultError
+		switch {
+		case err == nil || errors.As(err, &resultErr) || errors.Is(err, misterrors.ErrLDAPInvalidCredentials):
+			a.put(c)
+			return err
+		case reused && attempt == 0 && (errors.As(err, &netErr) || errors.Is(err, errMalformed) || isClosed(err)):
+			c.close()
+			continue
+		default:
+			c.close()
+			return err
+		}
+	}
+}
+
+// get returns an idle connection, or a new one.
+func (a *Authenticator) get(ctx context.Context) (*conn, bool, error) {
+	select {
+	case c := <-a.idle:
+		return c, true, nil
+	default:
+	}
+	c, err := dial(ctx, a.url, a.tlsConfig, a.startTLS, a.timeout)
+	return c, false, err
+}
+
+// put returns a connection to the pool, closing it when the pool is full.
+func (a *Authenticator) put(c *conn) {
+	select {
+	case a.idle <- c:
+	default:
+		c.close()
+	}
+}
+
+// roles returns the roles the groups of a user map to, without duplicates.
+func (a *Authenticator) roles(groups []string) []string {
+	var roles []string
+	seen := make(map[string]bool)
+	for key, mapped := range a.roleMap {
+		for _, g := range groups {
+			if !groupMatches(key, g) {
+				continue
+			}
+			for _, r := range mapped {
+				if !seen[r] {
+					seen[r] = true
+					roles = append(roles, r)
+				}
+			}
+			break
+		}
+	}
+	return roles
+}
+
+// groupMatches reports whether a group DN matches a key of the role map: a DN, or the value
+// of the first component of the group DN.
+func groupMatches(key string, dn string) bool {
+	if strings.Contains(key, "=") {
+		return normalizeDN(key) == normalizeDN(dn)
+	}
+	first, _, _ := strings.Cut(dn, ",")
+	_, value, _ := strings.Cut(first, "=")
+	return strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(key))
+}
+
+// normalizeDN lowercases a DN and removes the spaces around its separators.
+func normalizeDN(dn string) string {
+	parts := strings.Split(strings.ToLower(dn), ",")
+	for i, p := range parts {
+		name, value, _ := strings.Cut(p, "=")
+		parts[i] = strings.TrimSpace(name) + "=" + strings.TrimSpace(value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// expand replaces the placeholders of a filter with escaped values.
+func expand(filter string, values map[string]string) string {
+	for placeholder, v := range values {
+		filter = strings.ReplaceAll(filter, placeholder, EscapeFilter(v))
+	}
+	return filter
+}
+
+// isClosed reports whether an error reports a connection closed by the server.
+func isClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, errServerClosed)
+}
@@ -0,0 +1,410 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dormoron/mist"
+	misterrors "github.com/dormoron/mist/errors"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Register registers the endpoints of the provider under the path of the issuer:
+//   - GET /.well-known/openid-configuration: the discovery document,
+//   - GET /oauth2/jwks: the public keys of the tokens,
+//   - GET /oauth2/authorize: the authorization endpoint,
+//   - POST /oauth2/token: the token endpoint,
+//   - GET and POST /oauth2/userinfo: the userinfo endpoint,
+//   - POST /oauth2/introspect: the token introspection endpoint,
+//   - POST /oauth2/revoke: the token revocation endpoint, when the provider has a token store.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - ms: Middleware applied to every route.
+func (p *Provider) Register(server *mist.HTTPServer, ms ...mist.Middleware) {
+	prefix := p.path()
+	wellKnown := server.Group(prefix+"/.well-known", ms...)
+	wellKnown.GET("/openid-configuration", p.Discovery())
+	g := server.Group(prefix+"/oauth2", ms...)
+	g.GET("/jwks", p.JWKS())
+	g.GET("/authorize", p.Authorize())
+	g.POST("/token", p.Token())
+	g.GET("/userinfo", p.UserInfo())
+	g.POST("/userinfo", p.UserInfo())
+	g.POST("/introspect", p.Introspection())
+	if p.tokens != nil {
+		g.POST("/revoke", p.Revocation())
+	}
+}
+
+// Discovery returns the handler of the discovery document.
+func (p *Provider) Discovery() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		doc := map[string]any{
+			"issuer":                                        p.issuer,
+			"authorization_endpoint":                        p.issuer + "/oauth2/authorize",
+			"token_endpoint":                                p.issuer + "/oauth2/token",
+			"userinfo_endpoint":                             p.issuer + "/oauth2/userinfo",
+			"jwks_uri":                                      p.issuer + "/oauth2/jwks",
+			"scopes_supported":                              p.scopes,
+			"response_types_supported":                      []string{"code"},
+			"grant_types_supported":                         []string{"authorization_code"},
+			"subject_types_supported":                       []string{"public"},
+			"id_token_signing_alg_values_supported":         []string{p.method.Alg()},
+			"token_endpoint_auth_methods_supported":         []string{"client_secret_basic", "client_secret_post", "none"},
+			"code_challenge_methods_supported":              []string{"S256"},
+			"claims_supported":                              []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce"},
+			"introspection_endpoint":                        p.issuer + "/oauth2/introspect",
+			"introspection_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		}
+		if p.tokens != nil {
+			doc["revocation_endpoint"] = p.issuer + "/oauth2/revoke"
+			doc["revocation_endpoint_auth_methods_supported"] = []string{"client_secret_basic", "client_secret_post", "none"}
+		}
+		ctx.Header("Cache-Control", "public, max-age=3600")
+		_ = ctx.RespondWithJSON(http.StatusOK, doc)
+	}
+}
+
+// JWKS returns the handler of the JSON Web Key Set of the provider.
+func (p *Provider) JWKS() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		keys := make([]map[string]string, 0, len(p.keys))
+		for _, k := range p.keys {
+			if jwk := publicJWK(k.id, k.key); jwk != nil {
+				keys = append(keys, jwk)
+			}
+		}
+		ctx.Header("Cache-Control", "public, max-age=900")
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{"keys": keys})
+	}
+}
+
+// Authorize returns the handler of the authorization endpoint. Users who are not signed in are
+// redirected to the login URL; signed-in users are redirected back to the client with an
+// authorization code.
+func (p *Provider) Authorize() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		q := ctx.Request.URL.Query()
+		client, err := p.clients.Client(ctx, q.Get("client_id"))
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		redirectURI := q.Get("redirect_uri")
+		// Errors are only redirected to URIs registered by the client, so that the endpoint
+		// cannot be used as an open redirect.
+		if client == nil || !slices.Contains(client.RedirectURIs, redirectURI) {
+			_ = ctx.RespondProblem(mist.Problem{
+				Status: http.StatusBadRequest,
+				Detail: "unknown client_id or unregistered redirect_uri",
+			})
+			return
+		}
+		state := q.Get("state")
+		fail := func(code string, description string) {
+			redirect(ctx, redirectURI, url.Values{"error": {code}, "error_description": {description}, "state": {state}})
+		}
+		if q.Get("response_type") != "code" {
+			fail("unsupported_response_type", "only the code response type is supported")
+			return
+		}
+		scopes := p.allowedScopes(client, strings.Fields(q.Get("scope")))
+		if !slices.Contains(scopes, "openid") {
+			fail("invalid_scope", "the openid scope is required")
+			return
+		}
+		challenge := q.Get("code_challenge")
+		if challenge != "" && q.Get("code_challenge_method") != "S256" {
+			fail("invalid_request", "code_challenge_method must be S256")
+			return
+		}
+		if challenge == "" && client.Secret == "" {
+			fail("invalid_request", "public clients must use PKCE")
+			return
+		}
+
+		userID, authTime := "", time.Time{}
+		if p.currentUser != nil {
+			userID, authTime = p.currentUser(ctx)
+		}
+		if userID == "" {
+			if q.Get("prompt") == "none" || p.loginURL == "" {
+				fail("login_required", "the user is not signed in")
+				return
+			}
+			redirect(ctx, p.loginURL, url.Values{"return_to": {ctx.Request.URL.RequestURI()}})
+			return
+		}
+		if maxAge := q.Get("max_age"); maxAge != "" && !authTime.IsZero() {
+			if seconds, err := strconv.Atoi(maxAge); err == nil && time.Since(authTime) > time.Duration(seconds)*time.Second {
+				fail("login_required", "the authentication is older than max_age")
+				return
+			}
+		}
+
+		code, err := randomToken()
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		data, err := json.Marshal(authorization{
+			ClientID:    client.ID,
+			RedirectURI: redirectURI,
+			UserID:      userID,
+			Scopes:      scopes,
+			Nonce:       q.Get("nonce"),
+			Challenge:   challenge,
+			AuthTime:    authTime,
+		})
+		if err == nil {
+			err = p.backend.Put(ctx, codeKey(code), data, p.codeTTL)
+		}
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		redirect(ctx, redirectURI, url.Values{"code": {code}, "state": {state}})
+	}
+}
+
+// Token returns the handler of the token endpoint, exchanging authorization codes for an
+// access token and an ID token. Clients authenticate with HTTP Basic or the client_id and
+// client_secret form fields; public clients send the PKCE code_verifier instead.
+func (p *Provider) Token() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		if err := ctx.Request.ParseForm(); err != nil {
+			tokenError(ctx, http.StatusBadRequest, "invalid_request", "malformed form body")
+			return
+		}
+		form := ctx.Request.PostForm
+		client, ok := p.authenticateClient(ctx, false)
+		if !ok {
+			return
+		}
+		if form.Get("grant_type") != "authorization_code" {
+			tokenError(ctx, http.StatusBadRequest, "unsupported_grant_type", "only the authorization_code grant is supported")
+			return
+		}
+
+		raw, err := p.backend.Take(ctx, codeKey(form.Get("code")))
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		var auth authorization
+		if raw == nil || json.Unmarshal(raw, &auth) != nil || auth.ClientID != client.ID ||
+			auth.RedirectURI != form.Get("redirect_uri") {
+			tokenError(ctx, http.StatusBadRequest, "invalid_grant", "the code is invalid, expired or was already used")
+			return
+		}
+		if auth.Challenge != "" && !checkChallenge(auth.Challenge, form.Get("code_verifier")) {
+			tokenError(ctx, http.StatusBadRequest, "invalid_grant", "the code_verifier does not match")
+			return
+		}
+
+		access, id, err := p.issueTokens(ctx, &auth)
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{
+			"access_token": access,
+			"token_type":   "Bearer",
+			"expires_in":   int(p.tokenTTL.Seconds()),
+			"id_token":     id,
+			"scope":        strings.Join(auth.Scopes, " "),
+		})
+	}
+}
+
+// Introspection returns the handler of the token introspection endpoint (RFC 7662), answering
+// resource servers with the state of an access token: {"active": false} for tokens that are
+// unknown, expired or revoked. Only confidential clients may introspect tokens.
+func (p *Provider) Introspection() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		if err := ctx.Request.ParseForm(); err != nil {
+			tokenError(ctx, http.StatusBadRequest, "invalid_request", "malformed form body")
+			return
+		}
+		if _, ok := p.authenticateClient(ctx, true); !ok {
+			return
+		}
+		info, err := p.IntrospectToken(ctx, ctx.Request.PostForm.Get("token"))
+		if err != nil {
+			if errors.Is(err, misterrors.ErrOAuthTokenInactive) {
+				_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{"active": false})
+				return
+			}
+			_ = ctx.RespondError(err)
+			return
+		}
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{
+			"active":     true,
+			"scope":      info.Scope,
+			"client_id":  info.ClientID,
+			"sub":        info.Subject,
+			"token_type": "Bearer",
+			"exp":        info.ExpiresAt.Unix(),
+			"iat":        info.IssuedAt.Unix(),
+			"iss":        p.issuer,
+			"aud":        p.issuer,
+			"jti":        info.ID,
+		})
+	}
+}
+
+// Revocation returns the handler of the token revocation endpoint (RFC 7009), through which
+// clients revoke the access tokens issued to them, e.g. when their users sign out. Tokens that
+// are already inactive are answered with 200 as well.
+func (p *Provider) Revocation() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		if err := ctx.Request.ParseForm(); err != nil {
+			tokenError(ctx, http.StatusBadRequest, "invalid_request", "malformed form body")
+			return
+		}
+		client, ok := p.authenticateClient(ctx, false)
+		if !ok {
+			return
+		}
+		token := ctx.Request.PostForm.Get("token")
+		info, err := p.IntrospectToken(ctx, token)
+		if err != nil {
+			if errors.Is(err, misterrors.ErrOAuthTokenInactive) {
+				ctx.RespStatusCode = http.StatusOK
+				return
+			}
+			_ = ctx.RespondError(err)
+			return
+		}
+		if info.ClientID != client.ID {
+			tokenError(ctx, http.StatusBadRequest, "unauthorized_client", "the token was issued to another client")
+			return
+		}
+		if err = p.RevokeToken(ctx, token); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		ctx.RespStatusCode = http.StatusOK
+	}
+}
+
+// UserInfo returns the handler of the userinfo endpoint, answering with the claims of the user
+// of a Bearer access token.
+func (p *Provider) UserInfo() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		token, ok := strings.CutPrefix(ctx.Request.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			ctx.Header("WWW-Authenticate", `Bearer`)
+			ctx.RespStatusCode = http.StatusUnauthorized
+			return
+		}
+		access, err := p.IntrospectToken(ctx, strings.TrimSpace(token))
+		if errors.Is(err, misterrors.ErrOAuthTokenInactive) {
+			ctx.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			ctx.RespStatusCode = http.StatusUnauthorized
+			return
+		}
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		info, err := p.users.Claims(ctx, access.Subject, strings.Fields(access.Scope))
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		if info == nil {
+			info = map[string]any{}
+		}
+		info["sub"] = access.Subject
+		ctx.Header("Cache-Control", "no-store")
+		_ = ctx.RespondWithJSON(http.StatusOK, info)
+	}
+}
+
+// authenticateClient authenticates the client of a request with HTTP Basic or the client_id and
+// client_secret form fields, answering the request with invalid_client when it fails. Public
+// clients, identified by their client_id alone, are rejected when confidential is set.
+func (p *Provider) authenticateClient(ctx *mist.Context, confidential bool) (*Client, bool) {
+	clientID, secret, basic := ctx.Request.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = ctx.Request.PostForm.Get("client_id"), ctx.Request.PostForm.Get("client_secret")
+	}
+	client, err := p.clients.Client(ctx, clientID)
+	if err != nil {
+		_ = ctx.RespondError(err)
+		return nil, false
+	}
+	if client == nil || !checkSecret(client, secret) || (confidential && client.Secret == "") {
+		if basic {
+			ctx.Header("WWW-Authenticate", `Basic realm="oidc"`)
+		}
+		tokenError(ctx, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, false
+	}
+	return client, true
+}
+
+// path returns the path of the issuer URL.
+func (p *Provider) path() string {
+	u, err := url.Parse(p.issuer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// redirect answers a request with a redirection to a URL with query parameters added.
+func redirect(ctx *mist.Context, target string, params url.Values) {
+	for k, v := range params {
+		if len(v) == 0 || v[0] == "" {
+			delete(params, k)
+		}
+	}
+	sep := "?"
+	if strings.Contains(target, "?") {
+		sep = "&"
+	}
+	ctx.Header("Location", target+sep+params.Encode())
+	ctx.RespStatusCode = http.StatusFound
+}
+
+// tokenError answers a token request with an OAuth error.
+func tokenError(ctx *mist.Context, status int, code string, description string) {
+	_ = ctx.RespondWithJSON(status, map[string]string{"error": code, "error_description": description})
+}
+
+// publicJWK returns the JSON Web Key of a public key, nil for unsupported types.
+func publicJWK(id string, key any) map[string]string {
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA", "use": "sig", "alg": "RS256", "kid": id,
+			"n": encode(k.N.Bytes()), "e": encode(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC", "use": "sig", "alg": "ES256", "crv": k.Curve.Params().Name, "kid": id,
+			"x": encode(k.X.FillBytes(make([]byte, size))), "y": encode(k.Y.FillBytes(make([]byte, size))),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+// Package oidc turns a mist application into a minimal OpenID Connect provider, so that
+// internal tools can sign their users in with the accounts of the application. It implements
+// the authorization code flow with PKCE: the authorization endpoint, relying on the sign-in of
+// the application, the token endpoint issuing ID and access tokens, the userinfo endpoint, the
+// token introspection (RFC 7662) and revocation (RFC 7009) endpoints, the JWKS and the discovery
+// document:
+//
+//	key, _ := rsa.GenerateKey(rand.Reader, 2048) // loaded from a secret store in practice
+//	provider, err := oidc.InitProvider("https://id.example", "2026-10", key, users,
+//	    oidc.InitStaticClients(oidc.Client{
+//	        ID:           "grafana",
+//	        Secret:       grafanaSecret,
+//	        RedirectURIs: []string{"https://grafana.example/login/generic_oauth"},
+//	    }),
+//	    flowstate.InitRedisBackend(rdb))
+//	provider.SetCurrentUserFunc(currentUserID).SetLoginURL("/login")
+//	provider.Register(server)
+//
+// Access tokens are JWTs by default. With a token store, they can be revoked, and the provider
+// can issue opaque tokens instead, which resource servers check at the introspection endpoint:
+//
+//	provider.SetTokenStore(oidc.InitRedisTokenStore(rdb)).SetOpaqueTokens(true)
+//
+// Consent is implied: the clients are trusted tools of the same organization. Refresh tokens,
+// dynamic client registration and the implicit and hybrid flows are not supported.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/flowstate"
+	"github.com/golang-jwt/jwt/v5"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Users gives the claims of the users of the application.
+type Users interface {
+	// Claims returns the claims of a user for the granted scopes, such as "email" and
+	// "email_verified" for the email scope or "name" for the profile scope. The sub, iss, aud,
+	// exp, iat, auth_time and nonce claims are set by the provider.
+	Claims(ctx context.Context, userID string, scopes []string) (map[string]any, error)
+}
+
+// Client is a relying party allowed to sign users in.
+//
+// Fields:
+//   - ID: The client_id.
+//   - Secret: The client_secret; empty for public clients, such as single-page applications,
+//     which must use PKCE.
+//   - RedirectURIs: The redirect URIs the client may use, compared exactly.
+//   - Scopes: The scopes the client may request besides openid; empty allows every scope.
+type Client struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+	Scopes       []string
+}
+
+// Clients looks up the clients of the provider.
+type Clients interface {
+	// Client returns the client of an ID, nil when there is none.
+	Client(ctx context.Context, id string) (*Client, error)
+}
+
+// StaticClients is a fixed set of clients, typically from the configuration.
+type StaticClients map[string]*Client
+
+// InitStaticClients creates StaticClients.
+//
+// Parameters:
+//   - clients: The clients.
+//
+// Returns:
+//   - StaticClients: The clients by ID.
+func InitStaticClients(clients ...Client) StaticClients {
+	s := make(StaticClients, len(clients))
+	for i := range clients {
+		s[clients[i].ID] = &clients[i]
+	}
+	return s
+}
+
+// Client returns the client of an ID.
+func (s StaticClients) Client(_ context.Context, id string) (*Client, error) {
+	return s[id], nil
+}
+
+// verificationKey is a public key published in the JWKS.
+type verificationKey struct {
+	id  string
+	key crypto.PublicKey
+}
+
+// Provider is an OpenID Connect provider.
+type Provider struct {
+	issuer  string
+	keyID   string
+	key     crypto.Signer
+	method  jwt.SigningMethod
+	keys    []verificationKey
+	users   Users
+	clients Clients
+	backend flowstate.Backend
+	tokens  TokenStore
+	opaque  bool
+
+	codeTTL     time.Duration
+	tokenTTL    time.Duration
+	scopes      []string
+	loginURL    string
+	currentUser func(ctx *mist.Context) (userID string, authTime time.Time)
+}
+
+// InitProvider creates a Provider issuing authorization codes valid for 1 minute and tokens
+// valid for 1 hour, supporting the openid, profile and email scopes.
+//
+// Parameters:
+//   - issuer: The issuer identifier, the HTTPS URL the endpoints are served under, without a
+//     trailing slash.
+//   - keyID: The ID of the signing key, sent as the kid of the tokens.
+//   - key: The signing key, an *rsa.PrivateKey (RS256) or an *ecdsa.PrivateKey on P-256 (ES256).
+//   - users: The claims of the users.
+//   - clients: The relying parties.
+//   - backend: The store of the authorization codes, e.g. flowstate.InitRedisBackend(rdb) when
+//     several instances serve the provider.
+//
+// Returns:
+//   - *Provider: The initialized provider.
+//   - error: An error if the key is of another type.
+func InitProvider(issuer string, keyID string, key crypto.Signer, users Users, clients Clients, backend flowstate.Backend) (*Provider, error) {
+	var method jwt.SigningMethod
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("oidc: unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("oidc: unsupported signing key type %T", key)
+	}
+	return &Provider{
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		keyID:    keyID,
+		key:      key,
+		method:   method,
+		keys:     []verificationKey{{id: keyID, key: key.Public()}},
+		users:    users,
+		clients:  clients,
+		backend:  backend,
+		codeTTL:  time.Minute,
+		tokenTTL: time.Hour,
+		scopes:   []string{"openid", "profile", "email"},
+	}, nil
+}
+
+// SetTTL sets the validity of the authorization codes and of the tokens.
+func (p *Provider) SetTTL(code time.Duration, token time.Duration) *Provider {
+	p.codeTTL = code
+	p.tokenTTL = token
+	return p
+}
+
+// SetScopes sets the scopes the provider supports, besides openid.
+func (p *Provider) SetScopes(scopes ...string) *Provider {
+	p.scopes = append([]string{"openid"}, scopes...)
+	return p
+}
+
+// SetCurrentUserFunc sets the function returning the signed-in user of a request, e.g. from
+// its session, and when they signed in; "" when nobody is signed in.
+func (p *Provider) SetCurrentUserFunc(fn func(ctx *mist.Context) (userID string, authTime time.Time)) *Provider {
+	p.currentUser = fn
+	return p
+}
+
+// SetLoginURL sets the sign-in page of the application, where the authorization endpoint
+// redirects users who are not signed in, with the URL to come back to in the "return_to" query
+// parameter.
+func (p *Provider) SetLoginURL(u string) *Provider {
+	p.loginURL = u
+	return p
+}
+
+// AddVerificationKey publishes a public key in the JWKS besides the signing key, e.g. the
+// previous key during a rotation, until the tokens it signed expired.
+func (p *Provider) AddVerificationKey(keyID string, key crypto.PublicKey) *Provider {
+	p.keys = append(p.keys, verificationKey{id: keyID, key: key})
+	return p
+}
+
+// Issuer returns the issuer identifier.
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// authorization is the state stored under an authorization code.
+type authorization struct {
+	ClientID    string    `json:"c"`
+	RedirectURI string    `json:"r"`
+	UserID      string    `json:"u"`
+	Scopes      []string  `json:"s"`
+	Nonce       string    `json:"n,omitempty"`
+	Challenge   string    `json:"p,omitempty"`
+	AuthTime    time.Time `json:"t"`
+}
+
+// AccessClaims are the claims of the access tokens of the provider.
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope"`
+}
+
+// VerifyAccessToken verifies a JWT access token issued by the provider, e.g. to protect APIs of
+// the application called by the clients. It does not consult the token store: use
+// IntrospectToken to reject revoked tokens and to accept opaque ones.
+//
+// Parameters:
+//   - token: The access token.
+//
+// Returns:
+//   - *AccessClaims: The claims of the token.
+//   - error: An error if the token is invalid or expired.
+func (p *Provider) VerifyAccessToken(token string) (*AccessClaims, error) {
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return p.key.Public(), nil
+	}, jwt.WithValidMethods([]string{p.method.Alg()}), jwt.WithIssuer(p.issuer),
+		jwt.WithAudience(p.issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// issueTokens returns the access token and the ID token of an authorization.
+func (p *Provider) issueTokens(ctx context.Context, auth *authorization) (string, string, error) {
+	now := time.Now()
+	jti, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	var access string
+	if p.opaque {
+		access, err = p.issueOpaqueToken(ctx, &TokenInfo{
+			ID:        jti,
+			ClientID:  auth.ClientID,
+			Subject:   auth.UserID,
+			Scope:     strings.Join(auth.Scopes, " "),
+			IssuedAt:  now,
+			ExpiresAt: now.Add(p.tokenTTL),
+		})
+	} else {
+		access, err = p.sign(AccessClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    p.issuer,
+				Subject:   auth.UserID,
+				Audience:  jwt.ClaimStrings{p.issuer},
+				ExpiresAt: jwt.NewNumericDate(now.Add(p.tokenTTL)),
+				IssuedAt:  jwt.NewNumericDate(now),
+				ID:        jti,
+			},
+			ClientID: auth.ClientID,
+			Scope:    strings.Join(auth.Scopes, " "),
+		})
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	claims, err := p.users.Claims(ctx, auth.UserID, auth.Scopes)
+	if err != nil {
+		return "", "", err
+	}
+	idClaims := jwt.MapClaims{}
+	for k, v := range claims {
+		idClaims[k] = v
+	}
+	idClaims["iss"] = p.issuer
+	idClaims["sub"] = auth.UserID
+	idClaims["aud"] = auth.ClientID
+	idClaims["exp"] = now.Add(p.tokenTTL).Unix()
+	idClaims["iat"] = now.Unix()
+	if !auth.AuthTime.IsZero() {
+		idClaims["auth_time"] = auth.AuthTime.Unix()
+	}
+	if auth.Nonce != "" {
+		idClaims["nonce"] = auth.Nonce
+	}
+	// at_hash binds the ID token to the access token issued with it.
+	sum := sha256.Sum256([]byte(access))
+	idClaims["at_hash"] = base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+	id, err := p.sign(idClaims)
+	if err != nil {
+		return "", "", err
+	}
+	return access, id, nil
+}
+
+// issueOpaqueToken returns a random access token, stored with its info in the token store.
+func (p *Provider) issueOpaqueToken(ctx context.Context, info *TokenInfo) (string, error) {
+	if p.tokens == nil {
+		return "", errors.New("oidc: opaque access tokens require a token store")
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err = p.tokens.Put(ctx, tokenKey(token), info); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sign signs claims with the signing key.
+func (p *Provider) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(p.method, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+// checkSecret compares the secret presented by a client with its own in constant time.
+func checkSecret(client *Client, secret string) bool {
+	if client.Secret == "" {
+		return secret == ""
+	}
+	want := sha256.Sum256([]byte(client.Secret))
+	got := sha256.Sum256([]byte(secret))
+	return subtle.ConstantTimeCompare(want[:], got[:]) == 1
+}
+
+// checkChallenge verifies a PKCE code verifier against its S256 challenge.
+func checkChallenge(challenge string, verifier string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	return subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(challenge)) == 1
+}
+
+// allowedScopes returns the requested scopes the provider supports and the client may request.
+func (p *Provider) allowedScopes(client *Client, requested []string) []string {
+	var scopes []string
+	for _, scope := range requested {
+		if !slices.Contains(p.scopes, scope) || slices.Contains(scopes, scope) {
+			continue
+		}
+		if scope != "openid" && len(client.Scopes) > 0 && !slices.Contains(client.Scopes, scope) {
+			continue
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+// randomToken returns a random URL-safe token of 256 bits.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// codeKey returns the key of an authorization code in the backend: its hash, so that the store
+// does not hold usable codes.
+func codeKey(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return "oidc:code:" + hex.EncodeToString(sum[:])
+}
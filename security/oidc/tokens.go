@@ -0,0 +1,262 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	misterrors "github.com/dormoron/mist/errors"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/redis/go-redis/v9"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenInfo describes an access token issued by the provider, as answered by the
+// introspection endpoint.
+//
+// Fields:
+//   - ID: The unique identifier of the token, the jti of JWTs.
+//   - ClientID: The client the token was issued to.
+//   - Subject: The user the token was issued for.
+//   - Scope: The granted scopes, separated by spaces.
+//   - IssuedAt: When the token was issued.
+//   - ExpiresAt: When the token expires.
+type TokenInfo struct {
+	ID        string    `json:"jti"`
+	ClientID  string    `json:"client_id"`
+	Subject   string    `json:"sub"`
+	Scope     string    `json:"scope"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// TokenStore keeps the opaque access tokens of the provider and the revoked JWTs, until they
+// expire. The keys are derived from the tokens: the store never holds usable tokens.
+type TokenStore interface {
+	// Put stores info under key until info.ExpiresAt.
+	Put(ctx context.Context, key string, info *TokenInfo) error
+	// Get returns the info of key, nil when it is missing or expired.
+	Get(ctx context.Context, key string) (*TokenInfo, error)
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// SetTokenStore sets the store of the opaque access tokens and of the revocations. Without a
+// store, access tokens cannot be revoked and the revocation endpoint is not served.
+func (p *Provider) SetTokenStore(store TokenStore) *Provider {
+	p.tokens = store
+	return p
+}
+
+// SetOpaqueTokens makes the provider issue opaque access tokens, random strings kept in the
+// token store, instead of JWTs, so that the clients cannot read them and the resource servers
+// must introspect them. It requires a token store.
+func (p *Provider) SetOpaqueTokens(opaque bool) *Provider {
+	p.opaque = opaque
+	return p
+}
+
+// IntrospectToken returns the info of an active access token issued by the provider, opaque or
+// JWT. Unlike VerifyAccessToken, it rejects revoked JWTs.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - token: The access token.
+//
+// Returns:
+//   - *TokenInfo: The info of the token.
+//   - error: An error wrapping errors.ErrOAuthTokenInactive if the token is unknown, expired or
+//     revoked, or the error of the store.
+func (p *Provider) IntrospectToken(ctx context.Context, token string) (*TokenInfo, error) {
+	if !isJWT(token) {
+		if p.tokens == nil {
+			return nil, errs.ErrOAuthTokenInactive("unknown token")
+		}
+		info, err := p.tokens.Get(ctx, tokenKey(token))
+		if err != nil {
+			return nil, err
+		}
+		if info == nil || !time.Now().Before(info.ExpiresAt) {
+			return nil, errs.ErrOAuthTokenInactive("unknown, expired or revoked token")
+		}
+		return info, nil
+	}
+	claims, err := p.VerifyAccessToken(token)
+	if err != nil {
+		return nil, errs.ErrOAuthTokenInactive(err.Error())
+	}
+	info := &TokenInfo{
+		ID:        claims.ID,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		Scope:     claims.Scope,
+		IssuedAt:  claims.IssuedAt.Time,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if p.tokens != nil && info.ID != "" {
+		revoked, err := p.tokens.Get(ctx, revokedKey(info.ID))
+		if err != nil {
+			return nil, err
+		}
+		if revoked != nil {
+			return nil, errs.ErrOAuthTokenInactive("revoked token")
+		}
+	}
+	return info, nil
+}
+
+// RevokeToken revokes an access token issued by the provider: opaque tokens are deleted from
+// the token store, JWTs are recorded as revoked until they expire. Revoking an inactive token
+// does nothing.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - token: The access token.
+//
+// Returns:
+//   - error: An error if the provider has no token store, or the error of the store.
+func (p *Provider) RevokeToken(ctx context.Context, token string) error {
+	if p.tokens == nil {
+		return errors.New("oidc: revoking tokens requires a token store")
+	}
+	info, err := p.IntrospectToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, misterrors.ErrOAuthTokenInactive) {
+			return nil
+		}
+		return err
+	}
+	if isJWT(token) {
+		return p.tokens.Put(ctx, revokedKey(info.ID), info)
+	}
+	return p.tokens.Delete(ctx, tokenKey(token))
+}
+
+// isJWT reports whether a token is a JWT rather than an opaque token, which has no dots.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// tokenKey returns the key of an opaque access token in the token store.
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "oidc:token:" + hex.EncodeToString(sum[:])
+}
+
+// revokedKey returns the key of a revoked JWT in the token store.
+func revokedKey(id string) string {
+	return "oidc:revoked:" + id
+}
+
+// MemoryTokenStore is a TokenStore local to the process, for providers served by a single
+// instance.
+type MemoryTokenStore struct {
+	mutex     sync.Mutex
+	entries   map[string]TokenInfo
+	lastSweep time.Time
+}
+
+// InitMemoryTokenStore creates an empty MemoryTokenStore. Expired entries are purged as new
+// ones are stored.
+//
+// Returns:
+//   - *MemoryTokenStore: The initialized store.
+func InitMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{entries: make(map[string]TokenInfo), lastSweep: time.Now()}
+}
+
+// Put stores info under key until info.ExpiresAt.
+func (s *MemoryTokenStore) Put(_ context.Context, key string, info *TokenInfo) error {
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.Sub(s.lastSweep) >= time.Minute {
+		for k, e := range s.entries {
+			if !now.Before(e.ExpiresAt) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	s.entries[key] = *info
+	return nil
+}
+
+// Get returns the info of key, nil when it is missing or expired.
+func (s *MemoryTokenStore) Get(_ context.Context, key string) (*TokenInfo, error) {
+	s.mutex.Lock()
+	e, ok := s.entries[key]
+	s.mutex.Unlock()
+	if !ok || !time.Now().Before(e.ExpiresAt) {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// Delete removes key.
+func (s *MemoryTokenStore) Delete(_ context.Context, key string) error {
+	s.mutex.Lock()
+	delete(s.entries, key)
+	s.mutex.Unlock()
+	return nil
+}
+
+// RedisTokenStore is a TokenStore shared by the instances of a provider through Redis.
+type RedisTokenStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// InitRedisTokenStore creates a RedisTokenStore. Keys are prefixed with "mist:".
+//
+// Parameters:
+//   - client: The Redis client.
+//
+// Returns:
+//   - *RedisTokenStore: The initialized store.
+func InitRedisTokenStore(client redis.Cmdable) *RedisTokenStore {
+	return &RedisTokenStore{client: client, prefix: "mist:"}
+}
+
+// SetKeyPrefix sets the prefix of the Redis keys of the store.
+func (s *RedisTokenStore) SetKeyPrefix(prefix string) *RedisTokenStore {
+	s.prefix = prefix
+	return s
+}
+
+// Put stores info under key, expiring at info.ExpiresAt.
+func (s *RedisTokenStore) Put(ctx context.Context, key string, info *TokenInfo) error {
+	ttl := time.Until(info.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
+
+// Get returns the info of key, nil when it is missing or expired.
+func (s *RedisTokenStore) Get(ctx context.Context, key string) (*TokenInfo, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	info := &TokenInfo{}
+	if err = json.Unmarshal(data, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Delete removes key.
+func (s *RedisTokenStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
@@ -0,0 +1,124 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/dormoron/mist"
+	"net/http"
+	"strings"
+)
+
+// Namespaces and bindings of SAML 2.0.
+const (
+	nsAssertion     = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsProtocol      = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsMetadata      = "urn:oasis:names:tc:SAML:2.0:metadata"
+	bindingRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingPOST     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	statusSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmBearer   = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+)
+
+// Formats of the NameID of the principal, see SetNameIDFormat.
+const (
+	NameIDEmail       = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDPersistent  = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDTransient   = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+	NameIDUnspecified = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// IdentityProvider describes the identity provider the service provider trusts.
+//
+// Fields:
+//   - EntityID: The entity ID of the provider, the Issuer of its responses.
+//   - SSOURL: The single sign-on URL of the HTTP-Redirect binding.
+//   - Certificates: The signing certificates of the provider; several during a rotation.
+type IdentityProvider struct {
+	EntityID     string
+	SSOURL       string
+	Certificates []*x509.Certificate
+}
+
+// ParseIdPMetadata reads an IdentityProvider from the metadata published by the identity
+// provider, such as the federation metadata of Entra ID or the metadata URL of Okta.
+//
+// Parameters:
+//   - data: The XML metadata, with an EntityDescriptor and an IDPSSODescriptor.
+//
+// Returns:
+//   - *IdentityProvider: The identity provider.
+//   - error: An error if the metadata is malformed or lacks a redirect SSO URL or a signing
+//     certificate.
+func ParseIdPMetadata(data []byte) (*IdentityProvider, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+	var entity *node
+	root.walk(func(e *node) {
+		if entity == nil && e.is(nsMetadata, "EntityDescriptor") && e.child(nsMetadata, "IDPSSODescriptor") != nil {
+			entity = e
+		}
+	})
+	if entity == nil {
+		return nil, errors.New("saml: no identity provider in the metadata")
+	}
+	idp := &IdentityProvider{EntityID: entity.attr("entityID")}
+	descriptor := entity.child(nsMetadata, "IDPSSODescriptor")
+	for _, c := range descriptor.children {
+		e, ok := c.(*node)
+		if !ok {
+			continue
+		}
+		switch {
+		case e.is(nsMetadata, "SingleSignOnService") && e.attr("Binding") == bindingRedirect && idp.SSOURL == "":
+			idp.SSOURL = e.attr("Location")
+		case e.is(nsMetadata, "KeyDescriptor") && e.attr("use") != "encryption":
+			var certErr error
+			e.walk(func(k *node) {
+				if !k.is(nsDSig, "X509Certificate") || certErr != nil {
+					return
+				}
+				der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(k.text()), ""))
+				if err != nil {
+					certErr = err
+					return
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					certErr = err
+					return
+				}
+				idp.Certificates = append(idp.Certificates, cert)
+			})
+			if certErr != nil {
+				return nil, fmt.Errorf("saml: invalid certificate in the metadata: %w", certErr)
+			}
+		}
+	}
+	if idp.SSOURL == "" || len(idp.Certificates) == 0 {
+		return nil, errors.New("saml: the metadata lacks an HTTP-Redirect SSO URL or a signing certificate")
+	}
+	return idp, nil
+}
+
+// Metadata returns the handler of the metadata of the service provider, to register it with
+// the identity provider.
+func (sp *ServiceProvider) Metadata() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+		b.WriteString(`<md:EntityDescriptor xmlns:md="` + nsMetadata + `" entityID="` + escapeAttr(sp.entityID) + `">`)
+		b.WriteString(`<md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" ` +
+			`protocolSupportEnumeration="` + nsProtocol + `">`)
+		b.WriteString(`<md:NameIDFormat>` + escapeText(sp.nameIDFormat) + `</md:NameIDFormat>`)
+		b.WriteString(`<md:AssertionConsumerService Binding="` + bindingPOST + `" Location="` +
+			escapeAttr(sp.acsURL) + `" index="0" isDefault="true"/>`)
+		b.WriteString(`</md:SPSSODescriptor></md:EntityDescriptor>`)
+		ctx.Header("Content-Type", "application/samlmetadata+xml")
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = []byte(b.String())
+	}
+}
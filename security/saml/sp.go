@@ -0,0 +1,528 @@
+// Package saml implements the service provider side of SAML 2.0 single sign-on, for
+// enterprises whose users sign in through an identity provider such as Entra ID, Okta or AD FS.
+// The service provider publishes its metadata, starts sign-ins with the HTTP-Redirect binding,
+// and validates the responses posted to its assertion consumer service: signature, issuer,
+// audience, recipient, validity period, request correlation and replay. The attributes of the
+// signed-in user are mapped to a Principal and stored in the session:
+//
+//	idp, err := saml.ParseIdPMetadata(metadataXML)
+//	...
+//	sp := saml.InitServiceProvider("https://app.example/saml", "https://app.example/saml/acs", idp,
+//	    flowstate.InitRedisBackend(rdb)).
+//	    SetReplayStore(throttle.InitRedisStore(rdb)).
+//	    SetAttributeMap(map[string]string{
+//	        "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress": "email",
+//	        "http://schemas.microsoft.com/ws/2008/06/identity/claims/groups":     "groups",
+//	    }).
+//	    SetSessionManager(sessionManager)
+//	sp.Register(server, "/saml")
+//
+// Encrypted assertions and single logout are not supported.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/flowstate"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/security/throttle"
+	"github.com/dormoron/mist/session"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Principal is the user signed in by the identity provider.
+//
+// Fields:
+//   - NameID: The identifier of the user at the identity provider.
+//   - NameIDFormat: The format of NameID.
+//   - SessionIndex: The session of the user at the identity provider.
+//   - Attributes: The attributes of the assertion, by their mapped names, see SetAttributeMap.
+type Principal struct {
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string][]string
+}
+
+// Attribute returns the first value of an attribute, "" when it is missing.
+func (p *Principal) Attribute(name string) string {
+	if values := p.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Session keys of the principal, see SetSessionManager.
+const (
+	SessionKeyNameID       = "saml_name_id"
+	SessionKeySessionIndex = "saml_session_index"
+)
+
+// ServiceProvider is a SAML 2.0 service provider trusting one identity provider.
+type ServiceProvider struct {
+	entityID     string
+	acsURL       string
+	idp          *IdentityProvider
+	backend      flowstate.Backend
+	replay       throttle.Store
+	sessions     *session.Manager
+	nameIDFormat string
+	attributeMap map[string]string
+	skew         time.Duration
+	requestTTL   time.Duration
+	allowSHA1    bool
+	idpInitiated bool
+	redirectURL  string
+	onLogin      func(ctx *mist.Context, p *Principal) error
+}
+
+// InitServiceProvider creates a ServiceProvider requesting email NameIDs, accepting a clock
+// skew of 2 minutes and sign-ins completed within 10 minutes. Attributes keep their SAML names
+// until SetAttributeMap is called, and users are redirected to "/" once signed in.
+//
+// Parameters:
+//   - entityID: The entity ID of the service provider, usually the URL of its metadata.
+//   - acsURL: The absolute URL of the assertion consumer service, where responses are posted.
+//   - idp: The trusted identity provider.
+//   - backend: The store of the pending sign-in requests, shared by the instances.
+//
+// Returns:
+//   - *ServiceProvider: The initialized service provider.
+func InitServiceProvider(entityID string, acsURL string, idp *IdentityProvider, backend flowstate.Backend) *ServiceProvider {
+	return &ServiceProvider{
+		entityID:     entityID,
+		acsURL:       acsURL,
+		idp:          idp,
+		backend:      backend,
+		nameIDFormat: NameIDEmail,
+		skew:         2 * time.Minute,
+		requestTTL:   10 * time.Minute,
+		redirectURL:  "/",
+	}
+}
+
+// SetAttributeMap maps the names of SAML attributes to the names of the Principal attributes;
+// attributes that are not mapped are dropped.
+func (sp *ServiceProvider) SetAttributeMap(m map[string]string) *ServiceProvider {
+	sp.attributeMap = m
+	return sp
+}
+
+// SetNameIDFormat sets the NameID format requested from the identity provider.
+func (sp *ServiceProvider) SetNameIDFormat(format string) *ServiceProvider {
+	sp.nameIDFormat = format
+	return sp
+}
+
+// SetClockSkew sets the clock difference with the identity provider tolerated when checking
+// validity periods.
+func (sp *ServiceProvider) SetClockSkew(skew time.Duration) *ServiceProvider {
+	sp.skew = skew
+	return sp
+}
+
+// SetReplayStore sets the store recording the IDs of the accepted assertions until they
+// expire, so that a captured response cannot be posted again.
+func (sp *ServiceProvider) SetReplayStore(store throttle.Store) *ServiceProvider {
+	sp.replay = store
+	return sp
+}
+
+// SetAllowSHA1 accepts signatures and digests using SHA-1, for identity providers that
+// cannot be configured for SHA-256.
+func (sp *ServiceProvider) SetAllowSHA1(allow bool) *ServiceProvider {
+	sp.allowSHA1 = allow
+	return sp
+}
+
+// SetAllowIdPInitiated accepts responses that were not requested by the service provider,
+// such as sign-ins started from the application portal of the identity provider. They are
+// more exposed to replay, set a replay store with them.
+func (sp *ServiceProvider) SetAllowIdPInitiated(allow bool) *ServiceProvider {
+	sp.idpInitiated = allow
+	return sp
+}
+
+// SetRedirectURL sets where users go once signed in, unless the sign-in was started with a
+// "return_to" path.
+func (sp *ServiceProvider) SetRedirectURL(u string) *ServiceProvider {
+	sp.redirectURL = u
+	return sp
+}
+
+// SetSessionManager sets the session manager creating the session of the signed-in users. The
+// session holds the NameID and the session index under SessionKeyNameID and
+// SessionKeySessionIndex, and each mapped attribute under its name as a []string.
+func (sp *ServiceProvider) SetSessionManager(m *session.Manager) *ServiceProvider {
+	sp.sessions = m
+	return sp
+}
+
+// OnLogin sets a function called with the principal of every accepted response, after the
+// session is created; an error rejects the sign-in, e.g. for users without an account.
+func (sp *ServiceProvider) OnLogin(fn func(ctx *mist.Context, p *Principal) error) *ServiceProvider {
+	sp.onLogin = fn
+	return sp
+}
+
+// Register registers the routes of the service provider under a prefix:
+//   - GET {prefix}/metadata: Metadata,
+//   - GET {prefix}/login: Login,
+//   - POST {prefix}/acs: ACS, whose URL must be the one given to InitServiceProvider.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the routes, e.g. "/saml".
+//   - ms: Middleware applied to every route.
+func (sp *ServiceProvider) Register(server *mist.HTTPServer, prefix string, ms ...mist.Middleware) {
+	g := server.Group(prefix, ms...)
+	g.GET("/metadata", sp.Metadata())
+	g.GET("/login", sp.Login())
+	g.POST("/acs", sp.ACS())
+}
+
+// pendingRequest is a sign-in request waiting for its response.
+type pendingRequest struct {
+	ReturnTo string `json:"r,omitempty"`
+}
+
+// Login returns the handler starting a sign-in: it redirects to the identity provider with an
+// authentication request, and remembers the local path of the "return_to" query parameter.
+func (sp *ServiceProvider) Login() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		id, err := newID()
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		data, _ := json.Marshal(pendingRequest{ReturnTo: localPath(ctx.QueryValue("return_to").StringOrDefault(""))})
+		if err = sp.backend.Put(ctx, requestKey(id), data, sp.requestTTL); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		target, err := sp.authnRequestURL(id, time.Now())
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Location", target)
+		ctx.RespStatusCode = http.StatusFound
+	}
+}
+
+// ACS returns the handler of the assertion consumer service: it validates the posted response,
+// creates the session and redirects to the page the sign-in was started from. Rejected
+// responses are answered with 401.
+func (sp *ServiceProvider) ACS() mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		principal, returnTo, err := sp.ParseResponse(ctx, ctx.FormValue("SAMLResponse").StringOrDefault(""))
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		if sp.sessions != nil {
+			sess, err := sp.sessions.InitSession(ctx)
+			if err == nil {
+				err = storePrincipal(ctx, sess, principal)
+			}
+			if err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+		}
+		if sp.onLogin != nil {
+			if err = sp.onLogin(ctx, principal); err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+		}
+		if returnTo == "" {
+			returnTo = sp.redirectURL
+		}
+		ctx.Header("Location", returnTo)
+		ctx.RespStatusCode = http.StatusSeeOther
+	}
+}
+
+// ParseResponse validates a base64 encoded SAML response, as posted to the assertion consumer
+// service, and returns its principal.
+//
+// Parameters:
+//   - ctx: The context of the operation.
+//   - encoded: The value of the SAMLResponse form field.
+//
+// Returns:
+//   - *Principal: The signed-in user.
+//   - string: The local path the sign-in was started from, "" when unknown.
+//   - error: An error wrapping errors.ErrSAMLResponseInvalid if the response is rejected.
+func (sp *ServiceProvider) ParseResponse(ctx context.Context, encoded string) (*Principal, string, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, "", errs.ErrSAMLResponseInvalid("malformed encoding")
+	}
+	root, err := parseXML(raw)
+	if err != nil {
+		return nil, "", errs.ErrSAMLResponseInvalid(err.Error())
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, "", errs.ErrSAMLResponseInvalid("not a Response")
+	}
+	// A single assertion anywhere in the document leaves no room for wrapping a forged one.
+	var assertions []*node
+	root.walk(func(e *node) {
+		if e.local == "Assertion" || e.local == "EncryptedAssertion" {
+			assertions = append(assertions, e)
+		}
+	})
+	if len(assertions) != 1 || !assertions[0].is(nsAssertion, "Assertion") {
+		return nil, "", errs.ErrSAMLResponseInvalid("expected exactly one unencrypted assertion")
+	}
+
+	// The assertion is read from the signed content only: that of the response when it is
+	// signed, that of the assertion otherwise.
+	var assertion *node
+	responseContent, responseSigned, err := verifySignature(root, sp.idp.Certificates, sp.allowSHA1)
+	if err != nil {
+		return nil, "", errs.ErrSAMLResponseInvalid(err.Error())
+	}
+	if responseSigned {
+		if root, err = parseXML(responseContent); err != nil {
+			return nil, "", errs.ErrSAMLResponseInvalid(err.Error())
+		}
+		assertion = root.child(nsAssertion, "Assertion")
+	}
+	assertionContent, assertionSigned, err := verifySignature(assertions[0], sp.idp.Certificates, sp.allowSHA1)
+	if err != nil {
+		return nil, "", errs.ErrSAMLResponseInvalid(err.Error())
+	}
+	if assertionSigned && assertion == nil {
+		if assertion, err = parseXML(assertionContent); err != nil {
+			return nil, "", errs.ErrSAMLResponseInvalid(err.Error())
+		}
+	}
+	if assertion == nil {
+		return nil, "", errs.ErrSAMLResponseInvalid("neither the response nor the assertion is signed")
+	}
+	return sp.validate(ctx, root, responseSigned, assertion, time.Now())
+}
+
+// validate checks the conditions of a response and of its signed assertion. The InResponseTo of
+// the response is only trusted when responseSigned is set: otherwise anyone can wrap a captured
+// assertion in a response answering a pending request.
+func (sp *ServiceProvider) validate(ctx context.Context, response *node, responseSigned bool, assertion *node, now time.Time) (*Principal, string, error) {
+	if dest := response.attr("Destination"); dest != "" && dest != sp.acsURL {
+		return nil, "", errs.ErrSAMLResponseInvalid("wrong destination " + dest)
+	}
+	if status := response.child(nsProtocol, "Status"); status == nil ||
+		status.child(nsProtocol, "StatusCode") == nil ||
+		status.child(nsProtocol, "StatusCode").attr("Value") != statusSuccess {
+		return nil, "", errs.ErrSAMLResponseInvalid("the identity provider did not sign the user in")
+	}
+	if issuer := assertion.child(nsAssertion, "Issuer"); issuer == nil || strings.TrimSpace(issuer.text()) != sp.idp.EntityID {
+		return nil, "", errs.ErrSAMLResponseInvalid("wrong issuer")
+	}
+
+	conditions := assertion.child(nsAssertion, "Conditions")
+	if conditions == nil {
+		return nil, "", errs.ErrSAMLResponseInvalid("missing conditions")
+	}
+	if !sp.within(conditions.attr("NotBefore"), conditions.attr("NotOnOrAfter"), now) {
+		return nil, "", errs.ErrSAMLResponseInvalid("assertion outside its validity period")
+	}
+	audienceOK := false
+	for _, c := range conditions.children {
+		if r, ok := c.(*node); ok && r.is(nsAssertion, "AudienceRestriction") {
+			audienceOK = false
+			for _, a := range r.children {
+				if e, ok := a.(*node); ok && e.is(nsAssertion, "Audience") && strings.TrimSpace(e.text()) == sp.entityID {
+					audienceOK = true
+				}
+			}
+			if !audienceOK {
+				break
+			}
+		}
+	}
+	if !audienceOK {
+		return nil, "", errs.ErrSAMLResponseInvalid("wrong audience")
+	}
+
+	subject := assertion.child(nsAssertion, "Subject")
+	if subject == nil || subject.child(nsAssertion, "NameID") == nil {
+		return nil, "", errs.ErrSAMLResponseInvalid("missing subject")
+	}
+	var confirmation *node
+	for _, c := range subject.children {
+		e, ok := c.(*node)
+		if !ok || !e.is(nsAssertion, "SubjectConfirmation") || e.attr("Method") != confirmBearer {
+			continue
+		}
+		data := e.child(nsAssertion, "SubjectConfirmationData")
+		// A bearer confirmation without an expiry would stay valid forever.
+		if data != nil && data.attr("Recipient") == sp.acsURL && data.attr("NotOnOrAfter") != "" &&
+			sp.within("", data.attr("NotOnOrAfter"), now) {
+			confirmation = data
+			break
+		}
+	}
+	if confirmation == nil {
+		return nil, "", errs.ErrSAMLResponseInvalid("no valid bearer subject confirmation")
+	}
+
+	returnTo := ""
+	inResponseTo := confirmation.attr("InResponseTo")
+	if inResponseTo == "" && responseSigned {
+		inResponseTo = response.attr("InResponseTo")
+	}
+	if inResponseTo != "" {
+		raw, err := sp.backend.Take(ctx, requestKey(inResponseTo))
+		if err != nil {
+			return nil, "", err
+		}
+		var pending pendingRequest
+		if raw == nil || json.Unmarshal(raw, &pending) != nil {
+			return nil, "", errs.ErrSAMLResponseInvalid("unknown or already answered request")
+		}
+		returnTo = pending.ReturnTo
+	} else if !sp.idpInitiated {
+		return nil, "", errs.ErrSAMLResponseInvalid("unsolicited response")
+	}
+
+	if sp.replay != nil {
+		id := assertion.attr("ID")
+		expiry, err := time.Parse(time.RFC3339, confirmation.attr("NotOnOrAfter"))
+		if err != nil || id == "" {
+			return nil, "", errs.ErrSAMLResponseInvalid("assertion without ID or expiry")
+		}
+		count, err := sp.replay.Incr(ctx, "saml:assertion:"+id, time.Until(expiry)+sp.skew)
+		if err != nil {
+			return nil, "", err
+		}
+		if count > 1 {
+			return nil, "", errs.ErrSAMLResponseInvalid("replayed assertion")
+		}
+	}
+
+	nameID := subject.child(nsAssertion, "NameID")
+	principal := &Principal{
+		NameID:       strings.TrimSpace(nameID.text()),
+		NameIDFormat: nameID.attr("Format"),
+		Attributes:   make(map[string][]string),
+	}
+	if authn := assertion.child(nsAssertion, "AuthnStatement"); authn != nil {
+		principal.SessionIndex = authn.attr("SessionIndex")
+	}
+	if statement := assertion.child(nsAssertion, "AttributeStatement"); statement != nil {
+		for _, c := range statement.children {
+			attr, ok := c.(*node)
+			if !ok || !attr.is(nsAssertion, "Attribute") {
+				continue
+			}
+			name := attr.attr("Name")
+			if sp.attributeMap != nil {
+				if name, ok = sp.attributeMap[name]; !ok {
+					continue
+				}
+			}
+			for _, v := range attr.children {
+				if e, ok := v.(*node); ok && e.is(nsAssertion, "AttributeValue") {
+					principal.Attributes[name] = append(principal.Attributes[name], strings.TrimSpace(e.text()))
+				}
+			}
+		}
+	}
+	return principal, returnTo, nil
+}
+
+// within reports whether now is within a validity period, widened by the clock skew; empty
+// bounds are open.
+func (sp *ServiceProvider) within(notBefore string, notOnOrAfter string, now time.Time) bool {
+	if notBefore != "" {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil || now.Add(sp.skew).Before(t) {
+			return false
+		}
+	}
+	if notOnOrAfter != "" {
+		t, err := time.Parse(time.RFC3339, notOnOrAfter)
+		if err != nil || !now.Add(-sp.skew).Before(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// authnRequestURL returns the URL of the identity provider carrying an authentication request
+// with the HTTP-Redirect binding.
+func (sp *ServiceProvider) authnRequestURL(id string, now time.Time) (string, error) {
+	request := `<samlp:AuthnRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion +
+		`" ID="` + id + `" Version="2.0" IssueInstant="` + now.UTC().Format(time.RFC3339) +
+		`" Destination="` + escapeAttr(sp.idp.SSOURL) + `" AssertionConsumerServiceURL="` + escapeAttr(sp.acsURL) +
+		`" ProtocolBinding="` + bindingPOST + `"><saml:Issuer>` + escapeText(sp.entityID) + `</saml:Issuer>` +
+		`<samlp:NameIDPolicy Format="` + escapeAttr(sp.nameIDFormat) + `" AllowCreate="true"/></samlp:AuthnRequest>`
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write([]byte(request)); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	params := url.Values{"SAMLRequest": {base64.StdEncoding.EncodeToString(buf.Bytes())}, "RelayState": {id}}
+	sep := "?"
+	if strings.Contains(sp.idp.SSOURL, "?") {
+		sep = "&"
+	}
+	return sp.idp.SSOURL + sep + params.Encode(), nil
+}
+
+// storePrincipal stores a principal in a session.
+func storePrincipal(ctx context.Context, sess session.Session, p *Principal) error {
+	if err := sess.Set(ctx, SessionKeyNameID, p.NameID); err != nil {
+		return err
+	}
+	if err := sess.Set(ctx, SessionKeySessionIndex, p.SessionIndex); err != nil {
+		return err
+	}
+	for name, values := range p.Attributes {
+		if err := sess.Set(ctx, name, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newID returns the ID of a request; IDs must not start with a digit.
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+// requestKey returns the key of a pending request in the backend.
+func requestKey(id string) string {
+	return "saml:request:" + id
+}
+
+// localPath returns a path of the application, rejecting URLs that would redirect elsewhere.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,413 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Namespaces and algorithms of XML signatures.
+const (
+	nsDSig          = "http://www.w3.org/2000/09/xmldsig#"
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algRSASHA1      = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algECDSASHA256  = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algDigestSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+	algDigestSHA1   = "http://www.w3.org/2000/09/xmldsig#sha1"
+)
+
+// node is an element of a parsed XML document, its names and attributes kept with the prefixes
+// they were written with, as canonicalization requires.
+type node struct {
+	prefix   string
+	local    string
+	attrs    []xml.Attr
+	children []any // *node or string
+	parent   *node
+}
+
+// parseXML parses a document into its root element. Documents with a DTD are rejected, as
+// entity declarations can hide content from the signature or exhaust memory.
+func parseXML(data []byte) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+	var root, cur *node
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{prefix: t.Name.Space, local: t.Name.Local, attrs: t.Attr, parent: cur}
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("saml: several root elements")
+				}
+				root = n
+			} else {
+				cur.children = append(cur.children, n)
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil {
+				return nil, errors.New("saml: unbalanced end element")
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, string(t))
+			}
+		case xml.Directive:
+			return nil, errors.New("saml: documents with a DTD are not accepted")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("saml: incomplete document")
+	}
+	return root, nil
+}
+
+// namespace returns the namespace URI bound to a prefix in the scope of a node.
+func (n *node) namespace(prefix string) string {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace"
+	}
+	for e := n; e != nil; e = e.parent {
+		for _, a := range e.attrs {
+			if (prefix == "" && a.Name.Space == "" && a.Name.Local == "xmlns") ||
+				(prefix != "" && a.Name.Space == "xmlns" && a.Name.Local == prefix) {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+// is reports whether a node is the element of a namespace and local name.
+func (n *node) is(space string, local string) bool {
+	return n.local == local && n.namespace(n.prefix) == space
+}
+
+// attr returns the value of an unprefixed attribute.
+func (n *node) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child element of a namespace and local name.
+func (n *node) child(space string, local string) *node {
+	for _, c := range n.children {
+		if e, ok := c.(*node); ok && e.is(space, local) {
+			return e
+		}
+	}
+	return nil
+}
+
+// text returns the concatenated character data of a node.
+func (n *node) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if s, ok := c.(string); ok {
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// walk calls fn for a node and its descendant elements, in document order.
+func (n *node) walk(fn func(e *node)) {
+	fn(n)
+	for _, c := range n.children {
+		if e, ok := c.(*node); ok {
+			e.walk(fn)
+		}
+	}
+}
+
+// canonicalize serializes a node with Exclusive XML Canonicalization without comments, leaving
+// out the element skip (the enveloped signature) and declaring the prefixes of inclusive
+// wherever they are in scope.
+func canonicalize(n *node, skip *node, inclusive []string) []byte {
+	var buf bytes.Buffer
+	writeCanonical(&buf, n, skip, inclusive, map[string]string{})
+	return buf.Bytes()
+}
+
+// writeCanonical writes a node given the namespace declarations rendered by its ancestors.
+func writeCanonical(buf *bytes.Buffer, n *node, skip *node, inclusive []string, rendered map[string]string) {
+	used := []string{n.prefix}
+	for _, a := range n.attrs {
+		if a.Name.Space != "" && a.Name.Space != "xmlns" && a.Name.Space != "xml" {
+			used = append(used, a.Name.Space)
+		}
+	}
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		if n.namespace(p) != "" {
+			used = append(used, p)
+		}
+	}
+	slices.Sort(used)
+	used = slices.Compact(used)
+
+	scope := rendered
+	var decls []string
+	for _, p := range used {
+		uri := n.namespace(p)
+		if prev, ok := rendered[p]; (ok && prev == uri) || (!ok && uri == "") {
+			continue
+		}
+		if len(decls) == 0 {
+			scope = make(map[string]string, len(rendered)+1)
+			for k, v := range rendered {
+				scope[k] = v
+			}
+		}
+		scope[p] = uri
+		if p == "" {
+			decls = append(decls, ` xmlns="`+escapeAttr(uri)+`"`)
+		} else {
+			decls = append(decls, ` xmlns:`+p+`="`+escapeAttr(uri)+`"`)
+		}
+	}
+
+	type attr struct {
+		space, local, name, value string
+	}
+	var attrs []attr
+	for _, a := range n.attrs {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		name := a.Name.Local
+		if a.Name.Space != "" {
+			name = a.Name.Space + ":" + a.Name.Local
+		}
+		space := ""
+		if a.Name.Space != "" {
+			space = n.namespace(a.Name.Space)
+		}
+		attrs = append(attrs, attr{space: space, local: a.Name.Local, name: name, value: a.Value})
+	}
+	// Attributes are sorted by namespace URI then local name, unqualified ones first.
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	qname := n.local
+	if n.prefix != "" {
+		qname = n.prefix + ":" + n.local
+	}
+	buf.WriteString("<" + qname)
+	for _, d := range decls {
+		buf.WriteString(d)
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + a.name + `="` + escapeAttr(a.value) + `"`)
+	}
+	buf.WriteString(">")
+	for _, c := range n.children {
+		switch c := c.(type) {
+		case string:
+			buf.WriteString(escapeText(c))
+		case *node:
+			if c != skip {
+				writeCanonical(buf, c, skip, inclusive, scope)
+			}
+		}
+	}
+	buf.WriteString("</" + qname + ">")
+}
+
+// escapeText escapes character data as canonical XML does.
+func escapeText(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;").Replace(s)
+}
+
+// escapeAttr escapes an attribute value as canonical XML does.
+func escapeAttr(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;").Replace(s)
+}
+
+// verifySignature verifies the enveloped signature of an element against the certificates of
+// the identity provider.
+//
+// Returns:
+//   - []byte: The canonical form of the element without its signature, the only content to
+//     trust: reading the parsed document instead would expose to signature wrapping.
+//   - bool: Whether the element is signed at all.
+//   - error: An error if the signature is present but invalid.
+func verifySignature(el *node, certs []*x509.Certificate, allowSHA1 bool) ([]byte, bool, error) {
+	sig := el.child(nsDSig, "Signature")
+	if sig == nil {
+		return nil, false, nil
+	}
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if signedInfo == nil || sigValue == nil {
+		return nil, true, errors.New("saml: incomplete signature")
+	}
+	c14n := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	method := signedInfo.child(nsDSig, "SignatureMethod")
+	ref := signedInfo.child(nsDSig, "Reference")
+	if c14n == nil || method == nil || ref == nil {
+		return nil, true, errors.New("saml: incomplete signature")
+	}
+	if c14n.attr("Algorithm") != algExcC14N {
+		return nil, true, fmt.Errorf("saml: unsupported canonicalization %q", c14n.attr("Algorithm"))
+	}
+	id := el.attr("ID")
+	if id == "" || ref.attr("URI") != "#"+id {
+		return nil, true, errors.New("saml: the signature does not reference the signed element")
+	}
+	// A single reference, to the element itself, with the transforms of SAML only.
+	references := 0
+	for _, c := range signedInfo.children {
+		if e, ok := c.(*node); ok && e.is(nsDSig, "Reference") {
+			references++
+		}
+	}
+	if references != 1 {
+		return nil, true, errors.New("saml: the signature must have exactly one reference")
+	}
+	var inclusive []string
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, c := range transforms.children {
+			t, ok := c.(*node)
+			if !ok {
+				continue
+			}
+			switch t.attr("Algorithm") {
+			case algEnveloped:
+			case algExcC14N:
+				for _, in := range t.children {
+					if e, ok := in.(*node); ok && e.local == "InclusiveNamespaces" {
+						inclusive = strings.Fields(e.attr("PrefixList"))
+					}
+				}
+			default:
+				return nil, true, fmt.Errorf("saml: unsupported transform %q", t.attr("Algorithm"))
+			}
+		}
+	}
+
+	digestMethod := ref.child(nsDSig, "DigestMethod")
+	digestValue := ref.child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return nil, true, errors.New("saml: incomplete reference")
+	}
+	hash, err := hashOf(digestMethod.attr("Algorithm"), allowSHA1)
+	if err != nil {
+		return nil, true, err
+	}
+	content := canonicalize(el, sig, inclusive)
+	h := hash.New()
+	h.Write(content)
+	want, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(digestValue.text()), ""))
+	if err != nil || subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+		return nil, true, errors.New("saml: digest mismatch")
+	}
+
+	var signedInclusive []string
+	for _, c := range c14n.children {
+		if e, ok := c.(*node); ok && e.local == "InclusiveNamespaces" {
+			signedInclusive = strings.Fields(e.attr("PrefixList"))
+		}
+	}
+	signed := canonicalize(signedInfo, nil, signedInclusive)
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(sigValue.text()), ""))
+	if err != nil {
+		return nil, true, errors.New("saml: malformed signature value")
+	}
+	for _, cert := range certs {
+		if checkSignature(method.attr("Algorithm"), cert.PublicKey, signed, signature, allowSHA1) == nil {
+			return content, true, nil
+		}
+	}
+	return nil, true, errors.New("saml: signature does not match the identity provider certificates")
+}
+
+// hashOf returns the hash of a digest algorithm.
+func hashOf(alg string, allowSHA1 bool) (crypto.Hash, error) {
+	switch alg {
+	case algDigestSHA256:
+		return crypto.SHA256, nil
+	case algDigestSHA512:
+		return crypto.SHA512, nil
+	case algDigestSHA1:
+		if allowSHA1 {
+			return crypto.SHA1, nil
+		}
+	}
+	return 0, fmt.Errorf("saml: unsupported digest algorithm %q", alg)
+}
+
+// checkSignature verifies a signature of data with a public key.
+func checkSignature(alg string, key crypto.PublicKey, data []byte, signature []byte, allowSHA1 bool) error {
+	var hash crypto.Hash
+	switch alg {
+	case algRSASHA256, algECDSASHA256:
+		hash = crypto.SHA256
+	case algRSASHA512:
+		hash = crypto.SHA512
+	case algRSASHA1:
+		if !allowSHA1 {
+			return fmt.Errorf("saml: SHA-1 signatures are not accepted")
+		}
+		hash = crypto.SHA1
+	default:
+		return fmt.Errorf("saml: unsupported signature algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg == algECDSASHA256 {
+			return errors.New("saml: key type mismatch")
+		}
+		return rsa.VerifyPKCS1v15(k, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if alg != algECDSASHA256 || len(signature)%2 != 0 {
+			return errors.New("saml: key type mismatch")
+		}
+		// XML signatures encode ECDSA signatures as r || s.
+		half := len(signature) / 2
+		r, s := new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("saml: invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("saml: unsupported key type %T", key)
+}
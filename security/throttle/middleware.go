@@ -0,0 +1,171 @@
+package throttle
+
+import (
+	"github.com/dormoron/mist"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// MiddlewareBuilder builds a middleware protecting a login route with a Throttler. The
+// middleware checks the attempt before the login handler runs, and records its outcome from
+// the response status afterwards.
+type MiddlewareBuilder struct {
+	throttler     *Throttler
+	usernameFunc  func(ctx *mist.Context) string
+	captchaFunc   func(ctx *mist.Context) string
+	outcomeFunc   func(ctx *mist.Context) (failed bool, succeeded bool)
+	captchaHeader string
+	failClosed    bool
+	logFunc       func(msg string, args ...any)
+}
+
+// MiddlewareBuilder returns a builder of the login middleware of the throttler, which:
+//   - reads the username from the "username" form field,
+//   - reads CAPTCHA tokens from the X-Captcha-Token header or the "captcha_token" form field,
+//   - counts 401 Unauthorized responses as failures and 2xx responses as successes.
+//
+// Example:
+//
+//	throttler := throttle.InitThrottler(throttle.InitRedisStore(client))
+//	server.POST("/login", login, throttler.MiddlewareBuilder().Build())
+func (t *Throttler) MiddlewareBuilder() *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		throttler: t,
+		usernameFunc: func(ctx *mist.Context) string {
+			return ctx.FormValue("username").StringOrDefault("")
+		},
+		captchaFunc: func(ctx *mist.Context) string {
+			if token := ctx.Request.Header.Get("X-Captcha-Token"); token != "" {
+				return token
+			}
+			return ctx.FormValue("captcha_token").StringOrDefault("")
+		},
+		outcomeFunc: func(ctx *mist.Context) (bool, bool) {
+			return ctx.RespStatusCode == http.StatusUnauthorized,
+				ctx.RespStatusCode >= 200 && ctx.RespStatusCode < 300
+		},
+		captchaHeader: "X-Captcha-Required",
+		logFunc: func(msg string, args ...any) {
+			log.Println(append([]any{msg}, args...)...)
+		},
+	}
+}
+
+// SetUsernameFunc sets the function extracting the username of an attempt, e.g. from a
+// header or the JSON body. It must leave the body readable by the login handler.
+func (b *MiddlewareBuilder) SetUsernameFunc(fn func(ctx *mist.Context) string) *MiddlewareBuilder {
+	b.usernameFunc = fn
+	return b
+}
+
+// SetCaptchaTokenFunc sets the function extracting the CAPTCHA token of an attempt.
+func (b *MiddlewareBuilder) SetCaptchaTokenFunc(fn func(ctx *mist.Context) string) *MiddlewareBuilder {
+	b.captchaFunc = fn
+	return b
+}
+
+// SetOutcomeFunc sets the function telling, once the login handler has run, whether the attempt
+// failed or succeeded. Attempts that did neither, e.g. malformed requests, are not counted.
+func (b *MiddlewareBuilder) SetOutcomeFunc(fn func(ctx *mist.Context) (failed bool, succeeded bool)) *MiddlewareBuilder {
+	b.outcomeFunc = fn
+	return b
+}
+
+// SetFailClosed sets whether attempts are refused with 503 Service Unavailable when the store
+// cannot be checked. By default they are let through unthrottled, so that an outage of the store
+// does not lock every user out but leaves the login route open to guessing for its duration.
+func (b *MiddlewareBuilder) SetFailClosed(failClosed bool) *MiddlewareBuilder {
+	b.failClosed = failClosed
+	return b
+}
+
+// SetLogFunc sets the function logging store errors.
+func (b *MiddlewareBuilder) SetLogFunc(fn func(msg string, args ...any)) *MiddlewareBuilder {
+	b.logFunc = fn
+	return b
+}
+
+// Build creates the middleware. Locked-out attempts are answered with 429 Too Many Requests and
+// a Retry-After header. When a CAPTCHA is required, responses carry the X-Captcha-Required
+// header, and attempts without a valid token are answered with 403 Forbidden once a verifier is
+// set; attempts whose token cannot be verified, e.g. during an outage of the CAPTCHA provider,
+// are answered with 503 Service Unavailable.
+//
+// Store errors are logged. By default an attempt that cannot be checked is let through
+// unthrottled, so that every attempt escapes the lockouts and the CAPTCHA for as long as the
+// store is down; SetFailClosed refuses them instead.
+//
+// Returns:
+//   - mist.Middleware: The login middleware.
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	t := b.throttler
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			username := b.usernameFunc(ctx)
+			if username == "" {
+				next(ctx)
+				return
+			}
+			ip := ctx.ClientIP()
+			decision, err := t.Check(ctx, username, ip)
+			if err != nil {
+				b.logFunc("throttle: check failed", err)
+				if b.failClosed {
+					_ = ctx.RespondProblem(mist.Problem{
+						Status: http.StatusServiceUnavailable,
+						Detail: "logins are unavailable, retry later",
+					})
+					return
+				}
+				next(ctx)
+				return
+			}
+			if !decision.Allowed {
+				ctx.Header("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds()+0.5)))
+				_ = ctx.RespondProblem(mist.Problem{
+					Status: http.StatusTooManyRequests,
+					Detail: "too many failed login attempts, retry later",
+				})
+				return
+			}
+			if decision.CaptchaRequired {
+				ctx.Header(b.captchaHeader, "true")
+				ok, err := t.VerifyCaptcha(ctx, b.captchaFunc(ctx), ip)
+				if err != nil {
+					// The CAPTCHA cannot be skipped by making its verification fail.
+					b.logFunc("throttle: captcha verification failed", err)
+					_ = ctx.RespondProblem(mist.Problem{
+						Status: http.StatusServiceUnavailable,
+						Detail: "the CAPTCHA cannot be verified, retry later",
+					})
+					return
+				}
+				if !ok {
+					_ = ctx.RespondProblem(mist.Problem{
+						Status: http.StatusForbidden,
+						Detail: "a CAPTCHA must be solved to log in",
+					})
+					return
+				}
+			}
+
+			next(ctx)
+
+			failed, succeeded := b.outcomeFunc(ctx)
+			switch {
+			case failed:
+				decision, err = t.Fail(ctx, username, ip)
+				if err != nil {
+					b.logFunc("throttle: recording failure failed", err)
+				} else if decision.CaptchaRequired {
+					ctx.Header(b.captchaHeader, "true")
+				}
+			case succeeded:
+				if err = t.Succeed(ctx, username, ip); err != nil {
+					b.logFunc("throttle: recording success failed", err)
+				}
+			}
+		}
+	}
+}
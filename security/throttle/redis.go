@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// RedisStore is a Store shared by every instance through Redis. Counters are stored under
+// "<key>" and locks under "<key>:lock", both expiring on their own.
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+// InitRedisStore creates a RedisStore on the given client.
+func InitRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// luaIncr increments a counter and sets its expiry on the first increment, atomically.
+const luaIncr = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n`
+
+// Incr increments the counter of key, setting its expiry on the first increment.
+func (r *RedisStore) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return r.client.Eval(ctx, luaIncr, []string{key}, window.Milliseconds()).Int64()
+}
+
+// Count returns the counter of key.
+func (r *RedisStore) Count(ctx context.Context, key string) (int64, error) {
+	n, err := r.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Lock locks key for d.
+func (r *RedisStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	return r.client.Set(ctx, key+":lock", 1, d).Err()
+}
+
+// LockTTL returns the remaining lock time of key.
+func (r *RedisStore) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, key+":lock").Result()
+	if err != nil || ttl < 0 {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// Reset deletes the counters and locks of keys.
+func (r *RedisStore) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	all := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		all = append(all, key, key+":lock")
+	}
+	return r.client.Del(ctx, all...).Err()
+}
@@ -0,0 +1,132 @@
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store persists failure counters and lockouts. Implementations must be safe for concurrent
+// use; use a shared store such as RedisStore when several instances serve logins.
+type Store interface {
+	// Incr increments the counter of key and returns its new value. The counter expires window
+	// after its first increment.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	// Count returns the current value of the counter of key, or 0 if it has expired.
+	Count(ctx context.Context, key string) (int64, error)
+	// Lock locks key for the duration d.
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// LockTTL returns the remaining lock time of key, or 0 if key is not locked.
+	LockTTL(ctx context.Context, key string) (time.Duration, error)
+	// Reset deletes the counters and locks of keys.
+	Reset(ctx context.Context, keys ...string) error
+}
+
+// MemoryStore is a Store keeping counters in process memory. It suits single-instance servers
+// and tests.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	counters  map[string]memoryCounter
+	locks     map[string]time.Time
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+// memoryCounter is a counter of a MemoryStore.
+type memoryCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// sweepInterval is the minimum period between two purges of the expired entries of
+// MemoryStore.
+const sweepInterval = time.Minute
+
+// InitMemoryStore creates an empty MemoryStore.
+func InitMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		counters:  make(map[string]memoryCounter),
+		locks:     make(map[string]time.Time),
+		now:       time.Now,
+		lastSweep: time.Now(),
+	}
+}
+
+// Incr increments the counter of key, starting a new window if the previous one has expired.
+// Expired entries are swept on the way, at most once per sweepInterval so that a failed login
+// does not cost a pass over every entry, and the maps do not grow without bound.
+func (m *MemoryStore) Incr(_ context.Context, key string, window time.Duration) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.sweep(now)
+		m.lastSweep = now
+	}
+	c, ok := m.counters[key]
+	if !ok || !now.Before(c.expires) {
+		c = memoryCounter{expires: now.Add(window)}
+	}
+	c.count++
+	m.counters[key] = c
+	return c.count, nil
+}
+
+// Count returns the counter of key.
+func (m *MemoryStore) Count(_ context.Context, key string) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c, ok := m.counters[key]
+	if !ok || !m.now().Before(c.expires) {
+		return 0, nil
+	}
+	return c.count, nil
+}
+
+// Lock locks key for d.
+func (m *MemoryStore) Lock(_ context.Context, key string, d time.Duration) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.locks[key] = m.now().Add(d)
+	return nil
+}
+
+// LockTTL returns the remaining lock time of key.
+func (m *MemoryStore) LockTTL(_ context.Context, key string) (time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	until, ok := m.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	ttl := until.Sub(m.now())
+	if ttl <= 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Reset deletes the counters and locks of keys.
+func (m *MemoryStore) Reset(_ context.Context, keys ...string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, key := range keys {
+		delete(m.counters, key)
+		delete(m.locks, key)
+	}
+	return nil
+}
+
+// sweep removes expired counters and locks; the caller holds the lock.
+func (m *MemoryStore) sweep(now time.Time) {
+	for key, c := range m.counters {
+		if !now.Before(c.expires) {
+			delete(m.counters, key)
+		}
+	}
+	for key, until := range m.locks {
+		if !now.Before(until) {
+			delete(m.locks, key)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package throttle slows down password guessing by counting failed logins per account rather
+// than per IP address. IP-based limits break behind NAT, where many users share an address,
+// and do not stop attackers rotating addresses; counting per account, and per account and IP
+// pair, does both.
+//
+// Two independent counters are kept for every login attempt:
+//   - the account counter, keyed by the username alone, which stops distributed guessing
+//     against one account,
+//   - the pair counter, keyed by the username and the client IP, which locks out a single
+//     guessing client quickly without locking the legitimate user out everywhere.
+//
+// Each counter has its own Policy: the failures that trigger a lockout, how long the lockout
+// lasts, and after how many failures a CAPTCHA is required.
+package throttle
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Scope identifies the counter behind a throttling decision.
+type Scope string
+
+const (
+	// ScopeAccount is the counter keyed by the username.
+	ScopeAccount Scope = "account"
+	// ScopeAccountIP is the counter keyed by the username and the client IP.
+	ScopeAccountIP Scope = "account_ip"
+)
+
+// Policy configures a counter. Zero fields disable the corresponding behavior.
+//
+// Fields:
+//   - MaxFailures: The failures within Window that lock the key out.
+//   - Window: How long failures are remembered, counted from the first failure.
+//   - Lockout: How long a key stays locked once MaxFailures is reached.
+//   - CaptchaAfter: The failures within Window after which a CAPTCHA is required.
+type Policy struct {
+	MaxFailures  int
+	Window       time.Duration
+	Lockout      time.Duration
+	CaptchaAfter int
+}
+
+// Decision is the outcome of a throttling check.
+//
+// Fields:
+//   - Allowed: Whether a login attempt may proceed.
+//   - RetryAfter: When Allowed is false, how long until the lockout ends.
+//   - Scope: When Allowed is false, the counter that locked the attempt out.
+//   - CaptchaRequired: Whether the attempt must come with a solved CAPTCHA.
+type Decision struct {
+	Allowed         bool
+	RetryAfter      time.Duration
+	Scope           Scope
+	CaptchaRequired bool
+}
+
+// Event describes a failed login or a lockout, passed to the notification hooks.
+//
+// Fields:
+//   - Username: The normalized username.
+//   - IP: The client IP of the attempt.
+//   - Scope: The counter the event is about.
+//   - Failures: The failures counted within the window.
+//   - LockedFor: For lockouts, the lockout duration.
+type Event struct {
+	Username  string
+	IP        string
+	Scope     Scope
+	Failures  int64
+	LockedFor time.Duration
+}
+
+// Throttler counts failed logins and locks accounts out. Use Check before verifying the
+// credentials, then Fail or Succeed with the outcome; or let the middleware returned by
+// MiddlewareBuilder do it.
+type Throttler struct {
+	store         Store
+	prefix        string
+	accountPolicy Policy
+	pairPolicy    Policy
+	onFailure     []func(ctx context.Context, e Event)
+	onLockout     []func(ctx context.Context, e Event)
+	captcha       func(ctx context.Context, token string, ip string) (bool, error)
+}
+
+// InitThrottler creates a Throttler keeping its counters in store, with the following
+// policies:
+//   - account: 10 failures in 15 minutes lock the account for 15 minutes, and a CAPTCHA is
+//     required after 3 failures,
+//   - account and IP: 5 failures in 15 minutes lock the pair for 5 minutes.
+//
+// Parameters:
+//   - store: The store of the counters, e.g. InitMemoryStore() or InitRedisStore(client).
+//
+// Returns:
+//   - *Throttler: The initialized throttler.
+func InitThrottler(store Store) *Throttler {
+	return &Throttler{
+		store:         store,
+		prefix:        "login-throttle",
+		accountPolicy: Policy{MaxFailures: 10, Window: 15 * time.Minute, Lockout: 15 * time.Minute, CaptchaAfter: 3},
+		pairPolicy:    Policy{MaxFailures: 5, Window: 15 * time.Minute, Lockout: 5 * time.Minute},
+	}
+}
+
+// SetAccountPolicy sets the policy of the per-account counter.
+func (t *Throttler) SetAccountPolicy(p Policy) *Throttler {
+	t.accountPolicy = p
+	return t
+}
+
+// SetAccountIPPolicy sets the policy of the per-account-and-IP counter.
+func (t *Throttler) SetAccountIPPolicy(p Policy) *Throttler {
+	t.pairPolicy = p
+	return t
+}
+
+// SetKeyPrefix sets the prefix of the keys in the store, to share a store between
+// applications.
+func (t *Throttler) SetKeyPrefix(prefix string) *Throttler {
+	t.prefix = prefix
+	return t
+}
+
+// OnFailure adds a hook called for every failed login, once per counter.
+func (t *Throttler) OnFailure(fn func(ctx context.Context, e Event)) *Throttler {
+	t.onFailure = append(t.onFailure, fn)
+	return t
+}
+
+// OnLockout adds a hook called when a counter locks out an account or an account and IP pair,
+// e.g. to notify the account owner or the security team.
+func (t *Throttler) OnLockout(fn func(ctx context.Context, e Event)) *Throttler {
+	t.onLockout = append(t.onLockout, fn)
+	return t
+}
+
+// SetCaptchaVerifier sets the function verifying CAPTCHA tokens with the CAPTCHA provider,
+// e.g. reCAPTCHA or hCaptcha. Without a verifier, the CaptchaRequired decisions are only
+// reported and never enforced by the middleware.
+func (t *Throttler) SetCaptchaVerifier(fn func(ctx context.Context, token string, ip string) (bool, error)) *Throttler {
+	t.captcha = fn
+	return t
+}
+
+// Check tells whether a login attempt may proceed.
+//
+// Parameters:
+//   - ctx: The context of the store calls.
+//   - username: The username of the attempt; it is trimmed and lower-cased.
+//   - ip: The client IP of the attempt.
+//
+// Returns:
+//   - Decision: The decision.
+//   - error: An error from the store.
+func (t *Throttler) Check(ctx context.Context, username string, ip string) (Decision, error) {
+	decision := Decision{Allowed: true}
+	for _, c := range t.counters(username, ip) {
+		ttl, err := t.store.LockTTL(ctx, c.key)
+		if err != nil {
+			return Decision{}, err
+		}
+		if ttl > 0 {
+			return Decision{RetryAfter: ttl, Scope: c.scope}, nil
+		}
+		if c.policy.CaptchaAfter > 0 && !decision.CaptchaRequired {
+			failures, err := t.store.Count(ctx, c.key)
+			if err != nil {
+				return Decision{}, err
+			}
+			decision.CaptchaRequired = failures >= int64(c.policy.CaptchaAfter)
+		}
+	}
+	return decision, nil
+}
+
+// Fail records a failed login, locking the account or the pair out when a policy limit is
+// reached.
+//
+// Parameters:
+//   - ctx: The context of the store calls and hooks.
+//   - username: The username of the attempt.
+//   - ip: The client IP of the attempt.
+//
+// Returns:
+//   - Decision: The decision for the next attempt.
+//   - error: An error from the store.
+func (t *Throttler) Fail(ctx context.Context, username string, ip string) (Decision, error) {
+	decision := Decision{Allowed: true}
+	for _, c := range t.counters(username, ip) {
+		if c.policy.Window <= 0 {
+			continue
+		}
+		failures, err := t.store.Incr(ctx, c.key, c.policy.Window)
+		if err != nil {
+			return Decision{}, err
+		}
+		event := Event{Username: normalizeUsername(username), IP: ip, Scope: c.scope, Failures: failures}
+		for _, fn := range t.onFailure {
+			fn(ctx, event)
+		}
+		if c.policy.CaptchaAfter > 0 && failures >= int64(c.policy.CaptchaAfter) {
+			decision.CaptchaRequired = true
+		}
+		if c.policy.MaxFailures > 0 && failures >= int64(c.policy.MaxFailures) && c.policy.Lockout > 0 {
+			if err = t.store.Lock(ctx, c.key, c.policy.Lockout); err != nil {
+				return Decision{}, err
+			}
+			event.LockedFor = c.policy.Lockout
+			for _, fn := range t.onLockout {
+				fn(ctx, event)
+			}
+			if decision.Allowed || c.policy.Lockout > decision.RetryAfter {
+				decision = Decision{RetryAfter: c.policy.Lockout, Scope: c.scope, CaptchaRequired: decision.CaptchaRequired}
+			}
+		}
+	}
+	return decision, nil
+}
+
+// Succeed records a successful login, clearing the failures of the account and of the pair.
+func (t *Throttler) Succeed(ctx context.Context, username string, ip string) error {
+	counters := t.counters(username, ip)
+	return t.store.Reset(ctx, counters[0].key, counters[1].key)
+}
+
+// Unlock lifts the lockouts and clears the failures of an account, for example from an
+// administration console after the owner proved their identity. Pairs of the account with
+// other IP addresses expire on their own.
+func (t *Throttler) Unlock(ctx context.Context, username string) error {
+	return t.store.Reset(ctx, t.counters(username, "")[0].key)
+}
+
+// VerifyCaptcha verifies a CAPTCHA token with the verifier set by SetCaptchaVerifier. It
+// reports true when no verifier is set.
+func (t *Throttler) VerifyCaptcha(ctx context.Context, token string, ip string) (bool, error) {
+	if t.captcha == nil {
+		return true, nil
+	}
+	if token == "" {
+		return false, nil
+	}
+	return t.captcha(ctx, token, ip)
+}
+
+// counter is a counter of an attempt with its policy.
+type counter struct {
+	scope  Scope
+	key    string
+	policy Policy
+}
+
+// counters returns the pair and account counters of an attempt; the pair comes first since it
+// locks out sooner.
+func (t *Throttler) counters(username string, ip string) [2]counter {
+	username = normalizeUsername(username)
+	return [2]counter{
+		{scope: ScopeAccountIP, key: t.prefix + ":" + string(ScopeAccountIP) + ":" + username + "|" + ip, policy: t.pairPolicy},
+		{scope: ScopeAccount, key: t.prefix + ":" + string(ScopeAccount) + ":" + username, policy: t.accountPolicy},
+	}
+}
+
+// normalizeUsername makes "Alice " and "alice" share their counters.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,223 @@
+// Package hal produces HAL (Hypertext Application Language) documents from annotated structs.
+//
+// Regular exported fields form the state of the resource and are named after their `json`
+// tags. The `hal` struct tag marks fields with a special meaning:
+//
+//	type Order struct {
+//	    ID       int         `json:"id" hal:"id" links:"self=order,invoice=order-invoice"`
+//	    Total    float64     `json:"total"`
+//	    Customer *Customer   `hal:"embedded,customer"`
+//	    Items    []*LineItem `hal:"embedded,items"`
+//	}
+//
+// The "id" field provides the "id" parameter for link generation through named routes (see the
+// serializer package) and "embedded,<rel>" fields are moved into the _embedded object.
+package hal
+
+import (
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/serializer"
+	"reflect"
+	"strings"
+)
+
+// MediaType is the media type of HAL documents.
+const MediaType = "application/hal+json"
+
+// Link is a HAL link object.
+type Link struct {
+	Href string `json:"href"`
+}
+
+// Linker may be implemented by resources that need links beyond what the `links` tag can
+// express. The returned links are merged with the tag-generated ones and take precedence.
+type Linker interface {
+	HALLinks(builder serializer.URLBuilder) map[string]string
+}
+
+// Encoder converts annotated structs into HAL documents.
+//
+// Fields:
+//   - builder: The URL builder used to resolve `links` tags; typically the *mist.HTTPServer.
+type Encoder struct {
+	builder serializer.URLBuilder
+}
+
+// InitEncoder creates an Encoder resolving links through builder. A nil builder produces
+// documents without generated links.
+func InitEncoder(builder serializer.URLBuilder) *Encoder {
+	return &Encoder{builder: builder}
+}
+
+// Marshal converts v, an annotated struct or a pointer to one, into a HAL document represented
+// as a map ready for encoding/json.
+//
+// Returns:
+//   - map[string]any: The HAL document, or nil when v is nil.
+//   - error: An error if v is not a struct or a link cannot be resolved.
+func (e *Encoder) Marshal(v any) (map[string]any, error) {
+	return e.resource(reflect.ValueOf(v))
+}
+
+// MarshalCollection wraps a slice of resources into a HAL collection document, embedding the
+// items under rel and attaching the given links (e.g. "self", "next") to the collection.
+//
+// Parameters:
+//   - rel: The relation name under which items are embedded.
+//   - items: A slice of annotated structs.
+//   - links: Links of the collection itself, keyed by relation.
+//
+// Returns:
+//   - map[string]any: The HAL collection document.
+//   - error: An error if an item cannot be converted.
+func (e *Encoder) MarshalCollection(rel string, items any, links map[string]string) (map[string]any, error) {
+	embedded, err := e.embed(reflect.ValueOf(items))
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{
+		"_embedded": map[string]any{rel: embedded},
+	}
+	if len(links) > 0 {
+		doc["_links"] = toLinks(links)
+	}
+	return doc, nil
+}
+
+// resource converts a single annotated struct into a HAL resource.
+func (e *Encoder) resource(v reflect.Value) (map[string]any, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errs.ErrInvalidResource(v.Type().String())
+	}
+
+	doc := make(map[string]any)
+	embedded := make(map[string]any)
+	var id, linkTag string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		parts := strings.Split(sf.Tag.Get("hal"), ",")
+		switch parts[0] {
+		case "-":
+			continue
+		case "embedded":
+			rel := sf.Name
+			if len(parts) > 1 && parts[1] != "" {
+				rel = parts[1]
+			}
+			val, err := e.embed(fv)
+			if err != nil {
+				return nil, err
+			}
+			if val != nil {
+				embedded[rel] = val
+			}
+			continue
+		case "id":
+			id = serializer.FormatID(fv)
+			linkTag = sf.Tag.Get(serializer.LinkTag)
+		}
+		name, omitEmpty, skip := serializer.JSONName(sf)
+		if skip || (omitEmpty && serializer.IsEmpty(fv)) {
+			continue
+		}
+		doc[name] = fv.Interface()
+	}
+
+	links, err := serializer.ResolveLinks(e.builder, linkTag, id)
+	if err != nil {
+		return nil, err
+	}
+	if v.CanInterface() {
+		if linker, ok := v.Interface().(Linker); ok {
+			if links == nil {
+				links = make(map[string]string)
+			}
+			for rel, href := range linker.HALLinks(e.builder) {
+				links[rel] = href
+			}
+		}
+	}
+	if len(links) > 0 {
+		doc["_links"] = toLinks(links)
+	}
+	if len(embedded) > 0 {
+		doc["_embedded"] = embedded
+	}
+	return doc, nil
+}
+
+// embed converts the value of an embedded field, which may be a single resource or a slice
+// of resources.
+func (e *Encoder) embed(v reflect.Value) (any, error) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		res := make([]map[string]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := e.resource(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			if item != nil {
+				res = append(res, item)
+			}
+		}
+		return res, nil
+	}
+	res, err := e.resource(v)
+	if err != nil || res == nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// toLinks converts a relation-to-href map into HAL link objects.
+func toLinks(links map[string]string) map[string]Link {
+	res := make(map[string]Link, len(links))
+	for rel, href := range links {
+		res[rel] = Link{Href: href}
+	}
+	return res
+}
+
+// Respond serializes v as a HAL document and stores it as the response of ctx with the HAL
+// media type. The response is written when the framework flushes the context.
+//
+// Parameters:
+//   - ctx: The request context.
+//   - status: The HTTP status code of the response.
+//   - v: The annotated resource to serialize.
+//
+// Returns:
+//   - error: An error if the document cannot be built or serialized.
+func (e *Encoder) Respond(ctx *mist.Context, status int, v any) error {
+	doc, err := e.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	ctx.Header("Content-Type", MediaType)
+	ctx.RespStatusCode = status
+	ctx.RespData = data
+	return nil
+}
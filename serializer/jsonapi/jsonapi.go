@@ -0,0 +1,337 @@
+// Package jsonapi produces JSON:API (https://jsonapi.org) documents from annotated structs.
+//
+// Structs describe their JSON:API shape with the `jsonapi` struct tag:
+//
+//	type Article struct {
+//	    ID     int     `jsonapi:"primary,articles" links:"self=article"`
+//	    Title  string  `jsonapi:"attr,title"`
+//	    Body   string  `jsonapi:"attr,body,omitempty"`
+//	    Author *Person `jsonapi:"relation,author"`
+//	}
+//
+// The primary field holds the resource identifier and type, attr fields become attributes and
+// relation fields (pointers to, or slices of, annotated structs) become relationships whose
+// targets are added to the "included" section of the document. Resource links are generated
+// from named routes through the `links` tag, see the serializer package.
+package jsonapi
+
+import (
+	"encoding/json"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/serializer"
+	"reflect"
+	"strings"
+)
+
+// MediaType is the media type of JSON:API documents.
+const MediaType = "application/vnd.api+json"
+
+// Document is the top-level JSON:API document.
+type Document struct {
+	Data     any               `json:"data"`
+	Included []*ResourceObject `json:"included,omitempty"`
+	Links    map[string]string `json:"links,omitempty"`
+	Meta     map[string]any    `json:"meta,omitempty"`
+	included map[string]bool   // type/id pairs already present in Included
+	builder  serializer.URLBuilder
+}
+
+// ResourceObject is a single JSON:API resource.
+type ResourceObject struct {
+	Type          string                   `json:"type"`
+	ID            string                   `json:"id"`
+	Attributes    map[string]any           `json:"attributes,omitempty"`
+	Relationships map[string]*Relationship `json:"relationships,omitempty"`
+	Links         map[string]string        `json:"links,omitempty"`
+}
+
+// Relationship describes the link between a resource and related resources. Data is either a
+// single *Identifier, a []*Identifier or nil for an empty to-one relationship.
+type Relationship struct {
+	Data  any               `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Identifier is a resource identifier object referencing another resource.
+type Identifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Option configures how a Document is produced.
+type Option func(doc *Document)
+
+// WithURLBuilder sets the URL builder used to resolve the `links` tags of resources. Passing
+// the *mist.HTTPServer ties resource links to the server's named routes.
+func WithURLBuilder(builder serializer.URLBuilder) Option {
+	return func(doc *Document) {
+		doc.builder = builder
+	}
+}
+
+// WithMeta sets the top-level meta object of the document.
+func WithMeta(meta map[string]any) Option {
+	return func(doc *Document) {
+		doc.Meta = meta
+	}
+}
+
+// WithLinks sets the top-level links object of the document (e.g. pagination links).
+func WithLinks(links map[string]string) Option {
+	return func(doc *Document) {
+		doc.Links = links
+	}
+}
+
+// Marshal converts v into a JSON:API Document. v may be an annotated struct, a pointer to
+// one, or a slice of either; nil produces a document with null primary data.
+//
+// Parameters:
+//   - v: The primary data of the document.
+//   - opts: Options configuring links and meta information.
+//
+// Returns:
+//   - *Document: The document, ready to be serialized with encoding/json.
+//   - error: An error if v is not annotated correctly or a link cannot be resolved.
+func Marshal(v any, opts ...Option) (*Document, error) {
+	doc := &Document{included: map[string]bool{}}
+	for _, opt := range opts {
+		opt(doc)
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return doc, nil
+		}
+		if rv.Elem().Kind() != reflect.Struct {
+			rv = rv.Elem()
+			continue
+		}
+		break
+	}
+	if !rv.IsValid() {
+		return doc, nil
+	}
+
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		data := make([]*ResourceObject, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			res, err := doc.resource(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			if res != nil {
+				data = append(data, res)
+			}
+		}
+		doc.pruneIncluded(data)
+		doc.Data = data
+		return doc, nil
+	}
+
+	res, err := doc.resource(rv)
+	if err != nil {
+		return nil, err
+	}
+	if res != nil {
+		doc.pruneIncluded([]*ResourceObject{res})
+		doc.Data = res
+	}
+	return doc, nil
+}
+
+// pruneIncluded removes resources from Included that are also part of the primary data, as
+// the specification forbids a resource from appearing more than once in a compound document.
+func (doc *Document) pruneIncluded(primary []*ResourceObject) {
+	if len(doc.Included) == 0 {
+		return
+	}
+	skip := make(map[string]bool, len(primary))
+	for _, res := range primary {
+		skip[res.Type+"/"+res.ID] = true
+	}
+	filtered := doc.Included[:0]
+	for _, inc := range doc.Included {
+		if !skip[inc.Type+"/"+inc.ID] {
+			filtered = append(filtered, inc)
+		}
+	}
+	if len(filtered) == 0 {
+		filtered = nil
+	}
+	doc.Included = filtered
+}
+
+// resource converts a struct value into a ResourceObject, collecting related resources into
+// the document's included section along the way.
+func (doc *Document) resource(v reflect.Value) (*ResourceObject, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errs.ErrInvalidResource(v.Type().String())
+	}
+
+	res := &ResourceObject{}
+	var linkTag string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("jsonapi")
+		if !ok || !sf.IsExported() {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		fv := v.Field(i)
+		switch parts[0] {
+		case "primary":
+			if len(parts) < 2 || parts[1] == "" {
+				return nil, errs.ErrResourceTypeMissing(t.String())
+			}
+			res.Type = parts[1]
+			res.ID = serializer.FormatID(fv)
+			linkTag = sf.Tag.Get(serializer.LinkTag)
+		case "attr":
+			name := sf.Name
+			if len(parts) > 1 && parts[1] != "" {
+				name = parts[1]
+			}
+			if len(parts) > 2 && parts[2] == "omitempty" && serializer.IsEmpty(fv) {
+				continue
+			}
+			if res.Attributes == nil {
+				res.Attributes = make(map[string]any)
+			}
+			res.Attributes[name] = fv.Interface()
+		case "relation":
+			name := sf.Name
+			if len(parts) > 1 && parts[1] != "" {
+				name = parts[1]
+			}
+			rel, err := doc.relationship(fv)
+			if err != nil {
+				return nil, err
+			}
+			if res.Relationships == nil {
+				res.Relationships = make(map[string]*Relationship)
+			}
+			res.Relationships[name] = rel
+		}
+	}
+	if res.Type == "" {
+		return nil, errs.ErrResourceTypeMissing(t.String())
+	}
+
+	links, err := serializer.ResolveLinks(doc.builder, linkTag, res.ID)
+	if err != nil {
+		return nil, err
+	}
+	res.Links = links
+	return res, nil
+}
+
+// relationship builds the relationship object for a relation field and adds the related
+// resources to the included section.
+func (doc *Document) relationship(v reflect.Value) (*Relationship, error) {
+	for v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return &Relationship{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		ids := make([]*Identifier, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			id, err := doc.include(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			if id != nil {
+				ids = append(ids, id)
+			}
+		}
+		return &Relationship{Data: ids}, nil
+	}
+	id, err := doc.include(v)
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		return &Relationship{}, nil
+	}
+	return &Relationship{Data: id}, nil
+}
+
+// include adds a related resource to the included section once and returns its identifier.
+// The resource is marked as included before it is converted, so cyclic relationships between
+// resources terminate instead of recursing forever.
+func (doc *Document) include(v reflect.Value) (*Identifier, error) {
+	id, err := identify(v)
+	if err != nil || id == nil {
+		return nil, err
+	}
+	key := id.Type + "/" + id.ID
+	if doc.included[key] {
+		return id, nil
+	}
+	doc.included[key] = true
+	res, err := doc.resource(v)
+	if err != nil {
+		return nil, err
+	}
+	doc.Included = append(doc.Included, res)
+	return id, nil
+}
+
+// identify extracts the resource identifier of an annotated struct without converting the
+// rest of the resource.
+func identify(v reflect.Value) (*Identifier, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, errs.ErrInvalidResource(v.Type().String())
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		parts := strings.Split(t.Field(i).Tag.Get("jsonapi"), ",")
+		if parts[0] == "primary" && len(parts) > 1 && parts[1] != "" {
+			return &Identifier{Type: parts[1], ID: serializer.FormatID(v.Field(i))}, nil
+		}
+	}
+	return nil, errs.ErrResourceTypeMissing(t.String())
+}
+
+// Respond serializes v as a JSON:API document and stores it as the response of ctx with the
+// JSON:API media type. The response is written when the framework flushes the context.
+//
+// Parameters:
+//   - ctx: The request context.
+//   - status: The HTTP status code of the response.
+//   - v: The primary data of the document.
+//   - opts: Options forwarded to Marshal.
+//
+// Returns:
+//   - error: An error if the document cannot be built or serialized.
+func Respond(ctx *mist.Context, status int, v any, opts ...Option) error {
+	doc, err := Marshal(v, opts...)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	ctx.Header("Content-Type", MediaType)
+	ctx.RespStatusCode = status
+	ctx.RespData = data
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package serializer contains the pieces shared by the hypermedia response serializers
+// (JSON:API and HAL): struct tag parsing and link generation through named routes.
+package serializer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// URLBuilder generates URL paths for named routes. *mist.HTTPServer satisfies this interface
+// through its URLFor method, which allows serializers to derive resource links from the
+// routing table instead of hard-coding them.
+type URLBuilder interface {
+	URLFor(name string, params map[string]string) (string, error)
+}
+
+// LinkTag is the struct tag holding link definitions. Its value is a comma separated list of
+// "<relation>=<route name>" pairs, for example `links:"self=article,comments=article-comments"`.
+// Each route is resolved with URLFor using the resource identifier as the "id" parameter.
+const LinkTag = "links"
+
+// ResolveLinks turns a LinkTag value into a relation-to-URL map. Relations whose route cannot
+// be resolved are reported as errors, so misconfigured route names surface during development.
+//
+// Parameters:
+//   - builder: The URL builder used to resolve route names. When nil, no links are produced.
+//   - tag: The raw LinkTag value.
+//   - id: The resource identifier passed as the "id" route parameter.
+//
+// Returns:
+//   - map[string]string: The generated links keyed by relation, or nil when there are none.
+//   - error: An error if a route name cannot be resolved.
+func ResolveLinks(builder URLBuilder, tag string, id string) (map[string]string, error) {
+	if builder == nil || tag == "" {
+		return nil, nil
+	}
+	links := make(map[string]string)
+	for _, pair := range strings.Split(tag, ",") {
+		rel, name, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || rel == "" || name == "" {
+			continue
+		}
+		href, err := builder.URLFor(name, map[string]string{"id": id})
+		if err != nil {
+			return nil, err
+		}
+		links[rel] = href
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	return links, nil
+}
+
+// JSONName reports how encoding/json would name a struct field.
+//
+// Returns:
+//   - name: The serialized field name.
+//   - omitEmpty: Whether the field carries the "omitempty" option.
+//   - skip: Whether the field is not serialized at all (unexported or tagged "-").
+func JSONName(sf reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	if !sf.IsExported() {
+		return "", false, true
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = sf.Name
+	}
+	return name, strings.Contains(","+opts+",", ",omitempty,"), false
+}
+
+// FormatID converts a resource identifier field into its string form. Strings are returned
+// as-is, integers are formatted in base 10 and any other value uses its default formatting.
+func FormatID(v reflect.Value) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// IsEmpty mirrors the "omitempty" rules of encoding/json.
+func IsEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
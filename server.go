@@ -1,9 +1,14 @@
 package mist
 
 import (
-	"net"
+	"context"
+	"errors"
+	"github.com/dormoron/mist/errcode"
+	"io"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 )
 
 // This line asserts that HTTPServer implements the Server interface at compile time.
@@ -48,9 +53,9 @@ var _ Server = &HTTPServer{} // Ensures HTTPServer implements the Server interfa
 //	  }
 //	}
 type Server interface {
-	http.Handler                                                                         // Inherited ServeHTTP method for handling requests
-	Start(addr string) error                                                             // Method to start the server on a given address
-	registerRoute(method string, path string, handleFunc HandleFunc, mils ...Middleware) // Internal route registration
+	http.Handler                                                                                // Inherited ServeHTTP method for handling requests
+	Start(addr string) error                                                                    // Method to start the server on a given address
+	registerRoute(method string, path string, handleFunc HandleFunc, mils ...Middleware) *Route // Internal route registration
 }
 
 // HTTPServerOption defines a function type used to apply configuration options to an HTTPServer.
@@ -134,9 +139,30 @@ type HTTPServerOption func(server *HTTPServer) // Functional option for configur
 // can efficiently manage inbound requests, apply necessary pre-processing,
 // handle routing, execute business logic, and generate dynamic responses.
 type HTTPServer struct {
-	router                        // Embedded routing management. Provides direct access to routing methods.
-	log            Logger         // Logger interface. Allows for flexible and consistent logging.
-	templateEngine TemplateEngine // Template processor interface. Facilitates HTML template rendering.
+	router                                    // Embedded routing management. Provides direct access to routing methods.
+	log                 Logger                // Logger interface. Allows for flexible and consistent logging.
+	templateEngine      TemplateEngine        // Template processor interface. Facilitates HTML template rendering.
+	catalog             *errcode.Catalog      // Error catalog resolving status codes and localized messages of error codes.
+	tasks               *taskGroup            // Asynchronous work started from handlers, awaited on shutdown.
+	listeners           []*listener           // Addresses declared with Listen, started by Serve.
+	srvs                []*http.Server        // The underlying net/http servers, one per listener, available once started.
+	srvsMutex           sync.Mutex            // Guards srvs and closed between the serving goroutine and Shutdown.
+	closed              bool                  // Set by Shutdown; listeners started afterwards are closed at once.
+	flags               FlagEvaluator         // Feature flag evaluator consulted by Context.FlagEnabled.
+	switches            *routeSwitch          // Routes disabled at runtime and the status they respond with.
+	headers             http.Header           // Response headers preset on every response.
+	deprecations        *routeDeprecations    // Routes marked deprecated and the observers of their usage.
+	timingPolicy        ServerTimingPolicy    // Decides which responses carry the Server-Timing header; nil means all.
+	bodyParsers         map[string]BodyParser // Parsers used by Context.Bind, keyed by media type.
+	bodyLimit           int64                 // Size limit of the bodies cached by Context.BodyBytes; 0 means the default.
+	marshalErrorHandler MarshalErrorHandler   // Handles the serialization failures of RespondWithJSON.
+	handlerTimeout      time.Duration         // Time limit of request handling; 0 means no limit.
+	discardGone         bool                  // Skips writing the responses of disconnected clients.
+	flashStore          FlashStore            // Keeps the flash messages between requests.
+	protocol            ProtocolConfig        // Timeouts and limits of the connections of the listeners.
+	jsonLocalizer       *JSONLocalizer        // Localizes the JSON responses of the clients asking for it.
+	jobs                *jobRunner            // Runs the jobs accepted with Context.AcceptAsync.
+	shutdownHooks       []shutdownHook        // Stop the background components on shutdown, see OnShutdown.
 }
 
 // InitHTTPServer initializes and returns a pointer to a new HTTPServer instance. The server can be customized by
@@ -164,7 +190,12 @@ type HTTPServer struct {
 func InitHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 	// Create a new HTTPServer with a default configuration.
 	res := &HTTPServer{
-		router: initRouter(), // Initialize the HTTPServer's router for request handling.
+		router:              initRouter(),               // Initialize the HTTPServer's router for request handling.
+		tasks:               &taskGroup{},               // Track asynchronous work so that it can be drained on shutdown.
+		switches:            &routeSwitch{},             // No route is disabled initially.
+		deprecations:        &routeDeprecations{},       // No route is deprecated initially.
+		bodyParsers:         defaultBodyParsers,         // Decode JSON, XML and forms until parsers are registered.
+		marshalErrorHandler: DefaultMarshalErrorHandler, // Answer serialization failures with a 500 problem.
 	}
 
 	// Apply each provided HTTPServerOption to the HTTPServer to configure it according to the user's requirements.
@@ -295,14 +326,48 @@ func (s *HTTPServer) UseForAll(path string, mdls ...Middleware) {
 //     for manipulations), it gets sent out after the request is processed.
 //  5. Calls the fully wrapped root handler, beginning the execution of the middleware chain and ultimately invoking
 //     the appropriate request handler.
+//
+// A request whose context derives from one accepted on a listener, e.g. a sub-request dispatched
+// from inside a handler, is served as if accepted on that listener, so that it runs the
+// middleware of the listener and sees the routes restricted to it.
 func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	l, _ := request.Context().Value(listenerCtxKey{}).(*listener)
+	s.serve(writer, request, l)
+}
+
+// serve handles a request accepted on a listener; l is nil when the server is used as a plain
+// http.Handler outside of any listener.
+func (s *HTTPServer) serve(writer http.ResponseWriter, request *http.Request, l *listener) {
 	// Create the context that will traverse the request handling chain.
 	ctx := &Context{
-		Request:        request,          // The original HTTP request.
-		ResponseWriter: writer,           // The ResponseWriter to work with the HTTP response.
-		templateEngine: s.templateEngine, // The templating engine, if any, to render HTML views.
+		Request:             request,               // The original HTTP request.
+		ResponseWriter:      writer,                // The ResponseWriter to work with the HTTP response.
+		templateEngine:      s.templateEngine,      // The templating engine, if any, to render HTML views.
+		catalog:             s.catalog,             // The error catalog used by problem details responses.
+		tasks:               s.tasks,               // The tracker of asynchronous work started by handlers.
+		flags:               s.flags,               // The feature flag evaluator.
+		timingPolicy:        s.timingPolicy,        // The policy deciding whether Server-Timing is emitted.
+		bodyParsers:         s.bodyParsers,         // The body parsers used by Bind.
+		bodyLimit:           s.bodyLimit,           // The size limit of the cached body.
+		marshalErrorHandler: s.marshalErrorHandler, // The handler of JSON serialization failures.
+		start:               time.Now(),            // The start of the request, from which the handler timeout counts.
+		clientCtx:           request.Context(),     // Cancelled when the client disconnects.
+		discardGone:         s.discardGone,         // Whether responses of disconnected clients are skipped.
+		listener:            l,                     // The listener that accepted the request.
+		flashStore:          s.flashStore,          // The store of the flash messages.
+		jsonLocalizer:       s.jsonLocalizer,       // The localizer of the JSON responses.
+		jobs:                s.jobs,                // The runner of the asynchronous jobs.
 	}
+	// Buffer the status until the response is committed.
+	ctx.ResponseWriter = &responseWriter{ResponseWriter: writer, ctx: ctx}
+	// Bound the handling time; groups and routes may override the limit.
+	ctx.setHandlerTimeout(s.handlerTimeout)
+	// Preset the server-wide headers; group, route and handler headers override them.
+	applyHeaders(writer.Header(), s.headers)
 	s.server(ctx)
+	if ctx.deadline != nil {
+		ctx.deadline.release()
+	}
 }
 
 // flashResp is a method on the HTTPServer struct that commits the HTTP response
@@ -324,21 +389,46 @@ func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 // the HTTP response is correctly formed and transmitted to the client, concluding
 // the request-handling cycle.
 func (s *HTTPServer) flashResp(ctx *Context) {
-	// If a status code has been set on the Context, write it as the HTTP response status code.
-	if !ctx.headerWritten && ctx.RespStatusCode > 0 {
-		ctx.writeHeader(ctx.RespStatusCode)
+	// A body set with RespondReader is closed whether it is sent or not.
+	if closer, ok := ctx.respReader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	// Hijacked connections belong to the handler.
+	if ctx.hijacked {
+		return
+	}
+	// Nobody reads the responses of disconnected clients.
+	if ctx.discardGone && ctx.IsClientGone() {
+		return
+	}
+
+	// Bodies set with RespondReader are streamed instead of written from RespData.
+	if ctx.respReader != nil {
+		s.flashReader(ctx)
+		return
+	}
+
+	// Responses without data are complete once the header is written. Content-Length is left
+	// alone: 204 responses must not carry one, and HEAD handlers or 304 responses set the length
+	// of the representation they describe, which a zero would overwrite.
+	if len(ctx.RespData) == 0 {
+		ctx.Commit()
+		return
 	}
 
 	// Calculate the length of the response data and set the "Content-Length" header accordingly.
 	// The Content-Length header is important as it tells the client how many bytes of data to expect.
-	ctx.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(ctx.RespData)))
+	if !ctx.Committed() {
+		ctx.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(ctx.RespData)))
+	}
 
-	// Write the response data to the HTTP client. The Write method of ResponseWriter
-	// is used to send the response payload contained within ctx.RespData.
+	// Send the status and headers buffered so far, then the response data contained within
+	// ctx.RespData.
+	ctx.Commit()
 	_, err := ctx.ResponseWriter.Write(ctx.RespData)
-	if err != nil {
-		// In the event of a failure to write the response data to the client,
-		// log a fatal error with the defaultLogger. A fatal log typically indicates an
+	if err != nil && !ctx.IsClientGone() {
+		// In the event of a failure to write the response data to a client that is still
+		// connected, log a fatal error with the defaultLogger. A fatal log typically indicates an
 		// error so severe that it is impossible to continue the operation of the program.
 		defaultLogger.Fatalln("Failed to write response data:", err)
 	}
@@ -349,12 +439,19 @@ func (s *HTTPServer) flashResp(ctx *Context) {
 func (s *HTTPServer) server(ctx *Context) {
 	// Find the route that matches the method and path of the request.
 	mi, ok := s.findRoute(ctx.Request.Method, ctx.Request.URL.Path)
+	// Routes restricted to other listeners do not exist on this one.
+	if mi.n != nil && !mi.n.visibleOn(ctx.listener) {
+		mi.n, ok = nil, false
+	}
 
 	// If a matching node is found, populate the context with the route-specific
 	// path parameters and the matched route.
 	if mi.n != nil {
 		ctx.PathParams = mi.pathParams
 		ctx.MatchedRoute = mi.n.route
+		ctx.handler = mi.n.handler
+		ctx.routeMeta = mi.n.meta
+		ctx.frames = mi.n.frames
 	}
 
 	// Define a root handle function that will attempt to execute the matched route's handler.
@@ -364,14 +461,38 @@ func (s *HTTPServer) server(ctx *Context) {
 			ctx.RespStatusCode = 404 // Set status code to '404 Not Found' if the route is not resolved.
 			return
 		}
+		// Routes switched off at runtime never reach their handler.
+		if s.switches.disabled(ctx.Request.Method, mi.n.route) {
+			ctx.RespStatusCode = s.switches.disabledStatus()
+			return
+		}
+		// Deprecated routes announce their retirement before being served.
+		if dr, deprecated := s.deprecations.lookup(ctx.Request.Method, mi.n.route); deprecated {
+			s.deprecations.serve(ctx, dr)
+		}
+		// Requests violating the constraints of the route never reach its handler.
+		if c := mi.n.constraints; c != nil {
+			if err := c.check(ctx); err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+		}
 		// If a handler exists for the route, call it passing the context.
 		mi.n.handler(ctx)
 	}
 
 	// Execute all the applicable middlewares in reverse order.
 	// This is typically done to wrap the final handler with additional functionality.
+	// Each link of the chain is skipped once the request has been aborted.
+	root = skipAborted(root)
 	for i := len(mi.mils) - 1; i >= 0; i-- {
-		root = mi.mils[i](root)
+		root = skipAborted(mi.mils[i](root))
+	}
+	// The middleware of the listener run before those of the route.
+	if ctx.listener != nil {
+		for i := len(ctx.listener.mils) - 1; i >= 0; i-- {
+			root = skipAborted(ctx.listener.mils[i](root))
+		}
 	}
 
 	// Define a middleware that ensures the response is properly sent after
@@ -429,15 +550,59 @@ func (s *HTTPServer) server(ctx *Context) {
 //
 // The Start method is a blocking call. Once called, it will continue to run, serving incoming HTTP requests until
 // an error is encountered or the server is manually stopped.
+//
+// To serve several addresses, or over TLS, declare the listeners with Listen and call Serve.
 func (s *HTTPServer) Start(addr string) error {
-	// Create a new TCP listener on the specified address.
-	l, err := net.Listen("tcp", addr)
+	// Create a new TCP listener on the specified address and serve it.
+	served, err := s.startListeners([]*listener{{addr: addr, name: addr}})
 	if err != nil {
 		return err // Return the error if the listener could not be created.
 	}
+	return <-served // Return the result of Serve, which will block until the server stops.
+}
 
-	// Start the HTTP server with the newly created listener, using 's' (HTTPServer) as the handler.
-	return http.Serve(l, s) // Return the result of http.Serve, which will block until the server stops.
+// Shutdown gracefully stops the server. It stops accepting new connections, waits for the
+// in-flight requests to complete, runs the hooks registered with OnShutdown and then drains
+// the asynchronous work started with Context.Async; new asynchronous work is rejected from
+// that point on. Start returns http.ErrServerClosed once Shutdown has been called.
+//
+// Parameters:
+//   - ctx: Bounds the time spent waiting; when it is done, Shutdown returns its error.
+//
+// Returns:
+//   - error: The errors of the underlying servers, of the hooks and of the drain, joined;
+//     ctx.Err() on timeout.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.srvsMutex.Lock()
+	s.closed = true
+	srvs := s.srvs
+	s.srvsMutex.Unlock()
+
+	var errList []error
+	for _, srv := range srvs {
+		errList = append(errList, srv.Shutdown(ctx))
+	}
+	// The hooks and the drain run even when a server failed to stop, so that the background
+	// work is never left running.
+	for _, hook := range s.shutdownHooks {
+		errList = append(errList, hook(ctx))
+	}
+	s.tasks.close()
+	errList = append(errList, s.tasks.wait(ctx))
+	return errors.Join(errList...)
+}
+
+// shutdownHook stops a component running beside the server, see OnShutdown.
+type shutdownHook func(ctx context.Context) error
+
+// OnShutdown registers a hook run by Shutdown once the in-flight requests completed, in the
+// order of registration, to stop the components running beside the server, such as message
+// consumers, within the same grace period.
+//
+// Parameters:
+//   - hook: The hook; it returns once the component stopped, or when ctx is done.
+func (s *HTTPServer) OnShutdown(hook func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, hook)
 }
 
 // GET registers a new route and its associated handler function for HTTP GET requests.
@@ -462,8 +627,10 @@ func (s *HTTPServer) Start(addr string) error {
 // The method internally calls registerRoute to add the route to the server's routing
 // table with the method specified as `http.MethodGet`, which ensures that only GET
 // requests are handled by the provided handler.
-func (s *HTTPServer) GET(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodGet, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) GET(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodGet, path, handleFunc)
 }
 
 // HEAD registers a new route and its associated handler function for HTTP HEAD requests.
@@ -488,8 +655,10 @@ func (s *HTTPServer) GET(path string, handleFunc HandleFunc) {
 // The method utilizes the registerRoute internal function to add the route to the server's
 // routing table specifically for the HEAD HTTP method, which ensures that only HEAD
 // requests will trigger the execution of the provided handler function.
-func (s *HTTPServer) HEAD(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodHead, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) HEAD(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodHead, path, handleFunc)
 }
 
 // POST registers a new route and its associated handler function for handling HTTP POST requests.
@@ -512,8 +681,10 @@ func (s *HTTPServer) HEAD(path string, handleFunc HandleFunc) {
 // Note:
 // The method delegates to registerRoute, internally setting the HTTP method to `http.MethodPost`. This
 // ensures that the registered handler is invoked only for POST requests matching the specified path.
-func (s *HTTPServer) POST(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodPost, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) POST(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodPost, path, handleFunc)
 }
 
 // PUT registers a new route and its associated handler function for handling HTTP PUT requests.
@@ -536,8 +707,10 @@ func (s *HTTPServer) POST(path string, handleFunc HandleFunc) {
 // By calling registerRoute and specifying `http.MethodPut`, this method ensures that the handler is
 // specifically associated with PUT requests. If a PUT request is made on the matched path, the
 // corresponding handler function will be executed.
-func (s *HTTPServer) PUT(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodPut, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) PUT(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodPut, path, handleFunc)
 }
 
 // PATCH registers a new route with an associated handler function for HTTP PATCH requests.
@@ -560,8 +733,10 @@ func (s *HTTPServer) PUT(path string, handleFunc HandleFunc) {
 // Registering the route with the `http.MethodPatch` constant ensures that only PATCH requests are
 // handled by the provided function. The PATCH method is typically used to apply a partial update to
 // a resource, and this function is where you would define how the server handles such requests.
-func (s *HTTPServer) PATCH(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodPatch, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) PATCH(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodPatch, path, handleFunc)
 }
 
 // DELETE registers a new route with an associated handler function for HTTP DELETE requests.
@@ -585,8 +760,10 @@ func (s *HTTPServer) PATCH(path string, handleFunc HandleFunc) {
 // Note:
 // Using `http.MethodDelete` in the call to registerRoute confines this handler to respond
 // solely to DELETE requests, providing a way to define how the server handles deletions.
-func (s *HTTPServer) DELETE(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodDelete, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) DELETE(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodDelete, path, handleFunc)
 }
 
 // CONNECT registers a new route with an associated handler function for handling HTTP CONNECT
@@ -612,8 +789,10 @@ func (s *HTTPServer) DELETE(path string, handleFunc HandleFunc) {
 // The use of `http.MethodConnect` ensures that only HTTP CONNECT requests are matched to
 // this handler, facilitating the appropriate processing logic for these specialized request
 // types, which are different from the standard GET, POST, PUT, etc., methods.
-func (s *HTTPServer) CONNECT(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodConnect, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) CONNECT(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodConnect, path, handleFunc)
 }
 
 // OPTIONS registers a new route with an associated handler function for HTTP OPTIONS requests.
@@ -639,6 +818,8 @@ func (s *HTTPServer) CONNECT(path string, handleFunc HandleFunc) {
 // standard practice to implement this method on a server to inform clients about the methods and
 // content types that the server is capable of handling, thereby aiding the client's decision-making
 // regarding further actions.
-func (s *HTTPServer) OPTIONS(path string, handleFunc HandleFunc) {
-	s.registerRoute(http.MethodOptions, path, handleFunc)
+//
+// The returned Route attaches metadata to the route with Route.Meta.
+func (s *HTTPServer) OPTIONS(path string, handleFunc HandleFunc) *Route {
+	return s.registerRoute(http.MethodOptions, path, handleFunc)
 }
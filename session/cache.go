@@ -0,0 +1,119 @@
+package session
+
+import (
+	"context"
+	"github.com/hashicorp/golang-lru"
+	"time"
+)
+
+// defaultCacheSize is the number of sessions cached when Manager.CacheSize is not set.
+const defaultCacheSize = 10000
+
+// lookupTimeout bounds a lookup of the store shared by concurrent fetches, which no longer
+// follows the cancellation of any of their requests.
+const lookupTimeout = 5 * time.Second
+
+// lookup is the result of a lookup of the store.
+type lookup struct {
+	sess Session
+	err  error
+}
+
+// cachedEntry is a session of the store cached by the manager, and its expiry.
+type cachedEntry struct {
+	sess     Session
+	deadline time.Time
+}
+
+// invalidatingSession drops its session from the cache of the manager on every write, so that
+// the next lookup reads the store again.
+type invalidatingSession struct {
+	Session
+	manager *Manager
+}
+
+// Set stores value under key and invalidates the cached session.
+func (s *invalidatingSession) Set(ctx context.Context, key string, value any) error {
+	defer s.manager.Invalidate(s.ID())
+	return s.Session.Set(ctx, key, value)
+}
+
+// fetch returns the session of the store with the given ID, from the cache of the manager when
+// it holds a fresh one. Concurrent fetches of the same ID, from the goroutines of a request or
+// from concurrent requests of a client, share one call of the store. The shared call does not
+// follow the cancellation of the request that started it, so that a client going away does not
+// fail the others; each fetch stops waiting when its own ctx is done.
+func (m *Manager) fetch(ctx context.Context, id string) (Session, error) {
+	cache := m.sessionCache()
+	if cache != nil {
+		if val, ok := cache.Get(id); ok {
+			entry := val.(cachedEntry)
+			if time.Now().Before(entry.deadline) {
+				return entry.sess, nil
+			}
+			cache.Remove(id)
+		}
+	}
+	done := make(chan lookup, 1)
+	go func() {
+		sess, err, _ := m.flight.Do(id, func() (Session, error) {
+			lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+			defer cancel()
+			sess, err := m.Store.Get(lookupCtx, id)
+			if err != nil {
+				return nil, err
+			}
+			if cache == nil {
+				return sess, nil
+			}
+			sess = m.tracked(sess)
+			cache.Add(id, cachedEntry{sess: sess, deadline: time.Now().Add(m.CacheTTL)})
+			return sess, nil
+		})
+		done <- lookup{sess: sess, err: err}
+	}()
+	select {
+	case res := <-done:
+		return res.sess, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tracked returns sess invalidating the cache on writes, when the cache is enabled.
+func (m *Manager) tracked(sess Session) Session {
+	if m.sessionCache() == nil {
+		return sess
+	}
+	return &invalidatingSession{Session: sess, manager: m}
+}
+
+// Invalidate drops a session from the cache of the manager, e.g. after changing it through the
+// store directly. Writes through the sessions returned by the manager, and RemoveSession,
+// invalidate the cache themselves; changes made by other instances are seen once the cached
+// session expires, after CacheTTL at most.
+//
+// Parameters:
+//   - id: The ID of the session.
+func (m *Manager) Invalidate(id string) {
+	if cache := m.sessionCache(); cache != nil {
+		cache.Remove(id)
+		m.flight.Forget(id)
+	}
+}
+
+// sessionCache returns the cache of the sessions, created on first use, or nil when CacheTTL is
+// not set.
+func (m *Manager) sessionCache() *lru.Cache {
+	if m.CacheTTL <= 0 {
+		return nil
+	}
+	m.cacheOnce.Do(func() {
+		size := m.CacheSize
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		m.cache, _ = lru.New(size)
+	})
+	return m.cache
+}
@@ -0,0 +1,164 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"github.com/dormoron/mist/internal/errs"
+	"io"
+)
+
+// Codec serializes session values. Stores keep the encoded bytes, so that every store holds
+// values the same way and values keep their type across a round trip through Redis or any
+// other store. Other formats such as msgpack or CBOR are plugged in by implementing Codec.
+type Codec interface {
+	// Encode serializes a value.
+	Encode(val any) ([]byte, error)
+	// Decode deserializes a value encoded by Encode.
+	Decode(data []byte) (any, error)
+}
+
+// JSONCodec encodes values as JSON. Decoded values have the types of encoding/json: objects
+// become map[string]any and numbers float64.
+type JSONCodec struct{}
+
+// Encode serializes val as JSON.
+func (JSONCodec) Encode(val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+// Decode deserializes a JSON document.
+func (JSONCodec) Decode(data []byte) (any, error) {
+	var val any
+	err := json.Unmarshal(data, &val)
+	return val, err
+}
+
+// GobCodec encodes values with encoding/gob, preserving their concrete types. Types other than
+// the basic ones must be registered with gob.Register.
+type GobCodec struct{}
+
+// gobValue lets gob carry the concrete type of a value.
+type gobValue struct {
+	V any
+}
+
+// Encode serializes val with gob.
+func (GobCodec) Encode(val any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobValue{V: val}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode deserializes a gob encoded value.
+func (GobCodec) Decode(data []byte) (any, error) {
+	var val gobValue
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&val)
+	return val.V, err
+}
+
+// EncryptedCodec encrypts the output of another codec with AES-GCM, so that session values
+// are unreadable and tamper-evident in the store.
+type EncryptedCodec struct {
+	codec Codec
+	aead  cipher.AEAD
+}
+
+// InitEncryptedCodec creates an EncryptedCodec.
+//
+// Example:
+//
+//	codec, err := session.InitEncryptedCodec(session.GobCodec{}, key)
+//	manager := &session.Manager{Store: store, Propagator: propagator, Codec: codec}
+//
+// Parameters:
+//   - codec: The codec serializing the values before encryption.
+//   - key: The AES key, of 16, 24 or 32 bytes.
+//
+// Returns:
+//   - *EncryptedCodec: The codec.
+//   - error: An error if the key has an invalid size.
+func InitEncryptedCodec(codec Codec, key []byte) (*EncryptedCodec, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedCodec{codec: codec, aead: aead}, nil
+}
+
+// Encode serializes and encrypts val. The output is the nonce followed by the ciphertext.
+func (c *EncryptedCodec) Encode(val any) ([]byte, error) {
+	plain, err := c.codec.Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(plain)+c.aead.Overhead())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Decode decrypts and deserializes a value. Values that were not encrypted with the key, or
+// were altered, yield an error wrapping errors.ErrVerificationFailed.
+func (c *EncryptedCodec) Decode(data []byte) (any, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, errs.ErrVerificationFailed(errors.New("ciphertext too short"))
+	}
+	plain, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, errs.ErrVerificationFailed(err)
+	}
+	return c.codec.Decode(plain)
+}
+
+// codecSession encodes the values of a store session with a codec.
+type codecSession struct {
+	Session
+	codec Codec
+}
+
+// Get returns the decoded value of key.
+func (s *codecSession) Get(ctx context.Context, key string) (any, error) {
+	val, err := s.Session.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	switch data := val.(type) {
+	case []byte:
+		return s.codec.Decode(data)
+	case string:
+		return s.codec.Decode([]byte(data))
+	default:
+		return nil, errs.ErrInvalidType("[]byte", val)
+	}
+}
+
+// Set encodes value and stores it under key.
+func (s *codecSession) Set(ctx context.Context, key string, value any) error {
+	data, err := s.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return s.Session.Set(ctx, key, data)
+}
+
+// withCodec wraps sess with the codec of the manager, if any.
+func (m *Manager) withCodec(sess Session) Session {
+	if m.Codec == nil {
+		return sess
+	}
+	return &codecSession{Session: sess, codec: m.Codec}
+}
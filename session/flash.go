@@ -0,0 +1,85 @@
+package session
+
+import (
+	"encoding/json"
+	"github.com/dormoron/mist"
+)
+
+// FlashStore keeps flash messages in the session of the client, so that they survive the
+// redirect of the post/redirect/get pattern. It implements mist.FlashStore.
+//
+//	server := mist.InitHTTPServer(mist.ServerWithFlashStore(session.InitFlashStore(manager)))
+type FlashStore struct {
+	manager *Manager
+	key     string
+}
+
+// InitFlashStore creates a FlashStore keeping the messages under the "_flashes" session key.
+//
+// Parameters:
+//   - manager: The session manager.
+//
+// Returns:
+//   - *FlashStore: The initialized store.
+func InitFlashStore(manager *Manager) *FlashStore {
+	return &FlashStore{manager: manager, key: "_flashes"}
+}
+
+// SetKey sets the session key holding the messages.
+func (s *FlashStore) SetKey(key string) *FlashStore {
+	s.key = key
+	return s
+}
+
+// Add appends a message to the session of the client, starting a session if it has none.
+func (s *FlashStore) Add(ctx *mist.Context, flash mist.Flash) error {
+	sess, err := s.manager.GetSession(ctx)
+	if err != nil {
+		if sess, err = s.manager.InitSession(ctx); err != nil {
+			return err
+		}
+	}
+	flashes := append(s.read(ctx, sess), flash)
+	data, err := json.Marshal(flashes)
+	if err != nil {
+		return err
+	}
+	return sess.Set(ctx.Request.Context(), s.key, string(data))
+}
+
+// Take returns the messages of the session of the client and clears them. Clients without a
+// session have no messages.
+func (s *FlashStore) Take(ctx *mist.Context) ([]mist.Flash, error) {
+	sess, err := s.manager.GetSession(ctx)
+	if err != nil {
+		return nil, nil
+	}
+	flashes := s.read(ctx, sess)
+	if len(flashes) == 0 {
+		return nil, nil
+	}
+	return flashes, sess.Set(ctx.Request.Context(), s.key, "")
+}
+
+// read decodes the messages held by a session. Messages that cannot be read, because the key
+// is missing or the store failed, are treated as absent: flash messages are best effort.
+func (s *FlashStore) read(ctx *mist.Context, sess Session) []mist.Flash {
+	val, err := sess.Get(ctx.Request.Context(), s.key)
+	if err != nil {
+		return nil
+	}
+	var data []byte
+	switch v := val.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return nil
+	}
+	var flashes []mist.Flash
+	if len(data) == 0 || json.Unmarshal(data, &flashes) != nil {
+		return nil
+	}
+	return flashes
+}
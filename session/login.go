@@ -0,0 +1,127 @@
+package session
+
+import (
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/google/uuid"
+)
+
+// PrincipalKey is the session key under which Login stores the principal of the client.
+const PrincipalKey = "principal"
+
+// RotateID moves the session of the client to a new ID and sends the new ID to the client.
+// The values and expiry of the session are moved by the store in one step, so that the old ID
+// stops being valid in the store at once: an attacker who planted or learned it before is left
+// with nothing. Call it on every change of privilege, e.g. on sign-in or on stepping up to an
+// admin role; Login calls it for the sign-in.
+//
+// With Manager.CacheTTL set, only the cache of this instance drops the old ID. Other instances
+// that cached the session keep accepting the old ID until their copy expires, for CacheTTL at
+// most. Leave CacheTTL at 0 on deployments of several instances that cannot accept this window.
+//
+// The store must implement Rotator, as the stores of the memory and redis packages do.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//
+// Returns:
+//   - Session: The session with its new ID, also returned by GetSession for the rest of the
+//     request.
+//   - error: An error if the client has no session, the store cannot rotate IDs (see
+//     errs.IsSessionRotationUnsupported), or the rotation or the propagation of the ID fails.
+func (m *Manager) RotateID(ctx *mist.Context) (Session, error) {
+	sess, err := m.GetSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rotator, ok := m.Store.(Rotator)
+	if !ok {
+		return nil, errs.ErrSessionRotationUnsupported()
+	}
+	oldID, id := sess.ID(), uuid.New().String()
+	rotated, err := rotator.Rotate(ctx.Request.Context(), oldID, id)
+	m.Invalidate(oldID)
+	if err != nil {
+		return nil, err
+	}
+	rotated = m.withCodec(m.tracked(rotated))
+	m.setRequestSession(ctx, rotated)
+	return rotated, m.Inject(id, ctx.ResponseWriter)
+}
+
+// Login signs a client in: it rotates the ID of the session of the client, keeping its values,
+// or starts a session when it has none, then stores the principal under PrincipalKey. The ID the
+// client had before signing in is never the one of the signed-in session, which closes the
+// session fixation attacks that reusing the session, or copying its values to a new one by
+// hand, leaves open; see RotateID for the window left by the cache of other instances. With a
+// store unable to rotate IDs, the session is removed and a new empty one is started instead.
+//
+// Example:
+//
+//	server.POST("/login", func(ctx *mist.Context) {
+//	    user, err := authenticate(ctx)
+//	    ...
+//	    if _, err = manager.Login(ctx, user.ID); err != nil {
+//	        ...
+//	    }
+//	})
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - principal: The identity of the client, e.g. the ID of the user; with a Codec, its type
+//     must be registered with it.
+//
+// Returns:
+//   - Session: The session of the signed-in client.
+//   - error: An error if the session cannot be rotated or started, or the principal stored.
+func (m *Manager) Login(ctx *mist.Context, principal any) (Session, error) {
+	sess, err := m.GetSession(ctx)
+	switch {
+	case err != nil:
+		// No session, or one that expired: start a new one.
+		sess, err = m.InitSession(ctx)
+	default:
+		sess, err = m.RotateID(ctx)
+		if errs.IsSessionRotationUnsupported(err) {
+			old, _ := m.GetSession(ctx)
+			if err = m.Store.Remove(ctx.Request.Context(), old.ID()); err == nil {
+				m.Invalidate(old.ID())
+				sess, err = m.InitSession(ctx)
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.setRequestSession(ctx, sess)
+	if err = sess.Set(ctx.Request.Context(), PrincipalKey, principal); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Principal returns the principal stored by Login in the session of the client.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//
+// Returns:
+//   - any: The principal.
+//   - error: An error if the client has no session, or it holds no principal.
+func (m *Manager) Principal(ctx *mist.Context) (any, error) {
+	sess, err := m.GetSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sess.Get(ctx.Request.Context(), PrincipalKey)
+}
+
+// setRequestSession replaces the session retrieved for a request.
+func (m *Manager) setRequestSession(ctx *mist.Context, sess Session) {
+	m.valuesMutex.Lock()
+	defer m.valuesMutex.Unlock()
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	ctx.UserValues[m.CtxSessionKey] = sess
+}
@@ -2,7 +2,11 @@ package session
 
 import (
 	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/singleflight"
 	"github.com/google/uuid"
+	"github.com/hashicorp/golang-lru"
+	"sync"
+	"time"
 )
 
 // The Manager struct acts as a centralized component that orchestrates the session management
@@ -17,6 +21,17 @@ import (
 //     the context of an HTTP request. This allows middleware and handlers to retrieve the session
 //     info from the context using this key, facilitating a standard way of accessing session data
 //     during the processing of a request.
+//   - Codec: The codec serializing session values, e.g. GobCodec or an EncryptedCodec. When
+//     set, the sessions returned by the manager store the encoded bytes of their values, so
+//     that values keep their type in any store. When nil, values are passed to the store as
+//     is.
+//   - CacheTTL: How long the sessions read from the store are cached by the manager, sparing the
+//     store a lookup per request; 0, the default, disables the cache. Keep it short, a few
+//     seconds: a session removed, changed or rotated by another instance is seen only once it
+//     expires, so that an ID rotated by RotateID or Login elsewhere, or removed on logout,
+//     remains accepted by this instance for CacheTTL at most.
+//   - CacheSize: The number of sessions cached, the least recently used being evicted; 0 means
+//     10000.
 //
 // The inclusion of both the Store and Propagator interfaces suggests that any instance of Manager is
 // capable of performing all session-related operations defined by these interfaces. This includes generating
@@ -45,9 +60,17 @@ import (
 // access handling are considered in their implementations of Store and Propagator to prevent race
 // conditions or data inconsistencies.
 type Manager struct {
-	Store                // Handles storage and retrieval of session data.
-	Propagator           // Manages transmission of session identifiers in HTTP messages.
-	CtxSessionKey string // Key for session object storage in request context.
+	Store                       // Handles storage and retrieval of session data.
+	Propagator                  // Manages transmission of session identifiers in HTTP messages.
+	CtxSessionKey string        // Key for session object storage in request context.
+	Codec         Codec         // Serializes session values; nil stores them as is.
+	CacheTTL      time.Duration // Lifetime of the sessions cached by the manager; 0 disables the cache.
+	CacheSize     int           // Number of sessions cached; 0 means 10000.
+
+	flight      singleflight.Group[Session] // Coalesces the concurrent lookups of a session ID.
+	cacheOnce   sync.Once                   // Creates the cache on first use.
+	cache       *lru.Cache                  // Sessions read from the store, see CacheTTL.
+	valuesMutex sync.Mutex                  // Guards the session in UserValues against fan-out goroutines.
 }
 
 // GetSession is a method that retrieves the current user's session from the HTTP request
@@ -66,7 +89,9 @@ type Manager struct {
 //     identifier from the incoming HTTP request, which is typically read from a cookie or request header.
 //  5. With the session identifier obtained, the method then fetches the actual session data using the
 //     Store interface's Get method. This method call also passes along the context from the request to handle
-//     any session-related context operations such as deadlines or cancellations.
+//     any session-related context operations such as deadlines or cancellations. Concurrent fetches of the
+//     same session, from the goroutines of a request or from concurrent requests, share one call of the
+//     store, and the session is served from the cache of the manager when CacheTTL is set.
 //  6. After the session is successfully retrieved, it is stored in the UserValues map using the CtxSessionKey
 //     for quick access during subsequent calls within the same request lifecycle.
 //  7. Finally, the actual session data or an error (if any occurred while retrieving the session identifier
@@ -83,15 +108,9 @@ type Manager struct {
 // This method should be called by middlewares or handlers that require access to the current user's session.
 // It exempts them from having to handle low-level session extraction and storage mechanisms directly.
 func (m *Manager) GetSession(ctx *mist.Context) (Session, error) {
-	// Ensure the map used to store values in the context is initialized.
-	if ctx.UserValues == nil {
-		ctx.UserValues = make(map[string]any, 1)
-	}
-
 	// Attempt to retrieve the session from the cache in the user values map.
-	val, ok := ctx.UserValues[m.CtxSessionKey]
-	if ok {
-		return val.(Session), nil
+	if session, ok := m.requestSession(ctx); ok {
+		return session, nil
 	}
 
 	// Session not found in cache, so extract the session ID from the HTTP request.
@@ -101,16 +120,37 @@ func (m *Manager) GetSession(ctx *mist.Context) (Session, error) {
 	}
 
 	// Retrieve the session data using the extracted session ID.
-	session, err := m.Store.Get(ctx.Request.Context(), sessId)
+	session, err := m.fetch(ctx.Request.Context(), sessId)
 	if err != nil {
 		return nil, err
 	}
+	session = m.withCodec(session)
 
-	// Store the session in the map for quick access during this request lifecycle.
+	// Store the session in the map for quick access during this request lifecycle; a goroutine
+	// of the request may have stored it first.
+	m.valuesMutex.Lock()
+	defer m.valuesMutex.Unlock()
+	if ctx.UserValues == nil {
+		ctx.UserValues = make(map[string]any, 1)
+	}
+	if val, ok := ctx.UserValues[m.CtxSessionKey]; ok {
+		return val.(Session), nil
+	}
 	ctx.UserValues[m.CtxSessionKey] = session
 	return session, nil
 }
 
+// requestSession returns the session already retrieved for a request.
+func (m *Manager) requestSession(ctx *mist.Context) (Session, bool) {
+	m.valuesMutex.Lock()
+	defer m.valuesMutex.Unlock()
+	val, ok := ctx.UserValues[m.CtxSessionKey]
+	if !ok {
+		return nil, false
+	}
+	return val.(Session), true
+}
+
 // InitSession is responsible for creating a new session and associating it with the client who initiated
 // the HTTP request. It is typically called when a new user visits the application and a new session needs to
 // be established. The method leverages the capabilities of the embedded interfaces within the Manager struct
@@ -170,7 +210,7 @@ func (m *Manager) InitSession(ctx *mist.Context) (Session, error) {
 
 	// Propagate the new session identifier to the client using the ResponseWriter.
 	err = m.Inject(id, ctx.ResponseWriter)
-	return sess, err // Return the new session and any error from identifier propagation.
+	return m.withCodec(sess), err // Return the new session and any error from identifier propagation.
 }
 
 // RefreshSession is a method that updates an existing session's expiry time to extend its life.
@@ -281,6 +321,7 @@ func (m *Manager) RemoveSession(ctx *mist.Context) error {
 
 	// Remove the session from the store using the session ID.
 	err = m.Store.Remove(ctx.Request.Context(), sess.ID())
+	m.Invalidate(sess.ID())
 	if err != nil {
 		return err // If there's an error removing the session from the store, return the error.
 	}
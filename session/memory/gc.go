@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// GCStats describes a garbage collection cycle of a Store.
+//
+// Fields:
+//   - Scanned: The number of sessions examined.
+//   - Expired: The number of expired sessions removed.
+//   - Remaining: The number of sessions left in the store.
+//   - Duration: The duration of the cycle.
+type GCStats struct {
+	Scanned   int
+	Expired   int
+	Remaining int
+	Duration  time.Duration
+}
+
+// gcConfig holds the garbage collector settings and metrics of a Store; it is guarded by the
+// store mutex.
+type gcConfig struct {
+	interval  time.Duration
+	batchSize int
+	onGC      func(stats GCStats)
+
+	scanned  prometheus.Counter
+	expired  prometheus.Counter
+	duration prometheus.Histogram
+}
+
+// SetGCInterval sets the interval between two garbage collection cycles.
+func (s *Store) SetGCInterval(d time.Duration) *Store {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.gc.interval = d
+	return s
+}
+
+// SetGCBatchSize sets how many sessions a garbage collection batch examines while holding the
+// lock.
+func (s *Store) SetGCBatchSize(n int) *Store {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if n < 1 {
+		n = 1
+	}
+	s.gc.batchSize = n
+	return s
+}
+
+// OnGC sets a function receiving the statistics of every garbage collection cycle, e.g. to
+// log them with the application logger.
+func (s *Store) OnGC(fn func(stats GCStats)) *Store {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.gc.onGC = fn
+	return s
+}
+
+// SetMetrics exposes the garbage collector in Prometheus metrics registered with the default
+// registry, named "<namespace>_<subsystem>_" followed by:
+//   - "sessions": the number of sessions in the store,
+//   - "session_gc_scanned_total": the number of sessions examined,
+//   - "session_gc_expired_total": the number of expired sessions removed,
+//   - "session_gc_duration_seconds": the duration of the cycles.
+//
+// It panics if the metrics are already registered.
+func (s *Store) SetMetrics(namespace string, subsystem string) *Store {
+	size := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "sessions",
+		Help:      "Number of sessions in the memory store.",
+	}, func() float64 {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		return float64(len(s.sessions))
+	})
+	scanned := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "session_gc_scanned_total",
+		Help:      "Number of sessions examined by the garbage collector.",
+	})
+	expired := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "session_gc_expired_total",
+		Help:      "Number of expired sessions removed by the garbage collector.",
+	})
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "session_gc_duration_seconds",
+		Help:      "Duration of the garbage collection cycles.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+	prometheus.MustRegister(size, scanned, expired, duration)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.gc.scanned, s.gc.expired, s.gc.duration = scanned, expired, duration
+	return s
+}
+
+// GC runs a garbage collection cycle: it removes the expired sessions of a batch, and goes on
+// with another batch as long as more than a quarter of the sessions examined were expired,
+// for at most a quarter of the GC interval. Sessions of stores with few expired sessions are
+// thus removed over several cycles, without ever holding the lock for long.
+//
+// Returns:
+//   - GCStats: The statistics of the cycle.
+func (s *Store) GC() GCStats {
+	start := time.Now()
+	s.mutex.RLock()
+	cfg := s.gc
+	s.mutex.RUnlock()
+	budget := cfg.interval / 4
+
+	var stats GCStats
+	for {
+		scanned, expired, remaining := s.gcBatch(cfg.batchSize)
+		stats.Scanned += scanned
+		stats.Expired += expired
+		stats.Remaining = remaining
+		// A batch smaller than the batch size has examined the whole store.
+		if scanned < cfg.batchSize || expired*4 <= scanned || time.Since(start) > budget {
+			break
+		}
+	}
+	stats.Duration = time.Since(start)
+
+	if cfg.scanned != nil {
+		cfg.scanned.Add(float64(stats.Scanned))
+		cfg.expired.Add(float64(stats.Expired))
+		cfg.duration.Observe(stats.Duration.Seconds())
+	}
+	if cfg.onGC != nil {
+		cfg.onGC(stats)
+	}
+	return stats
+}
+
+// gcBatch examines up to n sessions, starting at a random position of the map, and removes
+// the expired ones.
+func (s *Store) gcBatch(n int) (scanned int, expired int, remaining int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	for id, e := range s.sessions {
+		if scanned == n {
+			break
+		}
+		scanned++
+		if !now.Before(e.expiresAt) {
+			delete(s.sessions, id)
+			expired++
+		}
+	}
+	return scanned, expired, len(s.sessions)
+}
+
+// gcWorker runs the garbage collection cycles until the store is closed.
+func (s *Store) gcWorker() {
+	for {
+		s.mutex.RLock()
+		interval := s.gc.interval
+		s.mutex.RUnlock()
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.GC()
+		}
+	}
+}
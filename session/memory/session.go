@@ -4,7 +4,6 @@ import (
 	"context"
 	"github.com/dormoron/mist/internal/errs"
 	"github.com/dormoron/mist/session"
-	"github.com/patrickmn/go-cache"
 	"sync"
 	"time"
 )
@@ -13,30 +12,44 @@ import (
 // access to session data and ensures that session information is stored and retrieved
 // efficiently with an automated expiration policy.
 //
+// Expired sessions are never returned, and are removed by an incremental garbage collector:
+// every GC interval it samples a bounded batch of sessions, deletes the expired ones, and goes
+// on with another batch only while many of the sampled sessions were expired. The lock is held
+// for one batch at a time, so collecting a large store does not stall requests.
+//
 // Fields:
-//   - mutex sync.RWMutex: A read/write mutual exclusion lock. It is used to ensure that
-//     only one goroutine can write to the sessions cache at a time and that there can be
-//     multiple concurrent readers. This ensures that the sessions cache is safe to use
-//     concurrently across multiple goroutines without data race conditions.
-//   - sessions *cache.Cache: A pointer to an instance of a cache that stores session data.
-//     This cache library typically provides a fast in-memory key:value store with
-//     expiration capabilities for stored items. The pointer allows the Store to manage
-//     sessions in a centralized manner.
+//   - mutex sync.RWMutex: A read/write mutual exclusion lock guarding the sessions map.
+//   - sessions map[string]*entry: The sessions with their expiry times.
 //   - expiration time.Duration: A duration after which a session is considered expired
-//     and can be removed from the cache. This value sets a time limit on how long
-//     session data should persist in the cache before being automatically deleted.
+//     and can be removed from the store.
+//   - gc: The garbage collector settings and metrics.
 type Store struct {
-	// mutex prevents race conditions when accessing the sessions cache by enforcing
+	// mutex prevents race conditions when accessing the sessions map by enforcing
 	// exclusive write locks and allowing concurrent read locks.
 	mutex sync.RWMutex
 
-	// sessions is an in-memory cache that holds session information. Each entry in
-	// this cache represents a unique session with its associated data.
-	sessions *cache.Cache
+	// sessions holds session information. Each entry in this map represents a unique
+	// session with its associated data and expiry time.
+	sessions map[string]*entry
 
 	// expiration specifies the duration for which the session data is valid. After this
-	// duration, the session data is considered stale and may be purged from the cache.
+	// duration, the session data is considered stale and may be purged from the store.
 	expiration time.Duration
+
+	// gc holds the garbage collector settings and metrics.
+	gc gcConfig
+
+	// stop stops the garbage collector.
+	stop chan struct{}
+
+	// closeOnce ensures the garbage collector is stopped once.
+	closeOnce sync.Once
+}
+
+// entry is a stored session with its expiry time.
+type entry struct {
+	sess      *Session
+	expiresAt time.Time
 }
 
 // InitStore initializes and returns a new Store instance with the specified expiration duration.
@@ -44,44 +57,38 @@ type Store struct {
 // The Store instance created by this function is prepared to manage session data with an
 // automated expiration policy, which purges the session data after the specified duration.
 // A store instance provides a thread-safe way to interact with session data across multiple
-// goroutines.
+// goroutines. Its garbage collector runs every second with batches of 100 sessions until
+// Close is called.
 //
 // Parameters:
 //   - expiration time.Duration: The duration after which sessions should expire and be removed
-//     from the cache. This duration dictates how long a session will be kept in memory before
+//     from the store. This duration dictates how long a session will be kept in memory before
 //     being deleted automatically.
 //
 // Returns:
-//   - *Store: A pointer to a newly created Store instance, which holds the session cache and
+//   - *Store: A pointer to a newly created Store instance, which holds the sessions and
 //     the expiration policy for session data.
 //
 // Example:
 // To create a store with a 30-minute expiration period for sessions, call InitStore with
 // time.Minute * 30 as the parameter.
 func InitStore(expiration time.Duration) *Store {
-	// Create a new Store instance with a cache that has a specific expiration time.
-	// Each session will last for the duration of 'expiration' before being automatically
-	// removed from the cache.
-	return &Store{
-		// The cache.New function is invoked with the expiration duration and a cleanup
-		// interval of one second. The cleanup interval specifies how often the cache
-		// should check for expired items to remove.
-		sessions: cache.New(expiration, time.Second),
-
-		// the expiration field is set to the duration passed into the function, ensuring all
-		// sessions adhere to this expiration policy.
+	s := &Store{
+		sessions:   make(map[string]*entry),
 		expiration: expiration,
+		gc: gcConfig{
+			interval:  time.Second,
+			batchSize: 100,
+		},
+		stop: make(chan struct{}),
 	}
+	go s.gcWorker()
+	return s
 }
 
-// Generate creates a new session with the specified ID and stores it in the Store's session
-// cache. It ensures that the session is safely created and stored even when accessed by
-// multiple goroutines simultaneously.
-//
-// The function locks the Store's mutex before creating the new session to prevent
-// concurrent write access, providing thread safety. It then adds the session to the
-// store's cache with the predefined expiration policy before returning the session to the
-// caller.
+// Generate creates a new session with the specified ID and stores it in the Store. It
+// ensures that the session is safely created and stored even when accessed by multiple
+// goroutines simultaneously.
 //
 // Parameters:
 //   - ctx context.Context: The context in which the session is generated. The context
@@ -93,17 +100,10 @@ func InitStore(expiration time.Duration) *Store {
 //   - session.Session: The newly created session object with the provided ID.
 //   - error: Any errors encountered during the generation of the session; returns nil
 //     since this implementation does not produce errors.
-//
-// This method may need to be updated if error-handling logic is introduced, such as when
-// checks for existing session IDs need to be implemented or if the cache.Set method could
-// potentially return an error.
 func (s *Store) Generate(ctx context.Context, id string) (session.Session, error) {
-	// Lock the mutex to ensure exclusive access to the sessions cache while a new session
-	// is being generated and added to the cache. This prevents data races on writes.
+	// Lock the mutex to ensure exclusive access to the sessions map while a new session
+	// is being generated and added. This prevents data races on writes.
 	s.mutex.Lock()
-	// Unlock the mutex when the function finishes. Defer is used to ensure that unlock
-	// happens at the end of the function execution, even if an error occurs or a panic is
-	// triggered, which provides safety against deadlocks.
 	defer s.mutex.Unlock()
 
 	// Initialize a new Session with the given ID and an empty concurrent-safe map
@@ -113,20 +113,16 @@ func (s *Store) Generate(ctx context.Context, id string) (session.Session, error
 		values: sync.Map{}, // Initialize a concurrent-safe map for storing session values.
 	}
 
-	// Add the newly created session to the cache with the Store's expiration duration
-	// policy, so it gets automatically evicted from cache when it expires.
-	s.sessions.Set(id, sess, s.expiration)
+	// Store the session with the Store's expiration policy, so it gets evicted once it expires.
+	s.sessions[id] = &entry{sess: sess, expiresAt: time.Now().Add(s.expiration)}
 
 	// Return the new session and nil since no error can occur in the current implementation.
 	return sess, nil
 }
 
 // Refresh updates the expiration time of an existing session, effectively "refreshing" it.
-// This method looks up a session by its ID and, if found, extends its life in the Store's
-// cache according to the Store's expiration policy.
-//
-// The method provides thread safety by locking the Store's mutex, thereby preventing
-// concurrent access to the sessions cache during the update process.
+// This method looks up a session by its ID and, if found, extends its life according to the
+// Store's expiration policy.
 //
 // Parameters:
 //   - ctx context.Context: The context in which the session refresh is executed. The context
@@ -135,38 +131,29 @@ func (s *Store) Generate(ctx context.Context, id string) (session.Session, error
 //   - id string: The unique identifier of the session that is being refreshed.
 //
 // Returns:
-//   - error: An error is returned if the session with the specified ID cannot be found;
-//     otherwise, nil is returned after successfully refreshing the session expiration time.
-//
-// This method assumes that the errs.ErrIdSessionNotFound function returns a relevant
-// error when a session with a given ID does not exist.
+//   - error: An error is returned if the session with the specified ID cannot be found or
+//     has expired; otherwise, nil is returned after successfully refreshing the session
+//     expiration time.
 func (s *Store) Refresh(ctx context.Context, id string) error {
-	// Lock the mutex to ensure exclusive access to the sessions cache during the refresh
-	// operation. This is crucial to prevent any concurrent write or read operations that
-	// might affect the consistency of the data.
+	// Lock the mutex to ensure exclusive access to the sessions map during the refresh
+	// operation.
 	s.mutex.Lock()
-	// Defer the Unlock operation to ensure that the mutex is always released at the end of
-	// the method's execution, regardless of where the function exits, which prevents
-	// potential deadlocks.
 	defer s.mutex.Unlock()
 
-	// Attempt to retrieve the session with the specified ID from the cache.
-	val, ok := s.sessions.Get(id)
-	if !ok {
-		// If the session is not found, return an error indicating the session ID does not
-		// exist, using a custom error function assumed to be defined in the 'errs' package.
+	// Attempt to retrieve the session with the specified ID; an expired session that the
+	// garbage collector has not removed yet cannot be refreshed.
+	now := time.Now()
+	e, ok := s.sessions[id]
+	if !ok || !now.Before(e.expiresAt) {
 		return errs.ErrIdSessionNotFound()
 	}
 
-	// If the session is found, reset its expiration time in the cache using the
-	// predefined expiration duration of the Store.
-	s.sessions.Set(id, val, s.expiration)
-
-	// Return nil as no errors occurred during the refresh operation.
+	// Reset its expiration time using the predefined expiration duration of the Store.
+	e.expiresAt = now.Add(s.expiration)
 	return nil
 }
 
-// Remove deletes a session from the Store's session cache using the provided session ID.
+// Remove deletes a session from the Store using the provided session ID.
 // It's designed to ensure thread-safe deletion of session data, avoiding concurrent access issues.
 //
 // Parameters:
@@ -174,31 +161,41 @@ func (s *Store) Refresh(ctx context.Context, id string) error {
 //     typically contains information about deadlines, cancellation signals, and other
 //     request-scoped values relevant to the operation. However, the context is not directly
 //     utilized within this function.
-//   - id string: The unique identifier of the session to be removed from the cache.
+//   - id string: The unique identifier of the session to be removed from the store.
 //
 // Returns:
-//   - error: An error is returned if any issues occur during the deletion process;
-//     however, in this implementation, the function always returns nil, indicating success.
-//
-// It's important to handle potential errors in future revisions of this method, particularly
-// when operations that can fail are introduced.
+//   - error: Always nil, indicating success.
 func (s *Store) Remove(ctx context.Context, id string) error {
-	// Lock the mutex to prevent other goroutines from modifying the session cache
+	// Lock the mutex to prevent other goroutines from modifying the sessions map
 	// concurrently, guaranteeing the safe deletion of a session.
 	s.mutex.Lock()
-	// Unlock the mutex when the function is complete. Using defer ensures the mutex is
-	// released even if an unexpected panic occurs, preventing deadlocks.
 	defer s.mutex.Unlock()
 
-	// Delete the session with the given ID from the cache. The Delete method does not return
-	// an error, so there's no error handling needed here. If error possibilities are introduced
-	// in future implementations, they should be handled accordingly.
-	s.sessions.Delete(id)
-
-	// Return nil to indicate that the session has been successfully removed.
+	delete(s.sessions, id)
 	return nil
 }
 
+// Rotate moves a session to a new ID, copying its values, under the lock of the store.
+//
+// Returns:
+//   - session.Session: The session with the new ID.
+//   - error: An error if no live session has oldID, or a session already has newID.
+func (s *Store) Rotate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	e, ok := s.sessions[oldID]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return nil, errs.ErrIdSessionNotFound()
+	}
+	if _, taken := s.sessions[newID]; taken {
+		return nil, errs.ErrSessionIDTaken(newID)
+	}
+	sess := e.sess.copyTo(newID)
+	s.sessions[newID] = &entry{sess: sess, expiresAt: e.expiresAt}
+	delete(s.sessions, oldID)
+	return sess, nil
+}
+
 // Get retrieves the session associated with the provided ID from the store.
 // It features thread safety by using a read lock to allow multiple concurrent
 // read operations while preventing write operations, ensuring data consistency.
@@ -211,32 +208,29 @@ func (s *Store) Remove(ctx context.Context, id string) error {
 //
 // Returns:
 // - session.Session: The session object associated with the ID, if found.
-// - error: An error if no session is found with the given ID, otherwise nil.
-//
-// If future versions of the Get function introduce returnable errors in other
-// situations, this documentation and implementation may need to be updated
-// accordingly.
+// - error: An error if no live session is found with the given ID, otherwise nil.
 func (s *Store) Get(ctx context.Context, id string) (session.Session, error) {
 	// Use a read lock (RLock) to allow for concurrent read access to the sessions
-	// cache by multiple goroutines, while still preventing any writes, maintaining
-	// data consistency and integrity.
+	// map by multiple goroutines, while still preventing any writes.
 	s.mutex.RLock()
-	// Ensure the read lock is released after this function's execution completes.
-	// This is essential to ensure that it doesn't block subsequent write operations.
 	defer s.mutex.RUnlock()
 
-	// Attempt to retrieve the session using the provided ID.
-	sess, ok := s.sessions.Get(id)
-	if !ok {
-		// If the session is not found, return an appropriate error. Assumes that
-		// errs.ErrSessionNotFound is a function returning a standardized error message.
+	// Attempt to retrieve the session using the provided ID. Expired sessions are reported
+	// as missing even before the garbage collector removes them.
+	e, ok := s.sessions[id]
+	if !ok || !time.Now().Before(e.expiresAt) {
 		return nil, errs.ErrSessionNotFound()
 	}
+	return e.sess, nil
+}
 
-	// Assert that the interface{} type returned from sessions.Get is indeed a *Session.
-	// This is necessary because the underlying data structure is generic and can store
-	// various types.
-	return sess.(*Session), nil
+// Close stops the garbage collector of the store. The store remains usable, but expired
+// sessions are no longer removed.
+func (s *Store) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
 }
 
 // Session is a data structure that represents a user session in a concurrent environment.
@@ -327,3 +321,13 @@ func (s *Session) ID() string {
 	// hence it is safe to access without additional synchronization mechanisms.
 	return s.id
 }
+
+// copyTo returns a copy of the session with another ID.
+func (s *Session) copyTo(id string) *Session {
+	sess := &Session{id: id}
+	s.values.Range(func(key, value any) bool {
+		sess.values.Store(key, value)
+		return true
+	})
+	return sess
+}
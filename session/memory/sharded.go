@@ -0,0 +1,452 @@
+package memory
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/gob"
+	"github.com/dormoron/mist/internal/errs"
+	"github.com/dormoron/mist/session"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ShardedStore is an in-memory session store for production use:
+//   - sessions are spread over shards with their own lock, so concurrent requests rarely
+//     contend,
+//   - expiry is scheduled on a hierarchical timing wheel per shard, so expiring sessions costs
+//     O(1) each instead of periodic scans,
+//   - the number of sessions can be bounded, evicting the sessions closest to expiry first,
+//   - sessions can be saved to disk and restored, so that restarts do not sign every user out.
+//
+// Since all sessions share the same expiration, the sessions closest to expiry are the least
+// recently refreshed ones.
+type ShardedStore struct {
+	shards     []*shard
+	expiration time.Duration
+	tick       time.Duration
+	maxEntries int
+	onEvict    func(id string)
+	stop       chan struct{}
+	closeOnce  sync.Once
+}
+
+// shard is a partition of a ShardedStore.
+type shard struct {
+	mutex   sync.RWMutex
+	entries map[string]*shardEntry
+	// lru orders the sessions by expiry, the front expiring first.
+	lru   *list.List
+	wheel *timingWheel
+	max   int
+}
+
+// shardEntry is a session stored in a shard.
+type shardEntry struct {
+	sess      *Session
+	expiresAt time.Time
+	elem      *list.Element
+}
+
+// ShardedStoreOption configures a ShardedStore.
+type ShardedStoreOption func(s *ShardedStore)
+
+// WithShards sets the number of shards, rounded up to a power of two. The default is 32.
+func WithShards(n int) ShardedStoreOption {
+	return func(s *ShardedStore) {
+		size := 1
+		for size < n {
+			size <<= 1
+		}
+		s.shards = make([]*shard, size)
+	}
+}
+
+// WithMaxEntries bounds the number of sessions; when a shard is full, creating a session
+// evicts the session of the shard closest to expiry. The bound is split evenly over the
+// shards. The default, 0, is unbounded.
+func WithMaxEntries(n int) ShardedStoreOption {
+	return func(s *ShardedStore) {
+		s.maxEntries = n
+	}
+}
+
+// WithTick sets the resolution of the expiry: sessions are removed at most one tick after
+// they expire. The default is one second.
+func WithTick(d time.Duration) ShardedStoreOption {
+	return func(s *ShardedStore) {
+		s.tick = d
+	}
+}
+
+// WithEvictFunc sets a function called with the ID of every session evicted because the store
+// is full, e.g. to count evictions.
+func WithEvictFunc(fn func(id string)) ShardedStoreOption {
+	return func(s *ShardedStore) {
+		s.onEvict = fn
+	}
+}
+
+// InitShardedStore creates a ShardedStore whose sessions expire after expiration. The store
+// expires sessions in the background until Close is called.
+//
+// Example:
+//
+//	store := memory.InitShardedStore(30*time.Minute, memory.WithMaxEntries(1_000_000))
+//	if err := store.LoadFile("/var/lib/app/sessions.gob"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+//	    log.Println(err)
+//	}
+//	defer store.SaveFile("/var/lib/app/sessions.gob")
+//
+// Parameters:
+//   - expiration: The duration after which sessions expire unless refreshed.
+//   - opts: The options.
+//
+// Returns:
+//   - *ShardedStore: The initialized store.
+func InitShardedStore(expiration time.Duration, opts ...ShardedStoreOption) *ShardedStore {
+	s := &ShardedStore{
+		shards:     make([]*shard, 32),
+		expiration: expiration,
+		tick:       time.Second,
+		stop:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	perShard := 0
+	if s.maxEntries > 0 {
+		perShard = (s.maxEntries + len(s.shards) - 1) / len(s.shards)
+	}
+	now := time.Now()
+	for i := range s.shards {
+		sh := &shard{
+			entries: make(map[string]*shardEntry),
+			lru:     list.New(),
+			max:     perShard,
+		}
+		sh.wheel = newTimingWheel(s.tick, now, sh.deadline)
+		s.shards[i] = sh
+	}
+	go s.expireWorker()
+	return s
+}
+
+// shard returns the shard of a session ID.
+func (s *ShardedStore) shard(id string) *shard {
+	return s.shards[s.shardIndex(id)]
+}
+
+// shardIndex returns the index of the shard of a session ID, from its FNV-1a hash.
+func (s *ShardedStore) shardIndex(id string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return h & uint32(len(s.shards)-1)
+}
+
+// Generate creates a session with the given ID, replacing any session with the same ID. If
+// the shard of the session is full, the session of the shard closest to expiry is evicted.
+func (s *ShardedStore) Generate(ctx context.Context, id string) (session.Session, error) {
+	sess := &Session{id: id}
+	sh := s.shard(id)
+	sh.mutex.Lock()
+	evicted := sh.put(sess, time.Now().Add(s.expiration))
+	sh.mutex.Unlock()
+	if evicted != "" && s.onEvict != nil {
+		s.onEvict(evicted)
+	}
+	return sess, nil
+}
+
+// Refresh extends the life of a session by the store expiration.
+//
+// Returns:
+//   - error: An error if no live session has the ID.
+func (s *ShardedStore) Refresh(ctx context.Context, id string) error {
+	sh := s.shard(id)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+	now := time.Now()
+	e, ok := sh.entries[id]
+	if !ok || !now.Before(e.expiresAt) {
+		return errs.ErrIdSessionNotFound()
+	}
+	e.expiresAt = now.Add(s.expiration)
+	sh.lru.MoveToBack(e.elem)
+	sh.wheel.schedule(id, e.expiresAt)
+	return nil
+}
+
+// Remove deletes a session.
+func (s *ShardedStore) Remove(ctx context.Context, id string) error {
+	sh := s.shard(id)
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+	sh.remove(id)
+	return nil
+}
+
+// Rotate moves a session to a new ID, copying its values, holding the locks of both shards.
+//
+// Returns:
+//   - session.Session: The session with the new ID.
+//   - error: An error if no live session has oldID, or a session already has newID.
+func (s *ShardedStore) Rotate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	sess, evicted, err := s.rotate(oldID, newID)
+	if evicted != "" && s.onEvict != nil {
+		s.onEvict(evicted)
+	}
+	return sess, err
+}
+
+// rotate moves a session to a new ID under the locks of both shards, and returns the ID of the
+// session evicted from the shard of newID, if any.
+func (s *ShardedStore) rotate(oldID string, newID string) (session.Session, string, error) {
+	from, to := s.shard(oldID), s.shard(newID)
+	// Lock the shards in a fixed order, so that concurrent rotations do not deadlock.
+	first, second := from, to
+	if s.shardIndex(newID) < s.shardIndex(oldID) {
+		first, second = to, from
+	}
+	first.mutex.Lock()
+	defer first.mutex.Unlock()
+	if second != first {
+		second.mutex.Lock()
+		defer second.mutex.Unlock()
+	}
+	e, ok := from.entries[oldID]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return nil, "", errs.ErrIdSessionNotFound()
+	}
+	if _, taken := to.entries[newID]; taken {
+		return nil, "", errs.ErrSessionIDTaken(newID)
+	}
+	sess := e.sess.copyTo(newID)
+	from.remove(oldID)
+	return sess, to.put(sess, e.expiresAt), nil
+}
+
+// Get returns a live session.
+//
+// Returns:
+//   - session.Session: The session.
+//   - error: An error if no live session has the ID.
+func (s *ShardedStore) Get(ctx context.Context, id string) (session.Session, error) {
+	sh := s.shard(id)
+	sh.mutex.RLock()
+	defer sh.mutex.RUnlock()
+	e, ok := sh.entries[id]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		return nil, errs.ErrSessionNotFound()
+	}
+	return e.sess, nil
+}
+
+// Len returns the number of sessions in the store, including expired sessions not removed
+// yet.
+func (s *ShardedStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		n += len(sh.entries)
+		sh.mutex.RUnlock()
+	}
+	return n
+}
+
+// Close stops expiring sessions in the background.
+func (s *ShardedStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+// snapshotEntry is the encoding of a session in a snapshot.
+type snapshotEntry struct {
+	ID        string
+	ExpiresAt time.Time
+	Values    map[string]any
+}
+
+// Snapshot writes the live sessions to w with encoding/gob, one shard at a time so that the
+// store keeps serving requests. The concrete types of session values other than basic types
+// must be registered with gob.Register.
+//
+// Returns:
+//   - error: The encoding or write error.
+func (s *ShardedStore) Snapshot(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		batch := make([]snapshotEntry, 0, len(sh.entries))
+		for id, e := range sh.entries {
+			if !now.Before(e.expiresAt) {
+				continue
+			}
+			values := make(map[string]any)
+			e.sess.values.Range(func(key, value any) bool {
+				if k, ok := key.(string); ok {
+					values[k] = value
+				}
+				return true
+			})
+			batch = append(batch, snapshotEntry{ID: id, ExpiresAt: e.expiresAt, Values: values})
+		}
+		sh.mutex.RUnlock()
+		if err := enc.Encode(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads sessions written by Snapshot from r and adds them to the store with their
+// remaining lifetime, skipping the sessions that expired meanwhile. The snapshot may come
+// from a store with another number of shards.
+//
+// Returns:
+//   - error: The decoding or read error.
+func (s *ShardedStore) Restore(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	var entries []snapshotEntry
+	for {
+		var batch []snapshotEntry
+		if err := dec.Decode(&batch); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		entries = append(entries, batch...)
+	}
+	// Inserting in expiry order appends every session at the back of the eviction order.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ExpiresAt.Before(entries[j].ExpiresAt) })
+
+	now := time.Now()
+	for _, se := range entries {
+		if !now.Before(se.ExpiresAt) {
+			continue
+		}
+		sess := &Session{id: se.ID}
+		for k, v := range se.Values {
+			sess.values.Store(k, v)
+		}
+		sh := s.shard(se.ID)
+		sh.mutex.Lock()
+		evicted := sh.put(sess, se.ExpiresAt)
+		sh.mutex.Unlock()
+		if evicted != "" && s.onEvict != nil {
+			s.onEvict(evicted)
+		}
+	}
+	return nil
+}
+
+// SaveFile writes a snapshot to the file at path, replacing it atomically.
+func (s *ShardedStore) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	buf := bufio.NewWriter(tmp)
+	if err = s.Snapshot(buf); err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile restores the snapshot of the file at path. It returns an error wrapping
+// fs.ErrNotExist if there is no snapshot yet.
+func (s *ShardedStore) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Restore(bufio.NewReader(f))
+}
+
+// expireWorker advances the timing wheels every tick until the store is closed.
+func (s *ShardedStore) expireWorker() {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			for _, sh := range s.shards {
+				sh.mutex.Lock()
+				for _, id := range sh.wheel.advance(now) {
+					sh.remove(id)
+				}
+				sh.mutex.Unlock()
+			}
+		}
+	}
+}
+
+// put stores a session expiring at expiresAt and returns the ID of the session evicted to make
+// room, if any. The caller holds the lock.
+func (sh *shard) put(sess *Session, expiresAt time.Time) string {
+	sh.remove(sess.id)
+	evicted := ""
+	if sh.max > 0 && len(sh.entries) >= sh.max {
+		if front := sh.lru.Front(); front != nil {
+			evicted = front.Value.(string)
+			sh.remove(evicted)
+		}
+	}
+	e := &shardEntry{sess: sess, expiresAt: expiresAt}
+	// Restored sessions may expire before the most recent ones: keep the list ordered.
+	mark := sh.lru.Back()
+	for mark != nil && sh.entries[mark.Value.(string)].expiresAt.After(expiresAt) {
+		mark = mark.Prev()
+	}
+	if mark == nil {
+		e.elem = sh.lru.PushFront(sess.id)
+	} else {
+		e.elem = sh.lru.InsertAfter(sess.id, mark)
+	}
+	sh.entries[sess.id] = e
+	sh.wheel.schedule(sess.id, expiresAt)
+	return evicted
+}
+
+// remove deletes a session. The caller holds the lock.
+func (sh *shard) remove(id string) {
+	e, ok := sh.entries[id]
+	if !ok {
+		return
+	}
+	delete(sh.entries, id)
+	sh.lru.Remove(e.elem)
+	sh.wheel.cancel(id)
+}
+
+// deadline returns the expiry of a session, for the timing wheel. The caller holds the lock.
+func (sh *shard) deadline(id string) (time.Time, bool) {
+	e, ok := sh.entries[id]
+	if !ok {
+		return time.Time{}, false
+	}
+	return e.expiresAt, true
+}
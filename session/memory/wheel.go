@@ -0,0 +1,103 @@
+package memory
+
+import "time"
+
+const (
+	// wheelBits is the log2 of the number of slots per level of a timing wheel.
+	wheelBits  = 6
+	wheelSlots = 1 << wheelBits
+	wheelMask  = wheelSlots - 1
+	// wheelLevels levels of 64 slots span 64^4 ticks, about 194 days with one-second ticks.
+	wheelLevels = 4
+)
+
+// timingWheel is a hierarchical timing wheel scheduling the expiry of session IDs. Level 0 has
+// one slot per tick; each slot of level n spans 64^n ticks, and its IDs are cascaded to the
+// lower levels when the wheel reaches it. Scheduling, rescheduling and expiring an ID cost
+// O(1), instead of scanning every session. It is not safe for concurrent use.
+type timingWheel struct {
+	tick    time.Duration
+	start   time.Time
+	current int64
+	slots   [wheelLevels][wheelSlots]map[string]struct{}
+	// pos holds the level and slot of every scheduled ID.
+	pos map[string][2]int
+	// deadline returns the expiry of an ID, consulted when cascading.
+	deadline func(id string) (time.Time, bool)
+}
+
+// newTimingWheel creates a timing wheel advancing by tick, starting at start.
+func newTimingWheel(tick time.Duration, start time.Time, deadline func(id string) (time.Time, bool)) *timingWheel {
+	w := &timingWheel{
+		tick:     tick,
+		start:    start,
+		pos:      make(map[string][2]int),
+		deadline: deadline,
+	}
+	for l := range w.slots {
+		for s := range w.slots[l] {
+			w.slots[l][s] = make(map[string]struct{})
+		}
+	}
+	return w
+}
+
+// schedule places id in the slot of its expiry, replacing its previous position.
+func (w *timingWheel) schedule(id string, at time.Time) {
+	w.cancel(id)
+	due := int64((at.Sub(w.start) + w.tick - 1) / w.tick)
+	if due <= w.current {
+		due = w.current + 1
+	}
+	delta := due - w.current
+	level := 0
+	for level < wheelLevels-1 && delta >= int64(1)<<(wheelBits*(level+1)) {
+		level++
+	}
+	if max := int64(1) << (wheelBits * (level + 1)); delta >= max {
+		// Beyond the span of the wheel: park it in the farthest slot, it is rescheduled when
+		// cascaded.
+		due = w.current + max - 1
+	}
+	slot := int((due >> (wheelBits * level)) & wheelMask)
+	w.slots[level][slot][id] = struct{}{}
+	w.pos[id] = [2]int{level, slot}
+}
+
+// cancel removes id from the wheel.
+func (w *timingWheel) cancel(id string) {
+	if p, ok := w.pos[id]; ok {
+		delete(w.slots[p[0]][p[1]], id)
+		delete(w.pos, id)
+	}
+}
+
+// advance moves the wheel to now and returns the IDs that expired.
+func (w *timingWheel) advance(now time.Time) []string {
+	target := int64(now.Sub(w.start) / w.tick)
+	var expired []string
+	for w.current < target {
+		w.current++
+		// Cascade the higher levels whose slot starts at this tick, highest first.
+		for level := wheelLevels - 1; level > 0; level-- {
+			if w.current&(int64(1)<<(wheelBits*level)-1) != 0 {
+				continue
+			}
+			slot := int((w.current >> (wheelBits * level)) & wheelMask)
+			for id := range w.slots[level][slot] {
+				delete(w.slots[level][slot], id)
+				delete(w.pos, id)
+				if at, ok := w.deadline(id); ok {
+					w.schedule(id, at)
+				}
+			}
+		}
+		slot := int(w.current & wheelMask)
+		for id := range w.slots[0][slot] {
+			delete(w.slots[0][slot], id)
+			delete(w.pos, id)
+			expired = append(expired, id)
+		}
+	}
+	return expired
+}
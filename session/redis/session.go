@@ -6,6 +6,7 @@ import (
 	"github.com/dormoron/mist/internal/errs"
 	"github.com/dormoron/mist/session"
 	"github.com/redis/go-redis/v9"
+	"strings"
 	"time"
 )
 
@@ -416,6 +417,35 @@ func (s *Store) Remove(ctx context.Context, id string) error {
 	return err
 }
 
+// Rotate moves a session to a new ID with RENAMENX, which keeps its values and expiry and
+// fails when the new key exists, in one atomic step. In a Redis Cluster, where the keys of the
+// two IDs usually live in different slots, it reports that rotation is unsupported.
+//
+// Returns:
+//   - session.Session: The session with the new ID.
+//   - error: An error if no session has oldID, a session already has newID, or Redis fails.
+func (s *Store) Rotate(ctx context.Context, oldID string, newID string) (session.Session, error) {
+	key := redisKey(s.prefix, newID)
+	renamed, err := s.client.RenameNX(ctx, redisKey(s.prefix, oldID), key).Result()
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "no such key"):
+			return nil, errs.ErrIdSessionNotFound()
+		case strings.HasPrefix(err.Error(), "CROSSSLOT"):
+			return nil, errs.ErrSessionRotationUnsupported()
+		}
+		return nil, err
+	}
+	if !renamed {
+		return nil, errs.ErrSessionIDTaken(newID)
+	}
+	return &Session{
+		id:     newID,
+		key:    key,
+		client: s.client,
+	}, nil
+}
+
 // Get retrieves the session data from the Redis store using the provided session ID. If the session is found, it returns
 // a Session struct which includes the session ID, the Redis key for accessing the session, and the Redis client from
 // the Store. If the session is not found, or any other error occurs, it returns the corresponding error.
@@ -575,9 +605,9 @@ func (s *Session) Set(ctx context.Context, key string, value any) error {
 	// Lua script to be evaluated on the Redis server. The script checks if a hash exists
 	// and sets a key-value pair in the hash if it does.
 	const lua = `
-if redisess.call("exists", KEYS[1])
+if redis.call("exists", KEYS[1]) == 1
 then
-    return redisess.call("hset", KEYS[1], ARGV[1], ARGV[2])
+    return redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
 else
     return -1
 end
@@ -67,6 +67,15 @@ type Store interface {
 	Get(ctx context.Context, id string) (Session, error)      // Retrieve a session's data
 }
 
+// Rotator is implemented by the stores able to move the data of a session to a new ID in one
+// step, which Manager.RotateID relies on to protect against session fixation.
+type Rotator interface {
+	// Rotate moves the session with ID oldID, its values and expiry, to newID, and returns it.
+	// The old ID is no longer valid afterwards. It fails if no live session has oldID, or one
+	// already has newID.
+	Rotate(ctx context.Context, oldID string, newID string) (Session, error)
+}
+
 // Session is an interface that defines the contract for a session management system.
 // In web applications, a session represents a single user's interactions with the application
 // across multiple requests. It is used to store and retrieve data specific to a user or session scope.
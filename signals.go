@@ -0,0 +1,138 @@
+package mist
+
+import (
+	"context"
+	"errors"
+	"github.com/dormoron/mist/internal/errs"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunOption configures RunWithSignals.
+type RunOption func(cfg *runConfig)
+
+// runConfig holds the configuration of RunWithSignals.
+type runConfig struct {
+	signals      []os.Signal
+	preStopDelay time.Duration
+	gracePeriod  time.Duration
+	setReady     func(ready bool)
+}
+
+// RunWithPreStopDelay sets how long the server keeps serving after the termination signal,
+// while reporting itself not ready, before it stops accepting connections. It gives the load
+// balancers and the Kubernetes endpoints controller time to stop routing traffic to the pod;
+// without it, requests sent in that window are refused. A second signal skips the delay.
+func RunWithPreStopDelay(d time.Duration) RunOption {
+	return func(cfg *runConfig) {
+		cfg.preStopDelay = d
+	}
+}
+
+// RunWithGracePeriod sets how long the in-flight requests and the asynchronous work have to
+// complete once the server stops accepting connections. Keep the pre-stop delay plus the grace
+// period below the terminationGracePeriodSeconds of the pod. The default is 25 seconds.
+func RunWithGracePeriod(d time.Duration) RunOption {
+	return func(cfg *runConfig) {
+		cfg.gracePeriod = d
+	}
+}
+
+// RunWithReadiness sets the function flipping the readiness of the process, such as
+// health.Checker.SetReady. It is called with false as soon as the termination signal arrives,
+// so that readiness probes fail during the pre-stop delay.
+func RunWithReadiness(setReady func(ready bool)) RunOption {
+	return func(cfg *runConfig) {
+		cfg.setReady = setReady
+	}
+}
+
+// RunWithStopSignals sets the signals triggering the shutdown. The default is SIGTERM, sent by
+// Kubernetes and most process managers, and SIGINT.
+func RunWithStopSignals(signals ...os.Signal) RunOption {
+	return func(cfg *runConfig) {
+		cfg.signals = signals
+	}
+}
+
+// RunWithSignals serves on addr until a termination signal arrives, then shuts down the way
+// orchestrators expect:
+//  1. the readiness set with RunWithReadiness flips to false,
+//  2. the server keeps serving for the pre-stop delay set with RunWithPreStopDelay,
+//  3. it stops accepting connections and waits for the in-flight requests and asynchronous
+//     work, for at most the grace period set with RunWithGracePeriod.
+//
+// Example:
+//
+//	checker := health.InitChecker()
+//	server.GET("/readyz", checker.ReadinessHandler())
+//	if err := server.RunWithSignals(":8080",
+//	    mist.RunWithReadiness(checker.SetReady),
+//	    mist.RunWithPreStopDelay(5*time.Second)); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Parameters:
+//   - addr: The TCP address to listen on, e.g. ":8080"; "" serves the listeners declared with
+//     Listen instead.
+//   - opts: The options.
+//
+// Returns:
+//   - error: nil after a graceful shutdown; the listen or serve error, or the shutdown error
+//     when the grace period ran out.
+func (s *HTTPServer) RunWithSignals(addr string, opts ...RunOption) error {
+	cfg := &runConfig{
+		signals:     []os.Signal{syscall.SIGTERM, os.Interrupt},
+		gracePeriod: 25 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	ls := s.listeners
+	if addr != "" {
+		ls = []*listener{{addr: addr, name: addr}}
+	} else if len(ls) == 0 {
+		return errs.ErrNoListener()
+	}
+	served, err := s.startListeners(ls)
+	if err != nil {
+		return err
+	}
+
+	stop := make(chan os.Signal, 2)
+	signal.Notify(stop, cfg.signals...)
+	defer signal.Stop(stop)
+
+	select {
+	case err = <-served:
+		s.closeServers()
+		return err
+	case <-stop:
+	}
+
+	if cfg.setReady != nil {
+		cfg.setReady(false)
+	}
+	if cfg.preStopDelay > 0 {
+		timer := time.NewTimer(cfg.preStopDelay)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.gracePeriod)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	for range ls {
+		if serveErr := <-served; !errors.Is(serveErr, http.ErrServerClosed) && err == nil {
+			err = serveErr
+		}
+	}
+	return err
+}
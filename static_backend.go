@@ -0,0 +1,229 @@
+package mist
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist/internal/awsv4"
+	"github.com/dormoron/mist/internal/errs"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StaticObject is an object read from a StaticBackend.
+//
+// Fields:
+//   - Body: The content of the object; nil when NotModified is set.
+//   - Size: The length of the content in bytes, or -1 when unknown.
+//   - ModTime: The time the object was last modified; zero when unknown.
+//   - ETag: The entity tag of the object, quoted, e.g. `"5d41402a"`; empty when unknown.
+//   - ContentType: The media type stored with the object; empty when unknown.
+//   - MaxAge: How long the object may be cached, overriding the TTL of the StaticCache; zero
+//     when the object does not say.
+//   - NotModified: Whether the backend answered a conditional read with "not modified".
+type StaticObject struct {
+	Body        io.ReadCloser
+	Size        int64
+	ModTime     time.Time
+	ETag        string
+	ContentType string
+	MaxAge      time.Duration
+	NotModified bool
+}
+
+// StaticBackend is the storage StaticResourceHandler serves the files from, such as a local
+// directory with FileBackend or a bucket with S3Backend.
+type StaticBackend interface {
+	// Open reads the object named name, a slash-separated path. The If-None-Match and
+	// If-Modified-Since headers of cond are passed on to the storage when it supports
+	// conditional reads; when the object matches them, Open returns an object with NotModified
+	// set and no Body. A missing object is reported with an error wrapping fs.ErrNotExist.
+	Open(ctx context.Context, name string, cond http.Header) (*StaticObject, error)
+}
+
+// StaticURLSigner is implemented by the backends able to grant temporary access to an object,
+// which StaticResourceHandler redirects clients to in place of proxying the bytes, see
+// StaticWithRedirect.
+type StaticURLSigner interface {
+	// SignedURL returns a URL reading the object named name, valid for expires.
+	SignedURL(name string, expires time.Duration) (string, error)
+}
+
+// FileBackend is a StaticBackend reading files from a local directory. Conditional reads are
+// left to StaticResourceHandler.
+type FileBackend struct {
+	dir string
+}
+
+// InitFileBackend creates a FileBackend reading the files of dir.
+func InitFileBackend(dir string) *FileBackend {
+	return &FileBackend{dir: dir}
+}
+
+// Open opens a file of the directory. Names are rooted in the directory, so that ".." does not
+// lead out of it.
+func (b *FileBackend) Open(_ context.Context, name string, _ http.Header) (*StaticObject, error) {
+	f, err := os.Open(filepath.Join(b.dir, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	return &StaticObject{
+		Body:    f,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		ETag:    fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}, nil
+}
+
+// S3Backend is a StaticBackend reading the objects of a bucket through the S3 API: Amazon S3,
+// Google Cloud Storage through its interoperability endpoint with HMAC keys, or compatible
+// stores such as MinIO or Cloudflare R2. Conditional reads are passed on to the store, objects
+// stored with a Cache-Control max-age are cached for that long, and objects can be served from
+// presigned URLs.
+type S3Backend struct {
+	bucket       string
+	region       string
+	accessKeyID  string
+	secretKey    string
+	sessionToken string
+	endpoint     string
+	prefix       string
+	client       *http.Client
+}
+
+// InitS3Backend creates an S3Backend reading a bucket of Amazon S3 at its virtual-hosted
+// endpoint, https://<bucket>.s3.<region>.amazonaws.com.
+//
+// Example:
+//
+//	// Google Cloud Storage
+//	backend := mist.InitS3Backend("assets", "auto", hmacKeyID, hmacSecret).
+//	    SetEndpoint("https://storage.googleapis.com")
+//
+// Parameters:
+//   - bucket: The name of the bucket.
+//   - region: The region of the bucket, e.g. "eu-west-1"; "auto" for Google Cloud Storage and R2.
+//   - accessKeyID, secretAccessKey: The credentials of an identity allowed s3:GetObject.
+//
+// Returns:
+//   - *S3Backend: The initialized backend.
+func InitS3Backend(bucket string, region string, accessKeyID string, secretAccessKey string) *S3Backend {
+	return &S3Backend{
+		bucket:      bucket,
+		region:      region,
+		accessKeyID: accessKeyID,
+		secretKey:   secretAccessKey,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetSessionToken sets the session token of temporary credentials.
+func (b *S3Backend) SetSessionToken(token string) *S3Backend {
+	b.sessionToken = token
+	return b
+}
+
+// SetEndpoint sets the base URL of the store, e.g. "https://storage.googleapis.com" or
+// "http://minio:9000", whose buckets are addressed by path: <endpoint>/<bucket>/<key>.
+func (b *S3Backend) SetEndpoint(endpoint string) *S3Backend {
+	b.endpoint = strings.TrimSuffix(endpoint, "/")
+	return b
+}
+
+// SetPrefix sets the prefix of the keys of the objects, e.g. "static/" to serve the file
+// "app.js" from the key "static/app.js".
+func (b *S3Backend) SetPrefix(prefix string) *S3Backend {
+	b.prefix = prefix
+	return b
+}
+
+// SetClient sets the HTTP client calling the store.
+func (b *S3Backend) SetClient(client *http.Client) *S3Backend {
+	b.client = client
+	return b
+}
+
+// Open reads an object with a GET request, passing on the conditional headers of cond.
+func (b *S3Backend) Open(ctx context.Context, name string, cond http.Header) (*StaticObject, error) {
+	target, err := b.SignedURL(name, time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"If-None-Match", "If-Modified-Since"} {
+		if value := cond.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, errs.ErrStaticBackend(err.Error())
+	}
+	obj := &StaticObject{Size: resp.ContentLength, ETag: resp.Header.Get("ETag")}
+	obj.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	obj.MaxAge = maxAge(resp.Header.Get("Cache-Control"))
+	switch resp.StatusCode {
+	case http.StatusOK:
+		obj.Body = resp.Body
+		obj.ContentType = resp.Header.Get("Content-Type")
+		return obj, nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		obj.Size = -1
+		obj.NotModified = true
+		return obj, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fs.ErrNotExist
+	default:
+		resp.Body.Close()
+		return nil, errs.ErrStaticBackend(fmt.Sprintf("GET %s: %s", name, resp.Status))
+	}
+}
+
+// SignedURL returns a presigned URL of an object, valid for expires, at most 7 days.
+func (b *S3Backend) SignedURL(name string, expires time.Duration) (string, error) {
+	key := b.prefix + strings.TrimPrefix(path.Clean("/"+name), "/")
+	raw := "https://" + b.bucket + ".s3." + b.region + ".amazonaws.com/" + awsv4.EscapePath(key)
+	if b.endpoint != "" {
+		raw = b.endpoint + "/" + awsv4.EscapePath(b.bucket) + "/" + awsv4.EscapePath(key)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errs.ErrStaticBackend(err.Error())
+	}
+	creds := awsv4.Credentials{AccessKeyID: b.accessKeyID, SecretKey: b.secretKey, SessionToken: b.sessionToken}
+	return awsv4.Presign(http.MethodGet, u, creds, b.region, "s3", time.Now(), expires), nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or zero.
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,245 @@
+package mist
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticEntry is a file cached by a StaticResourceHandler.
+type staticEntry struct {
+	data        []byte
+	etag        string
+	modTime     time.Time
+	contentType string
+}
+
+// staticCacheItem is an entry of a StaticCache with its bookkeeping.
+type staticCacheItem struct {
+	key   string
+	entry *staticEntry
+	size  int64
+	// added is when the entry was stored or last revalidated.
+	added time.Time
+	// maxAge is the TTL of the entry set by the backend; zero uses the TTL of the cache.
+	maxAge time.Duration
+	// refreshing is set while a background revalidation of the entry runs.
+	refreshing bool
+}
+
+// staticCacheState is the state of a file looked up in a StaticCache.
+type staticCacheState int
+
+const (
+	// staticCacheMiss reports a file not cached.
+	staticCacheMiss staticCacheState = iota
+	// staticCacheFresh reports a file served from the cache as is.
+	staticCacheFresh
+	// staticCacheStale reports an expired file still served while it is revalidated in the
+	// background.
+	staticCacheStale
+	// staticCacheExpired reports an expired file to revalidate before serving it.
+	staticCacheExpired
+)
+
+// StaticCacheStats are the counters of a StaticCache since its creation.
+//
+// Fields:
+//   - Hits: Lookups served from fresh entries.
+//   - StaleHits: Lookups served from expired entries while they were revalidated.
+//   - Misses: Lookups of files not cached, or expired beyond the stale window.
+//   - Evictions: Entries evicted to fit the byte budget.
+//   - Entries, Bytes: The number and the size of the entries cached now.
+//   - MaxBytes: The byte budget of the cache.
+type StaticCacheStats struct {
+	Hits      uint64
+	StaleHits uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     int64
+	MaxBytes  int64
+}
+
+// StaticCache is the in-memory cache of the files served by StaticResourceHandler, bounded by
+// the total size of the files rather than by their number and evicting the least recently used
+// ones first. Entries expire after a TTL, the cache's or the one stored with the object by the
+// backend, and may then be served stale while they are revalidated in the background. Its
+// settings can be changed while it serves requests, and it can be shared by several handlers
+// reading the same backend.
+type StaticCache struct {
+	mutex     sync.Mutex
+	maxBytes  int64
+	ttl       time.Duration
+	stale     time.Duration
+	items     map[string]*list.Element
+	order     *list.List
+	bytes     int64
+	hits      uint64
+	staleHits uint64
+	misses    uint64
+	evictions uint64
+}
+
+// InitStaticCache creates a StaticCache whose entries never expire.
+//
+// Parameters:
+//   - maxBytes: The byte budget of the cache, counting the content and the metadata of the
+//     files.
+//
+// Returns:
+//   - *StaticCache: The initialized cache.
+func InitStaticCache(maxBytes int64) *StaticCache {
+	return &StaticCache{maxBytes: maxBytes, items: make(map[string]*list.Element), order: list.New()}
+}
+
+// SetMaxBytes sets the byte budget of the cache, evicting entries at once when it shrinks.
+func (c *StaticCache) SetMaxBytes(maxBytes int64) *StaticCache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.maxBytes = maxBytes
+	c.evict()
+	return c
+}
+
+// SetTTL sets how long entries are served before being revalidated with the backend, for the
+// entries whose object does not set a max-age of its own; zero keeps them until they are
+// evicted. It applies to the entries already cached.
+func (c *StaticCache) SetTTL(ttl time.Duration) *StaticCache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ttl = ttl
+	return c
+}
+
+// SetStaleWhileRevalidate sets how long after their expiry entries are still served, while a
+// single background request revalidates them, so that clients never wait for the backend on
+// popular files. Past this window, expired entries are revalidated before being served.
+func (c *StaticCache) SetStaleWhileRevalidate(window time.Duration) *StaticCache {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stale = window
+	return c
+}
+
+// Flush removes the entries whose file name starts with prefix, e.g. "css/" after deploying
+// new style sheets; an empty prefix flushes the whole cache.
+//
+// Parameters:
+//   - prefix: The prefix of the file names to flush.
+//
+// Returns:
+//   - int: The number of entries removed.
+func (c *StaticCache) Flush(prefix string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	removed := 0
+	for key, elem := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(elem)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Stats returns the counters of the cache.
+func (c *StaticCache) Stats() StaticCacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return StaticCacheStats{
+		Hits:      c.hits,
+		StaleHits: c.staleHits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.items),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+	}
+}
+
+// get looks up a file. Stale entries are reported once per revalidation: further lookups get
+// them as fresh until the revalidation completes.
+func (c *StaticCache) get(key string) (*staticEntry, staticCacheState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return nil, staticCacheMiss
+	}
+	item := elem.Value.(*staticCacheItem)
+	c.order.MoveToFront(elem)
+	ttl := item.maxAge
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+	age := time.Since(item.added)
+	switch {
+	case ttl <= 0 || age < ttl:
+		c.hits++
+		return item.entry, staticCacheFresh
+	case age < ttl+c.stale:
+		c.staleHits++
+		if item.refreshing {
+			return item.entry, staticCacheFresh
+		}
+		item.refreshing = true
+		return item.entry, staticCacheStale
+	default:
+		c.misses++
+		return item.entry, staticCacheExpired
+	}
+}
+
+// add stores a file, replacing any entry of the same name, unless it does not fit the budget.
+func (c *StaticCache) add(key string, entry *staticEntry, maxAge time.Duration) {
+	size := int64(len(key) + len(entry.data) + len(entry.etag) + len(entry.contentType))
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	if size > c.maxBytes {
+		return
+	}
+	item := &staticCacheItem{key: key, entry: entry, size: size, added: time.Now(), maxAge: maxAge}
+	c.items[key] = c.order.PushFront(item)
+	c.bytes += size
+	c.evict()
+}
+
+// drop removes a file, if it is cached.
+func (c *StaticCache) drop(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// release ends the failed background revalidation of a file, which will be revalidated again
+// by the next lookup.
+func (c *StaticCache) release(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*staticCacheItem).refreshing = false
+	}
+}
+
+// evict evicts the least recently used entries until the cache fits its budget.
+func (c *StaticCache) evict() {
+	for c.bytes > c.maxBytes && c.order.Len() > 0 {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// remove removes an entry.
+func (c *StaticCache) remove(elem *list.Element) {
+	item := c.order.Remove(elem).(*staticCacheItem)
+	delete(c.items, item.key)
+	c.bytes -= item.size
+}
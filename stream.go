@@ -0,0 +1,66 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/internal/errs"
+	"io"
+	"strconv"
+)
+
+// RespondReader sends the content of r as the response body. The body is copied to the client
+// when the response is flushed, after every middleware has run, so it is never buffered in
+// RespData and writers installed by middleware (for example a compressing writer) see it as a
+// stream. If r implements io.Closer it is closed once the response completes, also when the
+// body is not sent because the client went away or the connection was hijacked.
+//
+// Content-Length is set when size is known (size >= 0) and no middleware has set a
+// Content-Encoding, since an encoded body has a different length.
+//
+// Example:
+//
+//	resp, err := http.Get(upstream)
+//	if err != nil {
+//	    _ = ctx.RespondError(err)
+//	    return
+//	}
+//	_ = ctx.RespondReader(resp.StatusCode, resp.Header.Get("Content-Type"), resp.Body, resp.ContentLength)
+//
+// Parameters:
+//   - status: The HTTP status code of the response.
+//   - contentType: The media type of the body; when empty the Content-Type header is left as is.
+//   - r: The body of the response.
+//   - size: The length of the body in bytes, or -1 when unknown.
+//
+// Returns:
+//   - error: An error if r is nil.
+func (c *Context) RespondReader(status int, contentType string, r io.Reader, size int64) error {
+	if r == nil {
+		return errs.ErrInputNil()
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.RespStatusCode = status
+	c.RespData = nil
+	c.respReader = r
+	c.respSize = size
+	return nil
+}
+
+// Streamed reports whether the body of the response was set by RespondReader, in which case
+// RespData is empty and the body is read only as the response is written.
+func (c *Context) Streamed() bool {
+	return c.respReader != nil
+}
+
+// flashReader writes a body set by RespondReader.
+func (s *HTTPServer) flashReader(ctx *Context) {
+	r := ctx.respReader
+	header := ctx.ResponseWriter.Header()
+	if ctx.respSize >= 0 && header.Get("Content-Encoding") == "" && !ctx.headerWritten {
+		header.Set("Content-Length", strconv.FormatInt(ctx.respSize, 10))
+	}
+	ctx.Commit()
+	// A failed copy almost always means the client went away; the status is already sent, so
+	// there is nothing left to report to it.
+	_, _ = io.Copy(ctx.ResponseWriter, r)
+}
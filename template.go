@@ -67,6 +67,10 @@ type TemplateEngine interface {
 // These functions compile the templates and return a *template.Template object, which is then assigned
 // to the T field.
 //
+// The loading methods LoadFromGlob, LoadFromFiles and LoadFromFS register the template functions of
+// TemplateFuncs, such as cspNonce; templates parsed by hand register them with
+// template.New(name).Funcs(mist.TemplateFuncs()).
+//
 // Using the T field, the GoTemplateEngine can execute the named templates with given data using the
 // ExecuteTemplate method, which satisfies the Render method of the TemplateEngine interface. The
 // execution process replaces template tags with corresponding data and generates the final rendered
@@ -157,7 +161,7 @@ func (g *GoTemplateEngine) LoadFromGlob(pattern string) error {
 	var err error
 	// Update the T field of the current GoTemplateEngine instance by parsing templates that match
 	// the provided pattern. ParseGlob will read and parse the files, compiling them into a template set.
-	g.T, err = template.ParseGlob(pattern)
+	g.T, err = template.New("").Funcs(TemplateFuncs()).ParseGlob(pattern)
 	// Return any error encountered during the parsing process. If err is nil, parsing was successful.
 	return err
 }
@@ -192,7 +196,7 @@ func (g *GoTemplateEngine) LoadFromFiles(filenames ...string) error {
 	// Assign to the T field a new template set consisting of the templates obtained from parsing the files
 	// using the filenames provided to the method. The filenames are spread into the function call using the
 	// variadic spread operator (...).
-	g.T, err = template.ParseFiles(filenames...)
+	g.T, err = template.New("").Funcs(TemplateFuncs()).ParseFiles(filenames...)
 	// Return the error, if any, from the parsing process. A nil error signifies successful loading and parsing
 	// of the template files.
 	return err
@@ -230,7 +234,7 @@ func (g *GoTemplateEngine) LoadFromFS(fs fs.FS, patterns ...string) error {
 	var err error
 	// Attempt to parse files from the provided file system (fs) that match the provided glob patterns.
 	// The parsed templates are stored in the GoTemplateEngine's T field.
-	g.T, err = template.ParseFS(fs, patterns...)
+	g.T, err = template.New("").Funcs(TemplateFuncs()).ParseFS(fs, patterns...)
 	// Return any errors encountered during the parsing process. A nil error indicates a successful
 	// parsing and loading of the templates into the engine.
 	return err
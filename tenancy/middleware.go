@@ -0,0 +1,138 @@
+package tenancy
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/errcode"
+	"github.com/dormoron/mist/internal/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// MiddlewareBuilder builds the middleware resolving the tenant of each request.
+//
+// Fields:
+//   - store: The Store tenants are loaded from.
+//   - resolver: Extracts the tenant ID from a request.
+//   - optional: When true, requests without a tenant ID pass through without a tenant.
+type MiddlewareBuilder struct {
+	store    Store
+	resolver Resolver
+	optional bool
+}
+
+// InitMiddlewareBuilder creates a MiddlewareBuilder loading tenants from store. Multiple
+// resolvers are tried in order, as with Chain.
+func InitMiddlewareBuilder(store Store, resolvers ...Resolver) *MiddlewareBuilder {
+	return &MiddlewareBuilder{store: store, resolver: Chain(resolvers...)}
+}
+
+// SetOptional lets requests that do not identify a tenant through, e.g. for routes shared by
+// tenants and the public site. Requests naming an unknown tenant are still rejected.
+func (b *MiddlewareBuilder) SetOptional(optional bool) *MiddlewareBuilder {
+	b.optional = optional
+	return b
+}
+
+// Build creates the middleware. Requests without a tenant ID are rejected with the
+// "tenant.missing" problem (400), unknown tenants with "tenant.unknown" (404). The resolved
+// tenant is stored on the context (see FromContext) and in the request context (see
+// FromStdContext).
+func (b *MiddlewareBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			id, ok := b.resolver(ctx)
+			if !ok {
+				if b.optional {
+					next(ctx)
+					return
+				}
+				_ = ctx.RespondError(errcode.New(errcode.CodeTenantMissing, nil))
+				return
+			}
+			tenant, found, err := b.store.Tenant(ctx.Request.Context(), id)
+			if err != nil {
+				_ = ctx.RespondError(err)
+				return
+			}
+			if !found {
+				_ = ctx.RespondError(unknownTenant(id))
+				return
+			}
+			ctx.Set(CtxTenantKey, tenant)
+			ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), contextKey{}, tenant))
+			next(ctx)
+		}
+	}
+}
+
+// RateLimitBuilder builds a middleware enforcing the RateLimit of each tenant with a Redis
+// sliding window shared by all instances of the application. It must run after the tenancy
+// middleware; requests without a tenant or with an unlimited tenant are not limited.
+type RateLimitBuilder struct {
+	client redis.Cmdable
+	logFn  func(level string, msg any, args ...any)
+}
+
+// InitRateLimitBuilder creates a RateLimitBuilder using client.
+func InitRateLimitBuilder(client redis.Cmdable) *RateLimitBuilder {
+	return &RateLimitBuilder{
+		client: client,
+		logFn: func(level string, msg any, args ...any) {
+			v := make([]any, 0, len(args)+2)
+			v = append(v, level, msg)
+			v = append(v, args...)
+			log.Println(v...)
+		},
+	}
+}
+
+// SetLogFunc sets the function used to log limiter failures.
+func (b *RateLimitBuilder) SetLogFunc(fn func(level string, msg any, args ...any)) *RateLimitBuilder {
+	b.logFn = fn
+	return b
+}
+
+// Build creates the middleware. Requests over the budget of their tenant receive a 429 problem
+// details response with a Retry-After header set to the window length.
+func (b *RateLimitBuilder) Build() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			tenant, ok := FromContext(ctx)
+			if !ok || tenant.RateLimit == nil || tenant.RateLimit.Rate <= 0 {
+				next(ctx)
+				return
+			}
+			limiter := &ratelimit.RedisSlidingWindowLimiter{
+				Cmd:      b.client,
+				Interval: tenant.RateLimit.Interval,
+				Rate:     tenant.RateLimit.Rate,
+			}
+			limited, err := limiter.Limit(ctx.Request.Context(), "tenant-limiter:"+tenant.ID)
+			if err != nil {
+				// Fail open: an unavailable limiter must not take every tenant down.
+				b.logFn("error", "tenant rate limit check failed: ", err)
+				next(ctx)
+				return
+			}
+			if limited {
+				ctx.Header("Retry-After", strconv.Itoa(max(int(tenant.RateLimit.Interval.Seconds()), 1)))
+				_ = ctx.RespondProblem(mist.Problem{
+					Status: http.StatusTooManyRequests,
+					Detail: "the rate limit of the tenant is exceeded, retry later",
+				})
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+// unknownTenant returns the coded error reported for a tenant ID without a tenant.
+func unknownTenant(id string) error {
+	e := errcode.New(errcode.CodeTenantUnknown, nil)
+	e.Params = map[string]any{"tenant": id}
+	return e
+}
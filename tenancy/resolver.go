@@ -0,0 +1,62 @@
+package tenancy
+
+import (
+	"github.com/dormoron/mist"
+	"net"
+	"strings"
+)
+
+// Resolver extracts the tenant ID from a request, reporting false when the request does not
+// identify a tenant.
+type Resolver func(ctx *mist.Context) (string, bool)
+
+// FromSubdomain resolves the tenant from the label of the host directly below baseDomain, so
+// that both "acme.example.com" and "www.acme.example.com" yield "acme" for the base domain
+// "example.com".
+func FromSubdomain(baseDomain string) Resolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(ctx *mist.Context) (string, bool) {
+		host := ctx.Request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+		if !strings.HasSuffix(host, suffix) {
+			return "", false
+		}
+		sub := strings.TrimSuffix(host, suffix)
+		if i := strings.LastIndexByte(sub, '.'); i >= 0 {
+			sub = sub[i+1:]
+		}
+		return sub, sub != ""
+	}
+}
+
+// FromHeader resolves the tenant from a request header, e.g. "X-Tenant-ID".
+func FromHeader(name string) Resolver {
+	return func(ctx *mist.Context) (string, bool) {
+		id := strings.TrimSpace(ctx.Request.Header.Get(name))
+		return id, id != ""
+	}
+}
+
+// FromPath resolves the tenant from a path parameter, e.g. "tenant" for routes registered under
+// "/tenants/:tenant".
+func FromPath(param string) Resolver {
+	return func(ctx *mist.Context) (string, bool) {
+		id, err := ctx.PathValue(param).String()
+		return id, err == nil && id != ""
+	}
+}
+
+// Chain tries resolvers in order and returns the first tenant ID found.
+func Chain(resolvers ...Resolver) Resolver {
+	return func(ctx *mist.Context) (string, bool) {
+		for _, r := range resolvers {
+			if id, ok := r(ctx); ok {
+				return id, true
+			}
+		}
+		return "", false
+	}
+}
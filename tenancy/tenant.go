@@ -0,0 +1,114 @@
+// Package tenancy adds multi-tenancy to mist applications. A middleware resolves the tenant of
+// every request from its subdomain, a header or a path parameter, loads it from a Store and
+// makes it available to handlers, together with per-tenant configuration and rate limits.
+//
+// Tenant-scoped route groups are regular groups carrying the tenancy middleware:
+//
+//	tenants := tenancy.InitMiddlewareBuilder(store, tenancy.FromPath("tenant"))
+//	api := server.Group("/tenants/:tenant", tenants.Build())
+//	api.GET("/orders", func(ctx *mist.Context) {
+//	    tenant, _ := tenancy.FromContext(ctx)
+//	    currency := tenant.Setting("currency").StringOrDefault("EUR")
+//	    // ...
+//	})
+package tenancy
+
+import (
+	"context"
+	"github.com/dormoron/mist"
+	"github.com/dormoron/mist/internal/errs"
+	"sync"
+	"time"
+)
+
+// CtxTenantKey is the key under which the resolved tenant is stored on the context.
+const CtxTenantKey = "_tenant"
+
+// RateLimit is the request budget of a tenant.
+//
+// Fields:
+//   - Rate: The maximum number of requests within Interval.
+//   - Interval: The length of the sliding window.
+type RateLimit struct {
+	Rate     int
+	Interval time.Duration
+}
+
+// Tenant describes a tenant of the application.
+//
+// Fields:
+//   - ID: The identifier the resolvers extract from requests (subdomain, header or path value).
+//   - Name: A human-readable name.
+//   - Settings: Per-tenant configuration values.
+//   - RateLimit: The request budget of the tenant; nil means unlimited.
+type Tenant struct {
+	ID        string
+	Name      string
+	Settings  map[string]any
+	RateLimit *RateLimit
+}
+
+// Setting looks up a per-tenant configuration value.
+func (t *Tenant) Setting(key string) mist.AnyValue {
+	val, ok := t.Settings[key]
+	if !ok {
+		return mist.AnyValue{Err: errs.ErrKeyNotFound(key)}
+	}
+	return mist.AnyValue{Val: val}
+}
+
+// Store loads tenants by ID.
+type Store interface {
+	// Tenant returns the tenant with the given ID and whether it exists.
+	Tenant(ctx context.Context, id string) (*Tenant, bool, error)
+}
+
+// MemoryStore keeps tenants in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mutex   sync.RWMutex
+	tenants map[string]*Tenant
+}
+
+// InitMemoryStore creates a MemoryStore holding tenants.
+func InitMemoryStore(tenants ...*Tenant) *MemoryStore {
+	s := &MemoryStore{tenants: make(map[string]*Tenant, len(tenants))}
+	for _, t := range tenants {
+		s.tenants[t.ID] = t
+	}
+	return s
+}
+
+// Tenant returns the tenant with the given ID and whether it exists.
+func (s *MemoryStore) Tenant(_ context.Context, id string) (*Tenant, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	t, ok := s.tenants[id]
+	return t, ok, nil
+}
+
+// Put adds or replaces a tenant.
+func (s *MemoryStore) Put(t *Tenant) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tenants[t.ID] = t
+}
+
+// contextKey is the key of the tenant in the standard request context.
+type contextKey struct{}
+
+// FromContext returns the tenant resolved for the request.
+func FromContext(ctx *mist.Context) (*Tenant, bool) {
+	val, ok := ctx.Get(CtxTenantKey)
+	if !ok {
+		return nil, false
+	}
+	t, ok := val.(*Tenant)
+	return t, ok
+}
+
+// FromStdContext returns the tenant stored in a standard context, such as the request context
+// or a context created with ctx.CopyToContext, e.g. inside repositories scoping their queries.
+func FromStdContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(*Tenant)
+	return t, ok
+}
@@ -0,0 +1,132 @@
+package mist
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ServerWithHandlerTimeout is a configuration function that returns an HTTPServerOption.
+// It sets the time limit of request handling: the context of every request gets a deadline
+// that far from the start of the request, reported by Context.Deadline and cancelling
+// Request.Context when it passes, so that handlers and the database calls or clients they
+// pass the context to give up together. Groups and routes override it with HandlerTimeout.
+//
+// The timeout is cooperative: handlers still run until they return, and decide how to answer
+// once the context is done.
+//
+// Parameters:
+//   - timeout: The time limit of request handling; 0 means no limit.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified timeout.
+func ServerWithHandlerTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.handlerTimeout = timeout
+	}
+}
+
+// HandlerTimeout returns a middleware overriding the time limit set with
+// ServerWithHandlerTimeout for the routes it is applied to. Used on a group it overrides the
+// server timeout, and used on a route it overrides the group timeout. The limit still counts
+// from the start of the request, and may be longer than the one it overrides; 0 removes the
+// limit. It has no effect once the deadline has passed.
+//
+// Example:
+//
+//	server := mist.InitHTTPServer(mist.ServerWithHandlerTimeout(5 * time.Second))
+//	reports := server.Group("/reports", mist.HandlerTimeout(time.Minute))
+//	reports.GET("/summary", summary, mist.HandlerTimeout(10*time.Second))
+//
+// Parameters:
+//   - timeout: The time limit of request handling.
+//
+// Returns:
+//   - Middleware: The middleware applying the timeout.
+func HandlerTimeout(timeout time.Duration) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.setHandlerTimeout(timeout)
+			next(ctx)
+		}
+	}
+}
+
+// handlerDeadline is the context installed on requests subject to a handler timeout. Unlike
+// context.WithTimeout, its deadline can be moved after the context was derived, so that the
+// overrides of groups and routes apply to the contexts already derived by the middleware that
+// ran before them.
+type handlerDeadline struct {
+	context.Context
+	cancel   context.CancelCauseFunc
+	mutex    sync.Mutex
+	start    time.Time
+	deadline time.Time
+	timer    *time.Timer
+}
+
+// Deadline returns the earliest of the handler deadline and the deadline of the parent.
+func (h *handlerDeadline) Deadline() (time.Time, bool) {
+	parent, ok := h.Context.Deadline()
+	h.mutex.Lock()
+	deadline := h.deadline
+	h.mutex.Unlock()
+	if deadline.IsZero() || (ok && parent.Before(deadline)) {
+		return parent, ok
+	}
+	return deadline, true
+}
+
+// Err returns context.DeadlineExceeded once the handler deadline has passed.
+func (h *handlerDeadline) Err() error {
+	err := h.Context.Err()
+	if err != nil && context.Cause(h.Context) == context.DeadlineExceeded {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// reset moves the deadline to timeout after the start of the request.
+func (h *handlerDeadline) reset(timeout time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.Context.Err() != nil {
+		return
+	}
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if timeout <= 0 {
+		h.deadline = time.Time{}
+		return
+	}
+	h.deadline = h.start.Add(timeout)
+	h.timer = time.AfterFunc(time.Until(h.deadline), func() {
+		h.cancel(context.DeadlineExceeded)
+	})
+}
+
+// release stops the timer and cancels the context once the request is served.
+func (h *handlerDeadline) release() {
+	h.mutex.Lock()
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.mutex.Unlock()
+	h.cancel(context.Canceled)
+}
+
+// setHandlerTimeout sets the time limit of the request, installing the deadline context on
+// the request the first time.
+func (c *Context) setHandlerTimeout(timeout time.Duration) {
+	if c.deadline == nil {
+		if timeout <= 0 {
+			return
+		}
+		inner, cancel := context.WithCancelCause(c.Request.Context())
+		c.deadline = &handlerDeadline{Context: inner, cancel: cancel, start: c.start}
+		c.Request = c.Request.WithContext(c.deadline)
+	}
+	c.deadline.reset(timeout)
+}
@@ -0,0 +1,184 @@
+package mist
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timing is a server-side metric of a request, reported to clients in the Server-Timing
+// response header.
+//
+// Fields:
+//   - Name: The metric name, e.g. "db".
+//   - Duration: The accumulated duration of the metric.
+//   - Description: A human-readable description shown by browser developer tools; optional.
+type Timing struct {
+	Name        string
+	Duration    time.Duration
+	Description string
+}
+
+// ServerTimingPolicy decides whether the Server-Timing header is sent with the response of a
+// request. Timings reveal details of the backend, so production servers usually restrict them to
+// authenticated or debug requests.
+type ServerTimingPolicy func(ctx *Context) bool
+
+// ServerWithServerTiming is a configuration function that returns an HTTPServerOption.
+// It restricts the Server-Timing header to the requests accepted by policy. Timings are still
+// recorded for every request and available to middleware through Context.Timings. Servers
+// without a policy send the header with every response that has timings.
+//
+// Example:
+//
+//	server := mist.InitHTTPServer(mist.ServerWithServerTiming(func(ctx *mist.Context) bool {
+//	    _, authenticated := ctx.Get(security.CtxSessionKey)
+//	    return authenticated
+//	}))
+//
+// Parameters:
+//   - policy: The policy deciding which responses carry the header.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified policy.
+func ServerWithServerTiming(policy ServerTimingPolicy) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.timingPolicy = policy
+	}
+}
+
+// ServerTimingDebugHeader returns a ServerTimingPolicy accepting requests that carry the header
+// with the given value, e.g. "X-Debug-Timing: <secret>" sent by a developer's browser extension.
+//
+// Parameters:
+//   - header: The request header to check.
+//   - value: The expected value; an empty value accepts any non-empty header.
+//
+// Returns:
+//   - ServerTimingPolicy: The policy.
+func ServerTimingDebugHeader(header string, value string) ServerTimingPolicy {
+	return func(ctx *Context) bool {
+		got := ctx.Request.Header.Get(header)
+		if value == "" {
+			return got != ""
+		}
+		return subtle.ConstantTimeCompare([]byte(got), []byte(value)) == 1
+	}
+}
+
+// ServerTimingAny returns a ServerTimingPolicy accepting requests accepted by any of policies,
+// e.g. authenticated requests and requests with a debug header.
+func ServerTimingAny(policies ...ServerTimingPolicy) ServerTimingPolicy {
+	return func(ctx *Context) bool {
+		for _, policy := range policies {
+			if policy(ctx) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ServerTiming records a metric reported in the Server-Timing response header, for example to
+// show the time of a downstream call in the browser's network panel. Durations recorded under
+// the same name are summed, and the last non-empty description is kept. Whether the header is
+// sent is decided by the policy set with ServerWithServerTiming.
+//
+// Example:
+//
+//	start := time.Now()
+//	resp, err := client.Do(req)
+//	ctx.ServerTiming("inventory", time.Since(start), "inventory service")
+//
+// Parameters:
+//   - name: The metric name; characters not allowed in a header token are replaced with '_'.
+//   - dur: The duration to add.
+//   - desc: A description shown by browser developer tools; may be empty.
+func (c *Context) ServerTiming(name string, dur time.Duration, desc string) {
+	c.addTiming(Timing{Name: name, Duration: dur, Description: desc})
+}
+
+// AddTiming contributes time spent on behalf of the request to a named metric, for example
+// the time of a database query. Durations added under the same name are summed, so every query
+// of a request can report to "db". The metrics are sent in the Server-Timing response header
+// and are available to middleware through Timings. It is safe to call from goroutines started
+// by the handler.
+//
+// Example:
+//
+//	start := time.Now()
+//	rows, err := db.QueryContext(ctx, query)
+//	ctx.AddTiming("db", time.Since(start))
+//
+// Parameters:
+//   - name: The metric name; characters not allowed in a header token are replaced with '_'.
+//   - dur: The duration to add.
+func (c *Context) AddTiming(name string, dur time.Duration) {
+	c.addTiming(Timing{Name: name, Duration: dur})
+}
+
+// addTiming adds t to the metric of the same name, keeping a non-empty description.
+func (c *Context) addTiming(t Timing) {
+	t.Name = timingName(t.Name)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i := range c.timings {
+		if c.timings[i].Name == t.Name {
+			c.timings[i].Duration += t.Duration
+			if t.Description != "" {
+				c.timings[i].Description = t.Description
+			}
+			return
+		}
+	}
+	c.timings = append(c.timings, t)
+}
+
+// Timings returns a copy of the metrics recorded for the request, in the order they were
+// first added.
+func (c *Context) Timings() []Timing {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]Timing(nil), c.timings...)
+}
+
+// writeTimings sets the Server-Timing header from the recorded metrics, unless the header has
+// already been sent or the timing policy rejects the request.
+func (c *Context) writeTimings() {
+	timings := c.Timings()
+	if len(timings) == 0 || c.headerWritten {
+		return
+	}
+	if c.timingPolicy != nil && !c.timingPolicy(c) {
+		return
+	}
+	c.ResponseWriter.Header().Set("Server-Timing", FormatServerTiming(timings))
+}
+
+// FormatServerTiming encodes metrics as a Server-Timing header value, e.g.
+// `db;dur=12.5, cache;dur=0.8;desc="hit"`. Durations are in milliseconds.
+func FormatServerTiming(timings []Timing) string {
+	parts := make([]string, 0, len(timings))
+	for _, t := range timings {
+		part := timingName(t.Name) + ";dur=" + strconv.FormatFloat(float64(t.Duration.Microseconds())/1000, 'f', -1, 64)
+		if t.Description != "" {
+			part += ";desc=" + strconv.Quote(t.Description)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timingName turns name into a header token.
+func timingName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
@@ -0,0 +1,66 @@
+package mist
+
+import (
+	"github.com/dormoron/mist/validation"
+	"net/http"
+)
+
+// StatusCoder may be implemented by the response values of JSON handlers to choose the status
+// code of the response, e.g. 201 Created. Responses that do not implement it are sent with
+// 200 OK.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// JSON adapts a typed function into a HandleFunc. The adapter decodes the JSON request body
+// into a Req and validates it against its `validate` tags, calls fn, and serializes the
+// returned Resp as JSON. Binding, validation and errors returned by fn are reported through
+// Context.RespondError, so they produce the same problem details as hand-written handlers.
+//
+// Requests without a body are accepted for GET, HEAD and DELETE; Req is then validated in its
+// zero state. Because fn receives a plain value and returns plain values, its logic can be unit
+// tested without constructing requests.
+//
+// Example:
+//
+//	server.POST("/users", mist.JSON(func(ctx *mist.Context, req CreateUser) (User, error) {
+//	    return users.Create(ctx, req)
+//	}))
+//
+// Parameters:
+//   - fn: The typed handler.
+//
+// Returns:
+//   - HandleFunc: The handler to register on a route.
+func JSON[Req any, Resp any](fn func(ctx *Context, req Req) (Resp, error)) HandleFunc {
+	return func(ctx *Context) {
+		var req Req
+		if err := bindTyped(ctx, &req); err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		resp, err := fn(ctx, req)
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		status := http.StatusOK
+		if sc, ok := any(resp).(StatusCoder); ok && sc.StatusCode() > 0 {
+			status = sc.StatusCode()
+		}
+		if err = ctx.RespondWithJSON(status, resp); err != nil {
+			_ = ctx.RespondError(err)
+		}
+	}
+}
+
+// bindTyped binds and validates the request of a JSON handler.
+func bindTyped(ctx *Context, req any) error {
+	switch ctx.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		if ctx.Request.Body == nil || ctx.Request.Body == http.NoBody || ctx.Request.ContentLength == 0 {
+			return validation.Validate(req)
+		}
+	}
+	return ctx.BindAndValidate(req)
+}
@@ -0,0 +1,22 @@
+package mist
+
+// Scheme returns the scheme the client used to reach the server, "http" or "https". Behind a
+// reverse proxy, it is the scheme set on Request.URL by the proxyheaders middleware; otherwise
+// it is inferred from the connection.
+func (c *Context) Scheme() string {
+	if c.Request.URL.Scheme != "" {
+		return c.Request.URL.Scheme
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// FullURL returns the absolute URL of the request as the client sent it, e.g.
+// "https://api.example.com/orders?page=2", for links, redirects and canonical URLs. Behind a
+// reverse proxy, it is only correct once the proxyheaders middleware has restored the
+// scheme and host seen by the client.
+func (c *Context) FullURL() string {
+	return c.Scheme() + "://" + c.Request.Host + c.Request.URL.RequestURI()
+}
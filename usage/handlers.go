@@ -0,0 +1,186 @@
+package usage
+
+import (
+	"github.com/dormoron/mist"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Summary is the usage of a group of stats, as answered by the query endpoints.
+//
+// Fields:
+//   - Start: The start of the period, for time series.
+//   - Route: The route, for the usage per route.
+//   - Consumer: The consumer, for the usage per consumer.
+//   - Calls: The number of calls.
+//   - Errors: The number of calls answered with a status of 500 or above.
+//   - MeanMs, P50Ms, P90Ms, P99Ms: The mean and percentiles of the latency, in milliseconds.
+type Summary struct {
+	Start    *time.Time `json:"start,omitempty"`
+	Route    string     `json:"route,omitempty"`
+	Consumer string     `json:"consumer,omitempty"`
+	Calls    int64      `json:"calls"`
+	Errors   int64      `json:"errors"`
+	MeanMs   float64    `json:"mean_ms"`
+	P50Ms    float64    `json:"p50_ms"`
+	P90Ms    float64    `json:"p90_ms"`
+	P99Ms    float64    `json:"p99_ms"`
+}
+
+// Summarize merges stats into a Summary per group, sorted by decreasing calls, or by start for
+// time series.
+//
+// Parameters:
+//   - stats: The stats.
+//   - by: The grouping: "route", "consumer" or "start".
+//
+// Returns:
+//   - []Summary: The summaries.
+func Summarize(stats []Stat, by string) []Summary {
+	groups := make(map[string]*Stat)
+	var order []string
+	for i := range stats {
+		s := &stats[i]
+		var key string
+		switch by {
+		case "route":
+			key = s.Route
+		case "consumer":
+			key = s.Consumer
+		default:
+			key = s.Start.Format(time.RFC3339)
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &Stat{Start: s.Start, Route: s.Route, Consumer: s.Consumer}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.Merge(s)
+	}
+	summaries := make([]Summary, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		sum := Summary{
+			Calls:  g.Calls,
+			Errors: g.Errors,
+			MeanMs: milliseconds(g.Mean()),
+			P50Ms:  milliseconds(g.Percentile(0.5)),
+			P90Ms:  milliseconds(g.Percentile(0.9)),
+			P99Ms:  milliseconds(g.Percentile(0.99)),
+		}
+		switch by {
+		case "route":
+			sum.Route = g.Route
+		case "consumer":
+			sum.Consumer = g.Consumer
+		default:
+			start := g.Start
+			sum.Start = &start
+		}
+		summaries = append(summaries, sum)
+	}
+	if by == "route" || by == "consumer" {
+		sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Calls > summaries[j].Calls })
+	} else {
+		sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Start.Before(*summaries[j].Start) })
+	}
+	return summaries
+}
+
+// Register registers the query endpoints of a store:
+//   - GET <prefix>/routes: the usage per route,
+//   - GET <prefix>/consumers: the usage per consumer, e.g. for invoicing,
+//   - GET <prefix>/series: the usage per period.
+//
+// They accept the query parameters from and to, RFC 3339 times or dates, the last 24 hours by
+// default; granularity, "minute", "hour" (the default) or "day"; and route and consumer to
+// select the calls of a route or a consumer. The endpoints are to be protected by ms, as they
+// disclose the usage of every consumer.
+//
+// Parameters:
+//   - server: The server to register the routes on.
+//   - prefix: The path prefix of the routes, e.g. "/admin/usage".
+//   - store: The store of the stats.
+//   - ms: Middleware applied to every route.
+func Register(server *mist.HTTPServer, prefix string, store Store, ms ...mist.Middleware) {
+	g := server.Group(prefix, ms...)
+	g.GET("/routes", queryHandler(store, "route"))
+	g.GET("/consumers", queryHandler(store, "consumer"))
+	g.GET("/series", queryHandler(store, "start"))
+}
+
+// queryHandler returns the handler of a query endpoint grouping the stats by route, consumer
+// or start.
+func queryHandler(store Store, by string) mist.HandleFunc {
+	return func(ctx *mist.Context) {
+		q, detail := parseQuery(ctx)
+		if detail != "" {
+			_ = ctx.RespondProblem(mist.Problem{Status: http.StatusBadRequest, Detail: detail})
+			return
+		}
+		stats, err := store.Query(ctx.Request.Context(), q)
+		if err != nil {
+			_ = ctx.RespondError(err)
+			return
+		}
+		_ = ctx.RespondWithJSON(http.StatusOK, map[string]any{
+			"from":        q.From,
+			"to":          q.To,
+			"granularity": q.Granularity,
+			"data":        Summarize(stats, by),
+		})
+	}
+}
+
+// parseQuery reads the query of a request, returning the problem detail of invalid parameters.
+func parseQuery(ctx *mist.Context) (Query, string) {
+	values := ctx.Request.URL.Query()
+	q := Query{
+		Granularity: Granularity(values.Get("granularity")),
+		Route:       values.Get("route"),
+		Consumer:    values.Get("consumer"),
+		To:          time.Now().UTC(),
+	}
+	if q.Granularity == "" {
+		q.Granularity = Hour
+	}
+	if q.Granularity.Duration() == 0 {
+		return q, "granularity must be minute, hour or day"
+	}
+	var ok bool
+	if raw := values.Get("to"); raw != "" {
+		if q.To, ok = parseTime(raw); !ok {
+			return q, "to must be an RFC 3339 time or a date"
+		}
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if raw := values.Get("from"); raw != "" {
+		if q.From, ok = parseTime(raw); !ok {
+			return q, "from must be an RFC 3339 time or a date"
+		}
+	}
+	if !q.From.Before(q.To) {
+		return q, "from must be before to"
+	}
+	// The period containing From is included.
+	q.From = q.Granularity.Truncate(q.From)
+	return q, ""
+}
+
+// parseTime parses an RFC 3339 time or a date, in UTC.
+func parseTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// milliseconds returns a duration in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
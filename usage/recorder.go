@@ -0,0 +1,207 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"github.com/dormoron/mist"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Anonymous is the consumer of the calls without one.
+const Anonymous = "anonymous"
+
+// statKey identifies a Stat.
+type statKey struct {
+	start    int64
+	route    string
+	consumer string
+}
+
+// Recorder counts the calls served through its middleware and writes them to a Store in the
+// background. It is safe for concurrent use; its settings are to be made before it records its
+// first call.
+type Recorder struct {
+	store         Store
+	consumerFn    func(ctx *mist.Context) string
+	flushInterval time.Duration
+	onError       func(err error)
+
+	mutex   sync.Mutex
+	pending map[statKey]*Stat
+
+	start   sync.Once
+	flushes chan chan error
+	closed  chan struct{}
+	close   sync.Once
+}
+
+// InitRecorder creates a Recorder writing the calls to the store every 10 seconds.
+//
+// Parameters:
+//   - store: The store of the stats, e.g. InitMemoryStore() or InitRedisStore(client).
+//   - consumerFn: The function returning the consumer of a request, e.g. its API key or the ID
+//     of its user; calls without a consumer are counted for Anonymous.
+//
+// Returns:
+//   - *Recorder: The initialized recorder.
+func InitRecorder(store Store, consumerFn func(ctx *mist.Context) string) *Recorder {
+	return &Recorder{
+		store:         store,
+		consumerFn:    consumerFn,
+		flushInterval: 10 * time.Second,
+		onError: func(err error) {
+			fmt.Printf("%s - usage: %v\n", time.Now().Format(time.RFC3339), err)
+		},
+		pending: make(map[statKey]*Stat),
+		flushes: make(chan chan error),
+		closed:  make(chan struct{}),
+	}
+}
+
+// SetFlushInterval sets how often the calls are written to the store.
+func (r *Recorder) SetFlushInterval(interval time.Duration) *Recorder {
+	r.flushInterval = interval
+	return r
+}
+
+// OnError sets the handler of the failures to write to the store, which are printed by
+// default. The calls of a failed write are lost.
+func (r *Recorder) OnError(fn func(err error)) *Recorder {
+	r.onError = fn
+	return r
+}
+
+// Store returns the store of the recorder.
+func (r *Recorder) Store() Store {
+	return r.store
+}
+
+// Middleware returns the middleware counting the calls of the next handlers. Calls of no route
+// are counted under the route "unknown".
+func (r *Recorder) Middleware() mist.Middleware {
+	return func(next mist.HandleFunc) mist.HandleFunc {
+		return func(ctx *mist.Context) {
+			begin := time.Now()
+			defer func() {
+				route := ctx.RoutePattern()
+				if route == "" {
+					route = "unknown"
+				}
+				consumer := ""
+				if r.consumerFn != nil {
+					consumer = r.consumerFn(ctx)
+				}
+				if consumer == "" {
+					consumer = Anonymous
+				}
+				r.Record(ctx.Request.Method+" "+route, consumer, ctx.RespStatusCode, time.Since(begin))
+			}()
+			next(ctx)
+		}
+	}
+}
+
+// Record counts a call, e.g. one served outside of the middleware.
+//
+// Parameters:
+//   - route: The route, e.g. "GET /users/:id".
+//   - consumer: The consumer.
+//   - status: The status of the response; 0 counts as 200.
+//   - latency: The time taken to serve the call.
+func (r *Recorder) Record(route string, consumer string, status int, latency time.Duration) {
+	r.start.Do(r.run)
+	start := Minute.Truncate(time.Now())
+	key := statKey{start: start.Unix(), route: route, consumer: consumer}
+	r.mutex.Lock()
+	s, ok := r.pending[key]
+	if !ok {
+		s = &Stat{Start: start, Route: route, Consumer: consumer}
+		r.pending[key] = s
+	}
+	s.add(latency, status >= http.StatusInternalServerError)
+	r.mutex.Unlock()
+}
+
+// Flush writes the counted calls to the store and waits until they are written or ctx is done.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.start.Do(r.run)
+	done := make(chan error, 1)
+	select {
+	case r.flushes <- done:
+	case <-r.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the counted calls and stops the recorder; later calls are not written. It is to
+// be called when the application stops, e.g. after HTTPServer.Shutdown.
+func (r *Recorder) Close(ctx context.Context) error {
+	err := r.Flush(ctx)
+	r.close.Do(func() { close(r.closed) })
+	return err
+}
+
+// run starts the goroutine writing the calls to the store.
+func (r *Recorder) run() {
+	go func() {
+		ticker := time.NewTicker(r.flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.write(); err != nil && r.onError != nil {
+					r.onError(err)
+				}
+			case done := <-r.flushes:
+				done <- r.write()
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+}
+
+// write writes the pending stats to the store in every granularity.
+func (r *Recorder) write() error {
+	r.mutex.Lock()
+	pending := r.pending
+	r.pending = make(map[statKey]*Stat)
+	r.mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, g := range granularities {
+		rolled := make(map[statKey]*Stat, len(pending))
+		for _, s := range pending {
+			start := g.Truncate(s.Start)
+			key := statKey{start: start.Unix(), route: s.Route, consumer: s.Consumer}
+			if t, ok := rolled[key]; ok {
+				t.Merge(s)
+				continue
+			}
+			t := &Stat{Start: start, Route: s.Route, Consumer: s.Consumer}
+			t.Merge(s)
+			rolled[key] = t
+		}
+		stats := make([]Stat, 0, len(rolled))
+		for _, s := range rolled {
+			stats = append(stats, *s)
+		}
+		if err := r.store.Add(ctx, g, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package usage
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisStore is a Store shared by every instance through Redis. The stats of a period are kept
+// in a hash under "<prefix>:<granularity>:<start>", with a field per route, consumer and
+// counter, and the periods of a granularity are indexed in a sorted set under
+// "<prefix>:<granularity>:index". Both expire with the retention of the granularity.
+type RedisStore struct {
+	client    redis.Cmdable
+	prefix    string
+	retention map[Granularity]time.Duration
+}
+
+// InitRedisStore creates a RedisStore with keys prefixed by "usage", keeping the stats per
+// minute for 48 hours, per hour for 90 days and per day for 2 years.
+func InitRedisStore(client redis.Cmdable) *RedisStore {
+	r := &RedisStore{client: client, prefix: "usage", retention: make(map[Granularity]time.Duration)}
+	for g, d := range defaultRetention {
+		r.retention[g] = d
+	}
+	return r
+}
+
+// SetKeyPrefix sets the prefix of the keys of the store.
+func (r *RedisStore) SetKeyPrefix(prefix string) *RedisStore {
+	r.prefix = prefix
+	return r
+}
+
+// SetRetention sets how long the stats of a granularity are kept.
+func (r *RedisStore) SetRetention(g Granularity, d time.Duration) *RedisStore {
+	r.retention[g] = d
+	return r
+}
+
+// fieldSep separates the route, the consumer and the counter in the fields of the hashes.
+const fieldSep = "\x1f"
+
+// Add increments the counters of the stats in one pipeline.
+func (r *RedisStore) Add(ctx context.Context, g Granularity, stats []Stat) error {
+	retention, ok := r.retention[g]
+	if !ok || len(stats) == 0 {
+		return nil
+	}
+	index := r.prefix + ":" + string(g) + ":index"
+	pipe := r.client.Pipeline()
+	starts := make(map[int64]bool)
+	for i := range stats {
+		s := &stats[i]
+		start := s.Start.Unix()
+		key := r.periodKey(g, start)
+		field := s.Route + fieldSep + s.Consumer + fieldSep
+		pipe.HIncrBy(ctx, key, field+"c", s.Calls)
+		if s.Errors > 0 {
+			pipe.HIncrBy(ctx, key, field+"e", s.Errors)
+		}
+		pipe.HIncrBy(ctx, key, field+"l", int64(s.Latency))
+		for b, n := range s.Buckets {
+			if n > 0 {
+				pipe.HIncrBy(ctx, key, field+"b"+strconv.Itoa(b), n)
+			}
+		}
+		if !starts[start] {
+			starts[start] = true
+			pipe.ExpireAt(ctx, key, s.Start.Add(retention))
+			pipe.ZAdd(ctx, index, redis.Z{Score: float64(start), Member: start})
+		}
+	}
+	pipe.ZRemRangeByScore(ctx, index, "-inf", "("+strconv.FormatInt(time.Now().Add(-retention).Unix(), 10))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Query reads the hashes of the periods selected by a query, sorted by start.
+func (r *RedisStore) Query(ctx context.Context, q Query) ([]Stat, error) {
+	index := r.prefix + ":" + string(q.Granularity) + ":index"
+	starts, err := r.client.ZRangeByScore(ctx, index, &redis.ZRangeBy{
+		Min: strconv.FormatInt(q.From.Unix(), 10),
+		Max: "(" + strconv.FormatInt(q.To.Unix(), 10),
+	}).Result()
+	if err != nil || len(starts) == 0 {
+		return nil, err
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(starts))
+	for i, start := range starts {
+		n, _ := strconv.ParseInt(start, 10, 64)
+		cmds[i] = pipe.HGetAll(ctx, r.periodKey(q.Granularity, n))
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	var stats []Stat
+	for i, cmd := range cmds {
+		n, _ := strconv.ParseInt(starts[i], 10, 64)
+		byKey := make(map[statKey]*Stat)
+		for field, value := range cmd.Val() {
+			parts := strings.Split(field, fieldSep)
+			if len(parts) != 3 {
+				continue
+			}
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				continue
+			}
+			key := statKey{start: n, route: parts[0], consumer: parts[1]}
+			s, ok := byKey[key]
+			if !ok {
+				s = &Stat{Start: time.Unix(n, 0).UTC(), Route: parts[0], Consumer: parts[1], Buckets: make([]int64, len(latencyBounds)+1)}
+				byKey[key] = s
+			}
+			switch counter := parts[2]; {
+			case counter == "c":
+				s.Calls = v
+			case counter == "e":
+				s.Errors = v
+			case counter == "l":
+				s.Latency = time.Duration(v)
+			case strings.HasPrefix(counter, "b"):
+				if b, err := strconv.Atoi(counter[1:]); err == nil && b < len(s.Buckets) {
+					s.Buckets[b] = v
+				}
+			}
+		}
+		for _, s := range byKey {
+			if q.match(s) {
+				stats = append(stats, *s)
+			}
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Start.Before(stats[j].Start) })
+	return stats, nil
+}
+
+// periodKey returns the key of the hash of a period.
+func (r *RedisStore) periodKey(g Granularity, start int64) string {
+	return r.prefix + ":" + string(g) + ":" + strconv.FormatInt(start, 10)
+}
@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Query selects stats.
+//
+// Fields:
+//   - Granularity: The granularity of the stats.
+//   - From: The earliest start of the periods, inclusive.
+//   - To: The latest start of the periods, exclusive.
+//   - Route: The route of the stats; empty selects every route.
+//   - Consumer: The consumer of the stats; empty selects every consumer.
+type Query struct {
+	Granularity Granularity
+	From        time.Time
+	To          time.Time
+	Route       string
+	Consumer    string
+}
+
+// match reports whether a stat is selected by a query.
+func (q Query) match(s *Stat) bool {
+	return !s.Start.Before(q.From) && s.Start.Before(q.To) &&
+		(q.Route == "" || s.Route == q.Route) && (q.Consumer == "" || s.Consumer == q.Consumer)
+}
+
+// Store keeps the stats of the calls. Implementations must be safe for concurrent use; use a
+// shared store such as RedisStore when several instances serve the API.
+type Store interface {
+	// Add adds stats of a granularity to those stored for the same period, route and consumer.
+	Add(ctx context.Context, g Granularity, stats []Stat) error
+	// Query returns the stats selected by a query, in no particular order.
+	Query(ctx context.Context, q Query) ([]Stat, error)
+}
+
+// defaultRetention is how long the stats of each granularity are kept by default.
+var defaultRetention = map[Granularity]time.Duration{
+	Minute: 48 * time.Hour,
+	Hour:   90 * 24 * time.Hour,
+	Day:    2 * 366 * 24 * time.Hour,
+}
+
+// MemoryStore is a Store keeping the stats in process memory. It suits single-instance servers
+// and tests; the stats are lost on restart.
+type MemoryStore struct {
+	mutex     sync.Mutex
+	stats     map[Granularity]map[statKey]*Stat
+	retention map[Granularity]time.Duration
+}
+
+// InitMemoryStore creates an empty MemoryStore, keeping the stats per minute for 48 hours, per
+// hour for 90 days and per day for 2 years.
+func InitMemoryStore() *MemoryStore {
+	m := &MemoryStore{
+		stats:     make(map[Granularity]map[statKey]*Stat),
+		retention: make(map[Granularity]time.Duration),
+	}
+	for _, g := range granularities {
+		m.stats[g] = make(map[statKey]*Stat)
+		m.retention[g] = defaultRetention[g]
+	}
+	return m
+}
+
+// SetRetention sets how long the stats of a granularity are kept.
+func (m *MemoryStore) SetRetention(g Granularity, d time.Duration) *MemoryStore {
+	m.mutex.Lock()
+	m.retention[g] = d
+	m.mutex.Unlock()
+	return m
+}
+
+// Add adds stats, dropping the stats past their retention on the way.
+func (m *MemoryStore) Add(_ context.Context, g Granularity, stats []Stat) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	byKey, ok := m.stats[g]
+	if !ok {
+		return nil
+	}
+	oldest := time.Now().Add(-m.retention[g])
+	for k, s := range byKey {
+		if s.Start.Before(oldest) {
+			delete(byKey, k)
+		}
+	}
+	for i := range stats {
+		s := &stats[i]
+		key := statKey{start: s.Start.Unix(), route: s.Route, consumer: s.Consumer}
+		stored, ok := byKey[key]
+		if !ok {
+			stored = &Stat{Start: s.Start.UTC(), Route: s.Route, Consumer: s.Consumer}
+			byKey[key] = stored
+		}
+		stored.Merge(s)
+	}
+	return nil
+}
+
+// Query returns the selected stats, sorted by start.
+func (m *MemoryStore) Query(_ context.Context, q Query) ([]Stat, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var stats []Stat
+	for _, s := range m.stats[q.Granularity] {
+		if q.match(s) {
+			c := *s
+			c.Buckets = append([]int64(nil), s.Buckets...)
+			stats = append(stats, c)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Start.Before(stats[j].Start) })
+	return stats, nil
+}
@@ -0,0 +1,155 @@
+// Package usage records the calls of an API per route and per consumer, with their latency
+// distribution, for usage dashboards and invoicing. The middleware of a Recorder aggregates
+// the calls in memory and writes them to a Store in the background, rolled up per minute, hour
+// and day; the query endpoints answer with call counts, error counts and latency percentiles:
+//
+//	recorder := usage.InitRecorder(usage.InitRedisStore(rdb), apiKeyOf)
+//	defer recorder.Close(context.Background())
+//	server.Use(recorder.Middleware())
+//	usage.Register(server, "/admin/usage", recorder.Store(), adminOnly)
+//
+// Latencies are counted in buckets growing by 25%, so percentiles are estimated within 12.5%;
+// the buckets of different instances and periods add up exactly.
+package usage
+
+import (
+	"time"
+)
+
+// Granularity is the length of the periods the calls are counted in.
+type Granularity string
+
+// Granularities of the stats. Days start at midnight UTC.
+const (
+	Minute Granularity = "minute"
+	Hour   Granularity = "hour"
+	Day    Granularity = "day"
+)
+
+// granularities are the granularities every call is counted in.
+var granularities = []Granularity{Minute, Hour, Day}
+
+// Duration returns the length of the periods of a granularity, 0 for unknown granularities.
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	case Day:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Truncate returns the start of the period of a granularity containing t, in UTC.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// latencyBounds are the upper bounds of the latency buckets, from 0.5ms growing by 25% up to
+// about a minute; the last bucket counts the longer calls.
+var latencyBounds = func() []time.Duration {
+	var bounds []time.Duration
+	for b := float64(500 * time.Microsecond); b < float64(time.Minute); b *= 1.25 {
+		bounds = append(bounds, time.Duration(b))
+	}
+	return bounds
+}()
+
+// bucketOf returns the latency bucket of a duration.
+func bucketOf(d time.Duration) int {
+	for i, b := range latencyBounds {
+		if d <= b {
+			return i
+		}
+	}
+	return len(latencyBounds)
+}
+
+// Stat counts the calls of a route by a consumer in a period.
+//
+// Fields:
+//   - Start: The start of the period, in UTC.
+//   - Route: The method and pattern of the route, e.g. "GET /users/:id".
+//   - Consumer: The API key, user ID or application calling the route.
+//   - Calls: The number of calls.
+//   - Errors: The number of calls answered with a status of 500 or above.
+//   - Latency: The total latency of the calls.
+//   - Buckets: The number of calls per latency bucket.
+type Stat struct {
+	Start    time.Time
+	Route    string
+	Consumer string
+	Calls    int64
+	Errors   int64
+	Latency  time.Duration
+	Buckets  []int64
+}
+
+// add counts a call.
+func (s *Stat) add(latency time.Duration, failed bool) {
+	if s.Buckets == nil {
+		s.Buckets = make([]int64, len(latencyBounds)+1)
+	}
+	s.Calls++
+	if failed {
+		s.Errors++
+	}
+	s.Latency += latency
+	s.Buckets[bucketOf(latency)]++
+}
+
+// Merge adds the calls of another stat.
+func (s *Stat) Merge(o *Stat) {
+	if s.Buckets == nil {
+		s.Buckets = make([]int64, len(latencyBounds)+1)
+	}
+	s.Calls += o.Calls
+	s.Errors += o.Errors
+	s.Latency += o.Latency
+	for i, n := range o.Buckets {
+		if i < len(s.Buckets) {
+			s.Buckets[i] += n
+		}
+	}
+}
+
+// Mean returns the mean latency of the calls.
+func (s *Stat) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(s.Calls)
+}
+
+// Percentile estimates a latency percentile of the calls, such as 0.99 for the 99th, by
+// interpolating within its bucket. Calls longer than the last bucket are reported at its
+// lower bound.
+func (s *Stat) Percentile(p float64) time.Duration {
+	var total int64
+	for _, n := range s.Buckets {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := p * float64(total)
+	var seen int64
+	for i, n := range s.Buckets {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower := time.Duration(0)
+		if i > 0 {
+			lower = latencyBounds[i-1]
+		}
+		if i == len(latencyBounds) {
+			return lower
+		}
+		frac := (rank - float64(seen)) / float64(n)
+		return lower + time.Duration(frac*float64(latencyBounds[i]-lower))
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
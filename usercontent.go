@@ -0,0 +1,261 @@
+package mist
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// userContentPolicy is the Content-Security-Policy of user content: nothing is loaded or run,
+// and documents opened directly are sandboxed into an opaque origin.
+const userContentPolicy = "default-src 'none'; img-src data:; style-src 'unsafe-inline'; sandbox"
+
+// maxSVGSize is the size of the largest SVG sanitized; larger ones are downloaded.
+const maxSVGSize = 4 << 20
+
+// UserContentHandler serves files uploaded by users without letting them attack the other
+// users of the site, e.g. with an HTML page or a scripted SVG uploaded as a picture:
+//   - every response carries X-Content-Type-Options: nosniff and a sandboxing
+//     Content-Security-Policy,
+//   - files are displayed inline only when their type, by extension, is a safe type such as
+//     an image and their content sniffs as that type; others are downloaded as
+//     application/octet-stream with Content-Disposition: attachment,
+//   - SVG images are displayed after their active content is stripped with SanitizeSVG,
+//   - with SetContentHost, files are only served from a separate, cookie-less domain.
+type UserContentHandler struct {
+	dir         string
+	inlineTypes map[string]bool
+	sanitizeSVG bool
+	contentHost string
+}
+
+// InitUserContentHandler creates a UserContentHandler serving the files of dir at the path
+// parameter "file", displaying PNG, JPEG, GIF, WebP and AVIF images, MP4 and WebM videos, MP3,
+// Ogg and WAV audio and sanitized SVG images inline.
+//
+// Example:
+//
+//	uploads := mist.InitUserContentHandler("/var/uploads").SetContentHost("usercontent.example.net")
+//	server.GET("/uploads/:file", uploads.Handle)
+//
+// Parameters:
+//   - dir: The directory of the uploaded files.
+//
+// Returns:
+//   - *UserContentHandler: The initialized handler.
+func InitUserContentHandler(dir string) *UserContentHandler {
+	h := &UserContentHandler{dir: dir, inlineTypes: make(map[string]bool), sanitizeSVG: true}
+	h.SetInlineTypes("image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+		"video/mp4", "video/webm", "audio/mpeg", "audio/ogg", "audio/wav")
+	return h
+}
+
+// SetInlineTypes sets the media types displayed inline, replacing the default ones. Types able
+// to run scripts, such as text/html, application/xhtml+xml or application/pdf, should never be
+// listed.
+func (h *UserContentHandler) SetInlineTypes(types ...string) *UserContentHandler {
+	h.inlineTypes = make(map[string]bool, len(types))
+	for _, t := range types {
+		h.inlineTypes[strings.ToLower(t)] = true
+	}
+	return h
+}
+
+// SetSanitizeSVG sets whether SVG images are displayed after sanitization, or downloaded.
+func (h *UserContentHandler) SetSanitizeSVG(sanitize bool) *UserContentHandler {
+	h.sanitizeSVG = sanitize
+	return h
+}
+
+// SetContentHost sets the domain the files are served from, e.g. "usercontent.example.net",
+// which must not share cookies with the site. Requests on other hosts are redirected there,
+// and the Set-Cookie headers set by middleware are dropped.
+func (h *UserContentHandler) SetContentHost(host string) *UserContentHandler {
+	h.contentHost = strings.ToLower(host)
+	return h
+}
+
+// Handle serves the file named by the path parameter "file".
+func (h *UserContentHandler) Handle(ctx *Context) {
+	file, err := ctx.PathValue("file").String()
+	if err != nil {
+		ctx.RespStatusCode = http.StatusBadRequest
+		ctx.RespData = []byte("Request path error")
+		return
+	}
+	header := ctx.ResponseWriter.Header()
+	if h.contentHost != "" {
+		if !strings.EqualFold(ctx.Request.Host, h.contentHost) {
+			target := "https://" + h.contentHost + ctx.Request.URL.RequestURI()
+			http.Redirect(ctx.ResponseWriter, ctx.Request, target, http.StatusMovedPermanently)
+			return
+		}
+		header.Del("Set-Cookie")
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Content-Security-Policy", userContentPolicy)
+
+	// Rooting the path before cleaning it keeps it inside the directory.
+	dst := filepath.Join(h.dir, filepath.Clean("/"+file))
+	f, err := os.Open(dst)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusNotFound
+		ctx.RespData = []byte("File not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		ctx.RespStatusCode = http.StatusNotFound
+		ctx.RespData = []byte("File not found")
+		return
+	}
+
+	name := filepath.Base(dst)
+	declared, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name)))
+	var content io.ReadSeeker = f
+	switch {
+	case declared == "image/svg+xml" && h.sanitizeSVG && info.Size() <= maxSVGSize:
+		data, err := io.ReadAll(f)
+		if err == nil {
+			data, err = SanitizeSVG(data)
+		}
+		if err != nil {
+			h.attach(header, name)
+			break
+		}
+		content = bytes.NewReader(data)
+		h.inline(header, declared, name)
+	case h.inlineTypes[declared] && h.sniffs(f, declared):
+		h.inline(header, declared, name)
+	default:
+		h.attach(header, name)
+	}
+	http.ServeContent(ctx.ResponseWriter, ctx.Request, "", info.ModTime(), content)
+}
+
+// sniffs reports whether the content of a file does not contradict its declared type: content
+// sniffed as another kind of media, e.g. an HTML page named picture.png, is not displayed.
+func (h *UserContentHandler) sniffs(f *os.File, declared string) bool {
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if sniffed == "application/octet-stream" {
+		// Many audio and video containers are not recognized.
+		return !strings.HasPrefix(declared, "image/")
+	}
+	kind, _, _ := strings.Cut(declared, "/")
+	sniffedKind, _, _ := strings.Cut(sniffed, "/")
+	return kind == sniffedKind || (kind == "audio" && sniffed == "video/webm") ||
+		(kind == "video" && sniffed == "audio/mpeg")
+}
+
+// inline sets the headers of a file displayed inline.
+func (h *UserContentHandler) inline(header http.Header, contentType string, name string) {
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+}
+
+// attach sets the headers of a file downloaded.
+func (h *UserContentHandler) attach(header http.Header, name string) {
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// svgBlockedElements are the SVG elements dropped with their content by SanitizeSVG.
+var svgBlockedElements = map[string]bool{
+	"script": true, "foreignobject": true, "iframe": true, "embed": true, "object": true,
+	"handler": true, "listener": true, "set": true, "animate": true, "animatemotion": true,
+	"animatetransform": true, "animatecolor": true,
+}
+
+// svgEscaper escapes the text and the attribute values written by SanitizeSVG.
+var svgEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;")
+
+// SanitizeSVG strips the active content of an SVG image: scripts, event handler attributes,
+// embedded documents, animations able to rewrite links, links other than to fragments and
+// inline images, comments, processing instructions and DTDs, whose entities could smuggle
+// any of these. What remains renders as it did.
+//
+// Parameters:
+//   - data: The SVG image.
+//
+// Returns:
+//   - []byte: The sanitized image.
+//   - error: An error if the image is not well-formed XML.
+func SanitizeSVG(data []byte) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	skip := 0
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || svgBlockedElements[strings.ToLower(t.Name.Local)] {
+				skip++
+				continue
+			}
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if !safeSVGAttr(attr) {
+					continue
+				}
+				out.WriteString(" " + qualifiedName(attr.Name) + `="`)
+				out.WriteString(svgEscaper.Replace(attr.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			out.WriteString("</" + qualifiedName(t.Name) + ">")
+		case xml.CharData:
+			if skip == 0 {
+				out.WriteString(svgEscaper.Replace(string(t)))
+			}
+		}
+	}
+	if skip != 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return out.Bytes(), nil
+}
+
+// safeSVGAttr reports whether an SVG attribute is kept by SanitizeSVG.
+func safeSVGAttr(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	value := strings.ToLower(strings.Join(strings.Fields(attr.Value), ""))
+	if strings.HasPrefix(name, "on") || strings.Contains(value, "javascript:") {
+		return false
+	}
+	if name == "href" || name == "src" {
+		return strings.HasPrefix(value, "#") ||
+			(strings.HasPrefix(value, "data:image/") && !strings.HasPrefix(value, "data:image/svg"))
+	}
+	return true
+}
+
+// qualifiedName returns a name of a raw XML token with its prefix.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
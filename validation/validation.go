@@ -0,0 +1,240 @@
+// Package validation checks struct values against rules declared in `validate` struct tags
+// and reports violations with stable error codes from the errcode catalog.
+//
+// Supported rules, separated by commas:
+//
+//	required      the value must not be the zero value
+//	min=N, max=N  numbers are compared by value, strings/slices/maps by length
+//	len=N         strings/slices/maps must have exactly N elements
+//	email         the string must be an email address
+//	url           the string must be an absolute URL
+//	oneof=a b c   the value must be one of the space separated options
+//
+// Nested structs, pointers to structs and slices of structs are validated recursively; field
+// paths use the JSON names of the fields ("address.city", "items[0].sku").
+package validation
+
+import (
+	"fmt"
+	"github.com/dormoron/mist/errcode"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a single rule violation.
+//
+// Fields:
+//   - Field: The path of the offending field, using JSON names.
+//   - Code: The errcode catalog code of the violated rule.
+//   - Param: The rule parameter, e.g. "3" for "min=3".
+type FieldError struct {
+	Field string
+	Code  string
+	Param string
+}
+
+// Error implements the error interface.
+func (e FieldError) Error() string {
+	if e.Param != "" {
+		return fmt.Sprintf("%s: %s(%s)", e.Field, e.Code, e.Param)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Code)
+}
+
+// Params returns the message parameters of the violation for catalog localization.
+func (e FieldError) Params() map[string]any {
+	return map[string]any{"field": e.Field, "param": e.Param}
+}
+
+// Errors is the list of violations found in a value. It is returned as the error of Validate.
+type Errors []FieldError
+
+// Error implements the error interface.
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return "validation: " + strings.Join(msgs, "; ")
+}
+
+// Validatable may be implemented by types that need checks beyond struct tags. Validate calls
+// it after the tag rules of the value passed without errors.
+type Validatable interface {
+	Validate() error
+}
+
+// Validate checks v against its `validate` tags.
+//
+// Parameters:
+//   - v: A struct, or a pointer to one. Other values are accepted and never fail.
+//
+// Returns:
+//   - error: nil when v is valid, Errors listing every violation otherwise, or the error
+//     returned by a Validatable implementation.
+func Validate(v any) error {
+	var es Errors
+	validateValue(reflect.ValueOf(v), "", &es)
+	if len(es) > 0 {
+		return es
+	}
+	if val, ok := v.(Validatable); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// validateValue recursively validates structs and collections of structs.
+func validateValue(v reflect.Value, path string, es *Errors) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			fieldPath := joinPath(path, fieldName(sf), sf.Anonymous)
+			if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+				checkRules(fv, fieldPath, tag, es)
+			}
+			validateValue(fv, fieldPath, es)
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", es)
+		}
+	}
+}
+
+// checkRules evaluates every rule of a tag against a field value.
+func checkRules(v reflect.Value, path string, tag string, es *Errors) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" {
+			continue
+		}
+		if name != "required" && isZero(v) {
+			// Optional fields are only checked when present.
+			continue
+		}
+		if code, ok := check(v, name, param); !ok {
+			*es = append(*es, FieldError{Field: path, Code: code, Param: param})
+			if name == "required" {
+				return
+			}
+		}
+	}
+}
+
+// check evaluates a single rule, returning the catalog code of the rule and whether it passed.
+// Unknown rules are ignored.
+func check(v reflect.Value, name string, param string) (string, bool) {
+	switch name {
+	case "required":
+		return errcode.CodeRequired, !isZero(v)
+	case "min":
+		return errcode.CodeMin, compare(v, param, func(a, b float64) bool { return a >= b })
+	case "max":
+		return errcode.CodeMax, compare(v, param, func(a, b float64) bool { return a <= b })
+	case "len":
+		return errcode.CodeLen, compare(v, param, func(a, b float64) bool { return a == b })
+	case "email":
+		s := indirect(v)
+		if s.Kind() != reflect.String {
+			return errcode.CodeEmail, false
+		}
+		addr, err := mail.ParseAddress(s.String())
+		return errcode.CodeEmail, err == nil && addr.Address == s.String()
+	case "url":
+		s := indirect(v)
+		if s.Kind() != reflect.String {
+			return errcode.CodeURL, false
+		}
+		u, err := url.Parse(s.String())
+		return errcode.CodeURL, err == nil && u.Scheme != "" && u.Host != ""
+	case "oneof":
+		val := fmt.Sprint(indirect(v).Interface())
+		for _, opt := range strings.Fields(param) {
+			if opt == val {
+				return errcode.CodeOneOf, true
+			}
+		}
+		return errcode.CodeOneOf, false
+	}
+	return "", true
+}
+
+// compare measures v (by value for numbers, by length otherwise) and compares it to param.
+func compare(v reflect.Value, param string, cmp func(a, b float64) bool) bool {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false
+	}
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp(float64(v.Int()), limit)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp(float64(v.Uint()), limit)
+	case reflect.Float32, reflect.Float64:
+		return cmp(v.Float(), limit)
+	case reflect.String:
+		return cmp(float64(len([]rune(v.String()))), limit)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return cmp(float64(v.Len()), limit)
+	}
+	return false
+}
+
+// indirect dereferences pointers and interfaces.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// isZero reports whether v holds the zero value of its type; empty collections count as zero.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Invalid:
+		return true
+	}
+	return v.IsZero()
+}
+
+// fieldName returns the JSON name of a struct field.
+func fieldName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+// joinPath appends a field name to a path. Embedded structs do not add a path segment.
+func joinPath(path string, name string, embedded bool) string {
+	if embedded {
+		return path
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -3,6 +3,7 @@ package mist
 import (
 	"encoding/json"
 	"errors"
+	"github.com/dormoron/mist/i18n"
 	"github.com/dormoron/mist/internal/errs"
 	"reflect"
 	"strconv"
@@ -742,18 +743,64 @@ func (av AnyValue) String() (string, error) {
 	return val, nil
 }
 
+// FormatOption configures how AsString writes numbers.
+type FormatOption func(opts *formatOptions)
+
+// formatOptions holds the settings applied by FormatOption values.
+type formatOptions struct {
+	format byte
+	prec   int
+	locale string
+}
+
+// WithFloatFormat sets the strconv format and precision used for floating-point values. The
+// default is 'g' with precision -1, the shortest representation that reads back exactly.
+//
+// Parameters:
+//   - format: A strconv.FormatFloat format such as 'f', 'e' or 'g'.
+//   - prec: The precision, or -1 for the smallest number of digits necessary.
+func WithFloatFormat(format byte, prec int) FormatOption {
+	return func(opts *formatOptions) {
+		opts.format = format
+		opts.prec = prec
+	}
+}
+
+// WithNumberLocale writes numbers with the decimal and group separators of locale using the
+// i18n package, e.g. "1.234,5" for 1234.5 in German. Localized floats are always written in
+// positional notation with the precision set by WithFloatFormat.
+//
+// Parameters:
+//   - locale: The locale of the reader, typically Context.Locale().
+func WithNumberLocale(locale string) FormatOption {
+	return func(opts *formatOptions) {
+		opts.locale = locale
+	}
+}
+
 // AsString tries to convert various numeric and slice types to a string representation.
 // If av.Err is not nil, the function returns the error immediately.
 // It uses reflection to handle different types such as uint, int, float32, float64, and byte slices ([]byte).
+// Floats are written in their shortest exact form ("3.14", not "3.1400000000") unless
+// options say otherwise.
 //
-// Parameters: None
+// Parameters:
+// - opts ...FormatOption: Optional settings for numbers, see WithFloatFormat and WithNumberLocale.
 // Returns:
 // - string: The string value after conversion.
 // - error: An optional error if something went wrong during type assertion or conversion, or if av.Err is not nil.
-func (av AnyValue) AsString() (string, error) {
+func (av AnyValue) AsString(opts ...FormatOption) (string, error) {
 	if av.Err != nil {
 		return "", av.Err
 	}
+	if av.Val == nil {
+		return "", errs.ErrInvalidType("string", av.Val)
+	}
+
+	options := formatOptions{format: 'g', prec: -1}
+	for _, opt := range opts {
+		opt(&options)
+	}
 
 	var val string
 	valueOf := reflect.ValueOf(av.Val)
@@ -761,13 +808,27 @@ func (av AnyValue) AsString() (string, error) {
 	case reflect.String:
 		val = valueOf.String()
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if options.locale != "" {
+			return i18n.FormatUnsigned(options.locale, valueOf.Uint()), nil
+		}
 		val = strconv.FormatUint(valueOf.Uint(), 10)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if options.locale != "" {
+			return i18n.FormatInteger(options.locale, valueOf.Int()), nil
+		}
 		val = strconv.FormatInt(valueOf.Int(), 10)
-	case reflect.Float32:
-		val = strconv.FormatFloat(valueOf.Float(), 'f', 10, 32)
-	case reflect.Float64:
-		val = strconv.FormatFloat(valueOf.Float(), 'f', 10, 64)
+	case reflect.Float32, reflect.Float64:
+		bitSize := 64
+		if valueOf.Kind() == reflect.Float32 {
+			bitSize = 32
+		}
+		f := valueOf.Float()
+		if options.locale != "" {
+			// Round through the value's own precision so float32 values do not grow digits.
+			f, _ = strconv.ParseFloat(strconv.FormatFloat(f, 'g', -1, bitSize), 64)
+			return i18n.FormatNumber(options.locale, f, options.prec), nil
+		}
+		val = strconv.FormatFloat(f, options.format, options.prec, bitSize)
 	case reflect.Slice:
 		if valueOf.Type().Elem().Kind() != reflect.Uint8 {
 			return "", errs.ErrInvalidType("[]byte", av.Val)
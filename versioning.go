@@ -0,0 +1,338 @@
+package mist
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionResolver extracts the API version requested by a request.
+//
+// Returns:
+//   - string: The requested version, e.g. "v2".
+//   - bool: false if the request does not specify a version.
+type VersionResolver func(ctx *Context) (string, bool)
+
+// VersionFromHeader resolves the version from a request header holding the bare version,
+// e.g. "API-Version: v2" or "API-Version: 2".
+func VersionFromHeader(name string) VersionResolver {
+	return func(ctx *Context) (string, bool) {
+		return normalizeVersion(ctx.Request.Header.Get(name))
+	}
+}
+
+// VersionFromQuery resolves the version from a query parameter, e.g. "?version=2".
+func VersionFromQuery(param string) VersionResolver {
+	return func(ctx *Context) (string, bool) {
+		return normalizeVersion(ctx.Request.URL.Query().Get(param))
+	}
+}
+
+// VersionFromAccept resolves the version from a vendor media type in the Accept header, e.g.
+// "Accept: application/vnd.acme.v2+json" for the vendor "acme".
+func VersionFromAccept(vendor string) VersionResolver {
+	pattern := regexp.MustCompile(`application/vnd\.` + regexp.QuoteMeta(vendor) + `\.(v?[0-9][0-9.]*)(\+[a-z]+)?`)
+	return func(ctx *Context) (string, bool) {
+		match := pattern.FindStringSubmatch(ctx.Request.Header.Get("Accept"))
+		if match == nil {
+			return "", false
+		}
+		return normalizeVersion(match[1])
+	}
+}
+
+// Deprecation describes the retirement of an API version or of a route. Responses served by a
+// deprecated version or route carry the Deprecation, Sunset and Link headers of RFC 9745 and
+// RFC 8594.
+//
+// Fields:
+//   - Since: When the deprecation took effect; zero emits "Deprecation: true".
+//   - Sunset: When the version or route stops being served; zero omits the Sunset header.
+//   - Link: A URL documenting the deprecation or the migration path.
+//   - Replacement: The version or route to use instead, used in logs and documentation.
+type Deprecation struct {
+	Since       time.Time
+	Sunset      time.Time
+	Link        string
+	Replacement string
+}
+
+// apply writes the deprecation headers to h.
+func (d Deprecation) apply(h http.Header) {
+	if d.Since.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		h.Add("Link", "<"+d.Link+`>; rel="deprecation"`)
+	}
+}
+
+// Versioning configures how requests are matched to the versions registered with
+// Version. It is plugged into the server with ServerWithVersioning.
+//
+// A route registered for several versions is served under its plain path, where the
+// version is resolved by the resolvers in order. When no resolver finds a version the default
+// version is served; when the requested version has no handler, the newest registered version
+// older than it is served, so clients asking for "v3" keep working on routes that did not
+// change since "v2". With path prefixes enabled, every version is also served under
+// "/<version><path>".
+type Versioning struct {
+	mutex        sync.RWMutex
+	defaultVer   string
+	resolvers    []VersionResolver
+	pathPrefix   bool
+	deprecations map[string]Deprecation
+}
+
+// InitVersioning creates a Versioning serving defaultVersion to requests that do not ask
+// for a version. Versions are resolved from the "API-Version" header until SetResolvers is
+// called.
+//
+// Parameters:
+//   - defaultVersion: The version served by default, e.g. "v1".
+//
+// Returns:
+//   - *Versioning: The initialized configuration.
+func InitVersioning(defaultVersion string) *Versioning {
+	def, _ := normalizeVersion(defaultVersion)
+	return &Versioning{
+		defaultVer:   def,
+		resolvers:    []VersionResolver{VersionFromHeader("API-Version")},
+		deprecations: make(map[string]Deprecation),
+	}
+}
+
+// SetResolvers replaces the resolvers consulted, in order, for the requested version.
+func (v *Versioning) SetResolvers(resolvers ...VersionResolver) *Versioning {
+	v.resolvers = resolvers
+	return v
+}
+
+// SetPathPrefix sets whether versioned routes are also registered under "/<version><path>".
+// It must be set before routes are registered.
+func (v *Versioning) SetPathPrefix(enabled bool) *Versioning {
+	v.pathPrefix = enabled
+	return v
+}
+
+// Deprecate marks a version as deprecated. Every response it serves then carries the
+// deprecation headers described by d.
+func (v *Versioning) Deprecate(version string, d Deprecation) *Versioning {
+	version, _ = normalizeVersion(version)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.deprecations[version] = d
+	return v
+}
+
+// deprecation returns the deprecation of a version.
+func (v *Versioning) deprecation(version string) (Deprecation, bool) {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+	d, ok := v.deprecations[version]
+	return d, ok
+}
+
+// resolve returns the version requested by ctx.
+func (v *Versioning) resolve(ctx *Context) string {
+	for _, r := range v.resolvers {
+		if version, ok := r(ctx); ok {
+			return version
+		}
+	}
+	return v.defaultVer
+}
+
+// ServerWithVersioning is a configuration function that returns an HTTPServerOption.
+// It sets how the versions of routes registered with Version are resolved and retired.
+// Servers without a configuration use InitVersioning("v1").
+//
+// Parameters:
+//   - versioning: The versioning configuration.
+//
+// Returns:
+//   - HTTPServerOption: A function that configures the server with the specified versioning.
+func ServerWithVersioning(versioning *Versioning) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.versioning = versioning
+	}
+}
+
+// versionedRoute holds the handlers of one method and path, keyed by version.
+type versionedRoute struct {
+	mutex    sync.RWMutex
+	handlers map[string]HandleFunc
+	versions []string // Registered versions, oldest first.
+}
+
+// pick returns the version serving a request for version, and its handler.
+func (vr *versionedRoute) pick(version string, def string) (string, HandleFunc, bool) {
+	vr.mutex.RLock()
+	defer vr.mutex.RUnlock()
+	if h, ok := vr.handlers[version]; ok {
+		return version, h, true
+	}
+	for i := len(vr.versions) - 1; i >= 0; i-- {
+		if compareVersions(vr.versions[i], version) < 0 {
+			return vr.versions[i], vr.handlers[vr.versions[i]], true
+		}
+	}
+	if h, ok := vr.handlers[def]; ok {
+		return def, h, true
+	}
+	return "", nil, false
+}
+
+// versionGroup registers routes for a single API version. It is created with Version.
+type versionGroup struct {
+	group   *routerGroup
+	version string
+}
+
+// Version returns a registrar for the routes of an API version under the group's prefix.
+//
+// Example:
+//
+//	api := server.Group("/api")
+//	api.Version("v1").GET("/users", listUsersV1)
+//	api.Version("v2").GET("/users", listUsersV2)
+//
+// Parameters:
+//   - version: The version, e.g. "v2". A bare number such as "2" is read as "v2".
+func (g *routerGroup) Version(version string) *versionGroup {
+	version, _ = normalizeVersion(version)
+	return &versionGroup{group: g, version: version}
+}
+
+// Version returns a registrar for the routes of an API version at the root of the server.
+// See routerGroup.Version.
+func (r *router) Version(version string) *versionGroup {
+	return (&routerGroup{router: r}).Version(version)
+}
+
+// GET registers a GET handler for the version.
+func (vg *versionGroup) GET(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodGet, path, handler, ms...)
+}
+
+// HEAD registers a HEAD handler for the version.
+func (vg *versionGroup) HEAD(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodHead, path, handler, ms...)
+}
+
+// POST registers a POST handler for the version.
+func (vg *versionGroup) POST(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodPost, path, handler, ms...)
+}
+
+// PUT registers a PUT handler for the version.
+func (vg *versionGroup) PUT(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodPut, path, handler, ms...)
+}
+
+// PATCH registers a PATCH handler for the version.
+func (vg *versionGroup) PATCH(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodPatch, path, handler, ms...)
+}
+
+// DELETE registers a DELETE handler for the version.
+func (vg *versionGroup) DELETE(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodDelete, path, handler, ms...)
+}
+
+// OPTIONS registers an OPTIONS handler for the version.
+func (vg *versionGroup) OPTIONS(path string, handler HandleFunc, ms ...Middleware) {
+	vg.register(http.MethodOptions, path, handler, ms...)
+}
+
+// register adds the handler of the version to the dispatcher of method and path, registering
+// the dispatcher route the first time the method and path are seen.
+func (vg *versionGroup) register(method string, path string, handler HandleFunc, ms ...Middleware) {
+	g, r := vg.group, vg.group.router
+	for i := len(ms) - 1; i >= 0; i-- {
+		handler = ms[i](skipAborted(handler))
+	}
+	version := vg.version
+
+	key := method + " " + g.calculateFullPath(path)
+	vr, ok := r.versioned[key]
+	if !ok {
+		vr = &versionedRoute{handlers: make(map[string]HandleFunc)}
+		r.versioned[key] = vr
+		g.registerRoute(method, path, func(ctx *Context) {
+			cfg := r.versioning
+			served, h, found := vr.pick(cfg.resolve(ctx), cfg.defaultVer)
+			if !found {
+				_ = ctx.RespondProblem(Problem{Status: http.StatusNotFound})
+				return
+			}
+			serveVersion(ctx, cfg, served, h)
+		})
+	}
+
+	vr.mutex.Lock()
+	if _, exists := vr.handlers[version]; !exists {
+		vr.versions = append(vr.versions, version)
+		for i := len(vr.versions) - 1; i > 0 && compareVersions(vr.versions[i], vr.versions[i-1]) < 0; i-- {
+			vr.versions[i], vr.versions[i-1] = vr.versions[i-1], vr.versions[i]
+		}
+	}
+	vr.handlers[version] = handler
+	vr.mutex.Unlock()
+
+	if r.versioning.pathPrefix {
+		g.registerRoute(method, "/"+version+path, func(ctx *Context) {
+			serveVersion(ctx, r.versioning, version, handler)
+		})
+	}
+}
+
+// serveVersion runs the handler of a version, emitting its deprecation headers.
+func serveVersion(ctx *Context, cfg *Versioning, version string, handler HandleFunc) {
+	if d, ok := cfg.deprecation(version); ok {
+		d.apply(ctx.ResponseWriter.Header())
+	}
+	handler(ctx)
+}
+
+// normalizeVersion trims a version and prefixes bare numbers with "v".
+func normalizeVersion(version string) (string, bool) {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if version == "" {
+		return "", false
+	}
+	if version[0] >= '0' && version[0] <= '9' {
+		version = "v" + version
+	}
+	return version, true
+}
+
+// compareVersions orders versions such as "v2" and "v2.1" numerically.
+func compareVersions(a string, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package mist
+
+// ViewData is the data of a rendered template, keyed by the names templates refer to, e.g.
+// {{.User.Name}}.
+type ViewData map[string]any
+
+// ViewContributor adds common entries to the view data of a request, such as the current user
+// or the flash messages shown by a layout. Contributors run once per request, when the view
+// data is first needed, so that requests rendering no template do not pay for them; flash
+// messages, for one, stay pending for the next page.
+type ViewContributor func(ctx *Context, data ViewData)
+
+// AddViewContributors registers contributors of the view data of the request, run in order
+// after those already registered. Middleware such as viewdata registers them, so that every
+// route of a group renders with the same layout data.
+//
+// Parameters:
+//   - contributors: The contributors.
+func (c *Context) AddViewContributors(contributors ...ViewContributor) {
+	c.viewContributors = append(c.viewContributors, contributors...)
+}
+
+// ViewData returns the view data of the request, running the pending contributors first. The
+// data is passed to every template rendered with Render; handlers may read it, or add entries
+// of their own.
+//
+// Returns:
+//   - ViewData: The view data; never nil.
+func (c *Context) ViewData() ViewData {
+	if c.viewData == nil {
+		c.viewData = make(ViewData)
+	}
+	for len(c.viewContributors) > 0 {
+		// Contributors may register further contributors.
+		contributor := c.viewContributors[0]
+		c.viewContributors = c.viewContributors[1:]
+		contributor(c, c.viewData)
+	}
+	return c.viewData
+}
+
+// viewDataFor returns the data of a template rendered by Render: the data of the handler
+// merged over the view data of the request when it is a map or nil, and as it is otherwise.
+func (c *Context) viewDataFor(data any) any {
+	if c.viewData == nil && len(c.viewContributors) == 0 {
+		return data
+	}
+	var own map[string]any
+	switch d := data.(type) {
+	case nil:
+	case ViewData:
+		own = d
+	case map[string]any:
+		own = d
+	default:
+		// Handlers rendering structs carry the view data in a field of their own.
+		return data
+	}
+	merged := make(ViewData, len(c.ViewData())+len(own))
+	for key, value := range c.viewData {
+		merged[key] = value
+	}
+	for key, value := range own {
+		merged[key] = value
+	}
+	return merged
+}
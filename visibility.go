@@ -0,0 +1,58 @@
+package mist
+
+import "slices"
+
+// OnlyOn restricts the route to the named listeners, see HTTPServer.Listen and ListenerName.
+// The router does not match the route on any other listener, so its requests get the 404 of an
+// unknown route: admin and debug endpoints restricted to an internal listener cannot be reached
+// from a public one, whatever the middleware. The restriction fails closed: a restricted route
+// is not served either when the server is used as a plain http.Handler. Calling OnlyOn again
+// adds listeners.
+//
+// Example:
+//
+//	server.GET("/debug/vars", expvarHandler).OnlyOn("internal")
+//
+// Parameters:
+//   - listeners: The names of the listeners serving the route.
+//
+// Returns:
+//   - *Route: The route, for chaining.
+func (r *Route) OnlyOn(listeners ...string) *Route {
+	for _, name := range listeners {
+		if !slices.Contains(r.node.listeners, name) {
+			r.node.listeners = append(r.node.listeners, name)
+		}
+	}
+	return r
+}
+
+// OnlyOn restricts the routes of the group to the named listeners, both those already
+// registered and those registered afterwards, see Route.OnlyOn.
+//
+// Example:
+//
+//	admin := server.Group("/admin").OnlyOn("internal")
+//	admin.GET("/users", listUsers)
+//
+// Parameters:
+//   - listeners: The names of the listeners serving the routes of the group.
+//
+// Returns:
+//   - *routerGroup: The group, for chaining.
+func (g *routerGroup) OnlyOn(listeners ...string) *routerGroup {
+	g.listeners = append(g.listeners, listeners...)
+	for _, route := range g.routes {
+		route.OnlyOn(listeners...)
+	}
+	return g
+}
+
+// visibleOn reports whether a route is served on the listener l, nil for requests not accepted
+// on a listener.
+func (n *node) visibleOn(l *listener) bool {
+	if len(n.listeners) == 0 {
+		return true
+	}
+	return l != nil && slices.Contains(n.listeners, l.name)
+}